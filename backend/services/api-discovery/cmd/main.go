@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,6 +18,7 @@ import (
 	"scopeapi.local/backend/services/api-discovery/internal/services"
 	"scopeapi.local/backend/shared/database/postgresql"
 	"scopeapi.local/backend/shared/logging"
+	"scopeapi.local/backend/shared/messaging/kafka"
 	"scopeapi.local/backend/shared/monitoring/health"
 )
 
@@ -56,6 +59,10 @@ func main() {
 
 	var discoveryRepo repository.DiscoveryRepositoryInterface
 	var inventoryRepo repository.InventoryRepositoryInterface
+	databaseReady := false
+
+	// Path inference is shared so manual overrides apply to discovery and specs
+	pathInference := services.NewPathInferenceEngine()
 
 	if db != nil {
 		if err := db.Ping(); err != nil {
@@ -64,18 +71,128 @@ func main() {
 			inventoryRepo = repository.NewInventoryRepository(nil)
 		} else {
 			logger.Info("Database connected successfully")
+
+			// The repositories query tables the migrations create, so a
+			// schema that cannot be brought up to date is fatal
+			migrationsDir := getEnv("DB_MIGRATIONS_DIR", "migrations")
+			applied, err := repository.NewMigrationRunner(db).RunMigrations(context.Background(), migrationsDir)
+			if err != nil {
+				logger.Fatal("Failed to run database migrations", "error", err, "dir", migrationsDir)
+			}
+			if len(applied) > 0 {
+				logger.Info("Applied database migrations", "versions", applied)
+			}
+
+			databaseReady = true
 			discoveryRepo = repository.NewDiscoveryRepository(db)
 			inventoryRepo = repository.NewInventoryRepository(db)
+
+			overrides, err := discoveryRepo.GetPathTemplateOverrides(context.Background())
+			if err != nil {
+				logger.Warn("Failed to load path template overrides", "error", err)
+			}
+			for i := range overrides {
+				if err := pathInference.SetOverride(&overrides[i]); err != nil {
+					logger.Warn("Ignoring invalid path template override", "error", err, "template", overrides[i].Template)
+				}
+			}
 		}
 	} else {
 		discoveryRepo = repository.NewDiscoveryRepository(nil)
 		inventoryRepo = repository.NewInventoryRepository(nil)
 	}
 
+	kafkaConfig := kafka.Config{
+		Brokers: strings.Split(getEnv("KAFKA_BROKERS", "localhost:9092"), ","),
+		ConsumerConfig: kafka.ConsumerConfig{
+			GroupID: getEnv("KAFKA_GROUP_ID", "api-discovery"),
+		},
+	}
+
+	// Breaking changes between generated spec versions are published to Kafka
+	kafkaProducer, err := kafka.NewProducer(kafkaConfig)
+	if err != nil {
+		logger.Fatal("Failed to initialize Kafka producer", "error", err)
+	}
+	defer kafkaProducer.Close()
+
 	// Initialize services
-	discoveryService := services.NewDiscoveryService(discoveryRepo, logger)
-	inventoryService := services.NewInventoryService(inventoryRepo, logger)
-	metadataService := services.NewMetadataService(discoveryRepo, logger)
+	discoveryService := services.NewDiscoveryService(discoveryRepo, pathInference, logger)
+	inventoryService := services.NewInventoryService(inventoryRepo, discoveryRepo, logger)
+	metadataService := services.NewMetadataService(discoveryRepo, pathInference, kafkaProducer, logger)
+
+	// Consume the traffic data-ingestion publishes for passive discovery
+	kafkaConsumer, err := kafka.NewConsumer(kafkaConfig, []string{getEnv("KAFKA_TRAFFIC_TOPIC", "api_traffic")})
+	if err != nil {
+		logger.Fatal("Failed to initialize Kafka consumer", "error", err)
+	}
+	defer kafkaConsumer.Close()
+
+	consumerCtx, stopConsumer := context.WithCancel(context.Background())
+	defer stopConsumer()
+
+	go func() {
+		for {
+			select {
+			case <-consumerCtx.Done():
+				return
+			default:
+				messages, err := kafkaConsumer.Consume(consumerCtx, 100)
+				if err != nil {
+					if consumerCtx.Err() == nil {
+						logger.Error("Failed to consume Kafka messages", "error", err)
+						time.Sleep(time.Second)
+					}
+					continue
+				}
+
+				for _, message := range messages {
+					if err := discoveryService.ObserveTraffic(consumerCtx, message.Value); err != nil {
+						logger.Warn("Failed to observe traffic", "error", err, "offset", message.Offset)
+					}
+				}
+			}
+		}
+	}()
+
+	// Compare observed traffic with imported specs, and mark endpoints without
+	// traffic stale or zombie, in the background
+	driftCtx, stopDriftMonitor := context.WithCancel(context.Background())
+	defer stopDriftMonitor()
+	if databaseReady {
+		driftInterval, err := time.ParseDuration(getEnv("SPEC_DRIFT_INTERVAL", "5m"))
+		if err != nil || driftInterval <= 0 {
+			logger.Warn("Invalid SPEC_DRIFT_INTERVAL, using 5m", "value", os.Getenv("SPEC_DRIFT_INTERVAL"))
+			driftInterval = 5 * time.Minute
+		}
+		go inventoryService.MonitorSpecDrift(driftCtx, driftInterval)
+
+		trafficInterval, err := time.ParseDuration(getEnv("ENDPOINT_TRAFFIC_INTERVAL", "1h"))
+		if err != nil || trafficInterval <= 0 {
+			logger.Warn("Invalid ENDPOINT_TRAFFIC_INTERVAL, using 1h", "value", os.Getenv("ENDPOINT_TRAFFIC_INTERVAL"))
+			trafficInterval = time.Hour
+		}
+		staleDays, err := strconv.Atoi(getEnv("STALE_ENDPOINT_DAYS", "30"))
+		if err != nil || staleDays <= 0 {
+			logger.Warn("Invalid STALE_ENDPOINT_DAYS, using 30", "value", os.Getenv("STALE_ENDPOINT_DAYS"))
+			staleDays = 30
+		}
+		zombieDays, err := strconv.Atoi(getEnv("ZOMBIE_ENDPOINT_DAYS", "90"))
+		if err != nil || zombieDays < staleDays {
+			logger.Warn("Invalid ZOMBIE_ENDPOINT_DAYS, using three times STALE_ENDPOINT_DAYS", "value", os.Getenv("ZOMBIE_ENDPOINT_DAYS"))
+			zombieDays = 3 * staleDays
+		}
+		go inventoryService.MonitorEndpointTraffic(driftCtx, trafficInterval,
+			time.Duration(staleDays)*24*time.Hour, time.Duration(zombieDays)*24*time.Hour)
+
+		// Breaking spec changes Kafka did not take stay pending until published
+		retryInterval, err := time.ParseDuration(getEnv("SPEC_CHANGE_RETRY_INTERVAL", "1m"))
+		if err != nil || retryInterval <= 0 {
+			logger.Warn("Invalid SPEC_CHANGE_RETRY_INTERVAL, using 1m", "value", os.Getenv("SPEC_CHANGE_RETRY_INTERVAL"))
+			retryInterval = time.Minute
+		}
+		go metadataService.PublishPendingSpecChanges(driftCtx, retryInterval)
+	}
 
 	// Initialize handlers
 	discoveryHandler := handlers.NewDiscoveryHandler(discoveryService, logger)
@@ -94,10 +211,25 @@ func main() {
 	{
 		v1.POST("/discovery/scan", discoveryHandler.StartDiscovery)
 		v1.GET("/discovery/status/:id", discoveryHandler.GetDiscoveryStatus)
+		v1.GET("/discovery/results/:id", discoveryHandler.GetDiscoveryResults)
+		v1.POST("/discovery/stop/:id", discoveryHandler.StopDiscovery)
+		v1.POST("/discovery/resume/:id", discoveryHandler.ResumeDiscovery)
 		v1.GET("/inventory/apis", inventoryHandler.GetAPIInventory)
 		v1.GET("/inventory/apis/:id", inventoryHandler.GetAPIDetails)
+		v1.POST("/inventory/apis/:id/spec", inventoryHandler.ImportAPISpec)
+		v1.GET("/inventory/apis/:id/spec", inventoryHandler.GetImportedSpec)
+		v1.GET("/inventory/apis/:id/drift", inventoryHandler.GetSpecDrift)
+		v1.GET("/inventory/apis/:id/export", endpointHandler.ExportAPISpec)
+		v1.GET("/inventory/apis/:id/versions", endpointHandler.GetSpecVersions)
+		v1.GET("/inventory/apis/:id/versions/:version", endpointHandler.GetSpecVersion)
+		v1.GET("/inventory/apis/:id/diff", endpointHandler.DiffSpecVersions)
+		v1.GET("/inventory/apis/:id/graphql", endpointHandler.GetGraphQLSchemas)
+		v1.GET("/inventory/apis/:id/grpc", endpointHandler.GetGRPCMethods)
+		v1.PATCH("/inventory/apis/:id/metadata", inventoryHandler.UpdateAPIMetadata)
+		v1.GET("/inventory/endpoints/:state", inventoryHandler.GetEndpointsByTrafficState)
 		v1.POST("/endpoints/analyze", endpointHandler.AnalyzeEndpoint)
 		v1.GET("/endpoints/:id/metadata", endpointHandler.GetEndpointMetadata)
+		v1.GET("/endpoints/:id/schemas", endpointHandler.GetEndpointSchemas)
 	}
 
 	// Start server
@@ -121,6 +253,10 @@ func main() {
 
 	logger.Info("Shutting down server...")
 
+	// Stop consuming traffic before the server goes away
+	stopConsumer()
+	stopDriftMonitor()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -128,5 +264,10 @@ func main() {
 		logger.Fatal("Server forced to shutdown", "error", err)
 	}
 
+	// Write the traffic observed since the last flush to the inventory
+	if err := discoveryService.Close(ctx); err != nil {
+		logger.Error("Failed to flush observed endpoints", "error", err)
+	}
+
 	logger.Info("Server exited")
 }
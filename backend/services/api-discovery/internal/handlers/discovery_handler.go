@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -121,3 +122,30 @@ func (h *DiscoveryHandler) StopDiscovery(c *gin.Context) {
 	h.logger.Info("Discovery stopped", "id", discoveryID)
 	c.JSON(http.StatusOK, gin.H{"message": "Discovery stopped successfully"})
 }
+
+// ResumeDiscovery restarts a stopped or failed active discovery from its last
+// checkpoint
+func (h *DiscoveryHandler) ResumeDiscovery(c *gin.Context) {
+	discoveryID := c.Param("id")
+	if discoveryID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Discovery ID is required"})
+		return
+	}
+
+	err := h.discoveryService.ResumeDiscovery(c.Request.Context(), discoveryID)
+	if err != nil {
+		if errors.Is(err, services.ErrDiscoveryNotResumable) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to resume discovery", "error", err, "id", discoveryID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resume discovery"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, DiscoveryResponse{
+		ID:      discoveryID,
+		Status:  "resumed",
+		Message: "Discovery process resumed from its last checkpoint",
+	})
+}
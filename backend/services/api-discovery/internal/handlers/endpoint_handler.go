@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"scopeapi.local/backend/services/api-discovery/internal/models"
@@ -73,6 +75,163 @@ func (h *EndpointHandler) GetEndpointMetadata(c *gin.Context) {
 	c.JSON(http.StatusOK, metadata)
 }
 
+func (h *EndpointHandler) GetEndpointSchemas(c *gin.Context) {
+	endpointID := c.Param("id")
+	if endpointID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Endpoint ID is required"})
+		return
+	}
+
+	schemas, err := h.metadataService.GetEndpointSchemas(c.Request.Context(), endpointID)
+	if err != nil {
+		h.logger.Error("Failed to get endpoint schemas", "error", err, "endpoint_id", endpointID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get endpoint schemas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schemas": schemas})
+}
+
+// ExportAPISpec downloads the spec generated for an API. format is json or
+// yaml for OpenAPI 3.1, postman for a Postman v2.1 collection, or har for
+// sample requests.
+func (h *EndpointHandler) ExportAPISpec(c *gin.Context) {
+	apiID := c.Param("id")
+	if apiID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API ID is required"})
+		return
+	}
+	format := c.DefaultQuery("format", services.SpecExportJSON)
+
+	export, err := h.metadataService.ExportAPISpec(c.Request.Context(), apiID, format)
+	if err != nil {
+		if errors.Is(err, services.ErrUnsupportedExportFormat) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to export API spec", "error", err, "api_id", apiID, "format", format)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export API spec"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+export.Filename+`"`)
+	c.Data(http.StatusOK, export.ContentType, export.Data)
+}
+
+// GetSpecVersions lists the stored versions of an API's generated spec
+func (h *EndpointHandler) GetSpecVersions(c *gin.Context) {
+	apiID := c.Param("id")
+	if apiID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API ID is required"})
+		return
+	}
+
+	versions, err := h.metadataService.GetSpecVersions(c.Request.Context(), apiID)
+	if err != nil {
+		h.logger.Error("Failed to get spec versions", "error", err, "api_id", apiID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get spec versions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+func (h *EndpointHandler) GetSpecVersion(c *gin.Context) {
+	apiID := c.Param("id")
+	version, err := strconv.Atoi(c.Param("version"))
+	if apiID == "" || err != nil || version <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API ID and a positive version are required"})
+		return
+	}
+
+	specVersion, err := h.metadataService.GetSpecVersion(c.Request.Context(), apiID, version)
+	if err != nil {
+		if errors.Is(err, services.ErrSpecVersionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to get spec version", "error", err, "api_id", apiID, "version", version)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get spec version"})
+		return
+	}
+
+	c.JSON(http.StatusOK, specVersion)
+}
+
+// DiffSpecVersions compares two versions of an API's spec. to defaults to
+// the latest version and from to the one before it.
+func (h *EndpointHandler) DiffSpecVersions(c *gin.Context) {
+	apiID := c.Param("id")
+	if apiID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API ID is required"})
+		return
+	}
+	var versions [2]int
+	for i, name := range []string{"from", "to"} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		version, err := strconv.Atoi(value)
+		if err != nil || version <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a positive version"})
+			return
+		}
+		versions[i] = version
+	}
+
+	diff, err := h.metadataService.DiffSpecVersions(c.Request.Context(), apiID, versions[0], versions[1])
+	if err != nil {
+		if errors.Is(err, services.ErrSpecVersionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to diff spec versions", "error", err, "api_id", apiID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to diff spec versions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// GetGraphQLSchemas lists the schemas of an API's GraphQL endpoints, with the
+// operations they serve and their risky settings
+func (h *EndpointHandler) GetGraphQLSchemas(c *gin.Context) {
+	apiID := c.Param("id")
+	if apiID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API ID is required"})
+		return
+	}
+
+	schemas, err := h.discoveryService.GetGraphQLSchemas(c.Request.Context(), apiID)
+	if err != nil {
+		h.logger.Error("Failed to get GraphQL schemas", "error", err, "api_id", apiID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get GraphQL schemas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schemas": schemas})
+}
+
+// GetGRPCMethods lists the methods of the gRPC service an API catalogues, with
+// their streaming types and message schemas
+func (h *EndpointHandler) GetGRPCMethods(c *gin.Context) {
+	apiID := c.Param("id")
+	if apiID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API ID is required"})
+		return
+	}
+
+	methods, err := h.discoveryService.GetGRPCMethods(c.Request.Context(), apiID)
+	if err != nil {
+		h.logger.Error("Failed to get gRPC methods", "error", err, "api_id", apiID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get gRPC methods"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"methods": methods})
+}
+
 func (h *EndpointHandler) UpdateEndpointMetadata(c *gin.Context) {
 	endpointID := c.Param("id")
 	if endpointID == "" {
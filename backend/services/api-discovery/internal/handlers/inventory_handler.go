@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"scopeapi.local/backend/services/api-discovery/internal/models"
 	"scopeapi.local/backend/services/api-discovery/internal/services"
 	"scopeapi.local/backend/shared/logging"
 )
@@ -89,6 +92,36 @@ func (h *InventoryHandler) UpdateAPITags(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "API tags updated successfully"})
 }
 
+// UpdateAPIMetadata sets the ownership and classification of an API; fields
+// left out of the request keep their value
+func (h *InventoryHandler) UpdateAPIMetadata(c *gin.Context) {
+	apiID := c.Param("id")
+	if apiID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API ID is required"})
+		return
+	}
+
+	var req models.APIMetadataUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Error("Invalid request payload", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	api, err := h.inventoryService.UpdateAPIMetadata(c.Request.Context(), apiID, req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAPIMetadata) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to update API metadata", "error", err, "api_id", apiID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update API metadata"})
+		return
+	}
+
+	c.JSON(http.StatusOK, api)
+}
+
 func (h *InventoryHandler) DeleteAPI(c *gin.Context) {
 	apiID := c.Param("id")
 	if apiID == "" {
@@ -117,3 +150,103 @@ func (h *InventoryHandler) GetAPIStatistics(c *gin.Context) {
 
 	c.JSON(http.StatusOK, stats)
 }
+
+// maxSpecUploadBytes bounds uploaded API descriptions
+const maxSpecUploadBytes = 16 << 20
+
+// ImportAPISpec attaches an OpenAPI or Swagger document to an API. The document
+// is sent as the request body, or as the "file" field of a multipart form.
+func (h *InventoryHandler) ImportAPISpec(c *gin.Context) {
+	apiID := c.Param("id")
+	if apiID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API ID is required"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSpecUploadBytes)
+	var document []byte
+	var err error
+	if file, header, formErr := c.Request.FormFile("file"); formErr == nil {
+		defer file.Close()
+		document, err = io.ReadAll(file)
+		h.logger.Info("Importing API spec from upload", "api_id", apiID, "filename", header.Filename)
+	} else {
+		document, err = io.ReadAll(c.Request.Body)
+	}
+	if err != nil {
+		h.logger.Error("Failed to read API spec", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read API spec"})
+		return
+	}
+
+	imported, err := h.inventoryService.ImportAPISpec(c.Request.Context(), apiID, document)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSpec) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to import API spec", "error", err, "api_id", apiID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import API spec"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, imported)
+}
+
+func (h *InventoryHandler) GetImportedSpec(c *gin.Context) {
+	apiID := c.Param("id")
+	if apiID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API ID is required"})
+		return
+	}
+
+	imported, err := h.inventoryService.GetImportedSpec(c.Request.Context(), apiID)
+	if err != nil {
+		h.logger.Error("Failed to get imported spec", "error", err, "api_id", apiID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "No spec imported for API"})
+		return
+	}
+
+	c.JSON(http.StatusOK, imported)
+}
+
+// GetSpecDrift reports how observed traffic departs from the imported spec;
+// refresh=true compares them again instead of returning the last report
+func (h *InventoryHandler) GetSpecDrift(c *gin.Context) {
+	apiID := c.Param("id")
+	if apiID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API ID is required"})
+		return
+	}
+	refresh, _ := strconv.ParseBool(c.DefaultQuery("refresh", "false"))
+
+	report, err := h.inventoryService.GetSpecDrift(c.Request.Context(), apiID, refresh)
+	if err != nil {
+		h.logger.Error("Failed to get spec drift", "error", err, "api_id", apiID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get spec drift"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetEndpointsByTrafficState lists the endpoints in a traffic state: active,
+// stale or zombie
+func (h *InventoryHandler) GetEndpointsByTrafficState(c *gin.Context) {
+	state := c.Param("state")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	endpoints, err := h.inventoryService.GetEndpointsByTrafficState(c.Request.Context(), state, page, limit)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidTrafficState) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("Failed to get endpoints by traffic state", "error", err, "traffic_state", state)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get endpoints"})
+		return
+	}
+
+	c.JSON(http.StatusOK, endpoints)
+}
@@ -115,6 +115,25 @@ type Schema struct {
 	MinItems             *int               `json:"min_items,omitempty"`
 	MaxItems             *int               `json:"max_items,omitempty"`
 	UniqueItems          bool               `json:"unique_items,omitempty"`
+	OneOf                []*Schema          `json:"one_of,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+}
+
+// EndpointSchema is one version of the request and response schemas learned
+// for an endpoint from observed JSON bodies. A new version is stored whenever
+// the structure of the learned schemas changes.
+type EndpointSchema struct {
+	ID              string             `json:"id" db:"id"`
+	EndpointID      string             `json:"endpoint_id" db:"endpoint_id"`
+	APIID           string             `json:"api_id" db:"api_id"`
+	Version         int                `json:"version" db:"version"`
+	RequestSchema   *Schema            `json:"request_schema,omitempty" db:"request_schema"`
+	ResponseSchemas map[string]*Schema `json:"response_schemas,omitempty" db:"response_schemas"` // by status code
+	SampleCount     int64              `json:"sample_count" db:"sample_count"`
+	Fingerprint     string             `json:"fingerprint" db:"fingerprint"`
+	State           []byte             `json:"-" db:"state"` // learner statistics, to resume learning
+	CreatedAt       time.Time          `json:"created_at" db:"created_at"`
 }
 
 type Example struct {
@@ -10,6 +10,7 @@ type Endpoint struct {
 	URL         string            `json:"url" db:"url"`
 	Path        string            `json:"path" db:"path"`
 	Method      string            `json:"method" db:"method"`
+	Protocol    string            `json:"protocol,omitempty" db:"protocol"` // rest, graphql, grpc
 	Headers     map[string]string `json:"headers" db:"headers"`
 	Body        string            `json:"body" db:"body"`
 	StatusCode  int               `json:"status_code" db:"status_code"`
@@ -20,6 +21,15 @@ type Endpoint struct {
 	Responses   map[string]Response `json:"responses" db:"responses"`
 	Tags        []string          `json:"tags" db:"tags"`
 	IsActive    bool              `json:"is_active" db:"is_active"`
+	DiscoveryID string            `json:"discovery_id,omitempty" db:"discovery_id"`
+	Source      string            `json:"source,omitempty" db:"source"` // passive, active
+	StatusCodes []int             `json:"status_codes,omitempty" db:"status_codes"`
+	ContentTypes []string         `json:"content_types,omitempty" db:"content_types"`
+	RequestCount int64            `json:"request_count,omitempty" db:"request_count"`
+	FirstSeen   *time.Time        `json:"first_seen,omitempty" db:"first_seen"`
+	LastSeen    *time.Time        `json:"last_seen,omitempty" db:"last_seen"`
+	LastTrafficAt *time.Time      `json:"last_traffic_at,omitempty" db:"last_traffic_at"` // last seen in observed traffic
+	TrafficState string           `json:"traffic_state,omitempty" db:"traffic_state"`     // active, stale, zombie
 	CreatedAt   time.Time         `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time         `json:"updated_at" db:"updated_at"`
 }
@@ -32,6 +42,18 @@ type Parameter struct {
 	Description string      `json:"description"`
 	Example     interface{} `json:"example,omitempty"`
 	Schema      interface{} `json:"schema,omitempty"`
+	Confidence  float64     `json:"confidence,omitempty"` // for inferred path parameters
+}
+
+// PathTemplateOverride pins how the paths of an API that match Template are
+// templated, replacing what path inference learned from traffic
+type PathTemplateOverride struct {
+	ID         string      `json:"id" db:"id"`
+	APIID      string      `json:"api_id" db:"api_id"`
+	Template   string      `json:"template" db:"template"`
+	Parameters []Parameter `json:"parameters,omitempty" db:"parameters"`
+	CreatedAt  time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at" db:"updated_at"`
 }
 
 type Response struct {
@@ -73,11 +95,46 @@ type API struct {
 	Status      string    `json:"status" db:"status"`
 	Description string    `json:"description" db:"description"`
 	Tags        []string  `json:"tags" db:"tags"`
+	Owner       string    `json:"owner,omitempty" db:"owner"` // owning team
+	Contact     string    `json:"contact,omitempty" db:"contact"`
+	Environment string    `json:"environment,omitempty" db:"environment"` // prod, staging, dev
+	Lifecycle   string    `json:"lifecycle,omitempty" db:"lifecycle"`     // experimental, active, deprecated, retired
+	DataSensitivity string `json:"data_sensitivity,omitempty" db:"data_sensitivity"` // public, internal, confidential, restricted
+	LastTrafficAt *time.Time `json:"last_traffic_at,omitempty" db:"last_traffic_at"`
 	Endpoints   []Endpoint `json:"endpoints,omitempty"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// APIMetadataUpdate sets the ownership and classification of an API. Fields
+// left out keep their value; an empty string clears them.
+type APIMetadataUpdate struct {
+	Owner           *string `json:"owner"`
+	Contact         *string `json:"contact"`
+	Environment     *string `json:"environment"`
+	Lifecycle       *string `json:"lifecycle"`
+	DataSensitivity *string `json:"data_sensitivity"`
+}
+
+// EndpointTraffic is what the stale endpoint check needs to know of an endpoint
+type EndpointTraffic struct {
+	EndpointID    string
+	APIID         string
+	APILifecycle  string
+	TrafficState  string
+	LastTrafficAt *time.Time
+	CreatedAt     time.Time
+}
+
+// EndpointInventory is a page of endpoints in a given traffic state
+type EndpointInventory struct {
+	TrafficState string     `json:"traffic_state"`
+	Total        int        `json:"total"`
+	Page         int        `json:"page"`
+	Limit        int        `json:"limit"`
+	Endpoints    []Endpoint `json:"endpoints"`
+}
+
 type Discovery struct {
 	ID             string           `json:"id" db:"id"`
 	Target         string           `json:"target" db:"target"`
@@ -89,10 +146,28 @@ type Discovery struct {
 	EndpointsFound int              `json:"endpoints_found" db:"endpoints_found"`
 	ErrorMessage   string           `json:"error_message,omitempty" db:"error_message"`
 	Config         *DiscoveryConfig `json:"config" db:"config"`
+	Checkpoint     *CrawlCheckpoint `json:"checkpoint,omitempty" db:"checkpoint"`
 	CreatedAt      time.Time        `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time        `json:"updated_at" db:"updated_at"`
 }
 
+// CrawlCheckpoint is the saved state of an active discovery run, so a stopped
+// run can resume where it left off
+type CrawlCheckpoint struct {
+	Queue    []CrawlRequest `json:"queue"`
+	Visited  []string       `json:"visited"` // method and URL of every request sent
+	Found    []string       `json:"found"`   // method and path of every endpoint found
+	Requests int            `json:"requests"`
+}
+
+// CrawlRequest is a request the crawler has still to send
+type CrawlRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Depth  int    `json:"depth"`
+	Source string `json:"source"` // seed, link, robots, sitemap, openapi, wordlist, probe
+}
+
 type DiscoveryConfig struct {
 	Target      string            `json:"target"`
 	Method      string            `json:"method"`
@@ -143,6 +218,8 @@ type APIStats struct {
 	TotalEndpoints    int `json:"total_endpoints"`
 	ActiveEndpoints   int `json:"active_endpoints"`
 	InactiveEndpoints int `json:"inactive_endpoints"`
+	StaleEndpoints    int `json:"stale_endpoints"`
+	ZombieEndpoints   int `json:"zombie_endpoints"`
 	LastScanned       *time.Time `json:"last_scanned,omitempty"`
 }
 
@@ -154,4 +231,8 @@ type APIStatistics struct {
 	RecentDiscoveries int            `json:"recent_discoveries"`
 	ProtocolBreakdown map[string]int `json:"protocol_breakdown"`
 	StatusBreakdown   map[string]int `json:"status_breakdown"`
+	// Endpoints by protocol: rest, graphql or grpc
+	EndpointProtocolBreakdown map[string]int `json:"endpoint_protocol_breakdown"`
+	// Endpoints by traffic state: active, stale or zombie
+	EndpointTrafficBreakdown map[string]int `json:"endpoint_traffic_breakdown"`
 }
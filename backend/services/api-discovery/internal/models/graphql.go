@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+)
+
+// GraphQLSchema is what is known about the schema served at one GraphQL
+// endpoint. Source is "introspection" when the server answered an
+// introspection query, or "observed" when the schema was reconstructed from
+// the queries and responses seen in traffic.
+type GraphQLSchema struct {
+	ID                   string             `json:"id" db:"id"`
+	APIID                string             `json:"api_id" db:"api_id"`
+	URL                  string             `json:"url" db:"url"`
+	Path                 string             `json:"path" db:"path"`
+	Source               string             `json:"source" db:"source"`
+	Environment          string             `json:"environment" db:"environment"`
+	Operations           []GraphQLOperation `json:"operations" db:"operations"`
+	Types                []GraphQLType      `json:"types" db:"types"`
+	Findings             []GraphQLFinding   `json:"findings" db:"findings"`
+	IntrospectionEnabled bool               `json:"introspection_enabled" db:"introspection_enabled"`
+	BatchingEnabled      bool               `json:"batching_enabled" db:"batching_enabled"`
+	MaxDepth             int                `json:"max_depth" db:"max_depth"` // deepest query seen to succeed
+	RequestCount         int64              `json:"request_count" db:"request_count"`
+	FirstSeen            *time.Time         `json:"first_seen,omitempty" db:"first_seen"`
+	LastSeen             *time.Time         `json:"last_seen,omitempty" db:"last_seen"`
+	CreatedAt            time.Time          `json:"created_at" db:"created_at"`
+	UpdatedAt            time.Time          `json:"updated_at" db:"updated_at"`
+}
+
+// GraphQLOperation is a root field of the query, mutation or subscription
+// type. Types are in SDL notation, such as "[ID!]!".
+type GraphQLOperation struct {
+	Type         string            `json:"type"`
+	Name         string            `json:"name"`
+	Arguments    []GraphQLArgument `json:"arguments,omitempty"`
+	ReturnType   string            `json:"return_type,omitempty"`
+	Deprecated   bool              `json:"deprecated,omitempty"`
+	RequestCount int64             `json:"request_count"`
+	LastSeen     *time.Time        `json:"last_seen,omitempty"`
+}
+
+type GraphQLArgument struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+// GraphQLType is a named type of the schema. Fields holds the fields of
+// objects and interfaces and the input fields of input objects.
+type GraphQLType struct {
+	Name       string            `json:"name"`
+	Kind       string            `json:"kind"`
+	Fields     []GraphQLArgument `json:"fields,omitempty"`
+	EnumValues []string          `json:"enum_values,omitempty"`
+}
+
+// GraphQLFinding is a risky setting of a GraphQL endpoint
+type GraphQLFinding struct {
+	Type        string `json:"type"`
+	Severity    string `json:"severity"`
+	Description string `json:"description"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// GRPCMethod is a method of a gRPC service. Each gRPC service is catalogued as
+// an API of its own and each method as a POST endpoint of it, at
+// /package.Service/Method, under the same ID. Source is "reflection" when the
+// server described the method through server reflection, or "observed" when
+// it was seen in traffic.
+type GRPCMethod struct {
+	ID             string     `json:"id" db:"id"`
+	APIID          string     `json:"api_id" db:"api_id"`
+	URL            string     `json:"url" db:"url"`
+	Service        string     `json:"service" db:"service"`
+	Method         string     `json:"method" db:"method"`
+	Path           string     `json:"path" db:"path"`
+	StreamingType  string     `json:"streaming_type" db:"streaming_type"` // unary, client_streaming, server_streaming, bidi_streaming
+	RequestType    string     `json:"request_type,omitempty" db:"request_type"`
+	ResponseType   string     `json:"response_type,omitempty" db:"response_type"`
+	RequestSchema  *Schema    `json:"request_schema,omitempty" db:"request_schema"`
+	ResponseSchema *Schema    `json:"response_schema,omitempty" db:"response_schema"`
+	Source         string     `json:"source" db:"source"`
+	RequestCount   int64      `json:"request_count" db:"request_count"`
+	FirstSeen      *time.Time `json:"first_seen,omitempty" db:"first_seen"`
+	LastSeen       *time.Time `json:"last_seen,omitempty" db:"last_seen"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
@@ -17,6 +17,7 @@ type Metadata struct {
 	DataSensitivity     string                 `json:"data_sensitivity" db:"data_sensitivity"`
 	ComplianceReqs      []string               `json:"compliance_requirements" db:"compliance_requirements"`
 	Parameters          []Parameter            `json:"parameters" db:"parameters"`
+	PathTemplate        string                 `json:"path_template,omitempty" db:"-"` // set to override the inferred path template
 	ResponseSchema      map[string]interface{} `json:"response_schema" db:"response_schema"`
 	RequestSchema       map[string]interface{} `json:"request_schema" db:"request_schema"`
 	Examples            []MetadataExample      `json:"examples" db:"examples"`
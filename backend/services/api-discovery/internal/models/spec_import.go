@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+// ImportedSpec is an OpenAPI or Swagger document uploaded by an API's owners
+// and attached to the API. Observed traffic is compared against it.
+type ImportedSpec struct {
+	ID            string    `json:"id" db:"id"`
+	APIID         string    `json:"api_id" db:"api_id"`
+	Format        string    `json:"format" db:"format"`                 // openapi, swagger
+	SourceVersion string    `json:"source_version" db:"source_version"` // e.g. 3.1.0, 2.0
+	Spec          *APISpec  `json:"spec" db:"spec"`
+	Warnings      []string  `json:"warnings,omitempty" db:"warnings"`
+	ImportedAt    time.Time `json:"imported_at" db:"imported_at"`
+}
+
+// DriftReport compares the traffic observed for an API with its imported spec
+type DriftReport struct {
+	APIID                  string           `json:"api_id"`
+	SpecID                 string           `json:"spec_id"`
+	Summary                DriftSummary     `json:"summary"`
+	ShadowEndpoints        []DriftEndpoint  `json:"shadow_endpoints"`
+	ZombieEndpoints        []DriftEndpoint  `json:"zombie_endpoints"`
+	UndocumentedParameters []ParameterDrift `json:"undocumented_parameters"`
+	ResponseDrift          []ResponseDrift  `json:"response_drift"`
+	GeneratedAt            time.Time        `json:"generated_at"`
+}
+
+type DriftSummary struct {
+	DocumentedOperations   int `json:"documented_operations"`
+	ObservedEndpoints      int `json:"observed_endpoints"`
+	ShadowEndpoints        int `json:"shadow_endpoints"` // observed but not documented
+	ZombieEndpoints        int `json:"zombie_endpoints"` // documented but not used
+	UndocumentedParameters int `json:"undocumented_parameters"`
+	ResponseDrift          int `json:"response_drift"`
+}
+
+type DriftEndpoint struct {
+	Method       string     `json:"method"`
+	Path         string     `json:"path"`
+	EndpointID   string     `json:"endpoint_id,omitempty"`
+	RequestCount int64      `json:"request_count,omitempty"`
+	LastSeen     *time.Time `json:"last_seen,omitempty"`
+}
+
+type ParameterDrift struct {
+	Method     string `json:"method"`
+	Path       string `json:"path"` // documented path
+	EndpointID string `json:"endpoint_id"`
+	Name       string `json:"name"`
+	In         string `json:"in"`
+	Type       string `json:"type,omitempty"`
+}
+
+// ResponseDrift is a difference between an observed and a documented response.
+// Kind is undocumented_status, undocumented_property, missing_property or
+// type_mismatch; Field addresses the property, e.g. $.items[].id.
+type ResponseDrift struct {
+	Method     string `json:"method"`
+	Path       string `json:"path"` // documented path
+	EndpointID string `json:"endpoint_id"`
+	StatusCode string `json:"status_code"`
+	Kind       string `json:"kind"`
+	Field      string `json:"field,omitempty"`
+	Documented string `json:"documented,omitempty"`
+	Observed   string `json:"observed,omitempty"`
+}
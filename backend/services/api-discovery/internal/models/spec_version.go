@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+)
+
+// APISpecVersion is an immutable snapshot of the spec generated for an API.
+// A new version is stored whenever a generated spec differs from the last.
+type APISpecVersion struct {
+	ID          string          `json:"id" db:"id"`
+	APIID       string          `json:"api_id" db:"api_id"`
+	Version     int             `json:"version" db:"version"`
+	Spec        *APISpec        `json:"spec,omitempty" db:"spec"`
+	Fingerprint string          `json:"fingerprint" db:"fingerprint"`
+	Changes     SpecDiffSummary `json:"changes" db:"changes"` // compared with the previous version
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+}
+
+// SpecDiff lists the changes between two versions of an API's spec
+type SpecDiff struct {
+	APIID       string          `json:"api_id"`
+	FromVersion int             `json:"from_version"`
+	ToVersion   int             `json:"to_version"`
+	Summary     SpecDiffSummary `json:"summary"`
+	Changes     []SpecChange    `json:"changes"`
+}
+
+type SpecDiffSummary struct {
+	Breaking    int `json:"breaking"`
+	NonBreaking int `json:"non_breaking"`
+}
+
+// SpecChange is one difference between two spec versions. Location addresses
+// a parameter (query:limit) or a body field (request $.items[].sku,
+// response 200 $.id) of the operation.
+type SpecChange struct {
+	Type     string `json:"type"`
+	Breaking bool   `json:"breaking"`
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Location string `json:"location,omitempty"`
+	Before   string `json:"before,omitempty"`
+	After    string `json:"after,omitempty"`
+}
+
+// SpecChangeEvent is published when a new spec version breaks clients of the
+// previous one. Changes holds the breaking changes only.
+type SpecChangeEvent struct {
+	EventType   string       `json:"event_type"`
+	APIID       string       `json:"api_id"`
+	FromVersion int          `json:"from_version"`
+	ToVersion   int          `json:"to_version"`
+	Changes     []SpecChange `json:"changes"`
+	Timestamp   time.Time    `json:"timestamp"`
+}
+
+// PendingSpecChange is a spec change event stored with its spec version and
+// not published yet
+type PendingSpecChange struct {
+	VersionID string          `json:"version_id"`
+	Event     SpecChangeEvent `json:"event"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
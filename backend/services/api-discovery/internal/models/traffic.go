@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// ObservedTraffic is the part of a data-ingestion api_traffic record that
+// passive discovery reads
+type ObservedTraffic struct {
+	ID                string            `json:"id"`
+	Timestamp         time.Time         `json:"timestamp"`
+	Protocol          string            `json:"protocol"`
+	Method            string            `json:"method"`
+	URL               string            `json:"url"`
+	Path              string            `json:"path"`
+	QueryParams       map[string]string `json:"query_params"`
+	Headers           map[string]string `json:"headers"`
+	StatusCode        int               `json:"status_code"`
+	ContentType       string            `json:"content_type"`
+	ResponseHeaders   map[string]string `json:"response_headers"`
+	BodyText          string            `json:"body_text"`
+	BodyFormat        string            `json:"body_format,omitempty"`
+	BodyTruncated     bool              `json:"body_truncated,omitempty"`
+	BodyFields        []ObservedField   `json:"body_fields,omitempty"`
+	ResponseText      string            `json:"response_text"`
+	ResponseFormat    string            `json:"response_format,omitempty"`
+	ResponseTruncated bool              `json:"response_truncated,omitempty"`
+	ResponseFields    []ObservedField   `json:"response_fields,omitempty"`
+}
+
+// ObservedField is one parsed body field, addressed by a JSONPath-style path
+type ObservedField struct {
+	Path  string `json:"path"`
+	Kind  string `json:"kind"`
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"scopeapi.local/backend/services/api-discovery/internal/models"
 )
 
@@ -15,10 +17,12 @@ type DiscoveryRepositoryInterface interface {
 	CreateDiscovery(ctx context.Context, discovery *models.Discovery) error
 	GetDiscovery(ctx context.Context, discoveryID string) (*models.Discovery, error)
 	UpdateDiscoveryStatus(ctx context.Context, discoveryID string, status string) error
-	UpdateDiscoveryProgress(ctx context.Context, discoveryID string, progress int) error
+	UpdateDiscoveryProgress(ctx context.Context, discoveryID string, progress int, checkpoint *models.CrawlCheckpoint) error
 	UpdateDiscoveryEndpointsFound(ctx context.Context, discoveryID string, count int) error
 	GetDiscoveryResults(ctx context.Context, discoveryID string, page, limit int) (*models.DiscoveryResults, error)
 	SaveEndpoint(ctx context.Context, endpoint *models.Endpoint) error
+	MergeEndpoint(ctx context.Context, fromID, intoID string) error
+	SaveAPI(ctx context.Context, api *models.API) error
 	UpdateEndpoint(ctx context.Context, endpoint *models.Endpoint) error
 	SaveEndpointAnalysis(ctx context.Context, analysis *models.EndpointAnalysis) error
 	GetEndpointMetadata(ctx context.Context, endpointID string) (*models.Metadata, error)
@@ -27,8 +31,31 @@ type DiscoveryRepositoryInterface interface {
 	GetAPISpecification(ctx context.Context, apiID string) (*models.APISpec, error)
 	SaveAPISpecification(ctx context.Context, spec *models.APISpec) error
 	GetAPIEndpoints(ctx context.Context, apiID string) ([]models.Endpoint, error)
+	SavePathTemplateOverride(ctx context.Context, override *models.PathTemplateOverride) error
+	GetPathTemplateOverrides(ctx context.Context) ([]models.PathTemplateOverride, error)
+	SaveEndpointSchema(ctx context.Context, schema *models.EndpointSchema) error
+	GetEndpointSchemas(ctx context.Context, endpointID string) ([]models.EndpointSchema, error)
+	GetLatestEndpointSchema(ctx context.Context, endpointID string) (*models.EndpointSchema, error)
+	GetLatestAPISchemas(ctx context.Context, apiID string) ([]models.EndpointSchema, error)
+	SaveAPISpecVersion(ctx context.Context, version *models.APISpecVersion, event *models.SpecChangeEvent) error
+	GetPendingSpecChanges(ctx context.Context, limit int) ([]models.PendingSpecChange, error)
+	MarkSpecChangePublished(ctx context.Context, versionID string) error
+	RecordSpecChangeFailure(ctx context.Context, versionID string, reason string) error
+	GetAPISpecVersions(ctx context.Context, apiID string) ([]models.APISpecVersion, error)
+	GetAPISpecVersion(ctx context.Context, apiID string, version int) (*models.APISpecVersion, error)
+	GetLatestAPISpecVersion(ctx context.Context, apiID string) (*models.APISpecVersion, error)
+	SaveGraphQLSchema(ctx context.Context, schema *models.GraphQLSchema) error
+	GetGraphQLSchema(ctx context.Context, schemaID string) (*models.GraphQLSchema, error)
+	GetGraphQLSchemas(ctx context.Context, apiID string) ([]models.GraphQLSchema, error)
+	SaveGRPCMethod(ctx context.Context, method *models.GRPCMethod) error
+	GetGRPCMethod(ctx context.Context, methodID string) (*models.GRPCMethod, error)
+	GetGRPCMethods(ctx context.Context, apiID string) ([]models.GRPCMethod, error)
 }
 
+// ErrSpecVersionConflict is returned when another generation stored the same
+// spec version number of an API first
+var ErrSpecVersionConflict = errors.New("API spec version already exists")
+
 type DiscoveryRepository struct {
 	db *sqlx.DB
 }
@@ -46,7 +73,7 @@ func (r *DiscoveryRepository) CreateDiscovery(ctx context.Context, discovery *mo
 	}
 
 	query := `
-		INSERT INTO discoveries (id, target, method, status, progress, start_time, endpoints_found, config, created_at, updated_at)
+		INSERT INTO scopeapi.discoveries (id, target, method, status, progress, start_time, endpoints_found, config, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
 
@@ -72,13 +99,13 @@ func (r *DiscoveryRepository) CreateDiscovery(ctx context.Context, discovery *mo
 
 func (r *DiscoveryRepository) GetDiscovery(ctx context.Context, discoveryID string) (*models.Discovery, error) {
 	query := `
-		SELECT id, target, method, status, progress, start_time, end_time, endpoints_found, error_message, config, created_at, updated_at
+		SELECT id, target, method, status, progress, start_time, end_time, endpoints_found, error_message, config, checkpoint, created_at, updated_at
 		FROM scopeapi.discoveries
 		WHERE id = $1
 	`
 
 	var discovery models.Discovery
-	var configJSON []byte
+	var configJSON, checkpointJSON []byte
 	var endTime sql.NullTime
 
 	err := r.db.QueryRowContext(ctx, query, discoveryID).Scan(
@@ -92,6 +119,7 @@ func (r *DiscoveryRepository) GetDiscovery(ctx context.Context, discoveryID stri
 		&discovery.EndpointsFound,
 		&discovery.ErrorMessage,
 		&configJSON,
+		&checkpointJSON,
 		&discovery.CreatedAt,
 		&discovery.UpdatedAt,
 	)
@@ -115,6 +143,14 @@ func (r *DiscoveryRepository) GetDiscovery(ctx context.Context, discoveryID stri
 		discovery.Config = &config
 	}
 
+	if len(checkpointJSON) > 0 {
+		var checkpoint models.CrawlCheckpoint
+		if err := json.Unmarshal(checkpointJSON, &checkpoint); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal checkpoint: %w", err)
+		}
+		discovery.Checkpoint = &checkpoint
+	}
+
 	return &discovery, nil
 }
 
@@ -133,14 +169,25 @@ func (r *DiscoveryRepository) UpdateDiscoveryStatus(ctx context.Context, discove
 	return nil
 }
 
-func (r *DiscoveryRepository) UpdateDiscoveryProgress(ctx context.Context, discoveryID string, progress int) error {
+// UpdateDiscoveryProgress records the progress of a discovery run and, when
+// checkpoint is not nil, the state to resume it from
+func (r *DiscoveryRepository) UpdateDiscoveryProgress(ctx context.Context, discoveryID string, progress int, checkpoint *models.CrawlCheckpoint) error {
+	var checkpointJSON interface{}
+	if checkpoint != nil {
+		encoded, err := json.Marshal(checkpoint)
+		if err != nil {
+			return fmt.Errorf("failed to marshal checkpoint: %w", err)
+		}
+		checkpointJSON = string(encoded)
+	}
+
 	query := `
 		UPDATE scopeapi.discoveries 
-		SET progress = $1, updated_at = $2
-		WHERE id = $3
+		SET progress = $1, checkpoint = COALESCE($2, checkpoint), updated_at = $3
+		WHERE id = $4
 	`
 
-	_, err := r.db.ExecContext(ctx, query, progress, time.Now(), discoveryID)
+	_, err := r.db.ExecContext(ctx, query, progress, checkpointJSON, time.Now(), discoveryID)
 	if err != nil {
 		return fmt.Errorf("failed to update discovery progress: %w", err)
 	}
@@ -176,7 +223,7 @@ func (r *DiscoveryRepository) GetDiscoveryResults(ctx context.Context, discovery
 
 	// Get endpoints
 	query := `
-		SELECT id, api_id, url, path, method, status_code, content_type, summary, description, tags, is_active, created_at, updated_at
+		SELECT id, api_id, url, path, method, protocol, status_code, content_type, summary, description, tags, is_active, created_at, updated_at
 		FROM scopeapi.endpoints 
 		WHERE discovery_id = $1
 		ORDER BY created_at DESC
@@ -200,6 +247,7 @@ func (r *DiscoveryRepository) GetDiscoveryResults(ctx context.Context, discovery
 			&endpoint.URL,
 			&endpoint.Path,
 			&endpoint.Method,
+			&endpoint.Protocol,
 			&endpoint.StatusCode,
 			&endpoint.ContentType,
 			&endpoint.Summary,
@@ -229,15 +277,39 @@ func (r *DiscoveryRepository) GetDiscoveryResults(ctx context.Context, discovery
 	}, nil
 }
 
+// SaveEndpoint inserts an endpoint or, when one with the same ID exists, merges
+// the new observation into it: counts add up, status codes and content types are
+// unioned and the first-seen/last-seen window widens. An endpoint keeps the
+// GraphQL or gRPC protocol it was recognised by when seen again as plain REST,
+// and becomes active again when it is seen in traffic.
 func (r *DiscoveryRepository) SaveEndpoint(ctx context.Context, endpoint *models.Endpoint) error {
 	headersJSON, _ := json.Marshal(endpoint.Headers)
 	parametersJSON, _ := json.Marshal(endpoint.Parameters)
 	responsesJSON, _ := json.Marshal(endpoint.Responses)
 	tagsJSON, _ := json.Marshal(endpoint.Tags)
+	statusCodesJSON, _ := json.Marshal(endpoint.StatusCodes)
+	contentTypesJSON, _ := json.Marshal(endpoint.ContentTypes)
 
 	query := `
-		INSERT INTO scopeapi.endpoints (id, api_id, url, path, method, headers, body, status_code, content_type, summary, description, parameters, responses, tags, is_active, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		INSERT INTO scopeapi.endpoints (id, api_id, url, path, method, headers, body, status_code, content_type, summary, description, parameters, responses, tags, is_active,
+		                                discovery_id, source, status_codes, content_types, request_count, first_seen, last_seen, created_at, updated_at, protocol, last_traffic_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NULLIF($16, ''), $17, $18, $19, $20, $21, $22, $23, $24, COALESCE(NULLIF($25, ''), 'rest'), $26)
+		ON CONFLICT (id) DO UPDATE SET
+		    url = EXCLUDED.url,
+		    protocol = CASE WHEN EXCLUDED.protocol = 'rest' THEN scopeapi.endpoints.protocol ELSE EXCLUDED.protocol END,
+		    status_code = EXCLUDED.status_code,
+		    content_type = EXCLUDED.content_type,
+		    parameters = EXCLUDED.parameters,
+		    is_active = EXCLUDED.is_active,
+		    discovery_id = COALESCE(EXCLUDED.discovery_id, scopeapi.endpoints.discovery_id),
+		    status_codes = (SELECT COALESCE(jsonb_agg(DISTINCT v ORDER BY v), '[]') FROM jsonb_array_elements(COALESCE(scopeapi.endpoints.status_codes, '[]') || COALESCE(EXCLUDED.status_codes, '[]')) v),
+		    content_types = (SELECT COALESCE(jsonb_agg(DISTINCT v ORDER BY v), '[]') FROM jsonb_array_elements(COALESCE(scopeapi.endpoints.content_types, '[]') || COALESCE(EXCLUDED.content_types, '[]')) v),
+		    request_count = COALESCE(scopeapi.endpoints.request_count, 0) + EXCLUDED.request_count,
+		    first_seen = LEAST(scopeapi.endpoints.first_seen, EXCLUDED.first_seen),
+		    last_seen = GREATEST(scopeapi.endpoints.last_seen, EXCLUDED.last_seen),
+		    last_traffic_at = GREATEST(scopeapi.endpoints.last_traffic_at, EXCLUDED.last_traffic_at),
+		    traffic_state = CASE WHEN EXCLUDED.last_traffic_at IS NULL THEN scopeapi.endpoints.traffic_state ELSE 'active' END,
+		    updated_at = EXCLUDED.updated_at
 	`
 
 	_, err := r.db.ExecContext(ctx, query,
@@ -256,8 +328,17 @@ func (r *DiscoveryRepository) SaveEndpoint(ctx context.Context, endpoint *models
 		responsesJSON,
 		tagsJSON,
 		endpoint.IsActive,
+		endpoint.DiscoveryID,
+		endpoint.Source,
+		statusCodesJSON,
+		contentTypesJSON,
+		endpoint.RequestCount,
+		endpoint.FirstSeen,
+		endpoint.LastSeen,
 		endpoint.CreatedAt,
 		endpoint.UpdatedAt,
+		endpoint.Protocol,
+		endpoint.LastTrafficAt,
 	)
 
 	if err != nil {
@@ -267,6 +348,93 @@ func (r *DiscoveryRepository) SaveEndpoint(ctx context.Context, endpoint *models
 	return nil
 }
 
+// MergeEndpoint moves the observations of an endpoint into another one, as
+// SaveEndpoint would merge them, and deactivates it with a zero request count.
+// It is used when the requests of an endpoint are templated to another path,
+// e.g. /users/alice once /users/{userId} is learned. Merging an endpoint that
+// is missing or already inactive does nothing.
+func (r *DiscoveryRepository) MergeEndpoint(ctx context.Context, fromID, intoID string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM scopeapi.endpoints WHERE id = $1)`, intoID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to get endpoint: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("endpoint not found: %s", intoID)
+	}
+
+	now := time.Now()
+	query := `
+		UPDATE scopeapi.endpoints AS e SET
+		    status_codes = (SELECT COALESCE(jsonb_agg(DISTINCT v ORDER BY v), '[]') FROM jsonb_array_elements(COALESCE(e.status_codes, '[]') || COALESCE(old.status_codes, '[]')) v),
+		    content_types = (SELECT COALESCE(jsonb_agg(DISTINCT v ORDER BY v), '[]') FROM jsonb_array_elements(COALESCE(e.content_types, '[]') || COALESCE(old.content_types, '[]')) v),
+		    request_count = COALESCE(e.request_count, 0) + COALESCE(old.request_count, 0),
+		    first_seen = LEAST(e.first_seen, old.first_seen),
+		    last_seen = GREATEST(e.last_seen, old.last_seen),
+		    last_traffic_at = GREATEST(e.last_traffic_at, old.last_traffic_at),
+		    updated_at = $3
+		FROM scopeapi.endpoints AS old
+		WHERE e.id = $2 AND old.id = $1 AND old.is_active
+	`
+	if _, err := tx.ExecContext(ctx, query, fromID, intoID, now); err != nil {
+		return fmt.Errorf("failed to merge endpoint: %w", err)
+	}
+
+	query = `
+		UPDATE scopeapi.endpoints
+		SET is_active = false, request_count = 0, updated_at = $2
+		WHERE id = $1 AND is_active
+	`
+	if _, err := tx.ExecContext(ctx, query, fromID, now); err != nil {
+		return fmt.Errorf("failed to deactivate merged endpoint: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit endpoint merge: %w", err)
+	}
+	return nil
+}
+
+// SaveAPI creates an API discovered from traffic, leaving existing APIs untouched
+// apart from their update and last traffic times
+func (r *DiscoveryRepository) SaveAPI(ctx context.Context, api *models.API) error {
+	tagsJSON, _ := json.Marshal(api.Tags)
+
+	query := `
+		INSERT INTO scopeapi.apis (id, name, url, base_url, version, protocol, status, description, tags, created_at, updated_at, last_traffic_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO UPDATE SET
+		    updated_at = EXCLUDED.updated_at,
+		    last_traffic_at = GREATEST(scopeapi.apis.last_traffic_at, EXCLUDED.last_traffic_at)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		api.ID,
+		api.Name,
+		api.URL,
+		api.BaseURL,
+		api.Version,
+		api.Protocol,
+		api.Status,
+		api.Description,
+		tagsJSON,
+		api.CreatedAt,
+		api.UpdatedAt,
+		api.LastTrafficAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to save API: %w", err)
+	}
+
+	return nil
+}
+
 func (r *DiscoveryRepository) UpdateEndpoint(ctx context.Context, endpoint *models.Endpoint) error {
 	headersJSON, _ := json.Marshal(endpoint.Headers)
 	parametersJSON, _ := json.Marshal(endpoint.Parameters)
@@ -645,7 +813,8 @@ func (r *DiscoveryRepository) SaveAPISpecification(ctx context.Context, spec *mo
 
 func (r *DiscoveryRepository) GetAPIEndpoints(ctx context.Context, apiID string) ([]models.Endpoint, error) {
 	query := `
-		SELECT id, api_id, url, path, method, headers, body, status_code, content_type, summary, description, parameters, responses, tags, is_active, created_at, updated_at
+		SELECT id, api_id, url, path, method, protocol, headers, body, status_code, content_type, summary, description, parameters, responses, tags, is_active,
+		       COALESCE(source, ''), status_codes, content_types, COALESCE(request_count, 0), first_seen, last_seen, last_traffic_at, traffic_state, created_at, updated_at
 		FROM scopeapi.endpoints
 		WHERE api_id = $1
 		ORDER BY path, method
@@ -660,7 +829,8 @@ func (r *DiscoveryRepository) GetAPIEndpoints(ctx context.Context, apiID string)
 	var endpoints []models.Endpoint
 	for rows.Next() {
 		var endpoint models.Endpoint
-		var headersJSON, parametersJSON, responsesJSON, tagsJSON []byte
+		var headersJSON, parametersJSON, responsesJSON, tagsJSON, statusCodesJSON, contentTypesJSON []byte
+		var firstSeen, lastSeen, lastTrafficAt sql.NullTime
 
 		err := rows.Scan(
 			&endpoint.ID,
@@ -668,6 +838,7 @@ func (r *DiscoveryRepository) GetAPIEndpoints(ctx context.Context, apiID string)
 			&endpoint.URL,
 			&endpoint.Path,
 			&endpoint.Method,
+			&endpoint.Protocol,
 			&headersJSON,
 			&endpoint.Body,
 			&endpoint.StatusCode,
@@ -678,12 +849,29 @@ func (r *DiscoveryRepository) GetAPIEndpoints(ctx context.Context, apiID string)
 			&responsesJSON,
 			&tagsJSON,
 			&endpoint.IsActive,
+			&endpoint.Source,
+			&statusCodesJSON,
+			&contentTypesJSON,
+			&endpoint.RequestCount,
+			&firstSeen,
+			&lastSeen,
+			&lastTrafficAt,
+			&endpoint.TrafficState,
 			&endpoint.CreatedAt,
 			&endpoint.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan endpoint: %w", err)
 		}
+		if firstSeen.Valid {
+			endpoint.FirstSeen = &firstSeen.Time
+		}
+		if lastSeen.Valid {
+			endpoint.LastSeen = &lastSeen.Time
+		}
+		if lastTrafficAt.Valid {
+			endpoint.LastTrafficAt = &lastTrafficAt.Time
+		}
 
 		// Unmarshal JSON fields
 		if len(headersJSON) > 0 {
@@ -698,9 +886,687 @@ func (r *DiscoveryRepository) GetAPIEndpoints(ctx context.Context, apiID string)
 		if len(tagsJSON) > 0 {
 			json.Unmarshal(tagsJSON, &endpoint.Tags)
 		}
+		if len(statusCodesJSON) > 0 {
+			json.Unmarshal(statusCodesJSON, &endpoint.StatusCodes)
+		}
+		if len(contentTypesJSON) > 0 {
+			json.Unmarshal(contentTypesJSON, &endpoint.ContentTypes)
+		}
 
 		endpoints = append(endpoints, endpoint)
 	}
 
 	return endpoints, nil
 }
+
+func (r *DiscoveryRepository) SavePathTemplateOverride(ctx context.Context, override *models.PathTemplateOverride) error {
+	parametersJSON, _ := json.Marshal(override.Parameters)
+
+	query := `
+		INSERT INTO scopeapi.path_template_overrides (id, api_id, template, parameters, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET parameters = EXCLUDED.parameters, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		override.ID,
+		override.APIID,
+		override.Template,
+		parametersJSON,
+		override.CreatedAt,
+		override.UpdatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to save path template override: %w", err)
+	}
+
+	return nil
+}
+
+func (r *DiscoveryRepository) GetPathTemplateOverrides(ctx context.Context) ([]models.PathTemplateOverride, error) {
+	query := `
+		SELECT id, api_id, template, parameters, created_at, updated_at
+		FROM scopeapi.path_template_overrides
+		ORDER BY api_id, template
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query path template overrides: %w", err)
+	}
+	defer rows.Close()
+
+	var overrides []models.PathTemplateOverride
+	for rows.Next() {
+		var override models.PathTemplateOverride
+		var parametersJSON []byte
+
+		err := rows.Scan(
+			&override.ID,
+			&override.APIID,
+			&override.Template,
+			&parametersJSON,
+			&override.CreatedAt,
+			&override.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan path template override: %w", err)
+		}
+
+		if len(parametersJSON) > 0 {
+			json.Unmarshal(parametersJSON, &override.Parameters)
+		}
+
+		overrides = append(overrides, override)
+	}
+
+	return overrides, nil
+}
+
+func (r *DiscoveryRepository) SaveEndpointSchema(ctx context.Context, schema *models.EndpointSchema) error {
+	requestJSON, _ := json.Marshal(schema.RequestSchema)
+	responsesJSON, _ := json.Marshal(schema.ResponseSchemas)
+
+	query := `
+		INSERT INTO scopeapi.endpoint_schemas (id, endpoint_id, api_id, version, request_schema, response_schemas,
+		                                       sample_count, fingerprint, state, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		schema.ID,
+		schema.EndpointID,
+		schema.APIID,
+		schema.Version,
+		string(requestJSON),
+		string(responsesJSON),
+		schema.SampleCount,
+		schema.Fingerprint,
+		nullableJSON(schema.State),
+		schema.CreatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to save endpoint schema: %w", err)
+	}
+
+	return nil
+}
+
+// GetEndpointSchemas returns every learned schema version of an endpoint, newest first
+func (r *DiscoveryRepository) GetEndpointSchemas(ctx context.Context, endpointID string) ([]models.EndpointSchema, error) {
+	query := `
+		SELECT id, endpoint_id, api_id, version, request_schema, response_schemas, sample_count, fingerprint, state, created_at
+		FROM scopeapi.endpoint_schemas
+		WHERE endpoint_id = $1
+		ORDER BY version DESC
+	`
+
+	return r.queryEndpointSchemas(ctx, query, endpointID)
+}
+
+// GetLatestEndpointSchema returns the newest learned schema of an endpoint, or
+// nil when none has been learned yet
+func (r *DiscoveryRepository) GetLatestEndpointSchema(ctx context.Context, endpointID string) (*models.EndpointSchema, error) {
+	query := `
+		SELECT id, endpoint_id, api_id, version, request_schema, response_schemas, sample_count, fingerprint, state, created_at
+		FROM scopeapi.endpoint_schemas
+		WHERE endpoint_id = $1
+		ORDER BY version DESC
+		LIMIT 1
+	`
+
+	schemas, err := r.queryEndpointSchemas(ctx, query, endpointID)
+	if err != nil || len(schemas) == 0 {
+		return nil, err
+	}
+	return &schemas[0], nil
+}
+
+// GetLatestAPISchemas returns the newest learned schema of each endpoint of an API
+func (r *DiscoveryRepository) GetLatestAPISchemas(ctx context.Context, apiID string) ([]models.EndpointSchema, error) {
+	query := `
+		SELECT DISTINCT ON (endpoint_id)
+		       id, endpoint_id, api_id, version, request_schema, response_schemas, sample_count, fingerprint, state, created_at
+		FROM scopeapi.endpoint_schemas
+		WHERE api_id = $1
+		ORDER BY endpoint_id, version DESC
+	`
+
+	return r.queryEndpointSchemas(ctx, query, apiID)
+}
+
+func (r *DiscoveryRepository) queryEndpointSchemas(ctx context.Context, query string, args ...interface{}) ([]models.EndpointSchema, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query endpoint schemas: %w", err)
+	}
+	defer rows.Close()
+
+	var schemas []models.EndpointSchema
+	for rows.Next() {
+		var schema models.EndpointSchema
+		var requestJSON, responsesJSON []byte
+
+		err := rows.Scan(
+			&schema.ID,
+			&schema.EndpointID,
+			&schema.APIID,
+			&schema.Version,
+			&requestJSON,
+			&responsesJSON,
+			&schema.SampleCount,
+			&schema.Fingerprint,
+			&schema.State,
+			&schema.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan endpoint schema: %w", err)
+		}
+
+		if len(requestJSON) > 0 {
+			json.Unmarshal(requestJSON, &schema.RequestSchema)
+		}
+		if len(responsesJSON) > 0 {
+			json.Unmarshal(responsesJSON, &schema.ResponseSchemas)
+		}
+
+		schemas = append(schemas, schema)
+	}
+
+	return schemas, nil
+}
+
+// SaveAPISpecVersion stores a spec version and, when event is not nil, its
+// spec change event in the outbox, in one transaction so an event is never
+// lost once its version is stored. It returns ErrSpecVersionConflict when the
+// API already has a version with the same number.
+func (r *DiscoveryRepository) SaveAPISpecVersion(ctx context.Context, version *models.APISpecVersion, event *models.SpecChangeEvent) error {
+	specJSON, err := json.Marshal(version.Spec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal API spec: %w", err)
+	}
+	changesJSON, _ := json.Marshal(version.Changes)
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO scopeapi.api_spec_versions (id, api_id, version, spec, fingerprint, changes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err = tx.ExecContext(ctx, query,
+		version.ID,
+		version.APIID,
+		version.Version,
+		string(specJSON),
+		version.Fingerprint,
+		string(changesJSON),
+		version.CreatedAt,
+	)
+
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return fmt.Errorf("%w: version %d of %s", ErrSpecVersionConflict, version.Version, version.APIID)
+		}
+		return fmt.Errorf("failed to save API spec version: %w", err)
+	}
+
+	if event != nil {
+		eventJSON, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal spec change event: %w", err)
+		}
+		query = `
+			INSERT INTO scopeapi.spec_change_outbox (version_id, api_id, version, event, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+		`
+		if _, err := tx.ExecContext(ctx, query, version.ID, version.APIID, version.Version, string(eventJSON), version.CreatedAt); err != nil {
+			return fmt.Errorf("failed to save spec change event: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit API spec version: %w", err)
+	}
+	return nil
+}
+
+// GetPendingSpecChanges returns the spec change events not published yet,
+// oldest first
+func (r *DiscoveryRepository) GetPendingSpecChanges(ctx context.Context, limit int) ([]models.PendingSpecChange, error) {
+	query := `
+		SELECT version_id, event, attempts, last_error, created_at
+		FROM scopeapi.spec_change_outbox
+		WHERE published_at IS NULL
+		ORDER BY created_at, version
+		LIMIT $1
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending spec changes: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []models.PendingSpecChange
+	for rows.Next() {
+		var change models.PendingSpecChange
+		var eventJSON []byte
+		if err := rows.Scan(&change.VersionID, &eventJSON, &change.Attempts, &change.LastError, &change.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan pending spec change: %w", err)
+		}
+		if err := json.Unmarshal(eventJSON, &change.Event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal spec change event: %w", err)
+		}
+		pending = append(pending, change)
+	}
+
+	return pending, rows.Err()
+}
+
+// MarkSpecChangePublished records that a spec change event was published
+func (r *DiscoveryRepository) MarkSpecChangePublished(ctx context.Context, versionID string) error {
+	query := `
+		UPDATE scopeapi.spec_change_outbox
+		SET published_at = $1, attempts = attempts + 1
+		WHERE version_id = $2
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, time.Now(), versionID); err != nil {
+		return fmt.Errorf("failed to mark spec change published: %w", err)
+	}
+	return nil
+}
+
+// RecordSpecChangeFailure counts a failed attempt to publish a spec change
+// event, which stays pending
+func (r *DiscoveryRepository) RecordSpecChangeFailure(ctx context.Context, versionID string, reason string) error {
+	query := `
+		UPDATE scopeapi.spec_change_outbox
+		SET attempts = attempts + 1, last_error = $1
+		WHERE version_id = $2
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, reason, versionID); err != nil {
+		return fmt.Errorf("failed to record spec change failure: %w", err)
+	}
+	return nil
+}
+
+// GetAPISpecVersions lists the spec versions of an API, newest first, without
+// the specs themselves
+func (r *DiscoveryRepository) GetAPISpecVersions(ctx context.Context, apiID string) ([]models.APISpecVersion, error) {
+	query := `
+		SELECT id, api_id, version, NULL, fingerprint, changes, created_at
+		FROM scopeapi.api_spec_versions
+		WHERE api_id = $1
+		ORDER BY version DESC
+	`
+
+	return r.queryAPISpecVersions(ctx, query, apiID)
+}
+
+// GetAPISpecVersion returns one spec version of an API, or nil when it does not exist
+func (r *DiscoveryRepository) GetAPISpecVersion(ctx context.Context, apiID string, version int) (*models.APISpecVersion, error) {
+	query := `
+		SELECT id, api_id, version, spec, fingerprint, changes, created_at
+		FROM scopeapi.api_spec_versions
+		WHERE api_id = $1 AND version = $2
+	`
+
+	versions, err := r.queryAPISpecVersions(ctx, query, apiID, version)
+	if err != nil || len(versions) == 0 {
+		return nil, err
+	}
+	return &versions[0], nil
+}
+
+// GetLatestAPISpecVersion returns the newest spec version of an API, or nil
+// when none has been stored yet
+func (r *DiscoveryRepository) GetLatestAPISpecVersion(ctx context.Context, apiID string) (*models.APISpecVersion, error) {
+	query := `
+		SELECT id, api_id, version, spec, fingerprint, changes, created_at
+		FROM scopeapi.api_spec_versions
+		WHERE api_id = $1
+		ORDER BY version DESC
+		LIMIT 1
+	`
+
+	versions, err := r.queryAPISpecVersions(ctx, query, apiID)
+	if err != nil || len(versions) == 0 {
+		return nil, err
+	}
+	return &versions[0], nil
+}
+
+func (r *DiscoveryRepository) queryAPISpecVersions(ctx context.Context, query string, args ...interface{}) ([]models.APISpecVersion, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API spec versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []models.APISpecVersion
+	for rows.Next() {
+		var version models.APISpecVersion
+		var specJSON, changesJSON []byte
+
+		err := rows.Scan(
+			&version.ID,
+			&version.APIID,
+			&version.Version,
+			&specJSON,
+			&version.Fingerprint,
+			&changesJSON,
+			&version.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API spec version: %w", err)
+		}
+
+		if len(specJSON) > 0 {
+			json.Unmarshal(specJSON, &version.Spec)
+		}
+		if len(changesJSON) > 0 {
+			json.Unmarshal(changesJSON, &version.Changes)
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+func (r *DiscoveryRepository) SaveGraphQLSchema(ctx context.Context, schema *models.GraphQLSchema) error {
+	operationsJSON, _ := json.Marshal(schema.Operations)
+	typesJSON, _ := json.Marshal(schema.Types)
+	findingsJSON, _ := json.Marshal(schema.Findings)
+
+	query := `
+		INSERT INTO scopeapi.graphql_schemas (id, api_id, url, path, source, environment, operations, types, findings,
+		                                      introspection_enabled, batching_enabled, max_depth, request_count,
+		                                      first_seen, last_seen, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		ON CONFLICT (id) DO UPDATE SET
+		    url = EXCLUDED.url,
+		    source = EXCLUDED.source,
+		    environment = EXCLUDED.environment,
+		    operations = EXCLUDED.operations,
+		    types = EXCLUDED.types,
+		    findings = EXCLUDED.findings,
+		    introspection_enabled = EXCLUDED.introspection_enabled,
+		    batching_enabled = EXCLUDED.batching_enabled,
+		    max_depth = EXCLUDED.max_depth,
+		    request_count = EXCLUDED.request_count,
+		    first_seen = EXCLUDED.first_seen,
+		    last_seen = EXCLUDED.last_seen,
+		    updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		schema.ID,
+		schema.APIID,
+		schema.URL,
+		schema.Path,
+		schema.Source,
+		schema.Environment,
+		string(operationsJSON),
+		string(typesJSON),
+		string(findingsJSON),
+		schema.IntrospectionEnabled,
+		schema.BatchingEnabled,
+		schema.MaxDepth,
+		schema.RequestCount,
+		schema.FirstSeen,
+		schema.LastSeen,
+		schema.CreatedAt,
+		schema.UpdatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to save GraphQL schema: %w", err)
+	}
+
+	return nil
+}
+
+// GetGraphQLSchema returns a GraphQL schema, or nil when none is stored under the ID
+func (r *DiscoveryRepository) GetGraphQLSchema(ctx context.Context, schemaID string) (*models.GraphQLSchema, error) {
+	query := `
+		SELECT id, api_id, url, path, source, environment, operations, types, findings, introspection_enabled,
+		       batching_enabled, max_depth, request_count, first_seen, last_seen, created_at, updated_at
+		FROM scopeapi.graphql_schemas
+		WHERE id = $1
+	`
+
+	schemas, err := r.queryGraphQLSchemas(ctx, query, schemaID)
+	if err != nil || len(schemas) == 0 {
+		return nil, err
+	}
+	return &schemas[0], nil
+}
+
+// GetGraphQLSchemas returns the schemas of the GraphQL endpoints of an API
+func (r *DiscoveryRepository) GetGraphQLSchemas(ctx context.Context, apiID string) ([]models.GraphQLSchema, error) {
+	query := `
+		SELECT id, api_id, url, path, source, environment, operations, types, findings, introspection_enabled,
+		       batching_enabled, max_depth, request_count, first_seen, last_seen, created_at, updated_at
+		FROM scopeapi.graphql_schemas
+		WHERE api_id = $1
+		ORDER BY path
+	`
+
+	return r.queryGraphQLSchemas(ctx, query, apiID)
+}
+
+func (r *DiscoveryRepository) queryGraphQLSchemas(ctx context.Context, query string, args ...interface{}) ([]models.GraphQLSchema, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GraphQL schemas: %w", err)
+	}
+	defer rows.Close()
+
+	var schemas []models.GraphQLSchema
+	for rows.Next() {
+		var schema models.GraphQLSchema
+		var operationsJSON, typesJSON, findingsJSON []byte
+		var firstSeen, lastSeen sql.NullTime
+
+		err := rows.Scan(
+			&schema.ID,
+			&schema.APIID,
+			&schema.URL,
+			&schema.Path,
+			&schema.Source,
+			&schema.Environment,
+			&operationsJSON,
+			&typesJSON,
+			&findingsJSON,
+			&schema.IntrospectionEnabled,
+			&schema.BatchingEnabled,
+			&schema.MaxDepth,
+			&schema.RequestCount,
+			&firstSeen,
+			&lastSeen,
+			&schema.CreatedAt,
+			&schema.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan GraphQL schema: %w", err)
+		}
+
+		if len(operationsJSON) > 0 {
+			json.Unmarshal(operationsJSON, &schema.Operations)
+		}
+		if len(typesJSON) > 0 {
+			json.Unmarshal(typesJSON, &schema.Types)
+		}
+		if len(findingsJSON) > 0 {
+			json.Unmarshal(findingsJSON, &schema.Findings)
+		}
+		if firstSeen.Valid {
+			schema.FirstSeen = &firstSeen.Time
+		}
+		if lastSeen.Valid {
+			schema.LastSeen = &lastSeen.Time
+		}
+
+		schemas = append(schemas, schema)
+	}
+
+	return schemas, nil
+}
+
+// SaveGRPCMethod inserts or replaces a gRPC method
+func (r *DiscoveryRepository) SaveGRPCMethod(ctx context.Context, method *models.GRPCMethod) error {
+	var requestJSON, responseJSON []byte
+	if method.RequestSchema != nil {
+		requestJSON, _ = json.Marshal(method.RequestSchema)
+	}
+	if method.ResponseSchema != nil {
+		responseJSON, _ = json.Marshal(method.ResponseSchema)
+	}
+
+	query := `
+		INSERT INTO scopeapi.grpc_methods (id, api_id, url, service, method, path, streaming_type, request_type, response_type,
+		                                   request_schema, response_schema, source, request_count, first_seen, last_seen, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		ON CONFLICT (id) DO UPDATE SET
+		    url = EXCLUDED.url,
+		    streaming_type = EXCLUDED.streaming_type,
+		    request_type = EXCLUDED.request_type,
+		    response_type = EXCLUDED.response_type,
+		    request_schema = EXCLUDED.request_schema,
+		    response_schema = EXCLUDED.response_schema,
+		    source = EXCLUDED.source,
+		    request_count = EXCLUDED.request_count,
+		    first_seen = EXCLUDED.first_seen,
+		    last_seen = EXCLUDED.last_seen,
+		    updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		method.ID,
+		method.APIID,
+		method.URL,
+		method.Service,
+		method.Method,
+		method.Path,
+		method.StreamingType,
+		method.RequestType,
+		method.ResponseType,
+		nullableJSON(requestJSON),
+		nullableJSON(responseJSON),
+		method.Source,
+		method.RequestCount,
+		method.FirstSeen,
+		method.LastSeen,
+		method.CreatedAt,
+		method.UpdatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to save gRPC method: %w", err)
+	}
+
+	return nil
+}
+
+// GetGRPCMethod returns a gRPC method, or nil when none is stored under the ID
+func (r *DiscoveryRepository) GetGRPCMethod(ctx context.Context, methodID string) (*models.GRPCMethod, error) {
+	query := `
+		SELECT id, api_id, url, service, method, path, streaming_type, request_type, response_type, request_schema,
+		       response_schema, source, request_count, first_seen, last_seen, created_at, updated_at
+		FROM scopeapi.grpc_methods
+		WHERE id = $1
+	`
+
+	methods, err := r.queryGRPCMethods(ctx, query, methodID)
+	if err != nil || len(methods) == 0 {
+		return nil, err
+	}
+	return &methods[0], nil
+}
+
+// GetGRPCMethods returns the methods of the gRPC service an API catalogues
+func (r *DiscoveryRepository) GetGRPCMethods(ctx context.Context, apiID string) ([]models.GRPCMethod, error) {
+	query := `
+		SELECT id, api_id, url, service, method, path, streaming_type, request_type, response_type, request_schema,
+		       response_schema, source, request_count, first_seen, last_seen, created_at, updated_at
+		FROM scopeapi.grpc_methods
+		WHERE api_id = $1
+		ORDER BY method
+	`
+
+	return r.queryGRPCMethods(ctx, query, apiID)
+}
+
+func (r *DiscoveryRepository) queryGRPCMethods(ctx context.Context, query string, args ...interface{}) ([]models.GRPCMethod, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query gRPC methods: %w", err)
+	}
+	defer rows.Close()
+
+	var methods []models.GRPCMethod
+	for rows.Next() {
+		var method models.GRPCMethod
+		var requestJSON, responseJSON []byte
+		var firstSeen, lastSeen sql.NullTime
+
+		err := rows.Scan(
+			&method.ID,
+			&method.APIID,
+			&method.URL,
+			&method.Service,
+			&method.Method,
+			&method.Path,
+			&method.StreamingType,
+			&method.RequestType,
+			&method.ResponseType,
+			&requestJSON,
+			&responseJSON,
+			&method.Source,
+			&method.RequestCount,
+			&firstSeen,
+			&lastSeen,
+			&method.CreatedAt,
+			&method.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan gRPC method: %w", err)
+		}
+
+		if len(requestJSON) > 0 {
+			json.Unmarshal(requestJSON, &method.RequestSchema)
+		}
+		if len(responseJSON) > 0 {
+			json.Unmarshal(responseJSON, &method.ResponseSchema)
+		}
+		if firstSeen.Valid {
+			method.FirstSeen = &firstSeen.Time
+		}
+		if lastSeen.Valid {
+			method.LastSeen = &lastSeen.Time
+		}
+
+		methods = append(methods, method)
+	}
+
+	return methods, nil
+}
+
+// nullableJSON passes JSON to a JSONB column as text, or NULL when empty
+func nullableJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
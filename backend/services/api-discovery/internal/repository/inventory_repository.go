@@ -28,6 +28,14 @@ type InventoryRepositoryInterface interface {
 	GetEndpoint(ctx context.Context, endpointID string) (*models.Endpoint, error)
 	GetEndpoints(ctx context.Context, page, limit int) ([]models.Endpoint, error)
 	DeleteEndpoint(ctx context.Context, endpointID string) error
+	GetEndpointsByTrafficState(ctx context.Context, state string, page, limit int) (*models.EndpointInventory, error)
+	GetEndpointTraffic(ctx context.Context) ([]models.EndpointTraffic, error)
+	UpdateEndpointTrafficState(ctx context.Context, endpointID string, state string) error
+	SaveImportedSpec(ctx context.Context, imported *models.ImportedSpec) error
+	GetImportedSpec(ctx context.Context, apiID string) (*models.ImportedSpec, error)
+	GetImportedSpecs(ctx context.Context) ([]models.ImportedSpec, error)
+	SaveDriftReport(ctx context.Context, report *models.DriftReport) error
+	GetDriftReport(ctx context.Context, apiID string) (*models.DriftReport, error)
 }
 
 type InventoryRepository struct {
@@ -53,7 +61,8 @@ func (r *InventoryRepository) GetAPIs(ctx context.Context, page, limit int) (*mo
 
 	// Get APIs
 	query := `
-		SELECT id, name, url, base_url, version, protocol, status, description, tags, created_at, updated_at
+		SELECT id, name, url, base_url, version, protocol, status, description, tags,
+		       owner, contact, environment, lifecycle, data_sensitivity, last_traffic_at, created_at, updated_at
 		FROM scopeapi.apis
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
@@ -69,6 +78,7 @@ func (r *InventoryRepository) GetAPIs(ctx context.Context, page, limit int) (*mo
 	for rows.Next() {
 		var api models.API
 		var tagsJSON []byte
+		var lastTrafficAt sql.NullTime
 
 		err := rows.Scan(
 			&api.ID,
@@ -80,6 +90,12 @@ func (r *InventoryRepository) GetAPIs(ctx context.Context, page, limit int) (*mo
 			&api.Status,
 			&api.Description,
 			&tagsJSON,
+			&api.Owner,
+			&api.Contact,
+			&api.Environment,
+			&api.Lifecycle,
+			&api.DataSensitivity,
+			&lastTrafficAt,
 			&api.CreatedAt,
 			&api.UpdatedAt,
 		)
@@ -90,6 +106,9 @@ func (r *InventoryRepository) GetAPIs(ctx context.Context, page, limit int) (*mo
 		if len(tagsJSON) > 0 {
 			json.Unmarshal(tagsJSON, &api.Tags)
 		}
+		if lastTrafficAt.Valid {
+			api.LastTrafficAt = &lastTrafficAt.Time
+		}
 
 		apis = append(apis, api)
 	}
@@ -104,13 +123,15 @@ func (r *InventoryRepository) GetAPIs(ctx context.Context, page, limit int) (*mo
 
 func (r *InventoryRepository) GetAPI(ctx context.Context, apiID string) (*models.API, error) {
 	query := `
-		SELECT id, name, url, base_url, version, protocol, status, description, tags, created_at, updated_at
+		SELECT id, name, url, base_url, version, protocol, status, description, tags,
+		       owner, contact, environment, lifecycle, data_sensitivity, last_traffic_at, created_at, updated_at
 		FROM scopeapi.apis
 		WHERE id = $1
 	`
 
 	var api models.API
 	var tagsJSON []byte
+	var lastTrafficAt sql.NullTime
 
 	err := r.db.QueryRowContext(ctx, query, apiID).Scan(
 		&api.ID,
@@ -122,6 +143,12 @@ func (r *InventoryRepository) GetAPI(ctx context.Context, apiID string) (*models
 		&api.Status,
 		&api.Description,
 		&tagsJSON,
+		&api.Owner,
+		&api.Contact,
+		&api.Environment,
+		&api.Lifecycle,
+		&api.DataSensitivity,
+		&lastTrafficAt,
 		&api.CreatedAt,
 		&api.UpdatedAt,
 	)
@@ -136,6 +163,9 @@ func (r *InventoryRepository) GetAPI(ctx context.Context, apiID string) (*models
 	if len(tagsJSON) > 0 {
 		json.Unmarshal(tagsJSON, &api.Tags)
 	}
+	if lastTrafficAt.Valid {
+		api.LastTrafficAt = &lastTrafficAt.Time
+	}
 
 	return &api, nil
 }
@@ -147,8 +177,9 @@ func (r *InventoryRepository) CreateAPI(ctx context.Context, api *models.API) er
 	}
 
 	query := `
-		INSERT INTO scopeapi.apis (id, name, url, base_url, version, protocol, status, description, tags, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		INSERT INTO scopeapi.apis (id, name, url, base_url, version, protocol, status, description, tags,
+		                           owner, contact, environment, lifecycle, data_sensitivity, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 	`
 
 	_, err = r.db.ExecContext(ctx, query,
@@ -161,6 +192,11 @@ func (r *InventoryRepository) CreateAPI(ctx context.Context, api *models.API) er
 		api.Status,
 		api.Description,
 		tagsJSON,
+		api.Owner,
+		api.Contact,
+		api.Environment,
+		api.Lifecycle,
+		api.DataSensitivity,
 		time.Now(),
 		time.Now(),
 	)
@@ -180,7 +216,8 @@ func (r *InventoryRepository) UpdateAPI(ctx context.Context, api *models.API) er
 
 	query := `
 		UPDATE scopeapi.apis 
-		SET name = $1, url = $2, base_url = $3, version = $4, protocol = $5, status = $6, description = $7, tags = $8, updated_at = $9
+		SET name = $1, url = $2, base_url = $3, version = $4, protocol = $5, status = $6, description = $7, tags = $8, updated_at = $9,
+		    owner = $11, contact = $12, environment = $13, lifecycle = $14, data_sensitivity = $15
 		WHERE id = $10
 	`
 
@@ -195,6 +232,11 @@ func (r *InventoryRepository) UpdateAPI(ctx context.Context, api *models.API) er
 		tagsJSON,
 		time.Now(),
 		api.ID,
+		api.Owner,
+		api.Contact,
+		api.Environment,
+		api.Lifecycle,
+		api.DataSensitivity,
 	)
 
 	if err != nil {
@@ -239,6 +281,12 @@ func (r *InventoryRepository) GetAPIDetails(ctx context.Context, apiID string) (
 		} else {
 			stats.InactiveEndpoints++
 		}
+		switch endpoint.TrafficState {
+		case "stale":
+			stats.StaleEndpoints++
+		case "zombie":
+			stats.ZombieEndpoints++
+		}
 	}
 
 	return &models.APIDetails{
@@ -250,8 +298,10 @@ func (r *InventoryRepository) GetAPIDetails(ctx context.Context, apiID string) (
 
 func (r *InventoryRepository) GetAPIStatistics(ctx context.Context) (*models.APIStatistics, error) {
 	stats := &models.APIStatistics{
-		ProtocolBreakdown: make(map[string]int),
-		StatusBreakdown:   make(map[string]int),
+		ProtocolBreakdown:         make(map[string]int),
+		StatusBreakdown:           make(map[string]int),
+		EndpointProtocolBreakdown: make(map[string]int),
+		EndpointTrafficBreakdown:  make(map[string]int),
 	}
 
 	// Get total APIs
@@ -316,6 +366,40 @@ func (r *InventoryRepository) GetAPIStatistics(ctx context.Context) (*models.API
 		stats.StatusBreakdown[status] = count
 	}
 
+	// Get endpoint protocol breakdown
+	endpointProtocolRows, err := r.db.QueryContext(ctx, "SELECT protocol, COUNT(*) FROM scopeapi.endpoints GROUP BY protocol")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get endpoint protocol breakdown: %w", err)
+	}
+	defer endpointProtocolRows.Close()
+
+	for endpointProtocolRows.Next() {
+		var protocol string
+		var count int
+		err := endpointProtocolRows.Scan(&protocol, &count)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan endpoint protocol breakdown: %w", err)
+		}
+		stats.EndpointProtocolBreakdown[protocol] = count
+	}
+
+	// Get endpoint traffic breakdown
+	trafficRows, err := r.db.QueryContext(ctx, "SELECT traffic_state, COUNT(*) FROM scopeapi.endpoints GROUP BY traffic_state")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get endpoint traffic breakdown: %w", err)
+	}
+	defer trafficRows.Close()
+
+	for trafficRows.Next() {
+		var state string
+		var count int
+		err := trafficRows.Scan(&state, &count)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan endpoint traffic breakdown: %w", err)
+		}
+		stats.EndpointTrafficBreakdown[state] = count
+	}
+
 	return stats, nil
 }
 
@@ -336,7 +420,8 @@ func (r *InventoryRepository) SearchAPIs(ctx context.Context, query string, page
 
 	// Get APIs
 	searchQuery := `
-		SELECT id, name, url, base_url, version, protocol, status, description, tags, created_at, updated_at
+		SELECT id, name, url, base_url, version, protocol, status, description, tags,
+		       owner, contact, environment, lifecycle, data_sensitivity, last_traffic_at, created_at, updated_at
 		FROM scopeapi.apis
 		WHERE name ILIKE $1 OR description ILIKE $1 OR url ILIKE $1
 		ORDER BY created_at DESC
@@ -353,6 +438,7 @@ func (r *InventoryRepository) SearchAPIs(ctx context.Context, query string, page
 	for rows.Next() {
 		var api models.API
 		var tagsJSON []byte
+		var lastTrafficAt sql.NullTime
 
 		err := rows.Scan(
 			&api.ID,
@@ -364,6 +450,12 @@ func (r *InventoryRepository) SearchAPIs(ctx context.Context, query string, page
 			&api.Status,
 			&api.Description,
 			&tagsJSON,
+			&api.Owner,
+			&api.Contact,
+			&api.Environment,
+			&api.Lifecycle,
+			&api.DataSensitivity,
+			&lastTrafficAt,
 			&api.CreatedAt,
 			&api.UpdatedAt,
 		)
@@ -374,6 +466,9 @@ func (r *InventoryRepository) SearchAPIs(ctx context.Context, query string, page
 		if len(tagsJSON) > 0 {
 			json.Unmarshal(tagsJSON, &api.Tags)
 		}
+		if lastTrafficAt.Valid {
+			api.LastTrafficAt = &lastTrafficAt.Time
+		}
 
 		apis = append(apis, api)
 	}
@@ -412,7 +507,8 @@ func (r *InventoryRepository) GetAPIsByTags(ctx context.Context, tags []string,
 
 	// Get APIs
 	query := fmt.Sprintf(`
-		SELECT id, name, url, base_url, version, protocol, status, description, tags, created_at, updated_at
+		SELECT id, name, url, base_url, version, protocol, status, description, tags,
+		       owner, contact, environment, lifecycle, data_sensitivity, last_traffic_at, created_at, updated_at
 		FROM scopeapi.apis
 		WHERE %s
 		ORDER BY created_at DESC
@@ -429,6 +525,7 @@ func (r *InventoryRepository) GetAPIsByTags(ctx context.Context, tags []string,
 	for rows.Next() {
 		var api models.API
 		var tagsJSON []byte
+		var lastTrafficAt sql.NullTime
 
 		err := rows.Scan(
 			&api.ID,
@@ -440,6 +537,12 @@ func (r *InventoryRepository) GetAPIsByTags(ctx context.Context, tags []string,
 			&api.Status,
 			&api.Description,
 			&tagsJSON,
+			&api.Owner,
+			&api.Contact,
+			&api.Environment,
+			&api.Lifecycle,
+			&api.DataSensitivity,
+			&lastTrafficAt,
 			&api.CreatedAt,
 			&api.UpdatedAt,
 		)
@@ -450,6 +553,9 @@ func (r *InventoryRepository) GetAPIsByTags(ctx context.Context, tags []string,
 		if len(tagsJSON) > 0 {
 			json.Unmarshal(tagsJSON, &api.Tags)
 		}
+		if lastTrafficAt.Valid {
+			api.LastTrafficAt = &lastTrafficAt.Time
+		}
 
 		apis = append(apis, api)
 	}
@@ -475,7 +581,8 @@ func (r *InventoryRepository) GetAPIsByStatus(ctx context.Context, status string
 
 	// Get APIs
 	query := `
-		SELECT id, name, url, base_url, version, protocol, status, description, tags, created_at, updated_at
+		SELECT id, name, url, base_url, version, protocol, status, description, tags,
+		       owner, contact, environment, lifecycle, data_sensitivity, last_traffic_at, created_at, updated_at
 		FROM scopeapi.apis
 		WHERE status = $1
 		ORDER BY created_at DESC
@@ -492,6 +599,7 @@ func (r *InventoryRepository) GetAPIsByStatus(ctx context.Context, status string
 	for rows.Next() {
 		var api models.API
 		var tagsJSON []byte
+		var lastTrafficAt sql.NullTime
 
 		err := rows.Scan(
 			&api.ID,
@@ -503,6 +611,12 @@ func (r *InventoryRepository) GetAPIsByStatus(ctx context.Context, status string
 			&api.Status,
 			&api.Description,
 			&tagsJSON,
+			&api.Owner,
+			&api.Contact,
+			&api.Environment,
+			&api.Lifecycle,
+			&api.DataSensitivity,
+			&lastTrafficAt,
 			&api.CreatedAt,
 			&api.UpdatedAt,
 		)
@@ -513,6 +627,9 @@ func (r *InventoryRepository) GetAPIsByStatus(ctx context.Context, status string
 		if len(tagsJSON) > 0 {
 			json.Unmarshal(tagsJSON, &api.Tags)
 		}
+		if lastTrafficAt.Valid {
+			api.LastTrafficAt = &lastTrafficAt.Time
+		}
 
 		apis = append(apis, api)
 	}
@@ -533,8 +650,8 @@ func (r *InventoryRepository) CreateEndpoint(ctx context.Context, endpoint *mode
 
 	query := `
 		INSERT INTO scopeapi.endpoints (id, api_id, url, path, method, headers, body, status_code, content_type, 
-		                      summary, description, parameters, responses, tags, is_active, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		                      summary, description, parameters, responses, tags, is_active, created_at, updated_at, protocol)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, COALESCE(NULLIF($18, ''), 'rest'))
 	`
 
 	_, err := r.db.ExecContext(ctx, query,
@@ -555,6 +672,7 @@ func (r *InventoryRepository) CreateEndpoint(ctx context.Context, endpoint *mode
 		endpoint.IsActive,
 		endpoint.CreatedAt,
 		endpoint.UpdatedAt,
+		endpoint.Protocol,
 	)
 
 	if err != nil {
@@ -574,7 +692,7 @@ func (r *InventoryRepository) UpdateEndpoint(ctx context.Context, endpoint *mode
 		UPDATE scopeapi.endpoints 
 		SET api_id = $1, url = $2, path = $3, method = $4, headers = $5, body = $6, status_code = $7,
 		    content_type = $8, summary = $9, description = $10, parameters = $11, responses = $12,
-		    tags = $13, is_active = $14, updated_at = $15
+		    tags = $13, is_active = $14, updated_at = $15, protocol = COALESCE(NULLIF($17, ''), protocol)
 		WHERE id = $16
 	`
 
@@ -595,6 +713,7 @@ func (r *InventoryRepository) UpdateEndpoint(ctx context.Context, endpoint *mode
 		endpoint.IsActive,
 		time.Now(),
 		endpoint.ID,
+		endpoint.Protocol,
 	)
 
 	if err != nil {
@@ -606,71 +725,142 @@ func (r *InventoryRepository) UpdateEndpoint(ctx context.Context, endpoint *mode
 
 func (r *InventoryRepository) GetEndpoint(ctx context.Context, endpointID string) (*models.Endpoint, error) {
 	query := `
-		SELECT id, api_id, url, path, method, headers, body, status_code, content_type, 
-		       summary, description, parameters, responses, tags, is_active, created_at, updated_at
+		SELECT id, api_id, url, path, method, protocol, headers, body, status_code, content_type, 
+		       summary, description, parameters, responses, tags, is_active, last_traffic_at, traffic_state, created_at, updated_at
 		FROM scopeapi.endpoints
 		WHERE id = $1
 	`
 
-	var endpoint models.Endpoint
-	var headersJSON, parametersJSON, responsesJSON, tagsJSON []byte
-
-	err := r.db.QueryRowContext(ctx, query, endpointID).Scan(
-		&endpoint.ID,
-		&endpoint.APIID,
-		&endpoint.URL,
-		&endpoint.Path,
-		&endpoint.Method,
-		&headersJSON,
-		&endpoint.Body,
-		&endpoint.StatusCode,
-		&endpoint.ContentType,
-		&endpoint.Summary,
-		&endpoint.Description,
-		&parametersJSON,
-		&responsesJSON,
-		&tagsJSON,
-		&endpoint.IsActive,
-		&endpoint.CreatedAt,
-		&endpoint.UpdatedAt,
-	)
-
+	endpoints, err := r.queryEndpoints(ctx, query, endpointID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("endpoint not found: %s", endpointID)
-		}
 		return nil, fmt.Errorf("failed to get endpoint: %w", err)
 	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("endpoint not found: %s", endpointID)
+	}
+	return &endpoints[0], nil
+}
+
+func (r *InventoryRepository) GetEndpoints(ctx context.Context, page, limit int) ([]models.Endpoint, error) {
+	offset := (page - 1) * limit
+
+	query := `
+		SELECT id, api_id, url, path, method, protocol, headers, body, status_code, content_type, 
+		       summary, description, parameters, responses, tags, is_active, last_traffic_at, traffic_state, created_at, updated_at
+		FROM scopeapi.endpoints
+		ORDER BY created_at DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	return r.queryEndpoints(ctx, query, limit, offset)
+}
+
+func (r *InventoryRepository) DeleteEndpoint(ctx context.Context, endpointID string) error {
+	query := `DELETE FROM scopeapi.endpoints WHERE id = $1`
+
+	_, err := r.db.ExecContext(ctx, query, endpointID)
+	if err != nil {
+		return fmt.Errorf("failed to delete endpoint: %w", err)
+	}
+
+	return nil
+}
 
-	// Unmarshal JSON fields
-	if len(headersJSON) > 0 {
-		json.Unmarshal(headersJSON, &endpoint.Headers)
+// GetEndpointsByTrafficState pages through the endpoints in a traffic state,
+// longest without traffic first
+func (r *InventoryRepository) GetEndpointsByTrafficState(ctx context.Context, state string, page, limit int) (*models.EndpointInventory, error) {
+	offset := (page - 1) * limit
+
+	countQuery := `SELECT COUNT(*) FROM scopeapi.endpoints WHERE traffic_state = $1`
+	var total int
+	err := r.db.QueryRowContext(ctx, countQuery, state).Scan(&total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get traffic state count: %w", err)
 	}
-	if len(parametersJSON) > 0 {
-		json.Unmarshal(parametersJSON, &endpoint.Parameters)
+
+	query := `
+		SELECT id, api_id, url, path, method, protocol, headers, body, status_code, content_type, 
+		       summary, description, parameters, responses, tags, is_active, last_traffic_at, traffic_state, created_at, updated_at
+		FROM scopeapi.endpoints
+		WHERE traffic_state = $1
+		ORDER BY COALESCE(last_traffic_at, created_at), path, method
+		LIMIT $2 OFFSET $3
+	`
+
+	endpoints, err := r.queryEndpoints(ctx, query, state, limit, offset)
+	if err != nil {
+		return nil, err
 	}
-	if len(responsesJSON) > 0 {
-		json.Unmarshal(responsesJSON, &endpoint.Responses)
+
+	return &models.EndpointInventory{
+		TrafficState: state,
+		Total:        total,
+		Page:         page,
+		Limit:        limit,
+		Endpoints:    endpoints,
+	}, nil
+}
+
+// GetEndpointTraffic returns when each endpoint last saw traffic, with the
+// lifecycle of its API
+func (r *InventoryRepository) GetEndpointTraffic(ctx context.Context) ([]models.EndpointTraffic, error) {
+	query := `
+		SELECT e.id, e.api_id, COALESCE(a.lifecycle, ''), e.traffic_state, e.last_traffic_at, e.created_at
+		FROM scopeapi.endpoints e
+		LEFT JOIN scopeapi.apis a ON a.id = e.api_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query endpoint traffic: %w", err)
 	}
-	if len(tagsJSON) > 0 {
-		json.Unmarshal(tagsJSON, &endpoint.Tags)
+	defer rows.Close()
+
+	var traffic []models.EndpointTraffic
+	for rows.Next() {
+		var t models.EndpointTraffic
+		var lastTrafficAt sql.NullTime
+
+		err := rows.Scan(&t.EndpointID, &t.APIID, &t.APILifecycle, &t.TrafficState, &lastTrafficAt, &t.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan endpoint traffic: %w", err)
+		}
+		if lastTrafficAt.Valid {
+			t.LastTrafficAt = &lastTrafficAt.Time
+		}
+
+		traffic = append(traffic, t)
 	}
 
-	return &endpoint, nil
+	return traffic, nil
 }
 
-func (r *InventoryRepository) GetEndpoints(ctx context.Context, page, limit int) ([]models.Endpoint, error) {
-	offset := (page - 1) * limit
+func (r *InventoryRepository) UpdateEndpointTrafficState(ctx context.Context, endpointID string, state string) error {
+	query := `UPDATE scopeapi.endpoints SET traffic_state = $1 WHERE id = $2`
+
+	_, err := r.db.ExecContext(ctx, query, state, endpointID)
+	if err != nil {
+		return fmt.Errorf("failed to update endpoint traffic state: %w", err)
+	}
 
+	return nil
+}
+
+// Helper method to get API endpoints
+func (r *InventoryRepository) getAPIEndpoints(ctx context.Context, apiID string) ([]models.Endpoint, error) {
 	query := `
-		SELECT id, api_id, url, path, method, headers, body, status_code, content_type, 
-		       summary, description, parameters, responses, tags, is_active, created_at, updated_at
+		SELECT id, api_id, url, path, method, protocol, headers, body, status_code, content_type, 
+		       summary, description, parameters, responses, tags, is_active, last_traffic_at, traffic_state, created_at, updated_at
 		FROM scopeapi.endpoints
-		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
+		WHERE api_id = $1
+		ORDER BY path, method
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	return r.queryEndpoints(ctx, query, apiID)
+}
+
+func (r *InventoryRepository) queryEndpoints(ctx context.Context, query string, args ...interface{}) ([]models.Endpoint, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query endpoints: %w", err)
 	}
@@ -680,6 +870,7 @@ func (r *InventoryRepository) GetEndpoints(ctx context.Context, page, limit int)
 	for rows.Next() {
 		var endpoint models.Endpoint
 		var headersJSON, parametersJSON, responsesJSON, tagsJSON []byte
+		var lastTrafficAt sql.NullTime
 
 		err := rows.Scan(
 			&endpoint.ID,
@@ -687,6 +878,7 @@ func (r *InventoryRepository) GetEndpoints(ctx context.Context, page, limit int)
 			&endpoint.URL,
 			&endpoint.Path,
 			&endpoint.Method,
+			&endpoint.Protocol,
 			&headersJSON,
 			&endpoint.Body,
 			&endpoint.StatusCode,
@@ -697,12 +889,17 @@ func (r *InventoryRepository) GetEndpoints(ctx context.Context, page, limit int)
 			&responsesJSON,
 			&tagsJSON,
 			&endpoint.IsActive,
+			&lastTrafficAt,
+			&endpoint.TrafficState,
 			&endpoint.CreatedAt,
 			&endpoint.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan endpoint: %w", err)
 		}
+		if lastTrafficAt.Valid {
+			endpoint.LastTrafficAt = &lastTrafficAt.Time
+		}
 
 		// Unmarshal JSON fields
 		if len(headersJSON) > 0 {
@@ -724,77 +921,149 @@ func (r *InventoryRepository) GetEndpoints(ctx context.Context, page, limit int)
 	return endpoints, nil
 }
 
-func (r *InventoryRepository) DeleteEndpoint(ctx context.Context, endpointID string) error {
-	query := `DELETE FROM scopeapi.endpoints WHERE id = $1`
+// SaveImportedSpec attaches a spec to its API, replacing the previous import
+func (r *InventoryRepository) SaveImportedSpec(ctx context.Context, imported *models.ImportedSpec) error {
+	specJSON, err := json.Marshal(imported.Spec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal imported spec: %w", err)
+	}
+	warningsJSON, _ := json.Marshal(imported.Warnings)
+
+	query := `
+		INSERT INTO scopeapi.imported_specs (id, api_id, format, source_version, spec, warnings, imported_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (api_id) DO UPDATE SET
+		    id = EXCLUDED.id,
+		    format = EXCLUDED.format,
+		    source_version = EXCLUDED.source_version,
+		    spec = EXCLUDED.spec,
+		    warnings = EXCLUDED.warnings,
+		    imported_at = EXCLUDED.imported_at
+	`
+
+	_, err = r.db.ExecContext(ctx, query,
+		imported.ID,
+		imported.APIID,
+		imported.Format,
+		imported.SourceVersion,
+		string(specJSON),
+		string(warningsJSON),
+		imported.ImportedAt,
+	)
 
-	_, err := r.db.ExecContext(ctx, query, endpointID)
 	if err != nil {
-		return fmt.Errorf("failed to delete endpoint: %w", err)
+		return fmt.Errorf("failed to save imported spec: %w", err)
 	}
 
 	return nil
 }
 
-// Helper method to get API endpoints
-func (r *InventoryRepository) getAPIEndpoints(ctx context.Context, apiID string) ([]models.Endpoint, error) {
+func (r *InventoryRepository) GetImportedSpec(ctx context.Context, apiID string) (*models.ImportedSpec, error) {
 	query := `
-		SELECT id, api_id, url, path, method, headers, body, status_code, content_type, 
-		       summary, description, parameters, responses, tags, is_active, created_at, updated_at
-		FROM scopeapi.endpoints
+		SELECT id, api_id, format, source_version, spec, warnings, imported_at
+		FROM scopeapi.imported_specs
 		WHERE api_id = $1
-		ORDER BY path, method
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, apiID)
+	specs, err := r.queryImportedSpecs(ctx, query, apiID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query API endpoints: %w", err)
+		return nil, err
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no spec imported for API: %s", apiID)
+	}
+	return &specs[0], nil
+}
+
+func (r *InventoryRepository) GetImportedSpecs(ctx context.Context) ([]models.ImportedSpec, error) {
+	query := `
+		SELECT id, api_id, format, source_version, spec, warnings, imported_at
+		FROM scopeapi.imported_specs
+		ORDER BY imported_at
+	`
+
+	return r.queryImportedSpecs(ctx, query)
+}
+
+func (r *InventoryRepository) queryImportedSpecs(ctx context.Context, query string, args ...interface{}) ([]models.ImportedSpec, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query imported specs: %w", err)
 	}
 	defer rows.Close()
 
-	var endpoints []models.Endpoint
+	var specs []models.ImportedSpec
 	for rows.Next() {
-		var endpoint models.Endpoint
-		var headersJSON, parametersJSON, responsesJSON, tagsJSON []byte
+		var imported models.ImportedSpec
+		var specJSON, warningsJSON []byte
 
 		err := rows.Scan(
-			&endpoint.ID,
-			&endpoint.APIID,
-			&endpoint.URL,
-			&endpoint.Path,
-			&endpoint.Method,
-			&headersJSON,
-			&endpoint.Body,
-			&endpoint.StatusCode,
-			&endpoint.ContentType,
-			&endpoint.Summary,
-			&endpoint.Description,
-			&parametersJSON,
-			&responsesJSON,
-			&tagsJSON,
-			&endpoint.IsActive,
-			&endpoint.CreatedAt,
-			&endpoint.UpdatedAt,
+			&imported.ID,
+			&imported.APIID,
+			&imported.Format,
+			&imported.SourceVersion,
+			&specJSON,
+			&warningsJSON,
+			&imported.ImportedAt,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan endpoint: %w", err)
+			return nil, fmt.Errorf("failed to scan imported spec: %w", err)
 		}
 
-		// Unmarshal JSON fields
-		if len(headersJSON) > 0 {
-			json.Unmarshal(headersJSON, &endpoint.Headers)
+		if err := json.Unmarshal(specJSON, &imported.Spec); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal imported spec: %w", err)
 		}
-		if len(parametersJSON) > 0 {
-			json.Unmarshal(parametersJSON, &endpoint.Parameters)
-		}
-		if len(responsesJSON) > 0 {
-			json.Unmarshal(responsesJSON, &endpoint.Responses)
-		}
-		if len(tagsJSON) > 0 {
-			json.Unmarshal(tagsJSON, &endpoint.Tags)
+		if len(warningsJSON) > 0 {
+			json.Unmarshal(warningsJSON, &imported.Warnings)
 		}
 
-		endpoints = append(endpoints, endpoint)
+		specs = append(specs, imported)
 	}
 
-	return endpoints, nil
+	return specs, nil
+}
+
+// SaveDriftReport keeps the latest drift report of an API
+func (r *InventoryRepository) SaveDriftReport(ctx context.Context, report *models.DriftReport) error {
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal drift report: %w", err)
+	}
+
+	query := `
+		INSERT INTO scopeapi.spec_drift_reports (api_id, spec_id, report, generated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (api_id) DO UPDATE SET
+		    spec_id = EXCLUDED.spec_id,
+		    report = EXCLUDED.report,
+		    generated_at = EXCLUDED.generated_at
+	`
+
+	_, err = r.db.ExecContext(ctx, query, report.APIID, report.SpecID, string(reportJSON), report.GeneratedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save drift report: %w", err)
+	}
+
+	return nil
+}
+
+// GetDriftReport returns the latest drift report of an API, or nil when the
+// API has not been checked yet
+func (r *InventoryRepository) GetDriftReport(ctx context.Context, apiID string) (*models.DriftReport, error) {
+	query := `SELECT report FROM scopeapi.spec_drift_reports WHERE api_id = $1`
+
+	var reportJSON []byte
+	err := r.db.QueryRowContext(ctx, query, apiID).Scan(&reportJSON)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get drift report: %w", err)
+	}
+
+	var report models.DriftReport
+	if err := json.Unmarshal(reportJSON, &report); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal drift report: %w", err)
+	}
+	return &report, nil
 }
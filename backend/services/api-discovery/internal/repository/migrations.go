@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migrationsTable tracks the applied api-discovery migrations. The database is
+// shared with the other services, whose migrations use the same version
+// numbers, so it is kept apart from their tables
+const migrationsTable = "api_discovery_schema_migrations"
+
+// Migration is one migration file, named like 001_create_table_name.sql
+type Migration struct {
+	Version string
+	Name    string
+	Path    string
+}
+
+// MigrationRunner applies the service's migrations in version order
+type MigrationRunner struct {
+	db *sqlx.DB
+}
+
+// NewMigrationRunner creates a new migration runner
+func NewMigrationRunner(db *sqlx.DB) *MigrationRunner {
+	return &MigrationRunner{db: db}
+}
+
+// RunMigrations applies every migration in migrationsDir that has not been
+// applied yet, each in its own transaction, and returns the applied versions
+func (mr *MigrationRunner) RunMigrations(ctx context.Context, migrationsDir string) ([]string, error) {
+	migrations, err := mr.getMigrationFiles(migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get migration files: %w", err)
+	}
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("no migrations found in %s", migrationsDir)
+	}
+
+	createQuery := `
+		CREATE TABLE IF NOT EXISTS ` + migrationsTable + ` (
+			version VARCHAR(255) PRIMARY KEY,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		)
+	`
+	if _, err := mr.db.ExecContext(ctx, createQuery); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	applied := make(map[string]bool)
+	var versions []string
+	if err := mr.db.SelectContext(ctx, &versions, `SELECT version FROM `+migrationsTable); err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	for _, version := range versions {
+		applied[version] = true
+	}
+
+	var newlyApplied []string
+	for _, migration := range migrations {
+		if applied[migration.Version] {
+			continue
+		}
+		if err := mr.applyMigration(ctx, migration); err != nil {
+			return newlyApplied, fmt.Errorf("failed to apply migration %s_%s: %w", migration.Version, migration.Name, err)
+		}
+		newlyApplied = append(newlyApplied, migration.Version)
+	}
+
+	return newlyApplied, nil
+}
+
+func (mr *MigrationRunner) getMigrationFiles(migrationsDir string) ([]Migration, error) {
+	paths, err := filepath.Glob(filepath.Join(migrationsDir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(paths))
+	for _, path := range paths {
+		filename := filepath.Base(path)
+		parts := strings.SplitN(strings.TrimSuffix(filename, ".sql"), "_", 2)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid migration filename format: %s", filename)
+		}
+		migrations = append(migrations, Migration{
+			Version: parts[0],
+			Name:    parts[1],
+			Path:    path,
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func (mr *MigrationRunner) applyMigration(ctx context.Context, migration Migration) error {
+	content, err := os.ReadFile(migration.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read migration file: %w", err)
+	}
+
+	tx, err := mr.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, string(content)); err != nil {
+		return fmt.Errorf("failed to execute migration: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO `+migrationsTable+` (version) VALUES ($1)`, migration.Version); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	return tx.Commit()
+}
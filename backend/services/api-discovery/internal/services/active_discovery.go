@@ -0,0 +1,868 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+)
+
+const (
+	// defaultCrawlDepth is how many links away from the target the crawler goes
+	defaultCrawlDepth = 3
+	// defaultCrawlRequests bounds the requests of one active discovery run
+	defaultCrawlRequests = 1000
+	// defaultCrawlRate is the requests per second sent to the target
+	defaultCrawlRate = 10
+	// maxCrawlRate bounds the rate option, whose interval must stay positive
+	maxCrawlRate = 1000
+	// crawlCheckpointInterval is how many requests are sent between saved checkpoints
+	crawlCheckpointInterval = 20
+	// maxCrawlBody bounds how much of a response is read for links
+	maxCrawlBody   = 2 << 20
+	crawlUserAgent = "ScopeAPI-Discovery/1.0"
+)
+
+// errDiscoveryStopped ends a run whose discovery was stopped, possibly by
+// another instance of the service
+var errDiscoveryStopped = errors.New("discovery stopped")
+
+// defaultCrawlWordlist is brute forced under the target when no wordlist is given
+var defaultCrawlWordlist = []string{
+	"api", "api/v1", "api/v2", "v1", "v2", "v3", "rest", "graphql",
+	"health", "healthz", "status", "info", "version", "metrics", "actuator",
+	"admin", "internal", "debug", "auth", "login", "oauth/token", "users", "account",
+	"docs", "swagger", "swagger-ui", "redoc",
+}
+
+// specLocations are where OpenAPI and Swagger documents are commonly served
+var specLocations = []string{
+	"openapi.json", "openapi.yaml", "swagger.json", "swagger.yaml",
+	"v2/api-docs", "v3/api-docs", "api-docs", "swagger/v1/swagger.json", ".well-known/openapi.json",
+}
+
+// defaultProbeMethods are tried against every endpoint the crawler finds
+var defaultProbeMethods = []string{http.MethodOptions, http.MethodHead, http.MethodPost}
+
+var (
+	htmlLink     = regexp.MustCompile(`(?i)(?:href|src|action)\s*=\s*["']([^"'#]+)`)
+	sitemapLoc   = regexp.MustCompile(`(?i)<loc>\s*([^<\s]+)\s*</loc>`)
+	staticAssets = regexp.MustCompile(`(?i)\.(css|js|mjs|map|png|jpe?g|gif|svg|ico|woff2?|ttf|eot|pdf|zip)$`)
+)
+
+// crawler is one active discovery run. It follows links, robots.txt,
+// sitemaps and OpenAPI documents from the target, brute forces a wordlist
+// under it and probes the methods of every endpoint it finds.
+type crawler struct {
+	service     *DiscoveryService
+	discovery   *models.Discovery
+	client      *http.Client
+	target      *url.URL
+	scope       crawlScope
+	maxDepth    int
+	maxRequests int
+	interval    time.Duration
+	wordlist    []string
+	methods     []string
+	credentials *models.Credentials
+	apiKey      string // header carrying an api_key credential
+	environment string // deployment of the target, for GraphQL findings
+
+	queue    []models.CrawlRequest
+	queued   map[string]bool
+	visited  []string
+	requests int
+	found    map[string]bool
+	pending  []models.Endpoint // found endpoints not saved yet
+	notFound *notFoundSignature
+}
+
+// crawlScope limits the crawler to the target's origin and the paths its
+// allow and deny rules permit
+type crawlScope struct {
+	scheme string
+	host   string
+	allow  []*regexp.Regexp
+	deny   []*regexp.Regexp
+}
+
+// notFoundSignature describes how the target answers for paths that do not
+// exist, for servers that do not answer with a 404
+type notFoundSignature struct {
+	status      int
+	contentType string
+	length      int
+}
+
+func newCrawler(service *DiscoveryService, discovery *models.Discovery) (*crawler, error) {
+	target := discovery.Target
+	if !strings.Contains(target, "://") {
+		target = "https://" + target
+	}
+	parsed, err := url.Parse(target)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("invalid discovery target %q", discovery.Target)
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/")
+	parsed.RawQuery, parsed.Fragment = "", ""
+
+	config := discovery.Config
+	if config == nil {
+		config = &models.DiscoveryConfig{}
+	}
+	options := config.Options
+	rate := intOption(options, "rate", defaultCrawlRate)
+	if rate > maxCrawlRate {
+		return nil, fmt.Errorf("crawl rate %d is above the maximum of %d requests per second", rate, maxCrawlRate)
+	}
+
+	c := &crawler{
+		service:     service,
+		discovery:   discovery,
+		target:      parsed,
+		maxDepth:    intOption(options, "max_depth", defaultCrawlDepth),
+		maxRequests: intOption(options, "max_requests", defaultCrawlRequests),
+		interval:    time.Second / time.Duration(rate),
+		wordlist:    listOption(options, "wordlist", defaultCrawlWordlist),
+		methods:     listOption(options, "methods", defaultProbeMethods),
+		credentials: config.Credentials,
+		apiKey:      options["api_key_header"],
+		environment: options["environment"],
+		queued:      make(map[string]bool),
+		found:       make(map[string]bool),
+	}
+	if c.apiKey == "" {
+		c.apiKey = "X-API-Key"
+	}
+	if c.environment == "" {
+		c.environment = "production"
+	}
+	for i, method := range c.methods {
+		c.methods[i] = strings.ToUpper(method)
+	}
+
+	c.scope = crawlScope{scheme: parsed.Scheme, host: strings.ToLower(parsed.Host)}
+	if c.scope.allow, err = globPatterns(options["allow"]); err != nil {
+		return nil, err
+	}
+	if c.scope.deny, err = globPatterns(options["deny"]); err != nil {
+		return nil, err
+	}
+
+	timeout := 10 * time.Second
+	if value, err := time.ParseDuration(options["timeout"]); err == nil && value > 0 {
+		timeout = value
+	}
+	c.client = &http.Client{
+		Timeout: timeout,
+		// Redirects are queued as links, so they are scoped like any other
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return c, nil
+}
+
+// run crawls until the queue is empty or the request budget is spent. A
+// cancelled context or a stopped discovery saves a checkpoint and returns
+// an error.
+func (c *crawler) run(ctx context.Context) error {
+	if checkpoint := c.discovery.Checkpoint; checkpoint != nil {
+		c.restore(checkpoint)
+	} else {
+		c.seed()
+	}
+	c.calibrate(ctx)
+
+	limiter := time.NewTicker(c.interval)
+	defer limiter.Stop()
+
+	for len(c.queue) > 0 && c.requests < c.maxRequests {
+		select {
+		case <-ctx.Done():
+			c.checkpoint(context.Background(), false)
+			return ctx.Err()
+		case <-limiter.C:
+		}
+
+		request := c.queue[0]
+		c.queue = c.queue[1:]
+		c.visit(ctx, request)
+
+		if c.requests%crawlCheckpointInterval == 0 {
+			if err := c.checkpoint(ctx, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.checkpoint(ctx, true)
+}
+
+// seed queues the target, the documents that describe it and the wordlist
+func (c *crawler) seed() {
+	root := *c.target
+	root.Path = ""
+	c.enqueue(http.MethodGet, c.target.String()+"/", 0, "seed")
+	c.enqueue(http.MethodGet, root.String()+"/robots.txt", 1, "robots")
+	c.enqueue(http.MethodGet, root.String()+"/sitemap.xml", 1, "sitemap")
+	for _, location := range specLocations {
+		c.enqueue(http.MethodGet, c.target.String()+"/"+location, 1, "openapi")
+		if c.target.Path != "" {
+			c.enqueue(http.MethodGet, root.String()+"/"+location, 1, "openapi")
+		}
+	}
+	for _, word := range c.wordlist {
+		c.enqueue(http.MethodGet, c.target.String()+"/"+strings.TrimPrefix(word, "/"), 1, "wordlist")
+	}
+}
+
+func (c *crawler) restore(checkpoint *models.CrawlCheckpoint) {
+	c.requests = checkpoint.Requests
+	c.visited = append(c.visited, checkpoint.Visited...)
+	for _, key := range checkpoint.Visited {
+		c.queued[key] = true
+	}
+	for _, request := range checkpoint.Queue {
+		c.queued[request.Method+" "+request.URL] = true
+		c.queue = append(c.queue, request)
+	}
+	for _, key := range checkpoint.Found {
+		c.found[key] = true
+	}
+}
+
+// checkpoint saves the endpoints found since the last checkpoint and the crawl
+// state. It returns errDiscoveryStopped when the discovery has been stopped.
+func (c *crawler) checkpoint(ctx context.Context, done bool) error {
+	repo := c.service.repo
+	saved := c.service.saveCrawledEndpoints(ctx, c.discovery.ID, c.pending)
+	c.pending = c.pending[saved:]
+
+	found := make([]string, 0, len(c.found))
+	for key := range c.found {
+		found = append(found, key)
+	}
+	sort.Strings(found)
+	checkpoint := &models.CrawlCheckpoint{
+		Queue:    append([]models.CrawlRequest{}, c.queue...),
+		Visited:  append([]string{}, c.visited...),
+		Found:    found,
+		Requests: c.requests,
+	}
+
+	progress := 100
+	if !done {
+		total := c.requests + len(c.queue)
+		if total > c.maxRequests {
+			total = c.maxRequests
+		}
+		progress = 99
+		if total > 0 && c.requests*100/total < progress {
+			progress = c.requests * 100 / total
+		}
+	}
+	if err := repo.UpdateDiscoveryProgress(ctx, c.discovery.ID, progress, checkpoint); err != nil {
+		c.service.logger.Warn("Failed to save discovery checkpoint", "error", err, "discovery_id", c.discovery.ID)
+	}
+	c.discovery.EndpointsFound = len(c.found)
+	repo.UpdateDiscoveryEndpointsFound(ctx, c.discovery.ID, len(c.found))
+
+	if done {
+		return nil
+	}
+	current, err := repo.GetDiscovery(ctx, c.discovery.ID)
+	if err == nil && current.Status == "stopped" {
+		return errDiscoveryStopped
+	}
+	return nil
+}
+
+// enqueue adds a request unless it was already queued or is out of scope
+func (c *crawler) enqueue(method, rawURL string, depth int, source string) {
+	if depth > c.maxDepth {
+		return
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !c.scope.allows(parsed) {
+		return
+	}
+	parsed.Fragment = ""
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	parsed.RawQuery = parsed.Query().Encode()
+	key := method + " " + parsed.String()
+	if c.queued[key] {
+		return
+	}
+	c.queued[key] = true
+	c.queue = append(c.queue, models.CrawlRequest{Method: method, URL: parsed.String(), Depth: depth, Source: source})
+}
+
+// calibrate learns how the target answers for a path that cannot exist
+func (c *crawler) calibrate(ctx context.Context) {
+	probe := c.target.String() + "/" + uuid.New().String()
+	resp, body, err := c.send(ctx, http.MethodGet, probe, nil)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusGone {
+		c.notFound = &notFoundSignature{
+			status:      resp.StatusCode,
+			contentType: contentMediaType(resp.Header.Get("Content-Type")),
+			length:      len(body),
+		}
+	}
+}
+
+func (c *crawler) visit(ctx context.Context, request models.CrawlRequest) {
+	c.visited = append(c.visited, request.Method+" "+request.URL)
+	c.requests++
+
+	var payload []byte
+	if request.Source == "graphql" {
+		payload = graphqlRequestPayload(graphqlIntrospectionQuery)
+	}
+	resp, body, err := c.send(ctx, request.Method, request.URL, payload)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Sent again when the run resumes
+			c.visited = c.visited[:len(c.visited)-1]
+			c.requests--
+			c.queue = append([]models.CrawlRequest{request}, c.queue...)
+			return
+		}
+		c.service.logger.Debug("Crawl request failed", "error", err, "method", request.Method, "url", request.URL)
+		return
+	}
+	location := resp.Request.URL
+	if request.Source == "graphql" {
+		c.probeGraphQL(ctx, location, resp, body)
+		return
+	}
+
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		if next, err := location.Parse(resp.Header.Get("Location")); err == nil {
+			c.enqueue(request.Method, next.String(), request.Depth, request.Source)
+		}
+		return
+	}
+
+	if !c.exists(resp, body) {
+		return
+	}
+	if request.Method == http.MethodOptions {
+		// Allow lists the methods the server accepts for the path
+		for _, method := range strings.Split(resp.Header.Get("Allow"), ",") {
+			method = strings.ToUpper(strings.TrimSpace(method))
+			if method != "" && method != http.MethodOptions && method != http.MethodHead {
+				c.record(method, location, nil)
+			}
+		}
+		return
+	}
+
+	allowed := resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented
+	switch {
+	case request.Method == http.MethodHead:
+		// HEAD is implied by GET, so it only shows endpoints GET does not reach
+		if allowed && !c.found[http.MethodGet+" "+location.Path] {
+			c.record(request.Method, location, resp)
+		}
+	case request.Method != http.MethodGet:
+		if allowed {
+			c.record(request.Method, location, resp)
+		}
+	case location.Path == "/robots.txt":
+		c.followRobots(location, body, request.Depth)
+	case bytes.Contains(body, []byte("<urlset")) || bytes.Contains(body, []byte("<sitemapindex")):
+		for _, match := range sitemapLoc.FindAllSubmatch(body, -1) {
+			c.enqueue(http.MethodGet, string(match[1]), request.Depth+1, "sitemap")
+		}
+	default:
+		if c.followSpec(location, body, request.Depth) {
+			return
+		}
+		if looksLikeGraphQL(location, body) {
+			// Queued before the method probes, which it makes redundant
+			c.enqueue(http.MethodPost, location.String(), request.Depth, "graphql")
+		}
+		isNew := allowed && c.record(http.MethodGet, location, resp)
+		c.followLinks(location, resp, body, request.Depth)
+		// A path that refuses GET may still accept other methods
+		if (isNew || !allowed) && !staticAssets.MatchString(location.Path) {
+			for _, method := range c.methods {
+				c.enqueue(method, location.String(), request.Depth, "probe")
+			}
+		}
+	}
+}
+
+// send makes a request with the discovery's credentials and reads a bounded
+// amount of the response body. Methods that take a body send payload, or an
+// empty JSON object when it is nil.
+func (c *crawler) send(ctx context.Context, method, rawURL string, payload []byte) (*http.Response, []byte, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	} else if method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch {
+		body = strings.NewReader("{}")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", crawlUserAgent)
+	req.Header.Set("Accept", "application/json, text/html;q=0.9, */*;q=0.8")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	applyCredentials(req, c.credentials, c.apiKey)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCrawlBody))
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, data, nil
+}
+
+// exists reports whether a response shows the requested path exists, though
+// possibly not for the requested method
+func (c *crawler) exists(resp *http.Response, body []byte) bool {
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return false
+	}
+	if c.notFound != nil && resp.StatusCode == c.notFound.status &&
+		contentMediaType(resp.Header.Get("Content-Type")) == c.notFound.contentType {
+		difference := len(body) - c.notFound.length
+		if difference < 0 {
+			difference = -difference
+		}
+		if difference <= 32+c.notFound.length/20 {
+			return false
+		}
+	}
+	return true
+}
+
+// record adds an endpoint found at a URL, reporting whether it is new. resp
+// is nil for endpoints that were documented or advertised but not requested.
+func (c *crawler) record(method string, location *url.URL, resp *http.Response) bool {
+	key := method + " " + location.Path
+	if c.found[key] {
+		return false
+	}
+	c.found[key] = true
+
+	now := time.Now()
+	endpoint := models.Endpoint{
+		URL:        location.Scheme + "://" + location.Host + location.Path,
+		Path:       location.Path,
+		Method:     method,
+		Parameters: queryParameters(location),
+		FirstSeen:  &now,
+		LastSeen:   &now,
+	}
+	if resp != nil {
+		endpoint.StatusCode = resp.StatusCode
+		endpoint.StatusCodes = []int{resp.StatusCode}
+		if contentType := contentMediaType(resp.Header.Get("Content-Type")); contentType != "" {
+			endpoint.ContentType = contentType
+			endpoint.ContentTypes = []string{contentType}
+		}
+	}
+	c.pending = append(c.pending, endpoint)
+	return true
+}
+
+func (c *crawler) followRobots(location *url.URL, body []byte, depth int) {
+	for _, line := range strings.Split(string(body), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(strings.SplitN(value, "#", 2)[0])
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "allow", "disallow":
+			// Disallowed paths are often the interesting ones
+			value = strings.TrimSuffix(strings.SplitN(value, "*", 2)[0], "$")
+			if value != "" && value != "/" {
+				if next, err := location.Parse(value); err == nil {
+					c.enqueue(http.MethodGet, next.String(), depth+1, "robots")
+				}
+			}
+		case "sitemap":
+			c.enqueue(http.MethodGet, value, depth+1, "sitemap")
+		}
+	}
+}
+
+// followSpec records the operations of an OpenAPI or Swagger document and
+// queues its concrete GET paths, reporting whether the body was a spec
+func (c *crawler) followSpec(location *url.URL, body []byte, depth int) bool {
+	if !bytes.Contains(body, []byte("openapi")) && !bytes.Contains(body, []byte("swagger")) {
+		return false
+	}
+	spec, _, _, err := parseSpecDocument(body)
+	if err != nil {
+		return false
+	}
+
+	base := &url.URL{Scheme: location.Scheme, Host: location.Host}
+	for _, server := range spec.Servers {
+		if serverURL, err := location.Parse(resolvedServerURL(server)); err == nil && strings.EqualFold(serverURL.Host, location.Host) {
+			base.Path = strings.TrimSuffix(serverURL.Path, "/")
+			break
+		}
+	}
+	paths := make([]string, 0, len(spec.Paths))
+	for specPath := range spec.Paths {
+		paths = append(paths, specPath)
+	}
+	sort.Strings(paths)
+
+	for _, specPath := range paths {
+		operationURL := *base
+		operationURL.Path = base.Path + specPath
+		if !c.scope.allows(&operationURL) {
+			continue
+		}
+		for _, operation := range pathOperations(spec.Paths[specPath]) {
+			method := strings.ToUpper(operation.method)
+			c.record(method, &operationURL, nil)
+			if method == http.MethodGet && !strings.Contains(specPath, "{") {
+				c.enqueue(http.MethodGet, operationURL.String(), depth+1, "openapi")
+			}
+		}
+	}
+	c.service.logger.Info("Found API spec while crawling", "discovery_id", c.discovery.ID, "url", location.String(), "paths", len(paths))
+	return true
+}
+
+// probeGraphQL records a GraphQL endpoint from the response to an
+// introspection query, then probes whether it accepts batches and deep
+// queries. Depth is probed through introspection, as other queries need
+// field names, so it is only probed when introspection is enabled.
+func (c *crawler) probeGraphQL(ctx context.Context, location *url.URL, resp *http.Response, body []byte) {
+	baseURL := location.Scheme + "://" + location.Host
+	now := time.Now()
+	schema := &models.GraphQLSchema{
+		ID:          graphqlSchemaID(baseURL, location.Path),
+		APIID:       apiIDForBaseURL(baseURL),
+		URL:         baseURL + location.Path,
+		Path:        location.Path,
+		Source:      graphqlSourceObserved,
+		Environment: c.environment,
+		FirstSeen:   &now,
+		LastSeen:    &now,
+	}
+
+	data, _ := graphqlResult(body)
+	if introspection, ok := data["__schema"].(map[string]interface{}); ok {
+		applyIntrospection(schema, introspection)
+	} else if !c.exists(resp, body) || resp.StatusCode == http.StatusMethodNotAllowed {
+		return
+	}
+	if c.record(http.MethodPost, location, resp) {
+		c.pending[len(c.pending)-1].Protocol = endpointProtocolGraphQL
+	}
+
+	if resp, body, err := c.probe(ctx, location, []byte(graphqlBatchProbe)); err == nil && resp.StatusCode == http.StatusOK {
+		var results []interface{}
+		schema.BatchingEnabled = json.Unmarshal(body, &results) == nil && len(results) == 2
+	}
+	if schema.IntrospectionEnabled {
+		depth := graphqlDepthLimit + 2
+		resp, body, err := c.probe(ctx, location, graphqlRequestPayload(graphqlDepthProbe(depth)))
+		if data, errorList := graphqlResult(body); err == nil && resp.StatusCode == http.StatusOK && data != nil && len(errorList) == 0 {
+			schema.MaxDepth = depth
+		}
+	}
+
+	if err := c.service.saveGraphQLSchema(ctx, schema, true); err != nil {
+		c.service.logger.Error("Failed to save GraphQL schema", "error", err, "url", schema.URL)
+		return
+	}
+	c.service.logger.Info("Found GraphQL endpoint while crawling", "discovery_id", c.discovery.ID, "url", schema.URL,
+		"introspection", schema.IntrospectionEnabled, "operations", len(schema.Operations))
+}
+
+// probe sends a further POST to an endpoint being probed, within the rate
+// limit and request budget of the run
+func (c *crawler) probe(ctx context.Context, location *url.URL, payload []byte) (*http.Response, []byte, error) {
+	if c.requests >= c.maxRequests {
+		return nil, nil, fmt.Errorf("request budget of %d spent", c.maxRequests)
+	}
+	select {
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	case <-time.After(c.interval):
+	}
+	c.requests++
+	return c.send(ctx, http.MethodPost, location.String(), payload)
+}
+
+// followLinks queues the links of an HTML page or the URLs in a JSON document
+func (c *crawler) followLinks(location *url.URL, resp *http.Response, body []byte, depth int) {
+	var links []string
+	if next := resp.Header.Get("Location"); next != "" {
+		links = append(links, next)
+	}
+	switch contentType := contentMediaType(resp.Header.Get("Content-Type")); {
+	case strings.Contains(contentType, "html"):
+		for _, match := range htmlLink.FindAllSubmatch(body, -1) {
+			links = append(links, string(match[1]))
+		}
+	case isJSONMediaType(contentType):
+		var document interface{}
+		if json.Unmarshal(body, &document) == nil {
+			links = jsonLinks(document, links)
+		}
+	}
+
+	for _, link := range links {
+		if strings.HasPrefix(link, "javascript:") || strings.HasPrefix(link, "mailto:") {
+			continue
+		}
+		if next, err := location.Parse(strings.TrimSpace(link)); err == nil {
+			c.enqueue(http.MethodGet, next.String(), depth+1, "link")
+		}
+	}
+}
+
+// jsonLinks collects the strings of a JSON document that look like URLs or
+// absolute paths, such as HAL and JSON:API links
+func jsonLinks(value interface{}, links []string) []string {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for _, item := range typed {
+			links = jsonLinks(item, links)
+		}
+	case []interface{}:
+		for _, item := range typed {
+			links = jsonLinks(item, links)
+		}
+	case string:
+		if strings.HasPrefix(typed, "http://") || strings.HasPrefix(typed, "https://") ||
+			strings.HasPrefix(typed, "/") && !strings.HasPrefix(typed, "//") && !strings.ContainsAny(typed, " \n") {
+			links = append(links, typed)
+		}
+	}
+	return links
+}
+
+// looksLikeGraphQL reports whether a GET response comes from a GraphQL
+// endpoint, by its path or by an error asking for a query
+func looksLikeGraphQL(location *url.URL, body []byte) bool {
+	lower := strings.ToLower(location.Path)
+	if strings.HasSuffix(lower, "graphql") || strings.HasSuffix(lower, "/gql") {
+		return true
+	}
+	_, errorList := graphqlResult(body)
+	for _, item := range errorList {
+		graphqlError, _ := item.(map[string]interface{})
+		if message, _ := graphqlError["message"].(string); strings.Contains(strings.ToLower(message), "query") {
+			return true
+		}
+	}
+	return false
+}
+
+// graphqlResult returns the data and errors of a GraphQL response body
+func graphqlResult(body []byte) (map[string]interface{}, []interface{}) {
+	var result struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors []interface{}          `json:"errors"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if decoder.Decode(&result) != nil {
+		return nil, nil
+	}
+	return result.Data, result.Errors
+}
+
+func (s crawlScope) allows(u *url.URL) bool {
+	if u.Scheme != s.scheme || !strings.EqualFold(u.Host, s.host) {
+		return false
+	}
+	urlPath := u.Path
+	if urlPath == "" {
+		urlPath = "/"
+	}
+	for _, pattern := range s.deny {
+		if pattern.MatchString(urlPath) {
+			return false
+		}
+	}
+	if len(s.allow) == 0 {
+		return true
+	}
+	for _, pattern := range s.allow {
+		if pattern.MatchString(urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// saveCrawledEndpoints templates and saves endpoints found by an active run,
+// under the same IDs passive discovery gives them, and returns how many of
+// them were saved
+func (s *DiscoveryService) saveCrawledEndpoints(ctx context.Context, discoveryID string, endpoints []models.Endpoint) int {
+	inference := s.observer.inference
+	for _, endpoint := range endpoints {
+		if !strings.Contains(endpoint.Path, "{") {
+			inference.Learn(apiIDForBaseURL(baseURLOf(endpoint.URL)), endpoint.Path)
+		}
+	}
+
+	apis := make(map[string]bool)
+	for i, endpoint := range endpoints {
+		baseURL := baseURLOf(endpoint.URL)
+		apiID := apiIDForBaseURL(baseURL)
+		if !strings.Contains(endpoint.Path, "{") {
+			template, pathParams := inference.Template(apiID, endpoint.Path)
+			endpoint.Path = template
+			endpoint.Parameters = mergePathParameters(endpoint.Parameters, pathParams)
+		}
+
+		if endpoint.Protocol == "" {
+			endpoint.Protocol = endpointProtocolREST
+		}
+
+		now := time.Now()
+		if !apis[apiID] {
+			api := models.API{
+				ID:          apiID,
+				Name:        strings.SplitN(baseURL, "://", 2)[1],
+				URL:         baseURL,
+				BaseURL:     baseURL,
+				Protocol:    endpoint.Protocol,
+				Status:      "active",
+				Description: "Discovered by active crawling",
+				Tags:        []string{"active"},
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}
+			if err := s.repo.SaveAPI(ctx, &api); err != nil {
+				s.logger.Error("Failed to save discovered API", "error", err, "api", baseURL)
+				return i
+			}
+			apis[apiID] = true
+		}
+
+		endpoint.ID = uuid.NewSHA1(uuid.NameSpaceURL, []byte(endpoint.Method+" "+baseURL+endpoint.Path)).String()
+		endpoint.APIID = apiID
+		endpoint.DiscoveryID = discoveryID
+		endpoint.Source = "active"
+		endpoint.IsActive = true
+		endpoint.CreatedAt, endpoint.UpdatedAt = now, now
+		if err := s.repo.SaveEndpoint(ctx, &endpoint); err != nil {
+			s.logger.Error("Failed to save crawled endpoint", "error", err, "method", endpoint.Method, "path", endpoint.Path)
+			return i
+		}
+	}
+	return len(endpoints)
+}
+
+// applyCredentials authenticates a request with a discovery's credentials
+func applyCredentials(req *http.Request, credentials *models.Credentials, apiKeyHeader string) {
+	if credentials == nil {
+		return
+	}
+	switch strings.ToLower(credentials.Type) {
+	case "basic":
+		req.SetBasicAuth(credentials.Username, credentials.Password)
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+credentials.Token)
+	case "api_key":
+		req.Header.Set(apiKeyHeader, credentials.APIKey)
+	}
+}
+
+func queryParameters(location *url.URL) []models.Parameter {
+	query := location.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	params := make([]models.Parameter, 0, len(names))
+	for _, name := range names {
+		params = append(params, models.Parameter{Name: name, In: "query", Type: "string", Example: query.Get(name)})
+	}
+	return params
+}
+
+func baseURLOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// globPatterns compiles comma separated path globs, where * matches any run
+// of characters
+func globPatterns(value string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, glob := range strings.Split(value, ",") {
+		glob = strings.TrimSpace(glob)
+		if glob == "" {
+			continue
+		}
+		if !strings.HasPrefix(glob, "/") {
+			glob = "/" + glob
+		}
+		pattern, err := regexp.Compile("^" + strings.ReplaceAll(regexp.QuoteMeta(path.Clean(glob)), `\*`, ".*") + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid scope rule %q: %w", glob, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// intOption reads a positive integer discovery option
+func intOption(options map[string]string, name string, fallback int) int {
+	value, err := strconv.Atoi(options[name])
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// listOption reads a comma separated discovery option
+func listOption(options map[string]string, name string, fallback []string) []string {
+	var values []string
+	for _, value := range strings.Split(options[name], ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return append([]string{}, fallback...)
+	}
+	return values
+}
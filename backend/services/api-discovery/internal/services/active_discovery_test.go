@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+// crawlTarget serves a small site and API, counting the requests it receives
+type crawlTarget struct {
+	mutex  sync.Mutex
+	hits   map[string]int
+	onHit  func(method, path string)
+	server *httptest.Server
+}
+
+func newCrawlTarget() *crawlTarget {
+	target := &crawlTarget{hits: make(map[string]int)}
+	target.server = httptest.NewServer(http.HandlerFunc(target.serve))
+	return target
+}
+
+func (t *crawlTarget) serve(w http.ResponseWriter, r *http.Request) {
+	t.mutex.Lock()
+	t.hits[r.Method+" "+r.URL.Path]++
+	onHit := t.onHit
+	t.mutex.Unlock()
+	if onHit != nil {
+		onHit(r.Method, r.URL.Path)
+	}
+
+	html := func(body string) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, body)
+	}
+	jsonBody := func(status int, body string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}
+
+	if r.URL.Path != "/api/users" && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/":
+		html(`<html><a href="/api/users">Users</a> <a href="/private/keys">Keys</a> <a href="https://elsewhere.example.com/">Out</a></html>`)
+	case "/robots.txt":
+		fmt.Fprintf(w, "User-agent: *\nDisallow: /admin # staff only\nSitemap: %s/sitemap.xml\n", t.server.URL)
+	case "/sitemap.xml":
+		fmt.Fprintf(w, `<?xml version="1.0"?><urlset><url><loc>%s/about</loc></url></urlset>`, t.server.URL)
+	case "/openapi.json":
+		jsonBody(http.StatusOK, `{"openapi": "3.0.3", "info": {"title": "Shop", "version": "1"},
+			"paths": {"/api/orders/{orderId}": {"get": {"responses": {"200": {"description": "OK"}}}, "delete": {"responses": {"204": {"description": "Gone"}}}}}}`)
+	case "/about":
+		html(`<html><body><h1>About the shop</h1><p>We sell things, and have done so for many years.</p></body></html>`)
+	case "/admin":
+		w.WriteHeader(http.StatusForbidden)
+	case "/health":
+		jsonBody(http.StatusOK, `{"status": "ok"}`)
+	case "/api/users":
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			jsonBody(http.StatusUnauthorized, `{"error": "unauthorized"}`)
+			return
+		}
+		switch r.Method {
+		case http.MethodOptions:
+			w.Header().Set("Allow", "GET, POST, OPTIONS")
+		case http.MethodPost:
+			jsonBody(http.StatusCreated, `{"id": 2}`)
+		case http.MethodGet, http.MethodHead:
+			jsonBody(http.StatusOK, `{"items": [{"id": 1, "_links": {"self": "/api/users/1"}}]}`)
+		}
+	case "/api/users/1":
+		jsonBody(http.StatusOK, `{"id": 1, "name": "Ada"}`)
+	default:
+		// A soft 404, which the crawler has to tell apart from real pages
+		html(`<html>Nothing here</html>`)
+	}
+}
+
+func (t *crawlTarget) hitCount(method, path string) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.hits[method+" "+path]
+}
+
+func newActiveDiscovery(repo *memoryDiscoveryRepository, target string) *models.Discovery {
+	discovery := &models.Discovery{
+		ID:     "crawl",
+		Target: target,
+		Method: "active",
+		Status: "running",
+		Config: &models.DiscoveryConfig{
+			Options: map[string]string{
+				"wordlist": "health,missing",
+				"rate":     "1000",
+				"deny":     "/private/*",
+			},
+			Credentials: &models.Credentials{Type: "bearer", Token: "secret"},
+		},
+	}
+	repo.CreateDiscovery(context.Background(), discovery)
+	return discovery
+}
+
+func crawledRoutes(repo *memoryDiscoveryRepository) []string {
+	var routes []string
+	for _, endpoint := range repo.endpoints {
+		routes = append(routes, endpoint.Method+" "+endpoint.Path)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+func TestActiveDiscovery(t *testing.T) {
+	target := newCrawlTarget()
+	defer target.server.Close()
+	repo := newMemoryDiscoveryRepository()
+	service := NewDiscoveryService(repo, NewPathInferenceEngine(), logging.NewStructuredLogger("test")).(*DiscoveryService)
+	defer service.Close(context.Background())
+	discovery := newActiveDiscovery(repo, target.server.URL)
+
+	crawler, err := newCrawler(service, discovery)
+	if err != nil {
+		t.Fatalf("newCrawler: %v", err)
+	}
+	if err := crawler.run(context.Background()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	want := []string{
+		"DELETE /api/orders/{orderId}",
+		"GET /",
+		"GET /about",
+		"GET /admin",
+		"GET /api/orders/{orderId}",
+		"GET /api/users",
+		"GET /api/users/{userId}",
+		"GET /health",
+		"POST /api/users",
+	}
+	if routes := crawledRoutes(repo); fmt.Sprint(routes) != fmt.Sprint(want) {
+		t.Errorf("routes =\n%v\nwant\n%v", routes, want)
+	}
+	if target.hitCount(http.MethodGet, "/private/keys") != 0 {
+		t.Errorf("denied path was requested")
+	}
+	if target.hitCount(http.MethodPost, "/api/users/1") != 1 || target.hitCount(http.MethodOptions, "/health") != 1 {
+		t.Errorf("found endpoints were not probed")
+	}
+
+	stored, _ := repo.GetDiscovery(context.Background(), "crawl")
+	if stored.Progress != 100 || stored.EndpointsFound != len(want) || stored.Checkpoint == nil || len(stored.Checkpoint.Queue) != 0 {
+		t.Errorf("discovery = %d%% %d found, checkpoint %+v", stored.Progress, stored.EndpointsFound, stored.Checkpoint)
+	}
+	for _, endpoint := range repo.endpoints {
+		if endpoint.Source != "active" || endpoint.DiscoveryID != "crawl" || endpoint.APIID != apiIDForBaseURL(target.server.URL) {
+			t.Errorf("endpoint = %+v", endpoint)
+		}
+	}
+}
+
+func TestActiveDiscoveryRejectsExcessiveRate(t *testing.T) {
+	service := &DiscoveryService{repo: newMemoryDiscoveryRepository(), logger: logging.NewStructuredLogger("test")}
+	discovery := &models.Discovery{ID: "crawl", Target: "https://shop.example.com", Method: "active", Config: &models.DiscoveryConfig{
+		Options: map[string]string{"rate": "2000000000"},
+	}}
+	if _, err := newCrawler(service, discovery); err == nil {
+		t.Fatal("newCrawler accepted a rate that rounds the interval to zero")
+	}
+
+	discovery.Config.Options["rate"] = "1000"
+	crawler, err := newCrawler(service, discovery)
+	if err != nil {
+		t.Fatalf("newCrawler(rate 1000): %v", err)
+	}
+	if crawler.interval != time.Millisecond {
+		t.Errorf("interval = %v, want 1ms", crawler.interval)
+	}
+}
+
+func TestActiveDiscoveryResume(t *testing.T) {
+	target := newCrawlTarget()
+	defer target.server.Close()
+	repo := newMemoryDiscoveryRepository()
+	service := NewDiscoveryService(repo, NewPathInferenceEngine(), logging.NewStructuredLogger("test")).(*DiscoveryService)
+	defer service.Close(context.Background())
+	discovery := newActiveDiscovery(repo, target.server.URL)
+	repo.discoveries["crawl"].Status = "stopped"
+	ctx := context.Background()
+
+	if err := service.ResumeDiscovery(ctx, "crawl"); !errors.Is(err, ErrDiscoveryNotResumable) {
+		t.Fatalf("resume without a checkpoint error = %v", err)
+	}
+
+	// Stop the run once it reaches the API
+	runCtx, cancel := context.WithCancel(ctx)
+	target.onHit = func(method, path string) {
+		if path == "/api/users" {
+			cancel()
+		}
+	}
+	crawler, _ := newCrawler(service, discovery)
+	if err := crawler.run(runCtx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled run error = %v", err)
+	}
+	stopped, _ := repo.GetDiscovery(ctx, "crawl")
+	if stopped.Checkpoint == nil || len(stopped.Checkpoint.Queue) == 0 || stopped.Progress >= 100 {
+		t.Fatalf("checkpoint = %+v, progress %d", stopped.Checkpoint, stopped.Progress)
+	}
+
+	target.mutex.Lock()
+	target.onHit = nil
+	target.mutex.Unlock()
+	if err := service.ResumeDiscovery(ctx, "crawl"); err != nil {
+		t.Fatalf("ResumeDiscovery: %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resumed, _ := repo.GetDiscovery(ctx, "crawl")
+		if resumed.Status == "completed" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("resumed discovery status = %s", resumed.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if routes := crawledRoutes(repo); !strings.Contains(fmt.Sprint(routes), "POST /api/users") || len(routes) != 9 {
+		t.Errorf("routes after resume = %v", routes)
+	}
+	if hits := target.hitCount(http.MethodGet, "/robots.txt"); hits != 1 {
+		t.Errorf("robots.txt fetched %d times", hits)
+	}
+}
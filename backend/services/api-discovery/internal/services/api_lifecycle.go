@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+)
+
+// ErrInvalidAPIMetadata is returned for API metadata outside the accepted values
+var ErrInvalidAPIMetadata = errors.New("invalid API metadata")
+
+// ErrInvalidTrafficState is returned when listing endpoints by an unknown traffic state
+var ErrInvalidTrafficState = errors.New("invalid traffic state")
+
+// Values accepted for the classified API metadata fields
+var (
+	apiEnvironments      = []string{"prod", "staging", "dev"}
+	apiLifecycles        = []string{"experimental", "active", "deprecated", "retired"}
+	apiDataSensitivities = []string{"public", "internal", "confidential", "restricted"}
+)
+
+// Endpoint traffic states
+const (
+	trafficStateActive = "active"
+	trafficStateStale  = "stale"
+	trafficStateZombie = "zombie"
+)
+
+// applyAPIMetadata validates an update and applies it to api. Nothing is
+// applied when a value is not accepted.
+func applyAPIMetadata(api *models.API, update models.APIMetadataUpdate) error {
+	fields := []struct {
+		name    string
+		value   *string
+		allowed []string
+		target  *string
+	}{
+		{"owner", update.Owner, nil, &api.Owner},
+		{"contact", update.Contact, nil, &api.Contact},
+		{"environment", update.Environment, apiEnvironments, &api.Environment},
+		{"lifecycle", update.Lifecycle, apiLifecycles, &api.Lifecycle},
+		{"data_sensitivity", update.DataSensitivity, apiDataSensitivities, &api.DataSensitivity},
+	}
+
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		if field.value == nil {
+			continue
+		}
+		value := strings.TrimSpace(*field.value)
+		if field.allowed != nil && value != "" {
+			value = strings.ToLower(value)
+			if !containsString(field.allowed, value) {
+				return fmt.Errorf("%w: %s must be one of %s", ErrInvalidAPIMetadata, field.name, strings.Join(field.allowed, ", "))
+			}
+		}
+		values[i] = value
+	}
+
+	for i, field := range fields {
+		if field.value != nil {
+			*field.target = values[i]
+		}
+	}
+	return nil
+}
+
+// endpointTrafficState classifies an endpoint by how long it has gone without
+// traffic, counted from its discovery when it was never seen in traffic.
+// Endpoints of deprecated or retired APIs are zombies as soon as they go stale.
+func endpointTrafficState(traffic models.EndpointTraffic, staleAfter, zombieAfter time.Duration, now time.Time) string {
+	since := traffic.CreatedAt
+	if traffic.LastTrafficAt != nil {
+		since = *traffic.LastTrafficAt
+	}
+
+	idle := now.Sub(since)
+	switch {
+	case idle <= staleAfter:
+		return trafficStateActive
+	case idle > zombieAfter, traffic.APILifecycle == "deprecated", traffic.APILifecycle == "retired":
+		return trafficStateZombie
+	default:
+		return trafficStateStale
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
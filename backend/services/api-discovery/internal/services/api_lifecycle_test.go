@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+func TestUpdateAPIMetadata(t *testing.T) {
+	inventory := newMemoryInventoryRepository()
+	service := NewInventoryService(inventory, newMemoryDiscoveryRepository(), logging.NewStructuredLogger("test"))
+	ctx := context.Background()
+	inventory.CreateAPI(ctx, &models.API{ID: "api-1", Name: "orders", Owner: "payments", Lifecycle: "active"})
+
+	text := func(value string) *string { return &value }
+	api, err := service.UpdateAPIMetadata(ctx, "api-1", models.APIMetadataUpdate{
+		Contact: text(" orders@example.com "), Environment: text("Prod"), DataSensitivity: text("confidential"),
+	})
+	if err != nil {
+		t.Fatalf("UpdateAPIMetadata: %v", err)
+	}
+	if api.Owner != "payments" || api.Contact != "orders@example.com" || api.Environment != "prod" ||
+		api.Lifecycle != "active" || api.DataSensitivity != "confidential" {
+		t.Errorf("api = %+v", api)
+	}
+
+	_, err = service.UpdateAPIMetadata(ctx, "api-1", models.APIMetadataUpdate{Owner: text("checkout"), Lifecycle: text("sunset")})
+	if !errors.Is(err, ErrInvalidAPIMetadata) {
+		t.Fatalf("err = %v, want ErrInvalidAPIMetadata", err)
+	}
+	if stored, _ := inventory.GetAPI(ctx, "api-1"); stored.Owner != "payments" || stored.Lifecycle != "active" {
+		t.Errorf("rejected update was applied: %+v", stored)
+	}
+
+	if api, err = service.UpdateAPIMetadata(ctx, "api-1", models.APIMetadataUpdate{Environment: text("")}); err != nil || api.Environment != "" {
+		t.Errorf("clearing environment: %+v, %v", api, err)
+	}
+	if _, err := service.UpdateAPIMetadata(ctx, "missing", models.APIMetadataUpdate{}); err == nil {
+		t.Errorf("expected an error for an unknown API")
+	}
+}
+
+func TestCheckEndpointTraffic(t *testing.T) {
+	inventory := newMemoryInventoryRepository()
+	service := NewInventoryService(inventory, newMemoryDiscoveryRepository(), logging.NewStructuredLogger("test")).(*InventoryService)
+	ctx := context.Background()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) *time.Time {
+		at := now.AddDate(0, 0, -days)
+		return &at
+	}
+
+	inventory.CreateAPI(ctx, &models.API{ID: "live"})
+	inventory.CreateAPI(ctx, &models.API{ID: "old", Lifecycle: "deprecated"})
+	endpoints := []models.Endpoint{
+		{ID: "recent", APIID: "live", Path: "/recent", LastTrafficAt: daysAgo(2), CreatedAt: *daysAgo(200)},
+		{ID: "idle", APIID: "live", Path: "/idle", LastTrafficAt: daysAgo(40), CreatedAt: *daysAgo(200)},
+		{ID: "forgotten", APIID: "live", Path: "/forgotten", LastTrafficAt: daysAgo(120), CreatedAt: *daysAgo(200)},
+		{ID: "crawled", APIID: "live", Path: "/crawled", CreatedAt: *daysAgo(45)},
+		{ID: "new", APIID: "live", Path: "/new", CreatedAt: *daysAgo(1)},
+		{ID: "deprecated", APIID: "old", Path: "/deprecated", LastTrafficAt: daysAgo(40), CreatedAt: *daysAgo(200)},
+		{ID: "revived", APIID: "live", Path: "/revived", LastTrafficAt: daysAgo(1), TrafficState: trafficStateStale, CreatedAt: *daysAgo(200)},
+	}
+	for i := range endpoints {
+		if endpoints[i].TrafficState == "" {
+			endpoints[i].TrafficState = trafficStateActive
+		}
+		inventory.CreateEndpoint(ctx, &endpoints[i])
+	}
+
+	if err := service.checkEndpointTraffic(ctx, 30*24*time.Hour, 90*24*time.Hour, now); err != nil {
+		t.Fatalf("checkEndpointTraffic: %v", err)
+	}
+	want := map[string]string{
+		"recent": "active", "idle": "stale", "forgotten": "zombie", "crawled": "stale",
+		"new": "active", "deprecated": "zombie", "revived": "active",
+	}
+	for id, state := range want {
+		if got := inventory.endpoints[id].TrafficState; got != state {
+			t.Errorf("%s is %s, want %s", id, got, state)
+		}
+	}
+
+	stale, err := service.GetEndpointsByTrafficState(ctx, "stale", 1, 50)
+	if err != nil || stale.Total != 2 || stale.Endpoints[0].Path != "/crawled" || stale.Endpoints[1].Path != "/idle" {
+		t.Errorf("stale endpoints = %+v, %v", stale, err)
+	}
+	if _, err := service.GetEndpointsByTrafficState(ctx, "dormant", 1, 50); !errors.Is(err, ErrInvalidTrafficState) {
+		t.Errorf("err = %v, want ErrInvalidTrafficState", err)
+	}
+}
@@ -2,10 +2,13 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,19 +22,47 @@ type DiscoveryServiceInterface interface {
 	GetDiscoveryStatus(ctx context.Context, discoveryID string) (*models.DiscoveryStatus, error)
 	GetDiscoveryResults(ctx context.Context, discoveryID string, page, limit int) (*models.DiscoveryResults, error)
 	StopDiscovery(ctx context.Context, discoveryID string) error
+	ResumeDiscovery(ctx context.Context, discoveryID string) error
 	AnalyzeEndpoint(ctx context.Context, endpoint *models.Endpoint) (*models.EndpointAnalysis, error)
+	ObserveTraffic(ctx context.Context, payload []byte) error
+	GetGraphQLSchemas(ctx context.Context, apiID string) ([]models.GraphQLSchema, error)
+	GetGRPCMethods(ctx context.Context, apiID string) ([]models.GRPCMethod, error)
+	Close(ctx context.Context) error
 }
 
+// ErrDiscoveryNotResumable is returned when resuming a discovery that is not a
+// stopped or failed active discovery with a saved checkpoint
+var ErrDiscoveryNotResumable = errors.New("discovery cannot be resumed")
+
 type DiscoveryService struct {
-	repo   repository.DiscoveryRepositoryInterface
-	logger logging.Logger
+	repo     repository.DiscoveryRepositoryInterface
+	logger   logging.Logger
+	observer *trafficObserver
+
+	// Cancels the discovery runs of this instance, by discovery ID
+	mutex   sync.Mutex
+	running map[string]context.CancelFunc
+
+	// Stops the observation flusher, which closes flusherDone once it returns
+	stop        chan struct{}
+	stopOnce    sync.Once
+	flusherDone chan struct{}
 }
 
-func NewDiscoveryService(repo repository.DiscoveryRepositoryInterface, logger logging.Logger) DiscoveryServiceInterface {
-	return &DiscoveryService{
-		repo:   repo,
-		logger: logger,
+func NewDiscoveryService(repo repository.DiscoveryRepositoryInterface, pathInference *PathInferenceEngine, logger logging.Logger) DiscoveryServiceInterface {
+	service := &DiscoveryService{
+		repo:     repo,
+		logger:   logger,
+		observer:    newTrafficObserver(pathInference),
+		running:     make(map[string]context.CancelFunc),
+		stop:        make(chan struct{}),
+		flusherDone: make(chan struct{}),
 	}
+
+	// Periodically write observed endpoints to the inventory
+	go service.startObservationFlusher()
+
+	return service
 }
 
 func (s *DiscoveryService) StartDiscovery(ctx context.Context, config *models.DiscoveryConfig) (string, error) {
@@ -53,7 +84,7 @@ func (s *DiscoveryService) StartDiscovery(ctx context.Context, config *models.Di
 	}
 
 	// Start discovery process asynchronously
-	go s.runDiscovery(context.Background(), discovery)
+	s.startRun(discovery)
 
 	s.logger.Info("Discovery started", "discovery_id", discoveryID, "target", config.Target)
 	return discoveryID, nil
@@ -87,31 +118,89 @@ func (s *DiscoveryService) GetDiscoveryResults(ctx context.Context, discoveryID
 	return results, nil
 }
 
+// Close stops the observation flusher and writes the observations not flushed
+// yet to the inventory, so traffic seen just before shutdown is not lost
+func (s *DiscoveryService) Close(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	select {
+	case <-s.flusherDone:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if saved := s.flushObservations(ctx, "", nil); saved > 0 {
+		s.logger.Info("Flushed observed endpoints on shutdown", "count", saved)
+	}
+	return ctx.Err()
+}
+
+// StopDiscovery marks a discovery stopped and cancels its run. Runs on other
+// instances of the service stop at their next checkpoint.
 func (s *DiscoveryService) StopDiscovery(ctx context.Context, discoveryID string) error {
 	err := s.repo.UpdateDiscoveryStatus(ctx, discoveryID, "stopped")
 	if err != nil {
 		return fmt.Errorf("failed to stop discovery: %w", err)
 	}
 
+	s.mutex.Lock()
+	if cancel, ok := s.running[discoveryID]; ok {
+		cancel()
+	}
+	s.mutex.Unlock()
+
 	s.logger.Info("Discovery stopped", "discovery_id", discoveryID)
 	return nil
 }
 
+// ResumeDiscovery restarts a stopped or failed active discovery from its last
+// checkpoint
+func (s *DiscoveryService) ResumeDiscovery(ctx context.Context, discoveryID string) error {
+	discovery, err := s.repo.GetDiscovery(ctx, discoveryID)
+	if err != nil {
+		return fmt.Errorf("failed to get discovery: %w", err)
+	}
+	if discovery.Method != "active" || discovery.Checkpoint == nil || (discovery.Status != "stopped" && discovery.Status != "failed") {
+		return fmt.Errorf("%w: %s is a %s discovery with status %s", ErrDiscoveryNotResumable, discoveryID, discovery.Method, discovery.Status)
+	}
+
+	s.mutex.Lock()
+	_, running := s.running[discoveryID]
+	s.mutex.Unlock()
+	if running {
+		return fmt.Errorf("%w: %s is still stopping", ErrDiscoveryNotResumable, discoveryID)
+	}
+
+	if err := s.repo.UpdateDiscoveryStatus(ctx, discoveryID, "running"); err != nil {
+		return fmt.Errorf("failed to resume discovery: %w", err)
+	}
+	discovery.Status = "running"
+	s.startRun(discovery)
+
+	s.logger.Info("Discovery resumed", "discovery_id", discoveryID, "requests", discovery.Checkpoint.Requests)
+	return nil
+}
+
 func (s *DiscoveryService) AnalyzeEndpoint(ctx context.Context, endpoint *models.Endpoint) (*models.EndpointAnalysis, error) {
 	analysis := &models.EndpointAnalysis{
 		EndpointID:    uuid.New().String(),
 		URL:          endpoint.URL,
 		Method:       endpoint.Method,
-		ResponseTime: s.measureResponseTime(endpoint),
-		StatusCode:   s.getStatusCode(endpoint),
-		ContentType:  s.getContentType(endpoint),
 		Parameters:   s.extractParameters(endpoint),
 		Headers:      endpoint.Headers,
-		Security:     s.analyzeSecurityHeaders(endpoint),
 		CreatedAt:    time.Now(),
 	}
 
-	err := s.repo.SaveEndpointAnalysis(ctx, analysis)
+	resp, elapsed, err := s.probeEndpoint(ctx, endpoint)
+	if err != nil {
+		s.logger.Warn("Failed to probe endpoint", "error", err, "url", endpoint.URL)
+	} else {
+		analysis.ResponseTime = elapsed
+		analysis.StatusCode = resp.StatusCode
+		analysis.ContentType = resp.Header.Get("Content-Type")
+	}
+	analysis.Security = s.analyzeSecurityHeaders(endpoint, resp)
+
+	err = s.repo.SaveEndpointAnalysis(ctx, analysis)
 	if err != nil {
 		return nil, fmt.Errorf("failed to save endpoint analysis: %w", err)
 	}
@@ -119,127 +208,150 @@ func (s *DiscoveryService) AnalyzeEndpoint(ctx context.Context, endpoint *models
 	return analysis, nil
 }
 
+// ObserveTraffic records a traffic record published by data-ingestion against
+// the endpoint it belongs to
+func (s *DiscoveryService) ObserveTraffic(ctx context.Context, payload []byte) error {
+	var traffic models.ObservedTraffic
+	if err := json.Unmarshal(payload, &traffic); err != nil {
+		return fmt.Errorf("failed to decode traffic record: %w", err)
+	}
+	return s.observer.observe(&traffic)
+}
+
+// startRun runs a discovery in the background, cancellable by StopDiscovery
+func (s *DiscoveryService) startRun(discovery *models.Discovery) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mutex.Lock()
+	s.running[discovery.ID] = cancel
+	s.mutex.Unlock()
+
+	go func() {
+		defer func() {
+			s.mutex.Lock()
+			delete(s.running, discovery.ID)
+			s.mutex.Unlock()
+			cancel()
+		}()
+		s.runDiscovery(ctx, discovery)
+	}()
+}
+
 func (s *DiscoveryService) runDiscovery(ctx context.Context, discovery *models.Discovery) {
 	s.logger.Info("Starting discovery process", "discovery_id", discovery.ID)
 
+	// Status updates use their own context, so they are recorded after the run
+	// is cancelled
+	store := context.Background()
 	defer func() {
 		if r := recover(); r != nil {
 			s.logger.Error("Discovery process panicked", "discovery_id", discovery.ID, "panic", r)
-			s.repo.UpdateDiscoveryStatus(ctx, discovery.ID, "failed")
+			s.repo.UpdateDiscoveryStatus(store, discovery.ID, "failed")
 		}
 	}()
 
+	var err error
 	switch discovery.Method {
 	case "passive":
-		s.runPassiveDiscovery(ctx, discovery)
+		err = s.runPassiveDiscovery(ctx, discovery)
 	case "active":
-		s.runActiveDiscovery(ctx, discovery)
+		err = s.runActiveDiscovery(ctx, discovery)
 	default:
-		s.logger.Error("Unknown discovery method", "method", discovery.Method)
-		s.repo.UpdateDiscoveryStatus(ctx, discovery.ID, "failed")
+		err = fmt.Errorf("unknown discovery method %q", discovery.Method)
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, errDiscoveryStopped):
+		s.logger.Info("Discovery process stopped", "discovery_id", discovery.ID, "endpoints_found", discovery.EndpointsFound)
+		return
+	case err != nil:
+		s.logger.Error("Discovery failed", "error", err, "discovery_id", discovery.ID, "method", discovery.Method)
+		s.repo.UpdateDiscoveryStatus(store, discovery.ID, "failed")
 		return
 	}
 
-	s.repo.UpdateDiscoveryStatus(ctx, discovery.ID, "completed")
+	s.repo.UpdateDiscoveryStatus(store, discovery.ID, "completed")
 	s.logger.Info("Discovery process completed", "discovery_id", discovery.ID)
 }
 
-func (s *DiscoveryService) runPassiveDiscovery(ctx context.Context, discovery *models.Discovery) {
-	// Implement passive discovery logic
-	// This would involve analyzing traffic logs, proxy logs, etc.
+func (s *DiscoveryService) runPassiveDiscovery(ctx context.Context, discovery *models.Discovery) error {
+	// Passive discovery reports the endpoints seen in the traffic stream for the
+	// target, after listening for the configured window
 	s.logger.Info("Running passive discovery", "discovery_id", discovery.ID)
-	
-	// Real passive discovery implementation
-	s.repo.UpdateDiscoveryProgress(ctx, discovery.ID, 10)
-	
-	// Analyze target for common API patterns
-	endpoints := s.analyzeTargetForAPIPatterns(discovery.Target)
-	
-	s.repo.UpdateDiscoveryProgress(ctx, discovery.ID, 50)
-	
-	// Test discovered endpoints
-	s.testDiscoveredEndpoints(ctx, discovery, endpoints)
-	
-	s.repo.UpdateDiscoveryProgress(ctx, discovery.ID, 100)
-}
 
-func (s *DiscoveryService) runActiveDiscovery(ctx context.Context, discovery *models.Discovery) {
-	// Implement active discovery logic
-	// This would involve crawling, scanning, probing endpoints
-	s.logger.Info("Running active discovery", "discovery_id", discovery.ID)
-	
-	// Real active discovery implementation
-	s.repo.UpdateDiscoveryProgress(ctx, discovery.ID, 10)
-	
-	// Use basic HTTP probing to discover endpoints
-	endpoints := s.probeTargetForEndpoints(discovery.Target)
-	
-	s.repo.UpdateDiscoveryProgress(ctx, discovery.ID, 60)
-	
-	// Test discovered endpoints
-	s.testDiscoveredEndpoints(ctx, discovery, endpoints)
-	
-	s.repo.UpdateDiscoveryProgress(ctx, discovery.ID, 100)
+	match, err := targetMatcher(discovery.Target)
+	if err != nil {
+		return err
+	}
+	// Endpoints flushed during the window are still reported by this run
+	unwatch := s.observer.watch(match)
+	defer unwatch()
+
+	window := passiveWindow(discovery.Config)
+	deadline := time.Now().Add(window)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		elapsed := window - time.Until(deadline)
+		s.repo.UpdateDiscoveryProgress(ctx, discovery.ID, int(90*elapsed/window), nil)
+	}
+
+	found := s.flushObservations(ctx, discovery.ID, match)
+	discovery.EndpointsFound = found
+	s.repo.UpdateDiscoveryEndpointsFound(ctx, discovery.ID, found)
+	s.repo.UpdateDiscoveryProgress(ctx, discovery.ID, 100, nil)
+	return nil
 }
 
-func (s *DiscoveryService) measureResponseTime(endpoint *models.Endpoint) time.Duration {
-	// Implement real response time measurement
-	start := time.Now()
-	
-	// Make HTTP request to measure response time
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("GET", endpoint.URL, nil)
-	if err != nil {
-		return 0
+// runActiveDiscovery crawls the target, starting over or from the checkpoint
+// of a resumed run. gRPC targets are discovered through server reflection.
+func (s *DiscoveryService) runActiveDiscovery(ctx context.Context, discovery *models.Discovery) error {
+	s.logger.Info("Running active discovery", "discovery_id", discovery.ID, "resumed", discovery.Checkpoint != nil)
+
+	if target, ok, err := grpcTargetOf(discovery); ok {
+		if err != nil {
+			return err
+		}
+		return s.runGRPCReflection(ctx, discovery, target)
 	}
-	
-	req.Header.Set("User-Agent", "ScopeAPI-Discovery/1.0")
-	
-	resp, err := client.Do(req)
+
+	crawler, err := newCrawler(s, discovery)
 	if err != nil {
-		return 0
+		return err
 	}
-	defer resp.Body.Close()
-	
-	return time.Since(start)
+	return crawler.run(ctx)
 }
 
-func (s *DiscoveryService) getStatusCode(endpoint *models.Endpoint) int {
-	// Implement real status code detection
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("GET", endpoint.URL, nil)
-	if err != nil {
-		return 0
+// probeEndpoint sends an endpoint's request once, returning the response and
+// how long the server took to answer
+func (s *DiscoveryService) probeEndpoint(ctx context.Context, endpoint *models.Endpoint) (*http.Response, time.Duration, error) {
+	method := endpoint.Method
+	if method == "" {
+		method = http.MethodGet
 	}
-	
-	req.Header.Set("User-Agent", "ScopeAPI-Discovery/1.0")
-	
-	resp, err := client.Do(req)
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.URL, strings.NewReader(endpoint.Body))
 	if err != nil {
-		return 0
+		return nil, 0, err
 	}
-	defer resp.Body.Close()
-	
-	return resp.StatusCode
-}
+	for name, value := range endpoint.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("User-Agent", crawlUserAgent)
 
-func (s *DiscoveryService) getContentType(endpoint *models.Endpoint) string {
-	// Implement real content type detection
 	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("GET", endpoint.URL, nil)
-	if err != nil {
-		return ""
-	}
-	
-	req.Header.Set("User-Agent", "ScopeAPI-Discovery/1.0")
-	
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
-		return ""
+		return nil, 0, err
 	}
-	defer resp.Body.Close()
-	
-	return resp.Header.Get("Content-Type")
+	elapsed := time.Since(start)
+	resp.Body.Close()
+	return resp, elapsed, nil
 }
 
 func (s *DiscoveryService) extractParameters(endpoint *models.Endpoint) []models.Parameter {
@@ -266,7 +378,9 @@ func (s *DiscoveryService) extractParameters(endpoint *models.Endpoint) []models
 	return params
 }
 
-func (s *DiscoveryService) analyzeSecurityHeaders(endpoint *models.Endpoint) *models.SecurityAnalysis {
+// analyzeSecurityHeaders checks the headers of an endpoint's response, which
+// is nil when the endpoint could not be reached
+func (s *DiscoveryService) analyzeSecurityHeaders(endpoint *models.Endpoint, resp *http.Response) *models.SecurityAnalysis {
 	// Implement real security header analysis
 	security := &models.SecurityAnalysis{
 		HasHTTPS:           false,
@@ -280,20 +394,10 @@ func (s *DiscoveryService) analyzeSecurityHeaders(endpoint *models.Endpoint) *mo
 		security.HasHTTPS = true
 	}
 	
-	// Test endpoint to analyze headers
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("GET", endpoint.URL, nil)
-	if err != nil {
-		return security
-	}
-	
-	req.Header.Set("User-Agent", "ScopeAPI-Discovery/1.0")
-	
-	resp, err := client.Do(req)
-	if err != nil {
+	if resp == nil {
 		return security
 	}
-	defer resp.Body.Close()
+	security.AuthenticationRequired = resp.StatusCode == http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") != ""
 	
 	// Check for security headers
 	securityHeaders := []string{
@@ -341,98 +445,3 @@ func (s *DiscoveryService) analyzeSecurityHeaders(endpoint *models.Endpoint) *mo
 	
 	return security
 }
-
-// Helper methods for discovery implementation
-
-func (s *DiscoveryService) analyzeTargetForAPIPatterns(target string) []models.Endpoint {
-	var endpoints []models.Endpoint
-	
-	// Common API endpoint patterns
-	patterns := []string{
-		"/api",
-		"/api/v1",
-		"/api/v2", 
-		"/rest",
-		"/graphql",
-		"/swagger",
-		"/openapi",
-		"/docs",
-		"/health",
-		"/status",
-	}
-	
-	for _, pattern := range patterns {
-		endpoint := models.Endpoint{
-			ID:        uuid.New().String(),
-			URL:       target + pattern,
-			Path:      pattern,
-			Method:    "GET",
-			IsActive:  true,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
-		endpoints = append(endpoints, endpoint)
-	}
-	
-	return endpoints
-}
-
-func (s *DiscoveryService) probeTargetForEndpoints(target string) []models.Endpoint {
-	var endpoints []models.Endpoint
-	
-	// Basic endpoint probing
-	commonPaths := []string{
-		"/",
-		"/api",
-		"/v1",
-		"/v2",
-		"/health",
-		"/status",
-		"/info",
-		"/metrics",
-	}
-	
-	for _, path := range commonPaths {
-		endpoint := models.Endpoint{
-			ID:        uuid.New().String(),
-			URL:       target + path,
-			Path:      path,
-			Method:    "GET",
-			IsActive:  true,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
-		endpoints = append(endpoints, endpoint)
-	}
-	
-	return endpoints
-}
-
-func (s *DiscoveryService) testDiscoveredEndpoints(ctx context.Context, discovery *models.Discovery, endpoints []models.Endpoint) {
-	s.logger.Info("Testing discovered endpoints", "discovery_id", discovery.ID, "count", len(endpoints))
-	
-	// Save endpoints to repository
-	for _, endpoint := range endpoints {
-		err := s.repo.SaveEndpoint(ctx, &endpoint)
-		if err != nil {
-			s.logger.Error("Failed to save endpoint", "error", err, "endpoint", endpoint.URL)
-			continue
-		}
-		
-		// Test endpoint
-		if analysis, err := s.AnalyzeEndpoint(ctx, &endpoint); err == nil {
-			// Update endpoint with analysis results
-			endpoint.StatusCode = analysis.StatusCode
-			endpoint.ContentType = analysis.ContentType
-			endpoint.Parameters = analysis.Parameters
-			endpoint.Headers = analysis.Headers
-			
-			// Save updated endpoint
-			s.repo.UpdateEndpoint(ctx, &endpoint)
-		}
-	}
-	
-	// Update discovery with endpoint count
-	discovery.EndpointsFound = len(endpoints)
-	s.repo.UpdateDiscoveryEndpointsFound(ctx, discovery.ID, len(endpoints))
-}
@@ -0,0 +1,656 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+	"scopeapi.local/backend/shared/graphql"
+)
+
+const (
+	graphqlSourceIntrospection = "introspection"
+	graphqlSourceObserved      = "observed"
+
+	// graphqlDepthLimit is the deepest query a server is expected to accept;
+	// deeper queries that succeed are reported
+	graphqlDepthLimit = 10
+
+	graphqlFindingIntrospection = "introspection_enabled"
+	graphqlFindingDepth         = "no_depth_limit"
+	graphqlFindingBatching      = "batching_enabled"
+)
+
+// graphqlIntrospectionQuery asks for the root types and the named types of a
+// schema, with type references up to six wrappers deep, e.g. [[ID!]!]!
+const graphqlIntrospectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types {
+      kind
+      name
+      fields(includeDeprecated: true) { name isDeprecated args { name type { ...TypeRef } } type { ...TypeRef } }
+      inputFields { name type { ...TypeRef } }
+      enumValues(includeDeprecated: true) { name }
+    }
+  }
+}
+fragment TypeRef on __Type {
+  kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } } }
+}`
+
+// graphqlBatchProbe is two operations in one request, which servers without
+// batching reject
+const graphqlBatchProbe = `[{"query": "{ __typename }"}, {"query": "{ __typename }"}]`
+
+var graphqlOperationOrder = map[string]int{"query": 0, "mutation": 1, "subscription": 2}
+
+var graphqlBuiltinScalars = map[string]bool{"String": true, "Int": true, "Float": true, "Boolean": true, "ID": true}
+
+// graphqlSchemaID identifies the schema served at a path of an API, whichever
+// method the requests used
+func graphqlSchemaID(baseURL, path string) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("graphql "+baseURL+path)).String()
+}
+
+// graphqlRequestPayload wraps a query in a JSON request body
+func graphqlRequestPayload(query string) []byte {
+	payload, _ := json.Marshal(map[string]string{"query": query})
+	return payload
+}
+
+// graphqlDepthProbe is an introspection query whose selections nest depth
+// levels below the root field
+func graphqlDepthProbe(depth int) string {
+	query := "{ __schema { types { fields { type { " + strings.Repeat("ofType { ", depth-4) + "name"
+	return query + strings.Repeat(" }", depth) + " }"
+}
+
+// graphqlRequest returns the GraphQL request carried by a decoded JSON body,
+// a single operation or a batch, or by the query string of a GET request. It
+// returns nil for other requests.
+func graphqlRequest(body interface{}, query map[string]string) interface{} {
+	switch typed := body.(type) {
+	case map[string]interface{}:
+		if _, ok := typed["query"].(string); ok {
+			return typed
+		}
+	case []interface{}:
+		if len(typed) > 0 {
+			if first, ok := typed[0].(map[string]interface{}); ok {
+				if _, ok := first["query"].(string); ok {
+					return typed
+				}
+			}
+		}
+	}
+	if query["query"] == "" {
+		return nil
+	}
+	return map[string]interface{}{"query": query["query"], "operationName": query["operationName"]}
+}
+
+// graphqlReconstruction builds a schema from the operations of observed
+// requests and the data returned for them
+type graphqlReconstruction struct {
+	schema    *models.GraphQLSchema
+	types     map[string]*models.GraphQLType
+	fragments map[string]map[string]interface{}
+	seen      time.Time
+}
+
+// observedGraphQLSchema reconstructs what one exchange shows of a GraphQL
+// schema: the operations requested, the types of the data returned and the
+// settings the server accepted. It returns nil when request holds no GraphQL
+// operation.
+func observedGraphQLSchema(request, response interface{}, status int, seen time.Time) *models.GraphQLSchema {
+	var requests, responses []interface{}
+	switch typed := request.(type) {
+	case map[string]interface{}:
+		requests, responses = []interface{}{typed}, []interface{}{response}
+	case []interface{}:
+		requests = typed
+		if list, ok := response.([]interface{}); ok && len(list) == len(typed) {
+			responses = list
+		}
+	default:
+		return nil
+	}
+
+	r := &graphqlReconstruction{
+		schema: &models.GraphQLSchema{Source: graphqlSourceObserved, RequestCount: 1, FirstSeen: &seen, LastSeen: &seen},
+		types:  make(map[string]*models.GraphQLType),
+		seen:   seen,
+	}
+	succeeded := status == 0 || (status >= 200 && status < 300)
+	parsed := false
+	for i, item := range requests {
+		var itemResponse interface{}
+		if i < len(responses) {
+			itemResponse = responses[i]
+		}
+		if r.exchange(item, itemResponse, succeeded) {
+			parsed = true
+		}
+	}
+	if !parsed {
+		return nil
+	}
+	// A server without batching answers a batch with a single error
+	if len(requests) > 1 && len(responses) == len(requests) && succeeded {
+		r.schema.BatchingEnabled = true
+	}
+
+	for _, graphqlType := range r.types {
+		r.schema.Types = append(r.schema.Types, *graphqlType)
+	}
+	schema := &models.GraphQLSchema{}
+	mergeGraphQLSchema(schema, r.schema)
+	return schema
+}
+
+// exchange records one operation and the response to it, reporting whether
+// the request held a GraphQL document
+func (r *graphqlReconstruction) exchange(request, response interface{}, succeeded bool) bool {
+	fields, _ := request.(map[string]interface{})
+	query, _ := fields["query"].(string)
+	if query == "" {
+		return false
+	}
+	document, err := graphql.ParseDocument(query, graphql.Options{EnumValue: graphql.EnumObject})
+	if err != nil {
+		return false
+	}
+	operationName, _ := fields["operationName"].(string)
+	operation, err := graphql.SelectOperation(document, operationName)
+	if err != nil {
+		return false
+	}
+
+	r.fragments = make(map[string]map[string]interface{})
+	fragments, _ := document["fragments"].([]interface{})
+	for _, item := range fragments {
+		fragment := item.(map[string]interface{})
+		r.fragments[fragment["name"].(string)] = fragment
+	}
+	operationType, _ := operation["operation"].(string)
+	variableTypes := make(map[string]string)
+	definitions, _ := operation["variable_definitions"].([]interface{})
+	for _, item := range definitions {
+		definition := item.(map[string]interface{})
+		variableTypes[definition["name"].(string)], _ = definition["type"].(string)
+	}
+
+	result, _ := response.(map[string]interface{})
+	data, _ := result["data"].(map[string]interface{})
+	errorList, _ := result["errors"].([]interface{})
+	selections, _ := operation["selections"].([]interface{})
+
+	for _, field := range r.fields(selections, nil) {
+		name, _ := field["name"].(string)
+		value := data[graphqlResponseKey(field)]
+		if strings.HasPrefix(name, "__") {
+			if (name == "__schema" || name == "__type") && value != nil {
+				r.schema.IntrospectionEnabled = true
+				// Only a full introspection result shows the root types
+				if introspection, ok := value.(map[string]interface{}); ok && introspection["queryType"] != nil {
+					applyIntrospection(r.schema, introspection)
+				}
+			}
+			continue
+		}
+
+		seen := r.seen
+		recorded := models.GraphQLOperation{Type: operationType, Name: name, RequestCount: 1, LastSeen: &seen}
+		arguments, _ := field["arguments"].(map[string]interface{})
+		for argument, argumentValue := range arguments {
+			recorded.Arguments = append(recorded.Arguments, models.GraphQLArgument{Name: argument, Type: graphqlArgumentType(argumentValue, variableTypes)})
+		}
+		sort.Slice(recorded.Arguments, func(i, j int) bool { return recorded.Arguments[i].Name < recorded.Arguments[j].Name })
+		recorded.ReturnType = r.valueType(field, value, graphqlTypeName(name), 0)
+		r.schema.Operations = append(r.schema.Operations, recorded)
+	}
+
+	if succeeded && data != nil && len(errorList) == 0 {
+		if depth := r.depth(selections, 0); depth > r.schema.MaxDepth {
+			r.schema.MaxDepth = depth
+		}
+	}
+	return true
+}
+
+// fields flattens the fragments of a selection set into its fields. Whether a
+// fragment applied to an object is told by the keys of the data returned.
+func (r *graphqlReconstruction) fields(selections []interface{}, visiting map[string]bool) []map[string]interface{} {
+	var fields []map[string]interface{}
+	for _, item := range selections {
+		selection, _ := item.(map[string]interface{})
+		switch selection["kind"] {
+		case "field":
+			fields = append(fields, selection)
+		case "inline_fragment":
+			nested, _ := selection["selections"].([]interface{})
+			fields = append(fields, r.fields(nested, visiting)...)
+		case "fragment_spread":
+			name, _ := selection["name"].(string)
+			fragment, ok := r.fragments[name]
+			if !ok || visiting[name] {
+				continue
+			}
+			if visiting == nil {
+				visiting = make(map[string]bool)
+			}
+			// Fragments may not spread themselves, but a hostile document can
+			visiting[name] = true
+			nested, _ := fragment["selections"].([]interface{})
+			fields = append(fields, r.fields(nested, visiting)...)
+			delete(visiting, name)
+		}
+	}
+	return fields
+}
+
+// depth is how many levels of selections nest below a selection set, so a
+// query for a scalar root field has depth 0
+func (r *graphqlReconstruction) depth(selections []interface{}, level int) int {
+	if level >= graphql.MaxDepth {
+		return 0
+	}
+	deepest := 0
+	for _, field := range r.fields(selections, nil) {
+		if nested, ok := field["selections"].([]interface{}); ok {
+			if depth := 1 + r.depth(nested, level+1); depth > deepest {
+				deepest = depth
+			}
+		}
+	}
+	return deepest
+}
+
+// valueType returns the SDL type of the value returned for a field, recording
+// the fields of the objects in it. Object types are named by __typename when
+// it was selected, and otherwise guessed from the field name.
+func (r *graphqlReconstruction) valueType(field map[string]interface{}, value interface{}, guess string, level int) string {
+	if level > graphql.MaxDepth {
+		return ""
+	}
+	switch typed := value.(type) {
+	case []interface{}:
+		element := ""
+		for _, item := range typed {
+			if itemType := r.valueType(field, item, singularGraphQLName(guess), level+1); element == "" {
+				element = itemType
+			}
+		}
+		if element == "" {
+			return ""
+		}
+		return "[" + element + "]"
+	case map[string]interface{}:
+		selections, _ := field["selections"].([]interface{})
+		if len(selections) == 0 {
+			return "JSON"
+		}
+		name, _ := typed["__typename"].(string)
+		if name == "" {
+			name = guess
+		}
+		graphqlType, ok := r.types[name]
+		if !ok {
+			graphqlType = &models.GraphQLType{Name: name, Kind: "OBJECT"}
+			r.types[name] = graphqlType
+		}
+		for _, nested := range r.fields(selections, nil) {
+			nestedName, _ := nested["name"].(string)
+			nestedValue, returned := typed[graphqlResponseKey(nested)]
+			// Fields of fragments on other types are not returned
+			if strings.HasPrefix(nestedName, "__") || !returned {
+				continue
+			}
+			nestedType := r.valueType(nested, nestedValue, graphqlTypeName(nestedName), level+1)
+			graphqlType.Fields = mergeGraphQLFields(graphqlType.Fields, []models.GraphQLArgument{{Name: nestedName, Type: nestedType}})
+		}
+		return name
+	case string:
+		return "String"
+	case bool:
+		return "Boolean"
+	case json.Number:
+		if _, err := typed.Int64(); err == nil {
+			return "Int"
+		}
+		return "Float"
+	case float64:
+		if typed == math.Trunc(typed) {
+			return "Int"
+		}
+		return "Float"
+	}
+	return ""
+}
+
+// applyIntrospection sets a schema's operations and types from the __schema
+// object of an introspection result
+func applyIntrospection(schema *models.GraphQLSchema, introspection map[string]interface{}) {
+	roots := make(map[string]string)
+	for operationType, key := range map[string]string{"query": "queryType", "mutation": "mutationType", "subscription": "subscriptionType"} {
+		if root, ok := introspection[key].(map[string]interface{}); ok {
+			if name, _ := root["name"].(string); name != "" {
+				roots[name] = operationType
+			}
+		}
+	}
+
+	schema.Source = graphqlSourceIntrospection
+	schema.IntrospectionEnabled = true
+	schema.Operations, schema.Types = nil, nil
+	types, _ := introspection["types"].([]interface{})
+	for _, item := range types {
+		introspected, _ := item.(map[string]interface{})
+		name, _ := introspected["name"].(string)
+		kind, _ := introspected["kind"].(string)
+		if name == "" || strings.HasPrefix(name, "__") || (kind == "SCALAR" && graphqlBuiltinScalars[name]) {
+			continue
+		}
+
+		graphqlType := models.GraphQLType{Name: name, Kind: kind}
+		fields, _ := introspected["fields"].([]interface{})
+		if kind == "INPUT_OBJECT" {
+			fields, _ = introspected["inputFields"].([]interface{})
+		}
+		for _, fieldItem := range fields {
+			field, _ := fieldItem.(map[string]interface{})
+			fieldName, _ := field["name"].(string)
+			fieldType := introspectionTypeRef(field["type"], 0)
+			graphqlType.Fields = append(graphqlType.Fields, models.GraphQLArgument{Name: fieldName, Type: fieldType})
+
+			operationType, root := roots[name]
+			if !root {
+				continue
+			}
+			operation := models.GraphQLOperation{Type: operationType, Name: fieldName, ReturnType: fieldType}
+			operation.Deprecated, _ = field["isDeprecated"].(bool)
+			arguments, _ := field["args"].([]interface{})
+			for _, argumentItem := range arguments {
+				argument, _ := argumentItem.(map[string]interface{})
+				argumentName, _ := argument["name"].(string)
+				operation.Arguments = append(operation.Arguments, models.GraphQLArgument{Name: argumentName, Type: introspectionTypeRef(argument["type"], 0)})
+			}
+			schema.Operations = append(schema.Operations, operation)
+		}
+		enumValues, _ := introspected["enumValues"].([]interface{})
+		for _, valueItem := range enumValues {
+			value, _ := valueItem.(map[string]interface{})
+			if valueName, _ := value["name"].(string); valueName != "" {
+				graphqlType.EnumValues = append(graphqlType.EnumValues, valueName)
+			}
+		}
+
+		// Root types are listed as operations
+		if _, root := roots[name]; !root {
+			schema.Types = append(schema.Types, graphqlType)
+		}
+	}
+}
+
+// introspectionTypeRef renders an introspected type reference in SDL notation
+func introspectionTypeRef(value interface{}, level int) string {
+	ref, _ := value.(map[string]interface{})
+	if ref == nil || level > graphql.MaxDepth {
+		return ""
+	}
+	switch ref["kind"] {
+	case "NON_NULL":
+		if inner := introspectionTypeRef(ref["ofType"], level+1); inner != "" {
+			return inner + "!"
+		}
+		return ""
+	case "LIST":
+		if inner := introspectionTypeRef(ref["ofType"], level+1); inner != "" {
+			return "[" + inner + "]"
+		}
+		return ""
+	}
+	name, _ := ref["name"].(string)
+	return name
+}
+
+// mergeGraphQLSchema folds another view of an endpoint's schema into schema.
+// Introspection results replace reconstructed operations and types, which
+// only add to what is already known.
+func mergeGraphQLSchema(schema, other *models.GraphQLSchema) {
+	introspected := other.Source == graphqlSourceIntrospection
+	if introspected || schema.Source == "" {
+		schema.Source = other.Source
+	}
+	if other.Environment != "" {
+		schema.Environment = other.Environment
+	}
+	schema.IntrospectionEnabled = schema.IntrospectionEnabled || other.IntrospectionEnabled
+	schema.BatchingEnabled = schema.BatchingEnabled || other.BatchingEnabled
+	if other.MaxDepth > schema.MaxDepth {
+		schema.MaxDepth = other.MaxDepth
+	}
+	schema.RequestCount += other.RequestCount
+	if other.FirstSeen != nil && (schema.FirstSeen == nil || other.FirstSeen.Before(*schema.FirstSeen)) {
+		schema.FirstSeen = other.FirstSeen
+	}
+	if other.LastSeen != nil && (schema.LastSeen == nil || other.LastSeen.After(*schema.LastSeen)) {
+		schema.LastSeen = other.LastSeen
+	}
+
+	operations := make(map[string]int, len(schema.Operations))
+	for i, operation := range schema.Operations {
+		operations[operation.Type+" "+operation.Name] = i
+	}
+	for _, operation := range other.Operations {
+		i, ok := operations[operation.Type+" "+operation.Name]
+		if !ok {
+			operations[operation.Type+" "+operation.Name] = len(schema.Operations)
+			schema.Operations = append(schema.Operations, operation)
+			continue
+		}
+		existing := &schema.Operations[i]
+		existing.RequestCount += operation.RequestCount
+		if operation.LastSeen != nil && (existing.LastSeen == nil || operation.LastSeen.After(*existing.LastSeen)) {
+			existing.LastSeen = operation.LastSeen
+		}
+		if introspected {
+			existing.Arguments, existing.ReturnType, existing.Deprecated = operation.Arguments, operation.ReturnType, operation.Deprecated
+			continue
+		}
+		existing.Arguments = mergeGraphQLFields(existing.Arguments, operation.Arguments)
+		if existing.ReturnType == "" {
+			existing.ReturnType = operation.ReturnType
+		}
+	}
+	sort.SliceStable(schema.Operations, func(i, j int) bool {
+		a, b := schema.Operations[i], schema.Operations[j]
+		if a.Type != b.Type {
+			return graphqlOperationOrder[a.Type] < graphqlOperationOrder[b.Type]
+		}
+		return a.Name < b.Name
+	})
+
+	if introspected {
+		schema.Types = append([]models.GraphQLType{}, other.Types...)
+	} else {
+		types := make(map[string]int, len(schema.Types))
+		for i, graphqlType := range schema.Types {
+			types[graphqlType.Name] = i
+		}
+		for _, graphqlType := range other.Types {
+			i, ok := types[graphqlType.Name]
+			if !ok {
+				types[graphqlType.Name] = len(schema.Types)
+				schema.Types = append(schema.Types, graphqlType)
+				continue
+			}
+			schema.Types[i].Fields = mergeGraphQLFields(schema.Types[i].Fields, graphqlType.Fields)
+		}
+	}
+	sort.SliceStable(schema.Types, func(i, j int) bool { return schema.Types[i].Name < schema.Types[j].Name })
+}
+
+// mergeGraphQLFields adds the fields or arguments of other that fields lacks,
+// and the types of those whose type was not known
+func mergeGraphQLFields(fields, other []models.GraphQLArgument) []models.GraphQLArgument {
+	for _, field := range other {
+		found := false
+		for i := range fields {
+			if fields[i].Name == field.Name {
+				if fields[i].Type == "" {
+					fields[i].Type = field.Type
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// graphqlFindings lists the risky settings of a GraphQL endpoint. Endpoints
+// whose environment is not known are assumed to be in production.
+func graphqlFindings(schema *models.GraphQLSchema) []models.GraphQLFinding {
+	findings := []models.GraphQLFinding{}
+	if schema.IntrospectionEnabled {
+		finding := models.GraphQLFinding{
+			Type:        graphqlFindingIntrospection,
+			Severity:    "low",
+			Description: fmt.Sprintf("Introspection is enabled in %s, exposing the full schema", schema.Environment),
+		}
+		if environment := strings.ToLower(schema.Environment); environment == "" || environment == "production" || environment == "prod" {
+			finding.Severity = "high"
+			finding.Description = "Introspection is enabled in production, exposing the full schema to anyone who can reach the endpoint"
+		}
+		findings = append(findings, finding)
+	}
+	if schema.MaxDepth > graphqlDepthLimit {
+		findings = append(findings, models.GraphQLFinding{
+			Type:        graphqlFindingDepth,
+			Severity:    "medium",
+			Description: fmt.Sprintf("A query nested %d levels deep succeeded, so query depth does not appear to be limited", schema.MaxDepth),
+		})
+	}
+	if schema.BatchingEnabled {
+		findings = append(findings, models.GraphQLFinding{
+			Type:        graphqlFindingBatching,
+			Severity:    "medium",
+			Description: "Several operations are accepted in one request, which gets around per-request rate limits",
+		})
+	}
+	return findings
+}
+
+// saveGraphQLSchema merges what was learned about a GraphQL endpoint into its
+// stored schema. The introspection and batching settings of a probe replace
+// the stored ones, so a setting that was fixed stops being reported.
+func (s *DiscoveryService) saveGraphQLSchema(ctx context.Context, schema *models.GraphQLSchema, probed bool) error {
+	stored, err := s.repo.GetGraphQLSchema(ctx, schema.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load GraphQL schema: %w", err)
+	}
+	now := time.Now()
+	if stored == nil {
+		stored = &models.GraphQLSchema{ID: schema.ID, APIID: schema.APIID, Path: schema.Path, CreatedAt: now}
+	}
+	mergeGraphQLSchema(stored, schema)
+	if probed {
+		stored.IntrospectionEnabled = schema.IntrospectionEnabled
+		stored.BatchingEnabled = schema.BatchingEnabled
+	}
+	stored.URL = schema.URL
+	stored.Findings = graphqlFindings(stored)
+	stored.UpdatedAt = now
+
+	if err := s.repo.SaveGraphQLSchema(ctx, stored); err != nil {
+		return err
+	}
+	for _, finding := range stored.Findings {
+		s.logger.Debug("GraphQL endpoint has a risky setting", "url", stored.URL, "finding", finding.Type, "severity", finding.Severity)
+	}
+	return nil
+}
+
+func (s *DiscoveryService) GetGraphQLSchemas(ctx context.Context, apiID string) ([]models.GraphQLSchema, error) {
+	schemas, err := s.repo.GetGraphQLSchemas(ctx, apiID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GraphQL schemas: %w", err)
+	}
+	return schemas, nil
+}
+
+// Helper functions
+
+// graphqlArgumentType returns the type of an argument value. Variables have
+// their declared types; literal enum values and input objects do not show
+// their type names, so they are reported by kind.
+func graphqlArgumentType(value interface{}, variableTypes map[string]string) string {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if name, ok := typed["variable"].(string); ok && len(typed) == 1 {
+			return variableTypes[name]
+		}
+		if _, ok := typed["enum"].(string); ok && len(typed) == 1 {
+			return "ENUM"
+		}
+		return "INPUT_OBJECT"
+	case []interface{}:
+		for _, item := range typed {
+			if itemType := graphqlArgumentType(item, variableTypes); itemType != "" {
+				return "[" + itemType + "]"
+			}
+		}
+	case json.Number:
+		if strings.ContainsAny(string(typed), ".eE") {
+			return "Float"
+		}
+		return "Int"
+	case string:
+		return "String"
+	case bool:
+		return "Boolean"
+	}
+	return ""
+}
+
+func graphqlResponseKey(field map[string]interface{}) string {
+	if alias, ok := field["alias"].(string); ok {
+		return alias
+	}
+	name, _ := field["name"].(string)
+	return name
+}
+
+// graphqlTypeName guesses the type returned by a field from its name
+func graphqlTypeName(field string) string {
+	runes := []rune(field)
+	if len(runes) == 0 {
+		return ""
+	}
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+func singularGraphQLName(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies") && len(name) > 3:
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss") && len(name) > 1:
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+func TestObservedGraphQLSchema(t *testing.T) {
+	repo := newMemoryDiscoveryRepository()
+	service := &DiscoveryService{repo: repo, logger: logging.NewStructuredLogger("test"), observer: newTrafficObserver(NewPathInferenceEngine())}
+	ctx := context.Background()
+
+	exchange := func(request, response string, status int) {
+		record, _ := json.Marshal(models.ObservedTraffic{
+			ID: "1", Method: "POST", URL: "https://shop.example.com/graphql", StatusCode: status,
+			ContentType: "application/json", BodyText: request,
+			ResponseHeaders: map[string]string{"Content-Type": "application/json"}, ResponseText: response,
+		})
+		if err := service.ObserveTraffic(ctx, record); err != nil {
+			t.Fatalf("ObserveTraffic: %v", err)
+		}
+	}
+	exchange(`{"query": "query User($id: ID!) { user(id: $id) { __typename id ...Names orders(first: 2) { total } } } fragment Names on User { name }",
+		"variables": {"id": "42"}}`,
+		`{"data": {"user": {"__typename": "Customer", "id": "42", "name": "Ada", "orders": [{"total": 9.5}, {"total": 3}]}}}`, 200)
+	exchange(`{"query": "mutation { cancelOrder(id: 7, reason: FRAUD, refund: {full: true}) { ok } }"}`,
+		`{"data": {"cancelOrder": {"ok": true}}}`, 200)
+	exchange(`[{"query": "{ ping }"}, {"query": "subscription { orderShipped { id } }"}]`,
+		`[{"data": {"ping": "pong"}}, {"data": null}]`, 200)
+	exchange(`{"query": "{ __schema { types { name } } }"}`, `{"errors": [{"message": "introspection is disabled"}]}`, 400)
+	deep := "{ a " + strings.Repeat("{ a ", 11) + "{ b }" + strings.Repeat(" }", 12)
+	exchange(`{"query": "`+deep+`"}`, `{"errors": [{"message": "query is too deep"}]}`, 400)
+	exchange(`{"search": "not graphql"}`, `{}`, 200)
+
+	service.flushObservations(ctx, "", nil)
+	schemas, _ := service.GetGraphQLSchemas(ctx, apiIDForBaseURL("https://shop.example.com"))
+	if len(schemas) != 1 {
+		t.Fatalf("schemas = %+v", schemas)
+	}
+	schema := schemas[0]
+	if schema.Source != graphqlSourceObserved || schema.Path != "/graphql" || schema.RequestCount != 5 || schema.IntrospectionEnabled {
+		t.Errorf("schema = %s %s %d introspection %v", schema.Source, schema.Path, schema.RequestCount, schema.IntrospectionEnabled)
+	}
+
+	var operations []string
+	for _, operation := range schema.Operations {
+		operations = append(operations, fmt.Sprintf("%s %s%v: %s", operation.Type, operation.Name, operation.Arguments, operation.ReturnType))
+	}
+	want := []string{
+		"query a[]: ",
+		"query ping[]: String",
+		"query user[{id ID!}]: Customer",
+		"mutation cancelOrder[{id Int} {reason ENUM} {refund INPUT_OBJECT}]: CancelOrder",
+		"subscription orderShipped[]: ",
+	}
+	if fmt.Sprint(operations) != fmt.Sprint(want) {
+		t.Errorf("operations =\n%v\nwant\n%v", operations, want)
+	}
+
+	types := make(map[string]string)
+	for _, graphqlType := range schema.Types {
+		types[graphqlType.Name] = fmt.Sprint(graphqlType.Fields)
+	}
+	if types["Customer"] != "[{id String} {name String} {orders [Order]}]" || types["CancelOrder"] != "[{ok Boolean}]" || types["Order"] != "[{total Float}]" {
+		t.Errorf("types = %v", types)
+	}
+
+	// The deep query failed, so only batching is reported
+	if schema.MaxDepth != 2 || len(schema.Findings) != 1 || schema.Findings[0].Type != graphqlFindingBatching {
+		t.Errorf("max depth %d, findings %+v", schema.MaxDepth, schema.Findings)
+	}
+}
+
+// graphqlTarget serves a GraphQL endpoint that allows introspection and
+// batching and does not limit query depth
+func graphqlTarget() *httptest.Server {
+	introspection := `{"data": {"__schema": {
+		"queryType": {"name": "Query"}, "mutationType": {"name": "Mutation"}, "subscriptionType": null,
+		"types": [
+			{"kind": "OBJECT", "name": "Query", "fields": [
+				{"name": "user", "isDeprecated": false, "args": [{"name": "id", "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "ID"}}}],
+				 "type": {"kind": "OBJECT", "name": "User"}},
+				{"name": "users", "isDeprecated": true, "args": [],
+				 "type": {"kind": "NON_NULL", "ofType": {"kind": "LIST", "ofType": {"kind": "NON_NULL", "ofType": {"kind": "OBJECT", "name": "User"}}}}}]},
+			{"kind": "OBJECT", "name": "Mutation", "fields": [
+				{"name": "createUser", "isDeprecated": false, "args": [{"name": "input", "type": {"kind": "NON_NULL", "ofType": {"kind": "INPUT_OBJECT", "name": "UserInput"}}}],
+				 "type": {"kind": "OBJECT", "name": "User"}}]},
+			{"kind": "OBJECT", "name": "User", "fields": [{"name": "id", "args": [], "type": {"kind": "SCALAR", "name": "ID"}}]},
+			{"kind": "INPUT_OBJECT", "name": "UserInput", "fields": null, "inputFields": [{"name": "name", "type": {"kind": "SCALAR", "name": "String"}}]},
+			{"kind": "ENUM", "name": "Role", "enumValues": [{"name": "ADMIN"}, {"name": "MEMBER"}]},
+			{"kind": "SCALAR", "name": "String"},
+			{"kind": "OBJECT", "name": "__Schema", "fields": []}
+		]}}}`
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/graphql" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors": [{"message": "Must provide query string."}]}`)
+		case strings.HasPrefix(string(body), "["):
+			fmt.Fprint(w, `[{"data": {"__typename": "Query"}}, {"data": {"__typename": "Query"}}]`)
+		case strings.Contains(string(body), "IntrospectionQuery"):
+			fmt.Fprint(w, introspection)
+		default:
+			fmt.Fprint(w, `{"data": {"__schema": {"types": []}}}`)
+		}
+	}))
+}
+
+func TestActiveGraphQLDiscovery(t *testing.T) {
+	server := graphqlTarget()
+	defer server.Close()
+	repo := newMemoryDiscoveryRepository()
+	service := NewDiscoveryService(repo, NewPathInferenceEngine(), logging.NewStructuredLogger("test")).(*DiscoveryService)
+	defer service.Close(context.Background())
+	discovery := &models.Discovery{ID: "graphql", Target: server.URL, Method: "active", Status: "running", Config: &models.DiscoveryConfig{
+		Options: map[string]string{"wordlist": "graphql", "rate": "1000", "methods": "OPTIONS", "environment": "staging"},
+	}}
+	repo.CreateDiscovery(context.Background(), discovery)
+
+	crawler, err := newCrawler(service, discovery)
+	if err != nil {
+		t.Fatalf("newCrawler: %v", err)
+	}
+	if err := crawler.run(context.Background()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	schemas, _ := service.GetGraphQLSchemas(context.Background(), apiIDForBaseURL(server.URL))
+	if len(schemas) != 1 {
+		t.Fatalf("schemas = %+v", schemas)
+	}
+	schema := schemas[0]
+	if schema.Source != graphqlSourceIntrospection || !schema.IntrospectionEnabled || !schema.BatchingEnabled || schema.MaxDepth != graphqlDepthLimit+2 {
+		t.Errorf("schema = %+v", schema)
+	}
+
+	var operations []string
+	for _, operation := range schema.Operations {
+		operations = append(operations, fmt.Sprintf("%s %s%v: %s %v", operation.Type, operation.Name, operation.Arguments, operation.ReturnType, operation.Deprecated))
+	}
+	want := []string{
+		"query user[{id ID!}]: User false",
+		"query users[]: [User!]! true",
+		"mutation createUser[{input UserInput!}]: User false",
+	}
+	if fmt.Sprint(operations) != fmt.Sprint(want) {
+		t.Errorf("operations =\n%v\nwant\n%v", operations, want)
+	}
+	if len(schema.Types) != 3 || schema.Types[0].Name != "Role" || len(schema.Types[0].EnumValues) != 2 || schema.Types[2].Fields[0].Name != "name" {
+		t.Errorf("types = %+v", schema.Types)
+	}
+
+	severities := make(map[string]string)
+	for _, finding := range schema.Findings {
+		severities[finding.Type] = finding.Severity
+	}
+	if len(severities) != 3 || severities[graphqlFindingIntrospection] != "low" {
+		t.Errorf("findings = %+v", schema.Findings)
+	}
+
+	found := false
+	for _, endpoint := range repo.endpoints {
+		found = found || (endpoint.Method == http.MethodPost && endpoint.Path == "/graphql" && endpoint.Protocol == endpointProtocolGraphQL)
+	}
+	if !found {
+		t.Errorf("GraphQL endpoint not recorded: %v", crawledRoutes(repo))
+	}
+}
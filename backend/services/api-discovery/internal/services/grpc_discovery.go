@@ -0,0 +1,782 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+)
+
+const (
+	endpointProtocolREST    = "rest"
+	endpointProtocolGraphQL = "graphql"
+	endpointProtocolGRPC    = "grpc"
+
+	grpcSourceReflection = "reflection"
+	grpcSourceObserved   = "observed"
+
+	grpcUnary           = "unary"
+	grpcClientStreaming = "client_streaming"
+	grpcServerStreaming = "server_streaming"
+	grpcBidiStreaming   = "bidi_streaming"
+
+	// maxGRPCSchemaDepth bounds how deeply nested messages are described, as
+	// message types may be recursive
+	maxGRPCSchemaDepth = 8
+)
+
+// grpcReflectionMethods are the server reflection streams, newest first.
+// Their messages are the same, so one client serves both.
+var grpcReflectionMethods = []string{
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
+// grpcMethodPath matches the HTTP/2 :path of a gRPC call, /package.Service/Method
+var grpcMethodPath = regexp.MustCompile(`^/([A-Za-z_][A-Za-z0-9_.]*)/([A-Za-z_][A-Za-z0-9_]*)$`)
+
+// splitGRPCPath returns the service and method a gRPC path calls
+func splitGRPCPath(path string) (string, string, bool) {
+	match := grpcMethodPath.FindStringSubmatch(path)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+// isGRPCTraffic reports whether a request is a gRPC call, by its content
+// type, the format data-ingestion parsed its body as or a grpc-status trailer
+func isGRPCTraffic(traffic *models.ObservedTraffic, requestType, responseType string) bool {
+	for _, media := range []string{contentMediaType(requestType), contentMediaType(responseType)} {
+		if strings.HasPrefix(media, "application/grpc") {
+			return true
+		}
+	}
+	return traffic.BodyFormat == "grpc" || traffic.ResponseFormat == "grpc" ||
+		headerValue(traffic.ResponseHeaders, "grpc-status") != ""
+}
+
+// grpcServiceURL is where a gRPC service is served; it identifies the API
+// cataloguing the service
+func grpcServiceURL(baseURL, service string) string {
+	return baseURL + "/" + service
+}
+
+// grpcServiceAPI catalogues a gRPC service as an API
+func grpcServiceAPI(baseURL, service, description, tag string) models.API {
+	now := time.Now()
+	serviceURL := grpcServiceURL(baseURL, service)
+	return models.API{
+		ID:          apiIDForBaseURL(serviceURL),
+		Name:        service,
+		URL:         serviceURL,
+		BaseURL:     baseURL,
+		Protocol:    endpointProtocolGRPC,
+		Status:      "active",
+		Description: description,
+		Tags:        []string{tag, endpointProtocolGRPC},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// grpcStreamingType names how a method streams from whether the client and
+// the server send more than one message
+func grpcStreamingType(clientStreaming, serverStreaming bool) string {
+	switch {
+	case clientStreaming && serverStreaming:
+		return grpcBidiStreaming
+	case clientStreaming:
+		return grpcClientStreaming
+	case serverStreaming:
+		return grpcServerStreaming
+	}
+	return grpcUnary
+}
+
+// mergeGRPCStreaming combines two observed streaming types. A call in which
+// each side sent one message does not rule out streaming, so a stream seen
+// once stays a stream.
+func mergeGRPCStreaming(streamingType, other string) string {
+	clientStreaming := streamingType == grpcClientStreaming || streamingType == grpcBidiStreaming ||
+		other == grpcClientStreaming || other == grpcBidiStreaming
+	serverStreaming := streamingType == grpcServerStreaming || streamingType == grpcBidiStreaming ||
+		other == grpcServerStreaming || other == grpcBidiStreaming
+	return grpcStreamingType(clientStreaming, serverStreaming)
+}
+
+// Observed messages
+
+// observedGRPCMessage describes the messages of a gRPC body from the fields
+// data-ingestion parsed out of it, and returns how many messages it held.
+// Bodies decoded without a descriptor have fields keyed by field number, each
+// an entry with a wire type, a guessed type and a value.
+func observedGRPCMessage(fields []models.ObservedField) (*models.Schema, int) {
+	var root interface{}
+	for _, field := range fields {
+		segments, ok := observedFieldPath(field.Path)
+		if !ok || len(segments) == 0 {
+			continue
+		}
+		root = insertObservedField(root, segments, field)
+	}
+	if root == nil {
+		return nil, 0
+	}
+
+	// A body of several messages was parsed as a list of them
+	messages, ok := root.([]interface{})
+	if !ok {
+		messages = []interface{}{root}
+	}
+	var schema *models.Schema
+	for _, message := range messages {
+		if message != nil {
+			schema = mergeGRPCSchema(schema, observedGRPCSchema(message, 0))
+		}
+	}
+	return schema, len(messages)
+}
+
+// observedFieldPath splits a JSONPath-style field path such as $[0].1.value
+// into keys and list indexes
+func observedFieldPath(path string) ([]interface{}, bool) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, false
+	}
+	var segments []interface{}
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			segments = append(segments, rest[1:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, false
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, false
+			}
+			segments = append(segments, index)
+			rest = rest[end+1:]
+		default:
+			return nil, false
+		}
+	}
+	return segments, true
+}
+
+// insertObservedField places a field in a tree of objects and lists rebuilt
+// from field paths
+func insertObservedField(node interface{}, segments []interface{}, field models.ObservedField) interface{} {
+	if len(segments) == 0 {
+		return field
+	}
+	switch segment := segments[0].(type) {
+	case string:
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			object = make(map[string]interface{})
+		}
+		object[segment] = insertObservedField(object[segment], segments[1:], field)
+		return object
+	case int:
+		list, _ := node.([]interface{})
+		if segment >= maxSchemaArrayItems {
+			return list
+		}
+		for len(list) <= segment {
+			list = append(list, nil)
+		}
+		list[segment] = insertObservedField(list[segment], segments[1:], field)
+		return list
+	}
+	return node
+}
+
+// observedGRPCSchema describes a node of a rebuilt message
+func observedGRPCSchema(node interface{}, depth int) *models.Schema {
+	if depth > maxSchemaDepth {
+		return &models.Schema{}
+	}
+	switch typed := node.(type) {
+	case models.ObservedField:
+		if typed.Type == "null" {
+			return &models.Schema{Nullable: true}
+		}
+		return &models.Schema{Type: typed.Type}
+	case []interface{}:
+		schema := &models.Schema{Type: "array"}
+		for _, item := range typed {
+			if item != nil {
+				schema.Items = mergeGRPCSchema(schema.Items, observedGRPCSchema(item, depth+1))
+			}
+		}
+		return schema
+	case map[string]interface{}:
+		if wireType, ok := typed["wire_type"].(models.ObservedField); ok {
+			return wireEntrySchema(wireType.Value, typed, depth)
+		}
+		schema := &models.Schema{Type: "object", Properties: make(map[string]*models.Schema)}
+		for key, value := range typed {
+			schema.Properties[key] = observedGRPCSchema(value, depth+1)
+		}
+		return schema
+	}
+	return &models.Schema{}
+}
+
+// wireEntrySchema describes a field decoded without a descriptor by its wire
+// type and, for length-delimited fields, by what its bytes looked like
+func wireEntrySchema(wireType string, entry map[string]interface{}, depth int) *models.Schema {
+	switch wireType {
+	case "varint":
+		return &models.Schema{Type: "integer", Format: "varint"}
+	case "fixed32", "fixed64":
+		return &models.Schema{Type: "number", Format: wireType}
+	case "bytes":
+		kind, _ := entry["type"].(models.ObservedField)
+		switch kind.Value {
+		case "string":
+			return &models.Schema{Type: "string"}
+		case "message":
+			return observedGRPCSchema(entry["value"], depth+1)
+		}
+		return &models.Schema{Type: "string", Format: "byte"}
+	case "group":
+		if _, ok := entry["value"].(map[string]interface{}); ok {
+			return observedGRPCSchema(entry["value"], depth+1)
+		}
+		return &models.Schema{Type: "string", Format: "byte"}
+	}
+	return &models.Schema{}
+}
+
+// mergeGRPCSchema folds other into schema, keeping the properties of both.
+// A field seen with an integer and a fractional value is a number.
+func mergeGRPCSchema(schema, other *models.Schema) *models.Schema {
+	if schema == nil {
+		return other
+	}
+	if other == nil {
+		return schema
+	}
+	switch {
+	case schema.Type == "":
+		schema.Type, schema.Format = other.Type, other.Format
+	case schema.Type == "integer" && other.Type == "number":
+		schema.Type, schema.Format = "number", ""
+	}
+	schema.Nullable = schema.Nullable || other.Nullable
+	if len(other.Properties) > 0 && schema.Properties == nil {
+		schema.Properties = make(map[string]*models.Schema)
+	}
+	for name, property := range other.Properties {
+		schema.Properties[name] = mergeGRPCSchema(schema.Properties[name], property)
+	}
+	if other.Items != nil {
+		schema.Items = mergeGRPCSchema(schema.Items, other.Items)
+	}
+	return schema
+}
+
+// addGRPC folds what a call showed of a gRPC method into the observations not
+// flushed yet
+func (o *trafficObserver) addGRPC(host string, method *models.GRPCMethod) {
+	existing, ok := o.grpc[method.ID]
+	if !ok {
+		o.grpc[method.ID] = &grpcObservation{host: host, method: method}
+		return
+	}
+	mergeGRPCMethod(existing.method, method)
+}
+
+// takeGRPC returns and forgets the gRPC observations matching match
+func (o *trafficObserver) takeGRPC(match func(*endpointObservation) bool) []grpcObservation {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	var observations []grpcObservation
+	for id, observation := range o.grpc {
+		if match != nil && !match(&endpointObservation{host: observation.host, path: observation.method.Path}) {
+			continue
+		}
+		observations = append(observations, *observation)
+		delete(o.grpc, id)
+	}
+	return observations
+}
+
+// restoreGRPC keeps a gRPC observation whose flush failed for the next one
+func (o *trafficObserver) restoreGRPC(observation grpcObservation) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.addGRPC(observation.host, observation.method)
+}
+
+// mergeGRPCMethod folds an observation of a method into what is known of it.
+// Counts add up and the seen window widens; message types, schemas and the
+// streaming type a server described through reflection are not overridden
+// by what traffic showed.
+func mergeGRPCMethod(method, other *models.GRPCMethod) {
+	method.RequestCount += other.RequestCount
+	if other.FirstSeen != nil && (method.FirstSeen == nil || other.FirstSeen.Before(*method.FirstSeen)) {
+		method.FirstSeen = other.FirstSeen
+	}
+	if other.LastSeen != nil && (method.LastSeen == nil || other.LastSeen.After(*method.LastSeen)) {
+		method.LastSeen = other.LastSeen
+	}
+	if other.Source == grpcSourceReflection {
+		method.Source = grpcSourceReflection
+		method.StreamingType = other.StreamingType
+		method.RequestType, method.ResponseType = other.RequestType, other.ResponseType
+		method.RequestSchema, method.ResponseSchema = other.RequestSchema, other.ResponseSchema
+		return
+	}
+	if method.Source == grpcSourceReflection {
+		return
+	}
+	method.StreamingType = mergeGRPCStreaming(method.StreamingType, other.StreamingType)
+	method.RequestSchema = mergeGRPCSchema(method.RequestSchema, other.RequestSchema)
+	method.ResponseSchema = mergeGRPCSchema(method.ResponseSchema, other.ResponseSchema)
+}
+
+// saveGRPCMethod merges what was learned about a gRPC method into the stored
+// method
+func (s *DiscoveryService) saveGRPCMethod(ctx context.Context, method *models.GRPCMethod) error {
+	stored, err := s.repo.GetGRPCMethod(ctx, method.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load gRPC method: %w", err)
+	}
+	now := time.Now()
+	if stored == nil {
+		stored = &models.GRPCMethod{
+			ID:            method.ID,
+			APIID:         method.APIID,
+			Service:       method.Service,
+			Method:        method.Method,
+			Path:          method.Path,
+			StreamingType: grpcUnary,
+			Source:        method.Source,
+			CreatedAt:     now,
+		}
+	}
+	mergeGRPCMethod(stored, method)
+	stored.URL = method.URL
+	stored.UpdatedAt = now
+
+	return s.repo.SaveGRPCMethod(ctx, stored)
+}
+
+func (s *DiscoveryService) GetGRPCMethods(ctx context.Context, apiID string) ([]models.GRPCMethod, error) {
+	methods, err := s.repo.GetGRPCMethods(ctx, apiID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gRPC methods: %w", err)
+	}
+	return methods, nil
+}
+
+// Server reflection
+
+// grpcTarget is a gRPC server to discover through server reflection
+type grpcTarget struct {
+	address string // host:port to dial
+	baseURL string // origin traffic to the server is observed under
+	secure  bool
+}
+
+// grpcTargetOf returns the gRPC server of a discovery whose target is a
+// grpc:// or grpcs:// URL, or whose "protocol" option is "grpc"
+func grpcTargetOf(discovery *models.Discovery) (*grpcTarget, bool, error) {
+	target := discovery.Target
+	protocol := ""
+	if discovery.Config != nil {
+		protocol = strings.ToLower(discovery.Config.Options["protocol"])
+	}
+	scheme, _, _ := strings.Cut(strings.ToLower(target), "://")
+	if scheme != "grpc" && scheme != "grpcs" && protocol != endpointProtocolGRPC {
+		return nil, false, nil
+	}
+	if !strings.Contains(target, "://") {
+		target = "grpcs://" + target
+	}
+	parsed, err := url.Parse(target)
+	if err != nil || parsed.Host == "" {
+		return nil, true, fmt.Errorf("invalid discovery target %q", discovery.Target)
+	}
+
+	secure := parsed.Scheme == "grpcs" || parsed.Scheme == "https"
+	scheme, port := "http", "80"
+	if secure {
+		scheme, port = "https", "443"
+	}
+	address := parsed.Host
+	if parsed.Port() == "" {
+		address = net.JoinHostPort(parsed.Hostname(), port)
+	}
+	return &grpcTarget{
+		address: address,
+		baseURL: scheme + "://" + normalizeHost(parsed.Host, scheme),
+		secure:  secure,
+	}, true, nil
+}
+
+// reflectionClient asks a server for its services over one reflection stream
+type reflectionClient struct {
+	stream grpc.ClientStream
+}
+
+// newReflectionClient opens a reflection stream, falling back to the
+// v1alpha service for servers that do not serve v1
+func newReflectionClient(ctx context.Context, conn *grpc.ClientConn) (*reflectionClient, []string, error) {
+	var err error
+	for _, method := range grpcReflectionMethods {
+		var stream grpc.ClientStream
+		stream, err = conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, method)
+		if err != nil {
+			return nil, nil, err
+		}
+		client := &reflectionClient{stream: stream}
+		var services []string
+		services, err = client.listServices()
+		if status.Code(err) == codes.Unimplemented {
+			stream.CloseSend()
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return client, services, nil
+	}
+	return nil, nil, fmt.Errorf("server reflection is not enabled: %w", err)
+}
+
+func (c *reflectionClient) send(request *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+	if err := c.stream.SendMsg(request); err != nil {
+		return nil, err
+	}
+	response := &reflectionpb.ServerReflectionResponse{}
+	if err := c.stream.RecvMsg(response); err != nil {
+		return nil, err
+	}
+	if failure := response.GetErrorResponse(); failure != nil {
+		return nil, status.Error(codes.Code(failure.GetErrorCode()), failure.GetErrorMessage())
+	}
+	return response, nil
+}
+
+func (c *reflectionClient) listServices() ([]string, error) {
+	response, err := c.send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{ListServices: "*"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	for _, service := range response.GetListServicesResponse().GetService() {
+		services = append(services, service.GetName())
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// files loads the files defining the named services and the files they
+// import, which the server may send with them or on request
+func (c *reflectionClient) files(services []string) (*descriptorpb.FileDescriptorSet, error) {
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	add := func(response *reflectionpb.ServerReflectionResponse) error {
+		for _, data := range response.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			file := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(data, file); err != nil {
+				return fmt.Errorf("invalid file descriptor: %w", err)
+			}
+			files[file.GetName()] = file
+		}
+		return nil
+	}
+
+	for _, service := range services {
+		response, err := c.send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get descriptor of %s: %w", service, err)
+		}
+		if err := add(response); err != nil {
+			return nil, err
+		}
+	}
+
+	requested := make(map[string]bool)
+	for missing := true; missing; {
+		missing = false
+		for _, file := range files {
+			for _, dependency := range file.GetDependency() {
+				if files[dependency] != nil || requested[dependency] {
+					continue
+				}
+				requested[dependency] = true
+				missing = true
+				response, err := c.send(&reflectionpb.ServerReflectionRequest{
+					MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: dependency},
+				})
+				if err != nil {
+					// Left unresolved; fields of its types are described without them
+					continue
+				}
+				if err := add(response); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, file := range files {
+		set.File = append(set.File, file)
+	}
+	return set, nil
+}
+
+// runGRPCReflection catalogues the services a gRPC server describes through
+// server reflection: each service as an API and each method as an endpoint
+// with its streaming type and message schemas
+func (s *DiscoveryService) runGRPCReflection(ctx context.Context, discovery *models.Discovery, target *grpcTarget) error {
+	options := map[string]string{}
+	var credentialsConfig *models.Credentials
+	if discovery.Config != nil {
+		options = discovery.Config.Options
+		credentialsConfig = discovery.Config.Credentials
+	}
+	timeout := 10 * time.Second
+	if value, err := time.ParseDuration(options["timeout"]); err == nil && value > 0 {
+		timeout = value
+	}
+
+	transport := insecure.NewCredentials()
+	if target.secure {
+		transport = credentials.NewTLS(nil)
+	}
+	conn, err := grpc.NewClient(target.address, grpc.WithTransportCredentials(transport), grpc.WithUserAgent(crawlUserAgent))
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", target.address, err)
+	}
+	defer conn.Close()
+
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	callCtx = grpcCredentials(callCtx, credentialsConfig, options["api_key_header"])
+
+	client, services, err := newReflectionClient(callCtx, conn)
+	if err != nil {
+		return err
+	}
+	defer client.stream.CloseSend()
+
+	// The reflection services describe themselves
+	var names []string
+	for _, service := range services {
+		if !strings.HasPrefix(service, "grpc.reflection.") {
+			names = append(names, service)
+		}
+	}
+	set, err := client.files(names)
+	if err != nil {
+		return err
+	}
+	files, err := protodesc.FileOptions{AllowUnresolvable: true}.NewFiles(set)
+	if err != nil {
+		return fmt.Errorf("failed to resolve file descriptors: %w", err)
+	}
+	s.repo.UpdateDiscoveryProgress(ctx, discovery.ID, 50, nil)
+
+	found := 0
+	for _, name := range names {
+		descriptor, err := files.FindDescriptorByName(protoreflect.FullName(name))
+		service, ok := descriptor.(protoreflect.ServiceDescriptor)
+		if err != nil || !ok {
+			s.logger.Warn("gRPC service has no descriptor", "discovery_id", discovery.ID, "service", name)
+			continue
+		}
+		saved, err := s.saveReflectedService(ctx, discovery.ID, target.baseURL, service)
+		found += saved
+		if err != nil {
+			return err
+		}
+	}
+
+	discovery.EndpointsFound = found
+	s.repo.UpdateDiscoveryEndpointsFound(ctx, discovery.ID, found)
+	s.repo.UpdateDiscoveryProgress(ctx, discovery.ID, 100, nil)
+	s.logger.Info("Discovered gRPC services through server reflection", "discovery_id", discovery.ID,
+		"target", target.address, "services", len(names), "methods", found)
+	return nil
+}
+
+// saveReflectedService saves a service described through reflection and its
+// methods, returning how many methods were saved
+func (s *DiscoveryService) saveReflectedService(ctx context.Context, discoveryID, baseURL string, service protoreflect.ServiceDescriptor) (int, error) {
+	api := grpcServiceAPI(baseURL, string(service.FullName()), "Discovered through gRPC server reflection", "active")
+	if err := s.repo.SaveAPI(ctx, &api); err != nil {
+		return 0, fmt.Errorf("failed to save gRPC service %s: %w", service.FullName(), err)
+	}
+
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		descriptor := methods.Get(i)
+		now := time.Now()
+		method := &models.GRPCMethod{
+			APIID:          api.ID,
+			Service:        string(service.FullName()),
+			Method:         string(descriptor.Name()),
+			Path:           "/" + string(service.FullName()) + "/" + string(descriptor.Name()),
+			StreamingType:  grpcStreamingType(descriptor.IsStreamingClient(), descriptor.IsStreamingServer()),
+			RequestType:    string(descriptor.Input().FullName()),
+			ResponseType:   string(descriptor.Output().FullName()),
+			RequestSchema:  grpcMessageSchema(descriptor.Input(), 0),
+			ResponseSchema: grpcMessageSchema(descriptor.Output(), 0),
+			Source:         grpcSourceReflection,
+			FirstSeen:      &now,
+			LastSeen:       &now,
+		}
+		method.ID = uuid.NewSHA1(uuid.NameSpaceURL, []byte("POST "+baseURL+method.Path)).String()
+		method.URL = baseURL + method.Path
+
+		endpoint := models.Endpoint{
+			ID:           method.ID,
+			APIID:        api.ID,
+			URL:          method.URL,
+			Path:         method.Path,
+			Method:       "POST",
+			Protocol:     endpointProtocolGRPC,
+			ContentType:  "application/grpc",
+			ContentTypes: []string{"application/grpc"},
+			Summary:      method.Method,
+			Description:  fmt.Sprintf("%s %s(%s) returns (%s)", method.StreamingType, method.Method, method.RequestType, method.ResponseType),
+			IsActive:     true,
+			DiscoveryID:  discoveryID,
+			Source:       "active",
+			FirstSeen:    &now,
+			LastSeen:     &now,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if err := s.repo.SaveEndpoint(ctx, &endpoint); err != nil {
+			return i, fmt.Errorf("failed to save gRPC method %s: %w", method.Path, err)
+		}
+		if err := s.saveGRPCMethod(ctx, method); err != nil {
+			return i, fmt.Errorf("failed to save gRPC method %s: %w", method.Path, err)
+		}
+	}
+	return methods.Len(), nil
+}
+
+// grpcCredentials sends a discovery's credentials as call metadata
+func grpcCredentials(ctx context.Context, credentials *models.Credentials, apiKeyHeader string) context.Context {
+	if credentials == nil {
+		return ctx
+	}
+	switch strings.ToLower(credentials.Type) {
+	case "basic":
+		token := base64.StdEncoding.EncodeToString([]byte(credentials.Username + ":" + credentials.Password))
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Basic "+token)
+	case "bearer":
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+credentials.Token)
+	case "api_key":
+		if apiKeyHeader == "" {
+			apiKeyHeader = "X-API-Key"
+		}
+		return metadata.AppendToOutgoingContext(ctx, strings.ToLower(apiKeyHeader), credentials.APIKey)
+	}
+	return ctx
+}
+
+// grpcMessageSchema describes a message type with its fields named as in the
+// .proto definition
+func grpcMessageSchema(message protoreflect.MessageDescriptor, depth int) *models.Schema {
+	schema := &models.Schema{Type: "object", Title: string(message.FullName())}
+	if depth >= maxGRPCSchemaDepth {
+		return schema
+	}
+	fields := message.Fields()
+	schema.Properties = make(map[string]*models.Schema, fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		schema.Properties[string(field.Name())] = grpcFieldSchema(field, depth)
+		if field.Cardinality() == protoreflect.Required {
+			schema.Required = append(schema.Required, string(field.Name()))
+		}
+	}
+	return schema
+}
+
+func grpcFieldSchema(field protoreflect.FieldDescriptor, depth int) *models.Schema {
+	switch {
+	case field.IsMap():
+		return &models.Schema{Type: "object", AdditionalProperties: grpcValueSchema(field.MapValue(), depth)}
+	case field.IsList():
+		return &models.Schema{Type: "array", Items: grpcValueSchema(field, depth)}
+	}
+	return grpcValueSchema(field, depth)
+}
+
+// grpcValueSchema describes one value of a field, whatever its cardinality
+func grpcValueSchema(field protoreflect.FieldDescriptor, depth int) *models.Schema {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return &models.Schema{Type: "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return &models.Schema{Type: "integer", Format: "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return &models.Schema{Type: "integer", Format: "uint32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return &models.Schema{Type: "integer", Format: "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return &models.Schema{Type: "integer", Format: "uint64"}
+	case protoreflect.FloatKind:
+		return &models.Schema{Type: "number", Format: "float"}
+	case protoreflect.DoubleKind:
+		return &models.Schema{Type: "number", Format: "double"}
+	case protoreflect.StringKind:
+		return &models.Schema{Type: "string"}
+	case protoreflect.BytesKind:
+		return &models.Schema{Type: "string", Format: "byte"}
+	case protoreflect.EnumKind:
+		schema := &models.Schema{Type: "string", Title: string(field.Enum().FullName())}
+		values := field.Enum().Values()
+		for i := 0; i < values.Len(); i++ {
+			schema.Enum = append(schema.Enum, string(values.Get(i).Name()))
+		}
+		return schema
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return grpcMessageSchema(field.Message(), depth+1)
+	}
+	return &models.Schema{}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+// wireFields renders schema-less protobuf fields the way data-ingestion
+// publishes them: path, type and value triples
+func wireFields(values ...string) []models.ObservedField {
+	var fields []models.ObservedField
+	for i := 0; i+2 < len(values); i += 3 {
+		fields = append(fields, models.ObservedField{Path: values[i], Kind: "body", Type: values[i+1], Value: values[i+2]})
+	}
+	return fields
+}
+
+// schemaShape summarises a schema as its property names and types
+func schemaShape(schema *models.Schema) string {
+	if schema == nil {
+		return "<nil>"
+	}
+	if len(schema.Properties) == 0 {
+		if schema.Items != nil {
+			return "[" + schemaShape(schema.Items) + "]"
+		}
+		return schema.Type
+	}
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	shape := "{"
+	for i, name := range names {
+		if i > 0 {
+			shape += " "
+		}
+		shape += name + ":" + schemaShape(schema.Properties[name])
+	}
+	return shape + "}"
+}
+
+func TestObservedGRPCMethods(t *testing.T) {
+	repo := newMemoryDiscoveryRepository()
+	service := &DiscoveryService{repo: repo, logger: logging.NewStructuredLogger("test"), observer: newTrafficObserver(NewPathInferenceEngine())}
+	ctx := context.Background()
+
+	call := func(path string, request, response []models.ObservedField) {
+		record, _ := json.Marshal(models.ObservedTraffic{
+			ID: "1", Protocol: "HTTP/2.0", Method: "POST", StatusCode: 200,
+			Headers:         map[string]string{":authority": "orders.internal:8443", ":path": path, "content-type": "application/grpc"},
+			ResponseHeaders: map[string]string{"content-type": "application/grpc", "grpc-status": "0"},
+			BodyFormat:      "grpc", BodyFields: request, ResponseFormat: "grpc", ResponseFields: response,
+		})
+		if err := service.ObserveTraffic(ctx, record); err != nil {
+			t.Fatalf("ObserveTraffic: %v", err)
+		}
+	}
+	order := wireFields(
+		"$.1.wire_type", "string", "varint", "$.1.value", "number", "42",
+		"$.2.wire_type", "string", "bytes", "$.2.type", "string", "string", "$.2.value", "string", "Ada",
+		"$.3.wire_type", "string", "bytes", "$.3.type", "string", "message",
+		"$.3.value.1.wire_type", "string", "fixed64", "$.3.value.1.value", "number", "4621819117588971520",
+	)
+	call("/shop.v1.Orders/GetOrder", wireFields("$.1.wire_type", "string", "varint", "$.1.value", "number", "42"), order)
+	call("/shop.v1.Orders/GetOrder", wireFields(
+		"$.1.wire_type", "string", "varint", "$.1.value", "number", "7",
+		"$.4[0].wire_type", "string", "bytes", "$.4[0].type", "string", "string", "$.4[0].value", "string", "items",
+		"$.4[1].wire_type", "string", "bytes", "$.4[1].type", "string", "string", "$.4[1].value", "string", "total",
+	), order)
+	call("/shop.v1.Orders/WatchOrders", nil, wireFields(
+		"$[0].1.wire_type", "string", "varint", "$[0].1.value", "number", "1",
+		"$[1].1.wire_type", "string", "varint", "$[1].1.value", "number", "2",
+	))
+
+	service.flushObservations(ctx, "", nil)
+	apiID := apiIDForBaseURL("http://orders.internal:8443/shop.v1.Orders")
+	if api := repo.apis[apiID]; api.Protocol != endpointProtocolGRPC || api.Name != "shop.v1.Orders" || api.BaseURL != "http://orders.internal:8443" {
+		t.Errorf("api = %+v", api)
+	}
+	endpoints, _ := repo.GetAPIEndpoints(ctx, apiID)
+	if len(endpoints) != 2 || endpoints[0].Path != "/shop.v1.Orders/GetOrder" || endpoints[0].Protocol != endpointProtocolGRPC ||
+		endpoints[0].RequestCount != 2 || len(endpoints[0].Parameters) != 0 {
+		t.Fatalf("endpoints = %+v", endpoints)
+	}
+
+	methods, _ := service.GetGRPCMethods(ctx, apiID)
+	var got []string
+	for _, method := range methods {
+		if method.ID != endpointIDFor(endpoints, method.Path) || method.Source != grpcSourceObserved {
+			t.Errorf("method %s has ID %s and source %s", method.Path, method.ID, method.Source)
+		}
+		got = append(got, fmt.Sprintf("%s %s %d %s -> %s", method.Method, method.StreamingType, method.RequestCount,
+			schemaShape(method.RequestSchema), schemaShape(method.ResponseSchema)))
+	}
+	want := []string{
+		"GetOrder unary 2 {1:integer 4:[string]} -> {1:integer 2:string 3:{1:number}}",
+		"WatchOrders server_streaming 1 <nil> -> {1:integer}",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("methods =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func endpointIDFor(endpoints []models.Endpoint, path string) string {
+	for _, endpoint := range endpoints {
+		if endpoint.Path == path {
+			return endpoint.ID
+		}
+	}
+	return ""
+}
+
+func TestGRPCReflectionDiscovery(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	repo := newMemoryDiscoveryRepository()
+	service := NewDiscoveryService(repo, NewPathInferenceEngine(), logging.NewStructuredLogger("test")).(*DiscoveryService)
+	defer service.Close(context.Background())
+	discovery := &models.Discovery{ID: "grpc", Target: "grpc://" + listener.Addr().String(), Method: "active", Status: "running",
+		Config: &models.DiscoveryConfig{Credentials: &models.Credentials{Type: "bearer", Token: "secret"}}}
+	repo.CreateDiscovery(context.Background(), discovery)
+
+	if err := service.runActiveDiscovery(context.Background(), discovery); err != nil {
+		t.Fatalf("runActiveDiscovery: %v", err)
+	}
+	if discovery.EndpointsFound != 2 || len(repo.apis) != 1 {
+		t.Fatalf("found %d endpoints, APIs %+v", discovery.EndpointsFound, repo.apis)
+	}
+
+	apiID := apiIDForBaseURL("http://" + listener.Addr().String() + "/grpc.health.v1.Health")
+	methods, _ := service.GetGRPCMethods(context.Background(), apiID)
+	var got []string
+	for _, method := range methods {
+		got = append(got, fmt.Sprintf("%s %s %s(%s) %s", method.Path, method.StreamingType, method.RequestType,
+			schemaShape(method.RequestSchema), schemaShape(method.ResponseSchema)))
+	}
+	want := []string{
+		"/grpc.health.v1.Health/Check unary grpc.health.v1.HealthCheckRequest({service:string}) {status:string}",
+		"/grpc.health.v1.Health/Watch server_streaming grpc.health.v1.HealthCheckRequest({service:string}) {status:string}",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("methods =\n%v\nwant\n%v", got, want)
+	}
+	if status := methods[0].ResponseSchema.Properties["status"]; len(status.Enum) != 4 || status.Enum[1] != "SERVING" {
+		t.Errorf("status enum = %v", status.Enum)
+	}
+
+	endpoints, _ := repo.GetAPIEndpoints(context.Background(), apiID)
+	if len(endpoints) != 2 || endpoints[0].Method != "POST" || endpoints[0].Protocol != endpointProtocolGRPC || endpoints[0].DiscoveryID != "grpc" {
+		t.Errorf("endpoints = %+v", endpoints)
+	}
+}
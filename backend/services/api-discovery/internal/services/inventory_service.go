@@ -2,7 +2,9 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"scopeapi.local/backend/services/api-discovery/internal/models"
@@ -14,13 +16,28 @@ type InventoryServiceInterface interface {
 	GetAPIInventory(ctx context.Context, page, limit int, filters InventoryFilter) (*models.APIInventory, error)
 	GetAPIDetails(ctx context.Context, apiID string) (*models.APIDetails, error)
 	UpdateAPITags(ctx context.Context, apiID string, tags []string) error
+	UpdateAPIMetadata(ctx context.Context, apiID string, update models.APIMetadataUpdate) (*models.API, error)
 	DeleteAPI(ctx context.Context, apiID string) error
 	GetAPIStatistics(ctx context.Context) (*models.APIStatistics, error)
+	ImportAPISpec(ctx context.Context, apiID string, document []byte) (*models.ImportedSpec, error)
+	GetImportedSpec(ctx context.Context, apiID string) (*models.ImportedSpec, error)
+	GetSpecDrift(ctx context.Context, apiID string, refresh bool) (*models.DriftReport, error)
+	MonitorSpecDrift(ctx context.Context, interval time.Duration)
+	GetEndpointsByTrafficState(ctx context.Context, state string, page, limit int) (*models.EndpointInventory, error)
+	MonitorEndpointTraffic(ctx context.Context, interval, staleAfter, zombieAfter time.Duration)
 }
 
+// ErrInvalidSpec is returned for uploaded API descriptions that cannot be parsed
+var ErrInvalidSpec = errors.New("invalid API description")
+
 type InventoryService struct {
-	repo   repository.InventoryRepositoryInterface
-	logger logging.Logger
+	repo          repository.InventoryRepositoryInterface
+	discoveryRepo repository.DiscoveryRepositoryInterface
+	logger        logging.Logger
+
+	// Drift summaries from the last check, to log only changes
+	driftMutex sync.Mutex
+	lastDrift  map[string]models.DriftSummary
 }
 
 type InventoryFilter struct {
@@ -32,10 +49,12 @@ type InventoryFilter struct {
 	DateTo   string `json:"date_to" form:"date_to"`
 }
 
-func NewInventoryService(repo repository.InventoryRepositoryInterface, logger logging.Logger) InventoryServiceInterface {
+func NewInventoryService(repo repository.InventoryRepositoryInterface, discoveryRepo repository.DiscoveryRepositoryInterface, logger logging.Logger) InventoryServiceInterface {
 	return &InventoryService{
-		repo:   repo,
-		logger: logger,
+		repo:          repo,
+		discoveryRepo: discoveryRepo,
+		logger:        logger,
+		lastDrift:     make(map[string]models.DriftSummary),
 	}
 }
 
@@ -82,6 +101,31 @@ func (s *InventoryService) UpdateAPITags(ctx context.Context, apiID string, tags
 	return nil
 }
 
+// UpdateAPIMetadata sets the owner, contact, environment, lifecycle and data
+// sensitivity of an API
+func (s *InventoryService) UpdateAPIMetadata(ctx context.Context, apiID string, update models.APIMetadataUpdate) (*models.API, error) {
+	api, err := s.repo.GetAPI(ctx, apiID)
+	if err != nil {
+		s.logger.Error("Failed to get API for metadata update", "error", err, "api_id", apiID)
+		return nil, fmt.Errorf("failed to get API: %w", err)
+	}
+
+	if err := applyAPIMetadata(api, update); err != nil {
+		return nil, err
+	}
+	api.UpdatedAt = time.Now()
+
+	err = s.repo.UpdateAPI(ctx, api)
+	if err != nil {
+		s.logger.Error("Failed to update API metadata", "error", err, "api_id", apiID)
+		return nil, fmt.Errorf("failed to update API metadata: %w", err)
+	}
+
+	s.logger.Info("API metadata updated", "api_id", apiID, "owner", api.Owner, "environment", api.Environment,
+		"lifecycle", api.Lifecycle, "data_sensitivity", api.DataSensitivity)
+	return api, nil
+}
+
 func (s *InventoryService) DeleteAPI(ctx context.Context, apiID string) error {
 	err := s.repo.DeleteAPI(ctx, apiID)
 	if err != nil {
@@ -103,4 +147,190 @@ func (s *InventoryService) GetAPIStatistics(ctx context.Context) (*models.APISta
 	return stats, nil
 }
 
+// ImportAPISpec parses an OpenAPI 3.0/3.1 or Swagger 2.0 document, in JSON or
+// YAML, and attaches it to an API, replacing any spec imported before
+func (s *InventoryService) ImportAPISpec(ctx context.Context, apiID string, document []byte) (*models.ImportedSpec, error) {
+	if _, err := s.repo.GetAPI(ctx, apiID); err != nil {
+		s.logger.Error("Failed to get API for spec import", "error", err, "api_id", apiID)
+		return nil, fmt.Errorf("failed to get API: %w", err)
+	}
+
+	spec, format, warnings, err := parseSpecDocument(document)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSpec, err)
+	}
+	spec.APIID = apiID
+
+	imported := &models.ImportedSpec{
+		ID:            spec.ID,
+		APIID:         apiID,
+		Format:        format,
+		SourceVersion: spec.OpenAPIVersion,
+		Spec:          spec,
+		Warnings:      warnings,
+		ImportedAt:    time.Now(),
+	}
+	if err := s.repo.SaveImportedSpec(ctx, imported); err != nil {
+		s.logger.Error("Failed to save imported spec", "error", err, "api_id", apiID)
+		return nil, fmt.Errorf("failed to save imported spec: %w", err)
+	}
+
+	s.logger.Info("API spec imported", "api_id", apiID, "format", format, "version", imported.SourceVersion,
+		"paths", len(spec.Paths), "warnings", len(warnings))
+
+	// Compare the new spec with what was already observed
+	if _, err := s.GetSpecDrift(ctx, apiID, true); err != nil {
+		s.logger.Warn("Failed to check imported spec for drift", "error", err, "api_id", apiID)
+	}
+	return imported, nil
+}
+
+func (s *InventoryService) GetImportedSpec(ctx context.Context, apiID string) (*models.ImportedSpec, error) {
+	imported, err := s.repo.GetImportedSpec(ctx, apiID)
+	if err != nil {
+		s.logger.Error("Failed to get imported spec", "error", err, "api_id", apiID)
+		return nil, fmt.Errorf("failed to get imported spec: %w", err)
+	}
+
+	return imported, nil
+}
+
+// GetSpecDrift returns the last drift report of an API, or compares observed
+// traffic with the imported spec again when refresh is set or no report exists
+func (s *InventoryService) GetSpecDrift(ctx context.Context, apiID string, refresh bool) (*models.DriftReport, error) {
+	if !refresh {
+		report, err := s.repo.GetDriftReport(ctx, apiID)
+		if err == nil && report != nil {
+			return report, nil
+		}
+	}
+
+	imported, err := s.repo.GetImportedSpec(ctx, apiID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get imported spec: %w", err)
+	}
+	report, err := s.detectSpecDrift(ctx, imported)
+	if err != nil {
+		s.logger.Error("Failed to detect spec drift", "error", err, "api_id", apiID)
+		return nil, err
+	}
+	return report, nil
+}
+
+// MonitorSpecDrift compares observed traffic with every imported spec at each
+// interval until ctx is done
+func (s *InventoryService) MonitorSpecDrift(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			specs, err := s.repo.GetImportedSpecs(ctx)
+			if err != nil {
+				s.logger.Error("Failed to get imported specs", "error", err)
+				continue
+			}
+			for i := range specs {
+				if _, err := s.detectSpecDrift(ctx, &specs[i]); err != nil {
+					s.logger.Error("Failed to detect spec drift", "error", err, "api_id", specs[i].APIID)
+				}
+			}
+		}
+	}
+}
+
+func (s *InventoryService) detectSpecDrift(ctx context.Context, imported *models.ImportedSpec) (*models.DriftReport, error) {
+	endpoints, err := s.discoveryRepo.GetAPIEndpoints(ctx, imported.APIID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API endpoints: %w", err)
+	}
+	learned, err := s.discoveryRepo.GetLatestAPISchemas(ctx, imported.APIID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get learned schemas: %w", err)
+	}
+	schemas := make(map[string]models.EndpointSchema, len(learned))
+	for _, schema := range learned {
+		schemas[schema.EndpointID] = schema
+	}
+
+	report := detectDrift(imported, endpoints, schemas, defaultZombieAfter, time.Now())
+	if err := s.repo.SaveDriftReport(ctx, report); err != nil {
+		return nil, fmt.Errorf("failed to save drift report: %w", err)
+	}
+
+	s.driftMutex.Lock()
+	previous, checked := s.lastDrift[imported.APIID]
+	s.lastDrift[imported.APIID] = report.Summary
+	s.driftMutex.Unlock()
+	if !checked || previous != report.Summary {
+		s.logger.Info("API spec drift changed", "api_id", imported.APIID,
+			"shadow", report.Summary.ShadowEndpoints, "zombie", report.Summary.ZombieEndpoints,
+			"undocumented_parameters", report.Summary.UndocumentedParameters, "response_drift", report.Summary.ResponseDrift)
+	}
+	return report, nil
+}
+
+// GetEndpointsByTrafficState lists the endpoints the traffic monitor last
+// found active, stale or zombie
+func (s *InventoryService) GetEndpointsByTrafficState(ctx context.Context, state string, page, limit int) (*models.EndpointInventory, error) {
+	if state != trafficStateActive && state != trafficStateStale && state != trafficStateZombie {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTrafficState, state)
+	}
+
+	endpoints, err := s.repo.GetEndpointsByTrafficState(ctx, state, page, limit)
+	if err != nil {
+		s.logger.Error("Failed to get endpoints by traffic state", "error", err, "traffic_state", state)
+		return nil, fmt.Errorf("failed to get endpoints by traffic state: %w", err)
+	}
+
+	return endpoints, nil
+}
+
+// MonitorEndpointTraffic marks endpoints stale once they go staleAfter without
+// traffic, and zombie after zombieAfter, at each interval until ctx is done
+func (s *InventoryService) MonitorEndpointTraffic(ctx context.Context, interval, staleAfter, zombieAfter time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.checkEndpointTraffic(ctx, staleAfter, zombieAfter, time.Now()); err != nil {
+				s.logger.Error("Failed to check endpoint traffic", "error", err)
+			}
+		}
+	}
+}
+
+func (s *InventoryService) checkEndpointTraffic(ctx context.Context, staleAfter, zombieAfter time.Duration, now time.Time) error {
+	traffic, err := s.repo.GetEndpointTraffic(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get endpoint traffic: %w", err)
+	}
+
+	changed := make(map[string]int)
+	for _, endpoint := range traffic {
+		state := endpointTrafficState(endpoint, staleAfter, zombieAfter, now)
+		if state == endpoint.TrafficState {
+			continue
+		}
+		if err := s.repo.UpdateEndpointTrafficState(ctx, endpoint.EndpointID, state); err != nil {
+			s.logger.Error("Failed to update endpoint traffic state", "error", err, "endpoint_id", endpoint.EndpointID)
+			continue
+		}
+		changed[state]++
+	}
+
+	if len(changed) > 0 {
+		s.logger.Info("Endpoint traffic states changed", "active", changed[trafficStateActive],
+			"stale", changed[trafficStateStale], "zombie", changed[trafficStateZombie])
+	}
+	return nil
+}
+
 // Removed all MetadataService-related functions from this file. Only inventory-specific logic remains.
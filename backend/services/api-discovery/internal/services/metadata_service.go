@@ -2,14 +2,21 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"scopeapi.local/backend/services/api-discovery/internal/models"
 	"scopeapi.local/backend/services/api-discovery/internal/repository"
 	"scopeapi.local/backend/shared/logging"
+	"scopeapi.local/backend/shared/messaging/kafka"
 )
 
 type MetadataServiceInterface interface {
@@ -22,17 +29,36 @@ type MetadataServiceInterface interface {
 	CalculateQualityMetrics(ctx context.Context, endpointID string) (*models.QualityMetrics, error)
 	UpdateUsageMetrics(ctx context.Context, endpointID string, requestCount int64) error
 	EnrichMetadata(ctx context.Context, metadata *models.Metadata) error
+	GetEndpointSchemas(ctx context.Context, endpointID string) ([]models.EndpointSchema, error)
+	ExportAPISpec(ctx context.Context, apiID, format string) (*SpecExport, error)
+	GetSpecVersions(ctx context.Context, apiID string) ([]models.APISpecVersion, error)
+	GetSpecVersion(ctx context.Context, apiID string, version int) (*models.APISpecVersion, error)
+	DiffSpecVersions(ctx context.Context, apiID string, fromVersion, toVersion int) (*models.SpecDiff, error)
+	PublishPendingSpecChanges(ctx context.Context, interval time.Duration)
 }
 
+// ErrUnsupportedExportFormat is returned for an unknown spec export format
+var ErrUnsupportedExportFormat = errors.New("unsupported export format")
+
+// ErrSpecVersionNotFound is returned when an API has no such spec version
+var ErrSpecVersionNotFound = errors.New("spec version not found")
+
 type MetadataService struct {
-	repo   repository.DiscoveryRepositoryInterface
-	logger logging.Logger
+	repo          repository.DiscoveryRepositoryInterface
+	pathInference *PathInferenceEngine
+	kafkaProducer kafka.ProducerInterface
+	logger        logging.Logger
+
+	// Serializes publishing so pending spec changes are sent once and in order
+	publishMutex sync.Mutex
 }
 
-func NewMetadataService(repo repository.DiscoveryRepositoryInterface, logger logging.Logger) MetadataServiceInterface {
+func NewMetadataService(repo repository.DiscoveryRepositoryInterface, pathInference *PathInferenceEngine, kafkaProducer kafka.ProducerInterface, logger logging.Logger) MetadataServiceInterface {
 	return &MetadataService{
-		repo:   repo,
-		logger: logger,
+		repo:          repo,
+		pathInference: pathInference,
+		kafkaProducer: kafkaProducer,
+		logger:        logger,
 	}
 }
 
@@ -48,7 +74,15 @@ func (s *MetadataService) GetEndpointMetadata(ctx context.Context, endpointID st
 
 func (s *MetadataService) UpdateEndpointMetadata(ctx context.Context, endpointID string, metadata *models.Metadata) error {
 	metadata.UpdatedAt = time.Now()
-	
+
+	// A path template overrides what path inference learned for the endpoint
+	if metadata.PathTemplate != "" {
+		if err := s.overridePathTemplate(ctx, endpointID, metadata); err != nil {
+			s.logger.Error("Failed to override path template", "error", err, "endpoint_id", endpointID)
+			return fmt.Errorf("failed to override path template: %w", err)
+		}
+	}
+
 	err := s.repo.UpdateEndpointMetadata(ctx, endpointID, metadata)
 	if err != nil {
 		s.logger.Error("Failed to update endpoint metadata", "error", err, "endpoint_id", endpointID)
@@ -78,6 +112,15 @@ func (s *MetadataService) ExtractMetadata(ctx context.Context, endpoint *models.
 		UpdatedAt:     time.Now(),
 	}
 
+	// Schemas learned from observed bodies describe the endpoint better than
+	// a single snapshot
+	learned, err := s.repo.GetLatestEndpointSchema(ctx, endpoint.ID)
+	if err != nil {
+		s.logger.Warn("Failed to get learned endpoint schema", "error", err, "endpoint_id", endpoint.ID)
+	} else if learned != nil {
+		applyLearnedSchema(metadata, learned)
+	}
+
 	// Extract security metadata
 	securityMetadata, err := s.AnalyzeEndpointSecurity(ctx, endpoint)
 	if err != nil {
@@ -148,14 +191,47 @@ func (s *MetadataService) GenerateAPISpec(ctx context.Context, apiID string) (*m
 		UpdatedAt: time.Now(),
 	}
 
-	// Generate paths from endpoints
+	learned := make(map[string]models.EndpointSchema)
+	schemas, err := s.repo.GetLatestAPISchemas(ctx, apiID)
+	if err != nil {
+		s.logger.Warn("Failed to get learned schemas", "error", err, "api_id", apiID)
+	}
+	for _, schema := range schemas {
+		learned[schema.EndpointID] = schema
+	}
+	learnedComponents := make(map[string]*models.Schema)
+
+	// Template the stored paths, so endpoints found under concrete paths such
+	// as /orders/123 and /orders/124 share a single /orders/{orderId} entry
+	inference := s.pathInference.scratch()
 	for _, endpoint := range endpoints {
-		pathItem := s.convertEndpointToPathItem(&endpoint)
-		spec.Paths[endpoint.Path] = pathItem
+		inference.Learn(apiID, endpoint.Path)
+	}
+	for i := range endpoints {
+		endpoint := &endpoints[i]
+		template, pathParams := inference.Template(apiID, endpoint.Path)
+		endpoint.Path = template
+		endpoint.Parameters = mergePathParameters(endpoint.Parameters, pathParams)
+
+		pathItem := s.convertEndpointToPathItem(endpoint)
+		if existing, ok := spec.Paths[template]; ok {
+			mergePathItems(existing, pathItem)
+		} else {
+			spec.Paths[template] = pathItem
+		}
+
+		if schema, ok := learned[endpoint.ID]; ok {
+			s.referenceLearnedSchema(operationForMethod(spec.Paths[template], endpoint.Method), endpoint, &schema, learnedComponents)
+		}
 	}
 
+	spec.Servers = endpointServers(endpoints)
+
 	// Generate components
 	spec.Components = s.generateComponents(endpoints)
+	for name, schema := range learnedComponents {
+		spec.Components.Schemas[name] = schema
+	}
 
 	// Generate tags
 	spec.Tags = s.generateSpecTags(endpoints)
@@ -165,10 +241,103 @@ func (s *MetadataService) GenerateAPISpec(ctx context.Context, apiID string) (*m
 		return nil, fmt.Errorf("failed to save API specification: %w", err)
 	}
 
+	if err := s.recordSpecVersion(ctx, spec); err != nil {
+		s.logger.Error("Failed to record API spec version", "error", err, "api_id", apiID)
+	}
+
 	s.logger.Info("API specification generated", "api_id", apiID, "endpoints_count", len(endpoints))
 	return spec, nil
 }
 
+// GetSpecVersions lists the versions of an API's spec, newest first, without
+// their content
+func (s *MetadataService) GetSpecVersions(ctx context.Context, apiID string) ([]models.APISpecVersion, error) {
+	versions, err := s.repo.GetAPISpecVersions(ctx, apiID)
+	if err != nil {
+		s.logger.Error("Failed to get API spec versions", "error", err, "api_id", apiID)
+		return nil, fmt.Errorf("failed to get API spec versions: %w", err)
+	}
+
+	return versions, nil
+}
+
+func (s *MetadataService) GetSpecVersion(ctx context.Context, apiID string, version int) (*models.APISpecVersion, error) {
+	specVersion, err := s.repo.GetAPISpecVersion(ctx, apiID, version)
+	if err != nil {
+		s.logger.Error("Failed to get API spec version", "error", err, "api_id", apiID, "version", version)
+		return nil, fmt.Errorf("failed to get API spec version: %w", err)
+	}
+	if specVersion == nil {
+		return nil, fmt.Errorf("%w: %s version %d", ErrSpecVersionNotFound, apiID, version)
+	}
+
+	return specVersion, nil
+}
+
+// DiffSpecVersions lists the changes between two versions of an API's spec.
+// toVersion defaults to the latest version and fromVersion to the one before it.
+func (s *MetadataService) DiffSpecVersions(ctx context.Context, apiID string, fromVersion, toVersion int) (*models.SpecDiff, error) {
+	var to *models.APISpecVersion
+	var err error
+	if toVersion > 0 {
+		to, err = s.GetSpecVersion(ctx, apiID, toVersion)
+	} else if to, err = s.repo.GetLatestAPISpecVersion(ctx, apiID); err == nil && to == nil {
+		err = fmt.Errorf("%w: %s has no versions", ErrSpecVersionNotFound, apiID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fromVersion <= 0 {
+		fromVersion = to.Version - 1
+	}
+	from, err := s.GetSpecVersion(ctx, apiID, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := diffSpecs(from.Spec, to.Spec)
+	return &models.SpecDiff{
+		APIID:       apiID,
+		FromVersion: from.Version,
+		ToVersion:   to.Version,
+		Summary:     summarizeSpecChanges(changes),
+		Changes:     changes,
+	}, nil
+}
+
+func (s *MetadataService) GetEndpointSchemas(ctx context.Context, endpointID string) ([]models.EndpointSchema, error) {
+	schemas, err := s.repo.GetEndpointSchemas(ctx, endpointID)
+	if err != nil {
+		s.logger.Error("Failed to get endpoint schemas", "error", err, "endpoint_id", endpointID)
+		return nil, fmt.Errorf("failed to get endpoint schemas: %w", err)
+	}
+
+	return schemas, nil
+}
+
+// ExportAPISpec generates the API's spec from its endpoints and renders it as
+// OpenAPI 3.1 JSON or YAML, a Postman collection or a HAR of sample requests
+func (s *MetadataService) ExportAPISpec(ctx context.Context, apiID, format string) (*SpecExport, error) {
+	if _, ok := specExportFormats[format]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedExportFormat, format)
+	}
+
+	spec, err := s.GenerateAPISpec(ctx, apiID)
+	if err != nil {
+		s.logger.Error("Failed to generate API spec for export", "error", err, "api_id", apiID)
+		return nil, err
+	}
+
+	export, err := exportSpec(spec, format, time.Now())
+	if err != nil {
+		s.logger.Error("Failed to export API spec", "error", err, "api_id", apiID, "format", format)
+		return nil, fmt.Errorf("failed to export API spec: %w", err)
+	}
+
+	s.logger.Info("API specification exported", "api_id", apiID, "format", format, "bytes", len(export.Data))
+	return export, nil
+}
+
 func (s *MetadataService) AnalyzeEndpointSecurity(ctx context.Context, endpoint *models.Endpoint) (*models.SecurityMetadata, error) {
 	security := &models.SecurityMetadata{
 		HasHTTPS:              strings.HasPrefix(endpoint.URL, "https://"),
@@ -420,19 +589,37 @@ func (s *MetadataService) generateExamples(endpoint *models.Endpoint) []models.M
 }
 
 func (s *MetadataService) convertEndpointToPathItem(endpoint *models.Endpoint) *models.PathItem {
+	// Path parameters belong to the path; the rest to the operation
+	var pathParams, operationParams []models.Parameter
+	for _, param := range endpoint.Parameters {
+		if param.In == "path" {
+			pathParams = append(pathParams, param)
+		} else {
+			operationParams = append(operationParams, param)
+		}
+	}
+
 	pathItem := &models.PathItem{
 		Summary:     endpoint.Summary,
 		Description: endpoint.Description,
-		Parameters:  endpoint.Parameters,
+		Parameters:  pathParams,
 	}
 	
 	operation := &models.Operation{
 		Tags:        endpoint.Tags,
 		Summary:     endpoint.Summary,
 		Description: endpoint.Description,
-		Parameters:  endpoint.Parameters,
+		Parameters:  operationParams,
 		Responses:   s.convertResponses(endpoint.Responses),
 	}
+
+	// Status codes seen in traffic are documented even without a stored response
+	for _, code := range endpoint.StatusCodes {
+		key := strconv.Itoa(code)
+		if _, ok := operation.Responses[key]; !ok {
+			operation.Responses[key] = models.Response{StatusCode: code, Description: "Observed response"}
+		}
+	}
 	
 	switch strings.ToUpper(endpoint.Method) {
 	case "GET":
@@ -454,6 +641,229 @@ func (s *MetadataService) convertEndpointToPathItem(endpoint *models.Endpoint) *
 	return pathItem
 }
 
+// overridePathTemplate validates and stores a manual path template for the
+// endpoint's API and applies it to path inference
+func (s *MetadataService) overridePathTemplate(ctx context.Context, endpointID string, metadata *models.Metadata) error {
+	apiID, endpointURL := metadata.APIID, metadata.URL
+	if apiID == "" || endpointURL == "" {
+		existing, err := s.repo.GetEndpointMetadata(ctx, endpointID)
+		if err != nil {
+			return fmt.Errorf("failed to get endpoint metadata: %w", err)
+		}
+		if apiID == "" {
+			apiID = existing.APIID
+		}
+		if endpointURL == "" {
+			endpointURL = existing.URL
+		}
+	}
+
+	now := time.Now()
+	override := &models.PathTemplateOverride{
+		ID:         uuid.NewSHA1(uuid.NameSpaceURL, []byte(apiID+" "+metadata.PathTemplate)).String(),
+		APIID:      apiID,
+		Template:   metadata.PathTemplate,
+		Parameters: metadata.Parameters,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	parsed, err := parsePathOverride(override)
+	if err != nil {
+		return err
+	}
+	if endpointURL != "" {
+		if u, err := url.Parse(endpointURL); err == nil && !parsed.matches(splitPath(u.Path)) {
+			return fmt.Errorf("path template %q does not match %q", metadata.PathTemplate, u.Path)
+		}
+	}
+
+	if err := s.repo.SavePathTemplateOverride(ctx, override); err != nil {
+		return err
+	}
+	return s.pathInference.SetOverride(override)
+}
+
+// referenceLearnedSchema adds an endpoint's learned schemas to the components
+// and points the operation's request body and responses at them. The first
+// endpoint merged into an operation provides its schemas.
+func (s *MetadataService) referenceLearnedSchema(operation *models.Operation, endpoint *models.Endpoint, learned *models.EndpointSchema, components map[string]*models.Schema) {
+	if operation == nil {
+		return
+	}
+	baseName := strings.Title(strings.ToLower(endpoint.Method)) + s.pathToSchemaName(endpoint.Path)
+
+	if learned.RequestSchema != nil && operation.RequestBody == nil {
+		name := baseName + "Request"
+		components[name] = learned.RequestSchema
+		operation.RequestBody = &models.RequestBody{
+			Content: map[string]models.MediaType{
+				"application/json": {Schema: &models.Schema{Ref: "#/components/schemas/" + name}},
+			},
+			Required: !learned.RequestSchema.Nullable,
+		}
+	}
+
+	primary := primaryStatusCode(learned.ResponseSchemas)
+	if operation.Responses == nil {
+		operation.Responses = make(map[string]models.Response)
+	}
+	for code, schema := range learned.ResponseSchemas {
+		// The main success response is <Method><Path>Response; the others
+		// carry their status code
+		name := baseName + "Response"
+		if code != primary {
+			name += strings.Title(code)
+		}
+		components[name] = schema
+
+		response := operation.Responses[code]
+		if response.Description == "" {
+			response.Description = "Observed response"
+		}
+		if status, err := strconv.Atoi(code); err == nil {
+			response.StatusCode = status
+		}
+		response.Schema = map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		operation.Responses[code] = response
+	}
+}
+
+// primaryStatusCode picks the lowest 2xx status code, or the lowest code
+func primaryStatusCode(responses map[string]*models.Schema) string {
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		codes = append(codes, code)
+	}
+	return primaryCode(codes)
+}
+
+func primaryCode(codes []string) string {
+	sort.Strings(codes)
+	for _, code := range codes {
+		if strings.HasPrefix(code, "2") {
+			return code
+		}
+	}
+	if len(codes) > 0 {
+		return codes[0]
+	}
+	return ""
+}
+
+// operationForMethod returns the operation of a path item for an HTTP method
+func operationForMethod(item *models.PathItem, method string) *models.Operation {
+	switch strings.ToUpper(method) {
+	case "GET":
+		return item.Get
+	case "POST":
+		return item.Post
+	case "PUT":
+		return item.Put
+	case "DELETE":
+		return item.Delete
+	case "PATCH":
+		return item.Patch
+	case "OPTIONS":
+		return item.Options
+	case "HEAD":
+		return item.Head
+	}
+	return nil
+}
+
+// applyLearnedSchema sets the metadata schemas from a learned schema version
+func applyLearnedSchema(metadata *models.Metadata, learned *models.EndpointSchema) {
+	if learned.RequestSchema != nil {
+		metadata.RequestSchema = schemaToMap(learned.RequestSchema)
+	}
+	if len(learned.ResponseSchemas) > 0 {
+		responses := make(map[string]interface{}, len(learned.ResponseSchemas))
+		for code, schema := range learned.ResponseSchemas {
+			responses[code] = schemaToMap(schema)
+		}
+		metadata.ResponseSchema = responses
+	}
+}
+
+func schemaToMap(schema *models.Schema) map[string]interface{} {
+	encoded, err := json.Marshal(schema)
+	if err != nil {
+		return nil
+	}
+	var decoded map[string]interface{}
+	json.Unmarshal(encoded, &decoded)
+	return decoded
+}
+
+// mergePathParameters declares every parameter of a templated path once,
+// preferring what was stored for the endpoint over a fresh inference
+func mergePathParameters(params, inferred []models.Parameter) []models.Parameter {
+	names := make(map[string]bool, len(inferred))
+	for _, param := range inferred {
+		names[param.Name] = true
+	}
+
+	merged := make([]models.Parameter, 0, len(params)+len(inferred))
+	declared := make(map[string]bool)
+	for _, param := range params {
+		if param.In == "path" {
+			if !names[param.Name] || declared[param.Name] {
+				continue
+			}
+			declared[param.Name] = true
+		}
+		merged = append(merged, param)
+	}
+	for _, param := range inferred {
+		if !declared[param.Name] {
+			merged = append(merged, param)
+		}
+	}
+	return merged
+}
+
+// endpointServers lists the origins the endpoints were discovered on
+func endpointServers(endpoints []models.Endpoint) []models.SpecServer {
+	seen := make(map[string]bool)
+	var servers []models.SpecServer
+	for _, endpoint := range endpoints {
+		parsed, err := url.Parse(endpoint.URL)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			continue
+		}
+		origin := parsed.Scheme + "://" + parsed.Host
+		if !seen[origin] {
+			seen[origin] = true
+			servers = append(servers, models.SpecServer{URL: origin})
+		}
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].URL < servers[j].URL })
+	return servers
+}
+
+// mergePathItems adds the operations of src that dst does not have yet
+func mergePathItems(dst, src *models.PathItem) {
+	operations := []struct{ dst, src **models.Operation }{
+		{&dst.Get, &src.Get}, {&dst.Put, &src.Put}, {&dst.Post, &src.Post}, {&dst.Delete, &src.Delete},
+		{&dst.Options, &src.Options}, {&dst.Head, &src.Head}, {&dst.Patch, &src.Patch}, {&dst.Trace, &src.Trace},
+	}
+	for _, operation := range operations {
+		if *operation.dst == nil {
+			*operation.dst = *operation.src
+		}
+	}
+
+	declared := make(map[string]bool, len(dst.Parameters))
+	for _, param := range dst.Parameters {
+		declared[param.Name] = true
+	}
+	for _, param := range src.Parameters {
+		if !declared[param.Name] {
+			dst.Parameters = append(dst.Parameters, param)
+		}
+	}
+}
+
 func (s *MetadataService) convertResponses(responses map[string]models.Response) map[string]models.Response {
 	converted := make(map[string]models.Response)
 	
@@ -516,6 +926,8 @@ func (s *MetadataService) generateSpecTags(endpoints []models.Endpoint) []models
 	for _, tag := range tagMap {
 		tags = append(tags, tag)
 	}
+	// Sorted, so regenerating an unchanged API gives the same spec
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
 	
 	return tags
 }
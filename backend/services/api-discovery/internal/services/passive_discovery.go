@@ -0,0 +1,936 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+)
+
+const (
+	// maxTrafficObservations bounds the endpoints held in memory, so a client
+	// generating unique paths cannot exhaust memory. Observations are evicted
+	// once flushed and idle, so this limits the endpoints seen in recent flush
+	// intervals rather than over the lifetime of the service.
+	maxTrafficObservations = 50000
+	// maxObservedParameters bounds the parameters tracked per endpoint
+	maxObservedParameters = 200
+	// observationFlushInterval is how often observed endpoints are written to the inventory
+	observationFlushInterval = 30 * time.Second
+	// defaultPassiveWindow is how long a passive discovery run listens before reporting
+	defaultPassiveWindow = time.Minute
+)
+
+var arrayIndex = regexp.MustCompile(`\[\d+\]`)
+
+// trafficObserver clusters observed requests into templated endpoints and keeps
+// what was seen for each one until it is flushed to the inventory
+type trafficObserver struct {
+	mutex     sync.Mutex
+	inference *PathInferenceEngine
+	endpoints map[string]*endpointObservation
+	graphql   map[string]*graphqlObservation
+	grpc      map[string]*grpcObservation
+	dropped   int64
+
+	// Matchers of the running passive discoveries, whose endpoints are kept
+	// until the run reports them
+	watchers    map[int]func(*endpointObservation) bool
+	nextWatcher int
+
+	// Stored endpoints to fold into the endpoint their requests now template
+	// to, in the order they were retired
+	retired []endpointMerge
+}
+
+// endpointMerge moves a stored endpoint's counts into another one
+type endpointMerge struct {
+	from string
+	into string
+}
+
+// graphqlObservation is what requests to a GraphQL endpoint showed of its
+// schema since the last flush
+type graphqlObservation struct {
+	host   string
+	schema *models.GraphQLSchema
+}
+
+// grpcObservation is what calls to a gRPC method showed of it since the last
+// flush
+type grpcObservation struct {
+	host   string
+	method *models.GRPCMethod
+}
+
+type endpointObservation struct {
+	id           string
+	apiID        string
+	baseURL      string
+	host         string
+	method       string
+	path         string
+	protocol     string // rest, graphql or grpc
+	service      string // the gRPC service a grpc endpoint belongs to
+	samplePath   string
+	firstSeen    time.Time
+	lastSeen     time.Time
+	total        int64
+	pending      int64 // requests observed since the last flush
+	statusCodes  map[int]bool
+	contentTypes map[string]bool
+	responseType string
+	lastStatus   int
+	parameters   map[string]*models.Parameter
+	dirty        bool
+	idle         bool // flushed without traffic since, evicted at the next flush
+	stored       bool // flushed to the inventory under its current ID
+
+	// Learned body schemas. The stored versions are loaded before the first
+	// flush, so learning continues from the latest version.
+	schema            *endpointSchemaLearner
+	schemaDirty       bool
+	schemaLoaded      bool
+	schemaVersion     int
+	schemaFingerprint string
+}
+
+func newTrafficObserver(inference *PathInferenceEngine) *trafficObserver {
+	return &trafficObserver{
+		inference: inference,
+		endpoints: make(map[string]*endpointObservation),
+		graphql:   make(map[string]*graphqlObservation),
+		grpc:      make(map[string]*grpcObservation),
+		watchers:  make(map[int]func(*endpointObservation) bool),
+	}
+}
+
+// watch keeps the observations matching match in memory until the returned
+// function is called
+func (o *trafficObserver) watch(match func(*endpointObservation) bool) func() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	id := o.nextWatcher
+	o.nextWatcher++
+	o.watchers[id] = match
+	return func() {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		delete(o.watchers, id)
+	}
+}
+
+// evictFlushed forgets the observations with nothing left to flush that saw
+// no traffic since the previous flush. Their stored endpoint carries the counts,
+// and a learned schema continues from its latest version when the endpoint is
+// seen again.
+func (o *trafficObserver) evictFlushed() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	for key, observation := range o.endpoints {
+		if observation.dirty || observation.pending > 0 || observation.schemaDirty {
+			continue
+		}
+		if !observation.idle {
+			observation.idle = true
+			continue
+		}
+		watched := false
+		for _, match := range o.watchers {
+			if match(observation) {
+				watched = true
+				break
+			}
+		}
+		if !watched {
+			delete(o.endpoints, key)
+		}
+	}
+}
+
+// observe records one request/response pair against its templated endpoint
+func (o *trafficObserver) observe(traffic *models.ObservedTraffic) error {
+	method := strings.ToUpper(strings.TrimSpace(traffic.Method))
+	if method == "" {
+		return fmt.Errorf("traffic record %s has no method", traffic.ID)
+	}
+	scheme, host, path, err := trafficLocation(traffic)
+	if err != nil {
+		return err
+	}
+
+	seen := traffic.Timestamp
+	if seen.IsZero() {
+		seen = time.Now()
+	}
+
+	requestType := traffic.ContentType
+	if requestType == "" {
+		requestType = headerValue(traffic.Headers, "Content-Type")
+	}
+	responseType := headerValue(traffic.ResponseHeaders, "Content-Type")
+
+	baseURL := scheme + "://" + host
+	apiID := apiIDForBaseURL(baseURL)
+	protocol := endpointProtocolREST
+	service, grpcMethod, isGRPC := "", "", false
+	if isGRPCTraffic(traffic, requestType, responseType) {
+		service, grpcMethod, isGRPC = splitGRPCPath(path)
+	}
+	template, pathParams := path, []models.Parameter(nil)
+	if isGRPC {
+		// A gRPC path names a method rather than a resource, so it is not
+		// templated, and each service is an API of its own
+		protocol = endpointProtocolGRPC
+		apiID = apiIDForBaseURL(grpcServiceURL(baseURL, service))
+	} else {
+		o.inference.Learn(apiID, path)
+		template, pathParams = o.inference.Template(apiID, path)
+	}
+	key := method + " " + baseURL + template
+
+	requestBody := decodeJSONBody(traffic.BodyText, traffic.BodyFormat, requestType, traffic.BodyTruncated)
+	responseBody := decodeJSONBody(traffic.ResponseText, traffic.ResponseFormat, responseType, traffic.ResponseTruncated)
+
+	graphqlBody := requestBody
+	if contentMediaType(requestType) == "application/graphql" {
+		graphqlBody = map[string]interface{}{"query": traffic.BodyText}
+	}
+	graphql := observedGraphQLSchema(graphqlRequest(graphqlBody, traffic.QueryParams), responseBody, traffic.StatusCode, seen)
+	if graphql != nil {
+		protocol = endpointProtocolGraphQL
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	observation, exists := o.endpoints[key]
+	if !exists {
+		if len(o.endpoints) >= maxTrafficObservations {
+			o.dropped++
+			return fmt.Errorf("observation limit of %d endpoints reached", maxTrafficObservations)
+		}
+		observation = &endpointObservation{
+			id:           uuid.NewSHA1(uuid.NameSpaceURL, []byte(key)).String(),
+			apiID:        apiID,
+			baseURL:      baseURL,
+			host:         host,
+			method:       method,
+			path:         template,
+			protocol:     protocol,
+			service:      service,
+			firstSeen:    seen,
+			lastSeen:     seen,
+			statusCodes:  make(map[int]bool),
+			contentTypes: make(map[string]bool),
+			parameters:   make(map[string]*models.Parameter),
+		}
+		o.endpoints[key] = observation
+	}
+
+	observation.total++
+	observation.pending++
+	observation.dirty = true
+	observation.idle = false
+	observation.samplePath = path
+	if protocol != endpointProtocolREST {
+		observation.protocol = protocol
+	}
+	if seen.Before(observation.firstSeen) {
+		observation.firstSeen = seen
+	}
+	if seen.After(observation.lastSeen) {
+		observation.lastSeen = seen
+	}
+	if traffic.StatusCode > 0 {
+		observation.statusCodes[traffic.StatusCode] = true
+		observation.lastStatus = traffic.StatusCode
+	}
+
+	if media := contentMediaType(requestType); media != "" {
+		observation.contentTypes[media] = true
+	}
+	if media := contentMediaType(responseType); media != "" {
+		observation.contentTypes[media] = true
+		observation.responseType = media
+	}
+
+	observation.setPathParameters(pathParams)
+	for name, value := range traffic.QueryParams {
+		observation.addParameter("query", name, inferValueType(value), value, false)
+	}
+	// gRPC bodies are described by the method's message schemas instead
+	for _, field := range traffic.BodyFields {
+		// Array elements share one parameter, e.g. items[].sku
+		name := arrayIndex.ReplaceAllString(strings.TrimPrefix(strings.TrimPrefix(field.Path, "$"), "."), "[]")
+		if name == "" || isGRPC {
+			continue
+		}
+		observation.addParameter("body", name, field.Type, nil, false)
+	}
+
+	if requestBody != noBody || responseBody != noBody {
+		if observation.schema == nil {
+			observation.schema = newEndpointSchemaLearner()
+		}
+		observation.schema.observe(requestBody, traffic.StatusCode, responseBody)
+		observation.schemaDirty = true
+	}
+
+	if graphql != nil {
+		graphql.ID = graphqlSchemaID(baseURL, template)
+		graphql.APIID = apiID
+		graphql.URL = baseURL + template
+		graphql.Path = template
+		o.addGraphQL(host, graphql)
+	}
+
+	if isGRPC {
+		requestSchema, requestMessages := observedGRPCMessage(traffic.BodyFields)
+		responseSchema, responseMessages := observedGRPCMessage(traffic.ResponseFields)
+		o.addGRPC(host, &models.GRPCMethod{
+			ID:             observation.id,
+			APIID:          apiID,
+			URL:            baseURL + path,
+			Service:        service,
+			Method:         grpcMethod,
+			Path:           path,
+			StreamingType:  grpcStreamingType(requestMessages > 1, responseMessages > 1),
+			RequestSchema:  requestSchema,
+			ResponseSchema: responseSchema,
+			Source:         grpcSourceObserved,
+			RequestCount:   1,
+			FirstSeen:      &seen,
+			LastSeen:       &seen,
+		})
+	}
+
+	return nil
+}
+
+// addGraphQL folds what a request showed of a GraphQL schema into the
+// observations not flushed yet
+func (o *trafficObserver) addGraphQL(host string, schema *models.GraphQLSchema) {
+	if existing, ok := o.graphql[schema.ID]; ok {
+		mergeGraphQLSchema(existing.schema, schema)
+		return
+	}
+	o.graphql[schema.ID] = &graphqlObservation{host: host, schema: schema}
+}
+
+// setPathParameters replaces the path parameters with the latest inference
+func (e *endpointObservation) setPathParameters(params []models.Parameter) {
+	for key, param := range e.parameters {
+		if param.In == "path" {
+			delete(e.parameters, key)
+		}
+	}
+	for i := range params {
+		param := params[i]
+		e.parameters["path:"+param.Name] = &param
+	}
+}
+
+// merge folds another observation of the same endpoint into this one. Only
+// the requests not flushed yet are carried over; the flushed ones are moved by
+// merging the stored endpoints.
+func (e *endpointObservation) merge(other *endpointObservation) {
+	e.total += other.total
+	e.pending += other.pending
+	e.dirty = true
+	e.idle = false
+	if other.firstSeen.Before(e.firstSeen) {
+		e.firstSeen = other.firstSeen
+	}
+	if other.lastSeen.After(e.lastSeen) {
+		e.lastSeen = other.lastSeen
+		e.samplePath = other.samplePath
+		if other.lastStatus != 0 {
+			e.lastStatus = other.lastStatus
+		}
+		if other.responseType != "" {
+			e.responseType = other.responseType
+		}
+	}
+	for code := range other.statusCodes {
+		e.statusCodes[code] = true
+	}
+	for contentType := range other.contentTypes {
+		e.contentTypes[contentType] = true
+	}
+	for key, param := range other.parameters {
+		if _, ok := e.parameters[key]; !ok && param.In != "path" && len(e.parameters) < maxObservedParameters {
+			e.parameters[key] = param
+		}
+	}
+	if other.schema != nil {
+		if e.schema == nil {
+			e.schema = newEndpointSchemaLearner()
+		}
+		e.schema.merge(other.schema)
+		e.schemaDirty = true
+	}
+}
+
+func (e *endpointObservation) addParameter(in, name, paramType string, example interface{}, required bool) {
+	key := in + ":" + name
+	if existing, ok := e.parameters[key]; ok {
+		// A parameter seen with different types is reported as a string
+		if existing.Type != paramType && paramType != "" && paramType != "null" {
+			if existing.Type == "null" {
+				existing.Type = paramType
+			} else if !(existing.Type == "number" && paramType == "integer") {
+				existing.Type = "string"
+			}
+		}
+		return
+	}
+	if len(e.parameters) >= maxObservedParameters {
+		return
+	}
+	e.parameters[key] = &models.Parameter{
+		Name:        name,
+		In:          in,
+		Type:        paramType,
+		Required:    required,
+		Description: "Observed in traffic",
+		Example:     example,
+	}
+}
+
+// endpoint renders the observation as an inventory endpoint. RequestCount holds
+// only the requests not yet flushed, as SaveEndpoint adds it to the stored count.
+func (e *endpointObservation) endpoint(discoveryID string) models.Endpoint {
+	firstSeen, lastSeen := e.firstSeen, e.lastSeen
+	now := time.Now()
+
+	statusCodes := make([]int, 0, len(e.statusCodes))
+	for code := range e.statusCodes {
+		statusCodes = append(statusCodes, code)
+	}
+	sort.Ints(statusCodes)
+
+	contentTypes := make([]string, 0, len(e.contentTypes))
+	for contentType := range e.contentTypes {
+		contentTypes = append(contentTypes, contentType)
+	}
+	sort.Strings(contentTypes)
+
+	keys := make([]string, 0, len(e.parameters))
+	for key := range e.parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parameters := make([]models.Parameter, 0, len(keys))
+	for _, key := range keys {
+		parameters = append(parameters, *e.parameters[key])
+	}
+
+	return models.Endpoint{
+		ID:            e.id,
+		APIID:         e.apiID,
+		URL:           e.baseURL + e.samplePath,
+		Path:          e.path,
+		Method:        e.method,
+		Protocol:      e.protocol,
+		StatusCode:    e.lastStatus,
+		ContentType:   e.responseType,
+		Parameters:    parameters,
+		IsActive:      true,
+		DiscoveryID:   discoveryID,
+		Source:        "passive",
+		StatusCodes:   statusCodes,
+		ContentTypes:  contentTypes,
+		RequestCount:  e.pending,
+		FirstSeen:     &firstSeen,
+		LastSeen:      &lastSeen,
+		LastTrafficAt: &lastSeen,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+// take returns the endpoints to persist and clears their pending counts. Dirty
+// endpoints are always returned; with includeClean, matching clean ones are too.
+// Learned schemas whose structure changed are returned as new versions.
+func (o *trafficObserver) take(match func(*endpointObservation) bool, includeClean bool, discoveryID string) ([]models.Endpoint, []models.API, []schemaUpdate) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.retemplate()
+
+	var endpoints []models.Endpoint
+	var schemas []schemaUpdate
+	apis := make(map[string]models.API)
+	for _, observation := range o.endpoints {
+		if match != nil && !match(observation) {
+			continue
+		}
+		if !observation.dirty && !includeClean {
+			continue
+		}
+		endpoints = append(endpoints, observation.endpoint(discoveryID))
+		observation.pending = 0
+		observation.dirty = false
+		observation.stored = true
+		if update := observation.takeSchema(); update != nil {
+			schemas = append(schemas, *update)
+		}
+
+		if _, ok := apis[observation.apiID]; !ok && observation.protocol == endpointProtocolGRPC {
+			apis[observation.apiID] = grpcServiceAPI(observation.baseURL, observation.service, "Discovered from observed traffic", "passive")
+		} else if !ok {
+			now := time.Now()
+			apis[observation.apiID] = models.API{
+				ID:          observation.apiID,
+				Name:        observation.host,
+				URL:         observation.baseURL,
+				BaseURL:     observation.baseURL,
+				Protocol:    observation.protocol,
+				Status:      "active",
+				Description: "Discovered from observed traffic",
+				Tags:        []string{"passive"},
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}
+		}
+		if api := apis[observation.apiID]; api.LastTrafficAt == nil || observation.lastSeen.After(*api.LastTrafficAt) {
+			lastSeen := observation.lastSeen
+			api.LastTrafficAt = &lastSeen
+			apis[observation.apiID] = api
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Path != endpoints[j].Path {
+			return endpoints[i].Path < endpoints[j].Path
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+
+	apiList := make([]models.API, 0, len(apis))
+	for _, api := range apis {
+		apiList = append(apiList, api)
+	}
+	return endpoints, apiList, schemas
+}
+
+// takeSchema renders a changed learned schema as the next version. Schemas not
+// loaded yet are held back, so a restart does not start a new history.
+func (e *endpointObservation) takeSchema() *schemaUpdate {
+	if e.schema == nil || !e.schemaDirty || !e.schemaLoaded {
+		return nil
+	}
+	e.schemaDirty = false
+
+	version, err := e.schema.version(e.id, e.apiID)
+	if err != nil || version.Fingerprint == e.schemaFingerprint {
+		return nil
+	}
+	update := &schemaUpdate{schema: version, previousFingerprint: e.schemaFingerprint}
+	e.schemaVersion++
+	e.schemaFingerprint = version.Fingerprint
+	version.ID = uuid.New().String()
+	version.Version = e.schemaVersion
+	return update
+}
+
+// retemplate moves observations whose template changed as inference learned
+// more, e.g. once enough slugs were seen, merging those that now coincide. The
+// stored endpoints of the old templates are retired, so the requests flushed
+// under them are moved to the new endpoint rather than counted twice.
+func (o *trafficObserver) retemplate() {
+	for key, observation := range o.endpoints {
+		if observation.protocol == endpointProtocolGRPC {
+			continue
+		}
+		template, params := o.inference.Template(observation.apiID, observation.samplePath)
+		if template == observation.path {
+			continue
+		}
+		delete(o.endpoints, key)
+
+		newKey := observation.method + " " + observation.baseURL + template
+		if target, ok := o.endpoints[newKey]; ok {
+			target.merge(observation)
+			o.retire(observation, target.id)
+			continue
+		}
+		newID := uuid.NewSHA1(uuid.NameSpaceURL, []byte(newKey)).String()
+		o.retire(observation, newID)
+		observation.id = newID
+		observation.path = template
+		observation.stored = false
+		observation.dirty = true
+		observation.setPathParameters(params)
+		// The new endpoint has a schema history of its own
+		observation.schemaLoaded = false
+		observation.schemaVersion = 0
+		observation.schemaFingerprint = ""
+		o.endpoints[newKey] = observation
+	}
+}
+
+// retire queues the stored endpoint of an observation to be merged into the
+// endpoint with ID into, redirecting merges still queued for it
+func (o *trafficObserver) retire(observation *endpointObservation, into string) {
+	for i := range o.retired {
+		if o.retired[i].into == observation.id {
+			o.retired[i].into = into
+		}
+	}
+	if observation.stored {
+		o.retired = append(o.retired, endpointMerge{from: observation.id, into: into})
+	}
+}
+
+// takeRetired returns and forgets the queued endpoint merges
+func (o *trafficObserver) takeRetired() []endpointMerge {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	retired := o.retired
+	o.retired = nil
+	return retired
+}
+
+// restoreRetired queues a merge that failed again for the next flush
+func (o *trafficObserver) restoreRetired(merge endpointMerge) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.retired = append(o.retired, merge)
+}
+
+// takeGraphQL returns and forgets the GraphQL observations matching match
+func (o *trafficObserver) takeGraphQL(match func(*endpointObservation) bool) []graphqlObservation {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	var observations []graphqlObservation
+	for id, observation := range o.graphql {
+		if match != nil && !match(&endpointObservation{host: observation.host, path: observation.schema.Path}) {
+			continue
+		}
+		observations = append(observations, *observation)
+		delete(o.graphql, id)
+	}
+	return observations
+}
+
+// restoreGraphQL keeps a GraphQL observation whose flush failed for the next one
+func (o *trafficObserver) restoreGraphQL(observation graphqlObservation) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.addGraphQL(observation.host, observation.schema)
+}
+
+// restore re-marks endpoints whose flush failed so their counts are retried
+func (o *trafficObserver) restore(endpoint models.Endpoint) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	for _, observation := range o.endpoints {
+		if observation.id == endpoint.ID {
+			observation.pending += endpoint.RequestCount
+			observation.dirty = true
+			return
+		}
+	}
+}
+
+// unloadedSchemas returns the endpoints with learned schemas whose stored
+// versions have not been loaded yet
+func (o *trafficObserver) unloadedSchemas(match func(*endpointObservation) bool) []string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	var endpointIDs []string
+	for _, observation := range o.endpoints {
+		if observation.schema == nil || observation.schemaLoaded || (match != nil && !match(observation)) {
+			continue
+		}
+		endpointIDs = append(endpointIDs, observation.id)
+	}
+	return endpointIDs
+}
+
+// seedSchema continues learning an endpoint's schema from its latest stored
+// version, which is nil when none was stored
+func (o *trafficObserver) seedSchema(endpointID string, stored *models.EndpointSchema) error {
+	var learner *endpointSchemaLearner
+	var err error
+	if stored != nil {
+		learner, err = restoreSchemaLearner(stored)
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	for _, observation := range o.endpoints {
+		if observation.id != endpointID {
+			continue
+		}
+		observation.schemaLoaded = true
+		if stored == nil {
+			return nil
+		}
+		observation.schemaVersion = stored.Version
+		observation.schemaFingerprint = stored.Fingerprint
+		if err != nil {
+			return fmt.Errorf("invalid learner state in schema version %d: %w", stored.Version, err)
+		}
+		learner.merge(observation.schema)
+		observation.schema = learner
+		return nil
+	}
+	return nil
+}
+
+// restoreSchema rolls back a schema version that could not be saved
+func (o *trafficObserver) restoreSchema(update schemaUpdate) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	for _, observation := range o.endpoints {
+		if observation.id == update.schema.EndpointID && observation.schemaVersion == update.schema.Version {
+			observation.schemaVersion--
+			observation.schemaFingerprint = update.previousFingerprint
+			observation.schemaDirty = true
+			return
+		}
+	}
+}
+
+// Helper functions
+
+// trafficLocation returns the scheme, host and path of a traffic record, using
+// the Host header when the record carries no absolute URL and the HTTP/2
+// pseudo-headers when it carries neither
+func trafficLocation(traffic *models.ObservedTraffic) (string, string, string, error) {
+	scheme, host, path := "", "", traffic.Path
+	if traffic.URL != "" {
+		parsed, err := url.Parse(traffic.URL)
+		if err != nil {
+			return "", "", "", fmt.Errorf("invalid traffic URL %q: %w", traffic.URL, err)
+		}
+		scheme, host = parsed.Scheme, parsed.Host
+		if path == "" {
+			path = parsed.Path
+		}
+	}
+	if host == "" {
+		host = headerValue(traffic.Headers, "Host")
+	}
+	if host == "" {
+		host = headerValue(traffic.Headers, ":authority")
+	}
+	if path == "" {
+		path = headerValue(traffic.Headers, ":path")
+	}
+	if host == "" {
+		return "", "", "", fmt.Errorf("traffic record %s has no host", traffic.ID)
+	}
+	if scheme == "" {
+		scheme = "http"
+		if strings.EqualFold(headerValue(traffic.Headers, "X-Forwarded-Proto"), "https") || strings.HasSuffix(host, ":443") {
+			scheme = "https"
+		}
+	}
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	if path == "" {
+		path = "/"
+	}
+	return strings.ToLower(scheme), normalizeHost(host, scheme), path, nil
+}
+
+// normalizeHost lower-cases the host and drops the scheme's default port
+func normalizeHost(host, scheme string) string {
+	host = strings.ToLower(host)
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if (port == "80" && scheme == "http") || (port == "443" && scheme == "https") {
+			return h
+		}
+	}
+	return host
+}
+
+func inferValueType(value string) string {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return "integer"
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return "number"
+	}
+	if value == "true" || value == "false" {
+		return "boolean"
+	}
+	return "string"
+}
+
+func contentMediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return media
+}
+
+func headerValue(headers map[string]string, name string) string {
+	if value, ok := headers[name]; ok {
+		return value
+	}
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// apiIDForBaseURL derives a stable API ID so every instance of the service files
+// traffic for the same origin under the same API
+func apiIDForBaseURL(baseURL string) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(baseURL)).String()
+}
+
+// targetMatcher matches observations against a discovery target, given as a URL
+// or a bare host, optionally with a path prefix
+func targetMatcher(target string) (func(*endpointObservation) bool, error) {
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	parsed, err := url.Parse(target)
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid discovery target %q", target)
+	}
+	host := strings.ToLower(parsed.Hostname())
+	port := parsed.Port()
+	prefix := strings.TrimSuffix(parsed.Path, "/")
+
+	return func(observation *endpointObservation) bool {
+		observedHost, observedPort := observation.host, ""
+		if h, p, err := net.SplitHostPort(observation.host); err == nil {
+			observedHost, observedPort = h, p
+		}
+		if observedHost != host || (port != "" && observedPort != "" && observedPort != port) {
+			return false
+		}
+		return prefix == "" || observation.path == prefix || strings.HasPrefix(observation.path, prefix+"/")
+	}, nil
+}
+
+// flushObservations writes pending observations to the inventory. When match is
+// set only matching endpoints are written, all of them, tagged with discoveryID.
+func (s *DiscoveryService) flushObservations(ctx context.Context, discoveryID string, match func(*endpointObservation) bool) int {
+	s.loadEndpointSchemas(ctx, match)
+	endpoints, apis, schemas := s.observer.take(match, match != nil, discoveryID)
+
+	for i := range apis {
+		if err := s.repo.SaveAPI(ctx, &apis[i]); err != nil {
+			s.logger.Error("Failed to save discovered API", "error", err, "api", apis[i].BaseURL)
+		}
+	}
+
+	saved := 0
+	for i := range endpoints {
+		if err := s.repo.SaveEndpoint(ctx, &endpoints[i]); err != nil {
+			s.logger.Error("Failed to save observed endpoint", "error", err, "method", endpoints[i].Method, "path", endpoints[i].Path)
+			s.observer.restore(endpoints[i])
+			continue
+		}
+		saved++
+	}
+
+	// Stored endpoints of old templates are merged once the endpoint they
+	// moved to has been saved
+	for _, merge := range s.observer.takeRetired() {
+		if err := s.repo.MergeEndpoint(ctx, merge.from, merge.into); err != nil {
+			s.logger.Error("Failed to merge retemplated endpoint", "error", err, "endpoint_id", merge.from, "into", merge.into)
+			s.observer.restoreRetired(merge)
+		}
+	}
+
+	for _, update := range schemas {
+		if err := s.repo.SaveEndpointSchema(ctx, update.schema); err != nil {
+			s.logger.Error("Failed to save learned endpoint schema", "error", err, "endpoint_id", update.schema.EndpointID)
+			s.observer.restoreSchema(update)
+			continue
+		}
+		s.logger.Info("Learned endpoint schema changed", "endpoint_id", update.schema.EndpointID, "version", update.schema.Version)
+	}
+
+	for _, observation := range s.observer.takeGraphQL(match) {
+		if err := s.saveGraphQLSchema(ctx, observation.schema, false); err != nil {
+			s.logger.Error("Failed to save observed GraphQL schema", "error", err, "url", observation.schema.URL)
+			s.observer.restoreGraphQL(observation)
+		}
+	}
+
+	for _, observation := range s.observer.takeGRPC(match) {
+		if err := s.saveGRPCMethod(ctx, observation.method); err != nil {
+			s.logger.Error("Failed to save observed gRPC method", "error", err, "path", observation.method.Path)
+			s.observer.restoreGRPC(observation)
+		}
+	}
+
+	s.observer.evictFlushed()
+	return saved
+}
+
+// loadEndpointSchemas seeds the learners of endpoints seen for the first time
+// with their latest stored schema versions
+func (s *DiscoveryService) loadEndpointSchemas(ctx context.Context, match func(*endpointObservation) bool) {
+	for _, endpointID := range s.observer.unloadedSchemas(match) {
+		stored, err := s.repo.GetLatestEndpointSchema(ctx, endpointID)
+		if err != nil {
+			s.logger.Warn("Failed to load learned endpoint schema", "error", err, "endpoint_id", endpointID)
+			continue
+		}
+		if err := s.observer.seedSchema(endpointID, stored); err != nil {
+			s.logger.Warn("Discarded stored endpoint schema", "error", err, "endpoint_id", endpointID)
+		}
+	}
+}
+
+// startObservationFlusher writes observed endpoints to the inventory every
+// observationFlushInterval until the service is closed
+func (s *DiscoveryService) startObservationFlusher() {
+	defer close(s.flusherDone)
+	ticker := time.NewTicker(observationFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		if saved := s.flushObservations(context.Background(), "", nil); saved > 0 {
+			s.logger.Info("Flushed observed endpoints", "count", saved)
+		}
+	}
+}
+
+// passiveWindow reads how long a passive run listens from the "window" option
+func passiveWindow(config *models.DiscoveryConfig) time.Duration {
+	if config == nil || config.Options["window"] == "" {
+		return defaultPassiveWindow
+	}
+	window, err := time.ParseDuration(config.Options["window"])
+	if err != nil || window < 0 {
+		return defaultPassiveWindow
+	}
+	return window
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+func TestObserveTrafficClustersEndpoints(t *testing.T) {
+	repo := newMemoryDiscoveryRepository()
+	service := &DiscoveryService{repo: repo, logger: logging.NewStructuredLogger("test"), observer: newTrafficObserver(NewPathInferenceEngine())}
+	ctx := context.Background()
+
+	records := []string{
+		`{"id":"1","timestamp":"2026-01-02T10:00:00Z","method":"get","url":"https://shop.example.com:443/users/42?expand=orders","path":"/users/42","query_params":{"expand":"orders"},"status_code":200,"response_headers":{"Content-Type":"application/json; charset=utf-8"}}`,
+		`{"id":"2","timestamp":"2026-01-02T09:00:00Z","method":"GET","url":"https://shop.example.com/users/7","path":"/users/7","status_code":404,"response_headers":{"content-type":"application/problem+json"}}`,
+		`{"id":"3","timestamp":"2026-01-02T11:00:00Z","method":"POST","path":"/users","headers":{"Host":"shop.example.com","X-Forwarded-Proto":"https","Content-Type":"application/json"},"status_code":201,"body_fields":[{"path":"$.name","type":"string"},{"path":"$.tags[0]","type":"string"},{"path":"$.tags[1]","type":"string"}]}`,
+		`{"id":"4","timestamp":"2026-01-02T11:00:00Z","method":"GET","url":"http://other.example.com/users/1","status_code":200}`,
+	}
+	for _, record := range records {
+		if err := service.ObserveTraffic(ctx, []byte(record)); err != nil {
+			t.Fatalf("ObserveTraffic: %v", err)
+		}
+	}
+	if err := service.ObserveTraffic(ctx, []byte(`{"id":"5","method":"GET","path":"/nohost"}`)); err == nil {
+		t.Errorf("expected an error for a record without a host")
+	}
+
+	match, err := targetMatcher("https://shop.example.com")
+	if err != nil {
+		t.Fatalf("targetMatcher: %v", err)
+	}
+	if found := service.flushObservations(ctx, "disc-1", match); found != 2 {
+		t.Fatalf("found = %d, want 2", found)
+	}
+
+	byRoute := make(map[string]models.Endpoint)
+	for _, endpoint := range repo.endpoints {
+		byRoute[endpoint.Method+" "+endpoint.Path] = endpoint
+	}
+	get := byRoute["GET /users/{userId}"]
+	if get.RequestCount != 2 || get.DiscoveryID != "disc-1" || get.Source != "passive" {
+		t.Fatalf("GET endpoint = %+v", get)
+	}
+	if get.FirstSeen == nil || !get.FirstSeen.Equal(time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)) ||
+		!get.LastSeen.Equal(time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("seen = %v .. %v", get.FirstSeen, get.LastSeen)
+	}
+	if api := repo.apis[get.APIID]; api.LastTrafficAt == nil || !api.LastTrafficAt.Equal(time.Date(2026, 1, 2, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("API last traffic = %v", api.LastTrafficAt)
+	}
+	if len(get.StatusCodes) != 2 || get.StatusCodes[0] != 200 || get.StatusCodes[1] != 404 {
+		t.Errorf("status codes = %v", get.StatusCodes)
+	}
+	if len(get.ContentTypes) != 2 {
+		t.Errorf("content types = %v", get.ContentTypes)
+	}
+
+	params := make(map[string]models.Parameter)
+	for _, param := range get.Parameters {
+		params[param.In+":"+param.Name] = param
+	}
+	if id := params["path:userId"]; !id.Required || id.Type != "integer" {
+		t.Errorf("path param = %+v", id)
+	}
+	if _, ok := params["query:expand"]; !ok {
+		t.Errorf("parameters = %+v", get.Parameters)
+	}
+
+	post := byRoute["POST /users"]
+	if len(post.Parameters) != 2 || post.Parameters[1].Name != "tags[]" {
+		t.Errorf("POST parameters = %+v", post.Parameters)
+	}
+	if api, ok := repo.apis[get.APIID]; !ok || api.BaseURL != "https://shop.example.com" || api.Protocol != endpointProtocolREST || post.APIID != get.APIID {
+		t.Errorf("api = %+v", repo.apis)
+	}
+
+	// Only the new requests are added on the next flush
+	service.ObserveTraffic(ctx, []byte(records[0]))
+	service.flushObservations(ctx, "", nil)
+	if got := repo.endpoints[get.ID].RequestCount; got != 3 {
+		t.Errorf("request count after second flush = %d", got)
+	}
+	if len(repo.endpoints) != 3 {
+		t.Errorf("endpoints = %d, want 3", len(repo.endpoints))
+	}
+}
+
+func TestFlushedIdleObservationsAreEvicted(t *testing.T) {
+	repo := newMemoryDiscoveryRepository()
+	service := &DiscoveryService{repo: repo, logger: logging.NewStructuredLogger("test"), observer: newTrafficObserver(NewPathInferenceEngine())}
+	ctx := context.Background()
+
+	shop := `{"id":"1","method":"GET","url":"https://shop.example.com/orders","status_code":200}`
+	other := `{"id":"2","method":"GET","url":"https://other.example.com/orders","status_code":200}`
+	service.ObserveTraffic(ctx, []byte(shop))
+	service.ObserveTraffic(ctx, []byte(other))
+
+	// A running passive discovery keeps the endpoints it has to report
+	match, err := targetMatcher("other.example.com")
+	if err != nil {
+		t.Fatalf("targetMatcher: %v", err)
+	}
+	unwatch := service.observer.watch(match)
+
+	service.flushObservations(ctx, "", nil)
+	if len(service.observer.endpoints) != 2 {
+		t.Fatalf("observations after first flush = %d, want 2", len(service.observer.endpoints))
+	}
+	service.flushObservations(ctx, "", nil)
+	if len(service.observer.endpoints) != 1 {
+		t.Fatalf("observations after an idle flush = %d, want the watched one", len(service.observer.endpoints))
+	}
+	unwatch()
+	service.flushObservations(ctx, "", nil)
+	if len(service.observer.endpoints) != 0 {
+		t.Fatalf("observations after unwatching = %d, want 0", len(service.observer.endpoints))
+	}
+
+	// An evicted endpoint seen again adds to its stored count
+	service.ObserveTraffic(ctx, []byte(shop))
+	service.flushObservations(ctx, "", nil)
+	for _, endpoint := range repo.endpoints {
+		if endpoint.URL == "https://shop.example.com/orders" && endpoint.RequestCount != 2 {
+			t.Errorf("request count = %d, want 2", endpoint.RequestCount)
+		}
+	}
+}
+
+func TestCloseFlushesPendingObservations(t *testing.T) {
+	repo := newMemoryDiscoveryRepository()
+	service := NewDiscoveryService(repo, NewPathInferenceEngine(), logging.NewStructuredLogger("test")).(*DiscoveryService)
+	ctx := context.Background()
+
+	if err := service.ObserveTraffic(ctx, []byte(`{"id":"1","method":"GET","url":"https://shop.example.com/orders","status_code":200}`)); err != nil {
+		t.Fatalf("ObserveTraffic: %v", err)
+	}
+	if err := service.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case <-service.flusherDone:
+	default:
+		t.Fatalf("observation flusher still running after Close")
+	}
+	if len(repo.endpoints) != 1 {
+		t.Errorf("endpoints after Close = %d, want 1", len(repo.endpoints))
+	}
+	if err := service.Close(ctx); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestRetemplatedEndpointsAreMerged(t *testing.T) {
+	repo := newMemoryDiscoveryRepository()
+	service := &DiscoveryService{repo: repo, logger: logging.NewStructuredLogger("test"), observer: newTrafficObserver(NewPathInferenceEngine())}
+	ctx := context.Background()
+	observe := func(path string) {
+		record := `{"id":"1","method":"GET","url":"https://blog.example.com` + path + `","status_code":200}`
+		if err := service.ObserveTraffic(ctx, []byte(record)); err != nil {
+			t.Fatalf("ObserveTraffic: %v", err)
+		}
+	}
+
+	// A single slug is kept literal, so the first posts are stored as they are
+	observe("/posts/hello-world")
+	observe("/posts/top-ten-tips")
+	service.flushObservations(ctx, "", nil)
+	if len(repo.endpoints) != 2 {
+		t.Fatalf("endpoints = %d, want 2 literal posts", len(repo.endpoints))
+	}
+
+	observe("/posts/go-generics")
+	observe("/posts/why-rust")
+	service.flushObservations(ctx, "", nil)
+
+	var active []models.Endpoint
+	for _, endpoint := range repo.endpoints {
+		if endpoint.IsActive {
+			active = append(active, endpoint)
+		} else if endpoint.RequestCount != 0 {
+			t.Errorf("retired endpoint %s kept %d requests", endpoint.Path, endpoint.RequestCount)
+		}
+	}
+	if len(active) != 1 || active[0].Path != "/posts/{postSlug}" {
+		t.Fatalf("active endpoints = %+v", active)
+	}
+	if active[0].RequestCount != 4 {
+		t.Errorf("request count = %d, want 4", active[0].RequestCount)
+	}
+}
@@ -0,0 +1,744 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+)
+
+// Classes of path segment values. Typed classes are collapsed into a parameter
+// on sight; slugs, enums and free-form strings need statistical evidence.
+const (
+	segmentInteger = "integer"
+	segmentUUID    = "uuid"
+	segmentHex     = "hex"
+	segmentDate    = "date"
+	segmentToken   = "token"
+	segmentSlug    = "slug"
+	segmentEnum    = "enum"
+	segmentString  = "string"
+	segmentWord    = "word"
+	segmentOther   = "other"
+)
+
+const (
+	// maxTrackedSegmentValues bounds the distinct values kept per position
+	maxTrackedSegmentValues = 256
+	// maxSegmentChildren bounds the literal children of one position
+	maxSegmentChildren = 1000
+	// maxInferenceNodes bounds the size of the trie across all APIs
+	maxInferenceNodes = 200000
+	// maxEnumValues is the largest value set treated as an enum
+	maxEnumValues = 10
+	// enumMinHits is how often each enum value must be seen
+	enumMinHits = 3
+	// highCardinalityValues turns a position into a string parameter
+	highCardinalityValues = 50
+	// popularLiteralShare keeps literals that carry this share of a position's
+	// traffic out of a string parameter, e.g. /users/me next to /users/{user}
+	popularLiteralShare = 0.05
+	// collapseConfidence is the confidence slugs and enums need to be collapsed
+	collapseConfidence = 0.9
+)
+
+// segmentPriors is the chance that a single value of a class is a parameter.
+// Confidence grows with each distinct value seen: 1 - (1 - prior)^n.
+var segmentPriors = map[string]float64{
+	segmentInteger: 0.85,
+	segmentUUID:    0.97,
+	segmentHex:     0.8,
+	segmentDate:    0.9,
+	segmentToken:   0.8,
+	segmentSlug:    0.5,
+	segmentEnum:    0.55,
+	segmentString:  0.05,
+}
+
+var typedSegmentClasses = []string{segmentInteger, segmentUUID, segmentHex, segmentDate, segmentToken}
+
+var (
+	uuidSegment  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexSegment   = regexp.MustCompile(`^[0-9a-fA-F]{8,}$`)
+	tokenSegment = regexp.MustCompile(`^[A-Za-z0-9_-]{20,}$`)
+	slugSegment  = regexp.MustCompile(`^[a-z0-9]+(?:[-_][a-z0-9]+)+$`)
+	wordSegment  = regexp.MustCompile(`^[A-Za-z]+$`)
+	templateName = regexp.MustCompile(`^\{([A-Za-z_][A-Za-z0-9_.-]*)\}$`)
+)
+
+// PathInferenceEngine learns which URL path segments of an API are parameters
+// from the concrete paths observed for it, e.g. /orders/123 and /orders/124
+// become /orders/{orderId}. Manual overrides take precedence over inference.
+type PathInferenceEngine struct {
+	mutex     sync.RWMutex
+	roots     map[string]*segmentNode
+	overrides map[string][]*pathOverride
+	nodes     int
+}
+
+// segmentNode holds the statistics for one position in the paths of an API
+type segmentNode struct {
+	literals  map[string]*segmentNode
+	param     *segmentParam
+	values    map[string]int64
+	untracked int64
+	hits      int64
+	terminal  int64
+}
+
+// segmentParam is a parameter inferred at a position
+type segmentParam struct {
+	classes map[string]bool
+	enum    map[string]bool
+	child   *segmentNode
+}
+
+type pathOverride struct {
+	template string
+	segments []string
+	params   map[string]models.Parameter
+	literals int
+}
+
+func NewPathInferenceEngine() *PathInferenceEngine {
+	return &PathInferenceEngine{
+		roots:     make(map[string]*segmentNode),
+		overrides: make(map[string][]*pathOverride),
+	}
+}
+
+// scratch returns an empty engine with the same overrides, for templating a
+// set of stored paths without touching what was learned from traffic
+func (e *PathInferenceEngine) scratch() *PathInferenceEngine {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	engine := NewPathInferenceEngine()
+	for apiID, overrides := range e.overrides {
+		engine.overrides[apiID] = append([]*pathOverride(nil), overrides...)
+	}
+	return engine
+}
+
+// Learn records a concrete path observed for an API
+func (e *PathInferenceEngine) Learn(apiID, path string) {
+	segments := splitPath(path)
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	node, ok := e.roots[apiID]
+	if !ok {
+		node = e.newNode()
+		e.roots[apiID] = node
+	}
+	for _, segment := range segments {
+		if node.record(segment) || node.hits%16 == 0 {
+			e.infer(node)
+		}
+		next := node.next(segment)
+		if next == nil {
+			if len(node.literals) >= maxSegmentChildren || e.nodes >= maxInferenceNodes {
+				return
+			}
+			next = e.newNode()
+			node.literals[segment] = next
+		}
+		node = next
+	}
+	node.terminal++
+}
+
+// Template returns the templated form of a path and its path parameters
+func (e *PathInferenceEngine) Template(apiID, path string) (string, []models.Parameter) {
+	segments := splitPath(path)
+
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	for _, override := range e.overrides[apiID] {
+		if override.matches(segments) {
+			return override.template, override.parameters(segments)
+		}
+	}
+
+	var rendered []string
+	var params []models.Parameter
+	names := make(map[string]int)
+	node := e.roots[apiID]
+	previous := ""
+	for _, segment := range segments {
+		if name := templateName.FindStringSubmatch(segment); name != nil {
+			// Already templated, e.g. a path stored by an earlier run
+			rendered = append(rendered, segment)
+			params = append(params, pathParameter(name[1], segmentString, nil, 1, ""))
+			names[name[1]]++
+			node = nil
+			continue
+		}
+		if node != nil && node.param != nil && node.param.matches(segment, node) {
+			kind := node.param.kind()
+			name := uniqueName(parameterName(previous, kind), names)
+			rendered = append(rendered, "{"+name+"}")
+			params = append(params, pathParameter(name, kind, node.param.enumValues(), node.confidence(node.param), segment))
+			node = node.param.child
+			continue
+		}
+		rendered = append(rendered, segment)
+		previous = segment
+		if node != nil {
+			node = node.literals[segment]
+		}
+	}
+	return "/" + strings.Join(rendered, "/"), params
+}
+
+// SetOverride pins the template for the paths of an API that match it
+func (e *PathInferenceEngine) SetOverride(override *models.PathTemplateOverride) error {
+	parsed, err := parsePathOverride(override)
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	overrides := e.overrides[override.APIID][:0:0]
+	for _, existing := range e.overrides[override.APIID] {
+		if existing.template != parsed.template {
+			overrides = append(overrides, existing)
+		}
+	}
+	overrides = append(overrides, parsed)
+	// The most specific template wins when several match
+	sort.SliceStable(overrides, func(i, j int) bool { return overrides[i].literals > overrides[j].literals })
+	e.overrides[override.APIID] = overrides
+	return nil
+}
+
+func parsePathOverride(override *models.PathTemplateOverride) (*pathOverride, error) {
+	if override.APIID == "" {
+		return nil, fmt.Errorf("path template override needs an API ID")
+	}
+	if !strings.HasPrefix(override.Template, "/") {
+		return nil, fmt.Errorf("path template %q must start with /", override.Template)
+	}
+
+	parsed := &pathOverride{
+		segments: splitPath(override.Template),
+		params:   make(map[string]models.Parameter),
+	}
+	parsed.template = "/" + strings.Join(parsed.segments, "/")
+
+	declared := make(map[string]models.Parameter)
+	for _, param := range override.Parameters {
+		if param.In == "path" {
+			declared[param.Name] = param
+		}
+	}
+	for _, segment := range parsed.segments {
+		if strings.ContainsAny(segment, "{}") {
+			name := templateName.FindStringSubmatch(segment)
+			if name == nil {
+				return nil, fmt.Errorf("invalid path template segment %q", segment)
+			}
+			if _, dup := parsed.params[name[1]]; dup {
+				return nil, fmt.Errorf("path parameter %q appears twice", name[1])
+			}
+			param, ok := declared[name[1]]
+			if !ok {
+				param = models.Parameter{Name: name[1], Type: "string"}
+			}
+			param.In = "path"
+			param.Required = true
+			param.Confidence = 1
+			if param.Description == "" {
+				param.Description = "Path parameter set manually"
+			}
+			parsed.params[name[1]] = param
+			continue
+		}
+		parsed.literals++
+	}
+	return parsed, nil
+}
+
+func (e *PathInferenceEngine) newNode() *segmentNode {
+	e.nodes++
+	return &segmentNode{
+		literals: make(map[string]*segmentNode),
+		values:   make(map[string]int64),
+	}
+}
+
+// infer updates the parameter at a position from the values seen there
+func (e *PathInferenceEngine) infer(node *segmentNode) {
+	byClass := make(map[string][]string)
+	for value := range node.values {
+		class := classifySegment(value)
+		byClass[class] = append(byClass[class], value)
+	}
+
+	for _, class := range typedSegmentClasses {
+		if len(byClass[class]) > 0 {
+			node.addClass(class)
+		}
+	}
+	if segmentConfidence(segmentSlug, len(byClass[segmentSlug])) >= collapseConfidence {
+		node.addClass(segmentSlug)
+	}
+	if words := node.enumCandidates(byClass[segmentWord]); len(words) > 0 {
+		if node.param == nil || node.param.classes[segmentEnum] || len(node.param.enum) > 0 {
+			node.addEnum(words)
+		}
+	}
+	uncovered := int(node.untracked)
+	for value := range node.values {
+		if node.param == nil || !node.param.matches(value, nil) {
+			uncovered++
+		}
+	}
+	if uncovered >= highCardinalityValues {
+		node.addClass(segmentString)
+	}
+
+	if node.param != nil {
+		e.collapse(node)
+	}
+}
+
+// collapse merges the literal children covered by the parameter into it
+func (e *PathInferenceEngine) collapse(node *segmentNode) {
+	for value, child := range node.literals {
+		if !node.param.matches(value, nil) {
+			continue
+		}
+		if node.param.classes[segmentString] && float64(child.hits+child.terminal) >= popularLiteralShare*float64(node.hits) {
+			continue
+		}
+		delete(node.literals, value)
+		e.merge(node.param.child, child)
+	}
+}
+
+func (e *PathInferenceEngine) merge(dst, src *segmentNode) {
+	e.nodes--
+	dst.hits += src.hits
+	dst.terminal += src.terminal
+	dst.untracked += src.untracked
+	for value, count := range src.values {
+		if _, ok := dst.values[value]; ok || len(dst.values) < maxTrackedSegmentValues {
+			dst.values[value] += count
+		} else {
+			dst.untracked++
+		}
+	}
+	if src.param != nil {
+		if dst.param == nil {
+			dst.param = &segmentParam{classes: make(map[string]bool), enum: make(map[string]bool), child: e.newNode()}
+		}
+		for class := range src.param.classes {
+			dst.param.classes[class] = true
+		}
+		for value := range src.param.enum {
+			dst.param.enum[value] = true
+		}
+		e.merge(dst.param.child, src.param.child)
+	}
+	for value, child := range src.literals {
+		if existing, ok := dst.literals[value]; ok {
+			e.merge(existing, child)
+		} else if dst.param != nil && dst.param.matches(value, dst) {
+			e.merge(dst.param.child, child)
+		} else {
+			dst.literals[value] = child
+		}
+	}
+}
+
+// record counts a value at this position and reports whether the statistics
+// changed enough to run inference again
+func (n *segmentNode) record(value string) bool {
+	n.hits++
+	if _, ok := n.values[value]; ok {
+		n.values[value]++
+		return n.values[value] == enumMinHits
+	}
+	if len(n.values) >= maxTrackedSegmentValues {
+		// Values the parameter already covers add nothing to the statistics
+		if n.param == nil || !n.param.matches(value, n) {
+			n.untracked++
+		}
+		return false
+	}
+	n.values[value] = 1
+	return true
+}
+
+func (n *segmentNode) next(value string) *segmentNode {
+	if child, ok := n.literals[value]; ok {
+		return child
+	}
+	if n.param != nil && n.param.matches(value, n) {
+		return n.param.child
+	}
+	return nil
+}
+
+func (n *segmentNode) ensureParam() *segmentParam {
+	if n.param == nil {
+		n.param = &segmentParam{
+			classes: make(map[string]bool),
+			enum:    make(map[string]bool),
+			child: &segmentNode{
+				literals: make(map[string]*segmentNode),
+				values:   make(map[string]int64),
+			},
+		}
+	}
+	return n.param
+}
+
+func (n *segmentNode) addClass(class string) {
+	n.ensureParam().classes[class] = true
+}
+
+func (n *segmentNode) addEnum(values []string) {
+	param := n.ensureParam()
+	param.classes[segmentEnum] = true
+	for _, value := range values {
+		param.enum[value] = true
+	}
+}
+
+// enumCandidates returns the words at this position that look like the values
+// of one enum: few of them, each seen repeatedly, each followed by the same
+// literal segments. Requiring a literal after the value keeps sibling resources
+// such as /api/users/{id} and /api/orders/{id} apart.
+func (n *segmentNode) enumCandidates(words []string) []string {
+	known := 0
+	shape := ""
+	if n.param != nil && len(n.param.enum) > 0 {
+		known = len(n.param.enum)
+		shape = n.param.child.shape()
+	}
+
+	var candidates []string
+	for _, word := range words {
+		if n.param != nil && n.param.enum[word] {
+			continue
+		}
+		if n.values[word] < enumMinHits {
+			return nil
+		}
+		child, ok := n.literals[word]
+		if !ok {
+			continue
+		}
+		if len(child.literals) == 0 {
+			return nil
+		}
+		if shape == "" {
+			shape = child.shape()
+		} else if child.shape() != shape {
+			return nil
+		}
+		candidates = append(candidates, word)
+	}
+
+	total := known + len(candidates)
+	if len(candidates) == 0 || total < 2 || total > maxEnumValues {
+		return nil
+	}
+	if segmentConfidence(segmentEnum, total) < collapseConfidence {
+		return nil
+	}
+	return candidates
+}
+
+// shape describes what follows a position, so sibling values can be compared
+func (n *segmentNode) shape() string {
+	parts := make([]string, 0, len(n.literals)+2)
+	for value := range n.literals {
+		parts = append(parts, value)
+	}
+	if n.param != nil {
+		parts = append(parts, "{"+n.param.kind()+"}")
+	}
+	if n.terminal > 0 {
+		parts = append(parts, "$")
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "|")
+}
+
+// confidence reports how sure inference is that a position is a parameter
+func (n *segmentNode) confidence(param *segmentParam) float64 {
+	counts := make(map[string]int)
+	for value := range n.values {
+		counts[classifySegment(value)]++
+	}
+	confidence := 1.0
+	for class := range param.classes {
+		var c float64
+		switch class {
+		case segmentEnum:
+			c = segmentConfidence(class, len(param.enum))
+		case segmentString:
+			c = segmentConfidence(class, len(n.values)+int(n.untracked))
+		default:
+			c = segmentConfidence(class, counts[class])
+		}
+		confidence = math.Min(confidence, c)
+	}
+	return math.Round(confidence*1000) / 1000
+}
+
+// matches reports whether a value belongs to the parameter. A node is passed
+// when a string parameter must leave the node's literal children alone.
+func (p *segmentParam) matches(value string, node *segmentNode) bool {
+	if p.classes[segmentString] {
+		if node == nil {
+			return true
+		}
+		_, literal := node.literals[value]
+		return !literal
+	}
+	class := classifySegment(value)
+	if class == segmentWord && p.enum[value] {
+		return true
+	}
+	return p.classes[class]
+}
+
+// kind is the class reported for the parameter; mixed classes are strings
+func (p *segmentParam) kind() string {
+	if len(p.classes) == 1 {
+		for class := range p.classes {
+			return class
+		}
+	}
+	return segmentString
+}
+
+func (p *segmentParam) enumValues() []string {
+	if len(p.classes) != 1 || !p.classes[segmentEnum] {
+		return nil
+	}
+	values := make([]string, 0, len(p.enum))
+	for value := range p.enum {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+func (o *pathOverride) matches(segments []string) bool {
+	if len(segments) != len(o.segments) {
+		return false
+	}
+	for i, segment := range o.segments {
+		if templateName.MatchString(segment) {
+			continue
+		}
+		if segment != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *pathOverride) parameters(segments []string) []models.Parameter {
+	var params []models.Parameter
+	for i, segment := range o.segments {
+		name := templateName.FindStringSubmatch(segment)
+		if name == nil {
+			continue
+		}
+		param := o.params[name[1]]
+		if !templateName.MatchString(segments[i]) {
+			param.Example = segments[i]
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// Helper functions
+
+func splitPath(path string) []string {
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// classifySegment returns the class of a single path segment value
+func classifySegment(value string) string {
+	if value == "" {
+		return segmentOther
+	}
+	if len(value) <= 20 && isDigits(value) {
+		return segmentInteger
+	}
+	if uuidSegment.MatchString(value) {
+		return segmentUUID
+	}
+	if isDateSegment(value) {
+		return segmentDate
+	}
+	if hexSegment.MatchString(value) && strings.ContainsAny(value, "0123456789") && strings.ContainsAny(strings.ToLower(value), "abcdef") {
+		return segmentHex
+	}
+	if tokenSegment.MatchString(value) && strings.ContainsAny(value, "0123456789") && strings.ContainsAny(strings.ToLower(value), "abcdefghijklmnopqrstuvwxyz") {
+		return segmentToken
+	}
+	if slugSegment.MatchString(value) {
+		return segmentSlug
+	}
+	if wordSegment.MatchString(value) {
+		return segmentWord
+	}
+	return segmentOther
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isDateSegment(value string) bool {
+	if len(value) < 10 || value[4] != '-' {
+		return false
+	}
+	if _, err := time.Parse("2006-01-02", value); err == nil {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339, value)
+	return err == nil
+}
+
+func segmentConfidence(class string, distinct int) float64 {
+	if distinct <= 0 {
+		return 0
+	}
+	return 1 - math.Pow(1-segmentPriors[class], float64(distinct))
+}
+
+// parameterName names a parameter after the literal segment before it, e.g.
+// /orders/{orderId} or /posts/{postSlug}
+func parameterName(previous, kind string) string {
+	resource := camelCase(singular(previous))
+	switch kind {
+	case segmentInteger, segmentUUID, segmentHex, segmentToken:
+		if resource == "" {
+			return "id"
+		}
+		return resource + "Id"
+	case segmentSlug:
+		if resource == "" {
+			return "slug"
+		}
+		return resource + "Slug"
+	case segmentDate:
+		return "date"
+	default:
+		if resource == "" {
+			return "value"
+		}
+		return resource
+	}
+}
+
+func uniqueName(name string, used map[string]int) string {
+	used[name]++
+	if used[name] == 1 {
+		return name
+	}
+	return name + strconv.Itoa(used[name])
+}
+
+func singular(word string) string {
+	lower := strings.ToLower(word)
+	switch {
+	case strings.HasSuffix(lower, "ies") && len(word) > 3:
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(lower, "sses"), strings.HasSuffix(lower, "xes"), strings.HasSuffix(lower, "ches"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(lower, "ss"), strings.HasSuffix(lower, "us"):
+		return word
+	case strings.HasSuffix(lower, "s") && len(word) > 1:
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+func camelCase(word string) string {
+	parts := strings.FieldsFunc(word, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	for i, part := range parts {
+		part = strings.ToLower(part)
+		if i > 0 && part != "" {
+			part = strings.ToUpper(part[:1]) + part[1:]
+		}
+		parts[i] = part
+	}
+	name := strings.Join(parts, "")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		return ""
+	}
+	return name
+}
+
+// pathParameter renders an inferred parameter with an OpenAPI schema for its kind
+func pathParameter(name, kind string, enum []string, confidence float64, example string) models.Parameter {
+	schema := map[string]interface{}{"type": "string"}
+	paramType := "string"
+	switch kind {
+	case segmentInteger:
+		schema["type"] = "integer"
+		paramType = "integer"
+	case segmentUUID:
+		schema["format"] = "uuid"
+	case segmentDate:
+		schema["format"] = "date"
+	case segmentHex:
+		schema["pattern"] = "^[0-9a-fA-F]+$"
+	case segmentSlug:
+		schema["pattern"] = "^[a-z0-9]+(?:[-_][a-z0-9]+)*$"
+	case segmentEnum:
+		if len(enum) > 0 {
+			schema["enum"] = enum
+		}
+	}
+
+	param := models.Parameter{
+		Name:        name,
+		In:          "path",
+		Type:        paramType,
+		Required:    true,
+		Description: fmt.Sprintf("Path parameter inferred as %s", kind),
+		Schema:      schema,
+		Confidence:  confidence,
+	}
+	if example != "" {
+		param.Example = example
+	}
+	return param
+}
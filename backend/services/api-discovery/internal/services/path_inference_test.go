@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+func learnAll(engine *PathInferenceEngine, apiID string, paths ...string) {
+	for _, path := range paths {
+		engine.Learn(apiID, path)
+	}
+}
+
+func TestPathInferenceTypedSegments(t *testing.T) {
+	engine := NewPathInferenceEngine()
+	cases := map[string]string{
+		"/orders/123": "/orders/{orderId}",
+		"/users/6fa459ea-ee8a-3ca4-894e-db77e160355e":      "/users/{userId}",
+		"/teams/7/members/19":                              "/teams/{teamId}/members/{memberId}",
+		"/files/507f1f77bcf86cd799439011":                  "/files/{fileId}",
+		"/reports/2026-01-31":                              "/reports/{date}",
+		"/sessions/eyJhbGciOiJIUzI1NiJ9abc123def456ghi789": "/sessions/{sessionId}",
+		"/api/v1/health":                                   "/api/v1/health",
+		"/categories/9/subcategories/4":                    "/categories/{categoryId}/subcategories/{subcategoryId}",
+	}
+	for path, want := range cases {
+		engine.Learn("api", path)
+		if got, _ := engine.Template("api", path); got != want {
+			t.Errorf("Template(%q) = %q, want %q", path, got, want)
+		}
+	}
+
+	// Concrete paths that differ only in the identifier share one template
+	engine.Learn("api", "/orders/124")
+	_, params := engine.Template("api", "/orders/124")
+	if len(params) != 1 || params[0].Name != "orderId" || params[0].Type != "integer" || params[0].In != "path" || !params[0].Required {
+		t.Fatalf("params = %+v", params)
+	}
+	if params[0].Confidence < 0.97 || params[0].Example != "124" {
+		t.Errorf("confidence = %v, example = %v", params[0].Confidence, params[0].Example)
+	}
+	_, params = engine.Template("api", "/users/6fa459ea-ee8a-3ca4-894e-db77e160355e")
+	if schema := params[0].Schema.(map[string]interface{}); schema["format"] != "uuid" {
+		t.Errorf("uuid schema = %v", schema)
+	}
+}
+
+func TestPathInferenceStatisticalSegments(t *testing.T) {
+	engine := NewPathInferenceEngine()
+
+	// A single slug is kept literal; several collapse
+	learnAll(engine, "api", "/posts/hello-world", "/posts/top-ten-tips")
+	if got, _ := engine.Template("api", "/posts/hello-world"); got != "/posts/hello-world" {
+		t.Errorf("early slug template = %q", got)
+	}
+	learnAll(engine, "api", "/posts/go-generics", "/posts/why-rust")
+	got, params := engine.Template("api", "/posts/a-new-one")
+	if got != "/posts/{postSlug}" || params[0].Confidence < collapseConfidence {
+		t.Errorf("slug template = %q %+v", got, params)
+	}
+
+	// Repeated words followed by the same literal segments form an enum
+	for i := 0; i < enumMinHits; i++ {
+		learnAll(engine, "api", "/stats/daily/summary", "/stats/weekly/summary", "/stats/monthly/summary")
+	}
+	got, params = engine.Template("api", "/stats/weekly/summary")
+	if got != "/stats/{stat}/summary" {
+		t.Fatalf("enum template = %q", got)
+	}
+	if enum := params[0].Schema.(map[string]interface{})["enum"]; fmt.Sprint(enum) != "[daily monthly weekly]" {
+		t.Errorf("enum = %v", enum)
+	}
+
+	// Sibling resources stay literal
+	for i := 0; i < 5; i++ {
+		learnAll(engine, "api", "/v1/users", "/v1/orders", "/v1/products", "/v1/invoices")
+	}
+	if got, _ := engine.Template("api", "/v1/orders"); got != "/v1/orders" {
+		t.Errorf("resource template = %q", got)
+	}
+
+	// Many distinct free-form values become a string parameter, while a popular
+	// literal next to them is kept
+	for i := 0; i < 20; i++ {
+		engine.Learn("api", "/profiles/me")
+	}
+	for i := 0; i < highCardinalityValues; i++ {
+		engine.Learn("api", fmt.Sprintf("/profiles/user.%c%c", 'a'+i%26, 'a'+i/26))
+	}
+	if got, _ := engine.Template("api", "/profiles/user.zz"); got != "/profiles/{profile}" {
+		t.Errorf("string template = %q", got)
+	}
+	if got, _ := engine.Template("api", "/profiles/me"); got != "/profiles/me" {
+		t.Errorf("popular literal template = %q", got)
+	}
+}
+
+func TestPathTemplateOverrides(t *testing.T) {
+	repo := newMemoryDiscoveryRepository()
+	engine := NewPathInferenceEngine()
+	service := NewMetadataService(repo, engine, nil, logging.NewStructuredLogger("test")).(*MetadataService)
+	ctx := context.Background()
+
+	engine.Learn("api", "/reports/2026")
+	if got, _ := engine.Template("api", "/reports/2026"); got != "/reports/{reportId}" {
+		t.Fatalf("inferred = %q", got)
+	}
+
+	repo.metadata["ep-1"] = &models.Metadata{EndpointID: "ep-1", APIID: "api", URL: "https://example.com/reports/2026"}
+	update := &models.Metadata{
+		PathTemplate: "/reports/{year}",
+		Parameters:   []models.Parameter{{Name: "year", In: "path", Type: "integer", Description: "Reporting year"}},
+	}
+	if err := service.UpdateEndpointMetadata(ctx, "ep-1", update); err != nil {
+		t.Fatalf("UpdateEndpointMetadata: %v", err)
+	}
+	got, params := engine.Template("api", "/reports/2027")
+	if got != "/reports/{year}" || params[0].Confidence != 1 || params[0].Description != "Reporting year" {
+		t.Errorf("override = %q %+v", got, params)
+	}
+	if len(repo.overrides) != 1 {
+		t.Errorf("overrides = %+v", repo.overrides)
+	}
+
+	// A literal override keeps a segment out of inference
+	if err := engine.SetOverride(&models.PathTemplateOverride{APIID: "api", Template: "/reports/2020"}); err != nil {
+		t.Fatalf("SetOverride: %v", err)
+	}
+	if got, _ := engine.Template("api", "/reports/2020"); got != "/reports/2020" {
+		t.Errorf("literal override = %q", got)
+	}
+
+	bad := &models.Metadata{APIID: "api", URL: "https://example.com/reports/2026", PathTemplate: "/invoices/{id}"}
+	if err := service.UpdateEndpointMetadata(ctx, "ep-1", bad); err == nil {
+		t.Errorf("expected an error for a template that does not match the endpoint")
+	}
+	if err := service.UpdateEndpointMetadata(ctx, "ep-1", &models.Metadata{APIID: "api", PathTemplate: "/reports/{a}{b}"}); err == nil {
+		t.Errorf("expected an error for an invalid template")
+	}
+}
+
+func TestGenerateAPISpecTemplatesPaths(t *testing.T) {
+	repo := newMemoryDiscoveryRepository()
+	service := NewMetadataService(repo, NewPathInferenceEngine(), nil, logging.NewStructuredLogger("test")).(*MetadataService)
+	ctx := context.Background()
+
+	endpoints := []models.Endpoint{
+		{ID: "1", APIID: "api", Path: "/orders/123", Method: "GET"},
+		{ID: "2", APIID: "api", Path: "/orders/124", Method: "GET"},
+		{ID: "3", APIID: "api", Path: "/orders/124", Method: "DELETE"},
+		{ID: "4", APIID: "api", Path: "/orders", Method: "POST",
+			Parameters: []models.Parameter{{Name: "note", In: "body", Type: "string"}}},
+		{ID: "5", APIID: "api", Path: "/customers/{customerId}", Method: "GET",
+			Parameters: []models.Parameter{{Name: "customerId", In: "path", Type: "string", Confidence: 0.95}}},
+	}
+	for i := range endpoints {
+		repo.endpoints[endpoints[i].ID] = endpoints[i]
+	}
+
+	spec, err := service.GenerateAPISpec(ctx, "api")
+	if err != nil {
+		t.Fatalf("GenerateAPISpec: %v", err)
+	}
+	if len(spec.Paths) != 3 {
+		t.Fatalf("paths = %v", spec.Paths)
+	}
+	item := spec.Paths["/orders/{orderId}"]
+	if item == nil || item.Get == nil || item.Delete == nil {
+		t.Fatalf("orders item = %+v", item)
+	}
+	if len(item.Parameters) != 1 || item.Parameters[0].Name != "orderId" || item.Parameters[0].In != "path" {
+		t.Errorf("path parameters = %+v", item.Parameters)
+	}
+	if post := spec.Paths["/orders"]; post == nil || post.Post == nil || len(post.Post.Parameters) != 1 || len(post.Parameters) != 0 {
+		t.Errorf("orders collection = %+v", post)
+	}
+	customer := spec.Paths["/customers/{customerId}"]
+	if customer == nil || len(customer.Parameters) != 1 || customer.Parameters[0].Confidence != 0.95 {
+		t.Errorf("customer item = %+v", customer)
+	}
+}
@@ -0,0 +1,631 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+	"scopeapi.local/backend/services/api-discovery/internal/repository"
+)
+
+// memoryDiscoveryRepository is an in-memory DiscoveryRepositoryInterface for tests
+type memoryDiscoveryRepository struct {
+	mutex       sync.Mutex
+	discoveries map[string]*models.Discovery
+	apis        map[string]models.API
+	endpoints   map[string]models.Endpoint
+	metadata    map[string]*models.Metadata
+	specs       map[string]*models.APISpec
+	overrides   map[string]models.PathTemplateOverride
+	schemas     []models.EndpointSchema
+	versions    []models.APISpecVersion
+	outbox      []models.PendingSpecChange
+	published   map[string]bool
+	graphql     map[string]models.GraphQLSchema
+	grpc        map[string]models.GRPCMethod
+}
+
+func newMemoryDiscoveryRepository() *memoryDiscoveryRepository {
+	return &memoryDiscoveryRepository{
+		discoveries: make(map[string]*models.Discovery),
+		apis:        make(map[string]models.API),
+		endpoints:   make(map[string]models.Endpoint),
+		metadata:    make(map[string]*models.Metadata),
+		specs:       make(map[string]*models.APISpec),
+		overrides:   make(map[string]models.PathTemplateOverride),
+		graphql:     make(map[string]models.GraphQLSchema),
+		grpc:        make(map[string]models.GRPCMethod),
+		published:   make(map[string]bool),
+	}
+}
+
+func (r *memoryDiscoveryRepository) CreateDiscovery(ctx context.Context, discovery *models.Discovery) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	copied := *discovery
+	r.discoveries[discovery.ID] = &copied
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) GetDiscovery(ctx context.Context, discoveryID string) (*models.Discovery, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	discovery, ok := r.discoveries[discoveryID]
+	if !ok {
+		return nil, fmt.Errorf("discovery not found: %s", discoveryID)
+	}
+	copied := *discovery
+	return &copied, nil
+}
+
+func (r *memoryDiscoveryRepository) UpdateDiscoveryStatus(ctx context.Context, discoveryID string, status string) error {
+	return r.updateDiscovery(discoveryID, func(d *models.Discovery) { d.Status = status })
+}
+
+func (r *memoryDiscoveryRepository) UpdateDiscoveryProgress(ctx context.Context, discoveryID string, progress int, checkpoint *models.CrawlCheckpoint) error {
+	return r.updateDiscovery(discoveryID, func(d *models.Discovery) {
+		d.Progress = progress
+		if checkpoint != nil {
+			d.Checkpoint = checkpoint
+		}
+	})
+}
+
+func (r *memoryDiscoveryRepository) UpdateDiscoveryEndpointsFound(ctx context.Context, discoveryID string, count int) error {
+	return r.updateDiscovery(discoveryID, func(d *models.Discovery) { d.EndpointsFound = count })
+}
+
+func (r *memoryDiscoveryRepository) updateDiscovery(discoveryID string, update func(*models.Discovery)) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	discovery, ok := r.discoveries[discoveryID]
+	if !ok {
+		return fmt.Errorf("discovery not found: %s", discoveryID)
+	}
+	update(discovery)
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) GetDiscoveryResults(ctx context.Context, discoveryID string, page, limit int) (*models.DiscoveryResults, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	results := &models.DiscoveryResults{DiscoveryID: discoveryID, Page: page, Limit: limit}
+	for _, endpoint := range r.endpoints {
+		if endpoint.DiscoveryID == discoveryID {
+			results.Endpoints = append(results.Endpoints, endpoint)
+		}
+	}
+	results.Total = len(results.Endpoints)
+	return results, nil
+}
+
+// SaveEndpoint merges observations the way the PostgreSQL upsert does
+func (r *memoryDiscoveryRepository) SaveEndpoint(ctx context.Context, endpoint *models.Endpoint) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	saved := *endpoint
+	if saved.Protocol == "" {
+		saved.Protocol = "rest"
+	}
+	if existing, ok := r.endpoints[endpoint.ID]; ok {
+		if saved.Protocol == "rest" {
+			saved.Protocol = existing.Protocol
+		}
+		saved.RequestCount += existing.RequestCount
+		if existing.FirstSeen != nil && (saved.FirstSeen == nil || existing.FirstSeen.Before(*saved.FirstSeen)) {
+			saved.FirstSeen = existing.FirstSeen
+		}
+		if saved.DiscoveryID == "" {
+			saved.DiscoveryID = existing.DiscoveryID
+		}
+		if existing.LastTrafficAt != nil && (saved.LastTrafficAt == nil || existing.LastTrafficAt.After(*saved.LastTrafficAt)) {
+			saved.LastTrafficAt = existing.LastTrafficAt
+		}
+		if endpoint.LastTrafficAt == nil {
+			saved.TrafficState = existing.TrafficState
+		}
+	}
+	if saved.TrafficState == "" || endpoint.LastTrafficAt != nil {
+		saved.TrafficState = "active"
+	}
+	r.endpoints[endpoint.ID] = saved
+	return nil
+}
+
+// MergeEndpoint moves counts into another endpoint the way the PostgreSQL
+// repository does
+func (r *memoryDiscoveryRepository) MergeEndpoint(ctx context.Context, fromID, intoID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	into, ok := r.endpoints[intoID]
+	if !ok {
+		return fmt.Errorf("endpoint not found: %s", intoID)
+	}
+	from, ok := r.endpoints[fromID]
+	if !ok || !from.IsActive {
+		return nil
+	}
+	into.RequestCount += from.RequestCount
+	if from.FirstSeen != nil && (into.FirstSeen == nil || from.FirstSeen.Before(*into.FirstSeen)) {
+		into.FirstSeen = from.FirstSeen
+	}
+	r.endpoints[intoID] = into
+	from.IsActive = false
+	from.RequestCount = 0
+	r.endpoints[fromID] = from
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) SaveAPI(ctx context.Context, api *models.API) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	saved := *api
+	if existing, ok := r.apis[api.ID]; ok && existing.LastTrafficAt != nil &&
+		(saved.LastTrafficAt == nil || existing.LastTrafficAt.After(*saved.LastTrafficAt)) {
+		saved.LastTrafficAt = existing.LastTrafficAt
+	}
+	r.apis[api.ID] = saved
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) UpdateEndpoint(ctx context.Context, endpoint *models.Endpoint) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.endpoints[endpoint.ID] = *endpoint
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) SaveEndpointAnalysis(ctx context.Context, analysis *models.EndpointAnalysis) error {
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) GetEndpointMetadata(ctx context.Context, endpointID string) (*models.Metadata, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	metadata, ok := r.metadata[endpointID]
+	if !ok {
+		return nil, fmt.Errorf("metadata not found: %s", endpointID)
+	}
+	return metadata, nil
+}
+
+func (r *memoryDiscoveryRepository) UpdateEndpointMetadata(ctx context.Context, endpointID string, metadata *models.Metadata) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.metadata[endpointID] = metadata
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) SaveEndpointMetadata(ctx context.Context, metadata *models.Metadata) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.metadata[metadata.EndpointID] = metadata
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) GetAPISpecification(ctx context.Context, apiID string) (*models.APISpec, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	spec, ok := r.specs[apiID]
+	if !ok {
+		return nil, fmt.Errorf("specification not found: %s", apiID)
+	}
+	return spec, nil
+}
+
+func (r *memoryDiscoveryRepository) SaveAPISpecification(ctx context.Context, spec *models.APISpec) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.specs[spec.APIID] = spec
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) GetAPIEndpoints(ctx context.Context, apiID string) ([]models.Endpoint, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var endpoints []models.Endpoint
+	for _, endpoint := range r.endpoints {
+		if endpoint.APIID == apiID {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Path != endpoints[j].Path {
+			return endpoints[i].Path < endpoints[j].Path
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+	return endpoints, nil
+}
+
+func (r *memoryDiscoveryRepository) SavePathTemplateOverride(ctx context.Context, override *models.PathTemplateOverride) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.overrides[override.ID] = *override
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) GetPathTemplateOverrides(ctx context.Context) ([]models.PathTemplateOverride, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var overrides []models.PathTemplateOverride
+	for _, override := range r.overrides {
+		overrides = append(overrides, override)
+	}
+	return overrides, nil
+}
+
+func (r *memoryDiscoveryRepository) SaveEndpointSchema(ctx context.Context, schema *models.EndpointSchema) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, existing := range r.schemas {
+		if existing.EndpointID == schema.EndpointID && existing.Version == schema.Version {
+			return fmt.Errorf("schema version %d of %s already exists", schema.Version, schema.EndpointID)
+		}
+	}
+	r.schemas = append(r.schemas, *schema)
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) GetEndpointSchemas(ctx context.Context, endpointID string) ([]models.EndpointSchema, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var schemas []models.EndpointSchema
+	for _, schema := range r.schemas {
+		if schema.EndpointID == endpointID {
+			schemas = append(schemas, schema)
+		}
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Version > schemas[j].Version })
+	return schemas, nil
+}
+
+func (r *memoryDiscoveryRepository) GetLatestEndpointSchema(ctx context.Context, endpointID string) (*models.EndpointSchema, error) {
+	schemas, _ := r.GetEndpointSchemas(ctx, endpointID)
+	if len(schemas) == 0 {
+		return nil, nil
+	}
+	return &schemas[0], nil
+}
+
+func (r *memoryDiscoveryRepository) GetLatestAPISchemas(ctx context.Context, apiID string) ([]models.EndpointSchema, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	latest := make(map[string]models.EndpointSchema)
+	for _, schema := range r.schemas {
+		if schema.APIID == apiID && schema.Version > latest[schema.EndpointID].Version {
+			latest[schema.EndpointID] = schema
+		}
+	}
+	schemas := make([]models.EndpointSchema, 0, len(latest))
+	for _, schema := range latest {
+		schemas = append(schemas, schema)
+	}
+	return schemas, nil
+}
+
+func (r *memoryDiscoveryRepository) SaveAPISpecVersion(ctx context.Context, version *models.APISpecVersion, event *models.SpecChangeEvent) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, existing := range r.versions {
+		if existing.APIID == version.APIID && existing.Version == version.Version {
+			return fmt.Errorf("%w: version %d", repository.ErrSpecVersionConflict, version.Version)
+		}
+	}
+	// Store a copy, as the database would
+	encoded, _ := json.Marshal(version)
+	var stored models.APISpecVersion
+	json.Unmarshal(encoded, &stored)
+	r.versions = append(r.versions, stored)
+	if event != nil {
+		r.outbox = append(r.outbox, models.PendingSpecChange{VersionID: version.ID, Event: *event, CreatedAt: version.CreatedAt})
+	}
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) GetPendingSpecChanges(ctx context.Context, limit int) ([]models.PendingSpecChange, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var pending []models.PendingSpecChange
+	for _, change := range r.outbox {
+		if !r.published[change.VersionID] && len(pending) < limit {
+			pending = append(pending, change)
+		}
+	}
+	return pending, nil
+}
+
+func (r *memoryDiscoveryRepository) MarkSpecChangePublished(ctx context.Context, versionID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.published[versionID] = true
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) RecordSpecChangeFailure(ctx context.Context, versionID string, reason string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i := range r.outbox {
+		if r.outbox[i].VersionID == versionID {
+			r.outbox[i].Attempts++
+			r.outbox[i].LastError = reason
+		}
+	}
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) GetAPISpecVersions(ctx context.Context, apiID string) ([]models.APISpecVersion, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var versions []models.APISpecVersion
+	for _, version := range r.versions {
+		if version.APIID == apiID {
+			version.Spec = nil
+			versions = append(versions, version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions, nil
+}
+
+func (r *memoryDiscoveryRepository) GetAPISpecVersion(ctx context.Context, apiID string, number int) (*models.APISpecVersion, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, version := range r.versions {
+		if version.APIID == apiID && version.Version == number {
+			return &version, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryDiscoveryRepository) GetLatestAPISpecVersion(ctx context.Context, apiID string) (*models.APISpecVersion, error) {
+	versions, _ := r.GetAPISpecVersions(ctx, apiID)
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	return r.GetAPISpecVersion(ctx, apiID, versions[0].Version)
+}
+
+func (r *memoryDiscoveryRepository) SaveGraphQLSchema(ctx context.Context, schema *models.GraphQLSchema) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.graphql[schema.ID] = *schema
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) GetGraphQLSchema(ctx context.Context, schemaID string) (*models.GraphQLSchema, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	schema, ok := r.graphql[schemaID]
+	if !ok {
+		return nil, nil
+	}
+	return &schema, nil
+}
+
+func (r *memoryDiscoveryRepository) GetGraphQLSchemas(ctx context.Context, apiID string) ([]models.GraphQLSchema, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var schemas []models.GraphQLSchema
+	for _, schema := range r.graphql {
+		if schema.APIID == apiID {
+			schemas = append(schemas, schema)
+		}
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Path < schemas[j].Path })
+	return schemas, nil
+}
+
+func (r *memoryDiscoveryRepository) SaveGRPCMethod(ctx context.Context, method *models.GRPCMethod) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.grpc[method.ID] = *method
+	return nil
+}
+
+func (r *memoryDiscoveryRepository) GetGRPCMethod(ctx context.Context, methodID string) (*models.GRPCMethod, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	method, ok := r.grpc[methodID]
+	if !ok {
+		return nil, nil
+	}
+	return &method, nil
+}
+
+func (r *memoryDiscoveryRepository) GetGRPCMethods(ctx context.Context, apiID string) ([]models.GRPCMethod, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var methods []models.GRPCMethod
+	for _, method := range r.grpc {
+		if method.APIID == apiID {
+			methods = append(methods, method)
+		}
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Method < methods[j].Method })
+	return methods, nil
+}
+
+// memoryInventoryRepository is an in-memory InventoryRepositoryInterface for tests
+type memoryInventoryRepository struct {
+	mutex     sync.Mutex
+	apis      map[string]models.API
+	endpoints map[string]models.Endpoint
+	specs     map[string]models.ImportedSpec
+	reports   map[string]models.DriftReport
+}
+
+func newMemoryInventoryRepository() *memoryInventoryRepository {
+	return &memoryInventoryRepository{
+		apis:      make(map[string]models.API),
+		endpoints: make(map[string]models.Endpoint),
+		specs:     make(map[string]models.ImportedSpec),
+		reports:   make(map[string]models.DriftReport),
+	}
+}
+
+func (r *memoryInventoryRepository) GetAPIs(ctx context.Context, page, limit int) (*models.APIInventory, error) {
+	return &models.APIInventory{}, nil
+}
+
+func (r *memoryInventoryRepository) GetAPI(ctx context.Context, apiID string) (*models.API, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	api, ok := r.apis[apiID]
+	if !ok {
+		return nil, fmt.Errorf("API not found: %s", apiID)
+	}
+	return &api, nil
+}
+
+func (r *memoryInventoryRepository) CreateAPI(ctx context.Context, api *models.API) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.apis[api.ID] = *api
+	return nil
+}
+
+func (r *memoryInventoryRepository) UpdateAPI(ctx context.Context, api *models.API) error {
+	return r.CreateAPI(ctx, api)
+}
+
+func (r *memoryInventoryRepository) DeleteAPI(ctx context.Context, apiID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.apis, apiID)
+	return nil
+}
+
+func (r *memoryInventoryRepository) GetAPIDetails(ctx context.Context, apiID string) (*models.APIDetails, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (r *memoryInventoryRepository) GetAPIStatistics(ctx context.Context) (*models.APIStatistics, error) {
+	return &models.APIStatistics{}, nil
+}
+
+func (r *memoryInventoryRepository) SearchAPIs(ctx context.Context, query string, page, limit int) (*models.APIInventory, error) {
+	return &models.APIInventory{}, nil
+}
+
+func (r *memoryInventoryRepository) GetAPIsByTags(ctx context.Context, tags []string, page, limit int) (*models.APIInventory, error) {
+	return &models.APIInventory{}, nil
+}
+
+func (r *memoryInventoryRepository) GetAPIsByStatus(ctx context.Context, status string, page, limit int) (*models.APIInventory, error) {
+	return &models.APIInventory{}, nil
+}
+
+func (r *memoryInventoryRepository) CreateEndpoint(ctx context.Context, endpoint *models.Endpoint) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.endpoints[endpoint.ID] = *endpoint
+	return nil
+}
+
+func (r *memoryInventoryRepository) UpdateEndpoint(ctx context.Context, endpoint *models.Endpoint) error {
+	return nil
+}
+
+func (r *memoryInventoryRepository) GetEndpoint(ctx context.Context, endpointID string) (*models.Endpoint, error) {
+	return nil, fmt.Errorf("endpoint not found: %s", endpointID)
+}
+
+func (r *memoryInventoryRepository) GetEndpoints(ctx context.Context, page, limit int) ([]models.Endpoint, error) {
+	return nil, nil
+}
+
+func (r *memoryInventoryRepository) DeleteEndpoint(ctx context.Context, endpointID string) error {
+	return nil
+}
+
+func (r *memoryInventoryRepository) GetEndpointsByTrafficState(ctx context.Context, state string, page, limit int) (*models.EndpointInventory, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	inventory := &models.EndpointInventory{TrafficState: state, Page: page, Limit: limit}
+	for _, endpoint := range r.endpoints {
+		if endpoint.TrafficState == state {
+			inventory.Endpoints = append(inventory.Endpoints, endpoint)
+		}
+	}
+	sort.Slice(inventory.Endpoints, func(i, j int) bool { return inventory.Endpoints[i].Path < inventory.Endpoints[j].Path })
+	inventory.Total = len(inventory.Endpoints)
+	return inventory, nil
+}
+
+func (r *memoryInventoryRepository) GetEndpointTraffic(ctx context.Context) ([]models.EndpointTraffic, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var traffic []models.EndpointTraffic
+	for _, endpoint := range r.endpoints {
+		traffic = append(traffic, models.EndpointTraffic{
+			EndpointID:    endpoint.ID,
+			APIID:         endpoint.APIID,
+			APILifecycle:  r.apis[endpoint.APIID].Lifecycle,
+			TrafficState:  endpoint.TrafficState,
+			LastTrafficAt: endpoint.LastTrafficAt,
+			CreatedAt:     endpoint.CreatedAt,
+		})
+	}
+	return traffic, nil
+}
+
+func (r *memoryInventoryRepository) UpdateEndpointTrafficState(ctx context.Context, endpointID string, state string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	endpoint, ok := r.endpoints[endpointID]
+	if !ok {
+		return fmt.Errorf("endpoint not found: %s", endpointID)
+	}
+	endpoint.TrafficState = state
+	r.endpoints[endpointID] = endpoint
+	return nil
+}
+
+func (r *memoryInventoryRepository) SaveImportedSpec(ctx context.Context, imported *models.ImportedSpec) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.specs[imported.APIID] = *imported
+	return nil
+}
+
+func (r *memoryInventoryRepository) GetImportedSpec(ctx context.Context, apiID string) (*models.ImportedSpec, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	imported, ok := r.specs[apiID]
+	if !ok {
+		return nil, fmt.Errorf("no spec imported for API: %s", apiID)
+	}
+	return &imported, nil
+}
+
+func (r *memoryInventoryRepository) GetImportedSpecs(ctx context.Context) ([]models.ImportedSpec, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var specs []models.ImportedSpec
+	for _, imported := range r.specs {
+		specs = append(specs, imported)
+	}
+	return specs, nil
+}
+
+func (r *memoryInventoryRepository) SaveDriftReport(ctx context.Context, report *models.DriftReport) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reports[report.APIID] = *report
+	return nil
+}
+
+func (r *memoryInventoryRepository) GetDriftReport(ctx context.Context, apiID string) (*models.DriftReport, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	report, ok := r.reports[apiID]
+	if !ok {
+		return nil, nil
+	}
+	return &report, nil
+}
@@ -0,0 +1,552 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+)
+
+const (
+	// maxSchemaBodyBytes is the largest body parsed for schema learning
+	maxSchemaBodyBytes = 1 << 20
+	// maxSchemaDepth bounds how deeply nested values are learned
+	maxSchemaDepth = 16
+	// maxSchemaProperties bounds the properties learned per object
+	maxSchemaProperties = 200
+	// maxSchemaArrayItems bounds the elements of one array that are learned
+	maxSchemaArrayItems = 100
+	// maxTrackedValues is how many distinct strings are counted per field
+	// before it is considered free-form
+	maxTrackedValues = 20
+	// maxTrackedValueLength is the longest string counted as an enum candidate
+	maxTrackedValueLength = 64
+	// maxSchemaEnum is the most values a learned enum may have
+	maxSchemaEnum = 10
+	// minEnumSamples is how many strings must be seen before an enum is inferred
+	minEnumSamples = 10
+)
+
+var emailValue = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// schemaNode accumulates what was seen at one position of many JSON bodies.
+// It is serialised as the learner state of a stored schema version, so that
+// learning resumes where it stopped after a restart.
+type schemaNode struct {
+	Samples    int64                  `json:"samples"`
+	Types      map[string]int64       `json:"types,omitempty"`
+	Objects    int64                  `json:"objects,omitempty"`
+	Properties map[string]*schemaNode `json:"properties,omitempty"`
+	Items      *schemaNode            `json:"items,omitempty"`
+	MinItems   *int                   `json:"min_items,omitempty"`
+	MaxItems   *int                   `json:"max_items,omitempty"`
+	Strings    int64                  `json:"strings,omitempty"`
+	Formats    map[string]int64       `json:"formats,omitempty"`
+	Values     map[string]int64       `json:"values,omitempty"`
+	ManyValues bool                   `json:"many_values,omitempty"`
+	MinLength  *int                   `json:"min_length,omitempty"`
+	MaxLength  *int                   `json:"max_length,omitempty"`
+	Minimum    *float64               `json:"minimum,omitempty"`
+	Maximum    *float64               `json:"maximum,omitempty"`
+}
+
+func newSchemaNode() *schemaNode {
+	return &schemaNode{Types: make(map[string]int64)}
+}
+
+// observe adds one value decoded with json.Decoder.UseNumber
+func (n *schemaNode) observe(value interface{}, depth int) {
+	n.Samples++
+	switch v := value.(type) {
+	case nil:
+		n.Types["null"]++
+	case bool:
+		n.Types["boolean"]++
+	case json.Number:
+		n.observeNumber(v)
+	case string:
+		n.Types["string"]++
+		n.observeString(v)
+	case []interface{}:
+		n.Types["array"]++
+		n.MinItems, n.MaxItems = widenInt(n.MinItems, n.MaxItems, len(v))
+		if depth >= maxSchemaDepth {
+			return
+		}
+		if n.Items == nil {
+			n.Items = newSchemaNode()
+		}
+		for i, item := range v {
+			if i >= maxSchemaArrayItems {
+				break
+			}
+			n.Items.observe(item, depth+1)
+		}
+	case map[string]interface{}:
+		n.Types["object"]++
+		n.Objects++
+		if depth >= maxSchemaDepth {
+			return
+		}
+		if n.Properties == nil {
+			n.Properties = make(map[string]*schemaNode)
+		}
+		for key, property := range v {
+			child, ok := n.Properties[key]
+			if !ok {
+				if len(n.Properties) >= maxSchemaProperties {
+					continue
+				}
+				child = newSchemaNode()
+				n.Properties[key] = child
+			}
+			child.observe(property, depth+1)
+		}
+	}
+}
+
+func (n *schemaNode) observeNumber(number json.Number) {
+	text := number.String()
+	if strings.ContainsAny(text, ".eE") {
+		n.Types["number"]++
+	} else {
+		n.Types["integer"]++
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return
+	}
+	if n.Minimum == nil || value < *n.Minimum {
+		n.Minimum = &value
+	}
+	if n.Maximum == nil || value > *n.Maximum {
+		maximum := value
+		n.Maximum = &maximum
+	}
+}
+
+func (n *schemaNode) observeString(value string) {
+	n.Strings++
+	n.MinLength, n.MaxLength = widenInt(n.MinLength, n.MaxLength, len([]rune(value)))
+	if format := stringFormat(value); format != "" {
+		if n.Formats == nil {
+			n.Formats = make(map[string]int64)
+		}
+		n.Formats[format]++
+	}
+
+	if n.ManyValues {
+		return
+	}
+	if len(value) > maxTrackedValueLength {
+		n.ManyValues, n.Values = true, nil
+		return
+	}
+	if n.Values == nil {
+		n.Values = make(map[string]int64)
+	}
+	if _, ok := n.Values[value]; !ok && len(n.Values) >= maxTrackedValues {
+		n.ManyValues, n.Values = true, nil
+		return
+	}
+	n.Values[value]++
+}
+
+// merge folds the statistics of other into n
+func (n *schemaNode) merge(other *schemaNode) {
+	if other == nil {
+		return
+	}
+	n.Samples += other.Samples
+	n.Objects += other.Objects
+	n.Strings += other.Strings
+	for name, count := range other.Types {
+		n.Types[name] += count
+	}
+	if other.Properties != nil {
+		if n.Properties == nil {
+			n.Properties = make(map[string]*schemaNode)
+		}
+		for key, property := range other.Properties {
+			child, ok := n.Properties[key]
+			if !ok {
+				if len(n.Properties) >= maxSchemaProperties {
+					continue
+				}
+				child = newSchemaNode()
+				n.Properties[key] = child
+			}
+			child.merge(property)
+		}
+	}
+	if other.Items != nil {
+		if n.Items == nil {
+			n.Items = newSchemaNode()
+		}
+		n.Items.merge(other.Items)
+	}
+	if other.MinItems != nil {
+		n.MinItems, n.MaxItems = widenInt(n.MinItems, n.MaxItems, *other.MinItems)
+		n.MinItems, n.MaxItems = widenInt(n.MinItems, n.MaxItems, *other.MaxItems)
+	}
+	if other.MinLength != nil {
+		n.MinLength, n.MaxLength = widenInt(n.MinLength, n.MaxLength, *other.MinLength)
+		n.MinLength, n.MaxLength = widenInt(n.MinLength, n.MaxLength, *other.MaxLength)
+	}
+	if other.Minimum != nil && (n.Minimum == nil || *other.Minimum < *n.Minimum) {
+		minimum := *other.Minimum
+		n.Minimum = &minimum
+	}
+	if other.Maximum != nil && (n.Maximum == nil || *other.Maximum > *n.Maximum) {
+		maximum := *other.Maximum
+		n.Maximum = &maximum
+	}
+	for format, count := range other.Formats {
+		if n.Formats == nil {
+			n.Formats = make(map[string]int64)
+		}
+		n.Formats[format] += count
+	}
+
+	if n.ManyValues || other.ManyValues {
+		n.ManyValues, n.Values = true, nil
+		return
+	}
+	for value, count := range other.Values {
+		if n.Values == nil {
+			n.Values = make(map[string]int64)
+		}
+		n.Values[value] += count
+	}
+	if len(n.Values) > maxTrackedValues {
+		n.ManyValues, n.Values = true, nil
+	}
+}
+
+// render turns the statistics into a JSON Schema. Without bounds, the value
+// ranges and lengths are left out, which is what fingerprints compare.
+func (n *schemaNode) render(bounds bool) *models.Schema {
+	var types []string
+	for name := range n.Types {
+		if name != "null" {
+			types = append(types, name)
+		}
+	}
+	// Integers seen alongside decimals are numbers
+	if n.Types["integer"] > 0 && n.Types["number"] > 0 {
+		filtered := types[:0]
+		for _, name := range types {
+			if name != "integer" {
+				filtered = append(filtered, name)
+			}
+		}
+		types = filtered
+	}
+	sort.Strings(types)
+	nullable := n.Types["null"] > 0
+
+	switch len(types) {
+	case 0:
+		return &models.Schema{Nullable: nullable}
+	case 1:
+		schema := n.renderType(types[0], bounds)
+		schema.Nullable = nullable
+		return schema
+	}
+	schema := &models.Schema{Nullable: nullable}
+	for _, name := range types {
+		schema.OneOf = append(schema.OneOf, n.renderType(name, bounds))
+	}
+	return schema
+}
+
+func (n *schemaNode) renderType(name string, bounds bool) *models.Schema {
+	schema := &models.Schema{Type: name}
+	switch name {
+	case "object":
+		schema.Properties = make(map[string]*models.Schema, len(n.Properties))
+		for key, property := range n.Properties {
+			schema.Properties[key] = property.render(bounds)
+			// A property is required when every object seen carried it
+			if property.Samples >= n.Objects {
+				schema.Required = append(schema.Required, key)
+			}
+		}
+		sort.Strings(schema.Required)
+	case "array":
+		if n.Items != nil && n.Items.Samples > 0 {
+			schema.Items = n.Items.render(bounds)
+		}
+		if bounds {
+			schema.MinItems, schema.MaxItems = copyInt(n.MinItems), copyInt(n.MaxItems)
+		}
+	case "string":
+		for format, count := range n.Formats {
+			if count == n.Strings {
+				schema.Format = format
+			}
+		}
+		if schema.Format == "" && !n.ManyValues && n.Strings >= minEnumSamples &&
+			len(n.Values) <= maxSchemaEnum && int64(len(n.Values))*3 <= n.Strings {
+			values := make([]string, 0, len(n.Values))
+			for value := range n.Values {
+				values = append(values, value)
+			}
+			sort.Strings(values)
+			for _, value := range values {
+				schema.Enum = append(schema.Enum, value)
+			}
+		}
+		if bounds {
+			schema.MinLength, schema.MaxLength = copyInt(n.MinLength), copyInt(n.MaxLength)
+		}
+	case "integer", "number":
+		if bounds {
+			schema.Minimum, schema.Maximum = copyFloat(n.Minimum), copyFloat(n.Maximum)
+		}
+	}
+	return schema
+}
+
+// endpointSchemaLearner learns the request schema and one response schema per
+// status code of an endpoint
+type endpointSchemaLearner struct {
+	Request   *schemaNode            `json:"request,omitempty"`
+	Responses map[string]*schemaNode `json:"responses,omitempty"`
+}
+
+func newEndpointSchemaLearner() *endpointSchemaLearner {
+	return &endpointSchemaLearner{Responses: make(map[string]*schemaNode)}
+}
+
+// observe adds decoded bodies; a missing body is passed as noBody
+func (l *endpointSchemaLearner) observe(request interface{}, status int, response interface{}) {
+	if request != noBody {
+		if l.Request == nil {
+			l.Request = newSchemaNode()
+		}
+		l.Request.observe(request, 0)
+	}
+	if response != noBody {
+		code := "default"
+		if status > 0 {
+			code = strconv.Itoa(status)
+		}
+		node, ok := l.Responses[code]
+		if !ok {
+			node = newSchemaNode()
+			l.Responses[code] = node
+		}
+		node.observe(response, 0)
+	}
+}
+
+func (l *endpointSchemaLearner) merge(other *endpointSchemaLearner) {
+	if other == nil {
+		return
+	}
+	if other.Request != nil {
+		if l.Request == nil {
+			l.Request = newSchemaNode()
+		}
+		l.Request.merge(other.Request)
+	}
+	for code, node := range other.Responses {
+		existing, ok := l.Responses[code]
+		if !ok {
+			existing = newSchemaNode()
+			l.Responses[code] = existing
+		}
+		existing.merge(node)
+	}
+}
+
+func (l *endpointSchemaLearner) samples() int64 {
+	var samples int64
+	if l.Request != nil {
+		samples += l.Request.Samples
+	}
+	for _, node := range l.Responses {
+		samples += node.Samples
+	}
+	return samples
+}
+
+// version renders the learned schemas as an unsaved schema version
+func (l *endpointSchemaLearner) version(endpointID, apiID string) (*models.EndpointSchema, error) {
+	state, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	schema := &models.EndpointSchema{
+		EndpointID:      endpointID,
+		APIID:           apiID,
+		ResponseSchemas: make(map[string]*models.Schema, len(l.Responses)),
+		SampleCount:     l.samples(),
+		State:           state,
+		CreatedAt:       time.Now(),
+	}
+	shape := struct {
+		Request   *models.Schema            `json:"request"`
+		Responses map[string]*models.Schema `json:"responses"`
+	}{Responses: make(map[string]*models.Schema, len(l.Responses))}
+
+	if l.Request != nil {
+		schema.RequestSchema = l.Request.render(true)
+		shape.Request = l.Request.render(false)
+	}
+	for code, node := range l.Responses {
+		schema.ResponseSchemas[code] = node.render(true)
+		shape.Responses[code] = node.render(false)
+	}
+
+	// encoding/json sorts map keys, so equal shapes give equal fingerprints
+	encoded, err := json.Marshal(shape)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(encoded)
+	schema.Fingerprint = hex.EncodeToString(sum[:])
+	return schema, nil
+}
+
+// restoreSchemaLearner rebuilds a learner from the state of a stored version
+func restoreSchemaLearner(stored *models.EndpointSchema) (*endpointSchemaLearner, error) {
+	learner := newEndpointSchemaLearner()
+	if len(stored.State) == 0 {
+		return learner, nil
+	}
+	if err := json.Unmarshal(stored.State, learner); err != nil {
+		return nil, err
+	}
+	if learner.Responses == nil {
+		learner.Responses = make(map[string]*schemaNode)
+	}
+	learner.Request.ensureTypes()
+	for _, node := range learner.Responses {
+		node.ensureTypes()
+	}
+	return learner, nil
+}
+
+// ensureTypes restores the maps omitted from empty serialised nodes
+func (n *schemaNode) ensureTypes() {
+	if n == nil {
+		return
+	}
+	if n.Types == nil {
+		n.Types = make(map[string]int64)
+	}
+	for _, child := range n.Properties {
+		child.ensureTypes()
+	}
+	n.Items.ensureTypes()
+}
+
+// noBody marks a request or response without a JSON body
+var noBody interface{} = struct{}{}
+
+// decodeJSONBody decodes a body for schema learning, returning noBody when it
+// is missing, truncated, too large or not JSON
+func decodeJSONBody(text, format, contentType string, truncated bool) interface{} {
+	if text == "" || truncated || len(text) > maxSchemaBodyBytes {
+		return noBody
+	}
+	media := contentMediaType(contentType)
+	if format != "json" && !(format == "" && isJSONMediaType(media)) {
+		return noBody
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return noBody
+	}
+	// Trailing data means the body was not a single JSON document
+	if decoder.More() {
+		return noBody
+	}
+	return value
+}
+
+func isJSONMediaType(media string) bool {
+	if strings.HasSuffix(media, "ndjson") || strings.HasSuffix(media, "jsonl") || strings.HasSuffix(media, "json-seq") {
+		return false
+	}
+	return media == "application/json" || strings.HasSuffix(media, "+json")
+}
+
+// stringFormat returns the JSON Schema format a string value has, if any
+func stringFormat(value string) string {
+	switch {
+	case uuidSegment.MatchString(value):
+		return "uuid"
+	case len(value) >= 20 && isDateTime(value):
+		return "date-time"
+	case len(value) == 10 && isDate(value):
+		return "date"
+	case emailValue.MatchString(value):
+		return "email"
+	case strings.Count(value, ".") == 3 && net.ParseIP(value) != nil:
+		return "ipv4"
+	case strings.Contains(value, "://"):
+		if parsed, err := url.Parse(value); err == nil && parsed.Scheme != "" && parsed.Host != "" {
+			return "uri"
+		}
+	}
+	return ""
+}
+
+func isDateTime(value string) bool {
+	_, err := time.Parse(time.RFC3339Nano, value)
+	return err == nil
+}
+
+func isDate(value string) bool {
+	_, err := time.Parse("2006-01-02", value)
+	return err == nil
+}
+
+func widenInt(minimum, maximum *int, value int) (*int, *int) {
+	if minimum == nil || value < *minimum {
+		v := value
+		minimum = &v
+	}
+	if maximum == nil || value > *maximum {
+		v := value
+		maximum = &v
+	}
+	return minimum, maximum
+}
+
+func copyInt(value *int) *int {
+	if value == nil {
+		return nil
+	}
+	v := *value
+	return &v
+}
+
+func copyFloat(value *float64) *float64 {
+	if value == nil {
+		return nil
+	}
+	v := *value
+	return &v
+}
+
+// schemaUpdate is a learned schema version waiting to be saved, with what to
+// roll the observation back to if saving fails
+type schemaUpdate struct {
+	schema              *models.EndpointSchema
+	previousFingerprint string
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+func learnBodies(t *testing.T, node *schemaNode, bodies ...string) {
+	t.Helper()
+	for _, body := range bodies {
+		value := decodeJSONBody(body, "json", "", false)
+		if value == noBody {
+			t.Fatalf("could not decode %s", body)
+		}
+		node.observe(value, 0)
+	}
+}
+
+func TestSchemaLearning(t *testing.T) {
+	node := newSchemaNode()
+	for i := 0; i < 12; i++ {
+		status := []string{"active", "suspended"}[i%2]
+		learnBodies(t, node, fmt.Sprintf(
+			`{"id":"6fa459ea-ee8a-3ca4-894e-db77e160355%d","email":"user%d@example.com","status":%q,"age":%d,"created":"2026-01-0%dT10:00:00Z","tags":["a"],"score":%s}`,
+			i%10, i, status, 20+i, 1+i%9, []string{"1", "2.5", "null", `"n/a"`}[i%4]))
+	}
+	learnBodies(t, node, `{"id":"6fa459ea-ee8a-3ca4-894e-db77e1603550","email":"x@example.com","status":"active","age":18,"created":"2026-01-01T10:00:00Z","tags":[],"score":1,"nickname":"bob"}`)
+
+	schema := node.render(true)
+	if schema.Type != "object" {
+		t.Fatalf("type = %q", schema.Type)
+	}
+	if fmt.Sprint(schema.Required) != "[age created email id score status tags]" {
+		t.Errorf("required = %v", schema.Required)
+	}
+	properties := schema.Properties
+	if properties["id"].Format != "uuid" || properties["email"].Format != "email" || properties["created"].Format != "date-time" {
+		t.Errorf("formats = %q %q %q", properties["id"].Format, properties["email"].Format, properties["created"].Format)
+	}
+	if fmt.Sprint(properties["status"].Enum) != "[active suspended]" {
+		t.Errorf("status enum = %v", properties["status"].Enum)
+	}
+	if properties["email"].Enum != nil || properties["nickname"].Enum != nil {
+		t.Errorf("unexpected enums")
+	}
+	if age := properties["age"]; age.Type != "integer" || *age.Minimum != 18 || *age.Maximum != 31 {
+		t.Errorf("age = %+v", age)
+	}
+	score := properties["score"]
+	if !score.Nullable || len(score.OneOf) != 2 || score.OneOf[0].Type != "number" || score.OneOf[1].Type != "string" {
+		t.Errorf("score = %+v", score)
+	}
+	if tags := properties["tags"]; tags.Type != "array" || tags.Items.Type != "string" || *tags.MinItems != 0 || *tags.MaxItems != 1 {
+		t.Errorf("tags = %+v", tags)
+	}
+
+	// Merging the learner state gives the same schema
+	merged := newSchemaNode()
+	merged.merge(node)
+	if a, b := schemaToMap(merged.render(true)), schemaToMap(schema); fmt.Sprint(a) != fmt.Sprint(b) {
+		t.Errorf("merged schema = %v, want %v", a, b)
+	}
+
+	if decodeJSONBody(`{"a":1}`, "", "application/x-ndjson", false) != noBody ||
+		decodeJSONBody(`{"a":`, "json", "", false) != noBody ||
+		decodeJSONBody(`{"a":1}`, "json", "", true) != noBody {
+		t.Errorf("expected bodies to be skipped")
+	}
+	if decodeJSONBody(`{"a":1}`, "", "application/vnd.api+json", false) == noBody {
+		t.Errorf("expected a +json body to be decoded")
+	}
+}
+
+func TestSchemaVersionsFromTraffic(t *testing.T) {
+	repo := newMemoryDiscoveryRepository()
+	newService := func() *DiscoveryService {
+		return &DiscoveryService{repo: repo, logger: logging.NewStructuredLogger("test"), observer: newTrafficObserver(NewPathInferenceEngine())}
+	}
+	service := newService()
+	ctx := context.Background()
+	record := func(request, response string) []byte {
+		return []byte(fmt.Sprintf(`{"id":"1","method":"POST","url":"https://shop.example.com/orders","status_code":201,`+
+			`"body_text":%q,"body_format":"json","response_text":%q,"response_headers":{"Content-Type":"application/json"}}`, request, response))
+	}
+
+	service.ObserveTraffic(ctx, record(`{"sku":"a1","quantity":2}`, `{"id":10}`))
+	service.flushObservations(ctx, "", nil)
+	service.ObserveTraffic(ctx, record(`{"sku":"b2","quantity":5}`, `{"id":11}`))
+	service.flushObservations(ctx, "", nil)
+	if len(repo.schemas) != 1 {
+		t.Fatalf("versions = %d, want 1 as the structure did not change", len(repo.schemas))
+	}
+	first := repo.schemas[0]
+	if first.Version != 1 || first.RequestSchema.Properties["quantity"].Type != "integer" || first.ResponseSchemas["201"] == nil {
+		t.Fatalf("first version = %+v", first)
+	}
+
+	service.ObserveTraffic(ctx, record(`{"sku":"c3","quantity":1,"note":"gift"}`, `{"id":12}`))
+	service.flushObservations(ctx, "", nil)
+	latest, _ := repo.GetLatestEndpointSchema(ctx, first.EndpointID)
+	if latest.Version != 2 || fmt.Sprint(latest.RequestSchema.Required) != "[quantity sku]" || latest.SampleCount != 6 {
+		t.Fatalf("second version = %+v", latest)
+	}
+
+	// A restarted service continues from the stored learner state
+	restarted := newService()
+	restarted.ObserveTraffic(ctx, record(`{"sku":"d4","quantity":1.5}`, `{"id":13}`))
+	restarted.flushObservations(ctx, "", nil)
+	latest, _ = repo.GetLatestEndpointSchema(ctx, first.EndpointID)
+	if latest.Version != 3 || latest.SampleCount != 8 || latest.RequestSchema.Properties["quantity"].Type != "number" {
+		t.Fatalf("third version = %+v", latest)
+	}
+	if required := fmt.Sprint(latest.RequestSchema.Required); required != "[quantity sku]" {
+		t.Errorf("required after restart = %s", required)
+	}
+}
+
+func TestGenerateAPISpecUsesLearnedSchemas(t *testing.T) {
+	repo := newMemoryDiscoveryRepository()
+	service := NewMetadataService(repo, NewPathInferenceEngine(), nil, logging.NewStructuredLogger("test")).(*MetadataService)
+	ctx := context.Background()
+
+	repo.endpoints["ep-1"] = models.Endpoint{ID: "ep-1", APIID: "api", Path: "/orders/12", Method: "GET"}
+	repo.schemas = append(repo.schemas, models.EndpointSchema{
+		ID: "s-1", EndpointID: "ep-1", APIID: "api", Version: 1,
+		ResponseSchemas: map[string]*models.Schema{
+			"200": {Type: "object", Properties: map[string]*models.Schema{"id": {Type: "integer"}}},
+			"404": {Type: "object", Properties: map[string]*models.Schema{"error": {Type: "string"}}},
+		},
+	})
+
+	spec, err := service.GenerateAPISpec(ctx, "api")
+	if err != nil {
+		t.Fatalf("GenerateAPISpec: %v", err)
+	}
+	operation := spec.Paths["/orders/{orderId}"].Get
+	if ref := operation.Responses["200"].Schema["$ref"]; ref != "#/components/schemas/GetOrdersResponse" {
+		t.Errorf("200 ref = %v", ref)
+	}
+	if ref := operation.Responses["404"].Schema["$ref"]; ref != "#/components/schemas/GetOrdersResponse404" {
+		t.Errorf("404 ref = %v", ref)
+	}
+	if schema := spec.Components.Schemas["GetOrdersResponse"]; schema == nil || schema.Properties["id"].Type != "integer" {
+		t.Errorf("components = %+v", spec.Components.Schemas)
+	}
+
+	repo.metadata = map[string]*models.Metadata{}
+	metadata, err := service.ExtractMetadata(ctx, &models.Endpoint{ID: "ep-1", APIID: "api", Path: "/orders/12", Method: "GET"})
+	if err != nil {
+		t.Fatalf("ExtractMetadata: %v", err)
+	}
+	if response, ok := metadata.ResponseSchema["200"].(map[string]interface{}); !ok || response["type"] != "object" {
+		t.Errorf("metadata response schema = %v", metadata.ResponseSchema)
+	}
+}
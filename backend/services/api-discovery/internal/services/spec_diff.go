@@ -0,0 +1,638 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+	"scopeapi.local/backend/services/api-discovery/internal/repository"
+	"scopeapi.local/backend/shared/messaging/kafka"
+)
+
+// Spec change types. Whether a change is breaking depends on the type and,
+// for type and enum changes, on whether the schema describes a request or a
+// response.
+const (
+	changeEndpointAdded          = "endpoint_added"
+	changeEndpointRemoved        = "endpoint_removed"
+	changeParameterAdded         = "parameter_added"
+	changeRequiredParameterAdded = "required_parameter_added"
+	changeParameterRemoved       = "parameter_removed"
+	changeParameterMadeRequired  = "parameter_made_required"
+	changeParameterMadeOptional  = "parameter_made_optional"
+	changeRequestBodyAdded       = "request_body_added"
+	changeRequestBodyRequired    = "request_body_made_required"
+	changePropertyAdded          = "property_added"
+	changeRequiredPropertyAdded  = "required_property_added"
+	changePropertyRemoved        = "property_removed"
+	changePropertyMadeRequired   = "property_made_required"
+	changeResponseAdded          = "response_added"
+	changeResponseRemoved        = "response_removed"
+	changeResponseFieldAdded     = "response_field_added"
+	changeResponseFieldRemoved   = "response_field_removed"
+	changeResponseFieldOptional  = "response_field_made_optional"
+	changeTypeNarrowed           = "type_narrowed"
+	changeTypeWidened            = "type_widened"
+	changeTypeChanged            = "type_changed"
+	changeEnumNarrowed           = "enum_narrowed"
+	changeEnumWidened            = "enum_widened"
+	changeEnumChanged            = "enum_changed"
+)
+
+// SpecChangesTopic receives an event for every spec version with breaking changes
+const SpecChangesTopic = "api_spec_changes"
+
+// maxSpecVersionAttempts bounds how often a spec version is renumbered when
+// a concurrent generation stored the same version number first
+const maxSpecVersionAttempts = 3
+
+// specChangeBatchSize is the number of pending spec change events published
+// at a time
+const specChangeBatchSize = 100
+
+// recordSpecVersion stores a generated spec as the API's next version unless
+// it matches the latest one. The breaking changes it introduces are stored
+// with the version and published from there, so they are retried until Kafka
+// takes them.
+func (s *MetadataService) recordSpecVersion(ctx context.Context, spec *models.APISpec) error {
+	fingerprint, err := specFingerprint(spec)
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint API spec: %w", err)
+	}
+
+	var event *models.SpecChangeEvent
+	for attempt := 1; ; attempt++ {
+		latest, err := s.repo.GetLatestAPISpecVersion(ctx, spec.APIID)
+		if err != nil {
+			return fmt.Errorf("failed to get latest API spec version: %w", err)
+		}
+		if latest != nil && latest.Fingerprint == fingerprint {
+			return nil
+		}
+
+		version := &models.APISpecVersion{
+			ID:          uuid.New().String(),
+			APIID:       spec.APIID,
+			Version:     1,
+			Spec:        spec,
+			Fingerprint: fingerprint,
+			CreatedAt:   spec.CreatedAt,
+		}
+		event = nil
+		if latest != nil {
+			version.Version = latest.Version + 1
+			changes := diffSpecs(latest.Spec, spec)
+			version.Changes = summarizeSpecChanges(changes)
+			event = breakingChangeEvent(latest.Version, version, changes)
+		}
+
+		err = s.repo.SaveAPISpecVersion(ctx, version, event)
+		if errors.Is(err, repository.ErrSpecVersionConflict) && attempt < maxSpecVersionAttempts {
+			// Diff against the version that won instead
+			s.logger.Info("API spec version taken by a concurrent generation, retrying", "api_id", spec.APIID, "version", version.Version)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save API spec version: %w", err)
+		}
+
+		s.logger.Info("API spec version recorded", "api_id", spec.APIID, "version", version.Version,
+			"breaking_changes", version.Changes.Breaking, "non_breaking_changes", version.Changes.NonBreaking)
+		break
+	}
+
+	if event == nil {
+		return nil
+	}
+	if err := s.publishSpecChanges(ctx); err != nil {
+		s.logger.Error("Failed to publish breaking spec changes, will retry", "error", err, "api_id", spec.APIID)
+	}
+	return nil
+}
+
+// breakingChangeEvent builds the event for the breaking changes of a new spec
+// version, or returns nil when it has none
+func breakingChangeEvent(fromVersion int, version *models.APISpecVersion, changes []models.SpecChange) *models.SpecChangeEvent {
+	if version.Changes.Breaking == 0 {
+		return nil
+	}
+
+	event := &models.SpecChangeEvent{
+		EventType:   "api_spec.breaking_change",
+		APIID:       version.APIID,
+		FromVersion: fromVersion,
+		ToVersion:   version.Version,
+		Timestamp:   version.CreatedAt,
+	}
+	for _, change := range changes {
+		if change.Breaking {
+			event.Changes = append(event.Changes, change)
+		}
+	}
+	return event
+}
+
+// PublishPendingSpecChanges retries publishing the spec change events Kafka
+// did not take at each interval until ctx is done
+func (s *MetadataService) PublishPendingSpecChanges(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.publishSpecChanges(ctx); err != nil {
+				s.logger.Error("Failed to publish pending spec changes", "error", err)
+			}
+		}
+	}
+}
+
+// publishSpecChanges sends the pending spec change events to SpecChangesTopic,
+// oldest first and keyed by API so an API's events stay in order. It stops at
+// the first event that fails, which stays pending with the ones after it.
+func (s *MetadataService) publishSpecChanges(ctx context.Context) error {
+	s.publishMutex.Lock()
+	defer s.publishMutex.Unlock()
+
+	if s.kafkaProducer == nil {
+		s.logger.Warn("Kafka producer not configured, breaking spec changes not published")
+		return nil
+	}
+
+	for {
+		pending, err := s.repo.GetPendingSpecChanges(ctx, specChangeBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to get pending spec changes: %w", err)
+		}
+
+		for _, change := range pending {
+			value, err := json.Marshal(change.Event)
+			if err != nil {
+				return fmt.Errorf("failed to marshal spec change event: %w", err)
+			}
+
+			message := kafka.Message{
+				Topic: SpecChangesTopic,
+				Key:   []byte(change.Event.APIID),
+				Value: value,
+			}
+			if err := s.kafkaProducer.Produce(ctx, message); err != nil {
+				if recordErr := s.repo.RecordSpecChangeFailure(ctx, change.VersionID, err.Error()); recordErr != nil {
+					s.logger.Warn("Failed to record spec change failure", "error", recordErr, "version_id", change.VersionID)
+				}
+				return fmt.Errorf("failed to publish spec change of %s version %d: %w", change.Event.APIID, change.Event.ToVersion, err)
+			}
+			if err := s.repo.MarkSpecChangePublished(ctx, change.VersionID); err != nil {
+				return err
+			}
+		}
+
+		if len(pending) < specChangeBatchSize {
+			return nil
+		}
+	}
+}
+
+// specFingerprint hashes the content of a spec, leaving out its ID and
+// timestamps, so regenerating an unchanged API gives the same fingerprint
+func specFingerprint(spec *models.APISpec) (string, error) {
+	content := *spec
+	content.ID = ""
+	content.CreatedAt, content.UpdatedAt = time.Time{}, time.Time{}
+	encoded, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func summarizeSpecChanges(changes []models.SpecChange) models.SpecDiffSummary {
+	var summary models.SpecDiffSummary
+	for _, change := range changes {
+		if change.Breaking {
+			summary.Breaking++
+		} else {
+			summary.NonBreaking++
+		}
+	}
+	return summary
+}
+
+// specOperation is an operation of a spec with the parameters of its path item
+type specOperation struct {
+	method     string
+	path       string
+	operation  *models.Operation
+	parameters []models.Parameter
+}
+
+// specOperations indexes the operations of a spec by method and path
+// template, ignoring the names of path parameters
+func specOperations(spec *models.APISpec) map[string]specOperation {
+	operations := make(map[string]specOperation)
+	if spec == nil {
+		return operations
+	}
+	for path, item := range spec.Paths {
+		if item == nil {
+			continue
+		}
+		shape := pathTemplateVariable.ReplaceAllString(path, "{}")
+		for _, operation := range pathOperations(item) {
+			method := strings.ToUpper(operation.method)
+			operations[method+" "+shape] = specOperation{
+				method:     method,
+				path:       path,
+				operation:  operation.operation,
+				parameters: append(append([]models.Parameter{}, item.Parameters...), operation.operation.Parameters...),
+			}
+		}
+	}
+	return operations
+}
+
+// diffSpecs lists the changes from one spec version to the next, by path and
+// method
+func diffSpecs(from, to *models.APISpec) []models.SpecChange {
+	before, after := specOperations(from), specOperations(to)
+	keys := make([]string, 0, len(before)+len(after))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pathI, pathJ := keys[i][strings.Index(keys[i], " ")+1:], keys[j][strings.Index(keys[j], " ")+1:]
+		if pathI != pathJ {
+			return pathI < pathJ
+		}
+		return keys[i] < keys[j]
+	})
+
+	var changes []models.SpecChange
+	for _, key := range keys {
+		old, hadOld := before[key]
+		current, hasCurrent := after[key]
+		switch {
+		case !hasCurrent:
+			changes = append(changes, models.SpecChange{Type: changeEndpointRemoved, Breaking: true, Method: old.method, Path: old.path})
+		case !hadOld:
+			changes = append(changes, models.SpecChange{Type: changeEndpointAdded, Method: current.method, Path: current.path})
+		default:
+			differ := &operationDiffer{from: from, to: to, method: current.method, path: current.path}
+			differ.diff(old, current)
+			changes = append(changes, differ.changes...)
+		}
+	}
+	return changes
+}
+
+// operationDiffer collects the changes between two versions of an operation
+type operationDiffer struct {
+	from, to *models.APISpec
+	method   string
+	path     string
+	changes  []models.SpecChange
+}
+
+func (d *operationDiffer) add(changeType string, breaking bool, location, before, after string) {
+	d.changes = append(d.changes, models.SpecChange{
+		Type:     changeType,
+		Breaking: breaking,
+		Method:   d.method,
+		Path:     d.path,
+		Location: location,
+		Before:   before,
+		After:    after,
+	})
+}
+
+func (d *operationDiffer) diff(old, current specOperation) {
+	d.diffParameters(old, current)
+	d.diffRequestBody(old, current)
+	d.diffResponses(old.operation.Responses, current.operation.Responses)
+}
+
+// diffParameters compares query, header, cookie and path parameters. Path
+// parameters are matched by position, as renaming them does not affect clients.
+func (d *operationDiffer) diffParameters(old, current specOperation) {
+	before, beforeKeys := indexParameters(old)
+	after, afterKeys := indexParameters(current)
+
+	for _, key := range afterKeys {
+		param := after[key]
+		location := param.In + ":" + param.Name
+		previous, ok := before[key]
+		if !ok {
+			if param.Required {
+				d.add(changeRequiredParameterAdded, true, location, "", "required")
+			} else {
+				d.add(changeParameterAdded, false, location, "", "optional")
+			}
+			continue
+		}
+		if param.Required && !previous.Required {
+			d.add(changeParameterMadeRequired, true, location, "optional", "required")
+		} else if !param.Required && previous.Required {
+			d.add(changeParameterMadeOptional, false, location, "required", "optional")
+		}
+		d.diffValue(location, parameterSchema(previous), parameterSchema(param), false)
+	}
+	for _, key := range beforeKeys {
+		if _, ok := after[key]; !ok {
+			param := before[key]
+			d.add(changeParameterRemoved, false, param.In+":"+param.Name, "", "")
+		}
+	}
+}
+
+// indexParameters keys the parameters of an operation, operation parameters
+// overriding those of its path item. Body fields recorded as parameters are
+// compared as the request body.
+func indexParameters(operation specOperation) (map[string]models.Parameter, []string) {
+	variables := make(map[string]int)
+	for i, match := range pathTemplateVariable.FindAllStringSubmatch(operation.path, -1) {
+		variables[match[1]] = i
+	}
+
+	params := make(map[string]models.Parameter)
+	var keys []string
+	for _, param := range operation.parameters {
+		var key string
+		switch param.In {
+		case "path":
+			position, ok := variables[param.Name]
+			if !ok {
+				continue
+			}
+			key = fmt.Sprintf("path:%d", position)
+			param.Required = true
+		case "header":
+			key = "header:" + strings.ToLower(param.Name)
+		case "query", "cookie":
+			key = param.In + ":" + param.Name
+		default:
+			continue
+		}
+		if _, ok := params[key]; !ok {
+			keys = append(keys, key)
+		}
+		params[key] = param
+	}
+	sort.Strings(keys)
+	return params, keys
+}
+
+// requestSchema returns the schema of an operation's request body, preferring
+// JSON, and whether the body is required
+func requestSchema(operation specOperation) (*models.Schema, bool, bool) {
+	if body := operation.operation.RequestBody; body != nil && len(body.Content) > 0 {
+		names := make([]string, 0, len(body.Content))
+		for name := range body.Content {
+			names = append(names, name)
+		}
+		return body.Content[preferredMediaType(names)].Schema, body.Required, true
+	}
+	var bodyParams []models.Parameter
+	for _, param := range operation.parameters {
+		if param.In == "body" {
+			bodyParams = append(bodyParams, param)
+		}
+	}
+	if len(bodyParams) > 0 {
+		return bodyParameterSchema(bodyParams), false, true
+	}
+	return nil, false, false
+}
+
+func (d *operationDiffer) diffRequestBody(old, current specOperation) {
+	before, wasRequired, hadBody := requestSchema(old)
+	after, required, hasBody := requestSchema(current)
+	switch {
+	case !hasBody:
+		return
+	case !hadBody:
+		d.add(changeRequestBodyAdded, required, "request", "", "")
+		return
+	case required && !wasRequired:
+		d.add(changeRequestBodyRequired, true, "request", "optional", "required")
+	}
+	d.diffSchema("request ", "$", before, after, false, 0)
+}
+
+func (d *operationDiffer) diffResponses(before, after map[string]models.Response) {
+	codes := make([]string, 0, len(before)+len(after))
+	for code := range before {
+		codes = append(codes, code)
+	}
+	for code := range after {
+		if _, ok := before[code]; !ok {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		old, hadOld := before[code]
+		current, hasCurrent := after[code]
+		switch {
+		case !hasCurrent:
+			// Clients rely on the success responses they handle
+			d.add(changeResponseRemoved, strings.HasPrefix(code, "2"), "response "+code, "", "")
+		case !hadOld:
+			d.add(changeResponseAdded, false, "response "+code, "", "")
+		case len(old.Schema) > 0 && len(current.Schema) > 0:
+			d.diffSchema("response "+code+" ", "$", schemaFromMap(old.Schema), schemaFromMap(current.Schema), true, 0)
+		}
+	}
+}
+
+// diffSchema compares two versions of a body schema. A request schema breaks
+// clients when it accepts less than before; a response schema when it may
+// return more, or drops fields clients read.
+func (d *operationDiffer) diffSchema(prefix, field string, before, after *models.Schema, response bool, depth int) {
+	before, after = resolveSchemaRef(d.from, before), resolveSchemaRef(d.to, after)
+	if before == nil || after == nil || depth > maxSchemaDepth {
+		return
+	}
+	location := prefix + field
+	if !d.diffValue(location, before, after, response) {
+		// The properties of a value whose type changed are not compared
+		return
+	}
+
+	wasRequired := make(map[string]bool, len(before.Required))
+	for _, name := range before.Required {
+		wasRequired[name] = true
+	}
+	required := make(map[string]bool, len(after.Required))
+	for _, name := range after.Required {
+		required[name] = true
+	}
+
+	names := make([]string, 0, len(before.Properties)+len(after.Properties))
+	for name := range before.Properties {
+		names = append(names, name)
+	}
+	for name := range after.Properties {
+		if _, ok := before.Properties[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property := field + "." + name
+		old, hadOld := before.Properties[name]
+		current, hasCurrent := after.Properties[name]
+		switch {
+		case !hasCurrent && response:
+			d.add(changeResponseFieldRemoved, true, prefix+property, "", "")
+		case !hasCurrent:
+			d.add(changePropertyRemoved, false, prefix+property, "", "")
+		case !hadOld && response:
+			d.add(changeResponseFieldAdded, false, prefix+property, "", "")
+		case !hadOld:
+			if required[name] {
+				d.add(changeRequiredPropertyAdded, true, prefix+property, "", "required")
+			} else {
+				d.add(changePropertyAdded, false, prefix+property, "", "optional")
+			}
+		default:
+			if response && wasRequired[name] && !required[name] {
+				d.add(changeResponseFieldOptional, true, prefix+property, "required", "optional")
+			} else if !response && required[name] && !wasRequired[name] {
+				d.add(changePropertyMadeRequired, true, prefix+property, "optional", "required")
+			}
+			d.diffSchema(prefix, property, old, current, response, depth+1)
+		}
+	}
+
+	if before.Items != nil && after.Items != nil {
+		d.diffSchema(prefix, field+"[]", before.Items, after.Items, response, depth+1)
+	}
+}
+
+// diffValue compares the types and enums two schemas allow, and reports
+// whether the types are still compatible enough to compare their contents
+func (d *operationDiffer) diffValue(location string, before, after *models.Schema, response bool) bool {
+	beforeTypes, afterTypes := acceptedTypes(d.from, before), acceptedTypes(d.to, after)
+	narrowed, widened := !typesCover(afterTypes, beforeTypes), !typesCover(beforeTypes, afterTypes)
+	beforeText, afterText := strings.Join(beforeTypes, "|"), strings.Join(afterTypes, "|")
+	switch {
+	case narrowed && widened:
+		d.add(changeTypeChanged, true, location, beforeText, afterText)
+		return false
+	case narrowed:
+		d.add(changeTypeNarrowed, !response, location, beforeText, afterText)
+	case widened:
+		d.add(changeTypeWidened, response, location, beforeText, afterText)
+	}
+
+	before, after = resolveSchemaRef(d.from, before), resolveSchemaRef(d.to, after)
+	if before == nil || after == nil {
+		return true
+	}
+	narrowed, widened = enumChange(before.Enum, after.Enum)
+	beforeText, afterText = enumText(before.Enum), enumText(after.Enum)
+	switch {
+	case narrowed && widened:
+		d.add(changeEnumChanged, true, location, beforeText, afterText)
+	case narrowed:
+		d.add(changeEnumNarrowed, !response, location, beforeText, afterText)
+	case widened:
+		d.add(changeEnumWidened, response, location, beforeText, afterText)
+	}
+	return true
+}
+
+// acceptedTypes lists the types a schema allows, including null when it is
+// nullable. An empty list allows any type.
+func acceptedTypes(spec *models.APISpec, schema *models.Schema) []string {
+	types := schemaTypes(spec, schema)
+	for _, name := range types {
+		if name == "" {
+			return nil
+		}
+	}
+	if resolved := resolveSchemaRef(spec, schema); resolved != nil && resolved.Nullable && len(types) > 0 {
+		types = append(types, "null")
+	}
+	sort.Strings(types)
+	return types
+}
+
+// typesCover reports whether every value of the covered types is also of the
+// covering types
+func typesCover(covering, covered []string) bool {
+	if len(covering) == 0 {
+		return true
+	}
+	if len(covered) == 0 {
+		return false
+	}
+	for _, name := range covered {
+		if !typeAllowed(covering, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// enumChange reports whether the values an enum allows shrank or grew. No
+// enum allows any value.
+func enumChange(before, after []interface{}) (narrowed, widened bool) {
+	if len(before) == 0 && len(after) == 0 {
+		return false, false
+	}
+	if len(before) == 0 {
+		return true, false
+	}
+	if len(after) == 0 {
+		return false, true
+	}
+	beforeValues, afterValues := enumValues(before), enumValues(after)
+	for value := range beforeValues {
+		if !afterValues[value] {
+			narrowed = true
+		}
+	}
+	for value := range afterValues {
+		if !beforeValues[value] {
+			widened = true
+		}
+	}
+	return narrowed, widened
+}
+
+func enumValues(enum []interface{}) map[string]bool {
+	values := make(map[string]bool, len(enum))
+	for _, value := range enum {
+		values[fmt.Sprint(value)] = true
+	}
+	return values
+}
+
+func enumText(enum []interface{}) string {
+	values := make([]string, 0, len(enum))
+	for value := range enumValues(enum) {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return strings.Join(values, "|")
+}
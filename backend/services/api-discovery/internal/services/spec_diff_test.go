@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+	"scopeapi.local/backend/shared/logging"
+	"scopeapi.local/backend/shared/messaging/kafka"
+)
+
+func TestDiffSpecs(t *testing.T) {
+	order := func(required []string, status *models.Schema, extra map[string]*models.Schema) map[string]interface{} {
+		properties := map[string]*models.Schema{"id": {Type: "integer"}, "status": status}
+		for name, schema := range extra {
+			properties[name] = schema
+		}
+		return schemaToMap(&models.Schema{Type: "object", Required: required, Properties: properties})
+	}
+	from := &models.APISpec{Paths: map[string]*models.PathItem{
+		"/orders/{orderId}": {
+			Parameters: []models.Parameter{{Name: "orderId", In: "path", Type: "integer", Required: true}},
+			Get: &models.Operation{
+				Parameters: []models.Parameter{{Name: "limit", In: "query", Type: "integer"}, {Name: "debug", In: "query", Type: "boolean"}},
+				Responses: map[string]models.Response{
+					"200": {Schema: order([]string{"id", "status"}, &models.Schema{Type: "string", Enum: []interface{}{"open", "shipped"}}, nil)},
+					"404": {},
+				},
+			},
+			Delete: &models.Operation{Responses: map[string]models.Response{"204": {}}},
+		},
+		"/orders": {Post: &models.Operation{
+			RequestBody: &models.RequestBody{Content: map[string]models.MediaType{"application/json": {Schema: &models.Schema{
+				Type: "object", Properties: map[string]*models.Schema{"sku": {Type: "string"}, "note": {Type: "string"}},
+			}}}},
+			Responses: map[string]models.Response{"201": {}},
+		}},
+	}}
+	to := &models.APISpec{Paths: map[string]*models.PathItem{
+		"/orders/{id}": {
+			Parameters: []models.Parameter{{Name: "id", In: "path", Type: "integer", Required: true}},
+			Get: &models.Operation{
+				Parameters: []models.Parameter{
+					{Name: "limit", In: "query", Type: "number"},
+					{Name: "debug", In: "query", Type: "string"},
+					{Name: "X-Tenant", In: "header", Type: "string", Required: true},
+				},
+				Responses: map[string]models.Response{
+					"200": {Schema: order([]string{"id"}, &models.Schema{Type: "string", Enum: []interface{}{"open", "shipped", "cancelled"}},
+						map[string]*models.Schema{"total": {Type: "number"}})},
+				},
+			},
+		},
+		"/orders": {Post: &models.Operation{
+			RequestBody: &models.RequestBody{Required: true, Content: map[string]models.MediaType{"application/json": {Schema: &models.Schema{
+				Type: "object", Required: []string{"sku", "quantity"},
+				Properties: map[string]*models.Schema{"sku": {Type: "string"}, "note": {Type: "integer"}, "quantity": {Type: "integer"}},
+			}}}},
+			Responses: map[string]models.Response{"201": {}},
+		}},
+		"/health": {Get: &models.Operation{Responses: map[string]models.Response{"200": {}}}},
+	}}
+
+	var got []string
+	for _, change := range diffSpecs(from, to) {
+		got = append(got, fmt.Sprintf("%s %s %s %s %v", change.Method, change.Path, change.Type, change.Location, change.Breaking))
+	}
+	want := []string{
+		"GET /health endpoint_added  false",
+		"POST /orders request_body_made_required request true",
+		"POST /orders type_changed request $.note true",
+		"POST /orders required_property_added request $.quantity true",
+		"POST /orders property_made_required request $.sku true",
+		"DELETE /orders/{orderId} endpoint_removed  true",
+		"GET /orders/{id} required_parameter_added header:X-Tenant true",
+		"GET /orders/{id} type_changed query:debug true",
+		"GET /orders/{id} type_widened query:limit false",
+		"GET /orders/{id} response_field_made_optional response 200 $.status true",
+		"GET /orders/{id} enum_widened response 200 $.status true",
+		"GET /orders/{id} response_field_added response 200 $.total false",
+		"GET /orders/{id} response_removed response 404 false",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("changes =\n%v\nwant\n%v", got, want)
+	}
+
+	if changes := diffSpecs(from, from); len(changes) != 0 {
+		t.Errorf("unchanged spec changes = %v", changes)
+	}
+}
+
+type recordingProducer struct {
+	messages []kafka.Message
+}
+
+func (p *recordingProducer) Produce(ctx context.Context, message kafka.Message) error {
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+func (p *recordingProducer) Close() error { return nil }
+
+func TestSpecVersions(t *testing.T) {
+	repo := newMemoryDiscoveryRepository()
+	producer := &recordingProducer{}
+	service := NewMetadataService(repo, NewPathInferenceEngine(), producer, logging.NewStructuredLogger("test"))
+	ctx := context.Background()
+
+	repo.endpoints["list"] = models.Endpoint{ID: "list", APIID: "api", Method: "GET", Path: "/orders", StatusCodes: []int{200}, Tags: []string{"orders", "shop"}}
+	repo.endpoints["delete"] = models.Endpoint{ID: "delete", APIID: "api", Method: "DELETE", Path: "/orders", StatusCodes: []int{204}}
+
+	if _, err := service.DiffSpecVersions(ctx, "api", 0, 0); !errors.Is(err, ErrSpecVersionNotFound) {
+		t.Fatalf("diff without versions error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := service.GenerateAPISpec(ctx, "api"); err != nil {
+			t.Fatalf("GenerateAPISpec: %v", err)
+		}
+	}
+	if versions, _ := service.GetSpecVersions(ctx, "api"); len(versions) != 1 {
+		t.Fatalf("unchanged spec stored %d versions", len(versions))
+	}
+
+	delete(repo.endpoints, "delete")
+	repo.endpoints["create"] = models.Endpoint{ID: "create", APIID: "api", Method: "POST", Path: "/orders", StatusCodes: []int{201}}
+	if _, err := service.GenerateAPISpec(ctx, "api"); err != nil {
+		t.Fatalf("GenerateAPISpec: %v", err)
+	}
+
+	versions, err := service.GetSpecVersions(ctx, "api")
+	if err != nil || len(versions) != 2 || versions[0].Version != 2 || versions[0].Spec != nil {
+		t.Fatalf("versions = %+v %v", versions, err)
+	}
+	if versions[0].Changes != (models.SpecDiffSummary{Breaking: 1, NonBreaking: 1}) {
+		t.Errorf("version 2 summary = %+v", versions[0].Changes)
+	}
+	if version, err := service.GetSpecVersion(ctx, "api", 1); err != nil || version.Spec == nil || version.Spec.Paths["/orders"].Delete == nil {
+		t.Errorf("version 1 = %+v %v", version, err)
+	}
+	if _, err := service.GetSpecVersion(ctx, "api", 3); !errors.Is(err, ErrSpecVersionNotFound) {
+		t.Errorf("missing version error = %v", err)
+	}
+
+	diff, err := service.DiffSpecVersions(ctx, "api", 0, 0)
+	if err != nil || diff.FromVersion != 1 || diff.ToVersion != 2 || len(diff.Changes) != 2 {
+		t.Fatalf("diff = %+v %v", diff, err)
+	}
+	if diff, _ := service.DiffSpecVersions(ctx, "api", 2, 1); diff.Summary.Breaking != 1 || diff.Changes[0].Type != changeEndpointAdded {
+		t.Errorf("reverse diff = %+v", diff)
+	}
+
+	if len(producer.messages) != 1 || producer.messages[0].Topic != SpecChangesTopic || string(producer.messages[0].Key) != "api" {
+		t.Fatalf("messages = %+v", producer.messages)
+	}
+	var event models.SpecChangeEvent
+	if err := json.Unmarshal(producer.messages[0].Value, &event); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	if event.FromVersion != 1 || event.ToVersion != 2 || len(event.Changes) != 1 || event.Changes[0].Type != changeEndpointRemoved {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+// failingProducer rejects messages until fail is cleared
+type failingProducer struct {
+	recordingProducer
+	fail bool
+}
+
+func (p *failingProducer) Produce(ctx context.Context, message kafka.Message) error {
+	if p.fail {
+		return errors.New("broker unavailable")
+	}
+	return p.recordingProducer.Produce(ctx, message)
+}
+
+func TestSpecChangesRetriedUntilPublished(t *testing.T) {
+	repo := newMemoryDiscoveryRepository()
+	producer := &failingProducer{fail: true}
+	service := NewMetadataService(repo, NewPathInferenceEngine(), producer, logging.NewStructuredLogger("test")).(*MetadataService)
+	ctx := context.Background()
+
+	repo.endpoints["list"] = models.Endpoint{ID: "list", APIID: "api", Method: "GET", Path: "/orders", StatusCodes: []int{200}}
+	repo.endpoints["delete"] = models.Endpoint{ID: "delete", APIID: "api", Method: "DELETE", Path: "/orders", StatusCodes: []int{204}}
+	if _, err := service.GenerateAPISpec(ctx, "api"); err != nil {
+		t.Fatalf("GenerateAPISpec: %v", err)
+	}
+	delete(repo.endpoints, "delete")
+	if _, err := service.GenerateAPISpec(ctx, "api"); err != nil {
+		t.Fatalf("GenerateAPISpec: %v", err)
+	}
+
+	pending, _ := repo.GetPendingSpecChanges(ctx, specChangeBatchSize)
+	if len(producer.messages) != 0 || len(pending) != 1 || pending[0].Attempts != 1 || pending[0].LastError == "" {
+		t.Fatalf("after failed publish messages = %d pending = %+v", len(producer.messages), pending)
+	}
+
+	producer.fail = false
+	if err := service.publishSpecChanges(ctx); err != nil {
+		t.Fatalf("publishSpecChanges: %v", err)
+	}
+	if err := service.publishSpecChanges(ctx); err != nil {
+		t.Fatalf("publishSpecChanges: %v", err)
+	}
+	if pending, _ := repo.GetPendingSpecChanges(ctx, specChangeBatchSize); len(producer.messages) != 1 || len(pending) != 0 {
+		t.Fatalf("after retry messages = %d pending = %+v", len(producer.messages), pending)
+	}
+}
+
+// staleLatestRepository returns no latest spec version once, as a concurrent
+// generation that read it before another stored a version would see
+type staleLatestRepository struct {
+	*memoryDiscoveryRepository
+	stale bool
+}
+
+func (r *staleLatestRepository) GetLatestAPISpecVersion(ctx context.Context, apiID string) (*models.APISpecVersion, error) {
+	if r.stale {
+		r.stale = false
+		return nil, nil
+	}
+	return r.memoryDiscoveryRepository.GetLatestAPISpecVersion(ctx, apiID)
+}
+
+func TestSpecVersionConflictRetried(t *testing.T) {
+	repo := &staleLatestRepository{memoryDiscoveryRepository: newMemoryDiscoveryRepository()}
+	producer := &recordingProducer{}
+	service := NewMetadataService(repo, NewPathInferenceEngine(), producer, logging.NewStructuredLogger("test"))
+	ctx := context.Background()
+
+	repo.endpoints["list"] = models.Endpoint{ID: "list", APIID: "api", Method: "GET", Path: "/orders", StatusCodes: []int{200}}
+	repo.endpoints["delete"] = models.Endpoint{ID: "delete", APIID: "api", Method: "DELETE", Path: "/orders", StatusCodes: []int{204}}
+	if _, err := service.GenerateAPISpec(ctx, "api"); err != nil {
+		t.Fatalf("GenerateAPISpec: %v", err)
+	}
+
+	delete(repo.endpoints, "delete")
+	repo.stale = true
+	if _, err := service.GenerateAPISpec(ctx, "api"); err != nil {
+		t.Fatalf("GenerateAPISpec: %v", err)
+	}
+
+	versions, err := service.GetSpecVersions(ctx, "api")
+	if err != nil || len(versions) != 2 || versions[0].Version != 2 || versions[0].Changes.Breaking != 1 {
+		t.Fatalf("versions = %+v %v", versions, err)
+	}
+	if len(producer.messages) != 1 {
+		t.Fatalf("messages = %+v", producer.messages)
+	}
+}
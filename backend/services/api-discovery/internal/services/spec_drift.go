@@ -0,0 +1,519 @@
+package services
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+)
+
+const (
+	// defaultZombieAfter is how long a documented operation may go unused
+	// before it is reported as a zombie
+	defaultZombieAfter = 30 * 24 * time.Hour
+	// maxDriftFindings bounds each list of a drift report
+	maxDriftFindings = 500
+)
+
+// documentedOperation is one method and path of an imported spec, with the
+// server base path prepended
+type documentedOperation struct {
+	method     string
+	path       string
+	segments   []string
+	literals   int
+	operation  *models.Operation
+	parameters []models.Parameter
+}
+
+// documentedOperations lists the operations of a spec under each server base path
+func documentedOperations(spec *models.APISpec) []documentedOperation {
+	basePaths := specBasePaths(spec)
+
+	var operations []documentedOperation
+	for path, item := range spec.Paths {
+		if item == nil {
+			continue
+		}
+		for _, method := range []string{"GET", "PUT", "POST", "DELETE", "OPTIONS", "HEAD", "PATCH"} {
+			operation := operationForMethod(item, method)
+			if operation == nil {
+				continue
+			}
+			parameters := append(append([]models.Parameter{}, item.Parameters...), operation.Parameters...)
+			for _, basePath := range basePaths {
+				segments := splitPath(basePath + path)
+				literals := 0
+				for _, segment := range segments {
+					if !strings.Contains(segment, "{") {
+						literals++
+					}
+				}
+				operations = append(operations, documentedOperation{
+					method:     method,
+					path:       path,
+					segments:   segments,
+					literals:   literals,
+					operation:  operation,
+					parameters: parameters,
+				})
+			}
+		}
+	}
+	// Ties between equally specific templates are broken by path
+	sort.Slice(operations, func(i, j int) bool {
+		if operations[i].path != operations[j].path {
+			return operations[i].path < operations[j].path
+		}
+		return operations[i].method < operations[j].method
+	})
+	return operations
+}
+
+// specBasePaths returns the path prefixes of the spec's servers, with server
+// variables set to their defaults
+func specBasePaths(spec *models.APISpec) []string {
+	seen := make(map[string]bool)
+	var basePaths []string
+	for _, server := range spec.Servers {
+		serverURL := resolvedServerURL(server)
+		basePath := serverURL
+		if parsed, err := url.Parse(serverURL); err == nil {
+			basePath = parsed.Path
+		}
+		basePath = strings.TrimSuffix(basePath, "/")
+		if !seen[basePath] {
+			seen[basePath] = true
+			basePaths = append(basePaths, basePath)
+		}
+	}
+	if len(basePaths) == 0 {
+		basePaths = []string{""}
+	}
+	return basePaths
+}
+
+// resolvedServerURL returns a server URL with its variables set to their defaults
+func resolvedServerURL(server models.SpecServer) string {
+	serverURL := server.URL
+	for name, variable := range server.Variables {
+		serverURL = strings.ReplaceAll(serverURL, "{"+name+"}", variable.Default)
+	}
+	return serverURL
+}
+
+// matches reports whether an observed path template falls under the
+// documented one. A documented parameter matches any segment; an inferred
+// parameter only matches a documented parameter.
+func (d *documentedOperation) matches(segments []string) bool {
+	if len(segments) != len(d.segments) {
+		return false
+	}
+	for i, segment := range segments {
+		if !strings.Contains(d.segments[i], "{") && d.segments[i] != segment {
+			return false
+		}
+	}
+	return true
+}
+
+// detectDrift compares the endpoints observed for an API, and the schemas
+// learned for them, with the API's imported spec
+func detectDrift(imported *models.ImportedSpec, endpoints []models.Endpoint, schemas map[string]models.EndpointSchema, zombieAfter time.Duration, now time.Time) *models.DriftReport {
+	spec := imported.Spec
+	report := &models.DriftReport{
+		APIID:                  imported.APIID,
+		SpecID:                 imported.ID,
+		ShadowEndpoints:        []models.DriftEndpoint{},
+		ZombieEndpoints:        []models.DriftEndpoint{},
+		UndocumentedParameters: []models.ParameterDrift{},
+		ResponseDrift:          []models.ResponseDrift{},
+		GeneratedAt:            now,
+	}
+	operations := documentedOperations(spec)
+
+	type usage struct {
+		requests int64
+		lastSeen *time.Time
+	}
+	used := make(map[string]*usage)
+	reportedParams := make(map[string]bool)
+
+	for i := range endpoints {
+		endpoint := &endpoints[i]
+		method := strings.ToUpper(endpoint.Method)
+		path := endpoint.Path
+		if path == "" {
+			if parsed, err := url.Parse(endpoint.URL); err == nil {
+				path = parsed.Path
+			}
+		}
+		segments := splitPath(path)
+
+		var best *documentedOperation
+		for j := range operations {
+			candidate := &operations[j]
+			if candidate.method == method && candidate.matches(segments) && (best == nil || candidate.literals > best.literals) {
+				best = candidate
+			}
+		}
+		if best == nil {
+			if len(report.ShadowEndpoints) < maxDriftFindings {
+				report.ShadowEndpoints = append(report.ShadowEndpoints, models.DriftEndpoint{
+					Method:       method,
+					Path:         path,
+					EndpointID:   endpoint.ID,
+					RequestCount: endpoint.RequestCount,
+					LastSeen:     endpoint.LastSeen,
+				})
+			}
+			continue
+		}
+
+		key := best.method + " " + best.path
+		u, ok := used[key]
+		if !ok {
+			u = &usage{}
+			used[key] = u
+		}
+		u.requests += endpoint.RequestCount
+		if endpoint.LastSeen != nil && (u.lastSeen == nil || endpoint.LastSeen.After(*u.lastSeen)) {
+			u.lastSeen = endpoint.LastSeen
+		}
+
+		for _, param := range endpoint.Parameters {
+			if param.In == "path" || best.documents(spec, param) {
+				continue
+			}
+			paramKey := key + " " + param.In + ":" + param.Name
+			if reportedParams[paramKey] || len(report.UndocumentedParameters) >= maxDriftFindings {
+				continue
+			}
+			reportedParams[paramKey] = true
+			report.UndocumentedParameters = append(report.UndocumentedParameters, models.ParameterDrift{
+				Method:     method,
+				Path:       best.path,
+				EndpointID: endpoint.ID,
+				Name:       param.Name,
+				In:         param.In,
+				Type:       param.Type,
+			})
+		}
+
+		learned, hasSchema := schemas[endpoint.ID]
+		report.ResponseDrift = append(report.ResponseDrift, responseDrift(spec, best, endpoint, learned, hasSchema)...)
+	}
+	if len(report.ResponseDrift) > maxDriftFindings {
+		report.ResponseDrift = report.ResponseDrift[:maxDriftFindings]
+	}
+
+	// Operations documented under several base paths are reported once
+	reported := make(map[string]bool)
+	for _, operation := range operations {
+		key := operation.method + " " + operation.path
+		if reported[key] {
+			continue
+		}
+		reported[key] = true
+		u := used[key]
+		if u != nil && (u.lastSeen == nil || now.Sub(*u.lastSeen) <= zombieAfter) {
+			continue
+		}
+		zombie := models.DriftEndpoint{Method: operation.method, Path: operation.path}
+		if u != nil {
+			zombie.RequestCount, zombie.LastSeen = u.requests, u.lastSeen
+		}
+		if len(report.ZombieEndpoints) < maxDriftFindings {
+			report.ZombieEndpoints = append(report.ZombieEndpoints, zombie)
+		}
+	}
+
+	sortDriftEndpoints(report.ShadowEndpoints)
+	sortDriftEndpoints(report.ZombieEndpoints)
+	report.Summary = models.DriftSummary{
+		DocumentedOperations:   len(reported),
+		ObservedEndpoints:      len(endpoints),
+		ShadowEndpoints:        len(report.ShadowEndpoints),
+		ZombieEndpoints:        len(report.ZombieEndpoints),
+		UndocumentedParameters: len(report.UndocumentedParameters),
+		ResponseDrift:          len(report.ResponseDrift),
+	}
+	return report
+}
+
+// documents reports whether an observed parameter is declared by the
+// operation, body fields being looked up in the request body schema
+func (d *documentedOperation) documents(spec *models.APISpec, param models.Parameter) bool {
+	if param.In == "body" {
+		if d.operation.RequestBody == nil {
+			return false
+		}
+		for _, media := range d.operation.RequestBody.Content {
+			if schemaHasField(spec, media.Schema, param.Name) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, documented := range d.parameters {
+		if documented.In != param.In {
+			continue
+		}
+		// Header names are case-insensitive
+		if documented.Name == param.Name || (param.In == "header" && strings.EqualFold(documented.Name, param.Name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaHasField looks up a body field such as items[].sku in a schema
+func schemaHasField(spec *models.APISpec, schema *models.Schema, field string) bool {
+	for _, part := range strings.Split(field, ".") {
+		schema = resolveSchemaRef(spec, schema)
+		if schema == nil {
+			return false
+		}
+		name := strings.TrimRight(part, "[]")
+		arrays := (len(part) - len(name)) / 2
+
+		property, ok := schema.Properties[name]
+		if !ok {
+			for _, alternative := range schema.OneOf {
+				if alternative = resolveSchemaRef(spec, alternative); alternative != nil && alternative.Properties[name] != nil {
+					property, ok = alternative.Properties[name], true
+					break
+				}
+			}
+		}
+		if !ok {
+			// A free-form object accepts any field
+			return allowsAdditionalProperties(schema)
+		}
+		schema = property
+		for i := 0; i < arrays; i++ {
+			schema = resolveSchemaRef(spec, schema)
+			if schema == nil || schema.Items == nil {
+				return schema != nil && schema.Type == ""
+			}
+			schema = schema.Items
+		}
+	}
+	return true
+}
+
+func allowsAdditionalProperties(schema *models.Schema) bool {
+	switch additional := schema.AdditionalProperties.(type) {
+	case bool:
+		return additional
+	case nil:
+		return len(schema.Properties) == 0 && len(schema.OneOf) == 0
+	}
+	return true
+}
+
+// resolveSchemaRef follows local component references
+func resolveSchemaRef(spec *models.APISpec, schema *models.Schema) *models.Schema {
+	for depth := 0; schema != nil && schema.Ref != ""; depth++ {
+		name := localRefName(schema.Ref, "#/components/schemas/")
+		if name == "" || depth >= maxRefDepth || spec.Components == nil {
+			return nil
+		}
+		schema = spec.Components.Schemas[name]
+	}
+	return schema
+}
+
+// responseDrift compares observed status codes and learned response schemas
+// with the documented responses of an operation
+func responseDrift(spec *models.APISpec, operation *documentedOperation, endpoint *models.Endpoint, learned models.EndpointSchema, hasSchema bool) []models.ResponseDrift {
+	var drift []models.ResponseDrift
+	finding := func(code, kind, field, documented, observed string) {
+		drift = append(drift, models.ResponseDrift{
+			Method:     operation.method,
+			Path:       operation.path,
+			EndpointID: endpoint.ID,
+			StatusCode: code,
+			Kind:       kind,
+			Field:      field,
+			Documented: documented,
+			Observed:   observed,
+		})
+	}
+
+	codes := make(map[string]bool)
+	for _, status := range endpoint.StatusCodes {
+		codes[strconv.Itoa(status)] = true
+	}
+	if hasSchema {
+		for code := range learned.ResponseSchemas {
+			if code != "default" {
+				codes[code] = true
+			}
+		}
+	}
+	sorted := make([]string, 0, len(codes))
+	for code := range codes {
+		sorted = append(sorted, code)
+	}
+	sort.Strings(sorted)
+
+	for _, code := range sorted {
+		documented, ok := documentedResponse(operation.operation, code)
+		if !ok {
+			finding(code, "undocumented_status", "", "", code)
+			continue
+		}
+		observed := learned.ResponseSchemas[code]
+		if !hasSchema || observed == nil || documented.Schema == nil {
+			continue
+		}
+		compareSchemas(spec, schemaFromMap(documented.Schema), observed, "$", 0, func(kind, field, documented, observed string) {
+			finding(code, kind, field, documented, observed)
+		})
+	}
+	return drift
+}
+
+// documentedResponse finds the response documented for a status code, falling
+// back to its range (e.g. 4XX) and then to the default response
+func documentedResponse(operation *models.Operation, code string) (models.Response, bool) {
+	if response, ok := operation.Responses[code]; ok {
+		return response, true
+	}
+	if len(code) == 3 {
+		for _, key := range []string{code[:1] + "XX", code[:1] + "xx"} {
+			if response, ok := operation.Responses[key]; ok {
+				return response, true
+			}
+		}
+	}
+	response, ok := operation.Responses["default"]
+	return response, ok
+}
+
+// compareSchemas reports where an observed schema departs from the documented one
+func compareSchemas(spec *models.APISpec, documented, observed *models.Schema, field string, depth int, report func(kind, field, documented, observed string)) {
+	documented = resolveSchemaRef(spec, documented)
+	if documented == nil || observed == nil || depth > maxSchemaDepth {
+		return
+	}
+	documentedTypes := schemaTypes(spec, documented)
+	observedTypes := schemaTypes(spec, observed)
+	if len(documentedTypes) == 0 {
+		return
+	}
+
+	for _, observedType := range observedTypes {
+		if !typeAllowed(documentedTypes, observedType) {
+			report("type_mismatch", field, strings.Join(documentedTypes, "|"), observedType)
+			return
+		}
+	}
+	if observed.Nullable && !documented.Nullable {
+		report("type_mismatch", field, strings.Join(documentedTypes, "|"), "null")
+	}
+	// Unions are only compared by type
+	if len(documentedTypes) > 1 || len(observedTypes) != 1 {
+		return
+	}
+
+	switch observedTypes[0] {
+	case "object":
+		required := make(map[string]bool, len(documented.Required))
+		for _, name := range documented.Required {
+			required[name] = true
+		}
+		observedRequired := make(map[string]bool, len(observed.Required))
+		for _, name := range observed.Required {
+			observedRequired[name] = true
+		}
+
+		names := make([]string, 0, len(observed.Properties))
+		for name := range observed.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := documented.Properties[name]
+			if !ok {
+				if !allowsAdditionalProperties(documented) {
+					report("undocumented_property", field+"."+name, "", strings.Join(schemaTypes(spec, observed.Properties[name]), "|"))
+				}
+				continue
+			}
+			if required[name] && !observedRequired[name] {
+				report("missing_property", field+"."+name, "required", "optional")
+			}
+			compareSchemas(spec, property, observed.Properties[name], field+"."+name, depth+1, report)
+		}
+
+		missing := make([]string, 0)
+		for name := range required {
+			if _, ok := observed.Properties[name]; !ok {
+				missing = append(missing, name)
+			}
+		}
+		sort.Strings(missing)
+		for _, name := range missing {
+			report("missing_property", field+"."+name, "required", "absent")
+		}
+	case "array":
+		if documented.Items != nil && observed.Items != nil {
+			compareSchemas(spec, documented.Items, observed.Items, field+"[]", depth+1, report)
+		}
+	}
+}
+
+// schemaTypes lists the types a schema allows, "" standing for any
+func schemaTypes(spec *models.APISpec, schema *models.Schema) []string {
+	schema = resolveSchemaRef(spec, schema)
+	if schema == nil {
+		return nil
+	}
+	if schema.Type != "" {
+		return []string{schema.Type}
+	}
+	var types []string
+	for _, alternative := range schema.OneOf {
+		types = append(types, schemaTypes(spec, alternative)...)
+	}
+	if len(types) == 0 && len(schema.Properties) > 0 {
+		types = []string{"object"}
+	}
+	return types
+}
+
+func typeAllowed(documented []string, observed string) bool {
+	for _, name := range documented {
+		if name == "" || name == observed || (name == "number" && observed == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func schemaFromMap(data map[string]interface{}) *models.Schema {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+	var schema models.Schema
+	if err := json.Unmarshal(encoded, &schema); err != nil {
+		return nil
+	}
+	return &schema
+}
+
+func sortDriftEndpoints(endpoints []models.DriftEndpoint) {
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Path != endpoints[j].Path {
+			return endpoints[i].Path < endpoints[j].Path
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+}
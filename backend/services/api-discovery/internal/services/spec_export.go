@@ -0,0 +1,1420 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+)
+
+// Spec export formats accepted by ExportAPISpec
+const (
+	SpecExportJSON    = "json"
+	SpecExportYAML    = "yaml"
+	SpecExportPostman = "postman"
+	SpecExportHAR     = "har"
+)
+
+const (
+	// exportedOpenAPIVersion is the OpenAPI version specs are rendered as
+	exportedOpenAPIVersion = "3.1.0"
+	postmanSchemaURL       = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+	// defaultExportBaseURL addresses sample requests of a spec without servers
+	defaultExportBaseURL = "http://localhost"
+	// maxSampleDepth bounds how deep sample bodies are built from schemas
+	maxSampleDepth = 8
+)
+
+var specExportFormats = map[string]struct{ contentType, extension string }{
+	SpecExportJSON:    {"application/json", ".openapi.json"},
+	SpecExportYAML:    {"application/yaml", ".openapi.yaml"},
+	SpecExportPostman: {"application/json", ".postman_collection.json"},
+	SpecExportHAR:     {"application/json", ".har"},
+}
+
+// pathTemplateVariable matches a {name} variable of a path template
+var pathTemplateVariable = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// ignoredHeaderParameters are described by other parts of an OpenAPI
+// document, which requires header parameters with these names to be ignored
+var ignoredHeaderParameters = map[string]bool{"accept": true, "content-type": true, "authorization": true}
+
+// SpecExport is an API spec rendered in one of the export formats
+type SpecExport struct {
+	Format      string `json:"format"`
+	ContentType string `json:"content_type"`
+	Filename    string `json:"filename"`
+	Data        []byte `json:"-"`
+}
+
+// exportSpec renders a spec in an export format. now dates HAR entries.
+func exportSpec(spec *models.APISpec, format string, now time.Time) (*SpecExport, error) {
+	target, ok := specExportFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedExportFormat, format)
+	}
+
+	var data []byte
+	var err error
+	switch format {
+	case SpecExportJSON:
+		data, err = marshalExportJSON(openAPIDocumentFor(spec))
+	case SpecExportYAML:
+		var buffer bytes.Buffer
+		encoder := yaml.NewEncoder(&buffer)
+		encoder.SetIndent(2)
+		if err = encoder.Encode(openAPIDocumentFor(spec)); err == nil {
+			err = encoder.Close()
+		}
+		data = buffer.Bytes()
+	case SpecExportPostman:
+		data, err = marshalExportJSON(postmanCollectionFor(spec))
+	case SpecExportHAR:
+		data, err = marshalExportJSON(harDocumentFor(spec, now))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &SpecExport{
+		Format:      format,
+		ContentType: target.contentType,
+		Filename:    exportFilename(spec.APIID) + target.extension,
+		Data:        data,
+	}, nil
+}
+
+func marshalExportJSON(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// exportFilename keeps the characters of an API ID that are safe in a file name
+func exportFilename(apiID string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, apiID)
+	if name == "" {
+		return "api"
+	}
+	return name
+}
+
+// openAPIDocument is a spec as written in an OpenAPI 3.1 document. The fields
+// are in the order the document is usually read in.
+type openAPIDocument struct {
+	OpenAPI      string                            `json:"openapi" yaml:"openapi"`
+	Info         map[string]interface{}            `json:"info" yaml:"info"`
+	Servers      []map[string]interface{}          `json:"servers,omitempty" yaml:"servers,omitempty"`
+	Tags         []map[string]interface{}          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Security     []map[string][]string             `json:"security,omitempty" yaml:"security,omitempty"`
+	Paths        map[string]map[string]interface{} `json:"paths" yaml:"paths"`
+	Components   map[string]interface{}            `json:"components,omitempty" yaml:"components,omitempty"`
+	ExternalDocs map[string]interface{}            `json:"externalDocs,omitempty" yaml:"externalDocs,omitempty"`
+}
+
+// methodOperation is an operation of a path item with its HTTP method
+type methodOperation struct {
+	method    string
+	operation *models.Operation
+}
+
+// pathOperations returns the operations of a path item in method order
+func pathOperations(item *models.PathItem) []methodOperation {
+	all := []methodOperation{
+		{"get", item.Get}, {"put", item.Put}, {"post", item.Post}, {"delete", item.Delete},
+		{"options", item.Options}, {"head", item.Head}, {"patch", item.Patch}, {"trace", item.Trace},
+	}
+	operations := all[:0]
+	for _, operation := range all {
+		if operation.operation != nil {
+			operations = append(operations, operation)
+		}
+	}
+	return operations
+}
+
+func openAPIDocumentFor(spec *models.APISpec) *openAPIDocument {
+	doc := &openAPIDocument{
+		OpenAPI: exportedOpenAPIVersion,
+		Info:    openAPIInfo(spec),
+		Paths:   make(map[string]map[string]interface{}, len(spec.Paths)),
+	}
+
+	for _, server := range spec.Servers {
+		rendered := map[string]interface{}{"url": server.URL}
+		putString(rendered, "description", server.Description)
+		if len(server.Variables) > 0 {
+			variables := make(map[string]interface{}, len(server.Variables))
+			for name, variable := range server.Variables {
+				renderedVariable := map[string]interface{}{"default": variable.Default}
+				if len(variable.Enum) > 0 {
+					renderedVariable["enum"] = variable.Enum
+				}
+				putString(renderedVariable, "description", variable.Description)
+				variables[name] = renderedVariable
+			}
+			rendered["variables"] = variables
+		}
+		doc.Servers = append(doc.Servers, rendered)
+	}
+
+	tags := append([]models.SpecTag{}, spec.Tags...)
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	for _, tag := range tags {
+		rendered := map[string]interface{}{"name": tag.Name}
+		putString(rendered, "description", tag.Description)
+		if docs := openAPIExternalDocs(tag.ExternalDocs); docs != nil {
+			rendered["externalDocs"] = docs
+		}
+		doc.Tags = append(doc.Tags, rendered)
+	}
+
+	doc.Security = openAPISecurity(spec.Security)
+	doc.ExternalDocs = openAPIExternalDocs(spec.ExternalDocs)
+	doc.Components = openAPIComponents(spec.Components)
+
+	for path, item := range spec.Paths {
+		if item == nil || !strings.HasPrefix(path, "/") {
+			continue
+		}
+		doc.Paths[path] = openAPIPathItem(path, item)
+	}
+	return doc
+}
+
+func openAPIInfo(spec *models.APISpec) map[string]interface{} {
+	info := &models.SpecInfo{}
+	if spec.Info != nil {
+		info = spec.Info
+	}
+	title, version, description := info.Title, info.Version, info.Description
+	if title == "" {
+		title = spec.Title
+	}
+	if title == "" {
+		title = "API"
+	}
+	if version == "" {
+		version = spec.Version
+	}
+	if version == "" {
+		version = "1.0.0"
+	}
+	if description == "" {
+		description = spec.Description
+	}
+
+	rendered := map[string]interface{}{"title": title, "version": version}
+	putString(rendered, "description", description)
+	putString(rendered, "termsOfService", info.TermsOfService)
+	if contact := info.Contact; contact != nil {
+		renderedContact := make(map[string]interface{})
+		putString(renderedContact, "name", contact.Name)
+		putString(renderedContact, "url", contact.URL)
+		putString(renderedContact, "email", contact.Email)
+		rendered["contact"] = renderedContact
+	}
+	if license := info.License; license != nil && license.Name != "" {
+		renderedLicense := map[string]interface{}{"name": license.Name}
+		putString(renderedLicense, "url", license.URL)
+		rendered["license"] = renderedLicense
+	}
+	return rendered
+}
+
+func openAPIExternalDocs(docs *models.ExternalDocumentation) map[string]interface{} {
+	if docs == nil || docs.URL == "" {
+		return nil
+	}
+	rendered := map[string]interface{}{"url": docs.URL}
+	putString(rendered, "description", docs.Description)
+	return rendered
+}
+
+// openAPISecurity writes requirements without scopes as empty lists, which
+// the document requires
+func openAPISecurity(requirements []models.SecurityRequirement) []map[string][]string {
+	var rendered []map[string][]string
+	for _, requirement := range requirements {
+		renderedRequirement := make(map[string][]string, len(requirement))
+		for name, scopes := range requirement {
+			if scopes == nil {
+				scopes = []string{}
+			}
+			renderedRequirement[name] = scopes
+		}
+		rendered = append(rendered, renderedRequirement)
+	}
+	return rendered
+}
+
+// openAPIPathItem renders a path item, declaring every template variable of
+// the path as a path parameter and leaving out path parameters it lacks
+func openAPIPathItem(path string, item *models.PathItem) map[string]interface{} {
+	templated := make(map[string]bool)
+	var variables []string
+	for _, match := range pathTemplateVariable.FindAllStringSubmatch(path, -1) {
+		if !templated[match[1]] {
+			templated[match[1]] = true
+			variables = append(variables, match[1])
+		}
+	}
+
+	rendered := make(map[string]interface{})
+	putString(rendered, "summary", item.Summary)
+	putString(rendered, "description", item.Description)
+
+	var parameters []interface{}
+	declared := make(map[string]bool)
+	for _, param := range item.Parameters {
+		key := param.In + ":" + param.Name
+		if renderedParam := openAPIParameter(param, templated); renderedParam != nil && !declared[key] {
+			declared[key] = true
+			parameters = append(parameters, renderedParam)
+		}
+	}
+	for _, name := range variables {
+		if !declared["path:"+name] {
+			parameters = append(parameters, map[string]interface{}{
+				"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	if len(parameters) > 0 {
+		rendered["parameters"] = parameters
+	}
+
+	for _, operation := range pathOperations(item) {
+		rendered[operation.method] = openAPIOperation(operation.operation, templated)
+	}
+	return rendered
+}
+
+// openAPIOperation renders an operation. Body fields recorded as parameters
+// become the request body when the operation has no other.
+func openAPIOperation(operation *models.Operation, templated map[string]bool) map[string]interface{} {
+	rendered := map[string]interface{}{"responses": openAPIResponses(operation.Responses)}
+	if len(operation.Tags) > 0 {
+		rendered["tags"] = operation.Tags
+	}
+	putString(rendered, "summary", operation.Summary)
+	putString(rendered, "description", operation.Description)
+	putString(rendered, "operationId", operation.OperationID)
+	if operation.Deprecated {
+		rendered["deprecated"] = true
+	}
+	if operation.Security != nil {
+		security := openAPISecurity(operation.Security)
+		if security == nil {
+			security = []map[string][]string{}
+		}
+		rendered["security"] = security
+	}
+	for _, server := range operation.Servers {
+		servers, _ := rendered["servers"].([]interface{})
+		renderedServer := map[string]interface{}{"url": server.URL}
+		putString(renderedServer, "description", server.Description)
+		rendered["servers"] = append(servers, renderedServer)
+	}
+
+	var parameters []interface{}
+	var bodyParams []models.Parameter
+	declared := make(map[string]bool)
+	for _, param := range operation.Parameters {
+		if param.In == "body" {
+			bodyParams = append(bodyParams, param)
+			continue
+		}
+		key := param.In + ":" + param.Name
+		if renderedParam := openAPIParameter(param, templated); renderedParam != nil && !declared[key] {
+			declared[key] = true
+			parameters = append(parameters, renderedParam)
+		}
+	}
+	if len(parameters) > 0 {
+		rendered["parameters"] = parameters
+	}
+
+	if operation.RequestBody != nil && len(operation.RequestBody.Content) > 0 {
+		rendered["requestBody"] = openAPIRequestBody(*operation.RequestBody)
+	} else if len(bodyParams) > 0 {
+		rendered["requestBody"] = map[string]interface{}{
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": openAPISchema(bodyParameterSchema(bodyParams))},
+			},
+		}
+	}
+	return rendered
+}
+
+// openAPIParameter renders a query, header, cookie or path parameter, or
+// returns nil for one the document cannot hold. With templated set, only path
+// parameters named in the path template are kept.
+func openAPIParameter(param models.Parameter, templated map[string]bool) map[string]interface{} {
+	switch param.In {
+	case "query", "cookie":
+	case "header":
+		if ignoredHeaderParameters[strings.ToLower(param.Name)] {
+			return nil
+		}
+	case "path":
+		if templated != nil && !templated[param.Name] {
+			return nil
+		}
+	default:
+		return nil
+	}
+	if param.Name == "" {
+		return nil
+	}
+
+	schema := parameterSchema(param)
+	rendered := map[string]interface{}{
+		"name":   param.Name,
+		"in":     param.In,
+		"schema": openAPISchema(schema),
+	}
+	if param.Required || param.In == "path" {
+		rendered["required"] = true
+	}
+	putString(rendered, "description", param.Description)
+	if example, ok := typedExample(param.Example, schema.Type); ok {
+		rendered["example"] = example
+	}
+	return rendered
+}
+
+// typedExample converts an example taken from a URL, which is always a
+// string, to the parameter's type, so /orders/12 gives an integer 12. It
+// reports false when there is no example or it does not parse as the type.
+func typedExample(example interface{}, schemaType string) (interface{}, bool) {
+	text, ok := example.(string)
+	if !ok {
+		return example, example != nil
+	}
+	switch schemaType {
+	case "integer":
+		value, err := strconv.ParseInt(text, 10, 64)
+		return value, err == nil
+	case "number":
+		value, err := strconv.ParseFloat(text, 64)
+		return value, err == nil
+	case "boolean":
+		value, err := strconv.ParseBool(text)
+		return value, err == nil
+	}
+	return text, true
+}
+
+// parameterSchema returns the schema stored for a parameter, or one of its type
+func parameterSchema(param models.Parameter) *models.Schema {
+	if stored, ok := param.Schema.(map[string]interface{}); ok && len(stored) > 0 {
+		if schema := schemaFromMap(stored); schema != nil {
+			return schema
+		}
+	}
+	return &models.Schema{Type: jsonSchemaType(param.Type)}
+}
+
+// jsonSchemaType maps a recorded type to a JSON Schema type
+func jsonSchemaType(recorded string) string {
+	switch recorded {
+	case "string", "number", "integer", "boolean", "array", "object", "null":
+		return recorded
+	}
+	return "string"
+}
+
+// bodyParameterSchema builds an object schema from body fields recorded as
+// parameters, such as customer.name and items[].sku
+func bodyParameterSchema(params []models.Parameter) *models.Schema {
+	root := &models.Schema{Type: "object", Properties: make(map[string]*models.Schema)}
+	for _, param := range params {
+		segments := strings.Split(param.Name, ".")
+		node := root
+		for i, segment := range segments {
+			array := strings.HasSuffix(segment, "[]")
+			name := strings.TrimSuffix(segment, "[]")
+			last := i == len(segments)-1
+
+			// A body that is itself an array, e.g. [].id
+			if name == "" {
+				node.Type, node.Properties = "array", nil
+				if node.Items == nil {
+					node.Items = &models.Schema{Type: "object", Properties: make(map[string]*models.Schema)}
+				}
+				node = node.Items
+				continue
+			}
+
+			if node.Properties == nil {
+				node.Type, node.Properties = "object", make(map[string]*models.Schema)
+			}
+			child := node.Properties[name]
+			if child == nil {
+				child = &models.Schema{}
+				node.Properties[name] = child
+			}
+			if array {
+				child.Type = "array"
+				if child.Items == nil {
+					child.Items = &models.Schema{}
+				}
+				child = child.Items
+			}
+			if last {
+				if child.Properties == nil {
+					child.Type = jsonSchemaType(param.Type)
+				}
+			} else if child.Type != "object" {
+				child.Type = "object"
+			}
+			node = child
+		}
+	}
+	return root
+}
+
+func openAPIRequestBody(body models.RequestBody) map[string]interface{} {
+	content := make(map[string]interface{}, len(body.Content))
+	for mediaType, media := range body.Content {
+		renderedMedia := make(map[string]interface{})
+		if media.Schema != nil {
+			renderedMedia["schema"] = openAPISchema(media.Schema)
+		}
+		if media.Example != nil {
+			renderedMedia["example"] = media.Example
+		}
+		content[mediaType] = renderedMedia
+	}
+
+	rendered := map[string]interface{}{"content": content}
+	putString(rendered, "description", body.Description)
+	if body.Required {
+		rendered["required"] = true
+	}
+	return rendered
+}
+
+// openAPIResponses renders responses under valid status code keys. The
+// document requires at least one response.
+func openAPIResponses(responses map[string]models.Response) map[string]interface{} {
+	rendered := make(map[string]interface{}, len(responses))
+	for code, response := range responses {
+		if validResponseCode(code) {
+			rendered[code] = openAPIResponse(code, response)
+		}
+	}
+	if len(rendered) == 0 {
+		rendered["default"] = map[string]interface{}{"description": "Response"}
+	}
+	return rendered
+}
+
+func validResponseCode(code string) bool {
+	if code == "default" {
+		return true
+	}
+	if len(code) != 3 || code[0] < '1' || code[0] > '5' {
+		return false
+	}
+	if code[1:] == "XX" {
+		return true
+	}
+	_, err := strconv.Atoi(code)
+	return err == nil
+}
+
+func openAPIResponse(code string, response models.Response) map[string]interface{} {
+	description := response.Description
+	if description == "" {
+		if status, err := strconv.Atoi(code); err == nil {
+			description = http.StatusText(status)
+		}
+	}
+	if description == "" {
+		description = "Response"
+	}
+	rendered := map[string]interface{}{"description": description}
+
+	headers := make(map[string]interface{})
+	for name, headerDescription := range response.Headers {
+		if strings.EqualFold(name, "Content-Type") {
+			continue
+		}
+		header := map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		putString(header, "description", headerDescription)
+		headers[name] = header
+	}
+	if len(headers) > 0 {
+		rendered["headers"] = headers
+	}
+
+	content := make(map[string]interface{})
+	if len(response.Schema) > 0 {
+		if schema := schemaFromMap(response.Schema); schema != nil {
+			content["application/json"] = map[string]interface{}{"schema": openAPISchema(schema)}
+		}
+	}
+	// Examples stored by media type, as imported specs keep them
+	for mediaType, example := range response.Examples {
+		if !strings.Contains(mediaType, "/") {
+			continue
+		}
+		media, _ := content[mediaType].(map[string]interface{})
+		if media == nil {
+			media = make(map[string]interface{})
+			content[mediaType] = media
+		}
+		media["example"] = example
+	}
+	if len(content) > 0 {
+		rendered["content"] = content
+	}
+	return rendered
+}
+
+func openAPIComponents(components *models.SpecComponents) map[string]interface{} {
+	if components == nil {
+		return nil
+	}
+	rendered := make(map[string]interface{})
+	if len(components.Schemas) > 0 {
+		schemas := make(map[string]interface{}, len(components.Schemas))
+		for name, schema := range components.Schemas {
+			schemas[name] = openAPISchema(schema)
+		}
+		rendered["schemas"] = schemas
+	}
+	if len(components.Responses) > 0 {
+		responses := make(map[string]interface{}, len(components.Responses))
+		for name, response := range components.Responses {
+			responses[name] = openAPIResponse(strconv.Itoa(response.StatusCode), response)
+		}
+		rendered["responses"] = responses
+	}
+	if len(components.Parameters) > 0 {
+		parameters := make(map[string]interface{}, len(components.Parameters))
+		for name, param := range components.Parameters {
+			if renderedParam := openAPIParameter(param, nil); renderedParam != nil {
+				parameters[name] = renderedParam
+			}
+		}
+		if len(parameters) > 0 {
+			rendered["parameters"] = parameters
+		}
+	}
+	if len(components.RequestBodies) > 0 {
+		bodies := make(map[string]interface{}, len(components.RequestBodies))
+		for name, body := range components.RequestBodies {
+			bodies[name] = openAPIRequestBody(body)
+		}
+		rendered["requestBodies"] = bodies
+	}
+	if len(components.SecuritySchemes) > 0 {
+		schemes := make(map[string]interface{}, len(components.SecuritySchemes))
+		for name, scheme := range components.SecuritySchemes {
+			schemes[name] = openAPISecurityScheme(scheme)
+		}
+		rendered["securitySchemes"] = schemes
+	}
+	if len(rendered) == 0 {
+		return nil
+	}
+	return rendered
+}
+
+func openAPISecurityScheme(scheme models.SecurityScheme) map[string]interface{} {
+	rendered := map[string]interface{}{"type": scheme.Type}
+	putString(rendered, "description", scheme.Description)
+	putString(rendered, "name", scheme.Name)
+	putString(rendered, "in", scheme.In)
+	putString(rendered, "scheme", scheme.Scheme)
+	putString(rendered, "bearerFormat", scheme.BearerFormat)
+	putString(rendered, "openIdConnectUrl", scheme.OpenIDConnectURL)
+	if scheme.Flows != nil {
+		flows := make(map[string]interface{})
+		for name, flow := range map[string]*models.OAuthFlow{
+			"implicit":          scheme.Flows.Implicit,
+			"password":          scheme.Flows.Password,
+			"clientCredentials": scheme.Flows.ClientCredentials,
+			"authorizationCode": scheme.Flows.AuthorizationCode,
+		} {
+			if flow == nil {
+				continue
+			}
+			scopes := flow.Scopes
+			if scopes == nil {
+				scopes = map[string]string{}
+			}
+			renderedFlow := map[string]interface{}{"scopes": scopes}
+			putString(renderedFlow, "authorizationUrl", flow.AuthorizationURL)
+			putString(renderedFlow, "tokenUrl", flow.TokenURL)
+			putString(renderedFlow, "refreshUrl", flow.RefreshURL)
+			flows[name] = renderedFlow
+		}
+		rendered["flows"] = flows
+	}
+	return rendered
+}
+
+// openAPISchema renders a schema as JSON Schema 2020-12, the dialect of
+// OpenAPI 3.1, where a nullable type is a list of types that includes null
+func openAPISchema(schema *models.Schema) map[string]interface{} {
+	rendered := make(map[string]interface{})
+	if schema == nil {
+		return rendered
+	}
+	if schema.Ref != "" {
+		ref := map[string]interface{}{"$ref": schema.Ref}
+		putString(ref, "description", schema.Description)
+		if schema.Nullable {
+			return map[string]interface{}{"oneOf": []interface{}{ref, map[string]interface{}{"type": "null"}}}
+		}
+		return ref
+	}
+
+	switch {
+	case schema.Type != "" && schema.Nullable && schema.Type != "null":
+		rendered["type"] = []string{schema.Type, "null"}
+	case schema.Type != "":
+		rendered["type"] = schema.Type
+	case schema.Nullable && len(schema.OneOf) == 0:
+		rendered["type"] = "null"
+	}
+	putString(rendered, "format", schema.Format)
+	putString(rendered, "title", schema.Title)
+	putString(rendered, "description", schema.Description)
+	putString(rendered, "pattern", schema.Pattern)
+	if schema.Default != nil {
+		rendered["default"] = schema.Default
+	}
+	if schema.Example != nil {
+		rendered["examples"] = []interface{}{schema.Example}
+	}
+	if len(schema.Required) > 0 {
+		required := append([]string{}, schema.Required...)
+		sort.Strings(required)
+		rendered["required"] = required
+	}
+	if len(schema.Properties) > 0 {
+		properties := make(map[string]interface{}, len(schema.Properties))
+		for name, property := range schema.Properties {
+			properties[name] = openAPISchema(property)
+		}
+		rendered["properties"] = properties
+	}
+	if schema.Items != nil {
+		rendered["items"] = openAPISchema(schema.Items)
+	}
+	switch additional := schema.AdditionalProperties.(type) {
+	case bool:
+		rendered["additionalProperties"] = additional
+	case *models.Schema:
+		rendered["additionalProperties"] = openAPISchema(additional)
+	case map[string]interface{}:
+		rendered["additionalProperties"] = openAPISchema(schemaFromMap(additional))
+	}
+	if len(schema.Enum) > 0 {
+		enum := append([]interface{}{}, schema.Enum...)
+		if schema.Nullable {
+			enum = append(enum, nil)
+		}
+		rendered["enum"] = enum
+	}
+	if schema.Minimum != nil {
+		rendered["minimum"] = *schema.Minimum
+	}
+	if schema.Maximum != nil {
+		rendered["maximum"] = *schema.Maximum
+	}
+	if schema.MinLength != nil {
+		rendered["minLength"] = *schema.MinLength
+	}
+	if schema.MaxLength != nil {
+		rendered["maxLength"] = *schema.MaxLength
+	}
+	if schema.MinItems != nil {
+		rendered["minItems"] = *schema.MinItems
+	}
+	if schema.MaxItems != nil {
+		rendered["maxItems"] = *schema.MaxItems
+	}
+	if schema.UniqueItems {
+		rendered["uniqueItems"] = true
+	}
+	if len(schema.OneOf) > 0 {
+		oneOf := make([]interface{}, 0, len(schema.OneOf)+1)
+		for _, option := range schema.OneOf {
+			oneOf = append(oneOf, openAPISchema(option))
+		}
+		if schema.Nullable && schema.Type == "" {
+			oneOf = append(oneOf, map[string]interface{}{"type": "null"})
+		}
+		rendered["oneOf"] = oneOf
+	}
+	return rendered
+}
+
+func putString(rendered map[string]interface{}, key, value string) {
+	if value != "" {
+		rendered[key] = value
+	}
+}
+
+// sampleRequest is an operation of a spec with sample parameter values and
+// bodies, from which Postman requests and HAR entries are built
+type sampleRequest struct {
+	method       string
+	path         string
+	name         string
+	description  string
+	tag          string
+	pathParams   []sampleParam
+	query        []sampleParam
+	headers      []sampleParam
+	mediaType    string
+	body         string
+	form         []sampleParam
+	status       int
+	responseType string
+	response     string
+}
+
+type sampleParam struct {
+	name        string
+	value       string
+	description string
+	required    bool
+}
+
+// sampleRequests builds a sample request for every operation of a spec, by
+// path and method
+func sampleRequests(spec *models.APISpec) []sampleRequest {
+	paths := make([]string, 0, len(spec.Paths))
+	for path, item := range spec.Paths {
+		if item != nil && strings.HasPrefix(path, "/") {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var requests []sampleRequest
+	for _, path := range paths {
+		item := spec.Paths[path]
+		for _, operation := range pathOperations(item) {
+			requests = append(requests, sampleRequestFor(spec, path, item, operation))
+		}
+	}
+	return requests
+}
+
+func sampleRequestFor(spec *models.APISpec, path string, item *models.PathItem, method methodOperation) sampleRequest {
+	operation := method.operation
+	request := sampleRequest{
+		method:      strings.ToUpper(method.method),
+		path:        path,
+		name:        operation.Summary,
+		description: operation.Description,
+	}
+	if request.name == "" {
+		request.name = operation.OperationID
+	}
+	if request.name == "" {
+		request.name = request.method + " " + path
+	}
+	if len(operation.Tags) > 0 {
+		request.tag = operation.Tags[0]
+	}
+
+	// Operation parameters override path item parameters of the same name
+	var params []models.Parameter
+	index := make(map[string]int)
+	for _, param := range append(append([]models.Parameter{}, item.Parameters...), operation.Parameters...) {
+		key := param.In + ":" + param.Name
+		if i, ok := index[key]; ok {
+			params[i] = param
+			continue
+		}
+		index[key] = len(params)
+		params = append(params, param)
+	}
+
+	var bodyParams []models.Parameter
+	for _, param := range params {
+		sample := sampleParam{name: param.Name, description: param.Description, required: param.Required || param.In == "path"}
+		switch param.In {
+		case "path":
+			sample.value = sampleText(sampleParameterValue(spec, param))
+			request.pathParams = append(request.pathParams, sample)
+		case "query":
+			sample.value = sampleText(sampleParameterValue(spec, param))
+			request.query = append(request.query, sample)
+		case "header":
+			if strings.EqualFold(param.Name, "Content-Type") {
+				continue
+			}
+			sample.value = sampleText(sampleParameterValue(spec, param))
+			request.headers = append(request.headers, sample)
+		case "body":
+			bodyParams = append(bodyParams, param)
+		}
+	}
+
+	var body interface{}
+	if operation.RequestBody != nil && len(operation.RequestBody.Content) > 0 {
+		names := make([]string, 0, len(operation.RequestBody.Content))
+		for name := range operation.RequestBody.Content {
+			names = append(names, name)
+		}
+		request.mediaType = preferredMediaType(names)
+		media := operation.RequestBody.Content[request.mediaType]
+		body = media.Example
+		if body == nil {
+			body = sampleSchemaValue(spec, media.Schema, 0)
+		}
+	} else if len(bodyParams) > 0 {
+		request.mediaType = "application/json"
+		body = sampleSchemaValue(spec, bodyParameterSchema(bodyParams), 0)
+	}
+	if request.mediaType != "" {
+		switch {
+		case request.mediaType == "application/x-www-form-urlencoded" || strings.HasPrefix(request.mediaType, "multipart/"):
+			request.form = sampleFormFields(body)
+		case isJSONMediaType(request.mediaType):
+			request.body = sampleJSON(body)
+		default:
+			request.body = sampleText(body)
+		}
+	}
+
+	request.status, request.responseType, request.response = sampleResponse(spec, operation.Responses)
+	return request
+}
+
+// sampleResponse picks the main response of an operation: the lowest 2xx
+// status code, or the lowest code
+func sampleResponse(spec *models.APISpec, responses map[string]models.Response) (int, string, string) {
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		if validResponseCode(code) {
+			codes = append(codes, code)
+		}
+	}
+	code := primaryCode(codes)
+	response := responses[code]
+
+	status := http.StatusOK
+	if parsed, err := strconv.Atoi(code); err == nil {
+		status = parsed
+	} else if strings.HasSuffix(code, "XX") {
+		status = int(code[0]-'0') * 100
+	}
+
+	for mediaType, example := range response.Examples {
+		if strings.Contains(mediaType, "/") {
+			if isJSONMediaType(mediaType) {
+				return status, mediaType, sampleJSON(example)
+			}
+			return status, mediaType, sampleText(example)
+		}
+	}
+	if len(response.Schema) > 0 {
+		if schema := schemaFromMap(response.Schema); schema != nil {
+			return status, "application/json", sampleJSON(sampleSchemaValue(spec, schema, 0))
+		}
+	}
+	return status, "", ""
+}
+
+func sampleParameterValue(spec *models.APISpec, param models.Parameter) interface{} {
+	if param.Example != nil {
+		return param.Example
+	}
+	return sampleSchemaValue(spec, parameterSchema(param), 0)
+}
+
+// sampleSchemaValue builds a value a schema accepts, preferring the examples,
+// defaults and enums it documents
+func sampleSchemaValue(spec *models.APISpec, schema *models.Schema, depth int) interface{} {
+	schema = resolveSchemaRef(spec, schema)
+	if schema == nil || depth > maxSampleDepth {
+		return nil
+	}
+	switch {
+	case schema.Example != nil:
+		return schema.Example
+	case schema.Default != nil:
+		return schema.Default
+	case len(schema.Enum) > 0:
+		return schema.Enum[0]
+	case len(schema.OneOf) > 0:
+		return sampleSchemaValue(spec, schema.OneOf[0], depth+1)
+	}
+
+	switch schema.Type {
+	case "object", "":
+		if schema.Type == "" && len(schema.Properties) == 0 {
+			if schema.Items != nil {
+				return []interface{}{sampleSchemaValue(spec, schema.Items, depth+1)}
+			}
+			return nil
+		}
+		object := make(map[string]interface{}, len(schema.Properties))
+		for name, property := range schema.Properties {
+			object[name] = sampleSchemaValue(spec, property, depth+1)
+		}
+		return object
+	case "array":
+		if schema.Items == nil {
+			return []interface{}{}
+		}
+		return []interface{}{sampleSchemaValue(spec, schema.Items, depth+1)}
+	case "integer":
+		if schema.Minimum != nil {
+			return int64(*schema.Minimum)
+		}
+		return 1
+	case "number":
+		if schema.Minimum != nil {
+			return *schema.Minimum
+		}
+		return 1.5
+	case "boolean":
+		return true
+	case "string":
+		return sampleString(schema.Format)
+	}
+	return nil
+}
+
+func sampleString(format string) string {
+	switch format {
+	case "uuid":
+		return "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	case "date-time":
+		return "2026-01-01T00:00:00Z"
+	case "date":
+		return "2026-01-01"
+	case "email":
+		return "user@example.com"
+	case "uri", "url":
+		return "https://example.com"
+	case "ipv4":
+		return "192.0.2.1"
+	case "binary", "byte":
+		return ""
+	}
+	return "string"
+}
+
+func sampleJSON(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// sampleText renders a sample value as it is written in a URL or header
+func sampleText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(value)
+}
+
+// sampleFormFields writes the top-level fields of a sample object as form fields
+func sampleFormFields(body interface{}) []sampleParam {
+	object, ok := body.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]sampleParam, 0, len(names))
+	for _, name := range names {
+		fields = append(fields, sampleParam{name: name, value: sampleText(object[name])})
+	}
+	return fields
+}
+
+// samplePath fills in the path parameters of a path template
+func samplePath(path string, params []sampleParam) string {
+	values := make(map[string]string, len(params))
+	for _, param := range params {
+		values[param.name] = param.value
+	}
+	return pathTemplateVariable.ReplaceAllStringFunc(path, func(variable string) string {
+		name := variable[1 : len(variable)-1]
+		if value := values[name]; value != "" {
+			return url.PathEscape(value)
+		}
+		return name
+	})
+}
+
+// exportBaseURL is the URL sample requests are sent to: the first server of
+// the spec, with its variables set to their defaults
+func exportBaseURL(spec *models.APISpec) string {
+	if len(spec.Servers) > 0 {
+		if base := strings.TrimSuffix(resolvedServerURL(spec.Servers[0]), "/"); strings.Contains(base, "://") {
+			return base
+		}
+	}
+	return defaultExportBaseURL
+}
+
+// postmanCollection is a Postman collection in the v2.1 format
+type postmanCollection struct {
+	Info     postmanInfo       `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Variable []postmanKeyValue `json:"variable,omitempty"`
+}
+
+type postmanInfo struct {
+	PostmanID   string `json:"_postman_id,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Schema      string `json:"schema"`
+}
+
+// postmanItem is a request, or a folder of requests
+type postmanItem struct {
+	Name    string          `json:"name"`
+	Item    []postmanItem   `json:"item,omitempty"`
+	Request *postmanRequest `json:"request,omitempty"`
+}
+
+type postmanRequest struct {
+	Method      string            `json:"method"`
+	Header      []postmanKeyValue `json:"header"`
+	Body        *postmanBody      `json:"body,omitempty"`
+	URL         postmanURL        `json:"url"`
+	Description string            `json:"description,omitempty"`
+}
+
+type postmanURL struct {
+	Raw      string            `json:"raw"`
+	Host     []string          `json:"host"`
+	Path     []string          `json:"path,omitempty"`
+	Query    []postmanKeyValue `json:"query,omitempty"`
+	Variable []postmanKeyValue `json:"variable,omitempty"`
+}
+
+type postmanBody struct {
+	Mode       string                 `json:"mode"`
+	Raw        string                 `json:"raw,omitempty"`
+	URLEncoded []postmanKeyValue      `json:"urlencoded,omitempty"`
+	FormData   []postmanKeyValue      `json:"formdata,omitempty"`
+	Options    map[string]interface{} `json:"options,omitempty"`
+}
+
+type postmanKeyValue struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
+}
+
+// postmanCollectionFor builds a collection with a folder per operation tag.
+// Requests are addressed through the baseUrl collection variable.
+func postmanCollectionFor(spec *models.APISpec) *postmanCollection {
+	info := openAPIInfo(spec)
+	collection := &postmanCollection{
+		Info: postmanInfo{
+			PostmanID: spec.ID,
+			Name:      info["title"].(string),
+			Schema:    postmanSchemaURL,
+		},
+		Variable: []postmanKeyValue{{Key: "baseUrl", Value: exportBaseURL(spec)}},
+	}
+	if description, ok := info["description"].(string); ok {
+		collection.Info.Description = description
+	}
+
+	folders := make(map[string]*postmanItem)
+	var folderNames []string
+	var items []postmanItem
+	for _, request := range sampleRequests(spec) {
+		item := postmanItem{Name: request.name, Request: postmanRequestFor(request)}
+		if request.tag == "" {
+			items = append(items, item)
+			continue
+		}
+		folder, ok := folders[request.tag]
+		if !ok {
+			folder = &postmanItem{Name: request.tag}
+			folders[request.tag] = folder
+			folderNames = append(folderNames, request.tag)
+		}
+		folder.Item = append(folder.Item, item)
+	}
+
+	// Folders come first, by name
+	sort.Strings(folderNames)
+	collection.Item = make([]postmanItem, 0, len(folderNames)+len(items))
+	for _, name := range folderNames {
+		collection.Item = append(collection.Item, *folders[name])
+	}
+	collection.Item = append(collection.Item, items...)
+	return collection
+}
+
+func postmanRequestFor(request sampleRequest) *postmanRequest {
+	values := make(map[string]string, len(request.pathParams))
+	for _, param := range request.pathParams {
+		values[param.name] = param.value
+	}
+
+	// Path parameters that fill a whole segment become Postman path
+	// variables; the others are filled in
+	rendered := &postmanRequest{Method: request.method, Header: []postmanKeyValue{}, Description: request.description}
+	target := &rendered.URL
+	target.Host = []string{"{{baseUrl}}"}
+	for _, segment := range strings.Split(strings.Trim(request.path, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		if match := pathTemplateVariable.FindStringSubmatch(segment); match != nil && match[0] == segment {
+			segment = ":" + match[1]
+			target.Variable = append(target.Variable, postmanKeyValue{Key: match[1], Value: values[match[1]]})
+		} else {
+			segment = samplePath(segment, request.pathParams)
+		}
+		target.Path = append(target.Path, segment)
+	}
+
+	var query []string
+	for _, param := range request.query {
+		target.Query = append(target.Query, postmanKeyValue{
+			Key:         param.name,
+			Value:       param.value,
+			Description: param.description,
+			Disabled:    !param.required,
+		})
+		if param.required {
+			query = append(query, param.name+"="+param.value)
+		}
+	}
+	target.Raw = "{{baseUrl}}/" + strings.Join(target.Path, "/")
+	if len(query) > 0 {
+		target.Raw += "?" + strings.Join(query, "&")
+	}
+
+	for _, header := range request.headers {
+		rendered.Header = append(rendered.Header, postmanKeyValue{Key: header.name, Value: header.value, Description: header.description})
+	}
+	if request.mediaType == "" {
+		return rendered
+	}
+	if !strings.HasPrefix(request.mediaType, "multipart/") {
+		rendered.Header = append(rendered.Header, postmanKeyValue{Key: "Content-Type", Value: request.mediaType})
+	}
+
+	switch {
+	case request.mediaType == "application/x-www-form-urlencoded":
+		rendered.Body = &postmanBody{Mode: "urlencoded", URLEncoded: []postmanKeyValue{}}
+		for _, field := range request.form {
+			rendered.Body.URLEncoded = append(rendered.Body.URLEncoded, postmanKeyValue{Key: field.name, Value: field.value})
+		}
+	case strings.HasPrefix(request.mediaType, "multipart/"):
+		rendered.Body = &postmanBody{Mode: "formdata", FormData: []postmanKeyValue{}}
+		for _, field := range request.form {
+			rendered.Body.FormData = append(rendered.Body.FormData, postmanKeyValue{Key: field.name, Value: field.value, Type: "text"})
+		}
+	default:
+		rendered.Body = &postmanBody{Mode: "raw", Raw: request.body}
+		if isJSONMediaType(request.mediaType) {
+			rendered.Body.Options = map[string]interface{}{"raw": map[string]string{"language": "json"}}
+		}
+	}
+	return rendered
+}
+
+// harDocument is a HAR 1.2 log of sample requests and responses
+type harDocument struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string         `json:"mimeType"`
+	Text     string         `json:"text,omitempty"`
+	Params   []harNameValue `json:"params,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harDocumentFor builds a HAR entry for every operation of a spec from its
+// sample request and main response. Sizes that are not known are -1.
+func harDocumentFor(spec *models.APISpec, now time.Time) *harDocument {
+	doc := &harDocument{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "scopeapi-api-discovery", Version: "1.0"},
+		Entries: []harEntry{},
+	}}
+	baseURL := exportBaseURL(spec)
+	started := now.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+
+	for _, request := range sampleRequests(spec) {
+		entry := harEntry{
+			StartedDateTime: started,
+			Comment:         request.name,
+			Request: harRequest{
+				Method:      request.method,
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []harNameValue{},
+				Headers:     []harNameValue{},
+				QueryString: []harNameValue{},
+				HeadersSize: -1,
+			},
+			Response: harResponse{
+				Status:      request.status,
+				StatusText:  http.StatusText(request.status),
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []harNameValue{},
+				Headers:     []harNameValue{},
+				HeadersSize: -1,
+			},
+		}
+
+		target := baseURL + samplePath(request.path, request.pathParams)
+		var query []string
+		for _, param := range request.query {
+			entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: param.name, Value: param.value})
+			query = append(query, url.QueryEscape(param.name)+"="+url.QueryEscape(param.value))
+		}
+		if len(query) > 0 {
+			target += "?" + strings.Join(query, "&")
+		}
+		entry.Request.URL = target
+
+		for _, header := range request.headers {
+			entry.Request.Headers = append(entry.Request.Headers, harNameValue{Name: header.name, Value: header.value})
+		}
+		if request.mediaType != "" {
+			entry.Request.Headers = append(entry.Request.Headers, harNameValue{Name: "Content-Type", Value: request.mediaType})
+			postData := &harPostData{MimeType: request.mediaType, Text: request.body}
+			if request.form != nil {
+				// Form bodies are listed as params; the two are exclusive
+				postData.Params = make([]harNameValue, 0, len(request.form))
+				form := url.Values{}
+				for _, field := range request.form {
+					postData.Params = append(postData.Params, harNameValue{Name: field.name, Value: field.value})
+					form.Add(field.name, field.value)
+				}
+				entry.Request.BodySize = -1
+				if request.mediaType == "application/x-www-form-urlencoded" {
+					entry.Request.BodySize = len(form.Encode())
+				}
+			} else {
+				entry.Request.BodySize = len(request.body)
+			}
+			entry.Request.PostData = postData
+		}
+
+		entry.Response.Content = harContent{Size: len(request.response), MimeType: request.responseType, Text: request.response}
+		entry.Response.BodySize = len(request.response)
+		if request.responseType != "" {
+			entry.Response.Headers = append(entry.Response.Headers, harNameValue{Name: "Content-Type", Value: request.responseType})
+		} else {
+			entry.Response.Content.MimeType = "x-unknown"
+		}
+
+		doc.Log.Entries = append(doc.Log.Entries, entry)
+	}
+	return doc
+}
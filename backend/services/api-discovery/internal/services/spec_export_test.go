@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+func TestExportAPISpec(t *testing.T) {
+	repo := newMemoryDiscoveryRepository()
+	service := NewMetadataService(repo, NewPathInferenceEngine(), nil, logging.NewStructuredLogger("test"))
+	ctx := context.Background()
+
+	for _, id := range []string{"12", "13"} {
+		repo.endpoints["get-"+id] = models.Endpoint{
+			ID: "get-" + id, APIID: "api", Method: "GET", URL: "https://shop.example.com/orders/" + id, Path: "/orders/" + id,
+			Tags: []string{"orders"}, StatusCodes: []int{200, 404},
+			Parameters: []models.Parameter{{Name: "expand", In: "query", Type: "string"}, {Name: "Accept", In: "header", Type: "string"}},
+		}
+	}
+	repo.endpoints["create"] = models.Endpoint{
+		ID: "create", APIID: "api", Method: "POST", URL: "https://shop.example.com/orders", Path: "/orders", StatusCodes: []int{201},
+		Parameters: []models.Parameter{{Name: "sku", In: "body", Type: "string"}, {Name: "items[].quantity", In: "body", Type: "integer"}},
+	}
+	repo.schemas = append(repo.schemas, models.EndpointSchema{
+		ID: "s", EndpointID: "get-12", APIID: "api", Version: 1,
+		ResponseSchemas: map[string]*models.Schema{"200": {Type: "object", Properties: map[string]*models.Schema{
+			"id":   {Type: "integer"},
+			"note": {Type: "string", Nullable: true},
+		}}},
+	})
+
+	if _, err := service.ExportAPISpec(ctx, "api", "wsdl"); !errors.Is(err, ErrUnsupportedExportFormat) {
+		t.Fatalf("unsupported format error = %v", err)
+	}
+
+	// OpenAPI JSON
+	export, err := service.ExportAPISpec(ctx, "api", SpecExportJSON)
+	if err != nil {
+		t.Fatalf("export JSON: %v", err)
+	}
+	if export.Filename != "api.openapi.json" || export.ContentType != "application/json" {
+		t.Errorf("export = %s %s", export.Filename, export.ContentType)
+	}
+	validateOpenAPI(t, export.Data)
+	var document map[string]interface{}
+	if err := json.Unmarshal(export.Data, &document); err != nil {
+		t.Fatalf("decode JSON: %v", err)
+	}
+	if document["openapi"] != "3.1.0" || lookup(document, "servers", 0, "url") != "https://shop.example.com" {
+		t.Errorf("document = %v %v", document["openapi"], document["servers"])
+	}
+	order := lookup(document, "paths", "/orders/{orderId}").(map[string]interface{})
+	if lookup(order, "parameters", 0, "name") != "orderId" || lookup(order, "parameters", 0, "required") != true {
+		t.Errorf("path parameters = %v", order["parameters"])
+	}
+	if params := lookup(order, "get", "parameters").([]interface{}); len(params) != 1 || lookup(params, 0, "name") != "expand" {
+		t.Errorf("operation parameters = %v", params)
+	}
+	if ref := lookup(order, "get", "responses", "200", "content", "application/json", "schema", "$ref"); ref != "#/components/schemas/GetOrdersResponse" {
+		t.Errorf("200 schema = %v", ref)
+	}
+	if lookup(order, "get", "responses", "404", "description") != "Observed response" {
+		t.Errorf("404 response = %v", lookup(order, "get", "responses"))
+	}
+	note := lookup(document, "components", "schemas", "GetOrdersResponse", "properties", "note", "type")
+	if types, ok := note.([]interface{}); !ok || len(types) != 2 || types[1] != "null" {
+		t.Errorf("nullable type = %v", note)
+	}
+	create := lookup(document, "paths", "/orders", "post").(map[string]interface{})
+	if create["parameters"] != nil {
+		t.Errorf("body fields left as parameters: %v", create["parameters"])
+	}
+	schema := lookup(create, "requestBody", "content", "application/json", "schema")
+	if lookup(schema, "properties", "items", "items", "properties", "quantity", "type") != "integer" {
+		t.Errorf("request body schema = %v", schema)
+	}
+
+	// OpenAPI YAML reads back as a spec
+	export, err = service.ExportAPISpec(ctx, "api", SpecExportYAML)
+	if err != nil {
+		t.Fatalf("export YAML: %v", err)
+	}
+	validateOpenAPI(t, export.Data)
+	spec, format, warnings, err := parseSpecDocument(export.Data)
+	if err != nil || format != "openapi" || spec.OpenAPIVersion != "3.1.0" || len(warnings) != 0 {
+		t.Fatalf("YAML import = %v %s %v", err, format, warnings)
+	}
+	if spec.Paths["/orders/{orderId}"].Get == nil || spec.Paths["/orders"].Post.RequestBody == nil {
+		t.Errorf("YAML paths = %+v", spec.Paths)
+	}
+
+	// Postman collection
+	export, err = service.ExportAPISpec(ctx, "api", SpecExportPostman)
+	if err != nil {
+		t.Fatalf("export Postman: %v", err)
+	}
+	var collection postmanCollection
+	if err := json.Unmarshal(export.Data, &collection); err != nil {
+		t.Fatalf("decode Postman: %v", err)
+	}
+	if collection.Info.Schema != postmanSchemaURL || collection.Variable[0].Value != "https://shop.example.com" {
+		t.Errorf("collection = %+v", collection.Info)
+	}
+	if len(collection.Item) != 2 || collection.Item[0].Name != "orders" || len(collection.Item[0].Item) != 1 {
+		t.Fatalf("items = %+v", collection.Item)
+	}
+	getOrder := collection.Item[0].Item[0].Request
+	if getOrder.URL.Raw != "{{baseUrl}}/orders/:orderId" || getOrder.URL.Variable[0].Key != "orderId" || !getOrder.URL.Query[0].Disabled {
+		t.Errorf("GET url = %+v", getOrder.URL)
+	}
+	createOrder := collection.Item[1].Request
+	if createOrder.Method != "POST" || createOrder.Body == nil || !strings.Contains(createOrder.Body.Raw, `"sku": "string"`) {
+		t.Errorf("POST request = %+v", createOrder)
+	}
+
+	// HAR
+	export, err = service.ExportAPISpec(ctx, "api", SpecExportHAR)
+	if err != nil {
+		t.Fatalf("export HAR: %v", err)
+	}
+	var har harDocument
+	if err := json.Unmarshal(export.Data, &har); err != nil {
+		t.Fatalf("decode HAR: %v", err)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 2 {
+		t.Fatalf("HAR log = %+v", har.Log)
+	}
+	post, get := har.Log.Entries[0], har.Log.Entries[1]
+	if post.Request.URL != "https://shop.example.com/orders" || post.Request.PostData == nil || post.Response.Status != 201 {
+		t.Errorf("POST entry = %+v", post)
+	}
+	if !strings.HasPrefix(get.Request.URL, "https://shop.example.com/orders/1") || !strings.Contains(get.Request.URL, "?expand=string") {
+		t.Errorf("GET url = %s", get.Request.URL)
+	}
+	if get.Response.Status != 200 || get.Response.Content.MimeType != "application/json" || !strings.Contains(get.Response.Content.Text, `"id": 1`) {
+		t.Errorf("GET response = %+v", get.Response)
+	}
+}
+
+// validateOpenAPI checks an exported document against the OpenAPI
+// specification, including its $refs and examples. kin-openapi validates
+// schemas as OpenAPI 3.0 does, so 3.1 "null" types are checked here and then
+// folded into nullable.
+func validateOpenAPI(t *testing.T, data []byte) {
+	t.Helper()
+	loader := openapi3.NewLoader()
+	document, err := loader.LoadFromData(data)
+	if err != nil {
+		t.Fatalf("load exported OpenAPI document: %v", err)
+	}
+	if !strings.HasPrefix(document.OpenAPI, "3.1.") {
+		t.Errorf("openapi = %q, want 3.1", document.OpenAPI)
+	}
+
+	seen := make(map[*openapi3.Schema]bool)
+	if document.Components != nil {
+		for _, schema := range document.Components.Schemas {
+			foldNullType(t, schema, seen)
+		}
+	}
+	for _, item := range document.Paths.Map() {
+		for _, param := range item.Parameters {
+			foldNullType(t, param.Value.Schema, seen)
+		}
+		for _, operation := range item.Operations() {
+			for _, param := range operation.Parameters {
+				foldNullType(t, param.Value.Schema, seen)
+			}
+			if operation.RequestBody != nil {
+				for _, media := range operation.RequestBody.Value.Content {
+					foldNullType(t, media.Schema, seen)
+				}
+			}
+			for _, response := range operation.Responses.Map() {
+				for _, media := range response.Value.Content {
+					foldNullType(t, media.Schema, seen)
+				}
+			}
+		}
+	}
+
+	if err := document.Validate(loader.Context, openapi3.EnableExamplesValidation()); err != nil {
+		t.Errorf("exported OpenAPI document is invalid: %v", err)
+	}
+}
+
+// foldNullType rewrites a 3.1 type such as ["string", "null"] as the nullable
+// 3.0 type kin-openapi validates, rejecting nullable in the exported schema
+func foldNullType(t *testing.T, ref *openapi3.SchemaRef, seen map[*openapi3.Schema]bool) {
+	if ref == nil || ref.Value == nil || seen[ref.Value] {
+		return
+	}
+	schema := ref.Value
+	seen[schema] = true
+	if schema.Nullable {
+		t.Errorf("schema uses nullable, which OpenAPI 3.1 replaced with a null type")
+	}
+	if schema.Type != nil && schema.Type.Includes(openapi3.TypeNull) {
+		var types openapi3.Types
+		for _, schemaType := range schema.Type.Slice() {
+			if schemaType != openapi3.TypeNull {
+				types = append(types, schemaType)
+			}
+		}
+		schema.Type = &types
+		schema.Nullable = true
+	}
+
+	foldNullType(t, schema.Items, seen)
+	foldNullType(t, schema.Not, seen)
+	foldNullType(t, schema.AdditionalProperties.Schema, seen)
+	for _, property := range schema.Properties {
+		foldNullType(t, property, seen)
+	}
+	for _, list := range []openapi3.SchemaRefs{schema.OneOf, schema.AnyOf, schema.AllOf} {
+		for _, item := range list {
+			foldNullType(t, item, seen)
+		}
+	}
+}
+
+// lookup follows map keys and slice indexes through decoded JSON
+func lookup(value interface{}, path ...interface{}) interface{} {
+	for _, step := range path {
+		switch key := step.(type) {
+		case string:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			value = object[key]
+		case int:
+			list, ok := value.([]interface{})
+			if !ok || key >= len(list) {
+				return nil
+			}
+			value = list[key]
+		}
+	}
+	return value
+}
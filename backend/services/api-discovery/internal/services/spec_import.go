@@ -0,0 +1,924 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+)
+
+const (
+	// maxSpecDocumentBytes bounds the size of an uploaded API description
+	maxSpecDocumentBytes = 16 << 20
+	// maxRefDepth bounds how many $refs are followed to resolve one object
+	maxRefDepth = 16
+)
+
+// specDocument is an OpenAPI 3.0/3.1 or Swagger 2.0 document as written,
+// before it is converted to the inventory's spec types
+type specDocument struct {
+	OpenAPI      flexString                    `json:"openapi"`
+	Swagger      flexString                    `json:"swagger"`
+	Info         specInfoDoc                   `json:"info"`
+	Servers      []specServerDoc               `json:"servers"`
+	Paths        map[string]*specPathItemDoc   `json:"paths"`
+	Components   specComponentsDoc             `json:"components"`
+	Security     []models.SecurityRequirement  `json:"security"`
+	Tags         []specTagDoc                  `json:"tags"`
+	ExternalDocs *models.ExternalDocumentation `json:"externalDocs"`
+
+	// Swagger 2.0
+	Host                string                            `json:"host"`
+	BasePath            string                            `json:"basePath"`
+	Schemes             []string                          `json:"schemes"`
+	Consumes            []string                          `json:"consumes"`
+	Definitions         map[string]*specSchemaDoc         `json:"definitions"`
+	Parameters          map[string]*specParameterDoc      `json:"parameters"`
+	Responses           map[string]*specResponseDoc       `json:"responses"`
+	SecurityDefinitions map[string]*specSecuritySchemeDoc `json:"securityDefinitions"`
+}
+
+type specInfoDoc struct {
+	Title          string          `json:"title"`
+	Description    string          `json:"description"`
+	Version        flexString      `json:"version"`
+	TermsOfService string          `json:"termsOfService"`
+	Contact        *models.Contact `json:"contact"`
+	License        *models.License `json:"license"`
+}
+
+type specServerDoc struct {
+	URL         string `json:"url"`
+	Description string `json:"description"`
+	Variables   map[string]struct {
+		Enum        []string   `json:"enum"`
+		Default     flexString `json:"default"`
+		Description string     `json:"description"`
+	} `json:"variables"`
+}
+
+type specTagDoc struct {
+	Name         string                        `json:"name"`
+	Description  string                        `json:"description"`
+	ExternalDocs *models.ExternalDocumentation `json:"externalDocs"`
+}
+
+type specComponentsDoc struct {
+	Schemas         map[string]*specSchemaDoc         `json:"schemas"`
+	Parameters      map[string]*specParameterDoc      `json:"parameters"`
+	Responses       map[string]*specResponseDoc       `json:"responses"`
+	RequestBodies   map[string]*specRequestBodyDoc    `json:"requestBodies"`
+	SecuritySchemes map[string]*specSecuritySchemeDoc `json:"securitySchemes"`
+}
+
+type specPathItemDoc struct {
+	Ref         string              `json:"$ref"`
+	Summary     string              `json:"summary"`
+	Description string              `json:"description"`
+	Parameters  []*specParameterDoc `json:"parameters"`
+	Get         *specOperationDoc   `json:"get"`
+	Put         *specOperationDoc   `json:"put"`
+	Post        *specOperationDoc   `json:"post"`
+	Delete      *specOperationDoc   `json:"delete"`
+	Options     *specOperationDoc   `json:"options"`
+	Head        *specOperationDoc   `json:"head"`
+	Patch       *specOperationDoc   `json:"patch"`
+	Trace       *specOperationDoc   `json:"trace"`
+}
+
+type specOperationDoc struct {
+	Tags        []string                     `json:"tags"`
+	Summary     string                       `json:"summary"`
+	Description string                       `json:"description"`
+	OperationID string                       `json:"operationId"`
+	Parameters  []*specParameterDoc          `json:"parameters"`
+	RequestBody *specRequestBodyDoc          `json:"requestBody"`
+	Responses   map[string]*specResponseDoc  `json:"responses"`
+	Deprecated  bool                         `json:"deprecated"`
+	Security    []models.SecurityRequirement `json:"security"`
+	Consumes    []string                     `json:"consumes"`
+}
+
+type specParameterDoc struct {
+	Ref         string         `json:"$ref"`
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description"`
+	Required    bool           `json:"required"`
+	Schema      *specSchemaDoc `json:"schema"`
+	Example     interface{}    `json:"example"`
+
+	// Swagger 2.0 describes non-body parameters inline
+	Type    string         `json:"type"`
+	Format  string         `json:"format"`
+	Items   *specSchemaDoc `json:"items"`
+	Enum    []interface{}  `json:"enum"`
+	Default interface{}    `json:"default"`
+}
+
+type specRequestBodyDoc struct {
+	Ref         string                      `json:"$ref"`
+	Description string                      `json:"description"`
+	Required    bool                        `json:"required"`
+	Content     map[string]specMediaTypeDoc `json:"content"`
+}
+
+type specMediaTypeDoc struct {
+	Schema  *specSchemaDoc `json:"schema"`
+	Example interface{}    `json:"example"`
+}
+
+type specResponseDoc struct {
+	Ref         string                      `json:"$ref"`
+	Description string                      `json:"description"`
+	Headers     map[string]specHeaderDoc    `json:"headers"`
+	Content     map[string]specMediaTypeDoc `json:"content"`
+
+	// Swagger 2.0
+	Schema   *specSchemaDoc         `json:"schema"`
+	Examples map[string]interface{} `json:"examples"`
+}
+
+type specHeaderDoc struct {
+	Description string `json:"description"`
+}
+
+type specSchemaDoc struct {
+	Ref                  string                    `json:"$ref"`
+	Type                 specTypes                 `json:"type"`
+	Format               string                    `json:"format"`
+	Title                string                    `json:"title"`
+	Description          string                    `json:"description"`
+	Default              interface{}               `json:"default"`
+	Example              interface{}               `json:"example"`
+	Required             specNames                 `json:"required"`
+	Properties           map[string]*specSchemaDoc `json:"properties"`
+	Items                *specSchemaDoc            `json:"items"`
+	AdditionalProperties json.RawMessage           `json:"additionalProperties"`
+	Enum                 []interface{}             `json:"enum"`
+	Minimum              *float64                  `json:"minimum"`
+	Maximum              *float64                  `json:"maximum"`
+	MinLength            *int                      `json:"minLength"`
+	MaxLength            *int                      `json:"maxLength"`
+	Pattern              string                    `json:"pattern"`
+	MinItems             *int                      `json:"minItems"`
+	MaxItems             *int                      `json:"maxItems"`
+	UniqueItems          bool                      `json:"uniqueItems"`
+	OneOf                []*specSchemaDoc          `json:"oneOf"`
+	AnyOf                []*specSchemaDoc          `json:"anyOf"`
+	AllOf                []*specSchemaDoc          `json:"allOf"`
+	Nullable             bool                      `json:"nullable"`
+	XNullable            bool                      `json:"x-nullable"`
+}
+
+type specSecuritySchemeDoc struct {
+	Type             string `json:"type"`
+	Description      string `json:"description"`
+	Name             string `json:"name"`
+	In               string `json:"in"`
+	Scheme           string `json:"scheme"`
+	BearerFormat     string `json:"bearerFormat"`
+	OpenIDConnectURL string `json:"openIdConnectUrl"`
+	Flows            map[string]struct {
+		AuthorizationURL string            `json:"authorizationUrl"`
+		TokenURL         string            `json:"tokenUrl"`
+		RefreshURL       string            `json:"refreshUrl"`
+		Scopes           map[string]string `json:"scopes"`
+	} `json:"flows"`
+
+	// Swagger 2.0
+	Flow             string            `json:"flow"`
+	AuthorizationURL string            `json:"authorizationUrl"`
+	TokenURL         string            `json:"tokenUrl"`
+	Scopes           map[string]string `json:"scopes"`
+}
+
+// flexString accepts a string or a number, as YAML documents often leave
+// versions unquoted
+type flexString string
+
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case string:
+		*f = flexString(v)
+	case float64:
+		text := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.Contains(text, ".") {
+			text += ".0"
+		}
+		*f = flexString(text)
+	}
+	return nil
+}
+
+// specTypes is a schema type, given as one name or, in OpenAPI 3.1, a list
+type specTypes []string
+
+func (t *specTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = specTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("invalid schema type %s", data)
+	}
+	*t = list
+	return nil
+}
+
+// specNames is a list of required property names. Other values, such as the
+// "required: true" some Swagger documents put on properties, are ignored.
+type specNames []string
+
+func (n *specNames) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err == nil {
+		*n = names
+	}
+	return nil
+}
+
+// parseSpecDocument parses an OpenAPI 3.0/3.1 or Swagger 2.0 document, in JSON
+// or YAML, into the inventory's spec types. It returns the format ("openapi" or
+// "swagger") and warnings about the parts that could not be converted.
+func parseSpecDocument(document []byte) (*models.APISpec, string, []string, error) {
+	if len(document) == 0 {
+		return nil, "", nil, fmt.Errorf("empty API description")
+	}
+	if len(document) > maxSpecDocumentBytes {
+		return nil, "", nil, fmt.Errorf("API description exceeds %d bytes", maxSpecDocumentBytes)
+	}
+
+	// YAML is a superset of JSON, so one decoder reads both
+	var raw interface{}
+	if err := yaml.Unmarshal(document, &raw); err != nil {
+		return nil, "", nil, fmt.Errorf("invalid API description: %w", err)
+	}
+	encoded, err := json.Marshal(normalizeYAML(raw))
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("invalid API description: %w", err)
+	}
+	var doc specDocument
+	if err := json.Unmarshal(encoded, &doc); err != nil {
+		return nil, "", nil, fmt.Errorf("invalid API description: %w", err)
+	}
+
+	converter := &specConverter{doc: &doc}
+	switch {
+	case strings.HasPrefix(string(doc.OpenAPI), "3.0.") || strings.HasPrefix(string(doc.OpenAPI), "3.1."):
+		converter.format = "openapi"
+	case doc.OpenAPI != "":
+		return nil, "", nil, fmt.Errorf("unsupported OpenAPI version %q", doc.OpenAPI)
+	case doc.Swagger == "2.0":
+		converter.format = "swagger"
+	case doc.Swagger != "":
+		return nil, "", nil, fmt.Errorf("unsupported Swagger version %q", doc.Swagger)
+	default:
+		return nil, "", nil, fmt.Errorf("document is neither OpenAPI 3.x nor Swagger 2.0")
+	}
+
+	spec := converter.convert()
+	return spec, converter.format, converter.warnings, nil
+}
+
+// normalizeYAML turns the maps YAML decodes with non-string keys, such as
+// unquoted response codes, into JSON objects
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeYAML(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return converted
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+		return v
+	case time.Time:
+		// Unquoted dates, e.g. a version of 2024-01-31, stay as written
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	}
+	return value
+}
+
+type specConverter struct {
+	doc      *specDocument
+	format   string
+	warnings []string
+}
+
+func (c *specConverter) warn(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+func (c *specConverter) convert() *models.APISpec {
+	now := time.Now()
+	doc := c.doc
+
+	version := string(doc.OpenAPI)
+	if c.format == "swagger" {
+		version = "2.0"
+	}
+	spec := &models.APISpec{
+		ID:             uuid.New().String(),
+		Version:        string(doc.Info.Version),
+		Title:          doc.Info.Title,
+		Description:    doc.Info.Description,
+		OpenAPIVersion: version,
+		Info: &models.SpecInfo{
+			Title:          doc.Info.Title,
+			Description:    doc.Info.Description,
+			Version:        string(doc.Info.Version),
+			TermsOfService: doc.Info.TermsOfService,
+			Contact:        doc.Info.Contact,
+			License:        doc.Info.License,
+		},
+		Servers:      c.servers(),
+		Paths:        make(map[string]*models.PathItem, len(doc.Paths)),
+		Components:   c.components(),
+		Security:     doc.Security,
+		ExternalDocs: doc.ExternalDocs,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	for _, tag := range doc.Tags {
+		spec.Tags = append(spec.Tags, models.SpecTag{Name: tag.Name, Description: tag.Description, ExternalDocs: tag.ExternalDocs})
+	}
+
+	if len(doc.Paths) == 0 {
+		c.warn("the document describes no paths")
+	}
+	for path, item := range doc.Paths {
+		if item == nil {
+			continue
+		}
+		if item.Ref != "" {
+			c.warn("path %s: external path item $ref %q is not followed", path, item.Ref)
+			continue
+		}
+		spec.Paths[path] = c.pathItem(path, item)
+	}
+	return spec
+}
+
+func (c *specConverter) servers() []models.SpecServer {
+	if c.format == "swagger" {
+		if c.doc.Host == "" {
+			if c.doc.BasePath == "" {
+				return nil
+			}
+			return []models.SpecServer{{URL: c.doc.BasePath}}
+		}
+		schemes := c.doc.Schemes
+		if len(schemes) == 0 {
+			schemes = []string{"https"}
+		}
+		servers := make([]models.SpecServer, 0, len(schemes))
+		for _, scheme := range schemes {
+			servers = append(servers, models.SpecServer{URL: scheme + "://" + c.doc.Host + c.doc.BasePath})
+		}
+		return servers
+	}
+
+	servers := make([]models.SpecServer, 0, len(c.doc.Servers))
+	for _, server := range c.doc.Servers {
+		converted := models.SpecServer{URL: server.URL, Description: server.Description}
+		if len(server.Variables) > 0 {
+			converted.Variables = make(map[string]models.ServerVariable, len(server.Variables))
+			for name, variable := range server.Variables {
+				converted.Variables[name] = models.ServerVariable{
+					Enum:        variable.Enum,
+					Default:     string(variable.Default),
+					Description: variable.Description,
+				}
+			}
+		}
+		servers = append(servers, converted)
+	}
+	return servers
+}
+
+func (c *specConverter) components() *models.SpecComponents {
+	components := &models.SpecComponents{
+		Schemas:         make(map[string]*models.Schema),
+		Responses:       make(map[string]models.Response),
+		Parameters:      make(map[string]models.Parameter),
+		RequestBodies:   make(map[string]models.RequestBody),
+		SecuritySchemes: make(map[string]models.SecurityScheme),
+	}
+
+	schemas, parameters, responses, schemes := c.doc.Components.Schemas, c.doc.Components.Parameters, c.doc.Components.Responses, c.doc.Components.SecuritySchemes
+	if c.format == "swagger" {
+		schemas, parameters, responses, schemes = c.doc.Definitions, c.doc.Parameters, c.doc.Responses, c.doc.SecurityDefinitions
+	}
+	for name, schema := range schemas {
+		components.Schemas[name] = c.schema(schema, 0)
+	}
+	for name, parameter := range parameters {
+		if parameter != nil && parameter.In != "body" && parameter.In != "formData" {
+			components.Parameters[name] = c.parameter(parameter)
+		}
+	}
+	for name, response := range responses {
+		if response != nil {
+			components.Responses[name] = c.response(name, response)
+		}
+	}
+	for name, body := range c.doc.Components.RequestBodies {
+		if resolved := c.resolveRequestBody(body); resolved != nil {
+			components.RequestBodies[name] = c.requestBody(resolved)
+		}
+	}
+	for name, scheme := range schemes {
+		if scheme != nil {
+			components.SecuritySchemes[name] = c.securityScheme(scheme)
+		}
+	}
+	return components
+}
+
+func (c *specConverter) pathItem(path string, item *specPathItemDoc) *models.PathItem {
+	converted := &models.PathItem{Summary: item.Summary, Description: item.Description}
+	for _, parameter := range item.Parameters {
+		if resolved := c.resolveParameter(parameter); resolved != nil && resolved.In != "body" && resolved.In != "formData" {
+			converted.Parameters = append(converted.Parameters, c.parameter(resolved))
+		}
+	}
+
+	operations := []struct {
+		doc    *specOperationDoc
+		target **models.Operation
+	}{
+		{item.Get, &converted.Get}, {item.Put, &converted.Put}, {item.Post, &converted.Post}, {item.Delete, &converted.Delete},
+		{item.Options, &converted.Options}, {item.Head, &converted.Head}, {item.Patch, &converted.Patch}, {item.Trace, &converted.Trace},
+	}
+	for _, operation := range operations {
+		if operation.doc != nil {
+			*operation.target = c.operation(path, item, operation.doc)
+		}
+	}
+	return converted
+}
+
+func (c *specConverter) operation(path string, item *specPathItemDoc, doc *specOperationDoc) *models.Operation {
+	operation := &models.Operation{
+		Tags:        doc.Tags,
+		Summary:     doc.Summary,
+		Description: doc.Description,
+		OperationID: doc.OperationID,
+		Deprecated:  doc.Deprecated,
+		Security:    doc.Security,
+		Responses:   make(map[string]models.Response, len(doc.Responses)),
+	}
+
+	// Swagger 2.0 describes request bodies as body and formData parameters,
+	// which may also be declared on the path item
+	var body *specParameterDoc
+	var formData []*specParameterDoc
+	for _, parameter := range append(append([]*specParameterDoc{}, item.Parameters...), doc.Parameters...) {
+		resolved := c.resolveParameter(parameter)
+		if resolved == nil {
+			continue
+		}
+		switch resolved.In {
+		case "body":
+			body = resolved
+		case "formData":
+			formData = append(formData, resolved)
+		}
+	}
+	for _, parameter := range doc.Parameters {
+		if resolved := c.resolveParameter(parameter); resolved != nil && resolved.In != "body" && resolved.In != "formData" {
+			operation.Parameters = append(operation.Parameters, c.parameter(resolved))
+		}
+	}
+
+	switch {
+	case doc.RequestBody != nil:
+		if resolved := c.resolveRequestBody(doc.RequestBody); resolved != nil {
+			requestBody := c.requestBody(resolved)
+			operation.RequestBody = &requestBody
+		}
+	case body != nil:
+		content := make(map[string]models.MediaType)
+		for _, mediaType := range c.consumes(doc) {
+			content[mediaType] = models.MediaType{Schema: c.schema(body.Schema, 0)}
+		}
+		operation.RequestBody = &models.RequestBody{Description: body.Description, Required: body.Required, Content: content}
+	case len(formData) > 0:
+		operation.RequestBody = c.formRequestBody(doc, formData)
+	}
+
+	for code, response := range doc.Responses {
+		if response == nil {
+			continue
+		}
+		operation.Responses[code] = c.response(code, response)
+	}
+	if len(operation.Responses) == 0 {
+		c.warn("%s: operation %q documents no responses", path, doc.OperationID)
+	}
+	return operation
+}
+
+// formRequestBody turns Swagger 2.0 formData parameters into an object schema
+func (c *specConverter) formRequestBody(doc *specOperationDoc, parameters []*specParameterDoc) *models.RequestBody {
+	mediaType := "application/x-www-form-urlencoded"
+	for _, consumed := range c.consumes(doc) {
+		if consumed == "multipart/form-data" {
+			mediaType = consumed
+		}
+	}
+	schema := &models.Schema{Type: "object", Properties: make(map[string]*models.Schema, len(parameters))}
+	required := false
+	for _, parameter := range parameters {
+		if parameter.Type == "file" {
+			mediaType = "multipart/form-data"
+		}
+		schema.Properties[parameter.Name] = c.inlineSchema(parameter)
+		if parameter.Required {
+			schema.Required = append(schema.Required, parameter.Name)
+			required = true
+		}
+	}
+	sort.Strings(schema.Required)
+	return &models.RequestBody{Required: required, Content: map[string]models.MediaType{mediaType: {Schema: schema}}}
+}
+
+func (c *specConverter) consumes(doc *specOperationDoc) []string {
+	if len(doc.Consumes) > 0 {
+		return doc.Consumes
+	}
+	if len(c.doc.Consumes) > 0 {
+		return c.doc.Consumes
+	}
+	return []string{"application/json"}
+}
+
+func (c *specConverter) parameter(doc *specParameterDoc) models.Parameter {
+	schema := c.inlineSchema(doc)
+	if doc.Schema != nil {
+		schema = c.schema(doc.Schema, 0)
+	}
+	parameter := models.Parameter{
+		Name:        doc.Name,
+		In:          doc.In,
+		Type:        schema.Type,
+		Required:    doc.Required || doc.In == "path",
+		Description: doc.Description,
+		Example:     doc.Example,
+		Schema:      schemaToMap(schema),
+	}
+	if parameter.Example == nil {
+		parameter.Example = schema.Example
+	}
+	return parameter
+}
+
+// inlineSchema is the schema of a Swagger 2.0 parameter that has no schema
+func (c *specConverter) inlineSchema(doc *specParameterDoc) *models.Schema {
+	schema := &models.Schema{Type: doc.Type, Format: doc.Format, Enum: doc.Enum, Default: doc.Default}
+	if doc.Type == "file" {
+		schema.Type, schema.Format = "string", "binary"
+	}
+	if doc.Items != nil {
+		schema.Items = c.schema(doc.Items, 0)
+	}
+	return schema
+}
+
+func (c *specConverter) requestBody(doc *specRequestBodyDoc) models.RequestBody {
+	body := models.RequestBody{Description: doc.Description, Required: doc.Required, Content: make(map[string]models.MediaType, len(doc.Content))}
+	for mediaType, content := range doc.Content {
+		body.Content[mediaType] = models.MediaType{Schema: c.schema(content.Schema, 0), Example: content.Example}
+	}
+	return body
+}
+
+func (c *specConverter) response(code string, doc *specResponseDoc) models.Response {
+	resolved := c.resolveResponse(doc)
+	if resolved == nil {
+		return models.Response{Description: doc.Description}
+	}
+	response := models.Response{Description: resolved.Description, Examples: resolved.Examples}
+	if status, err := strconv.Atoi(code); err == nil {
+		response.StatusCode = status
+	}
+	if len(resolved.Headers) > 0 {
+		response.Headers = make(map[string]string, len(resolved.Headers))
+		for name, header := range resolved.Headers {
+			response.Headers[name] = header.Description
+		}
+	}
+
+	schema := resolved.Schema
+	if len(resolved.Content) > 0 {
+		mediaType := primaryMediaType(resolved.Content)
+		schema = resolved.Content[mediaType].Schema
+		if example := resolved.Content[mediaType].Example; example != nil {
+			response.Examples = map[string]interface{}{mediaType: example}
+		}
+	}
+	if schema != nil {
+		response.Schema = schemaToMap(c.schema(schema, 0))
+	}
+	return response
+}
+
+// primaryMediaType prefers application/json, then any JSON type, then the
+// first media type in name order
+func primaryMediaType(content map[string]specMediaTypeDoc) string {
+	names := make([]string, 0, len(content))
+	for name := range content {
+		names = append(names, name)
+	}
+	return preferredMediaType(names)
+}
+
+func preferredMediaType(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == "application/json" {
+			return name
+		}
+	}
+	for _, name := range names {
+		if strings.Contains(name, "json") {
+			return name
+		}
+	}
+	return names[0]
+}
+
+func (c *specConverter) schema(doc *specSchemaDoc, depth int) *models.Schema {
+	if doc == nil {
+		return nil
+	}
+	if depth > maxSchemaDepth*2 {
+		c.warn("schema nesting deeper than %d levels was cut", maxSchemaDepth*2)
+		return &models.Schema{}
+	}
+	if doc.Ref != "" {
+		return &models.Schema{Ref: c.schemaRef(doc.Ref), Description: doc.Description}
+	}
+
+	schema := &models.Schema{
+		Format:      doc.Format,
+		Title:       doc.Title,
+		Description: doc.Description,
+		Default:     doc.Default,
+		Example:     doc.Example,
+		Required:    doc.Required,
+		Enum:        doc.Enum,
+		Minimum:     doc.Minimum,
+		Maximum:     doc.Maximum,
+		MinLength:   doc.MinLength,
+		MaxLength:   doc.MaxLength,
+		Pattern:     doc.Pattern,
+		MinItems:    doc.MinItems,
+		MaxItems:    doc.MaxItems,
+		UniqueItems: doc.UniqueItems,
+		Nullable:    doc.Nullable || doc.XNullable,
+		Items:       c.schema(doc.Items, depth+1),
+	}
+
+	// OpenAPI 3.1 lists "null" among the types of a nullable value
+	var types []string
+	for _, name := range doc.Type {
+		if name == "null" {
+			schema.Nullable = true
+		} else {
+			types = append(types, name)
+		}
+	}
+	switch len(types) {
+	case 0:
+	case 1:
+		schema.Type = types[0]
+	default:
+		for _, name := range types {
+			schema.OneOf = append(schema.OneOf, &models.Schema{Type: name})
+		}
+	}
+
+	if len(doc.Properties) > 0 {
+		schema.Properties = make(map[string]*models.Schema, len(doc.Properties))
+		for name, property := range doc.Properties {
+			schema.Properties[name] = c.schema(property, depth+1)
+		}
+	}
+	if len(doc.AdditionalProperties) > 0 {
+		var allowed bool
+		var additional specSchemaDoc
+		if json.Unmarshal(doc.AdditionalProperties, &allowed) == nil {
+			schema.AdditionalProperties = allowed
+		} else if json.Unmarshal(doc.AdditionalProperties, &additional) == nil {
+			schema.AdditionalProperties = c.schema(&additional, depth+1)
+		}
+	}
+
+	// anyOf is kept as oneOf; the inventory does not tell them apart
+	for _, alternatives := range [][]*specSchemaDoc{doc.OneOf, doc.AnyOf} {
+		for _, alternative := range alternatives {
+			if alternative.isNull() {
+				schema.Nullable = true
+				continue
+			}
+			schema.OneOf = append(schema.OneOf, c.schema(alternative, depth+1))
+		}
+	}
+	// allOf parts are folded into one object
+	for _, part := range doc.AllOf {
+		c.foldSchema(schema, c.resolveSchema(part), depth+1)
+	}
+	return schema
+}
+
+func (s *specSchemaDoc) isNull() bool {
+	return s != nil && len(s.Type) == 1 && s.Type[0] == "null"
+}
+
+// foldSchema merges an allOf part into schema
+func (c *specConverter) foldSchema(schema *models.Schema, part *specSchemaDoc, depth int) {
+	if part == nil {
+		return
+	}
+	converted := c.schema(part, depth)
+	if schema.Type == "" {
+		schema.Type = converted.Type
+	}
+	if schema.Description == "" {
+		schema.Description = converted.Description
+	}
+	if len(converted.Properties) > 0 && schema.Properties == nil {
+		schema.Properties = make(map[string]*models.Schema, len(converted.Properties))
+	}
+	for name, property := range converted.Properties {
+		schema.Properties[name] = property
+	}
+	schema.Required = append(schema.Required, converted.Required...)
+	for _, part := range part.AllOf {
+		c.foldSchema(schema, c.resolveSchema(part), depth+1)
+	}
+}
+
+// schemaRef points a local reference at components, where Swagger 2.0
+// definitions are placed too
+func (c *specConverter) schemaRef(ref string) string {
+	if name := localRefName(ref, "#/definitions/"); name != "" {
+		return "#/components/schemas/" + name
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		c.warn("external schema $ref %q is not followed", ref)
+	}
+	return ref
+}
+
+func (c *specConverter) resolveSchema(doc *specSchemaDoc) *specSchemaDoc {
+	for depth := 0; doc != nil && doc.Ref != ""; depth++ {
+		name := localRefName(doc.Ref, "#/components/schemas/", "#/definitions/")
+		if name == "" || depth >= maxRefDepth {
+			c.warn("schema $ref %q could not be resolved", doc.Ref)
+			return nil
+		}
+		schemas := c.doc.Components.Schemas
+		if c.format == "swagger" {
+			schemas = c.doc.Definitions
+		}
+		doc = schemas[name]
+	}
+	return doc
+}
+
+func (c *specConverter) resolveParameter(doc *specParameterDoc) *specParameterDoc {
+	for depth := 0; doc != nil && doc.Ref != ""; depth++ {
+		name := localRefName(doc.Ref, "#/components/parameters/", "#/parameters/")
+		if name == "" || depth >= maxRefDepth {
+			c.warn("parameter $ref %q could not be resolved", doc.Ref)
+			return nil
+		}
+		parameters := c.doc.Components.Parameters
+		if c.format == "swagger" {
+			parameters = c.doc.Parameters
+		}
+		doc = parameters[name]
+	}
+	return doc
+}
+
+func (c *specConverter) resolveResponse(doc *specResponseDoc) *specResponseDoc {
+	for depth := 0; doc != nil && doc.Ref != ""; depth++ {
+		name := localRefName(doc.Ref, "#/components/responses/", "#/responses/")
+		if name == "" || depth >= maxRefDepth {
+			c.warn("response $ref %q could not be resolved", doc.Ref)
+			return nil
+		}
+		responses := c.doc.Components.Responses
+		if c.format == "swagger" {
+			responses = c.doc.Responses
+		}
+		doc = responses[name]
+	}
+	return doc
+}
+
+func (c *specConverter) resolveRequestBody(doc *specRequestBodyDoc) *specRequestBodyDoc {
+	for depth := 0; doc != nil && doc.Ref != ""; depth++ {
+		name := localRefName(doc.Ref, "#/components/requestBodies/")
+		if name == "" || depth >= maxRefDepth {
+			c.warn("request body $ref %q could not be resolved", doc.Ref)
+			return nil
+		}
+		doc = c.doc.Components.RequestBodies[name]
+	}
+	return doc
+}
+
+func (c *specConverter) securityScheme(doc *specSecuritySchemeDoc) models.SecurityScheme {
+	scheme := models.SecurityScheme{
+		Type:             doc.Type,
+		Description:      doc.Description,
+		Name:             doc.Name,
+		In:               doc.In,
+		Scheme:           doc.Scheme,
+		BearerFormat:     doc.BearerFormat,
+		OpenIDConnectURL: doc.OpenIDConnectURL,
+	}
+	flow := func(authorizationURL, tokenURL, refreshURL string, scopes map[string]string) *models.OAuthFlow {
+		return &models.OAuthFlow{AuthorizationURL: authorizationURL, TokenURL: tokenURL, RefreshURL: refreshURL, Scopes: scopes}
+	}
+
+	// Swagger 2.0 basic auth is an HTTP scheme, and its OAuth2 flows have other names
+	if doc.Type == "basic" {
+		scheme.Type, scheme.Scheme = "http", "basic"
+	}
+	if doc.Flow != "" {
+		scheme.Flows = &models.OAuthFlows{}
+		converted := flow(doc.AuthorizationURL, doc.TokenURL, "", doc.Scopes)
+		switch doc.Flow {
+		case "implicit":
+			scheme.Flows.Implicit = converted
+		case "password":
+			scheme.Flows.Password = converted
+		case "application":
+			scheme.Flows.ClientCredentials = converted
+		case "accessCode":
+			scheme.Flows.AuthorizationCode = converted
+		}
+	}
+	if len(doc.Flows) > 0 {
+		scheme.Flows = &models.OAuthFlows{}
+		for name, f := range doc.Flows {
+			converted := flow(f.AuthorizationURL, f.TokenURL, f.RefreshURL, f.Scopes)
+			switch name {
+			case "implicit":
+				scheme.Flows.Implicit = converted
+			case "password":
+				scheme.Flows.Password = converted
+			case "clientCredentials":
+				scheme.Flows.ClientCredentials = converted
+			case "authorizationCode":
+				scheme.Flows.AuthorizationCode = converted
+			}
+		}
+	}
+	return scheme
+}
+
+// localRefName returns the component name of a local $ref with one of the
+// given prefixes, or "" for any other reference
+func localRefName(ref string, prefixes ...string) string {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(ref, prefix) {
+			name := strings.TrimPrefix(ref, prefix)
+			// JSON pointer escapes
+			return strings.NewReplacer("~1", "/", "~0", "~").Replace(name)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"scopeapi.local/backend/services/api-discovery/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+const openAPI31Document = `
+openapi: 3.1.0
+info:
+  title: Shop
+  version: 2.1
+servers:
+  - url: https://shop.example.com/{basePath}
+    variables:
+      basePath:
+        default: v1
+paths:
+  /orders/{orderId}:
+    parameters:
+      - $ref: '#/components/parameters/OrderId'
+    get:
+      operationId: getOrder
+      parameters:
+        - name: expand
+          in: query
+          schema:
+            type: string
+      responses:
+        200:
+          description: The order
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Order'
+        404:
+          $ref: '#/components/responses/NotFound'
+  /orders:
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              properties:
+                sku: {type: string}
+                items:
+                  type: array
+                  items:
+                    type: object
+                    properties:
+                      quantity: {type: integer}
+      responses:
+        '201':
+          description: Created
+  /legacy/export:
+    get:
+      responses:
+        default:
+          description: Anything
+components:
+  parameters:
+    OrderId:
+      name: orderId
+      in: path
+      schema: {type: integer}
+  responses:
+    NotFound:
+      description: Not found
+  schemas:
+    Order:
+      type: object
+      required: [id, status]
+      properties:
+        id: {type: integer}
+        status: {type: string, enum: [open, shipped]}
+        note: {type: [string, "null"]}
+`
+
+const swagger2Document = `{
+  "swagger": "2.0",
+  "info": {"title": "Legacy", "version": "1.0"},
+  "host": "legacy.example.com",
+  "basePath": "/api",
+  "schemes": ["https"],
+  "securityDefinitions": {"basic": {"type": "basic"}},
+  "paths": {
+    "/users": {
+      "post": {
+        "parameters": [{"name": "body", "in": "body", "required": true, "schema": {"$ref": "#/definitions/User"}}],
+        "responses": {"200": {"description": "OK", "schema": {"$ref": "#/definitions/User"}}}
+      }
+    },
+    "/avatars": {
+      "post": {
+        "consumes": ["multipart/form-data"],
+        "parameters": [
+          {"name": "file", "in": "formData", "type": "file", "required": true},
+          {"name": "limit", "in": "query", "type": "integer"}
+        ],
+        "responses": {"204": {"description": "Stored"}}
+      }
+    }
+  },
+  "definitions": {
+    "User": {"type": "object", "properties": {"name": {"type": "string", "x-nullable": true}}}
+  }
+}`
+
+func TestParseSpecDocument(t *testing.T) {
+	spec, format, warnings, err := parseSpecDocument([]byte(openAPI31Document))
+	if err != nil {
+		t.Fatalf("parse OpenAPI: %v", err)
+	}
+	if format != "openapi" || spec.OpenAPIVersion != "3.1.0" || spec.Version != "2.1" || len(warnings) != 0 {
+		t.Errorf("format = %s %s %s %v", format, spec.OpenAPIVersion, spec.Version, warnings)
+	}
+	order := spec.Paths["/orders/{orderId}"]
+	if order == nil || order.Get == nil || len(order.Parameters) != 1 || order.Parameters[0].Name != "orderId" || !order.Parameters[0].Required {
+		t.Fatalf("order path = %+v", order)
+	}
+	if order.Get.OperationID != "getOrder" || order.Get.Parameters[0].Type != "string" {
+		t.Errorf("operation = %+v", order.Get)
+	}
+	if ref := order.Get.Responses["200"].Schema["$ref"]; ref != "#/components/schemas/Order" {
+		t.Errorf("200 schema = %v", order.Get.Responses["200"].Schema)
+	}
+	if order.Get.Responses["404"].Description != "Not found" || order.Get.Responses["404"].StatusCode != 404 {
+		t.Errorf("404 = %+v", order.Get.Responses["404"])
+	}
+	if note := spec.Components.Schemas["Order"].Properties["note"]; note.Type != "string" || !note.Nullable {
+		t.Errorf("3.1 nullable = %+v", note)
+	}
+	if body := spec.Paths["/orders"].Post.RequestBody; body == nil || !body.Required || body.Content["application/json"].Schema.Properties["sku"] == nil {
+		t.Errorf("request body = %+v", body)
+	}
+
+	spec, format, _, err = parseSpecDocument([]byte(swagger2Document))
+	if err != nil {
+		t.Fatalf("parse Swagger: %v", err)
+	}
+	if format != "swagger" || spec.OpenAPIVersion != "2.0" || len(spec.Servers) != 1 || spec.Servers[0].URL != "https://legacy.example.com/api" {
+		t.Errorf("swagger = %s %+v", format, spec.Servers)
+	}
+	users := spec.Paths["/users"].Post
+	if users.RequestBody == nil || users.RequestBody.Content["application/json"].Schema.Ref != "#/components/schemas/User" {
+		t.Errorf("body parameter = %+v", users.RequestBody)
+	}
+	if !spec.Components.Schemas["User"].Properties["name"].Nullable {
+		t.Errorf("x-nullable was not kept")
+	}
+	avatars := spec.Paths["/avatars"].Post
+	if form, ok := avatars.RequestBody.Content["multipart/form-data"]; !ok || form.Schema.Properties["file"].Format != "binary" {
+		t.Errorf("formData = %+v", avatars.RequestBody)
+	}
+	if len(avatars.Parameters) != 1 || avatars.Parameters[0].Type != "integer" {
+		t.Errorf("query parameters = %+v", avatars.Parameters)
+	}
+	if scheme := spec.Components.SecuritySchemes["basic"]; scheme.Type != "http" || scheme.Scheme != "basic" {
+		t.Errorf("security scheme = %+v", scheme)
+	}
+
+	for _, document := range []string{"", "openapi: 4.0.0", `{"swagger": "1.2"}`, "title: not a spec", "{"} {
+		if _, _, _, err := parseSpecDocument([]byte(document)); err == nil {
+			t.Errorf("expected an error for %q", document)
+		}
+	}
+}
+
+func TestSpecDrift(t *testing.T) {
+	inventory := newMemoryInventoryRepository()
+	discovery := newMemoryDiscoveryRepository()
+	service := NewInventoryService(inventory, discovery, logging.NewStructuredLogger("test"))
+	ctx := context.Background()
+
+	if _, err := service.ImportAPISpec(ctx, "api", []byte(openAPI31Document)); err == nil {
+		t.Fatalf("expected an error for an unknown API")
+	}
+	inventory.apis["api"] = models.API{ID: "api", Name: "shop"}
+	if _, err := service.ImportAPISpec(ctx, "api", []byte("openapi: [")); !errors.Is(err, ErrInvalidSpec) {
+		t.Fatalf("invalid document error = %v", err)
+	}
+
+	now := time.Now()
+	recent, old := now.Add(-time.Hour), now.Add(-60*24*time.Hour)
+	endpoints := []models.Endpoint{
+		{ID: "get-order", APIID: "api", Method: "GET", Path: "/v1/orders/{orderId}", StatusCodes: []int{200, 404, 500}, LastSeen: &recent,
+			Parameters: []models.Parameter{{Name: "orderId", In: "path"}, {Name: "expand", In: "query"}, {Name: "debug", In: "query", Type: "boolean"}}},
+		{ID: "create-order", APIID: "api", Method: "POST", Path: "/v1/orders", StatusCodes: []int{201}, LastSeen: &recent,
+			Parameters: []models.Parameter{{Name: "sku", In: "body"}, {Name: "items[].quantity", In: "body"}, {Name: "coupon", In: "body"}}},
+		{ID: "export", APIID: "api", Method: "GET", Path: "/v1/legacy/export", LastSeen: &old},
+		{ID: "admin", APIID: "api", Method: "DELETE", Path: "/v1/orders/{orderId}", LastSeen: &recent},
+		{ID: "internal", APIID: "api", Method: "GET", Path: "/internal/metrics", LastSeen: &recent},
+	}
+	for _, endpoint := range endpoints {
+		discovery.endpoints[endpoint.ID] = endpoint
+	}
+	discovery.schemas = append(discovery.schemas, models.EndpointSchema{
+		ID: "s", EndpointID: "get-order", APIID: "api", Version: 1,
+		ResponseSchemas: map[string]*models.Schema{"200": {Type: "object", Required: []string{"id"}, Properties: map[string]*models.Schema{
+			"id":       {Type: "string"},
+			"tracking": {Type: "string"},
+		}}},
+	})
+
+	if _, err := service.ImportAPISpec(ctx, "api", []byte(openAPI31Document)); err != nil {
+		t.Fatalf("ImportAPISpec: %v", err)
+	}
+	report, err := service.GetSpecDrift(ctx, "api", false)
+	if err != nil {
+		t.Fatalf("GetSpecDrift: %v", err)
+	}
+
+	if fmt.Sprint(driftRoutes(report.ShadowEndpoints)) != "[GET /internal/metrics DELETE /v1/orders/{orderId}]" {
+		t.Errorf("shadow = %v", driftRoutes(report.ShadowEndpoints))
+	}
+	if fmt.Sprint(driftRoutes(report.ZombieEndpoints)) != "[GET /legacy/export]" {
+		t.Errorf("zombie = %v", driftRoutes(report.ZombieEndpoints))
+	}
+	var params []string
+	for _, param := range report.UndocumentedParameters {
+		params = append(params, param.Path+" "+param.In+":"+param.Name)
+	}
+	if fmt.Sprint(params) != "[/orders body:coupon /orders/{orderId} query:debug]" {
+		t.Errorf("undocumented parameters = %v", params)
+	}
+
+	var drift []string
+	for _, finding := range report.ResponseDrift {
+		drift = append(drift, fmt.Sprintf("%s %s %s", finding.StatusCode, finding.Kind, finding.Field))
+	}
+	want := "[200 type_mismatch $.id 200 undocumented_property $.tracking 200 missing_property $.status 500 undocumented_status ]"
+	if fmt.Sprint(drift) != want {
+		t.Errorf("response drift = %v, want %s", drift, want)
+	}
+	if report.Summary.DocumentedOperations != 3 || report.Summary.ShadowEndpoints != 2 {
+		t.Errorf("summary = %+v", report.Summary)
+	}
+	if stored, _ := inventory.GetDriftReport(ctx, "api"); stored == nil || stored.SpecID != report.SpecID {
+		t.Errorf("stored report = %+v", stored)
+	}
+}
+
+func driftRoutes(endpoints []models.DriftEndpoint) []string {
+	routes := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		routes = append(routes, endpoint.Method+" "+endpoint.Path)
+	}
+	return routes
+}
@@ -0,0 +1,121 @@
+-- Migration: Create base tables
+-- Description: Creates the scopeapi schema and the tables the later migrations extend
+-- Version: 000
+-- Date: 2026-10-16
+
+CREATE SCHEMA IF NOT EXISTS scopeapi;
+
+CREATE TABLE IF NOT EXISTS scopeapi.apis (
+    id VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    url TEXT NOT NULL DEFAULT '',
+    base_url TEXT NOT NULL DEFAULT '',
+    version VARCHAR(50) NOT NULL DEFAULT '',
+    protocol VARCHAR(20) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    description TEXT NOT NULL DEFAULT '',
+    tags JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS scopeapi.endpoints (
+    id VARCHAR(255) PRIMARY KEY,
+    api_id VARCHAR(255) NOT NULL,
+    url TEXT NOT NULL DEFAULT '',
+    path TEXT NOT NULL DEFAULT '',
+    method VARCHAR(20) NOT NULL DEFAULT '',
+    headers JSONB NOT NULL DEFAULT '{}',
+    body TEXT NOT NULL DEFAULT '',
+    status_code INTEGER NOT NULL DEFAULT 0,
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    summary TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    parameters JSONB NOT NULL DEFAULT '[]',
+    responses JSONB NOT NULL DEFAULT '{}',
+    tags JSONB NOT NULL DEFAULT '[]',
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_endpoints_api_id ON scopeapi.endpoints (api_id);
+
+CREATE TABLE IF NOT EXISTS scopeapi.discoveries (
+    id VARCHAR(255) PRIMARY KEY,
+    target TEXT NOT NULL,
+    method VARCHAR(50) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL,
+    progress INTEGER NOT NULL DEFAULT 0,
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    end_time TIMESTAMP WITH TIME ZONE,
+    endpoints_found INTEGER NOT NULL DEFAULT 0,
+    error_message TEXT NOT NULL DEFAULT '',
+    config JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_discoveries_created_at ON scopeapi.discoveries (created_at);
+
+CREATE TABLE IF NOT EXISTS scopeapi.endpoint_analyses (
+    id BIGSERIAL PRIMARY KEY,
+    endpoint_id VARCHAR(255) NOT NULL,
+    url TEXT NOT NULL DEFAULT '',
+    method VARCHAR(20) NOT NULL DEFAULT '',
+    response_time BIGINT NOT NULL DEFAULT 0,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    parameters JSONB NOT NULL DEFAULT '[]',
+    headers JSONB NOT NULL DEFAULT '{}',
+    security JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_endpoint_analyses_endpoint_id ON scopeapi.endpoint_analyses (endpoint_id);
+
+CREATE TABLE IF NOT EXISTS scopeapi.endpoint_metadata (
+    id VARCHAR(255) PRIMARY KEY,
+    endpoint_id VARCHAR(255) NOT NULL UNIQUE,
+    api_id VARCHAR(255) NOT NULL,
+    url TEXT NOT NULL DEFAULT '',
+    method VARCHAR(20) NOT NULL DEFAULT '',
+    title TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    tags JSONB NOT NULL DEFAULT '[]',
+    category VARCHAR(255) NOT NULL DEFAULT '',
+    business_owner VARCHAR(255) NOT NULL DEFAULT '',
+    technical_owner VARCHAR(255) NOT NULL DEFAULT '',
+    data_sensitivity VARCHAR(20) NOT NULL DEFAULT '',
+    compliance_requirements JSONB NOT NULL DEFAULT '[]',
+    parameters JSONB NOT NULL DEFAULT '[]',
+    response_schema JSONB,
+    request_schema JSONB,
+    examples JSONB,
+    documentation JSONB,
+    versioning JSONB,
+    performance JSONB,
+    security JSONB,
+    quality JSONB,
+    usage JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS scopeapi.api_specifications (
+    id VARCHAR(255) PRIMARY KEY,
+    api_id VARCHAR(255) NOT NULL UNIQUE,
+    version VARCHAR(50) NOT NULL DEFAULT '',
+    title TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    openapi_version VARCHAR(20) NOT NULL DEFAULT '',
+    info JSONB,
+    servers JSONB,
+    paths JSONB,
+    components JSONB,
+    security JSONB,
+    tags JSONB,
+    external_docs JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,16 @@
+-- Migration: Add endpoint observations
+-- Description: Records how passive discovery observed each endpoint in traffic
+-- Version: 001
+-- Date: 2026-10-16
+
+ALTER TABLE scopeapi.endpoints
+    ADD COLUMN IF NOT EXISTS discovery_id VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS source VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS status_codes JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS content_types JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS request_count BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS first_seen TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS last_seen TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_endpoints_discovery_id ON scopeapi.endpoints (discovery_id);
+CREATE INDEX IF NOT EXISTS idx_endpoints_last_seen ON scopeapi.endpoints (last_seen);
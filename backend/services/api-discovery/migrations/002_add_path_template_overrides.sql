@@ -0,0 +1,16 @@
+-- Migration: Add path template overrides
+-- Description: Stores path templates set manually to override path inference
+-- Version: 002
+-- Date: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS scopeapi.path_template_overrides (
+    id VARCHAR(255) PRIMARY KEY,
+    api_id VARCHAR(255) NOT NULL,
+    template TEXT NOT NULL,
+    parameters JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (api_id, template)
+);
+
+CREATE INDEX IF NOT EXISTS idx_path_template_overrides_api_id ON scopeapi.path_template_overrides (api_id);
@@ -0,0 +1,20 @@
+-- Migration: Add endpoint schemas
+-- Description: Stores versions of the request and response schemas learned from observed bodies
+-- Version: 003
+-- Date: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS scopeapi.endpoint_schemas (
+    id VARCHAR(255) PRIMARY KEY,
+    endpoint_id VARCHAR(255) NOT NULL,
+    api_id VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    request_schema JSONB,
+    response_schemas JSONB NOT NULL DEFAULT '{}',
+    sample_count BIGINT NOT NULL DEFAULT 0,
+    fingerprint VARCHAR(64) NOT NULL,
+    state JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (endpoint_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_endpoint_schemas_api_id ON scopeapi.endpoint_schemas (api_id);
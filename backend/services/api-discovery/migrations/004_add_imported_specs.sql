@@ -0,0 +1,21 @@
+-- Migration: Add imported specs
+-- Description: Stores OpenAPI/Swagger documents attached to APIs and the latest drift report against them
+-- Version: 004
+-- Date: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS scopeapi.imported_specs (
+    id VARCHAR(255) PRIMARY KEY,
+    api_id VARCHAR(255) NOT NULL UNIQUE,
+    format VARCHAR(20) NOT NULL,
+    source_version VARCHAR(20) NOT NULL,
+    spec JSONB NOT NULL,
+    warnings JSONB NOT NULL DEFAULT '[]',
+    imported_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS scopeapi.spec_drift_reports (
+    api_id VARCHAR(255) PRIMARY KEY,
+    spec_id VARCHAR(255) NOT NULL,
+    report JSONB NOT NULL,
+    generated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
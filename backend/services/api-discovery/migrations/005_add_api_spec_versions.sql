@@ -0,0 +1,28 @@
+-- Migration: Add API spec versions
+-- Description: Stores every generated API spec as an immutable, numbered version
+-- Version: 005
+-- Date: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS scopeapi.api_spec_versions (
+    id VARCHAR(255) PRIMARY KEY,
+    api_id VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    spec JSONB NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL,
+    changes JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (api_id, version)
+);
+
+-- Versions are written once; changes are recorded as new versions
+CREATE OR REPLACE FUNCTION scopeapi.reject_api_spec_version_update()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'API spec versions are immutable';
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS api_spec_versions_immutable ON scopeapi.api_spec_versions;
+CREATE TRIGGER api_spec_versions_immutable
+    BEFORE UPDATE ON scopeapi.api_spec_versions
+    FOR EACH ROW EXECUTE FUNCTION scopeapi.reject_api_spec_version_update();
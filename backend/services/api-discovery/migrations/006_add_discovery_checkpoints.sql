@@ -0,0 +1,7 @@
+-- Migration: Add discovery checkpoints
+-- Description: Stores the crawl state of active discovery runs so stopped runs can resume
+-- Version: 006
+-- Date: 2026-10-16
+
+ALTER TABLE scopeapi.discoveries
+    ADD COLUMN IF NOT EXISTS checkpoint JSONB;
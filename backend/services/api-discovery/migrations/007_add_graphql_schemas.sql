@@ -0,0 +1,26 @@
+-- Migration: Add GraphQL schemas
+-- Description: Stores the schemas, operations and risky settings of discovered GraphQL endpoints
+-- Version: 007
+-- Date: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS scopeapi.graphql_schemas (
+    id VARCHAR(255) PRIMARY KEY,
+    api_id VARCHAR(255) NOT NULL,
+    url TEXT NOT NULL,
+    path TEXT NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    environment VARCHAR(50) NOT NULL DEFAULT '',
+    operations JSONB NOT NULL DEFAULT '[]',
+    types JSONB NOT NULL DEFAULT '[]',
+    findings JSONB NOT NULL DEFAULT '[]',
+    introspection_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    batching_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    max_depth INTEGER NOT NULL DEFAULT 0,
+    request_count BIGINT NOT NULL DEFAULT 0,
+    first_seen TIMESTAMP WITH TIME ZONE,
+    last_seen TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_graphql_schemas_api_id ON scopeapi.graphql_schemas (api_id);
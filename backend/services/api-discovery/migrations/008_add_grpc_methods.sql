@@ -0,0 +1,31 @@
+-- Migration: Add endpoint protocols and gRPC methods
+-- Description: Records whether an endpoint is REST, GraphQL or gRPC, and the streaming type and message schemas of gRPC methods
+-- Version: 008
+-- Date: 2026-10-16
+
+ALTER TABLE scopeapi.endpoints
+    ADD COLUMN IF NOT EXISTS protocol VARCHAR(20) NOT NULL DEFAULT 'rest';
+
+CREATE INDEX IF NOT EXISTS idx_endpoints_protocol ON scopeapi.endpoints (protocol);
+
+CREATE TABLE IF NOT EXISTS scopeapi.grpc_methods (
+    id VARCHAR(255) PRIMARY KEY,
+    api_id VARCHAR(255) NOT NULL,
+    url TEXT NOT NULL,
+    service TEXT NOT NULL,
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    streaming_type VARCHAR(20) NOT NULL DEFAULT 'unary',
+    request_type TEXT NOT NULL DEFAULT '',
+    response_type TEXT NOT NULL DEFAULT '',
+    request_schema JSONB,
+    response_schema JSONB,
+    source VARCHAR(20) NOT NULL,
+    request_count BIGINT NOT NULL DEFAULT 0,
+    first_seen TIMESTAMP WITH TIME ZONE,
+    last_seen TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_grpc_methods_api_id ON scopeapi.grpc_methods (api_id);
@@ -0,0 +1,29 @@
+-- Migration: Add API ownership metadata and endpoint traffic states
+-- Description: Records the owner, contact, environment, lifecycle and data sensitivity of APIs, when they last saw traffic, and which endpoints have gone stale or zombie
+-- Version: 009
+-- Date: 2026-10-16
+
+ALTER TABLE scopeapi.apis
+    ADD COLUMN IF NOT EXISTS owner VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS contact VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS environment VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS lifecycle VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS data_sensitivity VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS last_traffic_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE scopeapi.endpoints
+    ADD COLUMN IF NOT EXISTS last_traffic_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS traffic_state VARCHAR(20) NOT NULL DEFAULT 'active';
+
+-- Endpoints discovered passively before this migration were seen in traffic
+UPDATE scopeapi.endpoints
+    SET last_traffic_at = last_seen
+    WHERE last_traffic_at IS NULL AND source = 'passive';
+
+UPDATE scopeapi.apis
+    SET last_traffic_at = (SELECT MAX(e.last_traffic_at) FROM scopeapi.endpoints e WHERE e.api_id = scopeapi.apis.id)
+    WHERE last_traffic_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_apis_owner ON scopeapi.apis (owner);
+CREATE INDEX IF NOT EXISTS idx_apis_lifecycle ON scopeapi.apis (lifecycle);
+CREATE INDEX IF NOT EXISTS idx_endpoints_traffic_state ON scopeapi.endpoints (traffic_state);
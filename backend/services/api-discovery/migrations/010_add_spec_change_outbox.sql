@@ -0,0 +1,19 @@
+-- Migration: Add spec change outbox
+-- Description: Keeps the breaking change event of each spec version until it is published
+-- Version: 010
+-- Date: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS scopeapi.spec_change_outbox (
+    version_id VARCHAR(255) PRIMARY KEY REFERENCES scopeapi.api_spec_versions (id),
+    api_id VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    event JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_spec_change_outbox_pending
+    ON scopeapi.spec_change_outbox (created_at, version)
+    WHERE published_at IS NULL;
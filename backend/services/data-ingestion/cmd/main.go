@@ -5,15 +5,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
 	"scopeapi.local/backend/services/data-ingestion/internal/config"
 	"scopeapi.local/backend/services/data-ingestion/internal/handlers"
+	"scopeapi.local/backend/services/data-ingestion/internal/proto/ingestionv1"
+	"scopeapi.local/backend/services/data-ingestion/internal/repository"
 	"scopeapi.local/backend/services/data-ingestion/internal/services"
 	"scopeapi.local/backend/shared/database/postgresql"
 	"scopeapi.local/backend/shared/logging"
@@ -50,6 +55,20 @@ func main() {
 		logger.Info("Database connected successfully")
 	}
 
+	// Persist ingestion jobs and stats once the schema is in place. A reachable
+	// database without its migrations is a broken deployment, not a reason to
+	// quietly keep everything in memory.
+	var ingestionRepo repository.IngestionRepositoryInterface
+	if db != nil {
+		if cfg.Database.PostgreSQL.Migrations == "" {
+			logger.Warn("No migrations directory configured, keeping ingestion status in memory")
+		} else if err := migrateDatabase(dbConfig, cfg.Database.PostgreSQL.Migrations); err != nil {
+			logger.Fatal("Failed to apply database migrations", "directory", cfg.Database.PostgreSQL.Migrations, "error", err)
+		} else {
+			ingestionRepo = repository.NewPostgresIngestionRepository(db.DB())
+		}
+	}
+
 	// Initialize Kafka producer (optional for now)
 	var kafkaProducer *kafka.Producer
 	if len(cfg.Messaging.Kafka.Brokers) > 0 {
@@ -118,29 +137,27 @@ func main() {
 	metricsCollector := metrics.NewPrometheusCollector("data_ingestion")
 
 	// Initialize services
-	var ingestionService services.DataIngestionServiceInterface
-	if kafkaProducer != nil {
-		ingestionService = services.NewDataIngestionService(kafkaProducer, logger, cfg)
-	} else {
-		// Create a mock producer for now
-		ingestionService = services.NewDataIngestionService(nil, logger, cfg)
-	}
-	parserService := services.NewDataParserService(logger, cfg)
-	normalizerService := services.NewDataNormalizerService(logger, cfg)
-	
+	// Ingestion publishes through the queue, which spools to disk while Kafka is down
 	var queueService services.QueueServiceInterface
 	if kafkaProducer != nil {
 		queueService = services.NewQueueService(kafkaProducer, logger, cfg)
 	} else {
-		// Create a mock queue service for now
+		// Without a producer everything is spooled until a restart with Kafka
 		queueService = services.NewQueueService(nil, logger, cfg)
 	}
+	parserService := services.NewDataParserService(logger, cfg)
+	ingestionService := services.NewDataIngestionService(queueService, ingestionRepo, parserService, logger, cfg)
+	normalizerService := services.NewDataNormalizerService(logger, cfg)
+	importService := services.NewCaptureImportService(ingestionService, logger, cfg)
+	streamService := services.NewStreamIngestionService(ingestionService, queueService, logger, cfg)
 
 	// Initialize handlers
 	ingestionHandler := handlers.NewIngestionHandler(ingestionService, logger)
 	parserHandler := handlers.NewParserHandler(parserService, logger)
 	normalizerHandler := handlers.NewNormalizerHandler(normalizerService, logger)
 	queueHandler := handlers.NewQueueHandler(queueService, logger)
+	importHandler := handlers.NewImportHandler(importService, logger)
+	streamHandler := handlers.NewStreamHandler(streamService, logger, cfg.Streaming.MaxMessageSize)
 
 	// Setup Gin router
 	router := gin.New()
@@ -164,6 +181,9 @@ func main() {
 			ingestion.POST("/batch", ingestionHandler.IngestBatch)
 			ingestion.GET("/status/:id", ingestionHandler.GetIngestionStatus)
 			ingestion.GET("/stats", ingestionHandler.GetIngestionStats)
+			ingestion.POST("/import", importHandler.ImportCapture)
+			ingestion.GET("/stream", streamHandler.StreamTraffic)
+			ingestion.GET("/streams", streamHandler.GetStreams)
 		}
 
 		// Parser routes
@@ -172,6 +192,8 @@ func main() {
 			parser.POST("/parse", parserHandler.ParseData)
 			parser.GET("/formats", parserHandler.GetSupportedFormats)
 			parser.POST("/validate", parserHandler.ValidateFormat)
+			parser.POST("/descriptors", parserHandler.RegisterDescriptors)
+			parser.GET("/descriptors", parserHandler.GetDescriptors)
 		}
 
 		// Normalizer routes
@@ -242,6 +264,32 @@ func main() {
 		}
 	}()
 
+	// Start gRPC streaming ingest server
+	var grpcServer *grpc.Server
+	if cfg.Streaming.Enabled {
+		grpcPort := cfg.Streaming.GRPCPort
+		if grpcPort == "" {
+			grpcPort = "9091"
+		}
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%s", grpcPort))
+		if err != nil {
+			logger.Fatal("Failed to listen for gRPC streams", "port", grpcPort, "error", err)
+		}
+		var options []grpc.ServerOption
+		if cfg.Streaming.MaxMessageSize > 0 {
+			options = append(options, grpc.MaxRecvMsgSize(cfg.Streaming.MaxMessageSize))
+		}
+		grpcServer = grpc.NewServer(options...)
+		ingestionv1.RegisterTrafficIngestionServer(grpcServer, handlers.NewStreamServer(streamService, logger))
+
+		go func() {
+			logger.Info("Starting gRPC streaming ingest server", "port", grpcPort)
+			if err := grpcServer.Serve(listener); err != nil {
+				logger.Error("gRPC server stopped", "error", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal to gracefully shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -252,6 +300,11 @@ func main() {
 	// Cancel context to stop background services
 	cancel()
 
+	// Stop accepting new streams and let open ones finish
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+
 	// Shutdown HTTP server
 	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -260,6 +313,16 @@ func main() {
 		logger.Fatal("Server forced to shutdown", "error", err)
 	}
 
+	// Persist the pending stats rollups
+	if err := ingestionService.Close(ctx); err != nil {
+		logger.Error("Failed to close ingestion service", "error", err)
+	}
+
+	// Flush queued traffic and close the spool once no more requests arrive
+	if err := queueService.Close(ctx); err != nil {
+		logger.Error("Failed to drain traffic queue, remaining records stay spooled", "error", err)
+	}
+
 	logger.Info("Data ingestion service stopped")
 }
 
@@ -287,4 +350,27 @@ func processConfigUpdate(message kafka.Message, ingestionService services.DataIn
 	default:
 		logger.Warn("Unknown configuration update type", "type", configUpdate.Type)
 	}
-} 
\ No newline at end of file
+} 
+
+// ingestionMigrationsTable keeps this service's migration history apart from
+// other services sharing the database
+const ingestionMigrationsTable = "ingestion_schema_migrations"
+
+// migrateDatabase applies the ingestion migrations, failing when there are none
+func migrateDatabase(dbConfig postgresql.Config, migrationsDir string) error {
+	files, err := filepath.Glob(filepath.Join(migrationsDir, "*.up.sql"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no migrations found in %s", migrationsDir)
+	}
+
+	migrator, err := postgresql.NewMigrator(dbConfig)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	return migrator.WithTable(ingestionMigrationsTable).Migrate(migrationsDir)
+}
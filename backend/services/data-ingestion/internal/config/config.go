@@ -17,6 +17,7 @@ type Config struct {
 	Parser     ParserConfig     `yaml:"parser"`
 	Normalizer NormalizerConfig `yaml:"normalizer"`
 	Queue      QueueConfig      `yaml:"queue"`
+	Streaming  StreamingConfig  `yaml:"streaming"`
 	Security   SecurityConfig   `yaml:"security"`
 	Monitoring MonitoringConfig `yaml:"monitoring"`
 	Logging    LoggingConfig    `mapstructure:"logging"`
@@ -42,6 +43,9 @@ type PostgreSQLConfig struct {
 	Database string `yaml:"database"`
 	SSLMode  string `yaml:"ssl_mode"`
 	MaxConns int    `yaml:"max_conns"`
+	// Migrations is the directory of ingestion migrations applied at startup. The
+	// image ships them in /app/migrations; empty skips them.
+	Migrations string `yaml:"migrations"`
 }
 
 type MessagingConfig struct {
@@ -84,6 +88,9 @@ type IngestionConfig struct {
 	Compression      bool          `yaml:"compression"`
 	Topics           TopicsConfig  `yaml:"topics"`
 	Formats          FormatsConfig `yaml:"formats"`
+	Policies         []PolicyConfig `yaml:"policies"`
+	Redaction        RedactionConfig `yaml:"redaction"`
+	Decoding         DecodingConfig  `yaml:"decoding"`
 }
 
 type TopicsConfig struct {
@@ -99,6 +106,76 @@ type FormatsConfig struct {
 	Default   string   `yaml:"default"`
 }
 
+// DecodingConfig bounds the removal of content codings and charsets from bodies.
+// A layer may expand to at most MaxRatio times its input and never past MaxBytes;
+// DefaultCharset is used for non-UTF-8 bodies that declare no charset.
+type DecodingConfig struct {
+	MaxBytes       int64   `yaml:"max_bytes" json:"max_bytes" mapstructure:"max_bytes"`
+	MaxRatio       float64 `yaml:"max_ratio" json:"max_ratio" mapstructure:"max_ratio"`
+	MaxLayers      int     `yaml:"max_layers" json:"max_layers" mapstructure:"max_layers"`
+	DefaultCharset string  `yaml:"default_charset" json:"default_charset" mapstructure:"default_charset"`
+}
+
+// RedactionConfig replaces secrets in traffic with keyed hashes before it is
+// published. Headers and Query list names matched case-insensitively, Paths are
+// JSONPath expressions applied to JSON bodies and Patterns are regexes applied to
+// every remaining text value. Empty lists fall back to built-in defaults.
+type RedactionConfig struct {
+	Enabled  bool               `yaml:"enabled" json:"enabled"`
+	Key      string             `yaml:"key" json:"key"`
+	Headers  []string           `yaml:"headers" json:"headers"`
+	Query    []string           `yaml:"query" json:"query"`
+	Paths    []string           `yaml:"paths" json:"paths"`
+	Patterns []RedactionPattern `yaml:"patterns" json:"patterns"`
+}
+
+// RedactionPattern is a named regex. When it has capture groups only the first
+// group is replaced, otherwise the whole match is.
+type RedactionPattern struct {
+	Name  string `yaml:"name" json:"name"`
+	Regex string `yaml:"regex" json:"regex"`
+}
+
+// PolicyConfig applies sampling, deduplication and body limits to the traffic it
+// selects. Hosts and Paths are globs where * stops at a separator and ** does not;
+// StatusClasses are classes like "5xx" or exact codes. Empty selectors match all
+// traffic and the first matching policy wins.
+type PolicyConfig struct {
+	Name          string          `yaml:"name" json:"name" mapstructure:"name"`
+	Hosts         []string        `yaml:"hosts" json:"hosts" mapstructure:"hosts"`
+	Paths         []string        `yaml:"paths" json:"paths" mapstructure:"paths"`
+	StatusClasses []string        `yaml:"status_classes" json:"status_classes" mapstructure:"status_classes"`
+	Sampling      SamplingConfig  `yaml:"sampling" json:"sampling" mapstructure:"sampling"`
+	Dedup         DedupConfig     `yaml:"dedup" json:"dedup" mapstructure:"dedup"`
+	Body          BodyLimitConfig `yaml:"body" json:"body" mapstructure:"body"`
+}
+
+// SamplingConfig keeps a Rate fraction of matching traffic. Errors, slow requests
+// and requests carrying one of KeepTags are kept regardless of the rate.
+type SamplingConfig struct {
+	Rate              *float64      `yaml:"rate" json:"rate" mapstructure:"rate"`
+	KeepErrors        bool          `yaml:"keep_errors" json:"keep_errors" mapstructure:"keep_errors"`
+	KeepStatusClasses []string      `yaml:"keep_status_classes" json:"keep_status_classes" mapstructure:"keep_status_classes"`
+	KeepTags          []string      `yaml:"keep_tags" json:"keep_tags" mapstructure:"keep_tags"`
+	SlowerThan        time.Duration `yaml:"slower_than" json:"slower_than" mapstructure:"slower_than"`
+	HashHeader        string        `yaml:"hash_header" json:"hash_header" mapstructure:"hash_header"`
+}
+
+// DedupConfig drops records whose content hash was already seen within Window
+type DedupConfig struct {
+	Window          time.Duration `yaml:"window" json:"window" mapstructure:"window"`
+	IncludeResponse bool          `yaml:"include_response" json:"include_response" mapstructure:"include_response"`
+	MaxEntries      int           `yaml:"max_entries" json:"max_entries" mapstructure:"max_entries"`
+}
+
+// BodyLimitConfig truncates request and response bodies to MaxBytes, optionally
+// recording a SHA-256 of the original body, or drops them entirely
+type BodyLimitConfig struct {
+	MaxBytes int  `yaml:"max_bytes" json:"max_bytes" mapstructure:"max_bytes"`
+	Hash     bool `yaml:"hash" json:"hash" mapstructure:"hash"`
+	Drop     bool `yaml:"drop" json:"drop" mapstructure:"drop"`
+}
+
 type ParserConfig struct {
 	MaxPayloadSize int           `yaml:"max_payload_size"`
 	Timeout        time.Duration `yaml:"timeout"`
@@ -126,6 +203,7 @@ type SchemaConfig struct {
 	Fields     map[string]FieldConfig `yaml:"fields"`
 	Required   []string               `yaml:"required"`
 	Validators []ValidatorConfig      `yaml:"validators"`
+	Transforms []string               `yaml:"transforms"` // names of entries in NormalizerConfig.Transformers
 }
 
 type FieldConfig struct {
@@ -152,6 +230,31 @@ type QueueConfig struct {
 	MaxSize       int           `yaml:"max_size"`
 	FlushInterval time.Duration `yaml:"flush_interval"`
 	RetryPolicy   RetryPolicy   `yaml:"retry_policy"`
+	Spool         SpoolConfig   `yaml:"spool"`
+}
+
+// StreamingConfig controls the gRPC and WebSocket streaming ingest channels
+type StreamingConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	GRPCPort        string        `yaml:"grpc_port"`
+	MaxStreams      int           `yaml:"max_streams"`
+	Window          int           `yaml:"window"`            // unacknowledged batches allowed per stream
+	MaxBatchRecords int           `yaml:"max_batch_records"`
+	MaxMessageSize  int           `yaml:"max_message_size"`
+	SlowThreshold   float64       `yaml:"slow_threshold"`    // queue utilization at which credits shrink
+	PauseThreshold  float64       `yaml:"pause_threshold"`   // queue utilization at which reading stops
+	PollInterval    time.Duration `yaml:"poll_interval"`
+}
+
+// SpoolConfig controls the on-disk spool that buffers traffic while Kafka is unavailable
+type SpoolConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Directory      string        `yaml:"directory"`
+	SegmentSize    int64         `yaml:"segment_size"`
+	MaxSize        int64         `yaml:"max_size"`
+	MaxAge         time.Duration `yaml:"max_age"`
+	ReplayInterval time.Duration `yaml:"replay_interval"`
+	ReplayBatch    int           `yaml:"replay_batch"`
 }
 
 type RetryPolicy struct {
@@ -204,6 +307,7 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("database.postgresql.password", "password")
 	viper.SetDefault("database.postgresql.dbname", "scopeapi")
 	viper.SetDefault("database.postgresql.sslmode", "disable")
+	viper.SetDefault("database.postgresql.migrations", "/app/migrations")
 	viper.SetDefault("messaging.kafka.brokers", []string{"localhost:9092"})
 	viper.SetDefault("messaging.kafka.topic", "api-traffic")
 	viper.SetDefault("logging.level", "info")
@@ -270,6 +374,9 @@ func loadFromEnv(config *Config) {
 	if database := os.Getenv("DB_NAME"); database != "" {
 		config.Database.PostgreSQL.Database = database
 	}
+	if migrations := os.Getenv("DB_MIGRATIONS"); migrations != "" {
+		config.Database.PostgreSQL.Migrations = migrations
+	}
 	
 	// Kafka configuration
 	if brokers := os.Getenv("KAFKA_BROKERS"); brokers != "" {
@@ -389,6 +496,27 @@ func setDefaults(config *Config) {
 	if config.Queue.RetryPolicy.MaxBackoff == 0 {
 		config.Queue.RetryPolicy.MaxBackoff = 60 * time.Second
 	}
+	if config.Streaming.GRPCPort == "" {
+		config.Streaming.GRPCPort = "9091"
+	}
+	if config.Queue.Spool.Directory == "" {
+		config.Queue.Spool.Directory = "data/spool"
+	}
+	if config.Queue.Spool.SegmentSize == 0 {
+		config.Queue.Spool.SegmentSize = 64 * 1024 * 1024 // 64MB
+	}
+	if config.Queue.Spool.MaxSize == 0 {
+		config.Queue.Spool.MaxSize = 2 * 1024 * 1024 * 1024 // 2GB
+	}
+	if config.Queue.Spool.MaxAge == 0 {
+		config.Queue.Spool.MaxAge = 24 * time.Hour
+	}
+	if config.Queue.Spool.ReplayInterval == 0 {
+		config.Queue.Spool.ReplayInterval = 5 * time.Second
+	}
+	if config.Queue.Spool.ReplayBatch == 0 {
+		config.Queue.Spool.ReplayBatch = 500
+	}
 	
 	// Monitoring defaults
 	if config.Monitoring.Metrics.Path == "" {
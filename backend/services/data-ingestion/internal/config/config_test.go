@@ -0,0 +1,82 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// loadTestConfig loads a YAML config file through LoadConfig
+func loadTestConfig(t *testing.T, yaml string) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data-ingestion.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_PATH", path)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return cfg
+}
+
+func TestLoadConfigPolicies(t *testing.T) {
+	cfg := loadTestConfig(t, `
+ingestion:
+  policies:
+    - name: sampled
+      status_classes: ["2xx"]
+      sampling:
+        rate: 0.1
+        keep_errors: true
+        keep_status_classes: ["429"]
+        keep_tags: ["flagged"]
+        slower_than: 2s
+        hash_header: X-Request-Id
+      dedup:
+        window: 1m
+        include_response: true
+        max_entries: 5000
+      body:
+        max_bytes: 4096
+        hash: true
+`)
+
+	if len(cfg.Ingestion.Policies) != 1 {
+		t.Fatalf("policies = %+v", cfg.Ingestion.Policies)
+	}
+	policy := cfg.Ingestion.Policies[0]
+	if len(policy.StatusClasses) != 1 || policy.StatusClasses[0] != "2xx" {
+		t.Errorf("status classes = %v", policy.StatusClasses)
+	}
+	sampling := policy.Sampling
+	if sampling.Rate == nil || *sampling.Rate != 0.1 || !sampling.KeepErrors || sampling.SlowerThan != 2*time.Second ||
+		sampling.HashHeader != "X-Request-Id" || len(sampling.KeepStatusClasses) != 1 || len(sampling.KeepTags) != 1 {
+		t.Errorf("sampling = %+v", sampling)
+	}
+	if dedup := policy.Dedup; dedup.Window != time.Minute || !dedup.IncludeResponse || dedup.MaxEntries != 5000 {
+		t.Errorf("dedup = %+v", dedup)
+	}
+	if body := policy.Body; body.MaxBytes != 4096 || !body.Hash {
+		t.Errorf("body = %+v", body)
+	}
+}
+
+func TestLoadConfigDecoding(t *testing.T) {
+	cfg := loadTestConfig(t, `
+ingestion:
+  decoding:
+    max_bytes: 10485760
+    max_ratio: 50
+    max_layers: 2
+    default_charset: windows-1252
+`)
+
+	decoding := cfg.Ingestion.Decoding
+	if decoding.MaxBytes != 10485760 || decoding.MaxRatio != 50 || decoding.MaxLayers != 2 || decoding.DefaultCharset != "windows-1252" {
+		t.Errorf("decoding = %+v", decoding)
+	}
+}
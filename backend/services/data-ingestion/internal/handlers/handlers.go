@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -30,6 +32,11 @@ type QueueHandler struct {
 	logger       Logger
 }
 
+type ImportHandler struct {
+	importService services.CaptureImportServiceInterface
+	logger        Logger
+}
+
 type Logger interface {
 	Info(msg string, args ...interface{})
 	Error(msg string, args ...interface{})
@@ -65,6 +72,13 @@ func NewQueueHandler(queueService services.QueueServiceInterface, logger Logger)
 	}
 }
 
+func NewImportHandler(importService services.CaptureImportServiceInterface, logger Logger) *ImportHandler {
+	return &ImportHandler{
+		importService: importService,
+		logger:        logger,
+	}
+}
+
 // IngestTraffic handles incoming API traffic data
 func (h *IngestionHandler) IngestTraffic(c *gin.Context) {
 	var request models.IngestionRequest
@@ -131,12 +145,42 @@ func (h *IngestionHandler) GetIngestionStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, status)
 }
 
-// GetIngestionStats returns ingestion statistics
+// GetIngestionStats returns ingestion statistics over a time range given as
+// RFC 3339 start and end parameters, or a window such as 1h ending now. The
+// default is the last 24 hours.
 func (h *IngestionHandler) GetIngestionStats(c *gin.Context) {
-	// Create a time range for the last 24 hours
-	timeRange := &models.TimeRange{
-		Start: time.Now().Add(-24 * time.Hour),
-		End:   time.Now(),
+	end := time.Now()
+	if value := c.Query("end"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end time: " + value})
+			return
+		}
+		end = parsed
+	}
+
+	window := 24 * time.Hour
+	if value := c.Query("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window: " + value})
+			return
+		}
+		window = parsed
+	}
+
+	timeRange := &models.TimeRange{Start: end.Add(-window), End: end}
+	if value := c.Query("start"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start time: " + value})
+			return
+		}
+		timeRange.Start = parsed
+	}
+	if !timeRange.Start.Before(timeRange.End) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start time must be before end time"})
+		return
 	}
 
 	stats, err := h.ingestionService.GetIngestionStats(c.Request.Context(), timeRange)
@@ -152,8 +196,11 @@ func (h *IngestionHandler) GetIngestionStats(c *gin.Context) {
 // ParseData handles data parsing requests
 func (h *ParserHandler) ParseData(c *gin.Context) {
 	var request struct {
-		Data   []byte `json:"data" binding:"required"`
-		Format string `json:"format"`
+		Data            []byte                 `json:"data" binding:"required"`
+		Format          string                 `json:"format"`
+		ContentType     string                 `json:"content_type"`
+		ContentEncoding string                 `json:"content_encoding"`
+		Protobuf        *models.ProtobufTarget `json:"protobuf"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -161,7 +208,20 @@ func (h *ParserHandler) ParseData(c *gin.Context) {
 		return
 	}
 
-	result, err := h.parserService.ParseData(c.Request.Context(), request.Data, request.Format, "")
+	// Bodies are decompressed and converted to UTF-8 before parsing
+	decoded, err := h.parserService.DecodeBody(c.Request.Context(), request.Data, request.ContentEncoding, request.ContentType)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	request.Data = decoded.Data
+
+	var result *models.ParsedData
+	if request.Protobuf != nil {
+		result, err = h.parserService.ParseProtobuf(c.Request.Context(), request.Data, request.ContentType, request.Protobuf)
+	} else {
+		result, err = h.parserService.ParseData(c.Request.Context(), request.Data, request.Format, request.ContentType)
+	}
 	if err != nil {
 		h.logger.Error("Failed to parse data", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse data"})
@@ -204,6 +264,35 @@ func (h *ParserHandler) ValidateFormat(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// RegisterDescriptors registers protobuf descriptors for a service or path prefix
+func (h *ParserHandler) RegisterDescriptors(c *gin.Context) {
+	var registration models.DescriptorRegistration
+	if err := c.ShouldBindJSON(&registration); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	info, err := h.parserService.RegisterDescriptors(c.Request.Context(), &registration)
+	if err != nil {
+		h.logger.Error("Failed to register descriptors", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, info)
+}
+
+// GetDescriptors returns registered protobuf descriptor sets
+func (h *ParserHandler) GetDescriptors(c *gin.Context) {
+	descriptors, err := h.parserService.GetDescriptors(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to get descriptors", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get descriptors"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"descriptors": descriptors})
+}
+
 // NormalizeData handles data normalization requests
 func (h *NormalizerHandler) NormalizeData(c *gin.Context) {
 	var request struct {
@@ -248,7 +337,7 @@ func (h *NormalizerHandler) CreateSchema(c *gin.Context) {
 	err := h.normalizerService.CreateSchema(c.Request.Context(), schema)
 	if err != nil {
 		h.logger.Error("Failed to create schema", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create schema"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -287,4 +376,46 @@ func (h *QueueHandler) GetTopics(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"topics": topics})
-} 
\ No newline at end of file
+} 
+// ImportCapture imports a HAR, pcap/pcapng or mitmproxy capture. The capture is
+// read either from a multipart "file" field or from the raw request body.
+func (h *ImportHandler) ImportCapture(c *gin.Context) {
+	request := &models.CaptureImportRequest{
+		Format: c.Query("format"),
+		Name:   c.Query("name"),
+		Tags:   c.QueryArray("tag"),
+	}
+
+	var reader io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		multipartReader, err := c.Request.MultipartReader()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart request"})
+			return
+		}
+		for {
+			part, err := multipartReader.NextPart()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file field"})
+				return
+			}
+			if part.FormName() == "file" {
+				if request.Name == "" {
+					request.Name = part.FileName()
+				}
+				reader = part
+				break
+			}
+			part.Close()
+		}
+	}
+
+	result, err := h.importService.ImportCapture(c.Request.Context(), request, reader)
+	if err != nil {
+		h.logger.Error("Failed to import capture", "error", err, "format", request.Format, "name", request.Name)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/services/data-ingestion/internal/proto/ingestionv1"
+	"scopeapi.local/backend/services/data-ingestion/internal/services"
+)
+
+// StreamServer implements the TrafficIngestion gRPC service
+type StreamServer struct {
+	ingestionv1.UnimplementedTrafficIngestionServer
+	streamService services.StreamIngestionServiceInterface
+	logger        Logger
+}
+
+func NewStreamServer(streamService services.StreamIngestionServiceInterface, logger Logger) *StreamServer {
+	return &StreamServer{
+		streamService: streamService,
+		logger:        logger,
+	}
+}
+
+// IngestTraffic handles client-streaming ingest. While the queue is saturated the
+// server stops calling Recv, so HTTP/2 flow control holds the client back.
+func (s *StreamServer) IngestTraffic(stream ingestionv1.TrafficIngestion_IngestTrafficServer) error {
+	ctx := stream.Context()
+	ingest, err := s.streamService.OpenStream(ctx, "grpc", grpcPeerAddress(ctx))
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	defer ingest.Close()
+
+	for {
+		if _, err := ingest.WaitForCapacity(ctx, nil); err != nil {
+			return status.FromContextError(err).Err()
+		}
+
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(summaryToProto(ingest.Close()))
+		}
+		if err != nil {
+			return err
+		}
+
+		ack := ingest.Submit(ctx, batchFromProto(batch))
+		if ack.Status == models.AckRejected {
+			s.logger.Warn("Streamed batch rejected", "stream_id", ingest.ID(), "sequence", ack.Sequence, "errors", ack.Errors)
+		}
+	}
+}
+
+// StreamTraffic handles bidirectional ingest with one acknowledgement per batch.
+// Pausing and resuming are announced with acknowledgements that carry no status.
+func (s *StreamServer) StreamTraffic(stream ingestionv1.TrafficIngestion_StreamTrafficServer) error {
+	ctx := stream.Context()
+	ingest, err := s.streamService.OpenStream(ctx, "grpc", grpcPeerAddress(ctx))
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	defer ingest.Close()
+
+	sendSignal := func(signal models.BackpressureSignal) error {
+		return stream.Send(&ingestionv1.BatchAck{
+			Sequence:     ingest.Info().LastSequence,
+			Backpressure: backpressureToProto(signal),
+		})
+	}
+
+	for {
+		var sendErr error
+		paused := false
+		signal, err := ingest.WaitForCapacity(ctx, func(signal models.BackpressureSignal) {
+			paused = true
+			sendErr = sendSignal(signal)
+		})
+		if sendErr != nil {
+			return sendErr
+		}
+		if err != nil {
+			return status.FromContextError(err).Err()
+		}
+		if paused {
+			if err := sendSignal(signal); err != nil {
+				return err
+			}
+		}
+
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ack := ingest.Submit(ctx, batchFromProto(batch))
+		if err := stream.Send(ackToProto(ack)); err != nil {
+			return err
+		}
+	}
+}
+
+// Helper methods
+
+func grpcPeerAddress(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+func batchFromProto(batch *ingestionv1.TrafficBatch) *models.StreamBatch {
+	records := make([]models.TrafficData, 0, len(batch.GetRecords()))
+	for _, record := range batch.GetRecords() {
+		data := models.TrafficData{
+			ID:              record.GetId(),
+			SourceIP:        record.GetSourceIp(),
+			DestinationIP:   record.GetDestinationIp(),
+			Protocol:        record.GetProtocol(),
+			Method:          record.GetMethod(),
+			URL:             record.GetUrl(),
+			Path:            record.GetPath(),
+			QueryParams:     record.GetQueryParams(),
+			Headers:         record.GetHeaders(),
+			Body:            record.GetBody(),
+			StatusCode:      int(record.GetStatusCode()),
+			ResponseHeaders: record.GetResponseHeaders(),
+			ResponseBody:    record.GetResponseBody(),
+			UserAgent:       record.GetUserAgent(),
+			ContentType:     record.GetContentType(),
+			Tags:            record.GetTags(),
+			Priority:        int(record.GetPriority()),
+		}
+		if record.GetTimestamp() != nil {
+			data.Timestamp = record.GetTimestamp().AsTime()
+		}
+		if record.GetDuration() != nil {
+			data.Duration = record.GetDuration().AsDuration()
+		}
+		if len(record.GetMetadata()) > 0 {
+			data.Metadata = make(map[string]interface{}, len(record.GetMetadata()))
+			for key, value := range record.GetMetadata() {
+				data.Metadata[key] = value
+			}
+		}
+		records = append(records, data)
+	}
+	return &models.StreamBatch{Sequence: batch.GetSequence(), Records: records}
+}
+
+var ackStatusToProto = map[string]ingestionv1.AckStatus{
+	models.AckAccepted:  ingestionv1.AckStatus_ACK_STATUS_ACCEPTED,
+	models.AckPartial:   ingestionv1.AckStatus_ACK_STATUS_PARTIAL,
+	models.AckRejected:  ingestionv1.AckStatus_ACK_STATUS_REJECTED,
+	models.AckDuplicate: ingestionv1.AckStatus_ACK_STATUS_DUPLICATE,
+}
+
+var backpressureLevelToProto = map[string]ingestionv1.BackpressureLevel{
+	models.BackpressureNone:  ingestionv1.BackpressureLevel_BACKPRESSURE_LEVEL_NONE,
+	models.BackpressureSlow:  ingestionv1.BackpressureLevel_BACKPRESSURE_LEVEL_SLOW,
+	models.BackpressurePause: ingestionv1.BackpressureLevel_BACKPRESSURE_LEVEL_PAUSE,
+}
+
+func ackToProto(ack *models.StreamAck) *ingestionv1.BatchAck {
+	return &ingestionv1.BatchAck{
+		Sequence:     ack.Sequence,
+		Status:       ackStatusToProto[ack.Status],
+		Accepted:     uint32(ack.Accepted),
+		Rejected:     uint32(ack.Rejected),
+		Errors:       ack.Errors,
+		TrafficIds:   ack.TrafficIDs,
+		Backpressure: backpressureToProto(ack.Backpressure),
+	}
+}
+
+func backpressureToProto(signal models.BackpressureSignal) *ingestionv1.Backpressure {
+	backpressure := &ingestionv1.Backpressure{
+		Level:            backpressureLevelToProto[signal.Level],
+		QueueUtilization: signal.QueueUtilization,
+		Credits:          uint32(signal.Credits),
+	}
+	if signal.RetryAfter > 0 {
+		backpressure.RetryAfter = durationpb.New(signal.RetryAfter)
+	}
+	return backpressure
+}
+
+func summaryToProto(info models.StreamInfo) *ingestionv1.IngestSummary {
+	return &ingestionv1.IngestSummary{
+		StreamId:     info.ID,
+		LastSequence: info.LastSequence,
+		Batches:      uint64(info.Batches),
+		Accepted:     uint64(info.Accepted),
+		Rejected:     uint64(info.Rejected),
+		Duplicates:   uint64(info.Duplicates),
+		Errors:       info.Errors,
+	}
+}
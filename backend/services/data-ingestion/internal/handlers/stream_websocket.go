@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/services/data-ingestion/internal/services"
+)
+
+const (
+	defaultStreamMessageSize = 16 * 1024 * 1024
+	streamWriteTimeout       = 10 * time.Second
+)
+
+// StreamHandler serves WebSocket streaming ingest and stream status
+type StreamHandler struct {
+	streamService  services.StreamIngestionServiceInterface
+	logger         Logger
+	upgrader       websocket.Upgrader
+	maxMessageSize int64
+}
+
+// streamClientMessage is a JSON text frame sent by a WebSocket client.
+// Type is "batch" (sequence and records) or "close" to finish the stream.
+type streamClientMessage struct {
+	Type     string               `json:"type"`
+	Sequence uint64               `json:"sequence"`
+	Records  []models.TrafficData `json:"records"`
+}
+
+// streamServerMessage is a JSON text frame sent to a WebSocket client. Type is
+// "ready", "ack", "backpressure", "summary" or "error".
+type streamServerMessage struct {
+	Type         string                     `json:"type"`
+	StreamID     string                     `json:"stream_id,omitempty"`
+	Sequence     uint64                     `json:"sequence,omitempty"`
+	Ack          *models.StreamAck          `json:"ack,omitempty"`
+	Backpressure *models.BackpressureSignal `json:"backpressure,omitempty"`
+	Summary      *models.StreamInfo         `json:"summary,omitempty"`
+	Error        string                     `json:"error,omitempty"`
+}
+
+func NewStreamHandler(streamService services.StreamIngestionServiceInterface, logger Logger, maxMessageSize int) *StreamHandler {
+	if maxMessageSize <= 0 {
+		maxMessageSize = defaultStreamMessageSize
+	}
+	return &StreamHandler{
+		streamService: streamService,
+		logger:        logger,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  64 * 1024,
+			WriteBufferSize: 64 * 1024,
+		},
+		maxMessageSize: int64(maxMessageSize),
+	}
+}
+
+// StreamTraffic upgrades to a WebSocket and ingests sequenced batches, acknowledging
+// each one. While the queue is saturated the server stops reading frames.
+func (h *StreamHandler) StreamTraffic(c *gin.Context) {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	// Open before upgrading so a full server can still answer with a plain HTTP error
+	ingest, err := h.streamService.OpenStream(ctx, "websocket", c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	defer ingest.Close()
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		h.logger.Error("Failed to upgrade stream connection", "error", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(h.maxMessageSize)
+
+	send := func(message streamServerMessage) error {
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		return conn.WriteJSON(message)
+	}
+
+	signal := h.streamService.GetBackpressure(ctx)
+	if err := send(streamServerMessage{Type: "ready", StreamID: ingest.ID(), Backpressure: &signal}); err != nil {
+		return
+	}
+
+	for {
+		var sendErr error
+		paused := false
+		signal, err := ingest.WaitForCapacity(ctx, func(signal models.BackpressureSignal) {
+			paused = true
+			sendErr = send(streamServerMessage{Type: "backpressure", Sequence: ingest.Info().LastSequence, Backpressure: &signal})
+		})
+		if err != nil || sendErr != nil {
+			return
+		}
+		if paused {
+			if err := send(streamServerMessage{Type: "backpressure", Sequence: ingest.Info().LastSequence, Backpressure: &signal}); err != nil {
+				return
+			}
+		}
+
+		var message streamClientMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			if isJSONDecodeError(err) {
+				send(streamServerMessage{Type: "error", Error: "invalid message: " + err.Error()})
+				h.closeStream(conn, websocket.CloseUnsupportedData, "invalid message")
+			} else if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				h.logger.Warn("Stream connection closed", "stream_id", ingest.ID(), "error", err)
+			}
+			return
+		}
+
+		switch message.Type {
+		case "batch", "":
+			ack := ingest.Submit(ctx, &models.StreamBatch{Sequence: message.Sequence, Records: message.Records})
+			if err := send(streamServerMessage{Type: "ack", Sequence: ack.Sequence, Ack: ack}); err != nil {
+				return
+			}
+		case "close":
+			summary := ingest.Close()
+			send(streamServerMessage{Type: "summary", StreamID: summary.ID, Sequence: summary.LastSequence, Summary: &summary})
+			h.closeStream(conn, websocket.CloseNormalClosure, "")
+			return
+		default:
+			if err := send(streamServerMessage{Type: "error", Error: "unknown message type: " + message.Type}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// GetStreams returns the open ingest streams and the current backpressure signal
+func (h *StreamHandler) GetStreams(c *gin.Context) {
+	streams, err := h.streamService.GetStreams(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to get streams", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get streams"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"streams":      streams,
+		"backpressure": h.streamService.GetBackpressure(c.Request.Context()),
+	})
+}
+
+func (h *StreamHandler) closeStream(conn *websocket.Conn, code int, reason string) {
+	deadline := time.Now().Add(streamWriteTimeout)
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+}
+
+func isJSONDecodeError(err error) bool {
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// CaptureImportRequest describes an uploaded traffic capture
+type CaptureImportRequest struct {
+	Format string   `json:"format"` // "har", "pcap", "pcapng" or "mitmproxy"; detected when empty
+	Name   string   `json:"name"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// CaptureImportResult represents the outcome of a capture import
+type CaptureImportResult struct {
+	ID              string        `json:"id"`
+	Format          string        `json:"format"`
+	Name            string        `json:"name"`
+	Status          string        `json:"status"`
+	TotalRecords    int           `json:"total_records"`
+	ImportedRecords int           `json:"imported_records"`
+	FailedRecords   int           `json:"failed_records"`
+	SkippedRecords  int           `json:"skipped_records"`
+	Batches         int           `json:"batches"`
+	IngestionIDs    []string      `json:"ingestion_ids,omitempty"`
+	Errors          []string      `json:"errors,omitempty"`
+	StartTime       time.Time     `json:"start_time"`
+	EndTime         time.Time     `json:"end_time"`
+	Duration        time.Duration `json:"duration"`
+}
+
+// maxCaptureImportErrors bounds the errors kept on an import result
+const maxCaptureImportErrors = 100
+
+// Methods for CaptureImportResult
+func (r *CaptureImportResult) AddError(error string) {
+	if len(r.Errors) < maxCaptureImportErrors {
+		r.Errors = append(r.Errors, error)
+	}
+}
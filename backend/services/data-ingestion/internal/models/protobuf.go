@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// DescriptorRegistration represents a request to register protobuf descriptors
+type DescriptorRegistration struct {
+	Name          string            `json:"name"`
+	Service       string            `json:"service,omitempty"`
+	PathPrefix    string            `json:"path_prefix,omitempty"`
+	DescriptorSet []byte            `json:"descriptor_set,omitempty"` // serialized google.protobuf.FileDescriptorSet
+	ProtoFiles    map[string]string `json:"proto_files,omitempty"`    // file name -> .proto source
+}
+
+// DescriptorSetInfo represents a registered set of protobuf descriptors
+type DescriptorSetInfo struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Service      string    `json:"service,omitempty"`
+	PathPrefix   string    `json:"path_prefix,omitempty"`
+	Files        []string  `json:"files"`
+	Messages     []string  `json:"messages"`
+	GRPCServices []string  `json:"grpc_services"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ProtobufTarget identifies which message type a protobuf payload should decode into
+type ProtobufTarget struct {
+	Service     string `json:"service,omitempty"`
+	Path        string `json:"path,omitempty"`         // gRPC method path, e.g. /pkg.Service/Method
+	MessageType string `json:"message_type,omitempty"` // fully-qualified message name
+	Response    bool   `json:"response,omitempty"`     // decode as the method's output type
+}
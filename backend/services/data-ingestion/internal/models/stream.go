@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+)
+
+// Backpressure levels reported to streaming clients
+const (
+	BackpressureNone  = "none"
+	BackpressureSlow  = "slow"
+	BackpressurePause = "pause"
+)
+
+// Acknowledgement statuses for streamed batches
+const (
+	AckAccepted  = "accepted"
+	AckPartial   = "partial"
+	AckRejected  = "rejected"
+	AckDuplicate = "duplicate"
+)
+
+// StreamBatch is one sequenced batch received on a streaming ingest channel
+type StreamBatch struct {
+	Sequence uint64        `json:"sequence"`
+	Records  []TrafficData `json:"records"`
+}
+
+// StreamAck acknowledges a StreamBatch
+type StreamAck struct {
+	Sequence     uint64             `json:"sequence"`
+	Status       string             `json:"status"`
+	Accepted     int                `json:"accepted"`
+	Rejected     int                `json:"rejected"`
+	Errors       []string           `json:"errors,omitempty"`
+	TrafficIDs   []string           `json:"traffic_ids,omitempty"`
+	Backpressure BackpressureSignal `json:"backpressure"`
+}
+
+// BackpressureSignal tells a streaming client how fast it may send
+type BackpressureSignal struct {
+	Level            string        `json:"level"`
+	QueueUtilization float64       `json:"queue_utilization"`
+	Credits          int           `json:"credits"` // batches allowed beyond the last acknowledged sequence
+	RetryAfter       time.Duration `json:"retry_after,omitempty"`
+}
+
+// StreamInfo describes an open or finished streaming ingest channel
+type StreamInfo struct {
+	ID           string    `json:"id"`
+	Transport    string    `json:"transport"` // "grpc" or "websocket"
+	Client       string    `json:"client"`
+	OpenedAt     time.Time `json:"opened_at"`
+	LastActivity time.Time `json:"last_activity"`
+	LastSequence uint64    `json:"last_sequence"`
+	Batches      int64     `json:"batches"`
+	Accepted     int64     `json:"accepted"`
+	Rejected     int64     `json:"rejected"`
+	Duplicates   int64     `json:"duplicates"`
+	Paused       int64     `json:"paused"`    // times the stream waited for queue capacity
+	Throttled    int64     `json:"throttled"` // batches rejected for exceeding granted credits
+	Errors       []string  `json:"errors,omitempty"`
+}
@@ -34,6 +34,20 @@ type TrafficData struct {
 	Tags          []string               `json:"tags" db:"tags"`
 	Priority      int                    `json:"priority" db:"priority"`
 	Status        string                 `json:"status" db:"status"`
+	SampleRate    float64                `json:"sample_rate" db:"sample_rate"`
+	Policy        string                 `json:"policy,omitempty" db:"policy"`
+	BodyHash      string                 `json:"body_hash,omitempty" db:"body_hash"`
+	BodyTruncated bool                   `json:"body_truncated,omitempty" db:"body_truncated"`
+	ResponseHash  string                 `json:"response_hash,omitempty" db:"response_hash"`
+	ResponseTruncated bool               `json:"response_truncated,omitempty" db:"response_truncated"`
+	Redacted      []string               `json:"redacted,omitempty" db:"redacted"`
+	Decoded       []string               `json:"decoded,omitempty" db:"decoded"`
+	DecodeErrors  []string               `json:"decode_errors,omitempty" db:"decode_errors"`
+	BodyFormat    string                 `json:"body_format,omitempty" db:"body_format"`
+	BodyFields    []ParsedField          `json:"body_fields,omitempty" db:"-"`
+	ResponseFormat string                `json:"response_format,omitempty" db:"response_format"`
+	ResponseFields []ParsedField         `json:"response_fields,omitempty" db:"-"`
+	ParseErrors   []string               `json:"parse_errors,omitempty" db:"parse_errors"`
 	CreatedAt     time.Time              `json:"created_at" db:"created_at"`
 	UpdatedAt     time.Time              `json:"updated_at" db:"updated_at"`
 }
@@ -48,6 +62,17 @@ type BatchTrafficData struct {
 	Errors    []string       `json:"errors,omitempty"`
 }
 
+// DecodedBody is a body with its content codings removed and its charset
+// converted to UTF-8
+type DecodedBody struct {
+	Data         []byte   `json:"data"`
+	Text         string   `json:"text,omitempty"`
+	Encodings    []string `json:"encodings,omitempty"`
+	Charset      string   `json:"charset,omitempty"`
+	OriginalSize int      `json:"original_size"`
+	DecodedSize  int      `json:"decoded_size"`
+}
+
 // ParsedData represents parsed traffic data
 type ParsedData struct {
 	ID           string                 `json:"id"`
@@ -59,10 +84,26 @@ type ParsedData struct {
 	Validation   ValidationResult       `json:"validation"`
 	Errors       []ParseError           `json:"errors,omitempty"`
 	Warnings     []ParseWarning         `json:"warnings,omitempty"`
+	Fields       []ParsedField          `json:"fields,omitempty"`
 	ProcessingTime time.Duration        `json:"processing_time"`
 	CreatedAt    time.Time              `json:"created_at"`
 }
 
+// ParsedField is one leaf value of a parsed body, addressed by a JSONPath-style
+// path such as $.user.email, so threat, PII and discovery consumers can inspect
+// fields individually. Multipart files carry their size and hash, not content.
+type ParsedField struct {
+	Path        string `json:"path"`
+	Kind        string `json:"kind"` // value, file, variable, argument, operation
+	Type        string `json:"type"` // string, number, boolean, null, file
+	Value       string `json:"value,omitempty"`
+	Truncated   bool   `json:"truncated,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int    `json:"size,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+}
+
 // ValidationResult represents validation results
 type ValidationResult struct {
 	Valid    bool     `json:"valid"`
@@ -107,6 +148,8 @@ type NormalizedData struct {
 type Transformation struct {
 	Type      string                 `json:"type"`
 	Name      string                 `json:"name"`
+	Field     string                 `json:"field,omitempty"`
+	Target    string                 `json:"target,omitempty"`
 	Config    map[string]interface{} `json:"config"`
 	Input     interface{}            `json:"input"`
 	Output    interface{}            `json:"output"`
@@ -141,6 +184,7 @@ type IngestionResponse struct {
 	NormalizedIDs []string              `json:"normalized_ids,omitempty"`
 	Errors       []string               `json:"errors,omitempty"`
 	Warnings     []string               `json:"warnings,omitempty"`
+	Filtered     int                    `json:"filtered,omitempty"`
 	ProcessingTime time.Duration        `json:"processing_time"`
 	CreatedAt    time.Time              `json:"created_at"`
 }
@@ -148,16 +192,34 @@ type IngestionResponse struct {
 // IngestionStatus represents ingestion status
 type IngestionStatus struct {
 	ID           string                 `json:"id"`
+	Kind         string                 `json:"kind,omitempty"`
 	Status       string                 `json:"status"`
 	Progress     float64                `json:"progress"`
 	TotalItems   int                    `json:"total_items"`
 	ProcessedItems int                  `json:"processed_items"`
 	FailedItems  int                    `json:"failed_items"`
+	FilteredItems int                   `json:"filtered_items,omitempty"`
 	Errors       []string               `json:"errors,omitempty"`
 	StartTime    time.Time              `json:"start_time"`
 	EndTime      *time.Time             `json:"end_time,omitempty"`
 	Duration     *time.Duration         `json:"duration,omitempty"`
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	Batches      []IngestionBatchStatus `json:"batches,omitempty"`
+}
+
+// IngestionBatchStatus records how one batch of an ingestion job was published
+type IngestionBatchStatus struct {
+	ID        string    `json:"id" db:"id"`
+	JobID     string    `json:"job_id" db:"job_id"`
+	BatchID   string    `json:"batch_id" db:"batch_id"`
+	Records   int       `json:"records" db:"record_count"`
+	Published int       `json:"published" db:"published_count"`
+	Filtered  int       `json:"filtered" db:"filtered_count"`
+	Failed    int       `json:"failed" db:"failed_count"`
+	Status    string    `json:"status" db:"status"`
+	Error     string    `json:"error,omitempty" db:"error"`
+	Topic     string    `json:"topic" db:"topic"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
 // IngestionStats represents ingestion statistics
@@ -166,6 +228,10 @@ type IngestionStats struct {
 	TotalParsed      int64     `json:"total_parsed"`
 	TotalNormalized  int64     `json:"total_normalized"`
 	TotalErrors      int64     `json:"total_errors"`
+	TotalSampledOut  int64     `json:"total_sampled_out"`
+	TotalDeduplicated int64    `json:"total_deduplicated"`
+	TotalTruncated   int64     `json:"total_truncated"`
+	TotalRedacted    int64     `json:"total_redacted"`
 	AverageProcessingTime time.Duration `json:"average_processing_time"`
 	SuccessRate      float64   `json:"success_rate"`
 	ErrorRate        float64   `json:"error_rate"`
@@ -175,6 +241,23 @@ type IngestionStats struct {
 	Schemas          map[string]int64 `json:"schemas"`
 	Sources          map[string]int64 `json:"sources"`
 	TimeRange        TimeRange `json:"time_range"`
+	Rollups          []IngestionRollup `json:"rollups,omitempty"`
+}
+
+// IngestionRollup holds the ingestion counters for one minute
+type IngestionRollup struct {
+	Minute            time.Time     `json:"minute" db:"minute"`
+	Ingested          int64         `json:"ingested" db:"ingested"`
+	Succeeded         int64         `json:"succeeded" db:"succeeded"`
+	Errors            int64         `json:"errors" db:"errors"`
+	SampledOut        int64         `json:"sampled_out" db:"sampled_out"`
+	Deduplicated      int64         `json:"deduplicated" db:"deduplicated"`
+	Truncated         int64         `json:"truncated" db:"truncated"`
+	Redacted          int64         `json:"redacted" db:"redacted"`
+	ProcessingTime    time.Duration `json:"processing_time" db:"processing_time_us"`
+	MaxProcessingTime time.Duration `json:"max_processing_time" db:"max_processing_time_us"`
+	LastIngestion     *time.Time    `json:"last_ingestion,omitempty" db:"last_ingestion"`
+	LastError         *time.Time    `json:"last_error,omitempty" db:"last_error"`
 }
 
 // TimeRange represents a time range
@@ -199,6 +282,22 @@ type QueueStatus struct {
 	Health         string                 `json:"health"`
 	Errors         []string               `json:"errors,omitempty"`
 	Metrics        map[string]interface{} `json:"metrics,omitempty"`
+	Spool          *SpoolStatus           `json:"spool,omitempty"`
+}
+
+// SpoolStatus represents the on-disk spool used while Kafka is unavailable
+type SpoolStatus struct {
+	Enabled        bool       `json:"enabled"`
+	Depth          int        `json:"depth"`
+	Bytes          int64      `json:"bytes"`
+	Segments       int        `json:"segments"`
+	MaxBytes       int64      `json:"max_bytes"`
+	OldestRecord   *time.Time `json:"oldest_record,omitempty"`
+	Dropped        int64      `json:"dropped"`
+	Corrupted      int64      `json:"corrupted"`
+	Replaying      bool       `json:"replaying"`
+	LastReplay     *time.Time `json:"last_replay,omitempty"`
+	KafkaAvailable bool       `json:"kafka_available"`
 }
 
 // TopicInfo represents Kafka topic information
@@ -233,10 +332,26 @@ type SchemaInfo struct {
 	Fields      map[string]FieldInfo   `json:"fields"`
 	Required    []string               `json:"required"`
 	Validators  []ValidatorInfo        `json:"validators"`
+	Transforms  []TransformSpec        `json:"transforms,omitempty"`
 	CreatedAt   time.Time              `json:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at"`
 }
 
+// TransformSpec declares a field transform applied, in order, before schema mapping.
+// Field and Target are dot-separated paths into the parsed document.
+type TransformSpec struct {
+	Type    string      `json:"type"`              // rename, coerce, timestamp, canonicalize_headers, normalize_ip, normalize_url, drop, derive
+	Name    string      `json:"name,omitempty"`
+	Field   string      `json:"field,omitempty"`
+	Target  string      `json:"target,omitempty"`  // defaults to Field
+	Fields  []string    `json:"fields,omitempty"`  // drop
+	Path    string      `json:"path,omitempty"`    // derive: JSONPath expression
+	To      string      `json:"to,omitempty"`      // coerce type, timestamp output or header case
+	Formats []string    `json:"formats,omitempty"` // timestamp input formats
+	Scale   float64     `json:"scale,omitempty"`   // coerce: multiplier applied to numbers
+	Default interface{} `json:"default,omitempty"` // derive: value when the path matches nothing
+}
+
 // FieldInfo represents field information
 type FieldInfo struct {
 	Type        string      `json:"type"`
@@ -0,0 +1,222 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v26.1.0
+// source: ingestion/v1/stream.proto
+
+package ingestionv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	TrafficIngestion_IngestTraffic_FullMethodName = "/scopeapi.ingestion.v1.TrafficIngestion/IngestTraffic"
+	TrafficIngestion_StreamTraffic_FullMethodName = "/scopeapi.ingestion.v1.TrafficIngestion/StreamTraffic"
+)
+
+// TrafficIngestionClient is the client API for TrafficIngestion service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TrafficIngestionClient interface {
+	// IngestTraffic reads batches until the client half-closes, then returns a summary.
+	// The server stops reading while the ingestion queue is saturated, so HTTP/2
+	// flow control pushes back on the client.
+	IngestTraffic(ctx context.Context, opts ...grpc.CallOption) (TrafficIngestion_IngestTrafficClient, error)
+	// StreamTraffic acknowledges every batch with its sequence number and the
+	// current backpressure signal.
+	StreamTraffic(ctx context.Context, opts ...grpc.CallOption) (TrafficIngestion_StreamTrafficClient, error)
+}
+
+type trafficIngestionClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTrafficIngestionClient(cc grpc.ClientConnInterface) TrafficIngestionClient {
+	return &trafficIngestionClient{cc}
+}
+
+func (c *trafficIngestionClient) IngestTraffic(ctx context.Context, opts ...grpc.CallOption) (TrafficIngestion_IngestTrafficClient, error) {
+	stream, err := c.cc.NewStream(ctx, &TrafficIngestion_ServiceDesc.Streams[0], TrafficIngestion_IngestTraffic_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &trafficIngestionIngestTrafficClient{stream}
+	return x, nil
+}
+
+type TrafficIngestion_IngestTrafficClient interface {
+	Send(*TrafficBatch) error
+	CloseAndRecv() (*IngestSummary, error)
+	grpc.ClientStream
+}
+
+type trafficIngestionIngestTrafficClient struct {
+	grpc.ClientStream
+}
+
+func (x *trafficIngestionIngestTrafficClient) Send(m *TrafficBatch) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *trafficIngestionIngestTrafficClient) CloseAndRecv() (*IngestSummary, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(IngestSummary)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *trafficIngestionClient) StreamTraffic(ctx context.Context, opts ...grpc.CallOption) (TrafficIngestion_StreamTrafficClient, error) {
+	stream, err := c.cc.NewStream(ctx, &TrafficIngestion_ServiceDesc.Streams[1], TrafficIngestion_StreamTraffic_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &trafficIngestionStreamTrafficClient{stream}
+	return x, nil
+}
+
+type TrafficIngestion_StreamTrafficClient interface {
+	Send(*TrafficBatch) error
+	Recv() (*BatchAck, error)
+	grpc.ClientStream
+}
+
+type trafficIngestionStreamTrafficClient struct {
+	grpc.ClientStream
+}
+
+func (x *trafficIngestionStreamTrafficClient) Send(m *TrafficBatch) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *trafficIngestionStreamTrafficClient) Recv() (*BatchAck, error) {
+	m := new(BatchAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TrafficIngestionServer is the server API for TrafficIngestion service.
+// All implementations must embed UnimplementedTrafficIngestionServer
+// for forward compatibility
+type TrafficIngestionServer interface {
+	// IngestTraffic reads batches until the client half-closes, then returns a summary.
+	// The server stops reading while the ingestion queue is saturated, so HTTP/2
+	// flow control pushes back on the client.
+	IngestTraffic(TrafficIngestion_IngestTrafficServer) error
+	// StreamTraffic acknowledges every batch with its sequence number and the
+	// current backpressure signal.
+	StreamTraffic(TrafficIngestion_StreamTrafficServer) error
+	mustEmbedUnimplementedTrafficIngestionServer()
+}
+
+// UnimplementedTrafficIngestionServer must be embedded to have forward compatible implementations.
+type UnimplementedTrafficIngestionServer struct {
+}
+
+func (UnimplementedTrafficIngestionServer) IngestTraffic(TrafficIngestion_IngestTrafficServer) error {
+	return status.Errorf(codes.Unimplemented, "method IngestTraffic not implemented")
+}
+func (UnimplementedTrafficIngestionServer) StreamTraffic(TrafficIngestion_StreamTrafficServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamTraffic not implemented")
+}
+func (UnimplementedTrafficIngestionServer) mustEmbedUnimplementedTrafficIngestionServer() {}
+
+// UnsafeTrafficIngestionServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TrafficIngestionServer will
+// result in compilation errors.
+type UnsafeTrafficIngestionServer interface {
+	mustEmbedUnimplementedTrafficIngestionServer()
+}
+
+func RegisterTrafficIngestionServer(s grpc.ServiceRegistrar, srv TrafficIngestionServer) {
+	s.RegisterService(&TrafficIngestion_ServiceDesc, srv)
+}
+
+func _TrafficIngestion_IngestTraffic_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TrafficIngestionServer).IngestTraffic(&trafficIngestionIngestTrafficServer{stream})
+}
+
+type TrafficIngestion_IngestTrafficServer interface {
+	SendAndClose(*IngestSummary) error
+	Recv() (*TrafficBatch, error)
+	grpc.ServerStream
+}
+
+type trafficIngestionIngestTrafficServer struct {
+	grpc.ServerStream
+}
+
+func (x *trafficIngestionIngestTrafficServer) SendAndClose(m *IngestSummary) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *trafficIngestionIngestTrafficServer) Recv() (*TrafficBatch, error) {
+	m := new(TrafficBatch)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _TrafficIngestion_StreamTraffic_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TrafficIngestionServer).StreamTraffic(&trafficIngestionStreamTrafficServer{stream})
+}
+
+type TrafficIngestion_StreamTrafficServer interface {
+	Send(*BatchAck) error
+	Recv() (*TrafficBatch, error)
+	grpc.ServerStream
+}
+
+type trafficIngestionStreamTrafficServer struct {
+	grpc.ServerStream
+}
+
+func (x *trafficIngestionStreamTrafficServer) Send(m *BatchAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *trafficIngestionStreamTrafficServer) Recv() (*TrafficBatch, error) {
+	m := new(TrafficBatch)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TrafficIngestion_ServiceDesc is the grpc.ServiceDesc for TrafficIngestion service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TrafficIngestion_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "scopeapi.ingestion.v1.TrafficIngestion",
+	HandlerType: (*TrafficIngestionServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "IngestTraffic",
+			Handler:       _TrafficIngestion_IngestTraffic_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "StreamTraffic",
+			Handler:       _TrafficIngestion_StreamTraffic_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ingestion/v1/stream.proto",
+}
@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+)
+
+type IngestionRepositoryInterface interface {
+	// SaveStatus inserts or updates an ingestion job together with its batches
+	SaveStatus(ctx context.Context, status *models.IngestionStatus) error
+	// GetStatus returns a job and its batches, or nil when it does not exist
+	GetStatus(ctx context.Context, id string) (*models.IngestionStatus, error)
+	// AddRollups adds per-minute counters to the stored rollups
+	AddRollups(ctx context.Context, rollups []models.IngestionRollup) error
+	// GetRollups returns the rollups for minutes in [start, end), oldest first
+	GetRollups(ctx context.Context, start, end time.Time) ([]models.IngestionRollup, error)
+}
+
+// PostgresIngestionRepository stores ingestion jobs and stats in the tables
+// created by the shared postgresql migrations
+type PostgresIngestionRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresIngestionRepository(db *sql.DB) *PostgresIngestionRepository {
+	return &PostgresIngestionRepository{db: db}
+}
+
+func (r *PostgresIngestionRepository) SaveStatus(ctx context.Context, status *models.IngestionStatus) error {
+	errs, err := json.Marshal(nonNilStrings(status.Errors))
+	if err != nil {
+		return fmt.Errorf("failed to marshal job errors: %w", err)
+	}
+	var metadata []byte
+	if status.Metadata != nil {
+		if metadata, err = json.Marshal(status.Metadata); err != nil {
+			return fmt.Errorf("failed to marshal job metadata: %w", err)
+		}
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO ingestion_jobs (id, kind, status, progress, total_items, processed_items, failed_items,
+			filtered_items, errors, metadata, started_at, ended_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NOW())
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			progress = EXCLUDED.progress,
+			total_items = EXCLUDED.total_items,
+			processed_items = EXCLUDED.processed_items,
+			failed_items = EXCLUDED.failed_items,
+			filtered_items = EXCLUDED.filtered_items,
+			errors = EXCLUDED.errors,
+			metadata = EXCLUDED.metadata,
+			ended_at = EXCLUDED.ended_at,
+			updated_at = NOW()`,
+		status.ID, status.Kind, status.Status, status.Progress, status.TotalItems, status.ProcessedItems,
+		status.FailedItems, status.FilteredItems, string(errs), nullableJSON(metadata), status.StartTime, status.EndTime)
+	if err != nil {
+		return fmt.Errorf("failed to save ingestion job %s: %w", status.ID, err)
+	}
+
+	for _, batch := range status.Batches {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO ingestion_batches (id, job_id, batch_id, record_count, published_count, filtered_count,
+				failed_count, status, error, topic, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			ON CONFLICT (id) DO UPDATE SET
+				published_count = EXCLUDED.published_count,
+				filtered_count = EXCLUDED.filtered_count,
+				failed_count = EXCLUDED.failed_count,
+				status = EXCLUDED.status,
+				error = EXCLUDED.error`,
+			batch.ID, status.ID, batch.BatchID, batch.Records, batch.Published, batch.Filtered,
+			batch.Failed, batch.Status, nullableString(batch.Error), nullableString(batch.Topic), batch.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to save ingestion batch %s: %w", batch.BatchID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit ingestion job %s: %w", status.ID, err)
+	}
+	return nil
+}
+
+func (r *PostgresIngestionRepository) GetStatus(ctx context.Context, id string) (*models.IngestionStatus, error) {
+	var (
+		status   models.IngestionStatus
+		errs     []byte
+		metadata []byte
+		endTime  sql.NullTime
+	)
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, kind, status, progress, total_items, processed_items, failed_items, filtered_items,
+			errors, metadata, started_at, ended_at
+		FROM ingestion_jobs WHERE id::text = $1`, id).Scan(
+		&status.ID, &status.Kind, &status.Status, &status.Progress, &status.TotalItems, &status.ProcessedItems,
+		&status.FailedItems, &status.FilteredItems, &errs, &metadata, &status.StartTime, &endTime)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ingestion job %s: %w", id, err)
+	}
+
+	if err := json.Unmarshal(errs, &status.Errors); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job errors: %w", err)
+	}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &status.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal job metadata: %w", err)
+		}
+	}
+	if endTime.Valid {
+		end := endTime.Time
+		duration := end.Sub(status.StartTime)
+		status.EndTime = &end
+		status.Duration = &duration
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, batch_id, record_count, published_count, filtered_count, failed_count, status,
+			COALESCE(error, ''), COALESCE(topic, ''), created_at
+		FROM ingestion_batches WHERE job_id = $1 ORDER BY created_at`, status.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ingestion batches for job %s: %w", id, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		batch := models.IngestionBatchStatus{JobID: status.ID}
+		if err := rows.Scan(&batch.ID, &batch.BatchID, &batch.Records, &batch.Published, &batch.Filtered,
+			&batch.Failed, &batch.Status, &batch.Error, &batch.Topic, &batch.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan ingestion batch: %w", err)
+		}
+		status.Batches = append(status.Batches, batch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ingestion batches: %w", err)
+	}
+
+	return &status, nil
+}
+
+func (r *PostgresIngestionRepository) AddRollups(ctx context.Context, rollups []models.IngestionRollup) error {
+	if len(rollups) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, rollup := range rollups {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO ingestion_stats_minute (minute, ingested, succeeded, errors, sampled_out, deduplicated,
+				truncated, redacted, processing_time_us, max_processing_time_us, last_ingestion, last_error)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			ON CONFLICT (minute) DO UPDATE SET
+				ingested = ingestion_stats_minute.ingested + EXCLUDED.ingested,
+				succeeded = ingestion_stats_minute.succeeded + EXCLUDED.succeeded,
+				errors = ingestion_stats_minute.errors + EXCLUDED.errors,
+				sampled_out = ingestion_stats_minute.sampled_out + EXCLUDED.sampled_out,
+				deduplicated = ingestion_stats_minute.deduplicated + EXCLUDED.deduplicated,
+				truncated = ingestion_stats_minute.truncated + EXCLUDED.truncated,
+				redacted = ingestion_stats_minute.redacted + EXCLUDED.redacted,
+				processing_time_us = ingestion_stats_minute.processing_time_us + EXCLUDED.processing_time_us,
+				max_processing_time_us = GREATEST(ingestion_stats_minute.max_processing_time_us, EXCLUDED.max_processing_time_us),
+				last_ingestion = GREATEST(ingestion_stats_minute.last_ingestion, EXCLUDED.last_ingestion),
+				last_error = GREATEST(ingestion_stats_minute.last_error, EXCLUDED.last_error)`,
+			rollup.Minute.UTC(), rollup.Ingested, rollup.Succeeded, rollup.Errors, rollup.SampledOut,
+			rollup.Deduplicated, rollup.Truncated, rollup.Redacted, rollup.ProcessingTime.Microseconds(),
+			rollup.MaxProcessingTime.Microseconds(), rollup.LastIngestion, rollup.LastError)
+		if err != nil {
+			return fmt.Errorf("failed to add rollup for %s: %w", rollup.Minute.Format(time.RFC3339), err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rollups: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresIngestionRepository) GetRollups(ctx context.Context, start, end time.Time) ([]models.IngestionRollup, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT minute, ingested, succeeded, errors, sampled_out, deduplicated, truncated, redacted,
+			processing_time_us, max_processing_time_us, last_ingestion, last_error
+		FROM ingestion_stats_minute
+		WHERE minute >= $1 AND minute < $2
+		ORDER BY minute`, start.UTC(), end.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rollups: %w", err)
+	}
+	defer rows.Close()
+
+	var rollups []models.IngestionRollup
+	for rows.Next() {
+		var (
+			rollup                   models.IngestionRollup
+			processingUS, maxUS      int64
+			lastIngestion, lastError sql.NullTime
+		)
+		if err := rows.Scan(&rollup.Minute, &rollup.Ingested, &rollup.Succeeded, &rollup.Errors, &rollup.SampledOut,
+			&rollup.Deduplicated, &rollup.Truncated, &rollup.Redacted, &processingUS, &maxUS,
+			&lastIngestion, &lastError); err != nil {
+			return nil, fmt.Errorf("failed to scan rollup: %w", err)
+		}
+		rollup.ProcessingTime = time.Duration(processingUS) * time.Microsecond
+		rollup.MaxProcessingTime = time.Duration(maxUS) * time.Microsecond
+		if lastIngestion.Valid {
+			rollup.LastIngestion = &lastIngestion.Time
+		}
+		if lastError.Valid {
+			rollup.LastError = &lastError.Time
+		}
+		rollups = append(rollups, rollup)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rollups: %w", err)
+	}
+	return rollups, nil
+}
+
+// Helper functions
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func nullableJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	// lib/pq sends []byte as bytea, so JSON goes over the wire as text
+	return string(data)
+}
+
+func nullableString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+)
+
+const (
+	defaultDecodeMaxBytes  = 10 << 20
+	defaultDecodeMaxRatio  = 100
+	defaultDecodeMaxLayers = 3
+	// Small bodies may legitimately compress far better than the ratio allows
+	decodeRatioFloor = 64 << 10
+)
+
+var (
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+	errUnsupportedCharset  = errors.New("unsupported charset")
+	errDecodeLimit         = errors.New("decoded body exceeds limit")
+)
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+	gzipMagic  = []byte{0x1F, 0x8B}
+	zstdMagic  = []byte{0x28, 0xB5, 0x2F, 0xFD}
+)
+
+// bodyDecoder removes content codings and converts charsets to UTF-8 so parsers
+// and scanners see the body the application saw. Every layer is bounded to stop
+// decompression bombs.
+type bodyDecoder struct {
+	maxBytes       int64
+	maxRatio       float64
+	maxLayers      int
+	defaultCharset encoding.Encoding
+	defaultName    string
+}
+
+func newBodyDecoder(cfg config.DecodingConfig) (*bodyDecoder, error) {
+	d := &bodyDecoder{
+		maxBytes:  cfg.MaxBytes,
+		maxRatio:  cfg.MaxRatio,
+		maxLayers: cfg.MaxLayers,
+	}
+	if d.maxBytes <= 0 {
+		d.maxBytes = defaultDecodeMaxBytes
+	}
+	if d.maxRatio <= 0 {
+		d.maxRatio = defaultDecodeMaxRatio
+	}
+	if d.maxLayers <= 0 {
+		d.maxLayers = defaultDecodeMaxLayers
+	}
+	if cfg.DefaultCharset != "" {
+		enc, err := htmlindex.Get(cfg.DefaultCharset)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errUnsupportedCharset, cfg.DefaultCharset)
+		}
+		d.defaultCharset = enc
+		d.defaultName, _ = htmlindex.Name(enc)
+	}
+	return d, nil
+}
+
+// decode removes the codings listed in contentEncoding, last applied first, and
+// converts the charset named in contentType to UTF-8. Text is only set when the
+// result is valid UTF-8.
+func (d *bodyDecoder) decode(body []byte, contentEncoding string, contentType string) (*models.DecodedBody, error) {
+	decoded := &models.DecodedBody{Data: body, OriginalSize: len(body)}
+
+	codings := parseContentEncoding(contentEncoding)
+	if len(codings) > d.maxLayers {
+		return nil, fmt.Errorf("%w: %d content codings, at most %d allowed", errDecodeLimit, len(codings), d.maxLayers)
+	}
+	for i := len(codings) - 1; i >= 0; i-- {
+		data, err := d.decodeLayer(codings[i], decoded.Data)
+		if err != nil {
+			return nil, err
+		}
+		decoded.Data = data
+		decoded.Encodings = append(decoded.Encodings, codings[i])
+	}
+
+	data, charset, err := d.decodeCharset(decoded.Data, contentType)
+	if err != nil {
+		return nil, err
+	}
+	decoded.Data = data
+	decoded.Charset = charset
+	decoded.DecodedSize = len(decoded.Data)
+	if utf8.Valid(decoded.Data) {
+		decoded.Text = string(decoded.Data)
+	}
+	return decoded, nil
+}
+
+func (d *bodyDecoder) decodeLayer(coding string, data []byte) ([]byte, error) {
+	limit := d.layerLimit(len(data))
+
+	var reader io.Reader
+	switch coding {
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	case "deflate":
+		// HTTP deflate is zlib-wrapped, but plenty of servers send raw deflate
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			zr = flate.NewReader(bytes.NewReader(data))
+		}
+		defer zr.Close()
+		reader = zr
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(data),
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(limit)+1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd body: %w", err)
+		}
+		defer zr.Close()
+		reader = zr
+	case "br":
+		reader = brotli.NewReader(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedEncoding, coding)
+	}
+
+	decoded, err := readLimited(reader, limit)
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		return nil, fmt.Errorf("%w of %d bytes", errDecodeLimit, limit)
+	}
+	if err != nil && !errors.Is(err, errDecodeLimit) {
+		return nil, fmt.Errorf("invalid %s body: %w", coding, err)
+	}
+	return decoded, err
+}
+
+// layerLimit caps a layer at maxRatio times its input, never below the ratio
+// floor and never above maxBytes
+func (d *bodyDecoder) layerLimit(size int) int64 {
+	limit := int64(float64(size) * d.maxRatio)
+	if limit < decodeRatioFloor {
+		limit = decodeRatioFloor
+	}
+	if limit > d.maxBytes {
+		limit = d.maxBytes
+	}
+	return limit
+}
+
+// decodeCharset converts data to UTF-8. A byte order mark wins over the declared
+// charset; the default charset only applies to textual bodies that are not
+// already valid UTF-8.
+func (d *bodyDecoder) decodeCharset(data []byte, contentType string) ([]byte, string, error) {
+	var enc encoding.Encoding
+	name := contentTypeCharset(contentType)
+
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return data[len(utf8BOM):], "utf-8", nil
+	case bytes.HasPrefix(data, utf16LEBOM):
+		enc, name = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), "utf-16le"
+	case bytes.HasPrefix(data, utf16BEBOM):
+		enc, name = unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), "utf-16be"
+	case name != "":
+		var err error
+		if enc, err = htmlindex.Get(name); err != nil {
+			return nil, "", fmt.Errorf("%w: %s", errUnsupportedCharset, name)
+		}
+		name, _ = htmlindex.Name(enc)
+	case d.defaultCharset != nil && isTextualContentType(contentType) && !utf8.Valid(data):
+		enc, name = d.defaultCharset, d.defaultName
+	default:
+		return data, "", nil
+	}
+
+	if enc == unicode.UTF8 {
+		return data, name, nil
+	}
+	decoded, err := readLimited(transform.NewReader(bytes.NewReader(data), enc.NewDecoder()), d.maxBytes)
+	if err != nil && !errors.Is(err, errDecodeLimit) {
+		return nil, "", fmt.Errorf("invalid %s body: %w", name, err)
+	}
+	return decoded, name, err
+}
+
+// Helper functions
+
+// parseContentEncoding returns the codings in the order they were applied,
+// without identity
+func parseContentEncoding(header string) []string {
+	var codings []string
+	for _, coding := range strings.Split(header, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "" && coding != "identity" {
+			codings = append(codings, coding)
+		}
+	}
+	return codings
+}
+
+// sniffContentEncoding recognises gzip, zstd and zlib bodies by their magic bytes
+func sniffContentEncoding(body []byte) string {
+	switch {
+	case bytes.HasPrefix(body, gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(body, zstdMagic):
+		return "zstd"
+	case len(body) >= 2 && body[0]&0x0F == 8 && (uint16(body[0])<<8|uint16(body[1]))%31 == 0:
+		return "deflate"
+	}
+	return ""
+}
+
+func contentTypeCharset(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(params["charset"])
+}
+
+func isTextualContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	for _, marker := range []string{"json", "xml", "yaml", "javascript", "graphql", "x-www-form-urlencoded"} {
+		if strings.Contains(mediaType, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func readLimited(reader io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w of %d bytes", errDecodeLimit, limit)
+	}
+	return data, nil
+}
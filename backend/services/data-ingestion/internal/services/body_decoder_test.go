@@ -0,0 +1,140 @@
+package services
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	w := gzip.NewWriter(&buffer)
+	w.Write(data)
+	w.Close()
+	return buffer.Bytes()
+}
+
+func brotliBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	w := brotli.NewWriter(&buffer)
+	w.Write(data)
+	w.Close()
+	return buffer.Bytes()
+}
+
+func TestBodyDecoderStackedCodingsAndCharset(t *testing.T) {
+	d, err := newBodyDecoder(config.DecodingConfig{})
+	if err != nil {
+		t.Fatalf("new decoder: %v", err)
+	}
+
+	// "café" in ISO-8859-1, deflated (raw) and then gzipped
+	latin1 := []byte("{\"name\":\"caf\xe9\"}")
+	var raw bytes.Buffer
+	fw, _ := flate.NewWriter(&raw, flate.BestCompression)
+	fw.Write(latin1)
+	fw.Close()
+	body := gzipBytes(t, raw.Bytes())
+
+	decoded, err := d.decode(body, "deflate, gzip", "application/json; charset=ISO-8859-1")
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.Text != `{"name":"café"}` {
+		t.Errorf("text = %q", decoded.Text)
+	}
+	if strings.Join(decoded.Encodings, ",") != "gzip,deflate" || decoded.Charset != "windows-1252" {
+		t.Errorf("encodings = %v, charset = %q", decoded.Encodings, decoded.Charset)
+	}
+
+	encoder, _ := zstd.NewWriter(nil)
+	compressed := encoder.EncodeAll([]byte("hello"), nil)
+	if decoded, err := d.decode(compressed, "zstd", "text/plain"); err != nil || decoded.Text != "hello" {
+		t.Errorf("zstd = %+v, %v", decoded, err)
+	}
+
+	if decoded, err := d.decode(brotliBytes(t, []byte(`{"ok":true}`)), "br", "application/json"); err != nil || decoded.Text != `{"ok":true}` {
+		t.Errorf("br = %+v, %v", decoded, err)
+	}
+	if _, err := d.decode([]byte("x"), "compress", ""); !errors.Is(err, errUnsupportedEncoding) {
+		t.Errorf("compress error = %v", err)
+	}
+	if _, err := d.decode([]byte("x"), "", "text/plain; charset=klingon"); !errors.Is(err, errUnsupportedCharset) {
+		t.Errorf("charset error = %v", err)
+	}
+}
+
+func TestBodyDecoderStopsDecompressionBombs(t *testing.T) {
+	d, _ := newBodyDecoder(config.DecodingConfig{MaxBytes: 1 << 20, MaxRatio: 10})
+
+	bomb := gzipBytes(t, make([]byte, 4<<20))
+	if _, err := d.decode(bomb, "gzip", ""); !errors.Is(err, errDecodeLimit) {
+		t.Fatalf("bomb error = %v", err)
+	}
+
+	// Highly compressible but small bodies stay under the ratio floor
+	small := gzipBytes(t, bytes.Repeat([]byte("a"), 32<<10))
+	if decoded, err := d.decode(small, "gzip", ""); err != nil || decoded.DecodedSize != 32<<10 {
+		t.Errorf("small body = %v", err)
+	}
+
+	brBomb := brotliBytes(t, make([]byte, 4<<20))
+	if _, err := d.decode(brBomb, "br", ""); !errors.Is(err, errDecodeLimit) {
+		t.Fatalf("br bomb error = %v", err)
+	}
+
+	if _, err := d.decode(small, "gzip,gzip,gzip,gzip", ""); !errors.Is(err, errDecodeLimit) {
+		t.Errorf("layer limit error = %v", err)
+	}
+}
+
+func TestIngestionDecodesBodiesBeforeRedaction(t *testing.T) {
+	service := newTestIngestionService(newMemoryIngestionRepository())
+
+	data := &models.TrafficData{
+		Method:          "POST",
+		Path:            "/login",
+		Headers:         map[string]string{"Content-Encoding": "gzip", "Content-Type": "application/json"},
+		Body:            gzipBytes(t, []byte(`{"password":"hunter2"}`)),
+		ResponseHeaders: map[string]string{"Content-Type": "text/plain; charset=utf-16"},
+		ResponseBody:    []byte{0xFF, 0xFE, 'o', 0, 'k', 0},
+		Compressed:      true,
+	}
+	service.decodeTraffic(data)
+
+	if data.BodyText != `{"password":"hunter2"}` || string(data.Body) != data.BodyText {
+		t.Errorf("body = %q", data.BodyText)
+	}
+	if data.ResponseText != "ok" {
+		t.Errorf("response = %q", data.ResponseText)
+	}
+	if data.Compressed || len(data.DecodeErrors) != 0 {
+		t.Errorf("compressed = %v, errors = %v", data.Compressed, data.DecodeErrors)
+	}
+	if strings.Join(data.Decoded, ",") != "body:gzip,response_body:charset:utf-16le" {
+		t.Errorf("decoded = %v", data.Decoded)
+	}
+
+	// Without headers the coding is sniffed, and failures keep the captured body
+	sniffed := &models.TrafficData{Body: gzipBytes(t, []byte("plain")), Compressed: true}
+	service.decodeTraffic(sniffed)
+	if sniffed.BodyText != "plain" {
+		t.Errorf("sniffed body = %q", sniffed.BodyText)
+	}
+
+	broken := &models.TrafficData{Headers: map[string]string{"content-encoding": "br"}, Body: []byte{1, 2, 3}}
+	service.decodeTraffic(broken)
+	if !broken.Compressed || len(broken.DecodeErrors) != 1 || !bytes.Equal(broken.Body, []byte{1, 2, 3}) {
+		t.Errorf("broken = %+v", broken)
+	}
+}
@@ -0,0 +1,503 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/shared/graphql"
+)
+
+const (
+	// maxMultipartParts bounds the parts read from one multipart body
+	maxMultipartParts = 1000
+	// maxParsedFields bounds the fields extracted from one body
+	maxParsedFields = 10000
+	// maxFieldValueLength bounds the text kept for a single field value
+	maxFieldValueLength = 4096
+)
+
+// mediaType returns the lower-cased media type of a Content-Type value, or "" when
+// it cannot be parsed
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	parsed, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	}
+	return parsed
+}
+
+// formatForMediaType maps the media types with dedicated body parsers to their format
+func formatForMediaType(mediaType string) string {
+	switch mediaType {
+	case "multipart/form-data":
+		return "multipart"
+	case "application/x-www-form-urlencoded":
+		return "form"
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines", "application/jsonlines":
+		return "ndjson"
+	case "application/graphql":
+		return "graphql"
+	}
+	return ""
+}
+
+// structuredBodyFormat returns the parser format for a captured body, or "" when
+// the body is not a structured format worth splitting into fields. JSON posted to
+// a GraphQL endpoint is parsed as GraphQL.
+func structuredBodyFormat(contentType string, path string, body []byte) string {
+	media := mediaType(contentType)
+	if format := formatForMediaType(media); format != "" {
+		return format
+	}
+	switch {
+	case strings.Contains(media, "json"):
+		if isGraphQLPath(path) && looksLikeGraphQLRequest(body) {
+			return "graphql"
+		}
+		return "json"
+	case strings.Contains(media, "xml"):
+		return "xml"
+	case strings.Contains(media, "yaml"):
+		return "yaml"
+	}
+	return ""
+}
+
+func isGraphQLPath(path string) bool {
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	return strings.HasSuffix(strings.TrimSuffix(strings.ToLower(path), "/"), "graphql")
+}
+
+func looksLikeGraphQLRequest(body []byte) bool {
+	trimmed := bytes.TrimSpace(body)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && bytes.Contains(trimmed, []byte(`"query"`))
+}
+
+// parseFormURLEncoded parses an application/x-www-form-urlencoded body. Repeated
+// names become arrays in the order they appear.
+func parseFormURLEncoded(data []byte) (map[string]interface{}, []models.ParsedField, error) {
+	values, err := url.ParseQuery(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse form body: %w", err)
+	}
+
+	parsed := make(map[string]interface{}, len(values))
+	for name, list := range values {
+		if len(list) == 1 {
+			parsed[name] = list[0]
+			continue
+		}
+		items := make([]interface{}, len(list))
+		for i, value := range list {
+			items[i] = value
+		}
+		parsed[name] = items
+	}
+	return parsed, flattenFields(parsed, "$", "value"), nil
+}
+
+// parseMultipartForm parses a multipart/form-data body. File parts are reported
+// by name, size and SHA-256 rather than by content.
+func parseMultipartForm(data []byte, contentType string) (map[string]interface{}, []models.ParsedField, error) {
+	boundary := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		boundary = params["boundary"]
+	}
+	if boundary == "" {
+		boundary = sniffMultipartBoundary(data)
+	}
+	if boundary == "" {
+		return nil, nil, fmt.Errorf("failed to parse multipart body: no boundary")
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(data), boundary)
+	parts := []interface{}{}
+	var fields []models.ParsedField
+	counts := make(map[string]int)
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse multipart body: %w", err)
+		}
+		if len(parts) >= maxMultipartParts {
+			part.Close()
+			return nil, nil, fmt.Errorf("multipart body exceeds %d parts", maxMultipartParts)
+		}
+
+		content, err := io.ReadAll(part)
+		part.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read multipart part %d: %w", len(parts), err)
+		}
+
+		name := part.FormName()
+		filename := part.FileName()
+		partType := part.Header.Get("Content-Type")
+		path := "$." + name
+		if counts[name] > 0 {
+			path = fmt.Sprintf("$.%s[%d]", name, counts[name])
+		}
+		counts[name]++
+
+		metadata := map[string]interface{}{
+			"name": name,
+			"size": len(content),
+		}
+		if len(part.Header) > 0 {
+			metadata["headers"] = flattenMIMEHeader(part.Header)
+		}
+		if partType != "" {
+			metadata["content_type"] = partType
+		}
+		if encoding := part.Header.Get("Content-Transfer-Encoding"); encoding != "" {
+			metadata["transfer_encoding"] = strings.ToLower(encoding)
+		}
+
+		if isMultipartFile(filename, partType, content) {
+			sum := sha256.Sum256(content)
+			hash := hex.EncodeToString(sum[:])
+			if partType == "" {
+				partType = http.DetectContentType(content)
+			}
+			metadata["filename"] = filename
+			metadata["content_type"] = partType
+			metadata["sha256"] = hash
+			fields = append(fields, models.ParsedField{
+				Path:        path,
+				Kind:        "file",
+				Type:        "file",
+				Filename:    filename,
+				ContentType: partType,
+				Size:        len(content),
+				SHA256:      hash,
+			})
+		} else {
+			metadata["value"] = string(content)
+			field := newParsedField(path, "value", string(content))
+			field.ContentType = partType
+			fields = append(fields, field)
+		}
+		parts = append(parts, metadata)
+	}
+
+	return map[string]interface{}{
+		"boundary": boundary,
+		"parts":    parts,
+	}, fields, nil
+}
+
+// isMultipartFile treats uploads, non-textual parts and binary values as files
+func isMultipartFile(filename, partType string, content []byte) bool {
+	if filename != "" {
+		return true
+	}
+	if partType != "" && !isTextualContentType(partType) {
+		return true
+	}
+	return !utf8.Valid(content)
+}
+
+// sniffMultipartBoundary recovers the boundary from the first delimiter line when
+// the Content-Type header was not captured
+func sniffMultipartBoundary(data []byte) string {
+	line, _, _ := bufio.NewReader(bytes.NewReader(data)).ReadLine()
+	line = bytes.TrimSpace(line)
+	if len(line) < 3 || !bytes.HasPrefix(line, []byte("--")) {
+		return ""
+	}
+	return string(line[2:])
+}
+
+func flattenMIMEHeader(header map[string][]string) map[string]interface{} {
+	flattened := make(map[string]interface{}, len(header))
+	for name, values := range header {
+		flattened[name] = strings.Join(values, ", ")
+	}
+	return flattened
+}
+
+// parseNDJSON parses newline-delimited JSON into an array of records. Blank lines
+// are skipped; errors report the line number.
+func parseNDJSON(data []byte) ([]interface{}, []models.ParsedField, error) {
+	records := []interface{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var record interface{}
+		if err := json.Unmarshal(text, &record); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse NDJSON line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read NDJSON: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("NDJSON body has no records")
+	}
+	return records, flattenFields(records, "$", "value"), nil
+}
+
+// parseGraphQLRequest parses a GraphQL-over-HTTP body: a JSON request object, a
+// batch of them, or (for application/graphql) the bare query document
+func parseGraphQLRequest(data []byte, contentType string) (interface{}, []models.ParsedField, error) {
+	trimmed := bytes.TrimSpace(data)
+	if mediaType(contentType) == "application/graphql" || (len(trimmed) > 0 && trimmed[0] != '{' && trimmed[0] != '[') {
+		return parseGraphQLOperation(string(data), "", nil, "$")
+	}
+
+	var body interface{}
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse GraphQL request: %w", err)
+	}
+
+	switch v := body.(type) {
+	case map[string]interface{}:
+		return parseGraphQLRequestObject(v, "$")
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, nil, fmt.Errorf("GraphQL batch is empty")
+		}
+		requests := make([]interface{}, 0, len(v))
+		var fields []models.ParsedField
+		for i, item := range v {
+			object, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, nil, fmt.Errorf("GraphQL batch item %d is not an object", i)
+			}
+			request, requestFields, err := parseGraphQLRequestObject(object, fmt.Sprintf("$[%d]", i))
+			if err != nil {
+				return nil, nil, fmt.Errorf("GraphQL batch item %d: %w", i, err)
+			}
+			requests = append(requests, request)
+			fields = append(fields, requestFields...)
+		}
+		return requests, fields, nil
+	}
+	return nil, nil, fmt.Errorf("GraphQL request must be an object or an array")
+}
+
+func parseGraphQLRequestObject(request map[string]interface{}, prefix string) (map[string]interface{}, []models.ParsedField, error) {
+	query, ok := request["query"].(string)
+	if !ok || strings.TrimSpace(query) == "" {
+		return nil, nil, fmt.Errorf("GraphQL request has no query")
+	}
+	operationName, _ := request["operationName"].(string)
+
+	var variables map[string]interface{}
+	switch v := request["variables"].(type) {
+	case map[string]interface{}:
+		variables = v
+	case string:
+		// Some clients send variables as an encoded JSON string
+		if strings.TrimSpace(v) != "" {
+			decoder := json.NewDecoder(strings.NewReader(v))
+			decoder.UseNumber()
+			if err := decoder.Decode(&variables); err != nil {
+				return nil, nil, fmt.Errorf("GraphQL variables are not a JSON object: %w", err)
+			}
+		}
+	case nil:
+	default:
+		return nil, nil, fmt.Errorf("GraphQL variables must be an object")
+	}
+
+	parsed, fields, err := parseGraphQLOperation(query, operationName, variables, prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	if extensions, ok := request["extensions"].(map[string]interface{}); ok {
+		parsed["extensions"] = extensions
+	}
+	return parsed, fields, nil
+}
+
+// parseGraphQLOperation parses a query document and selects the operation that
+// would execute. Fields cover the operation name, variables and inline arguments.
+func parseGraphQLOperation(query, operationName string, variables map[string]interface{}, prefix string) (map[string]interface{}, []models.ParsedField, error) {
+	document, err := graphql.ParseDocument(query, graphql.Options{})
+	if err != nil {
+		return nil, nil, err
+	}
+	operation, err := graphql.SelectOperation(document, operationName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if name, ok := operation["name"].(string); ok && operationName == "" {
+		operationName = name
+	}
+
+	parsed := map[string]interface{}{
+		"query":          query,
+		"operation_type": operation["operation"],
+		"document":       document,
+	}
+	var fields []models.ParsedField
+	if operationName != "" {
+		parsed["operation_name"] = operationName
+		fields = append(fields, newParsedField(prefix+".operationName", "operation", operationName))
+	}
+	if variables != nil {
+		parsed["variables"] = variables
+		fields = append(fields, flattenFields(variables, prefix+".variables", "variable")...)
+	}
+
+	selections, _ := operation["selections"].([]interface{})
+	fields = append(fields, graphqlArgumentFields(selections, prefix+".arguments")...)
+	return parsed, fields, nil
+}
+
+// graphqlArgumentFields reports literal field arguments keyed by their field path,
+// e.g. $.arguments.user.id for user(id: 1). Variable references are skipped as
+// the variables themselves are reported.
+func graphqlArgumentFields(selections []interface{}, prefix string) []models.ParsedField {
+	var fields []models.ParsedField
+	for _, candidate := range selections {
+		selection, ok := candidate.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := prefix
+		if selection["kind"] == "field" {
+			name, _ := selection["name"].(string)
+			if alias, ok := selection["alias"].(string); ok {
+				name = alias
+			}
+			path = prefix + "." + name
+			if arguments, ok := selection["arguments"].(map[string]interface{}); ok {
+				for _, argument := range sortedKeys(arguments) {
+					fields = append(fields, flattenGraphQLValue(arguments[argument], path+"."+argument)...)
+				}
+			}
+		}
+		if nested, ok := selection["selections"].([]interface{}); ok {
+			fields = append(fields, graphqlArgumentFields(nested, path)...)
+		}
+	}
+	return fields
+}
+
+func flattenGraphQLValue(value interface{}, path string) []models.ParsedField {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if _, ok := v["variable"]; ok && len(v) == 1 {
+			return nil
+		}
+		var fields []models.ParsedField
+		for _, key := range sortedKeys(v) {
+			fields = append(fields, flattenGraphQLValue(v[key], path+"."+key)...)
+		}
+		return fields
+	case []interface{}:
+		var fields []models.ParsedField
+		for i, item := range v {
+			fields = append(fields, flattenGraphQLValue(item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return fields
+	}
+	return []models.ParsedField{newParsedField(path, "argument", value)}
+}
+
+// flattenFields walks a parsed document and returns its leaf values as fields
+// addressed by JSONPath-style paths such as $.user.emails[0]
+func flattenFields(value interface{}, path string, kind string) []models.ParsedField {
+	var fields []models.ParsedField
+	var walk func(value interface{}, path string)
+	walk = func(value interface{}, path string) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for _, key := range sortedKeys(v) {
+				walk(v[key], path+"."+key)
+			}
+		case []interface{}:
+			for i, item := range v {
+				walk(item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		default:
+			fields = append(fields, newParsedField(path, kind, v))
+		}
+	}
+	walk(value, path)
+	return fields
+}
+
+func newParsedField(path, kind string, value interface{}) models.ParsedField {
+	field := models.ParsedField{Path: path, Kind: kind}
+	switch v := value.(type) {
+	case nil:
+		field.Type = "null"
+	case string:
+		field.Type = "string"
+		field.Value = v
+		field.Size = len(v)
+	case bool:
+		field.Type = "boolean"
+		field.Value = strconv.FormatBool(v)
+	case json.Number:
+		field.Type = "number"
+		field.Value = v.String()
+	case float64:
+		field.Type = "number"
+		field.Value = strconv.FormatFloat(v, 'f', -1, 64)
+	case int, int32, int64, uint, uint32, uint64:
+		field.Type = "number"
+		field.Value = fmt.Sprintf("%d", v)
+	default:
+		field.Type = "string"
+		field.Value = fmt.Sprintf("%v", v)
+		field.Size = len(field.Value)
+	}
+	if len(field.Value) > maxFieldValueLength {
+		field.Value = truncateUTF8(field.Value, maxFieldValueLength)
+		field.Truncated = true
+	}
+	return field
+}
+
+// limitFields caps a field list and reports whether fields were dropped
+func limitFields(fields []models.ParsedField) ([]models.ParsedField, bool) {
+	if len(fields) <= maxParsedFields {
+		return fields, false
+	}
+	return fields[:maxParsedFields], true
+}
+
+func truncateUTF8(value string, limit int) string {
+	if len(value) <= limit {
+		return value
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	return value[:cut]
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/shared/graphql"
+	"scopeapi.local/backend/shared/logging"
+)
+
+const testMultipartBody = "--XYZ\r\n" +
+	"Content-Disposition: form-data; name=\"title\"\r\n\r\n" +
+	"Quarterly report\r\n" +
+	"--XYZ\r\n" +
+	"Content-Disposition: form-data; name=\"upload\"; filename=\"report.pdf\"\r\n" +
+	"Content-Type: application/pdf\r\n\r\n" +
+	"%PDF-1.4 binary\r\n" +
+	"--XYZ--\r\n"
+
+func fieldsByPath(fields []models.ParsedField) map[string]models.ParsedField {
+	byPath := make(map[string]models.ParsedField, len(fields))
+	for _, field := range fields {
+		byPath[field.Path] = field
+	}
+	return byPath
+}
+
+func TestParseMultipartHashesFiles(t *testing.T) {
+	service := newTestParserService()
+
+	parsed, err := service.ParseData(context.Background(), []byte(testMultipartBody), "", "multipart/form-data; boundary=XYZ")
+	if err != nil {
+		t.Fatalf("ParseData: %v", err)
+	}
+	if parsed.Format != "multipart" {
+		t.Fatalf("format = %q", parsed.Format)
+	}
+
+	fields := fieldsByPath(parsed.Fields)
+	if title := fields["$.title"]; title.Kind != "value" || title.Value != "Quarterly report" {
+		t.Errorf("title = %+v", title)
+	}
+	sum := sha256.Sum256([]byte("%PDF-1.4 binary"))
+	upload := fields["$.upload"]
+	if upload.Kind != "file" || upload.Filename != "report.pdf" || upload.ContentType != "application/pdf" ||
+		upload.Size != 15 || upload.SHA256 != hex.EncodeToString(sum[:]) || upload.Value != "" {
+		t.Errorf("upload = %+v", upload)
+	}
+	if encoded, _ := json.Marshal(parsed.Parsed); strings.Contains(string(encoded), "binary") {
+		t.Errorf("file content leaked into parsed body: %v", parsed.Parsed)
+	}
+
+	// The boundary is recovered from the body when the header was not captured
+	sniffed, err := service.ParseData(context.Background(), []byte(testMultipartBody), "multipart", "")
+	if err != nil || len(sniffed.Fields) != 2 {
+		t.Fatalf("sniffed = %+v, %v", sniffed, err)
+	}
+}
+
+func TestParseFormAndNDJSON(t *testing.T) {
+	service := newTestParserService()
+	ctx := context.Background()
+
+	form, err := service.ParseData(ctx, []byte("user=ada&role=admin&role=billing"), "", "application/x-www-form-urlencoded")
+	if err != nil {
+		t.Fatalf("form: %v", err)
+	}
+	fields := fieldsByPath(form.Fields)
+	if form.Format != "form" || fields["$.user"].Value != "ada" || fields["$.role[1]"].Value != "billing" {
+		t.Errorf("form = %s %+v", form.Format, form.Fields)
+	}
+
+	ndjson, err := service.ParseData(ctx, []byte("{\"id\":1}\n\n{\"id\":2,\"ok\":true}\n"), "", "application/x-ndjson")
+	if err != nil {
+		t.Fatalf("ndjson: %v", err)
+	}
+	fields = fieldsByPath(ndjson.Fields)
+	if records, _ := ndjson.Parsed.([]interface{}); len(records) != 2 {
+		t.Errorf("records = %v", ndjson.Parsed)
+	}
+	if fields["$[1].id"].Value != "2" || fields["$[1].ok"].Type != "boolean" {
+		t.Errorf("ndjson fields = %+v", ndjson.Fields)
+	}
+
+	if _, err := service.ParseData(ctx, []byte("{\"id\":1}\n{broken\n"), "ndjson", ""); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected a line 2 error, got %v", err)
+	}
+}
+
+func TestParseGraphQLRequest(t *testing.T) {
+	service := newTestParserService()
+	ctx := context.Background()
+
+	body := `{
+		"query": "query A { a } query GetUser($id: ID!) { user(id: $id) { name posts(first: 10, filter: {tag: \"go\"}) { title } } }",
+		"operationName": "GetUser",
+		"variables": {"id": "42"}
+	}`
+	parsed, err := service.ParseData(ctx, []byte(body), "graphql", "application/json")
+	if err != nil {
+		t.Fatalf("ParseData: %v", err)
+	}
+	request := parsed.Parsed.(map[string]interface{})
+	if request["operation_name"] != "GetUser" || request["operation_type"] != "query" {
+		t.Errorf("request = %v", request)
+	}
+
+	fields := fieldsByPath(parsed.Fields)
+	if id := fields["$.variables.id"]; id.Kind != "variable" || id.Value != "42" {
+		t.Errorf("variable = %+v", id)
+	}
+	if first := fields["$.arguments.user.posts.first"]; first.Kind != "argument" || first.Value != "10" || first.Type != "number" {
+		t.Errorf("first = %+v", first)
+	}
+	if tag := fields["$.arguments.user.posts.filter.tag"]; tag.Value != "go" {
+		t.Errorf("tag = %+v", tag)
+	}
+	if _, ok := fields["$.arguments.user.id"]; ok {
+		t.Errorf("variable reference reported as an argument")
+	}
+
+	// Documents with several operations need an operation name
+	if _, err := service.ParseData(ctx, []byte(`{"query":"query A { a } query B { b }"}`), "graphql", ""); err == nil {
+		t.Errorf("expected an error for an ambiguous operation")
+	}
+
+	bare, err := service.ParseData(ctx, []byte("mutation { logout }"), "", "application/graphql")
+	if err != nil || bare.Format != "graphql" {
+		t.Fatalf("bare = %+v, %v", bare, err)
+	}
+	if bare.Parsed.(map[string]interface{})["operation_type"] != "mutation" {
+		t.Errorf("bare = %v", bare.Parsed)
+	}
+
+	if _, err := graphql.ParseDocument("{ a "+strings.Repeat("{ b ", graphql.MaxDepth)+strings.Repeat("}", graphql.MaxDepth+1), graphql.Options{}); err == nil {
+		t.Errorf("expected a depth limit error")
+	}
+}
+
+func TestIngestionPublishesRedactedBodyFields(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Parser.MaxPayloadSize = 1024 * 1024
+	cfg.Ingestion.Redaction = config.RedactionConfig{Enabled: true, Key: "test-key"}
+	logger := logging.NewStructuredLogger("test")
+	service := NewDataIngestionService(nil, nil, NewDataParserService(logger, cfg), logger, cfg).(*DataIngestionService)
+
+	body := "--XYZ\r\n" +
+		"Content-Disposition: form-data; name=\"username\"\r\n\r\nada\r\n" +
+		"--XYZ\r\n" +
+		"Content-Disposition: form-data; name=\"password\"\r\n\r\nhunter2\r\n" +
+		"--XYZ--\r\n"
+	data := &models.TrafficData{
+		Method:          "POST",
+		Path:            "/graphql",
+		ContentType:     "multipart/form-data; boundary=XYZ",
+		Body:            []byte(body),
+		ResponseHeaders: map[string]string{"Content-Type": "application/json"},
+		ResponseBody:    []byte(`{"data":{"ok":true}}`),
+	}
+	service.redactTraffic(data)
+	service.parseBodies(context.Background(), data)
+
+	fields := fieldsByPath(data.BodyFields)
+	if data.BodyFormat != "multipart" || fields["$.username"].Value != "ada" {
+		t.Fatalf("body = %s %+v (errors %v)", data.BodyFormat, data.BodyFields, data.ParseErrors)
+	}
+	if password := fields["$.password"].Value; password == "hunter2" || !strings.HasPrefix(password, redactedPrefix) {
+		t.Errorf("password field = %q", password)
+	}
+	if !strings.Contains(strings.Join(data.Redacted, ","), "body:field:password") {
+		t.Errorf("redacted = %v", data.Redacted)
+	}
+	// The raw multipart body cannot be rewritten, so it must not be published
+	if published, _ := json.Marshal(data); strings.Contains(string(published), "hunter2") || data.Body != nil {
+		t.Errorf("published record still holds the secret: %s", published)
+	}
+
+	// Raw form bodies are redacted in place, including names only listed as paths
+	form := &models.TrafficData{
+		Method:      "POST",
+		Path:        "/login",
+		ContentType: "application/x-www-form-urlencoded",
+		Body:        []byte("username=ada&apiKey=s3cr3t-value&password=hunter2"),
+	}
+	service.redactTraffic(form)
+	service.parseBodies(context.Background(), form)
+	published, _ := json.Marshal(form)
+	if strings.Contains(string(published), "hunter2") || strings.Contains(string(published), "s3cr3t-value") {
+		t.Errorf("published form record still holds a secret: %s", published)
+	}
+	if !strings.Contains(string(form.Body), "username=ada") || fieldsByPath(form.BodyFields)["$.username"].Value != "ada" {
+		t.Errorf("form = %q %+v", form.Body, form.BodyFields)
+	}
+	if data.ResponseFormat != "json" || fieldsByPath(data.ResponseFields)["$.data.ok"].Value != "true" {
+		t.Errorf("response = %s %+v", data.ResponseFormat, data.ResponseFields)
+	}
+
+	// Truncated bodies are not parsed
+	truncated := &models.TrafficData{ContentType: "application/json", Body: []byte(`{"a":`), BodyTruncated: true}
+	service.parseBodies(context.Background(), truncated)
+	if truncated.BodyFields != nil || len(truncated.ParseErrors) != 1 {
+		t.Errorf("truncated = %+v", truncated)
+	}
+}
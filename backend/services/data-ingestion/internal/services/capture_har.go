@@ -0,0 +1,229 @@
+package services
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// harEntry is the subset of a HAR 1.2 entry needed to rebuild an exchange
+type harEntry struct {
+	StartedDateTime string  `json:"startedDateTime"`
+	Time            float64 `json:"time"`
+	ServerIPAddress string  `json:"serverIPAddress"`
+	Request         struct {
+		Method      string         `json:"method"`
+		URL         string         `json:"url"`
+		HTTPVersion string         `json:"httpVersion"`
+		Headers     []harNameValue `json:"headers"`
+		QueryString []harNameValue `json:"queryString"`
+		PostData    *struct {
+			MimeType string         `json:"mimeType"`
+			Text     string         `json:"text"`
+			Params   []harNameValue `json:"params"`
+			Encoding string         `json:"encoding"`
+		} `json:"postData"`
+	} `json:"request"`
+	Response struct {
+		Status      int            `json:"status"`
+		HTTPVersion string         `json:"httpVersion"`
+		Headers     []harNameValue `json:"headers"`
+		Content     struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harReader streams entries out of log.entries without loading the whole document
+type harReader struct {
+	decoder *json.Decoder
+	record  int
+}
+
+func newHARReader(reader *bufio.Reader) (*harReader, error) {
+	// json.Decoder rejects a leading byte order mark
+	if bom, err := reader.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		reader.Discard(3)
+	}
+
+	h := &harReader{decoder: json.NewDecoder(reader)}
+	if err := h.seekEntries(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *harReader) Next() (*capturedExchange, error) {
+	if !h.decoder.More() {
+		return nil, io.EOF
+	}
+
+	h.record++
+	var entry harEntry
+	if err := h.decoder.Decode(&entry); err != nil {
+		// A syntax error leaves the decoder in an undefined state, so stop here
+		return nil, fmt.Errorf("failed to decode HAR entry %d: %w", h.record, err)
+	}
+
+	exchange, err := entry.toExchange()
+	if err != nil {
+		return nil, &captureRecordError{record: h.record, err: err}
+	}
+	return exchange, nil
+}
+
+// seekEntries positions the decoder at the first element of log.entries
+func (h *harReader) seekEntries() error {
+	if err := expectJSONDelim(h.decoder, '{'); err != nil {
+		return fmt.Errorf("invalid HAR document: %w", err)
+	}
+
+	for h.decoder.More() {
+		key, err := readJSONKey(h.decoder)
+		if err != nil {
+			return err
+		}
+		if key != "log" {
+			if err := skipJSONValue(h.decoder); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := expectJSONDelim(h.decoder, '{'); err != nil {
+			return fmt.Errorf("invalid HAR log: %w", err)
+		}
+		for h.decoder.More() {
+			key, err := readJSONKey(h.decoder)
+			if err != nil {
+				return err
+			}
+			if key == "entries" {
+				if err := expectJSONDelim(h.decoder, '['); err != nil {
+					return fmt.Errorf("invalid HAR entries: %w", err)
+				}
+				return nil
+			}
+			if err := skipJSONValue(h.decoder); err != nil {
+				return err
+			}
+		}
+		return fmt.Errorf("HAR log has no entries")
+	}
+
+	return fmt.Errorf("HAR document has no log")
+}
+
+func (e *harEntry) toExchange() (*capturedExchange, error) {
+	if e.Request.Method == "" || e.Request.URL == "" {
+		return nil, fmt.Errorf("entry is missing request method or URL")
+	}
+
+	exchange := &capturedExchange{
+		Duration:        time.Duration(e.Time * float64(time.Millisecond)),
+		DestinationIP:   strings.Trim(e.ServerIPAddress, "[]"),
+		Protocol:        e.Request.HTTPVersion,
+		Method:          e.Request.Method,
+		URL:             e.Request.URL,
+		RequestHeaders:  harHeaders(e.Request.Headers),
+		StatusCode:      e.Response.Status,
+		ResponseHeaders: harHeaders(e.Response.Headers),
+	}
+
+	if e.StartedDateTime != "" {
+		startedAt, err := time.Parse(time.RFC3339Nano, e.StartedDateTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid startedDateTime %q: %w", e.StartedDateTime, err)
+		}
+		exchange.StartedAt = startedAt
+	}
+
+	if postData := e.Request.PostData; postData != nil {
+		switch {
+		case postData.Text != "":
+			body, err := harContent(postData.Text, postData.Encoding)
+			if err != nil {
+				return nil, fmt.Errorf("invalid request body: %w", err)
+			}
+			exchange.RequestBody = body
+		case len(postData.Params) > 0:
+			form := url.Values{}
+			for _, param := range postData.Params {
+				form.Add(param.Name, param.Value)
+			}
+			exchange.RequestBody = []byte(form.Encode())
+		}
+		if postData.MimeType != "" && headerValue(exchange.RequestHeaders, "Content-Type") == "" {
+			exchange.RequestHeaders["Content-Type"] = postData.MimeType
+		}
+	}
+
+	if e.Response.Content.Text != "" {
+		body, err := harContent(e.Response.Content.Text, e.Response.Content.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response body: %w", err)
+		}
+		exchange.ResponseBody = body
+	}
+
+	return exchange, nil
+}
+
+func harHeaders(pairs []harNameValue) map[string]string {
+	headers := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		// HTTP/2 pseudo-headers are already reflected in method and URL
+		if strings.HasPrefix(pair.Name, ":") {
+			continue
+		}
+		addHeader(headers, pair.Name, pair.Value)
+	}
+	return headers
+}
+
+func harContent(text string, encoding string) ([]byte, error) {
+	if strings.EqualFold(encoding, "base64") {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return []byte(text), nil
+}
+
+func expectJSONDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := token.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expected %q, got %v", delim, token)
+	}
+	return nil
+}
+
+func readJSONKey(decoder *json.Decoder) (string, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := token.(string)
+	if !ok {
+		return "", fmt.Errorf("expected object key, got %v", token)
+	}
+	return key, nil
+}
+
+func skipJSONValue(decoder *json.Decoder) error {
+	var skipped json.RawMessage
+	return decoder.Decode(&skipped)
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+const (
+	defaultImportBatchSize = 1000
+	maxCapturedBodySize    = 10 * 1024 * 1024
+)
+
+type CaptureImportServiceInterface interface {
+	ImportCapture(ctx context.Context, request *models.CaptureImportRequest, reader io.Reader) (*models.CaptureImportResult, error)
+}
+
+type CaptureImportService struct {
+	ingestionService DataIngestionServiceInterface
+	logger           logging.Logger
+	config           *config.Config
+}
+
+// captureRecordReader streams HTTP exchanges out of a capture file. Next
+// returns io.EOF once the capture is exhausted and a *captureRecordError for
+// individual records that could not be decoded.
+type captureRecordReader interface {
+	Next() (*capturedExchange, error)
+}
+
+// captureRecordError is a non-fatal error affecting a single record
+type captureRecordError struct {
+	record int
+	err    error
+}
+
+func (e *captureRecordError) Error() string {
+	return fmt.Sprintf("record %d: %s", e.record, e.err)
+}
+
+// capturedExchange is the format-independent form of one request/response pair
+type capturedExchange struct {
+	StartedAt       time.Time
+	Duration        time.Duration
+	SourceIP        string
+	DestinationIP   string
+	Protocol        string
+	Method          string
+	URL             string
+	RequestHeaders  map[string]string
+	RequestBody     []byte
+	StatusCode      int
+	ResponseHeaders map[string]string
+	ResponseBody    []byte
+}
+
+func NewCaptureImportService(ingestionService DataIngestionServiceInterface, logger logging.Logger, cfg *config.Config) CaptureImportServiceInterface {
+	return &CaptureImportService{
+		ingestionService: ingestionService,
+		logger:           logger,
+		config:           cfg,
+	}
+}
+
+func (s *CaptureImportService) ImportCapture(ctx context.Context, request *models.CaptureImportRequest, reader io.Reader) (*models.CaptureImportResult, error) {
+	result := &models.CaptureImportResult{
+		ID:        uuid.New().String(),
+		Name:      request.Name,
+		Status:    "processing",
+		StartTime: time.Now(),
+	}
+
+	buffered := bufio.NewReaderSize(reader, 64*1024)
+	format, err := detectCaptureFormat(request.Format, request.Name, buffered)
+	if err != nil {
+		return nil, err
+	}
+	result.Format = format
+
+	records, err := newCaptureRecordReader(format, buffered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s capture: %w", format, err)
+	}
+
+	s.logger.Info("Starting capture import", "import_id", result.ID, "format", format, "name", request.Name)
+
+	batchSize := s.config.Ingestion.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultImportBatchSize
+	}
+
+	batch := s.newImportBatch()
+	for {
+		if ctx.Err() != nil {
+			result.AddError(ctx.Err().Error())
+			break
+		}
+
+		exchange, err := records.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var recordErr *captureRecordError
+			if errors.As(err, &recordErr) {
+				result.TotalRecords++
+				result.SkippedRecords++
+				result.AddError(err.Error())
+				continue
+			}
+			result.AddError(err.Error())
+			break
+		}
+
+		result.TotalRecords++
+		batch.AddData(*exchange.toTrafficData(format, request))
+
+		if batch.Count >= batchSize {
+			s.flushImportBatch(ctx, batch, result)
+			batch = s.newImportBatch()
+		}
+	}
+
+	if batch.Count > 0 {
+		s.flushImportBatch(ctx, batch, result)
+	}
+
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime)
+	switch {
+	case result.ImportedRecords == 0 && len(result.Errors) > 0:
+		result.Status = "failed"
+	case len(result.Errors) > 0 || result.FailedRecords > 0:
+		result.Status = "partial_success"
+	default:
+		result.Status = "completed"
+	}
+
+	s.logger.Info("Capture import completed", "import_id", result.ID, "format", format, "total", result.TotalRecords, "imported", result.ImportedRecords, "failed", result.FailedRecords, "skipped", result.SkippedRecords)
+	return result, nil
+}
+
+// Helper methods
+
+func (s *CaptureImportService) newImportBatch() *models.BatchTrafficData {
+	return &models.BatchTrafficData{
+		ID:        uuid.New().String(),
+		Timestamp: time.Now(),
+		Status:    "pending",
+	}
+}
+
+func (s *CaptureImportService) flushImportBatch(ctx context.Context, batch *models.BatchTrafficData, result *models.CaptureImportResult) {
+	result.Batches++
+
+	response, err := s.ingestionService.IngestBatch(ctx, batch)
+	if err != nil {
+		s.logger.Error("Failed to ingest imported batch", "error", err, "batch_id", batch.ID)
+		result.FailedRecords += batch.Count
+		result.AddError(fmt.Sprintf("batch %s: %s", batch.ID, err.Error()))
+		return
+	}
+
+	result.IngestionIDs = append(result.IngestionIDs, response.ID)
+	result.ImportedRecords += len(response.TrafficIDs)
+	result.SkippedRecords += response.Filtered
+	result.FailedRecords += batch.Count - len(response.TrafficIDs) - response.Filtered
+	for _, e := range response.Errors {
+		result.AddError(fmt.Sprintf("batch %s: %s", batch.ID, e))
+	}
+}
+
+func newCaptureRecordReader(format string, reader *bufio.Reader) (captureRecordReader, error) {
+	switch format {
+	case "har":
+		return newHARReader(reader)
+	case "pcap", "pcapng":
+		return newPcapExchangeReader(reader)
+	case "mitmproxy":
+		return newMitmproxyReader(reader), nil
+	default:
+		return nil, fmt.Errorf("unsupported capture format: %s", format)
+	}
+}
+
+// detectCaptureFormat resolves the capture format from the explicit format,
+// the file extension and finally the leading magic bytes.
+func detectCaptureFormat(format string, name string, reader *bufio.Reader) (string, error) {
+	switch strings.ToLower(format) {
+	case "har", "pcap", "pcapng", "mitmproxy":
+		return strings.ToLower(format), nil
+	case "mitm", "flow", "flows":
+		return "mitmproxy", nil
+	case "":
+	default:
+		return "", fmt.Errorf("unsupported capture format: %s", format)
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".har":
+		return "har", nil
+	case ".pcap", ".cap":
+		return "pcap", nil
+	case ".pcapng":
+		return "pcapng", nil
+	case ".mitm", ".flow", ".flows":
+		return "mitmproxy", nil
+	}
+
+	magic, err := reader.Peek(4)
+	if err != nil {
+		return "", fmt.Errorf("failed to detect capture format: %w", err)
+	}
+	switch {
+	case bytes.Equal(magic, []byte{0x0a, 0x0d, 0x0d, 0x0a}):
+		return "pcapng", nil
+	case isPcapMagic(magic):
+		return "pcap", nil
+	case magic[0] >= '0' && magic[0] <= '9':
+		return "mitmproxy", nil
+	}
+
+	trimmed := bytes.TrimLeft(magic, " \t\r\n\ufeff")
+	if len(trimmed) == 0 || trimmed[0] == '{' {
+		return "har", nil
+	}
+	return "", fmt.Errorf("unable to detect capture format")
+}
+
+func (e *capturedExchange) toTrafficData(format string, request *models.CaptureImportRequest) *models.TrafficData {
+	trafficData := &models.TrafficData{
+		ID:              uuid.New().String(),
+		Timestamp:       e.StartedAt,
+		SourceIP:        e.SourceIP,
+		DestinationIP:   e.DestinationIP,
+		Protocol:        e.Protocol,
+		Method:          strings.ToUpper(e.Method),
+		URL:             e.URL,
+		Headers:         e.RequestHeaders,
+		Body:            e.RequestBody,
+		StatusCode:      e.StatusCode,
+		ResponseBody:    e.ResponseBody,
+		ResponseHeaders: e.ResponseHeaders,
+		Duration:        e.Duration,
+		Size:            int64(len(e.RequestBody) + len(e.ResponseBody)),
+		UserAgent:       headerValue(e.RequestHeaders, "User-Agent"),
+		ContentType:     headerValue(e.RequestHeaders, "Content-Type"),
+		Tags:            append([]string{"imported", format}, request.Tags...),
+		Metadata: map[string]interface{}{
+			"import_source": format,
+		},
+	}
+
+	if request.Name != "" {
+		trafficData.Metadata["import_name"] = request.Name
+	}
+	if trafficData.ContentType == "" {
+		trafficData.ContentType = headerValue(e.ResponseHeaders, "Content-Type")
+	}
+
+	trafficData.Encoding = headerValue(e.RequestHeaders, "Content-Encoding")
+	if trafficData.Encoding == "" {
+		trafficData.Encoding = headerValue(e.ResponseHeaders, "Content-Encoding")
+	}
+	trafficData.Compressed = trafficData.Encoding != "" && !strings.EqualFold(trafficData.Encoding, "identity")
+
+	if utf8.Valid(e.RequestBody) {
+		trafficData.BodyText = string(e.RequestBody)
+	}
+	if utf8.Valid(e.ResponseBody) {
+		trafficData.ResponseText = string(e.ResponseBody)
+	}
+
+	if parsed, err := url.Parse(e.URL); err == nil {
+		trafficData.Path = parsed.Path
+		query := parsed.Query()
+		if len(query) > 0 {
+			trafficData.QueryParams = make(map[string]string, len(query))
+			for key, values := range query {
+				if len(values) > 0 {
+					trafficData.QueryParams[key] = values[0]
+				}
+			}
+		}
+	}
+
+	return trafficData
+}
+
+// headerValue looks a header up case-insensitively
+func headerValue(headers map[string]string, name string) string {
+	if value, exists := headers[name]; exists {
+		return value
+	}
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// addHeader merges repeated header values the way net/http renders them
+func addHeader(headers map[string]string, name, value string) {
+	if existing, exists := headers[name]; exists {
+		headers[name] = existing + ", " + value
+		return
+	}
+	headers[name] = value
+}
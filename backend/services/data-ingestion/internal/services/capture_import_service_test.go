@@ -0,0 +1,346 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+// recordingIngestionService captures the batches handed to IngestBatch
+type recordingIngestionService struct {
+	records []models.TrafficData
+}
+
+func (r *recordingIngestionService) IngestTraffic(ctx context.Context, request *models.IngestionRequest) (*models.IngestionResponse, error) {
+	return &models.IngestionResponse{}, nil
+}
+
+func (r *recordingIngestionService) IngestBatch(ctx context.Context, batch *models.BatchTrafficData) (*models.IngestionResponse, error) {
+	response := &models.IngestionResponse{ID: batch.ID, Status: "success"}
+	for _, data := range batch.Data {
+		r.records = append(r.records, data)
+		response.TrafficIDs = append(response.TrafficIDs, data.ID)
+	}
+	return response, nil
+}
+
+func (r *recordingIngestionService) GetIngestionStatus(ctx context.Context, id string) (*models.IngestionStatus, error) {
+	return nil, nil
+}
+
+func (r *recordingIngestionService) GetIngestionStats(ctx context.Context, timeRange *models.TimeRange) (*models.IngestionStats, error) {
+	return nil, nil
+}
+
+func (r *recordingIngestionService) UpdateConfiguration(ctx context.Context, configType string, config interface{}) error {
+	return nil
+}
+
+func (r *recordingIngestionService) Close(ctx context.Context) error {
+	return nil
+}
+
+func newTestImportService(batchSize int) (*CaptureImportService, *recordingIngestionService) {
+	cfg := &config.Config{}
+	cfg.Ingestion.BatchSize = batchSize
+	recorder := &recordingIngestionService{}
+	service := NewCaptureImportService(recorder, logging.NewStructuredLogger("test"), cfg).(*CaptureImportService)
+	return service, recorder
+}
+
+const testHAR = `{
+  "log": {
+    "version": "1.2",
+    "creator": {"name": "test", "version": "1"},
+    "pages": [],
+    "entries": [
+      {
+        "startedDateTime": "2024-03-01T10:00:00.000Z",
+        "time": 125.5,
+        "serverIPAddress": "10.0.0.5",
+        "request": {
+          "method": "POST",
+          "url": "https://api.example.com/v1/orders?expand=items",
+          "httpVersion": "HTTP/1.1",
+          "headers": [{"name": "Content-Type", "value": "application/json"}, {"name": ":authority", "value": "api.example.com"}],
+          "queryString": [{"name": "expand", "value": "items"}],
+          "postData": {"mimeType": "application/json", "text": "{\"sku\":\"A-1\"}"}
+        },
+        "response": {
+          "status": 201,
+          "httpVersion": "HTTP/1.1",
+          "headers": [{"name": "Content-Type", "value": "application/json"}],
+          "content": {"size": 10, "mimeType": "application/json", "text": "eyJpZCI6N30=", "encoding": "base64"}
+        }
+      },
+      {
+        "startedDateTime": "2024-03-01T10:00:01.000Z",
+        "time": 3,
+        "request": {"method": "GET", "url": "https://api.example.com/v1/orders/7", "httpVersion": "HTTP/1.1", "headers": []},
+        "response": {"status": 200, "httpVersion": "HTTP/1.1", "headers": [], "content": {"size": 0, "mimeType": ""}}
+      }
+    ]
+  }
+}`
+
+func TestImportCapture_HAR(t *testing.T) {
+	service, recorder := newTestImportService(1)
+
+	result, err := service.ImportCapture(context.Background(), &models.CaptureImportRequest{Name: "session.har"}, strings.NewReader(testHAR))
+	if err != nil {
+		t.Fatalf("ImportCapture: %v", err)
+	}
+	if result.Format != "har" || result.Status != "completed" || result.ImportedRecords != 2 || result.Batches != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	first := recorder.records[0]
+	if first.Method != "POST" || first.Path != "/v1/orders" || first.QueryParams["expand"] != "items" {
+		t.Fatalf("unexpected request fields: %+v", first)
+	}
+	if first.BodyText != `{"sku":"A-1"}` || first.ResponseText != `{"id":7}` || first.StatusCode != 201 {
+		t.Fatalf("unexpected bodies: %q %q %d", first.BodyText, first.ResponseText, first.StatusCode)
+	}
+	if first.Duration != 125500*time.Microsecond || first.DestinationIP != "10.0.0.5" {
+		t.Fatalf("unexpected timing/addressing: %v %s", first.Duration, first.DestinationIP)
+	}
+	if _, exists := first.Headers[":authority"]; exists {
+		t.Fatal("pseudo-headers should be dropped")
+	}
+}
+
+// testTCPFrame builds an Ethernet frame carrying one IPv4 TCP segment
+func testTCPFrame(src, dst [4]byte, srcPort, dstPort uint16, seq uint32, flags byte, payload string) []byte {
+	tcp := make([]byte, 20)
+	binary.BigEndian.PutUint16(tcp[0:], srcPort)
+	binary.BigEndian.PutUint16(tcp[2:], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	tcp = append(tcp, payload...)
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+	ip[8] = 64
+	ip[9] = 6
+	copy(ip[12:16], src[:])
+	copy(ip[16:20], dst[:])
+	ip = append(ip, tcp...)
+
+	frame := make([]byte, 14)
+	binary.BigEndian.PutUint16(frame[12:], 0x0800)
+	return append(frame, ip...)
+}
+
+// buildTestPcap writes a little-endian pcap containing one HTTP exchange over IPv4/Ethernet
+func buildTestPcap() []byte {
+	var out bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], linkTypeEthernet)
+	out.Write(header)
+
+	client := [4]byte{192, 168, 1, 10}
+	server := [4]byte{10, 0, 0, 5}
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	writePacket := func(offset time.Duration, src, dst [4]byte, srcPort, dstPort uint16, seq uint32, flags byte, payload string) {
+		frame := testTCPFrame(src, dst, srcPort, dstPort, seq, flags, payload)
+
+		timestamp := base.Add(offset)
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record[0:], uint32(timestamp.Unix()))
+		binary.LittleEndian.PutUint32(record[4:], uint32(timestamp.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(frame)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(frame)))
+		out.Write(record)
+		out.Write(frame)
+	}
+
+	request1 := "POST /login HTTP/1.1\r\nHost: api.example.com\r\nContent-Length: 9\r\n\r\n"
+	request2 := "user=ada\n"
+	response := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 2\r\n\r\nok"
+
+	writePacket(0, client, server, 50000, 80, 1000, tcpFlagSYN, "")
+	writePacket(time.Millisecond, server, client, 80, 50000, 5000, tcpFlagSYN|tcpFlagACK, "")
+	// Segments out of order plus a retransmission
+	writePacket(3*time.Millisecond, client, server, 50000, 80, 1001+uint32(len(request1)), tcpFlagACK, request2)
+	writePacket(2*time.Millisecond, client, server, 50000, 80, 1001, tcpFlagACK, request1)
+	writePacket(4*time.Millisecond, client, server, 50000, 80, 1001, tcpFlagACK, request1)
+	writePacket(20*time.Millisecond, server, client, 80, 50000, 5001, tcpFlagACK, response)
+	writePacket(21*time.Millisecond, client, server, 50000, 80, 1001+uint32(len(request1)+len(request2)), tcpFlagFIN|tcpFlagACK, "")
+	writePacket(22*time.Millisecond, server, client, 80, 50000, 5001+uint32(len(response)), tcpFlagFIN|tcpFlagACK, "")
+
+	return out.Bytes()
+}
+
+func TestImportCapture_Pcap(t *testing.T) {
+	service, recorder := newTestImportService(100)
+
+	result, err := service.ImportCapture(context.Background(), &models.CaptureImportRequest{}, bytes.NewReader(buildTestPcap()))
+	if err != nil {
+		t.Fatalf("ImportCapture: %v", err)
+	}
+	if result.Format != "pcap" || result.ImportedRecords != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	record := recorder.records[0]
+	if record.Method != "POST" || record.URL != "http://api.example.com/login" || record.BodyText != "user=ada\n" {
+		t.Fatalf("unexpected request: %s %s %q", record.Method, record.URL, record.BodyText)
+	}
+	if record.StatusCode != 200 || record.ResponseText != "ok" {
+		t.Fatalf("unexpected response: %d %q", record.StatusCode, record.ResponseText)
+	}
+	if record.SourceIP != "192.168.1.10" || record.DestinationIP != "10.0.0.5" {
+		t.Fatalf("unexpected addressing: %s -> %s", record.SourceIP, record.DestinationIP)
+	}
+	if record.Duration != 18*time.Millisecond {
+		t.Fatalf("unexpected duration: %v", record.Duration)
+	}
+}
+
+// packetList is a packet source over prepared packets
+type packetList struct {
+	packets []*capturedPacket
+	// before is called ahead of handing out each packet
+	before func()
+}
+
+func (l *packetList) nextPacket() (*capturedPacket, error) {
+	l.before()
+	if len(l.packets) == 0 {
+		return nil, io.EOF
+	}
+	packet := l.packets[0]
+	l.packets = l.packets[1:]
+	return packet, nil
+}
+
+func TestPcapReaderBufferBudget(t *testing.T) {
+	server := [4]byte{10, 0, 0, 5}
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	request := "POST /upload HTTP/1.1\r\nHost: api.example.com\r\nContent-Length: 400\r\n\r\n" + strings.Repeat("x", 400)
+	response := "HTTP/1.1 201 Created\r\nContent-Length: 0\r\n\r\n"
+
+	// Three connections that never close, each buffering about 500 bytes
+	source := &packetList{}
+	for i := 0; i < 3; i++ {
+		client := [4]byte{192, 168, 1, byte(10 + i)}
+		at := base.Add(time.Duration(i) * time.Second)
+		for _, frame := range [][]byte{
+			testTCPFrame(client, server, 50000, 80, 1000, tcpFlagSYN, ""),
+			testTCPFrame(client, server, 50000, 80, 1001, tcpFlagACK, request),
+			testTCPFrame(server, client, 80, 50000, 5001, tcpFlagACK, response),
+		} {
+			source.packets = append(source.packets, &capturedPacket{timestamp: at, linkType: linkTypeEthernet, data: frame})
+		}
+	}
+
+	reader := &pcapExchangeReader{source: source, flows: make(map[string]*tcpFlow), bufferLimit: 1000}
+	maxBuffered := 0
+	source.before = func() {
+		if reader.buffered > maxBuffered {
+			maxBuffered = reader.buffered
+		}
+	}
+
+	var exchanges []*capturedExchange
+	flushedEarly := false
+	for {
+		exchange, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		exchanges = append(exchanges, exchange)
+		flushedEarly = flushedEarly || len(source.packets) > 0
+	}
+	if maxBuffered > reader.bufferLimit {
+		t.Errorf("buffered %d bytes, over the %d byte budget", maxBuffered, reader.bufferLimit)
+	}
+	if !flushedEarly {
+		t.Error("no flow was flushed before the end of the capture")
+	}
+	if len(exchanges) != 3 || reader.buffered != 0 {
+		t.Errorf("got %d exchanges with %d bytes still buffered, want 3 and 0", len(exchanges), reader.buffered)
+	}
+	for _, exchange := range exchanges {
+		if exchange.StatusCode != 201 {
+			t.Errorf("exchange = %+v", exchange)
+		}
+	}
+}
+
+func tnet(kind byte, payload string) string {
+	return fmt.Sprintf("%d:%s%c", len(payload), payload, kind)
+}
+
+func tnetDict(pairs ...string) string {
+	return tnet('}', strings.Join(pairs, ""))
+}
+
+func TestImportCapture_Mitmproxy(t *testing.T) {
+	service, recorder := newTestImportService(100)
+
+	headers := tnet(']', tnet(']', tnet(',', "User-Agent")+tnet(',', "curl/8.0")))
+	request := tnetDict(
+		tnet(';', "method"), tnet(',', "GET"),
+		tnet(';', "scheme"), tnet(',', "https"),
+		tnet(';', "host"), tnet(';', "api.example.com"),
+		tnet(';', "port"), tnet('#', "8443"),
+		tnet(';', "path"), tnet(',', "/v1/users?id=3"),
+		tnet(';', "http_version"), tnet(',', "HTTP/1.1"),
+		tnet(';', "headers"), headers,
+		tnet(';', "content"), tnet(',', ""),
+		tnet(';', "timestamp_start"), tnet('^', "1709287200.5"),
+	)
+	response := tnetDict(
+		tnet(';', "status_code"), tnet('#', "404"),
+		tnet(';', "headers"), tnet(']', ""),
+		tnet(';', "content"), tnet(',', "missing"),
+		tnet(';', "timestamp_end"), tnet('^', "1709287200.75"),
+	)
+	clientConn := tnetDict(tnet(';', "peername"), tnet(']', tnet(';', "172.16.0.9")+tnet('#', "41000")))
+	flow := tnetDict(
+		tnet(';', "type"), tnet(';', "http"),
+		tnet(';', "request"), request,
+		tnet(';', "response"), response,
+		tnet(';', "client_conn"), clientConn,
+	)
+	tcpFlow := tnetDict(tnet(';', "type"), tnet(';', "tcp"))
+
+	result, err := service.ImportCapture(context.Background(), &models.CaptureImportRequest{Format: "mitmproxy"}, strings.NewReader(tcpFlow+flow))
+	if err != nil {
+		t.Fatalf("ImportCapture: %v", err)
+	}
+	if result.ImportedRecords != 1 || result.Status != "completed" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	record := recorder.records[0]
+	if record.URL != "https://api.example.com:8443/v1/users?id=3" || record.QueryParams["id"] != "3" {
+		t.Fatalf("unexpected URL: %s %v", record.URL, record.QueryParams)
+	}
+	if record.UserAgent != "curl/8.0" || record.StatusCode != 404 || record.ResponseText != "missing" {
+		t.Fatalf("unexpected record: %+v", record)
+	}
+	if record.SourceIP != "172.16.0.9" || record.Duration != 250*time.Millisecond {
+		t.Fatalf("unexpected connection details: %s %v", record.SourceIP, record.Duration)
+	}
+}
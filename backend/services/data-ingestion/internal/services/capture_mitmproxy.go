@@ -0,0 +1,315 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxTnetstringSize  = 256 * 1024 * 1024
+	maxTnetstringDepth = 64
+)
+
+// mitmproxyReader streams flows out of a mitmproxy dump, which is a sequence
+// of tnetstring-encoded dictionaries. Non-HTTP flows are skipped.
+type mitmproxyReader struct {
+	reader *bufio.Reader
+	record int
+}
+
+func newMitmproxyReader(reader *bufio.Reader) *mitmproxyReader {
+	return &mitmproxyReader{reader: reader}
+}
+
+func (m *mitmproxyReader) Next() (*capturedExchange, error) {
+	for {
+		value, err := readTnetstring(m.reader)
+		if err != nil {
+			return nil, err
+		}
+		m.record++
+
+		flow, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, &captureRecordError{record: m.record, err: fmt.Errorf("flow is not a dictionary")}
+		}
+		if flowType := tnetString(flow["type"]); flowType != "" && flowType != "http" {
+			continue
+		}
+
+		exchange, err := mitmproxyExchange(flow)
+		if err != nil {
+			return nil, &captureRecordError{record: m.record, err: err}
+		}
+		return exchange, nil
+	}
+}
+
+func mitmproxyExchange(flow map[string]interface{}) (*capturedExchange, error) {
+	request, ok := flow["request"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("flow has no request")
+	}
+
+	exchange := &capturedExchange{
+		Method:         tnetString(request["method"]),
+		Protocol:       tnetString(request["http_version"]),
+		RequestHeaders: tnetHeaders(request["headers"]),
+		RequestBody:    tnetBytes(request["content"]),
+	}
+	if exchange.Method == "" {
+		return nil, fmt.Errorf("request has no method")
+	}
+
+	scheme := tnetString(request["scheme"])
+	if scheme == "" {
+		scheme = "http"
+	}
+	host := tnetString(request["authority"])
+	if host == "" {
+		host = tnetString(request["host"])
+		if port, ok := tnetInt(request["port"]); ok && !isDefaultPort(scheme, port) {
+			host = net.JoinHostPort(host, strconv.FormatInt(port, 10))
+		}
+	}
+	exchange.URL = scheme + "://" + host + tnetString(request["path"])
+
+	startedAt, hasStart := tnetFloat(request["timestamp_start"])
+	if hasStart {
+		exchange.StartedAt = unixFloatTime(startedAt)
+	}
+
+	if response, ok := flow["response"].(map[string]interface{}); ok {
+		if statusCode, ok := tnetInt(response["status_code"]); ok {
+			exchange.StatusCode = int(statusCode)
+		}
+		exchange.ResponseHeaders = tnetHeaders(response["headers"])
+		exchange.ResponseBody = tnetBytes(response["content"])
+		if finishedAt, ok := tnetFloat(response["timestamp_end"]); ok && hasStart {
+			exchange.Duration = time.Duration((finishedAt - startedAt) * float64(time.Second))
+		}
+	}
+
+	if clientConn, ok := flow["client_conn"].(map[string]interface{}); ok {
+		exchange.SourceIP = tnetAddressHost(clientConn, "peername", "address")
+	}
+	if serverConn, ok := flow["server_conn"].(map[string]interface{}); ok {
+		exchange.DestinationIP = tnetAddressHost(serverConn, "peername", "ip_address", "address")
+	}
+
+	return exchange, nil
+}
+
+// readTnetstring reads one "<length>:<payload><type>" value from the stream
+func readTnetstring(reader *bufio.Reader) (interface{}, error) {
+	length := 0
+	digits := 0
+	for {
+		c, err := reader.ReadByte()
+		if err != nil {
+			if err == io.EOF && digits > 0 {
+				return nil, fmt.Errorf("truncated tnetstring length")
+			}
+			return nil, err
+		}
+		if c == ':' {
+			break
+		}
+		// Tolerate whitespace between top-level values
+		if digits == 0 && (c == '\n' || c == '\r' || c == ' ') {
+			continue
+		}
+		if c < '0' || c > '9' || digits >= 10 {
+			return nil, fmt.Errorf("invalid tnetstring length")
+		}
+		length = length*10 + int(c-'0')
+		digits++
+	}
+	if digits == 0 {
+		return nil, fmt.Errorf("missing tnetstring length")
+	}
+	if length > maxTnetstringSize {
+		return nil, fmt.Errorf("tnetstring too large: %d bytes", length)
+	}
+
+	payload := make([]byte, length+1)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, fmt.Errorf("truncated tnetstring: %w", err)
+	}
+
+	return parseTnetstringPayload(payload[:length], payload[length], 0)
+}
+
+// parseTnetstring parses one value from the front of data and returns the remainder
+func parseTnetstring(data []byte, depth int) (interface{}, []byte, error) {
+	colon := -1
+	for i := 0; i < len(data) && i <= 10; i++ {
+		if data[i] == ':' {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return nil, nil, fmt.Errorf("invalid tnetstring length")
+	}
+
+	length, err := strconv.Atoi(string(data[:colon]))
+	if err != nil || length < 0 || colon+1+length >= len(data) {
+		return nil, nil, fmt.Errorf("invalid tnetstring length")
+	}
+
+	payload := data[colon+1 : colon+1+length]
+	value, err := parseTnetstringPayload(payload, data[colon+1+length], depth)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, data[colon+2+length:], nil
+}
+
+func parseTnetstringPayload(payload []byte, kind byte, depth int) (interface{}, error) {
+	if depth > maxTnetstringDepth {
+		return nil, fmt.Errorf("tnetstring nested too deeply")
+	}
+
+	switch kind {
+	case ',':
+		return payload, nil
+	case ';':
+		return string(payload), nil
+	case '#':
+		value, err := strconv.ParseInt(string(payload), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tnetstring integer: %w", err)
+		}
+		return value, nil
+	case '^':
+		value, err := strconv.ParseFloat(string(payload), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tnetstring float: %w", err)
+		}
+		return value, nil
+	case '!':
+		return string(payload) == "true", nil
+	case '~':
+		return nil, nil
+	case ']':
+		list := []interface{}{}
+		for len(payload) > 0 {
+			item, rest, err := parseTnetstring(payload, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+			payload = rest
+		}
+		return list, nil
+	case '}':
+		dict := map[string]interface{}{}
+		for len(payload) > 0 {
+			key, rest, err := parseTnetstring(payload, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			value, rest, err := parseTnetstring(rest, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			dict[tnetString(key)] = value
+			payload = rest
+		}
+		return dict, nil
+	default:
+		return nil, fmt.Errorf("unknown tnetstring type %q", kind)
+	}
+}
+
+func tnetString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return ""
+	}
+}
+
+func tnetBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case []byte:
+		if len(v) == 0 {
+			return nil
+		}
+		return v
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []byte(v)
+	default:
+		return nil
+	}
+}
+
+func tnetInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func tnetFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// tnetHeaders converts mitmproxy's [[name, value], ...] header list
+func tnetHeaders(value interface{}) map[string]string {
+	headers := map[string]string{}
+	list, _ := value.([]interface{})
+	for _, item := range list {
+		pair, ok := item.([]interface{})
+		if !ok || len(pair) != 2 {
+			continue
+		}
+		addHeader(headers, tnetString(pair[0]), tnetString(pair[1]))
+	}
+	return headers
+}
+
+// tnetAddressHost returns the host of the first [host, port] address present under keys
+func tnetAddressHost(conn map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if address, ok := conn[key].([]interface{}); ok && len(address) > 0 {
+			if host := tnetString(address[0]); host != "" {
+				return host
+			}
+		}
+	}
+	return ""
+}
+
+func unixFloatTime(seconds float64) time.Time {
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*float64(time.Second))).UTC()
+}
+
+func isDefaultPort(scheme string, port int64) bool {
+	return (strings.EqualFold(scheme, "http") && port == 80) || (strings.EqualFold(scheme, "https") && port == 443)
+}
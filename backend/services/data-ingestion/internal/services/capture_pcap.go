@@ -0,0 +1,826 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	pcapngBlockSectionHeader     = 0x0a0d0d0a
+	pcapngBlockInterface         = 0x00000001
+	pcapngBlockSimplePacket      = 0x00000003
+	pcapngBlockEnhancedPacket    = 0x00000006
+	pcapngByteOrderMagic         = 0x1a2b3c4d
+	pcapngOptionTimestampResolve = 9
+
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLoop     = 108
+	linkTypeLinuxSLL = 113
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+
+	tcpFlagFIN = 0x01
+	tcpFlagSYN = 0x02
+	tcpFlagRST = 0x04
+	tcpFlagACK = 0x10
+
+	maxPcapBlockSize    = 64 * 1024 * 1024
+	maxTCPStreamSize    = 32 * 1024 * 1024
+	maxTrackedTCPFlows  = 65536
+	maxTCPSegmentsCount = 1 << 20
+	// Payload buffered across all flows before the oldest are flushed early
+	maxBufferedTCPBytes = 256 * 1024 * 1024
+)
+
+// capturedPacket is a single link-layer frame read from a capture file
+type capturedPacket struct {
+	timestamp time.Time
+	linkType  uint32
+	data      []byte
+}
+
+type packetSource interface {
+	nextPacket() (*capturedPacket, error)
+}
+
+func isPcapMagic(magic []byte) bool {
+	if len(magic) < 4 {
+		return false
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(magic) {
+		case 0xa1b2c3d4, 0xa1b23c4d:
+			return true
+		}
+	}
+	return false
+}
+
+// pcapSource reads classic libpcap files
+type pcapSource struct {
+	reader   io.Reader
+	order    binary.ByteOrder
+	nanos    bool
+	linkType uint32
+}
+
+func newPcapSource(reader io.Reader) (*pcapSource, error) {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, fmt.Errorf("failed to read pcap header: %w", err)
+	}
+
+	source := &pcapSource{reader: reader}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(header[0:4]) {
+		case 0xa1b2c3d4:
+			source.order = order
+		case 0xa1b23c4d:
+			source.order = order
+			source.nanos = true
+		}
+	}
+	if source.order == nil {
+		return nil, fmt.Errorf("invalid pcap magic number")
+	}
+
+	source.linkType = source.order.Uint32(header[20:24]) & 0x0fffffff
+	return source, nil
+}
+
+func (p *pcapSource) nextPacket() (*capturedPacket, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(p.reader, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated pcap record header")
+		}
+		return nil, err
+	}
+
+	seconds := int64(p.order.Uint32(header[0:4]))
+	fraction := int64(p.order.Uint32(header[4:8]))
+	capturedLength := p.order.Uint32(header[8:12])
+	if capturedLength > maxPcapBlockSize {
+		return nil, fmt.Errorf("pcap record too large: %d bytes", capturedLength)
+	}
+
+	data := make([]byte, capturedLength)
+	if _, err := io.ReadFull(p.reader, data); err != nil {
+		return nil, fmt.Errorf("truncated pcap record: %w", err)
+	}
+
+	if !p.nanos {
+		fraction *= int64(time.Microsecond)
+	}
+	return &capturedPacket{
+		timestamp: time.Unix(seconds, fraction).UTC(),
+		linkType:  p.linkType,
+		data:      data,
+	}, nil
+}
+
+// pcapngSource reads pcapng files, tracking interfaces per section
+type pcapngSource struct {
+	reader     io.Reader
+	order      binary.ByteOrder
+	interfaces []pcapngInterface
+}
+
+type pcapngInterface struct {
+	linkType  uint32
+	unitsPerS uint64 // timestamp units per second, from if_tsresol
+}
+
+func newPcapngSource(reader io.Reader) *pcapngSource {
+	return &pcapngSource{reader: reader}
+}
+
+func (p *pcapngSource) nextPacket() (*capturedPacket, error) {
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(p.reader, header); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("truncated pcapng block header")
+			}
+			return nil, err
+		}
+
+		// The section header type is a palindrome, so it can be recognised before the byte order is known
+		if binary.LittleEndian.Uint32(header[0:4]) == pcapngBlockSectionHeader {
+			if err := p.readSectionHeader(header); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if p.order == nil {
+			return nil, fmt.Errorf("pcapng block before section header")
+		}
+
+		blockType := p.order.Uint32(header[0:4])
+		totalLength := p.order.Uint32(header[4:8])
+		if totalLength < 12 || totalLength > maxPcapBlockSize || totalLength%4 != 0 {
+			return nil, fmt.Errorf("invalid pcapng block length: %d", totalLength)
+		}
+
+		body := make([]byte, totalLength-8)
+		if _, err := io.ReadFull(p.reader, body); err != nil {
+			return nil, fmt.Errorf("truncated pcapng block: %w", err)
+		}
+		body = body[:len(body)-4] // trailing block length
+
+		switch blockType {
+		case pcapngBlockInterface:
+			p.readInterface(body)
+		case pcapngBlockEnhancedPacket:
+			if packet := p.readEnhancedPacket(body); packet != nil {
+				return packet, nil
+			}
+		case pcapngBlockSimplePacket:
+			if packet := p.readSimplePacket(body); packet != nil {
+				return packet, nil
+			}
+		}
+	}
+}
+
+func (p *pcapngSource) readSectionHeader(header []byte) error {
+	rest := make([]byte, 4)
+	if _, err := io.ReadFull(p.reader, rest); err != nil {
+		return fmt.Errorf("truncated pcapng section header: %w", err)
+	}
+
+	switch {
+	case binary.LittleEndian.Uint32(rest) == pcapngByteOrderMagic:
+		p.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(rest) == pcapngByteOrderMagic:
+		p.order = binary.BigEndian
+	default:
+		return fmt.Errorf("invalid pcapng byte order magic")
+	}
+
+	totalLength := p.order.Uint32(header[4:8])
+	if totalLength < 28 || totalLength > maxPcapBlockSize {
+		return fmt.Errorf("invalid pcapng section header length: %d", totalLength)
+	}
+	if _, err := io.CopyN(io.Discard, p.reader, int64(totalLength-12)); err != nil {
+		return fmt.Errorf("truncated pcapng section header: %w", err)
+	}
+
+	// Interfaces are scoped to their section
+	p.interfaces = nil
+	return nil
+}
+
+func (p *pcapngSource) readInterface(body []byte) {
+	if len(body) < 8 {
+		return
+	}
+
+	iface := pcapngInterface{
+		linkType:  uint32(p.order.Uint16(body[0:2])),
+		unitsPerS: 1000000,
+	}
+
+	options := body[8:]
+	for len(options) >= 4 {
+		code := p.order.Uint16(options[0:2])
+		length := int(p.order.Uint16(options[2:4]))
+		if code == 0 || 4+length > len(options) {
+			break
+		}
+		if code == pcapngOptionTimestampResolve && length >= 1 {
+			resolution := options[4]
+			if resolution&0x80 != 0 {
+				if resolution&0x7f < 64 {
+					iface.unitsPerS = 1 << (resolution & 0x7f)
+				}
+			} else if resolution <= 19 {
+				iface.unitsPerS = 1
+				for i := byte(0); i < resolution; i++ {
+					iface.unitsPerS *= 10
+				}
+			}
+		}
+		options = options[4+(length+3)&^3:]
+	}
+
+	p.interfaces = append(p.interfaces, iface)
+}
+
+func (p *pcapngSource) readEnhancedPacket(body []byte) *capturedPacket {
+	if len(body) < 20 {
+		return nil
+	}
+
+	interfaceID := p.order.Uint32(body[0:4])
+	if int(interfaceID) >= len(p.interfaces) {
+		return nil
+	}
+	iface := p.interfaces[interfaceID]
+
+	timestamp := uint64(p.order.Uint32(body[4:8]))<<32 | uint64(p.order.Uint32(body[8:12]))
+	capturedLength := int(p.order.Uint32(body[12:16]))
+	if capturedLength > len(body)-20 {
+		capturedLength = len(body) - 20
+	}
+
+	seconds := timestamp / iface.unitsPerS
+	remainder := timestamp % iface.unitsPerS
+	nanos := uint64(float64(remainder) * float64(time.Second) / float64(iface.unitsPerS))
+
+	return &capturedPacket{
+		timestamp: time.Unix(int64(seconds), int64(nanos)).UTC(),
+		linkType:  iface.linkType,
+		data:      body[20 : 20+capturedLength],
+	}
+}
+
+func (p *pcapngSource) readSimplePacket(body []byte) *capturedPacket {
+	if len(body) < 4 || len(p.interfaces) == 0 {
+		return nil
+	}
+
+	originalLength := int(p.order.Uint32(body[0:4]))
+	data := body[4:]
+	if originalLength < len(data) {
+		data = data[:originalLength]
+	}
+
+	return &capturedPacket{linkType: p.interfaces[0].linkType, data: data}
+}
+
+// tcpSegment is a decoded TCP segment with its addressing
+type tcpSegment struct {
+	timestamp time.Time
+	src       tcpEndpoint
+	dst       tcpEndpoint
+	seq       uint32
+	flags     byte
+	payload   []byte
+}
+
+type tcpEndpoint struct {
+	ip   string
+	port uint16
+}
+
+func (e tcpEndpoint) String() string {
+	return net.JoinHostPort(e.ip, strconv.Itoa(int(e.port)))
+}
+
+// decodeTCPSegment unwraps the link and IP layers of a frame down to TCP
+func decodeTCPSegment(packet *capturedPacket) (*tcpSegment, bool) {
+	data := packet.data
+
+	switch packet.linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		for etherType == 0x8100 || etherType == 0x88a8 {
+			if len(data) < 4 {
+				return nil, false
+			}
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+		if etherType != 0x0800 && etherType != 0x86dd {
+			return nil, false
+		}
+	case linkTypeNull, linkTypeLoop:
+		if len(data) < 4 {
+			return nil, false
+		}
+		data = data[4:]
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, false
+		}
+		data = data[16:]
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+	default:
+		return nil, false
+	}
+
+	if len(data) < 1 {
+		return nil, false
+	}
+
+	var src, dst net.IP
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return nil, false
+		}
+		headerLength := int(data[0]&0x0f) * 4
+		totalLength := int(binary.BigEndian.Uint16(data[2:4]))
+		fragment := binary.BigEndian.Uint16(data[6:8])
+		if data[9] != 6 || headerLength < 20 || fragment&0x3fff != 0 {
+			// Not TCP, or an IP fragment, which is not reassembled
+			return nil, false
+		}
+		if totalLength > len(data) || totalLength < headerLength {
+			totalLength = len(data)
+		}
+		src, dst = net.IP(data[12:16]), net.IP(data[16:20])
+		data = data[headerLength:totalLength]
+	case 6:
+		if len(data) < 40 {
+			return nil, false
+		}
+		payloadLength := int(binary.BigEndian.Uint16(data[4:6]))
+		nextHeader := data[6]
+		src, dst = net.IP(data[8:24]), net.IP(data[24:40])
+		data = data[40:]
+		if payloadLength < len(data) {
+			data = data[:payloadLength]
+		}
+		// Skip hop-by-hop, routing and destination option headers
+		for nextHeader == 0 || nextHeader == 43 || nextHeader == 60 {
+			if len(data) < 8 {
+				return nil, false
+			}
+			extensionLength := (int(data[1]) + 1) * 8
+			if extensionLength > len(data) {
+				return nil, false
+			}
+			nextHeader = data[0]
+			data = data[extensionLength:]
+		}
+		if nextHeader != 6 {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	if len(data) < 20 {
+		return nil, false
+	}
+	dataOffset := int(data[12]>>4) * 4
+	if dataOffset < 20 || dataOffset > len(data) {
+		return nil, false
+	}
+
+	return &tcpSegment{
+		timestamp: packet.timestamp,
+		src:       tcpEndpoint{ip: src.String(), port: binary.BigEndian.Uint16(data[0:2])},
+		dst:       tcpEndpoint{ip: dst.String(), port: binary.BigEndian.Uint16(data[2:4])},
+		seq:       binary.BigEndian.Uint32(data[4:8]),
+		flags:     data[13],
+		payload:   data[dataOffset:],
+	}, true
+}
+
+// tcpHalfStream collects one direction of a TCP connection
+type tcpHalfStream struct {
+	endpoint  tcpEndpoint
+	isn       uint32
+	hasISN    bool
+	sentSYN   bool // SYN without ACK, i.e. the connecting side
+	finished  bool
+	size      int
+	segments  []tcpSegment
+	truncated bool
+}
+
+type tcpFlow struct {
+	key      string
+	halves   [2]*tcpHalfStream
+	lastSeen time.Time
+}
+
+// streamMark records the capture time of the segment that starts at an offset
+type streamMark struct {
+	offset    int
+	timestamp time.Time
+}
+
+type reassembledStream struct {
+	endpoint tcpEndpoint
+	data     []byte
+	marks    []streamMark
+}
+
+func (f *tcpFlow) half(endpoint tcpEndpoint) *tcpHalfStream {
+	for _, half := range f.halves {
+		if half != nil && half.endpoint == endpoint {
+			return half
+		}
+	}
+	half := &tcpHalfStream{endpoint: endpoint}
+	if f.halves[0] == nil {
+		f.halves[0] = half
+	} else {
+		f.halves[1] = half
+	}
+	return half
+}
+
+// add records a segment and returns the number of payload bytes it buffered
+func (f *tcpFlow) add(segment *tcpSegment) int {
+	half := f.half(segment.src)
+	f.lastSeen = segment.timestamp
+
+	if segment.flags&tcpFlagSYN != 0 {
+		half.isn = segment.seq
+		half.hasISN = true
+		half.sentSYN = segment.flags&tcpFlagACK == 0
+	}
+	if segment.flags&(tcpFlagFIN|tcpFlagRST) != 0 {
+		half.finished = true
+	}
+
+	if len(segment.payload) == 0 || half.truncated {
+		return 0
+	}
+	if half.size+len(segment.payload) > maxTCPStreamSize || len(half.segments) >= maxTCPSegmentsCount {
+		half.truncated = true
+		return 0
+	}
+
+	segment.payload = append([]byte(nil), segment.payload...)
+	half.segments = append(half.segments, *segment)
+	half.size += len(segment.payload)
+	return len(segment.payload)
+}
+
+// size is the payload buffered for both directions
+func (f *tcpFlow) size() int {
+	size := 0
+	for _, half := range f.halves {
+		if half != nil {
+			size += half.size
+		}
+	}
+	return size
+}
+
+func (f *tcpFlow) complete() bool {
+	return f.halves[0] != nil && f.halves[1] != nil && f.halves[0].finished && f.halves[1].finished
+}
+
+// reassemble orders a half stream by sequence number, dropping retransmissions
+// and stopping at the first gap.
+func (h *tcpHalfStream) reassemble() reassembledStream {
+	stream := reassembledStream{endpoint: h.endpoint}
+	if len(h.segments) == 0 {
+		return stream
+	}
+
+	base := h.segments[0].seq
+	if h.hasISN {
+		base = h.isn + 1
+	} else {
+		for _, segment := range h.segments {
+			if int32(segment.seq-base) < 0 {
+				base = segment.seq
+			}
+		}
+	}
+
+	sort.SliceStable(h.segments, func(i, j int) bool {
+		return int32(h.segments[i].seq-base) < int32(h.segments[j].seq-base)
+	})
+
+	var buffer bytes.Buffer
+	for _, segment := range h.segments {
+		relative := int(int32(segment.seq - base))
+		end := relative + len(segment.payload)
+		switch {
+		case relative > buffer.Len():
+			// Missing data; everything after the gap is unreliable
+			stream.data = buffer.Bytes()
+			return stream
+		case end <= buffer.Len():
+			continue
+		}
+		stream.marks = append(stream.marks, streamMark{offset: buffer.Len(), timestamp: segment.timestamp})
+		buffer.Write(segment.payload[buffer.Len()-relative:])
+	}
+
+	stream.data = buffer.Bytes()
+	return stream
+}
+
+func (s reassembledStream) timestampAt(offset int) time.Time {
+	index := sort.Search(len(s.marks), func(i int) bool { return s.marks[i].offset > offset })
+	if index == 0 {
+		if len(s.marks) > 0 {
+			return s.marks[0].timestamp
+		}
+		return time.Time{}
+	}
+	return s.marks[index-1].timestamp
+}
+
+// pcapExchangeReader reassembles TCP flows from pcap/pcapng captures and
+// parses HTTP/1.x exchanges out of them.
+type pcapExchangeReader struct {
+	source  packetSource
+	flows   map[string]*tcpFlow
+	pending []*capturedExchange
+	done    bool
+	// buffered is the payload held across all flows, kept within bufferLimit
+	buffered    int
+	bufferLimit int
+}
+
+func newPcapExchangeReader(reader *bufio.Reader) (*pcapExchangeReader, error) {
+	magic, err := reader.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture header: %w", err)
+	}
+
+	var source packetSource
+	switch {
+	case bytes.Equal(magic, []byte{0x0a, 0x0d, 0x0d, 0x0a}):
+		source = newPcapngSource(reader)
+	case isPcapMagic(magic):
+		pcap, err := newPcapSource(reader)
+		if err != nil {
+			return nil, err
+		}
+		source = pcap
+	default:
+		return nil, fmt.Errorf("not a pcap or pcapng capture")
+	}
+
+	return &pcapExchangeReader{
+		source:      source,
+		flows:       make(map[string]*tcpFlow),
+		bufferLimit: maxBufferedTCPBytes,
+	}, nil
+}
+
+func (r *pcapExchangeReader) Next() (*capturedExchange, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return nil, io.EOF
+		}
+
+		packet, err := r.source.nextPacket()
+		if err == io.EOF {
+			r.done = true
+			r.flushAll()
+			continue
+		}
+		if err != nil {
+			// Keep whatever was captured before the corruption
+			r.done = true
+			r.flushAll()
+			if len(r.pending) == 0 {
+				return nil, err
+			}
+			continue
+		}
+
+		segment, ok := decodeTCPSegment(packet)
+		if !ok {
+			continue
+		}
+
+		key := tcpFlowKey(segment.src, segment.dst)
+		flow, exists := r.flows[key]
+		if !exists {
+			if len(r.flows) >= maxTrackedTCPFlows {
+				r.evictOldest()
+			}
+			flow = &tcpFlow{key: key}
+			r.flows[key] = flow
+		}
+		r.buffered += flow.add(segment)
+
+		if flow.complete() {
+			r.flush(flow)
+		}
+		for r.buffered > r.bufferLimit && len(r.flows) > 0 {
+			r.evictOldest()
+		}
+	}
+
+	exchange := r.pending[0]
+	r.pending = r.pending[1:]
+	return exchange, nil
+}
+
+func (r *pcapExchangeReader) flush(flow *tcpFlow) {
+	delete(r.flows, flow.key)
+	r.buffered -= flow.size()
+	r.pending = append(r.pending, parseHTTPFlow(flow)...)
+}
+
+func (r *pcapExchangeReader) flushAll() {
+	flows := make([]*tcpFlow, 0, len(r.flows))
+	for _, flow := range r.flows {
+		flows = append(flows, flow)
+	}
+	sort.Slice(flows, func(i, j int) bool { return flows[i].lastSeen.Before(flows[j].lastSeen) })
+	for _, flow := range flows {
+		r.flush(flow)
+	}
+}
+
+func (r *pcapExchangeReader) evictOldest() {
+	var oldest *tcpFlow
+	for _, flow := range r.flows {
+		if oldest == nil || flow.lastSeen.Before(oldest.lastSeen) {
+			oldest = flow
+		}
+	}
+	if oldest != nil {
+		r.flush(oldest)
+	}
+}
+
+func tcpFlowKey(a, b tcpEndpoint) string {
+	first, second := a.String(), b.String()
+	if first > second {
+		first, second = second, first
+	}
+	return first + "|" + second
+}
+
+// parseHTTPFlow pairs HTTP/1.x requests and responses in a reassembled flow
+func parseHTTPFlow(flow *tcpFlow) []*capturedExchange {
+	if flow.halves[0] == nil || flow.halves[1] == nil {
+		return nil
+	}
+
+	client, server := flow.halves[0].reassemble(), flow.halves[1].reassemble()
+	switch {
+	case flow.halves[1].sentSYN && !flow.halves[0].sentSYN:
+		client, server = server, client
+	case flow.halves[0].sentSYN:
+	case looksLikeHTTPResponse(client.data) || looksLikeHTTPRequest(server.data):
+		client, server = server, client
+	}
+	if !looksLikeHTTPRequest(client.data) {
+		return nil
+	}
+
+	clientReader := bytes.NewReader(client.data)
+	requests := bufio.NewReader(clientReader)
+	serverReader := bytes.NewReader(server.data)
+	responses := bufio.NewReader(serverReader)
+
+	var exchanges []*capturedExchange
+	for {
+		offset := len(client.data) - clientReader.Len() - requests.Buffered()
+		request, err := http.ReadRequest(requests)
+		if err != nil {
+			break
+		}
+		requestBody := readCapturedBody(request.Body)
+
+		exchange := &capturedExchange{
+			StartedAt:      client.timestampAt(offset),
+			SourceIP:       client.endpoint.ip,
+			DestinationIP:  server.endpoint.ip,
+			Protocol:       request.Proto,
+			Method:         request.Method,
+			URL:            capturedRequestURL(request, server.endpoint),
+			RequestHeaders: flattenHeaders(request.Header),
+			RequestBody:    requestBody,
+		}
+		if request.Host != "" {
+			exchange.RequestHeaders["Host"] = request.Host
+		}
+
+		responseOffset := len(server.data) - serverReader.Len() - responses.Buffered()
+		response, err := readFinalResponse(responses, request)
+		if err == nil {
+			exchange.StatusCode = response.StatusCode
+			exchange.ResponseHeaders = flattenHeaders(response.Header)
+			exchange.ResponseBody = readCapturedBody(response.Body)
+			if respondedAt := server.timestampAt(responseOffset); !respondedAt.IsZero() && !exchange.StartedAt.IsZero() {
+				exchange.Duration = respondedAt.Sub(exchange.StartedAt)
+			}
+		}
+
+		exchanges = append(exchanges, exchange)
+	}
+
+	return exchanges
+}
+
+// readFinalResponse skips interim 1xx responses other than 101 Switching Protocols
+func readFinalResponse(reader *bufio.Reader, request *http.Request) (*http.Response, error) {
+	for {
+		response, err := http.ReadResponse(reader, request)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode >= 200 || response.StatusCode == http.StatusSwitchingProtocols {
+			return response, nil
+		}
+	}
+}
+
+func readCapturedBody(body io.ReadCloser) []byte {
+	if body == nil {
+		return nil
+	}
+	defer body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(body, maxCapturedBodySize))
+	io.Copy(io.Discard, body)
+	if len(data) == 0 {
+		return nil
+	}
+	return data
+}
+
+func capturedRequestURL(request *http.Request, server tcpEndpoint) string {
+	if request.URL.IsAbs() {
+		return request.URL.String()
+	}
+
+	host := request.Host
+	if host == "" {
+		host = server.String()
+	}
+	scheme := "http"
+	if server.port == 443 {
+		scheme = "https"
+	}
+	return scheme + "://" + host + request.URL.RequestURI()
+}
+
+func flattenHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+func looksLikeHTTPRequest(data []byte) bool {
+	space := bytes.IndexByte(data, ' ')
+	if space <= 0 || space > 16 {
+		return false
+	}
+	for _, c := range data[:space] {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func looksLikeHTTPResponse(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("HTTP/"))
+}
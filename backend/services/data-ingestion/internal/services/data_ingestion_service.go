@@ -3,15 +3,17 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"scopeapi.local/backend/services/data-ingestion/internal/config"
 	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/services/data-ingestion/internal/repository"
 	"scopeapi.local/backend/shared/logging"
-	"scopeapi.local/backend/shared/messaging/kafka"
 )
 
 type DataIngestionServiceInterface interface {
@@ -20,36 +22,87 @@ type DataIngestionServiceInterface interface {
 	GetIngestionStatus(ctx context.Context, id string) (*models.IngestionStatus, error)
 	GetIngestionStats(ctx context.Context, timeRange *models.TimeRange) (*models.IngestionStats, error)
 	UpdateConfiguration(ctx context.Context, configType string, config interface{}) error
+	Close(ctx context.Context) error
 }
 
+// Record outcomes counted in the ingestion stats
+const (
+	outcomeSucceeded = "succeeded"
+	outcomeFailed    = "failed"
+	outcomeFiltered  = "filtered"
+)
+
 type DataIngestionService struct {
-	kafkaProducer kafka.ProducerInterface
+	queue         QueueServiceInterface
+	repository    repository.IngestionRepositoryInterface
 	logger        logging.Logger
 	config        *config.Config
 	statusMap     map[string]*models.IngestionStatus
 	stats         *models.IngestionStats
+	rollups       map[time.Time]*models.IngestionRollup
 	mutex         sync.RWMutex
 	parserService DataParserServiceInterface
 	normalizerService DataNormalizerServiceInterface
+	policies      *ingestionPolicies
+	redactor      *redactor
+	decoder       *bodyDecoder
+	stop          chan struct{}
+	stopOnce      sync.Once
 }
 
+// NewDataIngestionService creates the ingestion service. Records are published
+// through queue so they are spooled while Kafka is down. repo may be nil, in which
+// case job status and stats only live in memory. parser should be the one behind
+// the parser API, so the descriptors registered there decode ingested bodies.
 func NewDataIngestionService(
-	kafkaProducer kafka.ProducerInterface,
+	queue QueueServiceInterface,
+	repo repository.IngestionRepositoryInterface,
+	parser DataParserServiceInterface,
 	logger logging.Logger,
 	cfg *config.Config,
 ) DataIngestionServiceInterface {
 	service := &DataIngestionService{
-		kafkaProducer: kafkaProducer,
+		queue:         queue,
+		repository:    repo,
+		parserService: parser,
 		logger:        logger,
 		config:        cfg,
 		statusMap:     make(map[string]*models.IngestionStatus),
 		stats:         &models.IngestionStats{},
+		rollups:       make(map[time.Time]*models.IngestionRollup),
+		stop:          make(chan struct{}),
 	}
 
-	// Initialize parser and normalizer services
-	service.parserService = NewDataParserService(logger, cfg)
+	// Initialize normalizer service
 	service.normalizerService = NewDataNormalizerService(logger, cfg)
 
+	// Invalid policies are reported and ingestion continues unfiltered
+	policies, err := compileIngestionPolicies(cfg.Ingestion.Policies)
+	if err != nil {
+		logger.Error("Invalid ingestion policies, ingesting without policies", "error", err)
+		policies, _ = compileIngestionPolicies(nil)
+	}
+	service.policies = policies
+
+	// Decoding limits fall back to the defaults rather than decoding unbounded
+	decoder, err := newBodyDecoder(cfg.Ingestion.Decoding)
+	if err != nil {
+		logger.Error("Invalid decoding configuration, using default limits", "error", err)
+		decoder, _ = newBodyDecoder(config.DecodingConfig{})
+	}
+	service.decoder = decoder
+
+	// Redaction falls back to the built-in rules rather than publishing secrets
+	redactor, err := compileRedactor(cfg.Ingestion.Redaction)
+	if err != nil {
+		logger.Error("Invalid redaction configuration, using default redaction rules", "error", err)
+		redactor, _ = compileRedactor(config.RedactionConfig{Enabled: true, Key: cfg.Ingestion.Redaction.Key})
+	}
+	if redactor != nil && redactor.ephemeralKey {
+		logger.Warn("No redaction key configured, redacted values will not correlate across restarts")
+	}
+	service.redactor = redactor
+
 	// Start background tasks
 	go service.startStatsCollector()
 	go service.startStatusCleanup()
@@ -70,6 +123,7 @@ func (s *DataIngestionService) IngestTraffic(ctx context.Context, request *model
 	// Create ingestion status
 	status := &models.IngestionStatus{
 		ID:         response.ID,
+		Kind:       "single",
 		Status:     "processing",
 		Progress:   0.0,
 		TotalItems: 1,
@@ -88,11 +142,33 @@ func (s *DataIngestionService) IngestTraffic(ctx context.Context, request *model
 		now := time.Now()
 		status.EndTime = &now
 		s.updateStatus(status)
+		s.updateStats(outcomeFailed, 1, time.Since(startTime))
 		return response, err
 	}
 
+	// Redact secrets, then apply sampling, deduplication and body limits
+	s.redactTraffic(trafficData)
+	decision := s.applyPolicies(trafficData)
+	if !decision.Keep {
+		response.Status = "success"
+		response.Message = fmt.Sprintf("Record dropped by ingestion policy %s: %s", decision.Policy, decision.Reason)
+		response.Filtered = 1
+		response.ProcessingTime = time.Since(startTime)
+		status.Status = "completed"
+		status.ProcessedItems = 1
+		status.FilteredItems = 1
+		status.Progress = 100.0
+		now := time.Now()
+		status.EndTime = &now
+		s.updateStatus(status)
+		s.updateStats(outcomeFiltered, 1, time.Since(startTime))
+		return response, nil
+	}
+
+	s.parseBodies(ctx, trafficData)
+
 	// Publish to Kafka
-	if err := s.publishToKafka(ctx, trafficData); err != nil {
+	if err := s.publish(ctx, []models.TrafficData{*trafficData}); err != nil {
 		s.logger.Error("Failed to publish to Kafka", "error", err, "request_id", request.ID)
 		response.Status = "failed"
 		response.Errors = append(response.Errors, err.Error())
@@ -101,6 +177,7 @@ func (s *DataIngestionService) IngestTraffic(ctx context.Context, request *model
 		now := time.Now()
 		status.EndTime = &now
 		s.updateStatus(status)
+		s.updateStats(outcomeFailed, 1, time.Since(startTime))
 		return response, err
 	}
 
@@ -116,7 +193,7 @@ func (s *DataIngestionService) IngestTraffic(ctx context.Context, request *model
 	s.updateStatus(status)
 
 	// Update statistics
-	s.updateStats(trafficData, time.Since(startTime), nil)
+	s.updateStats(outcomeSucceeded, 1, time.Since(startTime))
 
 	s.logger.Info("Traffic ingestion completed", "request_id", request.ID, "traffic_id", trafficData.ID)
 	return response, nil
@@ -135,6 +212,7 @@ func (s *DataIngestionService) IngestBatch(ctx context.Context, batch *models.Ba
 	// Create ingestion status
 	status := &models.IngestionStatus{
 		ID:         response.ID,
+		Kind:       "batch",
 		Status:     "processing",
 		Progress:   0.0,
 		TotalItems: batch.Count,
@@ -145,8 +223,10 @@ func (s *DataIngestionService) IngestBatch(ctx context.Context, batch *models.Ba
 	// Process batch items
 	var trafficIDs []string
 	var errors []string
+	var kept []models.TrafficData
 	processedCount := 0
 	failedCount := 0
+	filteredCount := 0
 
 	for i, trafficData := range batch.Data {
 		// Process individual traffic data
@@ -165,7 +245,14 @@ func (s *DataIngestionService) IngestBatch(ctx context.Context, batch *models.Ba
 			errors = append(errors, fmt.Sprintf("Item %d: %s", i, err.Error()))
 			failedCount++
 		} else {
-			trafficIDs = append(trafficIDs, processed.ID)
+			s.redactTraffic(processed)
+			if s.applyPolicies(processed).Keep {
+				s.parseBodies(ctx, processed)
+				trafficIDs = append(trafficIDs, processed.ID)
+				kept = append(kept, *processed)
+			} else {
+				filteredCount++
+			}
 			processedCount++
 		}
 
@@ -177,11 +264,27 @@ func (s *DataIngestionService) IngestBatch(ctx context.Context, batch *models.Ba
 		s.updateStatus(status)
 	}
 
-	// Publish batch to Kafka
-	if len(trafficIDs) > 0 {
-		if err := s.publishBatchToKafka(ctx, batch); err != nil {
+	// Publish the processed records that survived the ingestion policies
+	batchStatus := models.IngestionBatchStatus{
+		ID:        uuid.New().String(),
+		JobID:     status.ID,
+		BatchID:   batch.ID,
+		Records:   batch.Count,
+		Filtered:  filteredCount,
+		Failed:    failedCount,
+		Status:    "empty",
+		Topic:     s.config.Ingestion.Topics.APITraffic,
+		CreatedAt: time.Now(),
+	}
+	if len(kept) > 0 {
+		if err := s.publish(ctx, kept); err != nil {
 			s.logger.Error("Failed to publish batch to Kafka", "error", err, "batch_id", batch.ID)
 			errors = append(errors, fmt.Sprintf("Kafka publish: %s", err.Error()))
+			batchStatus.Status = "failed"
+			batchStatus.Error = err.Error()
+		} else {
+			batchStatus.Status = "published"
+			batchStatus.Published = len(kept)
 		}
 	}
 
@@ -195,40 +298,97 @@ func (s *DataIngestionService) IngestBatch(ctx context.Context, batch *models.Ba
 	}
 
 	response.TrafficIDs = trafficIDs
+	response.Filtered = filteredCount
 	response.Errors = errors
 	response.ProcessingTime = time.Since(startTime)
 
 	// Update status
 	status.Status = response.Status
+	status.FilteredItems = filteredCount
+	status.Errors = errors
+	status.Batches = append(status.Batches, batchStatus)
 	now := time.Now()
 	status.EndTime = &now
 	s.updateStatus(status)
 
-	// Update statistics
-	s.updateStats(nil, time.Since(startTime), errors)
+	// Update statistics per record, so imports and streams count every record
+	published := len(trafficIDs)
+	if batchStatus.Status == "failed" {
+		failedCount += published
+		published = 0
+	}
+	processingTime := time.Since(startTime)
+	s.updateStats(outcomeSucceeded, published, processingTime)
+	s.updateStats(outcomeFailed, failedCount, processingTime)
+	s.updateStats(outcomeFiltered, filteredCount, processingTime)
 
-	s.logger.Info("Batch ingestion completed", "batch_id", batch.ID, "processed", processedCount, "failed", failedCount)
+	s.logger.Info("Batch ingestion completed", "batch_id", batch.ID, "processed", processedCount, "failed", failedCount, "filtered", filteredCount)
 	return response, nil
 }
 
+// GetIngestionStatus answers from memory for recent jobs and from the repository
+// for jobs that were pruned or ran before a restart
 func (s *DataIngestionService) GetIngestionStatus(ctx context.Context, id string) (*models.IngestionStatus, error) {
 	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-
 	status, exists := s.statusMap[id]
-	if !exists {
-		return nil, fmt.Errorf("ingestion status not found: %s", id)
+	s.mutex.RUnlock()
+	if exists {
+		return status, nil
+	}
+
+	if s.repository != nil {
+		stored, err := s.repository.GetStatus(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if stored != nil {
+			return stored, nil
+		}
 	}
 
-	return status, nil
+	return nil, fmt.Errorf("ingestion status not found: %s", id)
 }
 
+// GetIngestionStats aggregates the stored per-minute rollups, plus the ones not
+// yet flushed, over timeRange. Without a repository or a time range it returns
+// the counters of this process.
 func (s *DataIngestionService) GetIngestionStats(ctx context.Context, timeRange *models.TimeRange) (*models.IngestionStats, error) {
+	if s.repository == nil || timeRange == nil {
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+
+		stats := *s.stats
+		if timeRange != nil {
+			stats.TimeRange = *timeRange
+		}
+		return &stats, nil
+	}
+
+	start := timeRange.Start.UTC().Truncate(time.Minute)
+	rollups, err := s.repository.GetRollups(ctx, start, timeRange.End)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ingestion rollups: %w", err)
+	}
+
+	byMinute := make(map[time.Time]int, len(rollups))
+	for i := range rollups {
+		byMinute[rollups[i].Minute.UTC()] = i
+	}
 	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	for minute, pending := range s.rollups {
+		if minute.Before(start) || !minute.Before(timeRange.End) {
+			continue
+		}
+		if i, exists := byMinute[minute]; exists {
+			mergeRollup(&rollups[i], pending)
+		} else {
+			rollups = append(rollups, *pending)
+		}
+	}
+	s.mutex.RUnlock()
+	sort.Slice(rollups, func(i, j int) bool { return rollups[i].Minute.Before(rollups[j].Minute) })
 
-	// Return current stats (in a real implementation, this would query the database)
-	return s.stats, nil
+	return statsFromRollups(rollups, *timeRange), nil
 }
 
 func (s *DataIngestionService) UpdateConfiguration(ctx context.Context, configType string, config interface{}) error {
@@ -239,6 +399,10 @@ func (s *DataIngestionService) UpdateConfiguration(ctx context.Context, configTy
 		return s.parserService.UpdateConfiguration(ctx, config)
 	case "normalizer":
 		return s.normalizerService.UpdateConfiguration(ctx, config)
+	case "policies":
+		return s.updatePolicies(config)
+	case "redaction":
+		return s.updateRedaction(config)
 	case "ingestion":
 		// Update ingestion configuration
 		if cfg, ok := config.(map[string]interface{}); ok {
@@ -259,6 +423,8 @@ func (s *DataIngestionService) UpdateConfiguration(ctx context.Context, configTy
 	}
 }
 
+const persistTimeout = 10 * time.Second
+
 // Helper methods
 
 func (s *DataIngestionService) processTrafficData(request *models.IngestionRequest) (*models.TrafficData, error) {
@@ -273,6 +439,21 @@ func (s *DataIngestionService) processTrafficData(request *models.IngestionReque
 		UpdatedAt: time.Now(),
 	}
 
+	// Batches and capture imports carry fully-typed records
+	if data, ok := request.Data.(models.TrafficData); ok {
+		id := trafficData.ID
+		*trafficData = data
+		trafficData.ID = id
+		trafficData.Priority = request.Priority
+		trafficData.Tags = request.Tags
+		trafficData.Status = "processing"
+		trafficData.CreatedAt = time.Now()
+		trafficData.UpdatedAt = time.Now()
+		if trafficData.Timestamp.IsZero() {
+			trafficData.Timestamp = request.Timestamp
+		}
+	}
+
 	// Extract traffic data from request
 	if data, ok := request.Data.(map[string]interface{}); ok {
 		// Extract basic fields
@@ -292,7 +473,7 @@ func (s *DataIngestionService) processTrafficData(request *models.IngestionReque
 			trafficData.Path = fmt.Sprintf("%v", path)
 		}
 		if statusCode, exists := data["status_code"]; exists {
-			if sc, ok := statusCode.(int); ok {
+			if sc, ok := intValue(statusCode); ok {
 				trafficData.StatusCode = sc
 			}
 		}
@@ -344,108 +525,395 @@ func (s *DataIngestionService) processTrafficData(request *models.IngestionReque
 		return nil, fmt.Errorf("traffic data validation failed: %w", err)
 	}
 
+	s.decodeTraffic(trafficData)
+
 	return trafficData, nil
 }
 
-func (s *DataIngestionService) validateTrafficData(trafficData *models.TrafficData) error {
-	if trafficData.Timestamp.IsZero() {
-		trafficData.Timestamp = time.Now()
+// decodeTraffic removes content codings and converts charsets so redaction,
+// policies and downstream consumers see plain text. Bodies that fail to decode
+// are kept as captured and the failure is recorded on the record.
+func (s *DataIngestionService) decodeTraffic(trafficData *models.TrafficData) {
+	requestEncoding := headerValue(trafficData.Headers, "Content-Encoding")
+	responseEncoding := headerValue(trafficData.ResponseHeaders, "Content-Encoding")
+	// Records without encoding headers only carry the Encoding and Compressed fields
+	fallback := requestEncoding == "" && responseEncoding == "" && trafficData.Compressed
+
+	requestType := trafficData.ContentType
+	if requestType == "" {
+		requestType = headerValue(trafficData.Headers, "Content-Type")
 	}
+	responseType := headerValue(trafficData.ResponseHeaders, "Content-Type")
 
-	if trafficData.Method == "" {
-		return fmt.Errorf("method is required")
+	requestEncoded := s.decodeBody(trafficData, &trafficData.Body, &trafficData.BodyText, requestEncoding, requestType, fallback, "body")
+	responseEncoded := s.decodeBody(trafficData, &trafficData.ResponseBody, &trafficData.ResponseText, responseEncoding, responseType, fallback, "response_body")
+	trafficData.Compressed = requestEncoded || responseEncoded
+}
+
+// decodeBody decodes one body in place and reports whether it is still encoded
+func (s *DataIngestionService) decodeBody(trafficData *models.TrafficData, body *[]byte, text *string, contentEncoding, contentType string, fallback bool, location string) bool {
+	if len(*body) == 0 {
+		return false
+	}
+	if fallback {
+		contentEncoding = trafficData.Encoding
+		if contentEncoding == "" {
+			contentEncoding = sniffContentEncoding(*body)
+		}
 	}
 
-	if trafficData.URL == "" && trafficData.Path == "" {
-		return fmt.Errorf("either URL or path is required")
+	decoded, err := s.decoder.decode(*body, contentEncoding, contentType)
+	if err != nil {
+		trafficData.DecodeErrors = append(trafficData.DecodeErrors, location+": "+err.Error())
+		if errors.Is(err, errDecodeLimit) {
+			s.logger.Warn("Body exceeds decoding limits, keeping it encoded", "traffic_id", trafficData.ID, "location", location, "error", err)
+		} else {
+			s.logger.Debug("Failed to decode body", "traffic_id", trafficData.ID, "location", location, "error", err)
+		}
+		return len(parseContentEncoding(contentEncoding)) > 0
 	}
 
+	for _, coding := range decoded.Encodings {
+		trafficData.Decoded = append(trafficData.Decoded, location+":"+coding)
+	}
+	if decoded.Charset != "" {
+		trafficData.Decoded = append(trafficData.Decoded, location+":charset:"+decoded.Charset)
+	}
+	*body = decoded.Data
+	*text = decoded.Text
+	return false
+}
+
+// redactTraffic replaces secrets in a processed record before anything else sees it
+func (s *DataIngestionService) redactTraffic(trafficData *models.TrafficData) {
+	s.mutex.RLock()
+	redactor := s.redactor
+	s.mutex.RUnlock()
+
+	if locations := redactor.redact(trafficData); len(locations) > 0 {
+		s.mutex.Lock()
+		s.stats.TotalRedacted++
+		if s.repository != nil {
+			s.rollupLocked(time.Now()).Redacted++
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// updateRedaction replaces the redaction rules
+func (s *DataIngestionService) updateRedaction(update interface{}) error {
+	cfg, ok := update.(config.RedactionConfig)
+	if !ok {
+		data, err := json.Marshal(update)
+		if err != nil {
+			return fmt.Errorf("invalid redaction configuration: %w", err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return fmt.Errorf("invalid redaction configuration: %w", err)
+		}
+	}
+
+	redactor, err := compileRedactor(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.redactor = redactor
+	s.config.Ingestion.Redaction = cfg
+	s.mutex.Unlock()
+
+	s.logger.Info("Redaction rules updated", "enabled", cfg.Enabled)
 	return nil
 }
 
-func (s *DataIngestionService) publishToKafka(ctx context.Context, trafficData *models.TrafficData) error {
-	// Determine topic based on traffic type
-	topic := s.config.Ingestion.Topics.APITraffic
+// parseBodies splits structured request and response bodies into fields so threat,
+// PII and discovery consumers can inspect them individually. It runs after
+// redaction and policies; truncated and unparseable bodies are published as-is.
+func (s *DataIngestionService) parseBodies(ctx context.Context, trafficData *models.TrafficData) {
+	requestType := trafficData.ContentType
+	if requestType == "" {
+		requestType = headerValue(trafficData.Headers, "Content-Type")
+	}
+	responseType := headerValue(trafficData.ResponseHeaders, "Content-Type")
+
+	found := make(map[string]bool)
+	trafficData.BodyFormat, trafficData.BodyFields = s.parseBody(ctx, trafficData, &trafficData.Body, &trafficData.BodyText, trafficData.BodyTruncated, requestType, "body", found)
+	trafficData.ResponseFormat, trafficData.ResponseFields = s.parseBody(ctx, trafficData, &trafficData.ResponseBody, &trafficData.ResponseText, trafficData.ResponseTruncated, responseType, "response_body", found)
+
+	if len(found) == 0 {
+		return
+	}
+	for _, location := range trafficData.Redacted {
+		found[location] = true
+	}
+	trafficData.Redacted = trafficData.Redacted[:0]
+	for location := range found {
+		trafficData.Redacted = append(trafficData.Redacted, location)
+	}
+	sort.Strings(trafficData.Redacted)
+}
+
+// parseBody parses one body into fields. When field redaction hashes a value in
+// a multipart or form body, which redaction cannot reliably rewrite in place, the
+// raw body and text are dropped so the secret is only published hashed.
+func (s *DataIngestionService) parseBody(ctx context.Context, trafficData *models.TrafficData, body *[]byte, text *string, truncated bool, contentType string, location string, found map[string]bool) (string, []models.ParsedField) {
+	if len(*body) == 0 || trafficData.Compressed {
+		return "", nil
+	}
+	format := structuredBodyFormat(contentType, trafficData.Path, *body)
+	if format == "" {
+		return "", nil
+	}
+	if truncated {
+		trafficData.ParseErrors = append(trafficData.ParseErrors, location+": truncated before parsing")
+		return format, nil
+	}
 
-	// Serialize traffic data
-	data, err := json.Marshal(trafficData)
+	parsed, err := s.parserService.ParseData(ctx, *body, format, contentType)
 	if err != nil {
-		return fmt.Errorf("failed to marshal traffic data: %w", err)
+		trafficData.ParseErrors = append(trafficData.ParseErrors, location+": "+err.Error())
+		return format, nil
 	}
 
-	// Publish to Kafka
-	message := kafka.Message{
-		Topic: topic,
-		Key:   []byte(trafficData.ID),
-		Value: data,
+	// Fields of formats redaction cannot rewrite in place may still hold secrets
+	s.mutex.RLock()
+	redactor := s.redactor
+	s.mutex.RUnlock()
+	if redactor.redactFields(parsed.Fields, location, found) && (format == "multipart" || format == "form") {
+		*body = nil
+		*text = ""
+		found[location+":raw"] = true
 	}
+	return format, parsed.Fields
+}
 
-	if err := s.kafkaProducer.Produce(ctx, message); err != nil {
-		return fmt.Errorf("failed to produce message to Kafka: %w", err)
+// intValue reads a whole number decoded from JSON, which arrives as a float64
+// or a json.Number rather than an int
+func intValue(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), v == float64(int(v))
+	case json.Number:
+		n, err := v.Int64()
+		return int(n), err == nil
+	default:
+		return 0, false
 	}
+}
 
-	s.logger.Info("Published traffic data to Kafka", "traffic_id", trafficData.ID, "topic", topic)
-	return nil
+// applyPolicies runs the ingestion policies against a processed record and counts the outcome
+func (s *DataIngestionService) applyPolicies(trafficData *models.TrafficData) policyDecision {
+	s.mutex.RLock()
+	policies := s.policies
+	s.mutex.RUnlock()
+
+	decision := policies.apply(trafficData)
+
+	s.mutex.Lock()
+	var rollup models.IngestionRollup
+	switch {
+	case decision.Reason == policyReasonSampledOut:
+		s.stats.TotalSampledOut++
+		rollup.SampledOut++
+	case decision.Reason == policyReasonDuplicate:
+		s.stats.TotalDeduplicated++
+		rollup.Deduplicated++
+	case decision.Truncated:
+		s.stats.TotalTruncated++
+		rollup.Truncated++
+	}
+	if s.repository != nil {
+		mergeRollup(s.rollupLocked(time.Now()), &rollup)
+	}
+	s.mutex.Unlock()
+
+	return decision
 }
 
-func (s *DataIngestionService) publishBatchToKafka(ctx context.Context, batch *models.BatchTrafficData) error {
-	// Serialize batch data
-	data, err := json.Marshal(batch)
+// updatePolicies replaces the ingestion policies. The new set starts with empty
+// dedup windows.
+func (s *DataIngestionService) updatePolicies(update interface{}) error {
+	configs, ok := update.([]config.PolicyConfig)
+	if !ok {
+		data, err := json.Marshal(update)
+		if err != nil {
+			return fmt.Errorf("invalid policy configuration: %w", err)
+		}
+		if err := json.Unmarshal(data, &configs); err != nil {
+			return fmt.Errorf("invalid policy configuration: %w", err)
+		}
+	}
+
+	policies, err := compileIngestionPolicies(configs)
 	if err != nil {
-		return fmt.Errorf("failed to marshal batch data: %w", err)
+		return err
 	}
 
-	// Publish to Kafka
-	message := kafka.Message{
-		Topic: s.config.Ingestion.Topics.APITraffic,
-		Key:   []byte(batch.ID),
-		Value: data,
+	s.mutex.Lock()
+	s.policies = policies
+	s.config.Ingestion.Policies = configs
+	s.mutex.Unlock()
+
+	s.logger.Info("Ingestion policies updated", "count", len(configs))
+	return nil
+}
+
+func (s *DataIngestionService) validateTrafficData(trafficData *models.TrafficData) error {
+	if trafficData.Timestamp.IsZero() {
+		trafficData.Timestamp = time.Now()
 	}
 
-	if err := s.kafkaProducer.Produce(ctx, message); err != nil {
-		return fmt.Errorf("failed to produce batch message to Kafka: %w", err)
+	if trafficData.Method == "" {
+		return fmt.Errorf("method is required")
+	}
+
+	if trafficData.URL == "" && trafficData.Path == "" {
+		return fmt.Errorf("either URL or path is required")
 	}
 
-	s.logger.Info("Published batch data to Kafka", "batch_id", batch.ID, "count", batch.Count)
 	return nil
 }
 
+// publish hands records to the queue, which spools them while Kafka is unavailable
+func (s *DataIngestionService) publish(ctx context.Context, records []models.TrafficData) error {
+	if s.queue == nil {
+		return fmt.Errorf("traffic queue is not configured")
+	}
+	if err := s.queue.Publish(ctx, records); err != nil {
+		return fmt.Errorf("failed to publish traffic: %w", err)
+	}
+
+	s.logger.Info("Published traffic data", "count", len(records), "topic", s.config.Ingestion.Topics.APITraffic)
+	return nil
+}
+
+// updateStatus tracks a job in memory and persists it once it has finished
 func (s *DataIngestionService) updateStatus(status *models.IngestionStatus) {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
 	s.statusMap[status.ID] = status
+	s.mutex.Unlock()
+
+	if s.repository == nil || status.EndTime == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), persistTimeout)
+	defer cancel()
+	if err := s.repository.SaveStatus(ctx, status); err != nil {
+		s.logger.Error("Failed to persist ingestion status", "error", err, "id", status.ID)
+	}
 }
 
-func (s *DataIngestionService) updateStats(trafficData *models.TrafficData, processingTime time.Duration, errors []string) {
+// updateStats counts records that ended with the same outcome. processingTime is
+// the time spent on the request they came in with, shared between all its records.
+func (s *DataIngestionService) updateStats(outcome string, records int, processingTime time.Duration) {
+	if records <= 0 {
+		return
+	}
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	s.stats.TotalIngested++
-	if len(errors) == 0 {
-		s.stats.TotalParsed++
-		s.stats.TotalNormalized++
-		s.stats.SuccessRate = float64(s.stats.TotalParsed) / float64(s.stats.TotalIngested)
-	} else {
-		s.stats.TotalErrors++
-		s.stats.ErrorRate = float64(s.stats.TotalErrors) / float64(s.stats.TotalIngested)
+	now := time.Now()
+	count := int64(records)
+	s.stats.TotalIngested += count
+	switch outcome {
+	case outcomeSucceeded:
+		s.stats.TotalParsed += count
+		s.stats.TotalNormalized += count
+	case outcomeFailed:
+		s.stats.TotalErrors += count
+		s.stats.LastError = now
+	}
+	s.stats.SuccessRate = float64(s.stats.TotalParsed) / float64(s.stats.TotalIngested)
+	s.stats.ErrorRate = float64(s.stats.TotalErrors) / float64(s.stats.TotalIngested)
+
+	s.stats.AverageProcessingTime = (s.stats.AverageProcessingTime + processingTime/time.Duration(records)) / 2
+	s.stats.LastIngestion = now
+
+	if s.repository != nil {
+		rollup := models.IngestionRollup{
+			Ingested:          count,
+			ProcessingTime:    processingTime,
+			MaxProcessingTime: processingTime / time.Duration(records),
+			LastIngestion:     &now,
+		}
+		switch outcome {
+		case outcomeSucceeded:
+			rollup.Succeeded = count
+		case outcomeFailed:
+			rollup.Errors = count
+			rollup.LastError = &now
+		}
+		mergeRollup(s.rollupLocked(now), &rollup)
 	}
+}
 
-	s.stats.AverageProcessingTime = (s.stats.AverageProcessingTime + processingTime) / 2
-	s.stats.LastIngestion = time.Now()
+// rollupLocked returns the pending rollup for the minute containing t. Callers
+// must hold s.mutex.
+func (s *DataIngestionService) rollupLocked(t time.Time) *models.IngestionRollup {
+	minute := t.UTC().Truncate(time.Minute)
+	rollup, exists := s.rollups[minute]
+	if !exists {
+		rollup = &models.IngestionRollup{Minute: minute}
+		s.rollups[minute] = rollup
+	}
+	return rollup
+}
 
-	if len(errors) > 0 {
-		s.stats.LastError = time.Now()
+// flushRollups writes the pending rollups to the repository, keeping them for
+// the next flush if the write fails
+func (s *DataIngestionService) flushRollups(ctx context.Context) {
+	s.mutex.Lock()
+	pending := s.rollups
+	s.rollups = make(map[time.Time]*models.IngestionRollup)
+	s.mutex.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	rollups := make([]models.IngestionRollup, 0, len(pending))
+	for _, rollup := range pending {
+		rollups = append(rollups, *rollup)
+	}
+	sort.Slice(rollups, func(i, j int) bool { return rollups[i].Minute.Before(rollups[j].Minute) })
+
+	ctx, cancel := context.WithTimeout(ctx, persistTimeout)
+	defer cancel()
+	if err := s.repository.AddRollups(ctx, rollups); err != nil {
+		s.logger.Error("Failed to persist ingestion rollups", "error", err, "minutes", len(rollups))
+		s.mutex.Lock()
+		for minute, rollup := range pending {
+			mergeRollup(s.rollupLocked(minute), rollup)
+		}
+		s.mutex.Unlock()
 	}
 }
 
+// Close stops the background tasks and persists the pending stats rollups
+func (s *DataIngestionService) Close(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	if s.repository != nil {
+		s.flushRollups(ctx)
+	}
+	return nil
+}
+
 func (s *DataIngestionService) startStatsCollector() {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		s.mutex.Lock()
-		// In a real implementation, this would persist stats to database
-		s.mutex.Unlock()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		if s.repository != nil {
+			s.flushRollups(context.Background())
+		}
 	}
 }
 
@@ -453,7 +921,12 @@ func (s *DataIngestionService) startStatusCleanup() {
 	ticker := time.NewTicker(10 * time.Minute)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
 		s.mutex.Lock()
 		cutoff := time.Now().Add(-24 * time.Hour) // Keep status for 24 hours
 		for id, status := range s.statusMap {
@@ -463,4 +936,58 @@ func (s *DataIngestionService) startStatusCleanup() {
 		}
 		s.mutex.Unlock()
 	}
-} 
\ No newline at end of file
+} 
+// mergeRollup adds the counters of src to dst
+func mergeRollup(dst *models.IngestionRollup, src *models.IngestionRollup) {
+	dst.Ingested += src.Ingested
+	dst.Succeeded += src.Succeeded
+	dst.Errors += src.Errors
+	dst.SampledOut += src.SampledOut
+	dst.Deduplicated += src.Deduplicated
+	dst.Truncated += src.Truncated
+	dst.Redacted += src.Redacted
+	dst.ProcessingTime += src.ProcessingTime
+	if src.MaxProcessingTime > dst.MaxProcessingTime {
+		dst.MaxProcessingTime = src.MaxProcessingTime
+	}
+	dst.LastIngestion = laterTime(dst.LastIngestion, src.LastIngestion)
+	dst.LastError = laterTime(dst.LastError, src.LastError)
+}
+
+func laterTime(a, b *time.Time) *time.Time {
+	if a == nil || (b != nil && b.After(*a)) {
+		return b
+	}
+	return a
+}
+
+// statsFromRollups totals per-minute rollups into IngestionStats
+func statsFromRollups(rollups []models.IngestionRollup, timeRange models.TimeRange) *models.IngestionStats {
+	stats := &models.IngestionStats{TimeRange: timeRange, Rollups: rollups}
+
+	var total models.IngestionRollup
+	for i := range rollups {
+		mergeRollup(&total, &rollups[i])
+	}
+
+	stats.TotalIngested = total.Ingested
+	stats.TotalParsed = total.Succeeded
+	stats.TotalNormalized = total.Succeeded
+	stats.TotalErrors = total.Errors
+	stats.TotalSampledOut = total.SampledOut
+	stats.TotalDeduplicated = total.Deduplicated
+	stats.TotalTruncated = total.Truncated
+	stats.TotalRedacted = total.Redacted
+	if total.Ingested > 0 {
+		stats.AverageProcessingTime = total.ProcessingTime / time.Duration(total.Ingested)
+		stats.SuccessRate = float64(total.Succeeded) / float64(total.Ingested)
+		stats.ErrorRate = float64(total.Errors) / float64(total.Ingested)
+	}
+	if total.LastIngestion != nil {
+		stats.LastIngestion = *total.LastIngestion
+	}
+	if total.LastError != nil {
+		stats.LastError = *total.LastError
+	}
+	return stats
+}
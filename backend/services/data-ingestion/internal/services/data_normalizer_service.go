@@ -19,32 +19,35 @@ type DataNormalizerServiceInterface interface {
 }
 
 type DataNormalizerService struct {
-	logger  logging.Logger
-	config  *config.Config
-	schemas map[string]models.SchemaInfo
-	mutex   sync.RWMutex
+	logger     logging.Logger
+	config     *config.Config
+	schemas    map[string]models.SchemaInfo
+	transforms map[string][]compiledTransform
+	mutex      sync.RWMutex
 }
 
 func NewDataNormalizerService(logger logging.Logger, cfg *config.Config) DataNormalizerServiceInterface {
 	service := &DataNormalizerService{
-		logger:  logger,
-		config:  cfg,
-		schemas: make(map[string]models.SchemaInfo),
-	}
-
-	// Initialize with default schema if provided
-	if cfg.Normalizer.DefaultSchema != "" {
-		if schema, ok := cfg.Normalizer.Schemas[cfg.Normalizer.DefaultSchema]; ok {
-			service.schemas[cfg.Normalizer.DefaultSchema] = models.SchemaInfo{
-				Name:        schema.Name,
-				Version:     schema.Version,
-				Fields:      make(map[string]models.FieldInfo),
-				Required:    schema.Required,
-				Validators:  []models.ValidatorInfo{},
-				Description: "",
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			}
+		logger:     logger,
+		config:     cfg,
+		schemas:    make(map[string]models.SchemaInfo),
+		transforms: make(map[string][]compiledTransform),
+	}
+
+	// Built-in gateway log schemas; configured schemas of the same name replace them
+	for _, schema := range builtinSchemas() {
+		if err := service.registerSchema(schema.Name, schema); err != nil {
+			logger.Error("Failed to register built-in schema", "schema", schema.Name, "error", err)
+		}
+	}
+
+	for name, schemaConfig := range cfg.Normalizer.Schemas {
+		schema, err := schemaFromConfig(name, schemaConfig, cfg.Normalizer.Transformers)
+		if err == nil {
+			err = service.registerSchema(name, schema)
+		}
+		if err != nil {
+			logger.Error("Failed to load configured schema", "schema", name, "error", err)
 		}
 	}
 
@@ -54,6 +57,7 @@ func NewDataNormalizerService(logger logging.Logger, cfg *config.Config) DataNor
 func (s *DataNormalizerService) NormalizeData(ctx context.Context, parsed *models.ParsedData, schemaName string) (*models.NormalizedData, error) {
 	s.mutex.RLock()
 	schema, exists := s.schemas[schemaName]
+	transforms := s.transforms[schemaName]
 	s.mutex.RUnlock()
 
 	if !exists {
@@ -77,9 +81,16 @@ func (s *DataNormalizerService) NormalizeData(ctx context.Context, parsed *model
 		CreatedAt:     time.Now(),
 	}
 
-	// Apply field mapping and transformations
+	// Apply transformations to a copy so the parsed data is left untouched
+	document := copyJSONValue(parsedMap).(map[string]interface{})
+	applyTransforms(transforms, document, normalized)
+
+	// Apply field mapping; schemas without declared fields keep the transformed document
+	if len(schema.Fields) == 0 {
+		normalized.Data = document
+	}
 	for field, fieldInfo := range schema.Fields {
-		if value, exists := parsedMap[field]; exists {
+		if value, exists := getPathValue(document, field); exists {
 			normalized.Data[field] = value
 		} else if fieldInfo.Required {
 			normalized.Data[field] = fieldInfo.Default
@@ -117,8 +128,10 @@ func (s *DataNormalizerService) CreateSchema(ctx context.Context, schema models.
 	if _, exists := s.schemas[schema.Name]; exists {
 		return fmt.Errorf("schema already exists: %s", schema.Name)
 	}
-	s.schemas[schema.Name] = schema
-	s.logger.Info("Schema created", "name", schema.Name)
+	if err := s.registerSchemaLocked(schema.Name, schema); err != nil {
+		return err
+	}
+	s.logger.Info("Schema created", "name", schema.Name, "transforms", len(schema.Transforms))
 	return nil
 }
 
@@ -131,7 +144,9 @@ func (s *DataNormalizerService) UpdateConfiguration(ctx context.Context, config
 		if schemas, exists := cfg["schemas"]; exists {
 			if schemaMap, ok := schemas.(map[string]models.SchemaInfo); ok {
 				for name, schema := range schemaMap {
-					s.schemas[name] = schema
+					if err := s.registerSchemaLocked(name, schema); err != nil {
+						s.logger.Error("Rejected schema update", "schema", name, "error", err)
+					}
 				}
 			}
 		}
@@ -159,4 +174,77 @@ func (s *DataNormalizerService) validateNormalizedData(normalized *models.Normal
 	}
 
 	return result
-} 
\ No newline at end of file
+}
+
+func (s *DataNormalizerService) registerSchema(name string, schema models.SchemaInfo) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.registerSchemaLocked(name, schema)
+}
+
+// registerSchemaLocked compiles the schema's transforms and stores both. Callers hold the write lock.
+func (s *DataNormalizerService) registerSchemaLocked(name string, schema models.SchemaInfo) error {
+	if name == "" {
+		return fmt.Errorf("schema name is required")
+	}
+	transforms, err := compileTransforms(schema.Transforms)
+	if err != nil {
+		return fmt.Errorf("invalid transforms for schema %s: %w", name, err)
+	}
+	if schema.Fields == nil {
+		schema.Fields = make(map[string]models.FieldInfo)
+	}
+	s.schemas[name] = schema
+	s.transforms[name] = transforms
+	return nil
+}
+
+// schemaFromConfig builds a SchemaInfo from configuration, resolving transformer references
+func schemaFromConfig(name string, schemaConfig config.SchemaConfig, transformers map[string]config.TransformerConfig) (models.SchemaInfo, error) {
+	schema := models.SchemaInfo{
+		Name:       schemaConfig.Name,
+		Version:    schemaConfig.Version,
+		Fields:     make(map[string]models.FieldInfo, len(schemaConfig.Fields)),
+		Required:   schemaConfig.Required,
+		Validators: []models.ValidatorInfo{},
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if schema.Name == "" {
+		schema.Name = name
+	}
+
+	for field, fieldConfig := range schemaConfig.Fields {
+		schema.Fields[field] = models.FieldInfo{
+			Type:     fieldConfig.Type,
+			Required: fieldConfig.Required,
+			Default:  fieldConfig.Default,
+			Format:   fieldConfig.Format,
+			Pattern:  fieldConfig.Pattern,
+		}
+	}
+	for _, validator := range schemaConfig.Validators {
+		schema.Validators = append(schema.Validators, models.ValidatorInfo{
+			Type:    validator.Type,
+			Config:  validator.Config,
+			Message: validator.Message,
+		})
+	}
+
+	for _, transformerName := range schemaConfig.Transforms {
+		transformer, exists := transformers[transformerName]
+		if !exists {
+			return schema, fmt.Errorf("unknown transformer: %s", transformerName)
+		}
+		if transformer.Name == "" {
+			transformer.Name = transformerName
+		}
+		spec, err := transformSpecFromConfig(transformer)
+		if err != nil {
+			return schema, err
+		}
+		schema.Transforms = append(schema.Transforms, spec)
+	}
+
+	return schema, nil
+}
@@ -10,33 +10,49 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"gopkg.in/yaml.v3"
 	"scopeapi.local/backend/services/data-ingestion/internal/config"
 	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/shared/graphql"
 	"scopeapi.local/backend/shared/logging"
 )
 
 type DataParserServiceInterface interface {
 	ParseData(ctx context.Context, data []byte, format string, contentType string) (*models.ParsedData, error)
+	DecodeBody(ctx context.Context, data []byte, contentEncoding string, contentType string) (*models.DecodedBody, error)
 	GetSupportedFormats(ctx context.Context) ([]models.FormatInfo, error)
 	ValidateFormat(ctx context.Context, data []byte, format string) (*models.ValidationResult, error)
 	UpdateConfiguration(ctx context.Context, config interface{}) error
+	ParseProtobuf(ctx context.Context, data []byte, contentType string, target *models.ProtobufTarget) (*models.ParsedData, error)
+	RegisterDescriptors(ctx context.Context, registration *models.DescriptorRegistration) (*models.DescriptorSetInfo, error)
+	GetDescriptors(ctx context.Context) ([]models.DescriptorSetInfo, error)
 }
 
 type DataParserService struct {
-	logger  logging.Logger
-	config  *config.Config
-	formats map[string]*config.FormatConfig
-	mutex   sync.RWMutex
+	logger        logging.Logger
+	config        *config.Config
+	formats       map[string]*config.FormatConfig
+	protoRegistry *protobufRegistry
+	decoder       *bodyDecoder
+	mutex         sync.RWMutex
 }
 
 func NewDataParserService(logger logging.Logger, cfg *config.Config) DataParserServiceInterface {
 	service := &DataParserService{
-		logger:  logger,
-		config:  cfg,
-		formats: make(map[string]*config.FormatConfig),
+		logger:        logger,
+		config:        cfg,
+		formats:       make(map[string]*config.FormatConfig),
+		protoRegistry: newProtobufRegistry(),
 	}
 
+	decoder, err := newBodyDecoder(cfg.Ingestion.Decoding)
+	if err != nil {
+		logger.Error("Invalid decoding configuration, using default limits", "error", err)
+		decoder, _ = newBodyDecoder(config.DecodingConfig{})
+	}
+	service.decoder = decoder
+
 	// Initialize supported formats
 	service.initializeFormats()
 
@@ -44,6 +60,42 @@ func NewDataParserService(logger logging.Logger, cfg *config.Config) DataParserS
 }
 
 func (s *DataParserService) ParseData(ctx context.Context, data []byte, format string, contentType string) (*models.ParsedData, error) {
+	return s.parseData(ctx, data, format, contentType, nil)
+}
+
+// DecodeBody removes content codings and converts the charset in contentType to
+// UTF-8. Callers run it ahead of ParseData for bodies taken off the wire.
+func (s *DataParserService) DecodeBody(ctx context.Context, data []byte, contentEncoding string, contentType string) (*models.DecodedBody, error) {
+	decoded, err := s.decoder.decode(data, contentEncoding, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode body: %w", err)
+	}
+	return decoded, nil
+}
+
+func (s *DataParserService) ParseProtobuf(ctx context.Context, data []byte, contentType string, target *models.ProtobufTarget) (*models.ParsedData, error) {
+	format := "protobuf"
+	if strings.Contains(contentType, "grpc") {
+		format = "grpc"
+	}
+	return s.parseData(ctx, data, format, contentType, target)
+}
+
+func (s *DataParserService) RegisterDescriptors(ctx context.Context, registration *models.DescriptorRegistration) (*models.DescriptorSetInfo, error) {
+	info, err := s.protoRegistry.register(ctx, registration)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Registered protobuf descriptors", "id", info.ID, "name", info.Name, "service", info.Service, "path_prefix", info.PathPrefix, "messages", len(info.Messages))
+	return info, nil
+}
+
+func (s *DataParserService) GetDescriptors(ctx context.Context) ([]models.DescriptorSetInfo, error) {
+	return s.protoRegistry.list(), nil
+}
+
+func (s *DataParserService) parseData(ctx context.Context, data []byte, format string, contentType string, target *models.ProtobufTarget) (*models.ParsedData, error) {
 	startTime := time.Now()
 	parsedData := &models.ParsedData{
 		ID:            uuid.New().String(),
@@ -67,10 +119,12 @@ func (s *DataParserService) ParseData(ctx context.Context, data []byte, format s
 	// Detect format if not specified
 	if format == "" {
 		format = s.detectFormat(data, contentType)
+		parsedData.Format = format
 	}
 
 	// Parse data based on format
 	var parsed interface{}
+	var fields []models.ParsedField
 	var err error
 
 	switch strings.ToLower(format) {
@@ -80,8 +134,16 @@ func (s *DataParserService) ParseData(ctx context.Context, data []byte, format s
 		parsed, err = s.parseXML(data)
 	case "yaml", "yml":
 		parsed, err = s.parseYAML(data)
-	case "protobuf":
-		parsed, err = s.parseProtobuf(data)
+	case "protobuf", "grpc":
+		parsed, err = s.parseProtobuf(data, strings.ToLower(format), contentType, target, parsedData)
+	case "multipart":
+		parsed, fields, err = parseMultipartForm(data, contentType)
+	case "form":
+		parsed, fields, err = parseFormURLEncoded(data)
+	case "ndjson":
+		parsed, fields, err = parseNDJSON(data)
+	case "graphql":
+		parsed, fields, err = parseGraphQLRequest(data, contentType)
 	default:
 		return nil, fmt.Errorf("unsupported format: %s", format)
 	}
@@ -103,6 +165,16 @@ func (s *DataParserService) ParseData(ctx context.Context, data []byte, format s
 	schema := s.extractSchema(parsed, format)
 	parsedData.Schema = schema
 
+	// Formats without dedicated field extraction expose every leaf value
+	if fields == nil {
+		fields = flattenFields(parsed, "$", "value")
+	}
+	var limited bool
+	parsedData.Fields, limited = limitFields(fields)
+	if limited {
+		parsedData.AddWarning("fields_truncated", fmt.Sprintf("only the first %d fields are reported", maxParsedFields))
+	}
+
 	// Set parsed data
 	parsedData.Parsed = parsed
 	parsedData.ProcessingTime = time.Since(startTime)
@@ -233,7 +305,70 @@ func (s *DataParserService) initializeFormats() {
 		Enabled:    true,
 		Priority:   4,
 		Config: map[string]interface{}{
-			"strict": true,
+			"strict":        true,
+			"wire_fallback": true,
+		},
+	}
+
+	// gRPC length-prefixed protobuf messages
+	s.formats["grpc"] = &config.FormatConfig{
+		Name:       "grpc",
+		Extensions: []string{},
+		MimeTypes:  []string{"application/grpc", "application/grpc+proto"},
+		Enabled:    true,
+		Priority:   5,
+		Config: map[string]interface{}{
+			"strict":        true,
+			"wire_fallback": true,
+		},
+	}
+
+	// Multipart form data; file parts are hashed rather than kept
+	s.formats["multipart"] = &config.FormatConfig{
+		Name:       "multipart",
+		Extensions: []string{},
+		MimeTypes:  []string{"multipart/form-data"},
+		Enabled:    true,
+		Priority:   6,
+		Config: map[string]interface{}{
+			"max_parts":  maxMultipartParts,
+			"hash_files":  "sha256",
+		},
+	}
+
+	// URL-encoded form bodies
+	s.formats["form"] = &config.FormatConfig{
+		Name:       "form",
+		Extensions: []string{},
+		MimeTypes:  []string{"application/x-www-form-urlencoded"},
+		Enabled:    true,
+		Priority:   7,
+		Config:     map[string]interface{}{},
+	}
+
+	// Newline-delimited JSON
+	s.formats["ndjson"] = &config.FormatConfig{
+		Name:       "ndjson",
+		Extensions: []string{".ndjson", ".jsonl"},
+		MimeTypes:  []string{"application/x-ndjson", "application/ndjson", "application/jsonl"},
+		Enabled:    true,
+		Priority:   8,
+		Config: map[string]interface{}{
+			"skip_blank_lines": true,
+		},
+	}
+
+	// GraphQL over HTTP, as JSON requests or bare query documents
+	s.formats["graphql"] = &config.FormatConfig{
+		Name:       "graphql",
+		Extensions: []string{".graphql", ".gql"},
+		MimeTypes:  []string{"application/graphql"},
+		Enabled:    true,
+		Priority:   9,
+		Config: map[string]interface{}{
+			"max_depth":  graphql.MaxDepth,
+			"max_tokens": graphql.MaxTokens,
+			"batching":   true,
 		},
 	}
 }
@@ -241,6 +376,10 @@ func (s *DataParserService) initializeFormats() {
 func (s *DataParserService) detectFormat(data []byte, contentType string) string {
 	// Try to detect format from content type
 	if contentType != "" {
+		// Formats whose media types would otherwise match the generic checks below
+		if format := formatForMediaType(mediaType(contentType)); format != "" {
+			return format
+		}
 		switch {
 		case strings.Contains(contentType, "json"):
 			return "json"
@@ -248,6 +387,8 @@ func (s *DataParserService) detectFormat(data []byte, contentType string) string
 			return "xml"
 		case strings.Contains(contentType, "yaml"):
 			return "yaml"
+		case strings.Contains(contentType, "grpc"):
+			return "grpc"
 		case strings.Contains(contentType, "protobuf"):
 			return "protobuf"
 		}
@@ -295,10 +436,54 @@ func (s *DataParserService) parseYAML(data []byte) (interface{}, error) {
 	return result, nil
 }
 
-func (s *DataParserService) parseProtobuf(data []byte) (interface{}, error) {
-	// This is a simplified implementation
-	// In a real implementation, you would need protobuf schema and proper parsing
-	return nil, fmt.Errorf("protobuf parsing not implemented")
+func (s *DataParserService) parseProtobuf(data []byte, format string, contentType string, target *models.ProtobufTarget, parsedData *models.ParsedData) (interface{}, error) {
+	payloads := [][]byte{data}
+	if format == "grpc" || strings.Contains(contentType, "grpc") || isGRPCFramed(data) {
+		// A bare protobuf message never starts with 0x00 or 0x01 (field number 0
+		// is invalid), so a well-formed frame sequence is unambiguous.
+		frames, err := splitGRPCFrames(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse gRPC framing: %w", err)
+		}
+		payloads = frames
+	}
+
+	var descriptor protoreflect.MessageDescriptor
+	if target != nil {
+		md, err := s.protoRegistry.resolve(target)
+		if err != nil {
+			parsedData.AddWarning("descriptor_not_found", err.Error())
+		} else {
+			descriptor = md
+		}
+	}
+
+	messages := make([]interface{}, 0, len(payloads))
+	for i, payload := range payloads {
+		if descriptor != nil {
+			message, err := decodeProtobufMessage(descriptor, payload)
+			if err == nil {
+				messages = append(messages, message)
+				continue
+			}
+			parsedData.AddWarning("descriptor_mismatch", fmt.Sprintf("message %d: %s", i, err.Error()))
+		}
+
+		message, err := decodeProtobufWire(payload, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse protobuf wire format: %w", err)
+		}
+		messages = append(messages, message)
+	}
+
+	if descriptor == nil {
+		parsedData.AddWarning("schema_less", "decoded without a descriptor; fields are keyed by field number")
+	}
+
+	if len(messages) == 1 {
+		return messages[0], nil
+	}
+	return messages, nil
 }
 
 func (s *DataParserService) validateParsedData(data interface{}, format string) models.ValidationResult {
@@ -325,8 +510,10 @@ func (s *DataParserService) validateParsedData(data interface{}, format string)
 		result = s.validateXML(data)
 	case "yaml":
 		result = s.validateYAML(data)
-	case "protobuf":
+	case "protobuf", "grpc":
 		result = s.validateProtobuf(data)
+	case "ndjson":
+		result = s.validateNDJSON(data)
 	}
 
 	return result
@@ -402,12 +589,58 @@ func (s *DataParserService) validateYAML(data interface{}) models.ValidationResu
 
 func (s *DataParserService) validateProtobuf(data interface{}) models.ValidationResult {
 	result := models.ValidationResult{
-		Valid:  false,
-		Score:  0.0,
-		Errors: []string{"protobuf validation not implemented"},
+		Valid:  true,
+		Score:  1.0,
+		Errors: []string{},
 		Warnings: []string{},
 	}
 
+	// Decoded messages are objects; streams of gRPC messages are arrays of objects
+	switch v := data.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			result.Warnings = append(result.Warnings, "empty protobuf message")
+		}
+	case []interface{}:
+		for _, message := range v {
+			if _, ok := message.(map[string]interface{}); !ok {
+				result.Valid = false
+				result.Score = 0.0
+				result.Errors = append(result.Errors, "invalid protobuf message in stream")
+				break
+			}
+		}
+	default:
+		result.Valid = false
+		result.Score = 0.0
+		result.Errors = append(result.Errors, "invalid protobuf structure")
+	}
+
+	return result
+}
+
+func (s *DataParserService) validateNDJSON(data interface{}) models.ValidationResult {
+	result := models.ValidationResult{
+		Valid:  true,
+		Score:  1.0,
+		Errors: []string{},
+		Warnings: []string{},
+	}
+
+	// Records are usually objects; anything else is legal but unusual
+	records, ok := data.([]interface{})
+	if !ok {
+		result.Valid = false
+		result.Score = 0.0
+		result.Errors = append(result.Errors, "invalid NDJSON structure")
+		return result
+	}
+	for i, record := range records {
+		if _, ok := record.(map[string]interface{}); !ok {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("NDJSON record %d is not an object", i))
+		}
+	}
+
 	return result
 }
 
@@ -425,7 +658,7 @@ func (s *DataParserService) extractSchema(data interface{}, format string) map[s
 		}
 	case string:
 		schema["type"] = "string"
-	case float64:
+	case float64, json.Number:
 		schema["type"] = "number"
 	case bool:
 		schema["type"] = "boolean"
@@ -452,6 +685,11 @@ func (s *DataParserService) getFormatDescription(format string) string {
 		"xml":       "Extensible Markup Language - markup language for data representation",
 		"yaml":      "YAML Ain't Markup Language - human-readable data serialization format",
 		"protobuf":  "Protocol Buffers - language-neutral data serialization format",
+		"grpc":      "gRPC - length-prefixed Protocol Buffers messages",
+		"multipart": "Multipart form data - form fields and file uploads, files reported by hash",
+		"form":      "URL-encoded form data - name/value pairs",
+		"ndjson":    "Newline-delimited JSON - one JSON record per line",
+		"graphql":   "GraphQL over HTTP - query document, operation name and variables",
 	}
 
 	if desc, exists := descriptions[format]; exists {
@@ -0,0 +1,458 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+)
+
+const (
+	defaultDedupMaxEntries = 100000
+	defaultKeepTag         = "flagged"
+
+	policyReasonSampledOut = "sampled_out"
+	policyReasonDuplicate  = "duplicate"
+)
+
+// policyDecision is the outcome of applying the ingestion policies to one record
+type policyDecision struct {
+	Keep      bool
+	Reason    string
+	Policy    string
+	Truncated bool
+}
+
+// ingestionPolicies selects the first matching policy for a record and applies its
+// sampling, deduplication and body limits
+type ingestionPolicies struct {
+	policies []*compiledPolicy
+	mutex    sync.Mutex
+	random   *rand.Rand
+	now      func() time.Time
+}
+
+type compiledPolicy struct {
+	config        config.PolicyConfig
+	hosts         []*regexp.Regexp
+	paths         []*regexp.Regexp
+	statusClasses []statusMatcher
+	keepClasses   []statusMatcher
+	keepTags      map[string]bool
+	rate          float64
+	dedup         map[string]time.Time
+}
+
+// statusMatcher matches an exact status code, or a class when code is a single digit
+type statusMatcher struct {
+	code  int
+	class bool
+}
+
+func compileIngestionPolicies(configs []config.PolicyConfig) (*ingestionPolicies, error) {
+	policies := &ingestionPolicies{
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:    time.Now,
+	}
+
+	for i, cfg := range configs {
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("policy-%d", i+1)
+		}
+		compiled, err := compilePolicy(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", cfg.Name, err)
+		}
+		policies.policies = append(policies.policies, compiled)
+	}
+	return policies, nil
+}
+
+func compilePolicy(cfg config.PolicyConfig) (*compiledPolicy, error) {
+	policy := &compiledPolicy{
+		config:   cfg,
+		rate:     1,
+		keepTags: make(map[string]bool),
+	}
+
+	for _, pattern := range cfg.Hosts {
+		re, err := compileGlob(strings.ToLower(pattern), '.')
+		if err != nil {
+			return nil, err
+		}
+		policy.hosts = append(policy.hosts, re)
+	}
+	for _, pattern := range cfg.Paths {
+		re, err := compileGlob(pattern, '/')
+		if err != nil {
+			return nil, err
+		}
+		policy.paths = append(policy.paths, re)
+	}
+
+	var err error
+	if policy.statusClasses, err = parseStatusMatchers(cfg.StatusClasses); err != nil {
+		return nil, err
+	}
+	if policy.keepClasses, err = parseStatusMatchers(cfg.Sampling.KeepStatusClasses); err != nil {
+		return nil, err
+	}
+
+	if cfg.Sampling.Rate != nil {
+		rate := *cfg.Sampling.Rate
+		if rate < 0 || rate > 1 || math.IsNaN(rate) {
+			return nil, fmt.Errorf("sample rate must be between 0 and 1, got %v", rate)
+		}
+		policy.rate = rate
+	}
+
+	tags := cfg.Sampling.KeepTags
+	if len(tags) == 0 {
+		tags = []string{defaultKeepTag}
+	}
+	for _, tag := range tags {
+		policy.keepTags[strings.ToLower(tag)] = true
+	}
+
+	if cfg.Dedup.Window < 0 {
+		return nil, fmt.Errorf("dedup window must not be negative")
+	}
+	if cfg.Dedup.Window > 0 {
+		if policy.config.Dedup.MaxEntries <= 0 {
+			policy.config.Dedup.MaxEntries = defaultDedupMaxEntries
+		}
+		policy.dedup = make(map[string]time.Time)
+	}
+	if cfg.Body.MaxBytes < 0 {
+		return nil, fmt.Errorf("body max_bytes must not be negative")
+	}
+
+	return policy, nil
+}
+
+// apply decides whether data is kept and, if so, stamps its sample rate and
+// applies the body limits of the matching policy
+func (p *ingestionPolicies) apply(data *models.TrafficData) policyDecision {
+	data.SampleRate = 1
+
+	policy := p.match(data)
+	if policy == nil {
+		return policyDecision{Keep: true}
+	}
+	decision := policyDecision{Keep: true, Policy: policy.config.Name}
+	data.Policy = policy.config.Name
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// Sample first so duplicates of dropped records are not themselves dropped
+	if !policy.alwaysKeep(data) {
+		if !p.sampled(policy, data) {
+			decision.Keep = false
+			decision.Reason = policyReasonSampledOut
+			return decision
+		}
+		data.SampleRate = policy.rate
+	}
+
+	if policy.dedup != nil {
+		now := p.now()
+		key := dedupKey(data, policy.config.Dedup.IncludeResponse)
+		if expires, seen := policy.dedup[key]; seen && now.Before(expires) {
+			decision.Keep = false
+			decision.Reason = policyReasonDuplicate
+			return decision
+		}
+		policy.remember(key, now)
+	}
+
+	decision.Truncated = applyBodyLimits(data, policy.config.Body)
+	return decision
+}
+
+func (p *ingestionPolicies) match(data *models.TrafficData) *compiledPolicy {
+	if len(p.policies) == 0 {
+		return nil
+	}
+	host, path := trafficHostAndPath(data)
+	for _, policy := range p.policies {
+		if policy.matches(host, path, data.StatusCode) {
+			return policy
+		}
+	}
+	return nil
+}
+
+func (p *ingestionPolicies) sampled(policy *compiledPolicy, data *models.TrafficData) bool {
+	switch {
+	case policy.rate >= 1:
+		return true
+	case policy.rate <= 0:
+		return false
+	}
+
+	// Hashing a correlation header keeps or drops every record of a trace together
+	if header := policy.config.Sampling.HashHeader; header != "" {
+		if value := headerValue(data.Headers, header); value != "" {
+			h := fnv.New64a()
+			h.Write([]byte(value))
+			return float64(h.Sum64())/float64(math.MaxUint64) < policy.rate
+		}
+	}
+	return p.random.Float64() < policy.rate
+}
+
+func (c *compiledPolicy) matches(host, path string, statusCode int) bool {
+	if len(c.hosts) > 0 && !anyGlobMatches(c.hosts, host) {
+		return false
+	}
+	if len(c.paths) > 0 && !anyGlobMatches(c.paths, path) {
+		return false
+	}
+	if len(c.statusClasses) > 0 && !statusMatches(c.statusClasses, statusCode) {
+		return false
+	}
+	return true
+}
+
+// alwaysKeep reports whether data bypasses sampling: errors, slow requests,
+// kept status classes and flagged requests
+func (c *compiledPolicy) alwaysKeep(data *models.TrafficData) bool {
+	sampling := c.config.Sampling
+	if sampling.KeepErrors && (data.StatusCode == 0 || data.StatusCode >= 500) {
+		return true
+	}
+	if len(c.keepClasses) > 0 && statusMatches(c.keepClasses, data.StatusCode) {
+		return true
+	}
+	if sampling.SlowerThan > 0 && data.Duration >= sampling.SlowerThan {
+		return true
+	}
+	for _, tag := range data.Tags {
+		if c.keepTags[strings.ToLower(tag)] {
+			return true
+		}
+	}
+	if flagged, ok := data.Metadata[defaultKeepTag].(bool); ok && flagged {
+		return true
+	}
+	return false
+}
+
+// remember records key until the dedup window passes, evicting expired entries
+// and then the oldest ones once the table is full
+func (c *compiledPolicy) remember(key string, now time.Time) {
+	if len(c.dedup) >= c.config.Dedup.MaxEntries {
+		for k, expires := range c.dedup {
+			if !now.Before(expires) {
+				delete(c.dedup, k)
+			}
+		}
+	}
+	if len(c.dedup) >= c.config.Dedup.MaxEntries {
+		type entry struct {
+			key     string
+			expires time.Time
+		}
+		entries := make([]entry, 0, len(c.dedup))
+		for k, expires := range c.dedup {
+			entries = append(entries, entry{k, expires})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].expires.Before(entries[j].expires) })
+		for _, e := range entries[:len(entries)-c.config.Dedup.MaxEntries+1] {
+			delete(c.dedup, e.key)
+		}
+	}
+	c.dedup[key] = now.Add(c.config.Dedup.Window)
+}
+
+// dedupKey hashes the parts of a record that identify a repeated request
+func dedupKey(data *models.TrafficData, includeResponse bool) string {
+	host, path := trafficHostAndPath(data)
+	h := sha256.New()
+	writeField := func(value []byte) {
+		h.Write([]byte(strconv.Itoa(len(value))))
+		h.Write([]byte{':'})
+		h.Write(value)
+	}
+
+	writeField([]byte(strings.ToUpper(data.Method)))
+	writeField([]byte(host))
+	writeField([]byte(path))
+	for _, key := range sortedStringKeys(data.QueryParams) {
+		writeField([]byte(key))
+		writeField([]byte(data.QueryParams[key]))
+	}
+	writeField(trafficBody(data.Body, data.BodyText))
+	if includeResponse {
+		writeField([]byte(strconv.Itoa(data.StatusCode)))
+		writeField(trafficBody(data.ResponseBody, data.ResponseText))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// applyBodyLimits truncates, hashes or drops the request and response bodies
+func applyBodyLimits(data *models.TrafficData, limits config.BodyLimitConfig) bool {
+	if limits.MaxBytes <= 0 && !limits.Hash && !limits.Drop {
+		return false
+	}
+
+	requestHash, requestTruncated := limitBody(&data.Body, &data.BodyText, limits)
+	responseHash, responseTruncated := limitBody(&data.ResponseBody, &data.ResponseText, limits)
+	data.BodyHash, data.BodyTruncated = requestHash, requestTruncated
+	data.ResponseHash, data.ResponseTruncated = responseHash, responseTruncated
+	return requestTruncated || responseTruncated
+}
+
+func limitBody(body *[]byte, text *string, limits config.BodyLimitConfig) (string, bool) {
+	original := trafficBody(*body, *text)
+	if len(original) == 0 {
+		return "", false
+	}
+
+	var hash string
+	if limits.Hash {
+		sum := sha256.Sum256(original)
+		hash = hex.EncodeToString(sum[:])
+	}
+
+	if limits.Drop {
+		*body, *text = nil, ""
+		return hash, true
+	}
+	if limits.MaxBytes <= 0 {
+		return hash, false
+	}
+
+	truncated := false
+	if len(*body) > limits.MaxBytes {
+		*body = (*body)[:limits.MaxBytes:limits.MaxBytes]
+		truncated = true
+	}
+	if len(*text) > limits.MaxBytes {
+		cut := limits.MaxBytes
+		for cut > 0 && !utf8.RuneStart((*text)[cut]) {
+			cut--
+		}
+		*text = (*text)[:cut]
+		truncated = true
+	}
+	return hash, truncated
+}
+
+// Helper functions
+
+// compileGlob turns a glob into an anchored regexp. * and ? do not cross sep, ** does.
+func compileGlob(pattern string, sep byte) (*regexp.Regexp, error) {
+	notSep := "[^" + regexp.QuoteMeta(string(sep)) + "]"
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString(notSep + "*")
+			}
+		case '?':
+			b.WriteString(notSep)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+func anyGlobMatches(globs []*regexp.Regexp, value string) bool {
+	for _, glob := range globs {
+		if glob.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseStatusMatchers(values []string) ([]statusMatcher, error) {
+	matchers := make([]statusMatcher, 0, len(values))
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if len(value) == 3 && strings.HasSuffix(value, "xx") && value[0] >= '1' && value[0] <= '5' {
+			matchers = append(matchers, statusMatcher{code: int(value[0] - '0'), class: true})
+			continue
+		}
+		code, err := strconv.Atoi(value)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status class %q", value)
+		}
+		matchers = append(matchers, statusMatcher{code: code})
+	}
+	return matchers, nil
+}
+
+func statusMatches(matchers []statusMatcher, statusCode int) bool {
+	for _, m := range matchers {
+		if (m.class && statusCode/100 == m.code) || (!m.class && statusCode == m.code) {
+			return true
+		}
+	}
+	return false
+}
+
+// trafficHostAndPath returns the lower-cased host without port and the request path
+func trafficHostAndPath(data *models.TrafficData) (string, string) {
+	host := headerValue(data.Headers, "Host")
+	path := data.Path
+	if parsed, err := url.Parse(data.URL); err == nil {
+		if host == "" {
+			host = parsed.Host
+		}
+		if path == "" {
+			path = parsed.Path
+		}
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	return strings.ToLower(host), path
+}
+
+func trafficBody(body []byte, text string) []byte {
+	if len(body) > 0 {
+		return body
+	}
+	return []byte(text)
+}
+
+func sortedStringKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+func policyRate(rate float64) *float64 {
+	return &rate
+}
+
+func TestIngestionPolicySelection(t *testing.T) {
+	policies, err := compileIngestionPolicies([]config.PolicyConfig{
+		{Name: "health", Paths: []string{"/health*"}, Sampling: config.SamplingConfig{Rate: policyRate(0)}},
+		{Name: "api", Hosts: []string{"**.example.com"}, Paths: []string{"/api/**"}, StatusClasses: []string{"2xx"}},
+	})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	cases := []struct {
+		data   models.TrafficData
+		policy string
+	}{
+		{models.TrafficData{Path: "/healthz", StatusCode: 200}, "health"},
+		{models.TrafficData{Path: "/health/deep", StatusCode: 200}, ""},
+		{models.TrafficData{URL: "https://shop.example.com:8443/api/v1/orders?id=1", StatusCode: 201}, "api"},
+		{models.TrafficData{URL: "https://shop.example.com/api/v1/orders", StatusCode: 404}, ""},
+		{models.TrafficData{URL: "https://example.org/api/v1", StatusCode: 200}, ""},
+	}
+	for _, tc := range cases {
+		got := ""
+		if policy := policies.match(&tc.data); policy != nil {
+			got = policy.config.Name
+		}
+		if got != tc.policy {
+			t.Errorf("%s%s %d: matched %q, want %q", tc.data.URL, tc.data.Path, tc.data.StatusCode, got, tc.policy)
+		}
+	}
+}
+
+func TestIngestionPolicySamplingKeepsErrorsAndFlagged(t *testing.T) {
+	policies, err := compileIngestionPolicies([]config.PolicyConfig{{
+		Name: "sampled",
+		Sampling: config.SamplingConfig{
+			Rate:       policyRate(0),
+			KeepErrors: true,
+			SlowerThan: time.Second,
+		},
+	}})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		data models.TrafficData
+		keep bool
+	}{
+		{"ok", models.TrafficData{Path: "/a", StatusCode: 200}, false},
+		{"server error", models.TrafficData{Path: "/a", StatusCode: 503}, true},
+		{"no response", models.TrafficData{Path: "/a"}, true},
+		{"slow", models.TrafficData{Path: "/a", StatusCode: 200, Duration: 2 * time.Second}, true},
+		{"flagged tag", models.TrafficData{Path: "/a", StatusCode: 200, Tags: []string{"Flagged"}}, true},
+		{"flagged metadata", models.TrafficData{Path: "/a", StatusCode: 200, Metadata: map[string]interface{}{"flagged": true}}, true},
+	}
+	for _, tc := range cases {
+		decision := policies.apply(&tc.data)
+		if decision.Keep != tc.keep {
+			t.Errorf("%s: keep = %v, want %v", tc.name, decision.Keep, tc.keep)
+		}
+		if tc.keep && tc.data.SampleRate != 1 {
+			t.Errorf("%s: sample rate = %v, want 1 for records kept regardless of rate", tc.name, tc.data.SampleRate)
+		}
+		if !tc.keep && decision.Reason != policyReasonSampledOut {
+			t.Errorf("%s: reason = %q", tc.name, decision.Reason)
+		}
+	}
+}
+
+func TestIngestionPolicyAppliesToDecodedRequests(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Ingestion.Policies = []config.PolicyConfig{{
+		Name:          "sampled",
+		StatusClasses: []string{"2xx", "5xx"},
+		Sampling:      config.SamplingConfig{Rate: policyRate(0), KeepErrors: true},
+	}}
+	logger := logging.NewStructuredLogger("test")
+	service := NewDataIngestionService(nil, nil, NewDataParserService(logger, cfg), logger, cfg).(*DataIngestionService)
+	defer service.Close(context.Background())
+
+	cases := []struct {
+		body      string
+		useNumber bool
+		keep      bool
+	}{
+		{`{"method": "GET", "path": "/a", "status_code": 200}`, false, false},
+		{`{"method": "GET", "path": "/a", "status_code": 200}`, true, false},
+		{`{"method": "GET", "path": "/a", "status_code": 503}`, false, true},
+		{`{"method": "GET", "path": "/a", "status_code": 503}`, true, true},
+	}
+	for _, tc := range cases {
+		decoder := json.NewDecoder(strings.NewReader(tc.body))
+		if tc.useNumber {
+			decoder.UseNumber()
+		}
+		var data map[string]interface{}
+		if err := decoder.Decode(&data); err != nil {
+			t.Fatal(err)
+		}
+
+		record, err := service.processTrafficData(&models.IngestionRequest{Data: data})
+		if err != nil {
+			t.Fatalf("processTrafficData(%s): %v", tc.body, err)
+		}
+		decision := service.applyPolicies(record)
+		if decision.Keep != tc.keep || decision.Policy != "sampled" {
+			t.Errorf("%s (use number %v): status %d kept %v by policy %q, want kept %v by sampled",
+				tc.body, tc.useNumber, record.StatusCode, decision.Keep, decision.Policy, tc.keep)
+		}
+	}
+}
+
+func TestIngestionPolicySampleRateIsDeterministicByHeader(t *testing.T) {
+	policies, err := compileIngestionPolicies([]config.PolicyConfig{{
+		Sampling: config.SamplingConfig{Rate: policyRate(0.5), HashHeader: "X-Request-Id"},
+	}})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		id := strings.Repeat("x", i%7) + time.Duration(i).String()
+		first := models.TrafficData{Path: "/a", StatusCode: 200, Headers: map[string]string{"x-request-id": id}}
+		second := first
+		a, b := policies.apply(&first), policies.apply(&second)
+		if a.Keep != b.Keep {
+			t.Fatalf("request %s sampled inconsistently", id)
+		}
+		if a.Keep {
+			kept++
+			if first.SampleRate != 0.5 {
+				t.Fatalf("sample rate = %v, want 0.5", first.SampleRate)
+			}
+		}
+	}
+	if kept < 400 || kept > 600 {
+		t.Errorf("kept %d of 1000 at rate 0.5", kept)
+	}
+}
+
+func TestIngestionPolicyDedupWindow(t *testing.T) {
+	policies, err := compileIngestionPolicies([]config.PolicyConfig{{
+		Dedup: config.DedupConfig{Window: time.Minute, MaxEntries: 2},
+	}})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	policies.now = func() time.Time { return now }
+
+	record := func(body string) *models.TrafficData {
+		return &models.TrafficData{Method: "POST", Path: "/orders", Body: []byte(body), QueryParams: map[string]string{"a": "1"}}
+	}
+
+	if !policies.apply(record("one")).Keep {
+		t.Fatal("first record dropped")
+	}
+	if decision := policies.apply(record("one")); decision.Keep || decision.Reason != policyReasonDuplicate {
+		t.Fatalf("duplicate kept: %+v", decision)
+	}
+	if !policies.apply(record("two")).Keep {
+		t.Fatal("different body treated as duplicate")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if !policies.apply(record("one")).Keep {
+		t.Fatal("record dropped after the window passed")
+	}
+	if entries := len(policies.policies[0].dedup); entries > 2 {
+		t.Errorf("dedup table has %d entries, limit is 2", entries)
+	}
+}
+
+func TestIngestionPolicyBodyLimits(t *testing.T) {
+	policies, err := compileIngestionPolicies([]config.PolicyConfig{{
+		Body: config.BodyLimitConfig{MaxBytes: 4, Hash: true},
+	}})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	data := &models.TrafficData{
+		Path:         "/a",
+		Body:         []byte("abcdefgh"),
+		BodyText:     "abcdefgh",
+		ResponseText: "hééé",
+	}
+	decision := policies.apply(data)
+	if !decision.Keep || !decision.Truncated {
+		t.Fatalf("decision = %+v", decision)
+	}
+	if string(data.Body) != "abcd" || data.BodyText != "abcd" || !data.BodyTruncated {
+		t.Errorf("request body = %q / %q", data.Body, data.BodyText)
+	}
+	// The second é spans bytes 3 and 4, so the cut falls before it
+	if data.ResponseText != "hé" || !data.ResponseTruncated {
+		t.Errorf("response text = %q", data.ResponseText)
+	}
+	if data.BodyHash != "9c56cc51b374c3ba189210d5b6d4bf57790d351c96c47c02190ecf1e430635ab" {
+		t.Errorf("body hash = %s", data.BodyHash)
+	}
+}
+
+func TestIngestionPolicyRejectsInvalidConfig(t *testing.T) {
+	invalid := []config.PolicyConfig{
+		{Sampling: config.SamplingConfig{Rate: policyRate(1.5)}},
+		{StatusClasses: []string{"6xx"}},
+		{Sampling: config.SamplingConfig{KeepStatusClasses: []string{"abc"}}},
+		{Dedup: config.DedupConfig{Window: -time.Second}},
+	}
+	for _, cfg := range invalid {
+		if _, err := compileIngestionPolicies([]config.PolicyConfig{cfg}); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+}
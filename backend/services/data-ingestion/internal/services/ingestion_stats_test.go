@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+// memoryIngestionRepository keeps what the service persists
+type memoryIngestionRepository struct {
+	mutex    sync.Mutex
+	statuses map[string]models.IngestionStatus
+	rollups  map[time.Time]models.IngestionRollup
+	failAdd  bool
+}
+
+func newMemoryIngestionRepository() *memoryIngestionRepository {
+	return &memoryIngestionRepository{
+		statuses: make(map[string]models.IngestionStatus),
+		rollups:  make(map[time.Time]models.IngestionRollup),
+	}
+}
+
+func (r *memoryIngestionRepository) SaveStatus(ctx context.Context, status *models.IngestionStatus) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.statuses[status.ID] = *status
+	return nil
+}
+
+func (r *memoryIngestionRepository) GetStatus(ctx context.Context, id string) (*models.IngestionStatus, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	status, exists := r.statuses[id]
+	if !exists {
+		return nil, nil
+	}
+	return &status, nil
+}
+
+func (r *memoryIngestionRepository) AddRollups(ctx context.Context, rollups []models.IngestionRollup) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.failAdd {
+		return errors.New("database unavailable")
+	}
+	for _, rollup := range rollups {
+		stored := r.rollups[rollup.Minute]
+		stored.Minute = rollup.Minute
+		mergeRollup(&stored, &rollup)
+		r.rollups[rollup.Minute] = stored
+	}
+	return nil
+}
+
+func (r *memoryIngestionRepository) GetRollups(ctx context.Context, start, end time.Time) ([]models.IngestionRollup, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var rollups []models.IngestionRollup
+	for minute, rollup := range r.rollups {
+		if !minute.Before(start) && minute.Before(end) {
+			rollups = append(rollups, rollup)
+		}
+	}
+	return rollups, nil
+}
+
+func newTestIngestionService(repo *memoryIngestionRepository) *DataIngestionService {
+	cfg := &config.Config{}
+	logger := logging.NewStructuredLogger("test")
+	return NewDataIngestionService(nil, repo, NewDataParserService(logger, cfg), logger, cfg).(*DataIngestionService)
+}
+
+func TestIngestionStatusIsPersistedAndReloaded(t *testing.T) {
+	repo := newMemoryIngestionRepository()
+	service := newTestIngestionService(repo)
+	ctx := context.Background()
+
+	response, _ := service.IngestBatch(ctx, &models.BatchTrafficData{
+		ID:    "batch-1",
+		Count: 2,
+		Data: []models.TrafficData{
+			{Method: "GET", Path: "/a"},
+			{Path: "/missing-method"},
+		},
+	})
+
+	stored, err := repo.GetStatus(ctx, response.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("job was not persisted: %v", err)
+	}
+	if stored.Kind != "batch" || stored.FailedItems != 1 || len(stored.Batches) != 1 {
+		t.Fatalf("stored job = %+v", stored)
+	}
+	// Without a Kafka producer the publish fails and the batch records it
+	if batch := stored.Batches[0]; batch.BatchID != "batch-1" || batch.Status != "failed" || batch.Error == "" {
+		t.Errorf("stored batch = %+v", batch)
+	}
+
+	// A restarted service finds the job in the repository
+	restarted := newTestIngestionService(repo)
+	status, err := restarted.GetIngestionStatus(ctx, response.ID)
+	if err != nil || status.ID != response.ID {
+		t.Fatalf("reloaded status = %+v, %v", status, err)
+	}
+	if _, err := restarted.GetIngestionStatus(ctx, "unknown"); err == nil {
+		t.Error("expected an error for an unknown job")
+	}
+}
+
+func TestIngestionStatsAnswerFromRollups(t *testing.T) {
+	repo := newMemoryIngestionRepository()
+	service := newTestIngestionService(repo)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	earlier := now.Truncate(time.Minute).Add(-30 * time.Minute)
+	lastIngestion := earlier.Add(10 * time.Second)
+	repo.rollups[earlier] = models.IngestionRollup{
+		Minute:         earlier,
+		Ingested:       4,
+		Succeeded:      3,
+		Errors:         1,
+		ProcessingTime: 40 * time.Millisecond,
+		LastIngestion:  &lastIngestion,
+	}
+	old := now.Truncate(time.Minute).Add(-48 * time.Hour)
+	repo.rollups[old] = models.IngestionRollup{Minute: old, Ingested: 100}
+
+	// Pending, unflushed counters for the current minute are included too
+	service.updateStats(outcomeSucceeded, 1, 20*time.Millisecond)
+
+	stats, err := service.GetIngestionStats(ctx, &models.TimeRange{Start: now.Add(-time.Hour), End: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.TotalIngested != 5 || stats.TotalParsed != 4 || stats.TotalErrors != 1 {
+		t.Errorf("totals = ingested %d parsed %d errors %d", stats.TotalIngested, stats.TotalParsed, stats.TotalErrors)
+	}
+	if stats.AverageProcessingTime != 12*time.Millisecond {
+		t.Errorf("average processing time = %v", stats.AverageProcessingTime)
+	}
+	if len(stats.Rollups) != 2 || !stats.Rollups[0].Minute.Equal(earlier) {
+		t.Errorf("rollups = %+v", stats.Rollups)
+	}
+
+	// Flushing moves the pending minute into the repository without double counting
+	service.flushRollups(ctx)
+	flushed, _ := service.GetIngestionStats(ctx, &models.TimeRange{Start: now.Add(-time.Hour), End: now.Add(time.Minute)})
+	if flushed.TotalIngested != 5 {
+		t.Errorf("after flush ingested = %d, want 5", flushed.TotalIngested)
+	}
+}
+
+func TestIngestionRollupsSurviveFailedFlush(t *testing.T) {
+	repo := newMemoryIngestionRepository()
+	repo.failAdd = true
+	service := newTestIngestionService(repo)
+	ctx := context.Background()
+
+	service.updateStats(outcomeSucceeded, 1, time.Millisecond)
+	service.flushRollups(ctx)
+	service.updateStats(outcomeFailed, 1, time.Millisecond)
+
+	repo.failAdd = false
+	service.flushRollups(ctx)
+
+	var total models.IngestionRollup
+	for _, rollup := range repo.rollups {
+		mergeRollup(&total, &rollup)
+	}
+	if total.Ingested != 2 || total.Errors != 1 || total.LastError == nil {
+		t.Errorf("persisted rollups = %+v", total)
+	}
+}
+
+func TestIngestionStatsCountEachRecordByOutcome(t *testing.T) {
+	repo := newMemoryIngestionRepository()
+	cfg := &config.Config{}
+	cfg.Ingestion.Policies = []config.PolicyConfig{
+		{Name: "health", Paths: []string{"/health*"}, Sampling: config.SamplingConfig{Rate: policyRate(0)}},
+	}
+	logger := logging.NewStructuredLogger("test")
+	service := NewDataIngestionService(nil, repo, NewDataParserService(logger, cfg), logger, cfg).(*DataIngestionService)
+	ctx := context.Background()
+
+	// Without a queue the kept record fails to publish
+	service.IngestBatch(ctx, &models.BatchTrafficData{
+		ID:    "batch-1",
+		Count: 3,
+		Data: []models.TrafficData{
+			{Method: "GET", Path: "/users"},
+			{Method: "GET", Path: "/health"},
+			{Path: "/missing-method"},
+		},
+	})
+
+	stats, err := service.GetIngestionStats(ctx, nil)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.TotalIngested != 3 || stats.TotalParsed != 0 || stats.TotalErrors != 2 || stats.TotalSampledOut != 1 {
+		t.Errorf("totals = ingested %d parsed %d errors %d sampled out %d",
+			stats.TotalIngested, stats.TotalParsed, stats.TotalErrors, stats.TotalSampledOut)
+	}
+
+	// Close persists what the minute ticker has not flushed yet
+	if err := service.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	var total models.IngestionRollup
+	for _, rollup := range repo.rollups {
+		mergeRollup(&total, &rollup)
+	}
+	if total.Ingested != 3 || total.Errors != 2 || total.SampledOut != 1 {
+		t.Errorf("persisted rollups = %+v", total)
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"time"
+
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+)
+
+// Canonical fields produced by the built-in gateway log schemas:
+//
+//	timestamp, method, url, host, path, protocol, status_code, source_ip,
+//	forwarded_for, user_agent, referer, request_id, request_headers, response_headers,
+//	request_size, response_size, duration_ms, upstream, service, route
+var canonicalTrafficRequired = []string{"timestamp", "method", "status_code"}
+
+// canonicalTrafficTransforms finish every built-in schema once fields have been renamed
+var canonicalTrafficTransforms = []models.TransformSpec{
+	{Type: transformTimestamp, Field: "timestamp"},
+	{Type: transformCoerce, Field: "status_code", To: "int"},
+	{Type: transformCoerce, Field: "request_size", To: "int"},
+	{Type: transformCoerce, Field: "response_size", To: "int"},
+	{Type: transformCoerce, Field: "duration_ms", To: "float"},
+	{Type: transformCanonicalizeHeaders, Field: "request_headers"},
+	{Type: transformCanonicalizeHeaders, Field: "response_headers"},
+	{Type: transformNormalizeIP, Field: "source_ip"},
+	{Type: transformNormalizeIP, Field: "forwarded_for"},
+	{Type: transformNormalizeURL, Field: "url"},
+	{Type: transformNormalizeURL, Field: "path"},
+}
+
+func renameTransforms(pairs ...string) []models.TransformSpec {
+	transforms := make([]models.TransformSpec, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		transforms = append(transforms, models.TransformSpec{Type: transformRename, Field: pairs[i], Target: pairs[i+1]})
+	}
+	return transforms
+}
+
+func gatewaySchema(name, description string, transforms ...[]models.TransformSpec) models.SchemaInfo {
+	var all []models.TransformSpec
+	for _, group := range transforms {
+		all = append(all, group...)
+	}
+	all = append(all, canonicalTrafficTransforms...)
+
+	now := time.Now()
+	return models.SchemaInfo{
+		Name:        name,
+		Version:     "1.0",
+		Description: description,
+		Fields:      map[string]models.FieldInfo{},
+		Required:    canonicalTrafficRequired,
+		Validators:  []models.ValidatorInfo{},
+		Transforms:  all,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// builtinSchemas maps Kong, Envoy and NGINX JSON access logs onto the canonical traffic shape
+func builtinSchemas() []models.SchemaInfo {
+	kong := gatewaySchema("kong", "Kong http-log / file-log plugin entries",
+		[]models.TransformSpec{
+			// Pull single headers out before the header map is moved
+			{Type: transformDerive, Path: "$.request.headers['user-agent']", Target: "user_agent"},
+			{Type: transformDerive, Path: "$.request.headers.host", Target: "host"},
+			{Type: transformDerive, Path: "$.request.headers['x-forwarded-for']", Target: "forwarded_for"},
+			{Type: transformDerive, Path: "$.request.id", Target: "request_id"},
+			{Type: transformDerive, Path: "$.service.name", Target: "service"},
+			{Type: transformDerive, Path: "$.route.name", Target: "route"},
+			{Type: transformDerive, Path: "$.tries[-1].ip", Target: "upstream"},
+		},
+		renameTransforms(
+			"request.method", "method",
+			"request.url", "url",
+			"request.uri", "path",
+			"request.headers", "request_headers",
+			"request.size", "request_size",
+			"response.status", "status_code",
+			"response.headers", "response_headers",
+			"response.size", "response_size",
+			"latencies.request", "duration_ms",
+			"client_ip", "source_ip",
+			"started_at", "timestamp",
+		),
+		[]models.TransformSpec{
+			{Type: transformDrop, Fields: []string{"request", "response", "latencies", "tries", "service", "route", "consumer", "authenticated_entity", "workspace", "workspace_name", "upstream_uri", "upstream_status"}},
+		},
+	)
+
+	envoy := gatewaySchema("envoy", "Envoy JSON access log with default command operators",
+		renameTransforms(
+			"start_time", "timestamp",
+			"response_code", "status_code",
+			"bytes_received", "request_size",
+			"bytes_sent", "response_size",
+			"duration", "duration_ms",
+			"x_forwarded_for", "forwarded_for",
+			"downstream_remote_address", "source_ip",
+			"authority", "host",
+			"upstream_host", "upstream",
+			"upstream_cluster", "service",
+			"route_name", "route",
+		),
+		[]models.TransformSpec{
+			{Type: transformDrop, Fields: []string{"response_flags", "upstream_service_time", "upstream_transport_failure_reason", "connection_termination_details", "downstream_local_address", "upstream_local_address", "requested_server_name"}},
+		},
+	)
+
+	nginx := gatewaySchema("nginx", "NGINX log_format escape=json access log",
+		renameTransforms(
+			"time_local", "timestamp",
+			"time_iso8601", "timestamp",
+			"request_method", "method",
+			"request_uri", "path",
+			"server_protocol", "protocol",
+			"status", "status_code",
+			"request_length", "request_size",
+			"body_bytes_sent", "response_size",
+			"http_user_agent", "user_agent",
+			"http_x_forwarded_for", "forwarded_for",
+			"http_host", "host",
+			"remote_addr", "source_ip",
+			"http_referer", "referer",
+			"upstream_addr", "upstream",
+		),
+		[]models.TransformSpec{
+			// request_time is in seconds with millisecond resolution
+			{Type: transformCoerce, Field: "request_time", Target: "duration_ms", To: "float", Scale: 1000},
+			{Type: transformDrop, Fields: []string{"request_time", "msec", "upstream_response_time", "upstream_connect_time", "bytes_sent", "remote_user", "request"}},
+		},
+	)
+
+	return []models.SchemaInfo{kong, envoy, nginx}
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a compiled subset of JSONPath: $, .name, ['name'], [index],
+// negative indexes, * and [*] wildcards and ..name recursive descent.
+// Filter and script expressions are not supported.
+type jsonPath struct {
+	expression string
+	steps      []jsonPathStep
+	definite   bool // true when the path can match at most one value
+}
+
+type jsonPathStep struct {
+	name      string
+	index     int
+	isIndex   bool
+	wildcard  bool
+	recursive bool
+}
+
+func compileJSONPath(expression string) (*jsonPath, error) {
+	expr := strings.TrimSpace(expression)
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("invalid JSONPath %q: must start with $", expression)
+	}
+
+	compiled := &jsonPath{expression: expression, definite: true}
+	rest := expr[1:]
+	for len(rest) > 0 {
+		step := jsonPathStep{}
+
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.recursive = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			name, remainder := readJSONPathName(rest)
+			if name == "" {
+				return nil, fmt.Errorf("invalid JSONPath %q: expected name after ..", expression)
+			}
+			step.name, step.wildcard = name, name == "*"
+			rest = remainder
+			compiled.steps = append(compiled.steps, step)
+			compiled.definite = false
+			continue
+
+		case strings.HasPrefix(rest, "."):
+			name, remainder := readJSONPathName(rest[1:])
+			if name == "" {
+				return nil, fmt.Errorf("invalid JSONPath %q: expected name after .", expression)
+			}
+			step.name, step.wildcard = name, name == "*"
+			rest = remainder
+			compiled.steps = append(compiled.steps, step)
+			if step.wildcard {
+				compiled.definite = false
+			}
+			continue
+
+		case !strings.HasPrefix(rest, "["):
+			return nil, fmt.Errorf("invalid JSONPath %q: unexpected %q", expression, rest[:1])
+		}
+
+		// Bracket selector, possibly following ..
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid JSONPath %q: unterminated [", expression)
+		}
+		selector := strings.TrimSpace(rest[1:end])
+		rest = rest[end+1:]
+
+		switch {
+		case selector == "*":
+			step.wildcard = true
+		case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+			step.name = selector[1 : len(selector)-1]
+		default:
+			index, err := strconv.Atoi(selector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSONPath %q: unsupported selector [%s]", expression, selector)
+			}
+			step.index, step.isIndex = index, true
+		}
+		if step.wildcard || step.recursive {
+			compiled.definite = false
+		}
+		compiled.steps = append(compiled.steps, step)
+	}
+
+	return compiled, nil
+}
+
+// readJSONPathName reads a dot-notation member name up to the next . or [
+func readJSONPathName(input string) (string, string) {
+	end := strings.IndexAny(input, ".[")
+	if end < 0 {
+		return input, ""
+	}
+	return input[:end], input[end:]
+}
+
+// evaluate returns the single match for definite paths, or a list of every match
+func (p *jsonPath) evaluate(doc interface{}) (interface{}, bool) {
+	current := []interface{}{doc}
+	for _, step := range p.steps {
+		var next []interface{}
+		for _, node := range current {
+			if step.recursive {
+				next = append(next, selectRecursive(node, step)...)
+			} else {
+				next = append(next, selectChildren(node, step)...)
+			}
+		}
+		if len(next) == 0 {
+			return nil, false
+		}
+		current = next
+	}
+
+	if p.definite {
+		return current[0], true
+	}
+	return current, true
+}
+
+// replace substitutes every value the path matches with fn(value) and returns
+// the updated document and the number of replacements. Maps and slices are
+// updated in place.
+func (p *jsonPath) replace(doc interface{}, fn func(interface{}) interface{}) (interface{}, int) {
+	if len(p.steps) == 0 {
+		return fn(doc), 1
+	}
+	return doc, replaceSteps(doc, p.steps, fn)
+}
+
+func replaceSteps(node interface{}, steps []jsonPathStep, fn func(interface{}) interface{}) int {
+	step, rest := steps[0], steps[1:]
+	count := 0
+
+	visit := func(value interface{}, set func(interface{})) {
+		if len(rest) == 0 {
+			set(fn(value))
+			count++
+			return
+		}
+		count += replaceSteps(value, rest, fn)
+	}
+
+	switch v := node.(type) {
+	case map[string]interface{}:
+		keys := sortedKeys(v)
+		for _, key := range keys {
+			if step.wildcard || (!step.isIndex && key == step.name) {
+				key := key
+				visit(v[key], func(value interface{}) { v[key] = value })
+			}
+		}
+		if step.recursive {
+			for _, key := range keys {
+				count += replaceSteps(v[key], steps, fn)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			index := step.index
+			if index < 0 {
+				index += len(v)
+			}
+			if step.wildcard || (step.isIndex && i == index) {
+				i := i
+				visit(v[i], func(value interface{}) { v[i] = value })
+			}
+		}
+		if step.recursive {
+			for _, item := range v {
+				count += replaceSteps(item, steps, fn)
+			}
+		}
+	}
+	return count
+}
+
+func selectChildren(node interface{}, step jsonPathStep) []interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if step.wildcard {
+			keys := sortedKeys(v)
+			matches := make([]interface{}, 0, len(keys))
+			for _, key := range keys {
+				matches = append(matches, v[key])
+			}
+			return matches
+		}
+		if step.isIndex {
+			return nil
+		}
+		if value, exists := v[step.name]; exists {
+			return []interface{}{value}
+		}
+	case []interface{}:
+		if step.wildcard {
+			return append([]interface{}{}, v...)
+		}
+		if step.isIndex {
+			index := step.index
+			if index < 0 {
+				index += len(v)
+			}
+			if index >= 0 && index < len(v) {
+				return []interface{}{v[index]}
+			}
+		}
+	}
+	return nil
+}
+
+// selectRecursive applies step to node and every descendant, in document order
+func selectRecursive(node interface{}, step jsonPathStep) []interface{} {
+	matches := selectChildren(node, step)
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			matches = append(matches, selectRecursive(v[key], step)...)
+		}
+	case []interface{}:
+		for _, item := range v {
+			matches = append(matches, selectRecursive(item, step)...)
+		}
+	}
+	return matches
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,647 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/textproto"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+)
+
+const (
+	transformRename              = "rename"
+	transformCoerce              = "coerce"
+	transformTimestamp           = "timestamp"
+	transformCanonicalizeHeaders = "canonicalize_headers"
+	transformNormalizeIP         = "normalize_ip"
+	transformNormalizeURL        = "normalize_url"
+	transformDrop                = "drop"
+	transformDerive              = "derive"
+)
+
+// compiledTransform is a validated TransformSpec ready to run against a document
+type compiledTransform struct {
+	spec     models.TransformSpec
+	jsonPath *jsonPath
+}
+
+// compileTransforms validates specs up front so schema errors surface on creation
+func compileTransforms(specs []models.TransformSpec) ([]compiledTransform, error) {
+	compiled := make([]compiledTransform, 0, len(specs))
+	for i, spec := range specs {
+		transform := compiledTransform{spec: spec}
+		if transform.spec.Name == "" {
+			transform.spec.Name = spec.Type
+		}
+
+		switch spec.Type {
+		case transformRename:
+			if spec.Field == "" || spec.Target == "" {
+				return nil, fmt.Errorf("transform %d: rename requires field and target", i)
+			}
+		case transformCoerce:
+			if spec.Field == "" {
+				return nil, fmt.Errorf("transform %d: coerce requires field", i)
+			}
+			switch spec.To {
+			case "string", "int", "float", "bool":
+			default:
+				return nil, fmt.Errorf("transform %d: unsupported coerce type %q", i, spec.To)
+			}
+		case transformTimestamp:
+			if spec.Field == "" {
+				return nil, fmt.Errorf("transform %d: timestamp requires field", i)
+			}
+			switch spec.To {
+			case "", "rfc3339", "unix", "unix_ms":
+			default:
+				return nil, fmt.Errorf("transform %d: unsupported timestamp output %q", i, spec.To)
+			}
+		case transformCanonicalizeHeaders:
+			if spec.Field == "" {
+				return nil, fmt.Errorf("transform %d: canonicalize_headers requires field", i)
+			}
+			if spec.To != "" && spec.To != "canonical" && spec.To != "lower" {
+				return nil, fmt.Errorf("transform %d: unsupported header case %q", i, spec.To)
+			}
+		case transformNormalizeIP, transformNormalizeURL:
+			if spec.Field == "" {
+				return nil, fmt.Errorf("transform %d: %s requires field", i, spec.Type)
+			}
+		case transformDrop:
+			if spec.Field == "" && len(spec.Fields) == 0 {
+				return nil, fmt.Errorf("transform %d: drop requires field or fields", i)
+			}
+		case transformDerive:
+			if spec.Path == "" || spec.Target == "" {
+				return nil, fmt.Errorf("transform %d: derive requires path and target", i)
+			}
+			compiledPath, err := compileJSONPath(spec.Path)
+			if err != nil {
+				return nil, fmt.Errorf("transform %d: %w", i, err)
+			}
+			transform.jsonPath = compiledPath
+		default:
+			return nil, fmt.Errorf("transform %d: unknown transform type %q", i, spec.Type)
+		}
+
+		compiled = append(compiled, transform)
+	}
+	return compiled, nil
+}
+
+// applyTransforms runs the pipeline over doc in place and records each applied transform.
+// Transforms whose source field is absent are skipped without a record.
+func applyTransforms(transforms []compiledTransform, doc map[string]interface{}, normalized *models.NormalizedData) {
+	for _, transform := range transforms {
+		start := time.Now()
+		input, output, applied, err := transform.apply(doc)
+		if !applied {
+			continue
+		}
+
+		record := models.Transformation{
+			Type:     transform.spec.Type,
+			Name:     transform.spec.Name,
+			Field:    transform.spec.Field,
+			Target:   transform.spec.Target,
+			Config:   transform.config(),
+			Input:    input,
+			Output:   output,
+			Duration: time.Since(start),
+			Success:  err == nil,
+		}
+		if transform.spec.Type == transformDerive {
+			record.Field = transform.spec.Path
+		}
+		if err != nil {
+			record.Error = err.Error()
+			normalized.Errors = append(normalized.Errors, fmt.Sprintf("%s %s: %v", transform.spec.Name, record.Field, err))
+		}
+		normalized.AddTransformation(record)
+	}
+}
+
+func (t compiledTransform) apply(doc map[string]interface{}) (interface{}, interface{}, bool, error) {
+	spec := t.spec
+	target := spec.Target
+	if target == "" {
+		target = spec.Field
+	}
+
+	switch spec.Type {
+	case transformRename:
+		value, exists := getPathValue(doc, spec.Field)
+		if !exists {
+			return nil, nil, false, nil
+		}
+		deletePathValue(doc, spec.Field)
+		setPathValue(doc, spec.Target, value)
+		return spec.Field, spec.Target, true, nil
+
+	case transformDrop:
+		fields := spec.Fields
+		if spec.Field != "" {
+			fields = append([]string{spec.Field}, fields...)
+		}
+		dropped := []string{}
+		for _, field := range fields {
+			if _, exists := getPathValue(doc, field); exists {
+				deletePathValue(doc, field)
+				dropped = append(dropped, field)
+			}
+		}
+		if len(dropped) == 0 {
+			return nil, nil, false, nil
+		}
+		return dropped, nil, true, nil
+
+	case transformDerive:
+		value, matched := t.jsonPath.evaluate(doc)
+		if !matched {
+			if spec.Default == nil {
+				return nil, nil, false, nil
+			}
+			value = spec.Default
+		}
+		value = copyJSONValue(value)
+		setPathValue(doc, spec.Target, value)
+		return spec.Path, value, true, nil
+	}
+
+	value, exists := getPathValue(doc, spec.Field)
+	if !exists {
+		return nil, nil, false, nil
+	}
+
+	var output interface{}
+	var err error
+	switch spec.Type {
+	case transformCoerce:
+		output, err = coerceValue(value, spec.To, spec.Scale)
+	case transformTimestamp:
+		output, err = normalizeTimestamp(value, spec.Formats, spec.To)
+	case transformCanonicalizeHeaders:
+		output, err = canonicalizeHeaders(value, spec.To == "lower")
+	case transformNormalizeIP:
+		output, err = normalizeIPValue(value)
+	case transformNormalizeURL:
+		output, err = normalizeURLValue(value)
+	}
+	if err != nil {
+		return value, nil, true, err
+	}
+
+	setPathValue(doc, target, output)
+	return value, output, true, nil
+}
+
+// config returns the non-path options of the transform for provenance records
+func (t compiledTransform) config() map[string]interface{} {
+	config := map[string]interface{}{}
+	if t.spec.To != "" {
+		config["to"] = t.spec.To
+	}
+	if len(t.spec.Formats) > 0 {
+		config["formats"] = t.spec.Formats
+	}
+	if t.spec.Scale != 0 {
+		config["scale"] = t.spec.Scale
+	}
+	if len(config) == 0 {
+		return nil
+	}
+	return config
+}
+
+// isAbsentValue reports values that access logs use to mean "not set"
+func isAbsentValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	if s, ok := value.(string); ok {
+		s = strings.TrimSpace(s)
+		return s == "" || s == "-"
+	}
+	return false
+}
+
+func coerceValue(value interface{}, to string, scale float64) (interface{}, error) {
+	if isAbsentValue(value) {
+		return nil, nil
+	}
+
+	switch to {
+	case "string":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		case map[string]interface{}, []interface{}:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			return string(data), nil
+		default:
+			return fmt.Sprint(v), nil
+		}
+
+	case "bool":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case float64:
+			return v != 0, nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "true", "yes", "on", "1", "y", "t":
+				return true, nil
+			case "false", "no", "off", "0", "n", "f":
+				return false, nil
+			}
+			return nil, fmt.Errorf("cannot coerce %q to bool", v)
+		}
+		return nil, fmt.Errorf("cannot coerce %T to bool", value)
+	}
+
+	number, err := numericValue(value)
+	if err != nil {
+		return nil, err
+	}
+	if scale != 0 {
+		number *= scale
+	}
+
+	if to == "int" {
+		if math.IsNaN(number) || math.IsInf(number, 0) || math.Abs(number) > 1<<53 {
+			return nil, fmt.Errorf("value %v out of integer range", number)
+		}
+		return int64(math.Round(number)), nil
+	}
+	return number, nil
+}
+
+func numericValue(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot coerce %q to number", v)
+		}
+		return number, nil
+	}
+	return 0, fmt.Errorf("cannot coerce %T to number", value)
+}
+
+var namedTimestampLayouts = map[string]string{
+	"rfc3339":  time.RFC3339Nano,
+	"iso8601":  "2006-01-02T15:04:05.999999999Z0700",
+	"rfc1123":  time.RFC1123,
+	"rfc1123z": time.RFC1123Z,
+	"clf":      "02/Jan/2006:15:04:05 -0700",
+}
+
+// defaultTimestampFormats covers the layouts produced by common gateways and proxies
+var defaultTimestampFormats = []string{"rfc3339", "iso8601", "clf", "rfc1123", "rfc1123z", "2006-01-02 15:04:05.999999999", "epoch"}
+
+func normalizeTimestamp(value interface{}, formats []string, to string) (interface{}, error) {
+	if isAbsentValue(value) {
+		return nil, nil
+	}
+	if len(formats) == 0 {
+		formats = defaultTimestampFormats
+	}
+
+	parsed, err := parseTimestamp(value, formats)
+	if err != nil {
+		return nil, err
+	}
+	parsed = parsed.UTC()
+
+	switch to {
+	case "unix":
+		return parsed.Unix(), nil
+	case "unix_ms":
+		return parsed.UnixMilli(), nil
+	default:
+		return parsed.Format(time.RFC3339Nano), nil
+	}
+}
+
+func parseTimestamp(value interface{}, formats []string) (time.Time, error) {
+	for _, format := range formats {
+		switch format {
+		case "unix", "unix_ms", "unix_us", "unix_ns", "epoch":
+			number, err := numericValue(value)
+			if err != nil {
+				continue
+			}
+			return epochTime(number, format), nil
+		}
+
+		text, ok := value.(string)
+		if !ok {
+			continue
+		}
+		layout := format
+		if named, exists := namedTimestampLayouts[format]; exists {
+			layout = named
+		}
+		if parsed, err := time.Parse(layout, strings.TrimSpace(text)); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised timestamp %v", value)
+}
+
+// epochTime converts a numeric timestamp; "epoch" infers the unit from its magnitude
+func epochTime(number float64, unit string) time.Time {
+	if unit == "epoch" {
+		switch magnitude := math.Abs(number); {
+		case magnitude >= 1e17:
+			unit = "unix_ns"
+		case magnitude >= 1e14:
+			unit = "unix_us"
+		case magnitude >= 1e11:
+			unit = "unix_ms"
+		default:
+			unit = "unix"
+		}
+	}
+
+	switch unit {
+	case "unix_ms":
+		return time.UnixMilli(0).Add(time.Duration(number * float64(time.Millisecond)))
+	case "unix_us":
+		return time.UnixMicro(0).Add(time.Duration(number * float64(time.Microsecond)))
+	case "unix_ns":
+		return time.Unix(0, int64(number))
+	default:
+		return unixFloatTime(number)
+	}
+}
+
+// canonicalizeHeaders rewrites header names to one casing and flattens multi-value headers
+func canonicalizeHeaders(value interface{}, lower bool) (interface{}, error) {
+	headers, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("headers must be an object, got %T", value)
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	// Deterministic merge order when several spellings of one header exist
+	sort.Strings(names)
+
+	canonical := make(map[string]interface{}, len(headers))
+	for _, name := range names {
+		key := textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+		if lower {
+			key = strings.ToLower(key)
+		}
+		if key == "" || strings.HasPrefix(key, ":") {
+			continue
+		}
+
+		headerText := headerValueText(headers[name])
+		if existing, exists := canonical[key]; exists {
+			headerText = existing.(string) + ", " + headerText
+		}
+		canonical[key] = headerText
+	}
+	return canonical, nil
+}
+
+func headerValueText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, headerValueText(item))
+		}
+		return strings.Join(parts, ", ")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// normalizeIPValue extracts the client address from forms like "1.2.3.4:80",
+// "[::1]:443" or an X-Forwarded-For list and returns its canonical text
+func normalizeIPValue(value interface{}) (interface{}, error) {
+	if isAbsentValue(value) {
+		return nil, nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("ip address must be a string, got %T", value)
+	}
+
+	candidate := strings.TrimSpace(strings.Split(text, ",")[0])
+	if host, _, err := net.SplitHostPort(candidate); err == nil {
+		candidate = host
+	}
+	candidate = strings.Trim(candidate, "[]")
+	if zone := strings.IndexByte(candidate, '%'); zone >= 0 {
+		candidate = candidate[:zone]
+	}
+
+	ip := net.ParseIP(candidate)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid ip address %q", text)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return ip.String(), nil
+}
+
+// normalizeURLValue lowercases scheme and host, drops default ports and fragments,
+// resolves dot segments and sorts query parameters
+func normalizeURLValue(value interface{}) (interface{}, error) {
+	if isAbsentValue(value) {
+		return nil, nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("url must be a string, got %T", value)
+	}
+
+	parsed, err := url.Parse(strings.TrimSpace(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %w", text, err)
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	if parsed.Host != "" {
+		host := strings.ToLower(parsed.Hostname())
+		port := parsed.Port()
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if port != "" && !isDefaultPort(parsed.Scheme, mustAtoi(port)) {
+			host += ":" + port
+		}
+		parsed.Host = host
+	}
+
+	if parsed.Path != "" {
+		cleaned := path.Clean(parsed.Path)
+		if strings.HasSuffix(parsed.Path, "/") && cleaned != "/" {
+			cleaned += "/"
+		}
+		if !strings.HasPrefix(parsed.Path, "/") {
+			cleaned = strings.TrimPrefix(cleaned, "./")
+		}
+		parsed.Path = cleaned
+		parsed.RawPath = ""
+	} else if parsed.Host != "" {
+		parsed.Path = "/"
+	}
+
+	if parsed.RawQuery != "" {
+		if query, err := url.ParseQuery(parsed.RawQuery); err == nil {
+			parsed.RawQuery = query.Encode()
+		}
+	}
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+
+	return parsed.String(), nil
+}
+
+func mustAtoi(value string) int64 {
+	number, _ := strconv.ParseInt(value, 10, 64)
+	return number
+}
+
+// transformSpecFromConfig converts a configured transformer into a TransformSpec
+func transformSpecFromConfig(transformer config.TransformerConfig) (models.TransformSpec, error) {
+	var spec models.TransformSpec
+	if len(transformer.Config) > 0 {
+		data, err := json.Marshal(transformer.Config)
+		if err != nil {
+			return spec, fmt.Errorf("invalid transformer %s config: %w", transformer.Name, err)
+		}
+		if err := json.Unmarshal(data, &spec); err != nil {
+			return spec, fmt.Errorf("invalid transformer %s config: %w", transformer.Name, err)
+		}
+	}
+	spec.Type = transformer.Type
+	if transformer.Name != "" {
+		spec.Name = transformer.Name
+	}
+	return spec, nil
+}
+
+// Document path helpers
+
+func getPathValue(doc map[string]interface{}, fieldPath string) (interface{}, bool) {
+	if value, exists := doc[fieldPath]; exists {
+		return value, true
+	}
+
+	parts := strings.Split(fieldPath, ".")
+	var current interface{} = doc
+	for _, part := range parts {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = object[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func setPathValue(doc map[string]interface{}, fieldPath string, value interface{}) {
+	if _, exists := doc[fieldPath]; exists || !strings.Contains(fieldPath, ".") {
+		doc[fieldPath] = value
+		return
+	}
+
+	parts := strings.Split(fieldPath, ".")
+	current := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}
+
+func deletePathValue(doc map[string]interface{}, fieldPath string) {
+	if _, exists := doc[fieldPath]; exists {
+		delete(doc, fieldPath)
+		return
+	}
+
+	parts := strings.Split(fieldPath, ".")
+	current := doc
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			return
+		}
+		current = next
+	}
+	delete(current, parts[len(parts)-1])
+}
+
+// copyJSONValue deep-copies maps and slices so transforms never touch the parsed input
+func copyJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyJSONValue(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyJSONValue(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+func normalizeJSON(t *testing.T, service DataNormalizerServiceInterface, schema string, document string) *models.NormalizedData {
+	t.Helper()
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(document), &parsed); err != nil {
+		t.Fatalf("invalid test document: %v", err)
+	}
+	normalized, err := service.NormalizeData(context.Background(), &models.ParsedData{ID: "p-1", Parsed: parsed}, schema)
+	if err != nil {
+		t.Fatalf("NormalizeData(%s): %v (errors: %v)", schema, err, normalized)
+	}
+	return normalized
+}
+
+func TestNormalizeData_GatewayLogsShareCanonicalShape(t *testing.T) {
+	service := NewDataNormalizerService(logging.NewStructuredLogger("test"), &config.Config{})
+
+	kong := normalizeJSON(t, service, "kong", `{
+		"request": {"method": "GET", "uri": "/v1/users/../orders?b=2&a=1", "url": "HTTP://API.Example.com:80/v1/orders?b=2&a=1",
+			"size": 120, "headers": {"user-agent": "curl/8.0", "host": "api.example.com", "x-request-id": ["a", "b"]}},
+		"response": {"status": 200, "size": 512, "headers": {"content-type": "application/json"}},
+		"latencies": {"request": 35, "kong": 2, "proxy": 33},
+		"client_ip": "::ffff:10.1.2.3",
+		"started_at": 1709287200500,
+		"service": {"name": "orders"},
+		"tries": [{"ip": "10.0.0.7", "port": 8080}]
+	}`)
+	envoy := normalizeJSON(t, service, "envoy", `{
+		"start_time": "2024-03-01T10:00:00.500Z", "method": "GET", "path": "/v1/orders?b=2&a=1", "protocol": "HTTP/1.1",
+		"response_code": 200, "bytes_received": 120, "bytes_sent": 512, "duration": 35,
+		"downstream_remote_address": "10.1.2.3:51234", "authority": "api.example.com", "user_agent": "curl/8.0",
+		"response_flags": "-"
+	}`)
+	nginx := normalizeJSON(t, service, "nginx", `{
+		"time_local": "01/Mar/2024:11:00:00 +0100", "remote_addr": "10.1.2.3", "request_method": "GET",
+		"request_uri": "/v1/orders?b=2&a=1", "status": "200", "body_bytes_sent": "512", "request_length": "120",
+		"request_time": "0.035", "http_user_agent": "curl/8.0", "http_host": "api.example.com", "upstream_addr": "-"
+	}`)
+
+	for _, normalized := range []*models.NormalizedData{kong, envoy, nginx} {
+		data := normalized.Data
+		if data["method"] != "GET" || data["status_code"] != int64(200) || data["source_ip"] != "10.1.2.3" {
+			t.Fatalf("%s: unexpected request fields: %v", normalized.Schema, data)
+		}
+		if data["path"] != "/v1/orders?a=1&b=2" || data["user_agent"] != "curl/8.0" {
+			t.Fatalf("%s: unexpected path/user agent: %v %v", normalized.Schema, data["path"], data["user_agent"])
+		}
+		if data["response_size"] != int64(512) || data["duration_ms"] != float64(35) {
+			t.Fatalf("%s: unexpected sizes/duration: %v %v", normalized.Schema, data["response_size"], data["duration_ms"])
+		}
+		if len(normalized.Errors) != 0 {
+			t.Fatalf("%s: unexpected transform errors: %v", normalized.Schema, normalized.Errors)
+		}
+		if len(normalized.Transformations) == 0 {
+			t.Fatalf("%s: expected transformation provenance", normalized.Schema)
+		}
+	}
+
+	if kong.Data["timestamp"] != "2024-03-01T10:00:00.5Z" || envoy.Data["timestamp"] != "2024-03-01T10:00:00.5Z" || nginx.Data["timestamp"] != "2024-03-01T10:00:00Z" {
+		t.Fatalf("unexpected timestamps: %v %v %v", kong.Data["timestamp"], envoy.Data["timestamp"], nginx.Data["timestamp"])
+	}
+	if kong.Data["url"] != "http://api.example.com/v1/orders?a=1&b=2" || kong.Data["upstream"] != "10.0.0.7" {
+		t.Fatalf("unexpected kong url/upstream: %v %v", kong.Data["url"], kong.Data["upstream"])
+	}
+	headers := kong.Data["request_headers"].(map[string]interface{})
+	if headers["User-Agent"] != "curl/8.0" || headers["X-Request-Id"] != "a, b" {
+		t.Fatalf("unexpected canonical headers: %v", headers)
+	}
+	if _, exists := kong.Data["request"]; exists {
+		t.Fatal("kong request object should have been dropped")
+	}
+	if nginx.Data["upstream"] != "-" {
+		// Renames carry values through unchanged
+		t.Fatalf("unexpected nginx upstream: %v", nginx.Data["upstream"])
+	}
+}
+
+func TestNormalizeData_RecordsProvenanceAndFailures(t *testing.T) {
+	service := NewDataNormalizerService(logging.NewStructuredLogger("test"), &config.Config{})
+	err := service.CreateSchema(context.Background(), models.SchemaInfo{
+		Name: "custom",
+		Transforms: []models.TransformSpec{
+			{Type: "derive", Path: "$.items[*].sku", Target: "skus"},
+			{Type: "coerce", Name: "latency", Field: "meta.latency", To: "int"},
+			{Type: "drop", Fields: []string{"items", "missing"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateSchema: %v", err)
+	}
+
+	normalized := normalizeJSON(t, service, "custom", `{"items": [{"sku": "A"}, {"sku": "B"}], "meta": {"latency": "fast"}}`)
+	skus, _ := normalized.Data["skus"].([]interface{})
+	if len(skus) != 2 || skus[0] != "A" {
+		t.Fatalf("unexpected derived field: %v", normalized.Data["skus"])
+	}
+	if len(normalized.Transformations) != 3 {
+		t.Fatalf("expected 3 transformation records, got %+v", normalized.Transformations)
+	}
+	coerce := normalized.Transformations[1]
+	if coerce.Success || coerce.Name != "latency" || coerce.Field != "meta.latency" || coerce.Error == "" || len(normalized.Errors) != 1 {
+		t.Fatalf("expected failed coerce record, got %+v", coerce)
+	}
+	drop := normalized.Transformations[2]
+	if dropped, _ := drop.Input.([]string); len(dropped) != 1 || dropped[0] != "items" {
+		t.Fatalf("unexpected drop provenance: %+v", drop)
+	}
+
+	if err := service.CreateSchema(context.Background(), models.SchemaInfo{
+		Name:       "broken",
+		Transforms: []models.TransformSpec{{Type: "derive", Path: "$.items[?(@.sku)]", Target: "x"}},
+	}); err == nil {
+		t.Fatal("expected unsupported JSONPath to be rejected")
+	}
+}
+
+func TestNormalizeURLValue(t *testing.T) {
+	cases := map[string]string{
+		"HTTPS://Example.COM:443/a/./b/../c/?z=1&a=2#frag": "https://example.com/a/c/?a=2&z=1",
+		"http://[::1]:8080//x//y":                          "http://[::1]:8080/x/y",
+		"http://example.com":                               "http://example.com/",
+	}
+	for input, expected := range cases {
+		output, err := normalizeURLValue(input)
+		if err != nil || output != expected {
+			t.Errorf("normalizeURLValue(%q) = %v, %v; want %q", input, output, err, expected)
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+
+	// Well-known types, so descriptor sets built without --include_imports still resolve
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	grpcFrameHeaderSize = 5
+	maxWireDecodeDepth  = 16
+	// maxGRPCMessageSize caps a gRPC message after decompression, matching
+	// gRPC's default limit on received messages
+	maxGRPCMessageSize = 4 * 1024 * 1024
+)
+
+// protobufRegistry holds descriptor sets registered per service or per path prefix
+type protobufRegistry struct {
+	sets  []*descriptorSet
+	mutex sync.RWMutex
+}
+
+type descriptorSet struct {
+	info  models.DescriptorSetInfo
+	files *protoregistry.Files
+}
+
+// chainedResolver resolves against the registered files first and falls back to the global registry
+type chainedResolver struct {
+	local *protoregistry.Files
+}
+
+func (r chainedResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if fd, err := r.local.FindFileByPath(path); err == nil {
+		return fd, nil
+	}
+	return protoregistry.GlobalFiles.FindFileByPath(path)
+}
+
+func (r chainedResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if d, err := r.local.FindDescriptorByName(name); err == nil {
+		return d, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
+
+func newProtobufRegistry() *protobufRegistry {
+	return &protobufRegistry{}
+}
+
+func (r *protobufRegistry) register(ctx context.Context, registration *models.DescriptorRegistration) (*models.DescriptorSetInfo, error) {
+	var files *protoregistry.Files
+	var err error
+
+	switch {
+	case len(registration.DescriptorSet) > 0:
+		files, err = buildFilesFromDescriptorSet(registration.DescriptorSet)
+	case len(registration.ProtoFiles) > 0:
+		files, err = buildFilesFromProtoSources(ctx, registration.ProtoFiles)
+	default:
+		return nil, fmt.Errorf("either descriptor_set or proto_files must be provided")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	set := &descriptorSet{
+		info: models.DescriptorSetInfo{
+			ID:         uuid.New().String(),
+			Name:       registration.Name,
+			Service:    registration.Service,
+			PathPrefix: registration.PathPrefix,
+			CreatedAt:  time.Now(),
+		},
+		files: files,
+	}
+
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		set.info.Files = append(set.info.Files, fd.Path())
+		collectMessageNames(fd.Messages(), &set.info.Messages)
+		services := fd.Services()
+		for i := 0; i < services.Len(); i++ {
+			set.info.GRPCServices = append(set.info.GRPCServices, string(services.Get(i).FullName()))
+		}
+		return true
+	})
+	sort.Strings(set.info.Files)
+	sort.Strings(set.info.Messages)
+	sort.Strings(set.info.GRPCServices)
+
+	if set.info.Name == "" && len(set.info.Files) > 0 {
+		set.info.Name = set.info.Files[0]
+	}
+
+	r.mutex.Lock()
+	r.sets = append(r.sets, set)
+	r.mutex.Unlock()
+
+	return &set.info, nil
+}
+
+func (r *protobufRegistry) list() []models.DescriptorSetInfo {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	infos := make([]models.DescriptorSetInfo, 0, len(r.sets))
+	for _, set := range r.sets {
+		infos = append(infos, set.info)
+	}
+	return infos
+}
+
+// resolve finds the message descriptor for a target. Sets registered for the
+// target's service are searched first, then sets whose path prefix matches
+// (longest first), then every remaining set.
+func (r *protobufRegistry) resolve(target *models.ProtobufTarget) (protoreflect.MessageDescriptor, error) {
+	if target == nil || (target.MessageType == "" && target.Path == "") {
+		return nil, fmt.Errorf("no message type or gRPC path provided")
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	grpcService, grpcMethod, isGRPCPath := splitGRPCPath(target.Path)
+
+	for _, set := range r.candidates(target) {
+		if target.MessageType != "" {
+			d, err := set.files.FindDescriptorByName(protoreflect.FullName(target.MessageType))
+			if err == nil {
+				if md, ok := d.(protoreflect.MessageDescriptor); ok {
+					return md, nil
+				}
+			}
+			continue
+		}
+
+		if !isGRPCPath {
+			continue
+		}
+		d, err := set.files.FindDescriptorByName(protoreflect.FullName(grpcService))
+		if err != nil {
+			continue
+		}
+		sd, ok := d.(protoreflect.ServiceDescriptor)
+		if !ok {
+			continue
+		}
+		if method := sd.Methods().ByName(protoreflect.Name(grpcMethod)); method != nil {
+			if target.Response {
+				return method.Output(), nil
+			}
+			return method.Input(), nil
+		}
+	}
+
+	if target.MessageType != "" {
+		return nil, fmt.Errorf("message type not registered: %s", target.MessageType)
+	}
+	return nil, fmt.Errorf("no descriptor registered for path: %s", target.Path)
+}
+
+func (r *protobufRegistry) candidates(target *models.ProtobufTarget) []*descriptorSet {
+	var byService, byPath, rest []*descriptorSet
+	for _, set := range r.sets {
+		switch {
+		case target.Service != "" && set.info.Service == target.Service:
+			byService = append(byService, set)
+		case set.info.PathPrefix != "" && strings.HasPrefix(target.Path, set.info.PathPrefix):
+			byPath = append(byPath, set)
+		default:
+			rest = append(rest, set)
+		}
+	}
+
+	sort.SliceStable(byPath, func(i, j int) bool {
+		return len(byPath[i].info.PathPrefix) > len(byPath[j].info.PathPrefix)
+	})
+
+	ordered := append(byService, byPath...)
+	return append(ordered, rest...)
+}
+
+func buildFilesFromDescriptorSet(data []byte) (*protoregistry.Files, error) {
+	var fds descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &fds); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal descriptor set: %w", err)
+	}
+
+	byName := make(map[string]*descriptorpb.FileDescriptorProto, len(fds.GetFile()))
+	for _, fdp := range fds.GetFile() {
+		byName[fdp.GetName()] = fdp
+	}
+
+	files := new(protoregistry.Files)
+	// visiting holds the files whose dependencies are being registered, so
+	// an import cycle is reported rather than recursed into
+	visiting := make(map[string]bool)
+	var register func(name string) error
+	register = func(name string) error {
+		if _, err := files.FindFileByPath(name); err == nil {
+			return nil
+		}
+		fdp, ok := byName[name]
+		if !ok {
+			// Not part of the set; left for the global registry to resolve
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("invalid descriptor %s: import cycle", name)
+		}
+		visiting[name] = true
+		defer delete(visiting, name)
+		for _, dep := range fdp.GetDependency() {
+			if err := register(dep); err != nil {
+				return err
+			}
+		}
+		fd, err := protodesc.NewFile(fdp, chainedResolver{local: files})
+		if err != nil {
+			return fmt.Errorf("invalid descriptor %s: %w", name, err)
+		}
+		return files.RegisterFile(fd)
+	}
+
+	for _, fdp := range fds.GetFile() {
+		if err := register(fdp.GetName()); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func buildFilesFromProtoSources(ctx context.Context, sources map[string]string) (*protoregistry.Files, error) {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(sources),
+		}),
+	}
+	compiled, err := compiler.Compile(ctx, names...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile proto files: %w", err)
+	}
+
+	files := new(protoregistry.Files)
+	var register func(fd protoreflect.FileDescriptor) error
+	register = func(fd protoreflect.FileDescriptor) error {
+		if _, err := files.FindFileByPath(fd.Path()); err == nil {
+			return nil
+		}
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			if err := register(imports.Get(i).FileDescriptor); err != nil {
+				return err
+			}
+		}
+		return files.RegisterFile(fd)
+	}
+
+	for _, fd := range compiled {
+		if err := register(fd); err != nil {
+			return nil, fmt.Errorf("failed to register %s: %w", fd.Path(), err)
+		}
+	}
+	return files, nil
+}
+
+func collectMessageNames(messages protoreflect.MessageDescriptors, names *[]string) {
+	for i := 0; i < messages.Len(); i++ {
+		md := messages.Get(i)
+		if md.IsMapEntry() {
+			continue
+		}
+		*names = append(*names, string(md.FullName()))
+		collectMessageNames(md.Messages(), names)
+	}
+}
+
+// splitGRPCPath splits "/pkg.Service/Method" into its service and method names
+func splitGRPCPath(path string) (string, string, bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// isGRPCFramed reports whether data is a complete sequence of gRPC length-prefixed messages
+func isGRPCFramed(data []byte) bool {
+	if len(data) < grpcFrameHeaderSize {
+		return false
+	}
+	for len(data) > 0 {
+		if len(data) < grpcFrameHeaderSize || data[0] > 1 {
+			return false
+		}
+		length := binary.BigEndian.Uint32(data[1:grpcFrameHeaderSize])
+		if uint64(len(data)-grpcFrameHeaderSize) < uint64(length) {
+			return false
+		}
+		data = data[grpcFrameHeaderSize+int(length):]
+	}
+	return true
+}
+
+// splitGRPCFrames splits a gRPC body into its message payloads, inflating gzip-compressed frames
+func splitGRPCFrames(data []byte) ([][]byte, error) {
+	var frames [][]byte
+	for offset := 0; offset < len(data); {
+		if len(data)-offset < grpcFrameHeaderSize {
+			return nil, fmt.Errorf("truncated gRPC frame header at offset %d", offset)
+		}
+		compressed := data[offset] == 1
+		length := int(binary.BigEndian.Uint32(data[offset+1 : offset+grpcFrameHeaderSize]))
+		start := offset + grpcFrameHeaderSize
+		if length > len(data)-start {
+			return nil, fmt.Errorf("truncated gRPC frame at offset %d: want %d bytes, have %d", offset, length, len(data)-start)
+		}
+		payload := data[start : start+length]
+
+		if compressed {
+			reader, err := gzip.NewReader(bytes.NewReader(payload))
+			if err != nil {
+				return nil, fmt.Errorf("unsupported gRPC frame compression at offset %d: %w", offset, err)
+			}
+			payload, err = io.ReadAll(io.LimitReader(reader, maxGRPCMessageSize+1))
+			if err != nil {
+				return nil, fmt.Errorf("failed to inflate gRPC frame at offset %d: %w", offset, err)
+			}
+		}
+		if len(payload) > maxGRPCMessageSize {
+			return nil, fmt.Errorf("gRPC frame at offset %d exceeds %d bytes", offset, maxGRPCMessageSize)
+		}
+
+		frames = append(frames, payload)
+		offset = start + length
+	}
+	return frames, nil
+}
+
+// decodeProtobufMessage decodes a payload with a descriptor into the same
+// generic tree encoding/json produces, using the canonical proto3 JSON mapping.
+func decodeProtobufMessage(md protoreflect.MessageDescriptor, payload []byte) (interface{}, error) {
+	message := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(payload, message); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", md.FullName(), err)
+	}
+
+	jsonData, err := protojson.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s to JSON: %w", md.FullName(), err)
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(jsonData, &result); err != nil {
+		return nil, fmt.Errorf("failed to convert %s to JSON: %w", md.FullName(), err)
+	}
+	return result, nil
+}
+
+// decodeProtobufWire decodes a payload without a schema. Fields are keyed by
+// field number; each entry carries its wire type and a best-effort value.
+// Repeated field numbers collapse into a list of entries.
+func decodeProtobufWire(data []byte, depth int) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, fmt.Errorf("invalid field tag: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		entry := map[string]interface{}{}
+		switch wireType {
+		case protowire.VarintType:
+			v, m := protowire.ConsumeVarint(data)
+			if m < 0 {
+				return nil, fmt.Errorf("invalid varint in field %d: %w", number, protowire.ParseError(m))
+			}
+			entry["wire_type"] = "varint"
+			entry["value"] = v
+			n = m
+		case protowire.Fixed32Type:
+			v, m := protowire.ConsumeFixed32(data)
+			if m < 0 {
+				return nil, fmt.Errorf("invalid fixed32 in field %d: %w", number, protowire.ParseError(m))
+			}
+			entry["wire_type"] = "fixed32"
+			entry["value"] = v
+			n = m
+		case protowire.Fixed64Type:
+			v, m := protowire.ConsumeFixed64(data)
+			if m < 0 {
+				return nil, fmt.Errorf("invalid fixed64 in field %d: %w", number, protowire.ParseError(m))
+			}
+			entry["wire_type"] = "fixed64"
+			entry["value"] = v
+			n = m
+		case protowire.BytesType:
+			v, m := protowire.ConsumeBytes(data)
+			if m < 0 {
+				return nil, fmt.Errorf("invalid length-delimited field %d: %w", number, protowire.ParseError(m))
+			}
+			entry["wire_type"] = "bytes"
+			entry["type"], entry["value"] = classifyLengthDelimited(v, depth)
+			n = m
+		case protowire.StartGroupType:
+			v, m := protowire.ConsumeGroup(number, data)
+			if m < 0 {
+				return nil, fmt.Errorf("invalid group in field %d: %w", number, protowire.ParseError(m))
+			}
+			entry["wire_type"] = "group"
+			entry["value"] = base64.StdEncoding.EncodeToString(v)
+			if depth < maxWireDecodeDepth {
+				if nested, err := decodeProtobufWire(v, depth+1); err == nil {
+					entry["value"] = nested
+				}
+			}
+			n = m
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d in field %d", wireType, number)
+		}
+		data = data[n:]
+
+		key := strconv.Itoa(int(number))
+		switch existing := result[key].(type) {
+		case nil:
+			result[key] = entry
+		case []interface{}:
+			result[key] = append(existing, entry)
+		default:
+			result[key] = []interface{}{existing, entry}
+		}
+	}
+
+	return result, nil
+}
+
+// classifyLengthDelimited guesses whether a length-delimited value is text,
+// an embedded message or opaque bytes.
+func classifyLengthDelimited(value []byte, depth int) (string, interface{}) {
+	if len(value) == 0 {
+		return "string", ""
+	}
+	if isPrintableText(value) {
+		return "string", string(value)
+	}
+	if depth < maxWireDecodeDepth {
+		if nested, err := decodeProtobufWire(value, depth+1); err == nil && len(nested) > 0 {
+			return "message", nested
+		}
+	}
+	return "bytes", base64.StdEncoding.EncodeToString(value)
+}
+
+func isPrintableText(value []byte) bool {
+	if !utf8.Valid(value) {
+		return false
+	}
+	for _, r := range string(value) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+const testUserProto = `
+syntax = "proto3";
+package users.v1;
+
+message GetUserRequest {
+  int64 user_id = 1;
+}
+
+message User {
+  int64 id = 1;
+  string email = 2;
+  repeated string roles = 3;
+}
+
+service UserService {
+  rpc GetUser(GetUserRequest) returns (User);
+}
+`
+
+func newTestParserService() *DataParserService {
+	cfg := &config.Config{}
+	cfg.Parser.MaxPayloadSize = 1024 * 1024
+	return NewDataParserService(logging.NewStructuredLogger("test"), cfg).(*DataParserService)
+}
+
+func encodeTestUser() []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, 42)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, "ada@example.com")
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendString(b, "admin")
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendString(b, "billing")
+	return b
+}
+
+func grpcFrame(payload []byte) []byte {
+	frame := make([]byte, grpcFrameHeaderSize, grpcFrameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+func TestParseProtobuf_WithRegisteredProtoFiles(t *testing.T) {
+	service := newTestParserService()
+	ctx := context.Background()
+
+	info, err := service.RegisterDescriptors(ctx, &models.DescriptorRegistration{
+		Service:    "users",
+		ProtoFiles: map[string]string{"users/v1/users.proto": testUserProto},
+	})
+	if err != nil {
+		t.Fatalf("RegisterDescriptors: %v", err)
+	}
+	if len(info.GRPCServices) != 1 || info.GRPCServices[0] != "users.v1.UserService" {
+		t.Fatalf("unexpected services: %v", info.GRPCServices)
+	}
+
+	parsed, err := service.ParseProtobuf(ctx, grpcFrame(encodeTestUser()), "application/grpc", &models.ProtobufTarget{
+		Service:  "users",
+		Path:     "/users.v1.UserService/GetUser",
+		Response: true,
+	})
+	if err != nil {
+		t.Fatalf("ParseProtobuf: %v", err)
+	}
+
+	user, ok := parsed.Parsed.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected object, got %T", parsed.Parsed)
+	}
+	// int64 fields use the canonical JSON mapping (quoted)
+	if user["id"] != "42" || user["email"] != "ada@example.com" {
+		t.Fatalf("unexpected message: %v", user)
+	}
+	if roles, ok := user["roles"].([]interface{}); !ok || len(roles) != 2 {
+		t.Fatalf("unexpected roles: %v", user["roles"])
+	}
+	if !parsed.Validation.Valid {
+		t.Fatalf("expected valid result, got %v", parsed.Validation.Errors)
+	}
+}
+
+func TestParseData_ProtobufWireFallback(t *testing.T) {
+	service := newTestParserService()
+
+	parsed, err := service.ParseData(context.Background(), encodeTestUser(), "protobuf", "")
+	if err != nil {
+		t.Fatalf("ParseData: %v", err)
+	}
+
+	fields, ok := parsed.Parsed.(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected object, got %T", parsed.Parsed)
+	}
+	id := fields["1"].(map[string]interface{})
+	if id["wire_type"] != "varint" || id["value"] != uint64(42) {
+		t.Fatalf("unexpected field 1: %v", id)
+	}
+	email := fields["2"].(map[string]interface{})
+	if email["type"] != "string" || email["value"] != "ada@example.com" {
+		t.Fatalf("unexpected field 2: %v", email)
+	}
+	if roles, ok := fields["3"].([]interface{}); !ok || len(roles) != 2 {
+		t.Fatalf("expected repeated field 3, got %v", fields["3"])
+	}
+	if len(parsed.Warnings) == 0 || parsed.Warnings[0].Type != "schema_less" {
+		t.Fatalf("expected schema_less warning, got %v", parsed.Warnings)
+	}
+}
+
+func TestRegisterDescriptors_ImportCycle(t *testing.T) {
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		{Name: proto.String("a.proto"), Dependency: []string{"b.proto"}},
+		{Name: proto.String("b.proto"), Dependency: []string{"a.proto"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = newTestParserService().RegisterDescriptors(context.Background(), &models.DescriptorRegistration{
+		Service:       "cycle",
+		DescriptorSet: set,
+	})
+	if err == nil || !strings.Contains(err.Error(), "import cycle") {
+		t.Fatalf("RegisterDescriptors = %v, want an import cycle error", err)
+	}
+}
+
+func TestSplitGRPCFrames(t *testing.T) {
+	body := append(grpcFrame([]byte{0x08, 0x01}), grpcFrame([]byte{0x08, 0x02})...)
+	if !isGRPCFramed(body) {
+		t.Fatal("expected body to be detected as gRPC framed")
+	}
+
+	frames, err := splitGRPCFrames(body)
+	if err != nil {
+		t.Fatalf("splitGRPCFrames: %v", err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got %d", len(frames))
+	}
+
+	if _, err := splitGRPCFrames(body[:len(body)-1]); err == nil {
+		t.Fatal("expected truncated frame error")
+	}
+}
+
+func TestSplitGRPCFrames_CompressedSizeLimit(t *testing.T) {
+	compressedFrame := func(size int) []byte {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		writer.Write(make([]byte, size))
+		writer.Close()
+		frame := grpcFrame(buf.Bytes())
+		frame[0] = 1
+		return frame
+	}
+
+	frames, err := splitGRPCFrames(compressedFrame(1024))
+	if err != nil || len(frames) != 1 || len(frames[0]) != 1024 {
+		t.Fatalf("compressed frame = %d frames, %v", len(frames), err)
+	}
+
+	// A few kilobytes of zeros inflate past the limit
+	if _, err := splitGRPCFrames(compressedFrame(maxGRPCMessageSize + 1)); err == nil {
+		t.Fatal("expected oversized frame error")
+	}
+}
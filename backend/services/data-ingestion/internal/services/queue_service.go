@@ -17,6 +17,8 @@ type QueueServiceInterface interface {
 	Enqueue(ctx context.Context, data *models.TrafficData) error
 	Dequeue(ctx context.Context) (*models.TrafficData, error)
 	Flush(ctx context.Context) error
+	Publish(ctx context.Context, items []models.TrafficData) error
+	Close(ctx context.Context) error
 	GetQueueStatus(ctx context.Context) (*models.QueueStatus, error)
 	GetTopics(ctx context.Context) ([]models.TopicInfo, error)
 	UpdateConfiguration(ctx context.Context, config interface{}) error
@@ -31,10 +33,32 @@ type QueueService struct {
 	mutex         sync.Mutex
 	lastFlush     time.Time
 	flushInterval time.Duration
+
+	// flushMutex serialises Flush and spool replay so batches reach Kafka in order.
+	// Lock order is flushMutex before mutex.
+	flushMutex     sync.Mutex
+	spool          *diskSpool
+	spoolConfig    config.SpoolConfig
+	replaying      bool
+	lastReplay     time.Time
+	lastKafkaError string
+	stopReplay     chan struct{}
+	replayDone     chan struct{}
+	closeOnce      sync.Once
+	closeErr       error
 }
 
+const (
+	defaultSpoolDirectory      = "data/spool"
+	defaultSpoolSegmentSize    = 64 * 1024 * 1024
+	defaultSpoolMaxSize        = 2 * 1024 * 1024 * 1024
+	defaultSpoolMaxAge         = 24 * time.Hour
+	defaultSpoolReplayInterval = 5 * time.Second
+	defaultSpoolReplayBatch    = 500
+)
+
 func NewQueueService(kafkaProducer kafka.ProducerInterface, logger logging.Logger, cfg *config.Config) QueueServiceInterface {
-	return &QueueService{
+	service := &QueueService{
 		logger:        logger,
 		config:        cfg,
 		kafkaProducer: kafkaProducer,
@@ -42,7 +66,23 @@ func NewQueueService(kafkaProducer kafka.ProducerInterface, logger logging.Logge
 		maxSize:       cfg.Queue.MaxSize,
 		flushInterval: cfg.Queue.FlushInterval,
 		lastFlush:     time.Now(),
+		spoolConfig:   spoolConfigWithDefaults(cfg.Queue.Spool),
+	}
+
+	if service.spoolConfig.Enabled {
+		spool, err := openDiskSpool(service.spoolConfig.Directory, service.spoolConfig.SegmentSize, service.spoolConfig.MaxSize, service.spoolConfig.MaxAge)
+		if err != nil {
+			logger.Error("Failed to open disk spool, continuing without it", "directory", service.spoolConfig.Directory, "error", err)
+		} else {
+			service.spool = spool
+			service.stopReplay = make(chan struct{})
+			service.replayDone = make(chan struct{})
+			logger.Info("Disk spool opened", "directory", service.spoolConfig.Directory, "pending", spool.depth())
+			go service.startSpoolReplay()
+		}
 	}
+
+	return service
 }
 
 func (s *QueueService) Enqueue(ctx context.Context, data *models.TrafficData) error {
@@ -50,7 +90,17 @@ func (s *QueueService) Enqueue(ctx context.Context, data *models.TrafficData) er
 	defer s.mutex.Unlock()
 
 	if len(s.queue) >= s.maxSize {
-		return fmt.Errorf("queue is full")
+		if s.spool == nil {
+			return fmt.Errorf("queue is full")
+		}
+		// Spill the in-memory queue behind anything already spooled so order is kept
+		items := append(s.queue, data)
+		if err := s.spoolItems(items); err != nil {
+			return fmt.Errorf("queue is full and spooling failed: %w", err)
+		}
+		s.queue = make([]*models.TrafficData, 0, s.maxSize)
+		s.logger.Warn("Queue full, spilled to disk spool", "count", len(items), "spool_depth", s.spool.depth())
+		return nil
 	}
 
 	s.queue = append(s.queue, data)
@@ -73,49 +123,115 @@ func (s *QueueService) Dequeue(ctx context.Context) (*models.TrafficData, error)
 }
 
 func (s *QueueService) Flush(ctx context.Context) error {
+	s.flushMutex.Lock()
+	defer s.flushMutex.Unlock()
+
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	items := s.queue
+	s.queue = make([]*models.TrafficData, 0, s.maxSize)
+	s.mutex.Unlock()
 
-	if len(s.queue) == 0 {
+	spoolPending := s.spool != nil && s.spool.depth() > 0
+	if len(items) == 0 && !spoolPending {
 		s.logger.Info("Queue is empty, nothing to flush")
 		return nil
 	}
 
-	// Batch publish to Kafka
-	batch := &models.BatchTrafficData{
-		ID:        fmt.Sprintf("batch-%d", time.Now().UnixNano()),
-		Timestamp: time.Now(),
-		Count:     len(s.queue),
-		Data:      make([]models.TrafficData, len(s.queue)),
-		Status:    "flushed",
+	// Anything spooled must reach Kafka first, so new items go behind it
+	if spoolPending || (s.spool != nil && s.kafkaProducer == nil) {
+		if err := s.spoolFlushed(items); err != nil {
+			return err
+		}
+		return s.replaySpool(ctx)
 	}
-	for i, item := range s.queue {
-		batch.Data[i] = *item
+
+	if len(items) == 0 {
+		return nil
 	}
 
-	data, err := json.Marshal(batch)
+	batch := make([]models.TrafficData, len(items))
+	for i, item := range items {
+		batch[i] = *item
+	}
+
+	batchID, err := s.produceBatch(ctx, batch)
 	if err != nil {
-		s.logger.Error("Failed to marshal batch for Kafka", "error", err)
-		return err
+		s.logger.Error("Failed to produce batch to Kafka", "error", err)
+		if s.spool == nil {
+			s.requeue(items)
+			return err
+		}
+		return s.spoolFlushed(items)
 	}
 
-	message := kafka.Message{
-		Topic: s.config.Ingestion.Topics.APITraffic,
-		Key:   []byte(batch.ID),
-		Value: data,
+	s.logger.Info("Flushed queue to Kafka", "batch_id", batchID, "count", len(batch))
+	return nil
+}
+
+// Publish sends records to the traffic topic. With a spool, records are written
+// to disk instead when Kafka is unavailable or earlier records are still waiting
+// to be replayed, so a nil error means the records are either in Kafka or on disk.
+func (s *QueueService) Publish(ctx context.Context, items []models.TrafficData) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if s.spool == nil {
+		return s.produceRecords(ctx, items)
 	}
 
-	if err := s.kafkaProducer.Produce(ctx, message); err != nil {
-		s.logger.Error("Failed to produce batch to Kafka", "error", err)
-		return err
+	// Replay sends spooled records first, so new ones queue up behind them
+	if s.spool.depth() == 0 && s.kafkaProducer != nil {
+		err := s.produceRecords(ctx, items)
+		if err == nil {
+			return nil
+		}
+		s.logger.Warn("Kafka unavailable, spooling traffic to disk", "count", len(items), "error", err)
 	}
 
-	s.logger.Info("Flushed queue to Kafka", "batch_id", batch.ID, "count", batch.Count)
-	s.queue = s.queue[:0]
-	s.lastFlush = time.Now()
+	pending := make([]*models.TrafficData, len(items))
+	for i := range items {
+		pending[i] = &items[i]
+	}
+	if err := s.spoolItems(pending); err != nil {
+		s.logger.Error("Failed to spool traffic", "count", len(items), "error", err)
+		return fmt.Errorf("failed to spool traffic: %w", err)
+	}
 	return nil
 }
 
+// Close drains the queue for shutdown: queued records are flushed, the spool is
+// replayed while ctx allows and then closed. Records Kafka did not take stay in
+// the spool for the next start. Later calls return the first call's result.
+func (s *QueueService) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() { s.closeErr = s.close(ctx) })
+	return s.closeErr
+}
+
+func (s *QueueService) close(ctx context.Context) error {
+	if s.stopReplay != nil {
+		close(s.stopReplay)
+		<-s.replayDone
+	}
+
+	err := s.Flush(ctx)
+	if s.spool == nil {
+		return err
+	}
+
+	s.flushMutex.Lock()
+	defer s.flushMutex.Unlock()
+	if err == nil && s.spool.depth() > 0 {
+		err = s.replaySpool(ctx)
+	}
+	if depth := s.spool.depth(); depth > 0 {
+		s.logger.Warn("Closing disk spool with records left to replay", "pending", depth)
+	}
+	if closeErr := s.spool.close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
 func (s *QueueService) GetQueueStatus(ctx context.Context) (*models.QueueStatus, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -136,6 +252,42 @@ func (s *QueueService) GetQueueStatus(ctx context.Context) (*models.QueueStatus,
 		Errors:        []string{},
 		Metrics:       map[string]interface{}{},
 	}
+
+	if s.lastKafkaError != "" {
+		status.Errors = append(status.Errors, s.lastKafkaError)
+	}
+
+	if s.spool != nil {
+		stats := s.spool.stats()
+		spoolStatus := &models.SpoolStatus{
+			Enabled:        true,
+			Depth:          stats.Records,
+			Bytes:          stats.Bytes,
+			Segments:       stats.Segments,
+			MaxBytes:       s.spoolConfig.MaxSize,
+			Dropped:        stats.Dropped,
+			Corrupted:      stats.Corrupted,
+			Replaying:      s.replaying,
+			KafkaAvailable: s.kafkaProducer != nil && s.lastKafkaError == "",
+		}
+		if !stats.Oldest.IsZero() {
+			oldest := stats.Oldest
+			spoolStatus.OldestRecord = &oldest
+		}
+		if !s.lastReplay.IsZero() {
+			lastReplay := s.lastReplay
+			spoolStatus.LastReplay = &lastReplay
+		}
+		status.Spool = spoolStatus
+		status.Pending += stats.Records
+		status.Metrics["spool_depth"] = stats.Records
+		status.Metrics["spool_bytes"] = stats.Bytes
+		status.Metrics["spool_dropped"] = stats.Dropped
+		if stats.Records > 0 {
+			status.Health = "degraded"
+		}
+	}
+
 	return status, nil
 }
 
@@ -176,4 +328,224 @@ func (s *QueueService) UpdateConfiguration(ctx context.Context, config interface
 
 	s.logger.Info("Queue configuration updated")
 	return nil
-} 
\ No newline at end of file
+}
+
+// Helper methods
+
+func spoolConfigWithDefaults(cfg config.SpoolConfig) config.SpoolConfig {
+	if cfg.Directory == "" {
+		cfg.Directory = defaultSpoolDirectory
+	}
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = defaultSpoolSegmentSize
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = defaultSpoolMaxSize
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = defaultSpoolMaxAge
+	}
+	if cfg.ReplayInterval <= 0 {
+		cfg.ReplayInterval = defaultSpoolReplayInterval
+	}
+	if cfg.ReplayBatch <= 0 {
+		cfg.ReplayBatch = defaultSpoolReplayBatch
+	}
+	return cfg
+}
+
+// produceBatch publishes items to the traffic topic as a single batch message
+func (s *QueueService) produceBatch(ctx context.Context, items []models.TrafficData) (string, error) {
+	if s.kafkaProducer == nil {
+		return "", fmt.Errorf("kafka producer is not configured")
+	}
+
+	batch := &models.BatchTrafficData{
+		ID:        fmt.Sprintf("batch-%d", time.Now().UnixNano()),
+		Timestamp: time.Now(),
+		Count:     len(items),
+		Data:      items,
+		Status:    "flushed",
+	}
+
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal batch for Kafka: %w", err)
+	}
+
+	message := kafka.Message{
+		Topic: s.config.Ingestion.Topics.APITraffic,
+		Key:   []byte(batch.ID),
+		Value: data,
+	}
+
+	if err := s.kafkaProducer.Produce(ctx, message); err != nil {
+		s.mutex.Lock()
+		s.lastKafkaError = err.Error()
+		s.mutex.Unlock()
+		return "", err
+	}
+
+	s.mutex.Lock()
+	s.lastKafkaError = ""
+	s.lastFlush = time.Now()
+	s.mutex.Unlock()
+	return batch.ID, nil
+}
+
+// produceRecords publishes a single record on its own, keyed by its ID as
+// consumers expect, and several records as one batch message
+func (s *QueueService) produceRecords(ctx context.Context, items []models.TrafficData) error {
+	if len(items) > 1 {
+		_, err := s.produceBatch(ctx, items)
+		return err
+	}
+	if s.kafkaProducer == nil {
+		return fmt.Errorf("kafka producer is not configured")
+	}
+
+	data, err := json.Marshal(items[0])
+	if err != nil {
+		return fmt.Errorf("failed to marshal traffic data: %w", err)
+	}
+
+	message := kafka.Message{
+		Topic: s.config.Ingestion.Topics.APITraffic,
+		Key:   []byte(items[0].ID),
+		Value: data,
+	}
+
+	if err := s.kafkaProducer.Produce(ctx, message); err != nil {
+		s.mutex.Lock()
+		s.lastKafkaError = err.Error()
+		s.mutex.Unlock()
+		return err
+	}
+
+	s.mutex.Lock()
+	s.lastKafkaError = ""
+	s.mutex.Unlock()
+	return nil
+}
+
+// spoolItems appends items to the disk spool as JSON-encoded TrafficData records
+func (s *QueueService) spoolItems(items []*models.TrafficData) error {
+	payloads := make([][]byte, 0, len(items))
+	for _, item := range items {
+		payload, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("failed to marshal traffic data %s: %w", item.ID, err)
+		}
+		payloads = append(payloads, payload)
+	}
+	return s.spool.append(payloads)
+}
+
+// spoolFlushed spools items taken off the queue by Flush, putting them back on failure
+func (s *QueueService) spoolFlushed(items []*models.TrafficData) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if err := s.spoolItems(items); err != nil {
+		s.logger.Error("Failed to spool queued traffic", "count", len(items), "error", err)
+		s.requeue(items)
+		return err
+	}
+	s.logger.Warn("Spooled queued traffic to disk", "count", len(items), "spool_depth", s.spool.depth())
+	return nil
+}
+
+// requeue puts items back at the front of the in-memory queue
+func (s *QueueService) requeue(items []*models.TrafficData) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.queue = append(items, s.queue...)
+}
+
+// replaySpool drains the spool to Kafka in batches, stopping at the first failure.
+// Callers must hold flushMutex.
+func (s *QueueService) replaySpool(ctx context.Context) error {
+	if s.spool == nil || s.kafkaProducer == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	s.replaying = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		s.replaying = false
+		s.lastReplay = time.Now()
+		s.mutex.Unlock()
+	}()
+
+	replayed := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		payloads, position, err := s.spool.peek(s.spoolConfig.ReplayBatch)
+		if err != nil {
+			return fmt.Errorf("failed to read disk spool: %w", err)
+		}
+		if len(payloads) == 0 {
+			// Still advance past any corrupt tail that peek skipped
+			if err := s.spool.commit(position, 0); err != nil {
+				return err
+			}
+			break
+		}
+
+		items := make([]models.TrafficData, 0, len(payloads))
+		for _, payload := range payloads {
+			var item models.TrafficData
+			if err := json.Unmarshal(payload, &item); err != nil {
+				s.logger.Warn("Skipping undecodable spool record", "error", err)
+				continue
+			}
+			items = append(items, item)
+		}
+
+		if len(items) > 0 {
+			if _, err := s.produceBatch(ctx, items); err != nil {
+				s.logger.Warn("Spool replay paused, Kafka unavailable", "replayed", replayed, "error", err)
+				return err
+			}
+		}
+
+		if err := s.spool.commit(position, len(payloads)); err != nil {
+			return fmt.Errorf("failed to commit spool position: %w", err)
+		}
+		replayed += len(items)
+	}
+
+	if replayed > 0 {
+		s.logger.Info("Replayed disk spool to Kafka", "count", replayed)
+	}
+	return nil
+}
+
+func (s *QueueService) startSpoolReplay() {
+	defer close(s.replayDone)
+
+	ticker := time.NewTicker(s.spoolConfig.ReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopReplay:
+			return
+		case <-ticker.C:
+		}
+
+		s.spool.expire()
+		if s.spool.depth() == 0 {
+			continue
+		}
+
+		s.flushMutex.Lock()
+		s.replaySpool(context.Background())
+		s.flushMutex.Unlock()
+	}
+}
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+)
+
+const redactedPrefix = "redacted:"
+
+var defaultRedactedHeaders = []string{
+	"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+	"X-Api-Key", "X-Auth-Token", "X-Csrf-Token", "X-Amz-Security-Token",
+}
+
+var defaultRedactedQuery = []string{
+	"api_key", "apikey", "key", "access_token", "refresh_token", "id_token",
+	"token", "password", "passwd", "secret", "client_secret", "signature", "sig",
+}
+
+var defaultRedactedPaths = []string{
+	"$..password", "$..passwd", "$..secret", "$..client_secret", "$..token",
+	"$..access_token", "$..refresh_token", "$..id_token", "$..api_key", "$..apiKey",
+}
+
+var defaultRedactionPatterns = []config.RedactionPattern{
+	{Name: "jwt", Regex: `eyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`},
+	{Name: "bearer", Regex: `(?i)\bbearer\s+([A-Za-z0-9\-._~+/]{8,}=*)`},
+	{Name: "aws_access_key", Regex: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{Name: "private_key", Regex: `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]+?-----END [A-Z ]*PRIVATE KEY-----`},
+}
+
+// redactor replaces secrets in traffic records with stable keyed hashes, so equal
+// secrets still correlate across records without being readable
+type redactor struct {
+	key          []byte
+	ephemeralKey bool
+	headers      map[string]bool
+	query        map[string]bool
+	paths        []*jsonPath
+	fieldNames   map[string]bool // names from $..name paths, matched against parsed fields
+	patterns     []redactionPattern
+}
+
+type redactionPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// compileRedactor returns nil when redaction is disabled. Without a configured key
+// a random one is generated, so hashes only correlate until the next restart.
+func compileRedactor(cfg config.RedactionConfig) (*redactor, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	r := &redactor{
+		key:        []byte(cfg.Key),
+		headers:    lowerSet(withDefault(cfg.Headers, defaultRedactedHeaders)),
+		query:      lowerSet(withDefault(cfg.Query, defaultRedactedQuery)),
+		fieldNames: make(map[string]bool),
+	}
+	if len(r.key) == 0 {
+		r.key = make([]byte, 32)
+		if _, err := rand.Read(r.key); err != nil {
+			return nil, fmt.Errorf("failed to generate redaction key: %w", err)
+		}
+		r.ephemeralKey = true
+	}
+
+	for _, expression := range withDefault(cfg.Paths, defaultRedactedPaths) {
+		path, err := compileJSONPath(expression)
+		if err != nil {
+			return nil, err
+		}
+		r.paths = append(r.paths, path)
+		if name := strings.TrimPrefix(expression, "$.."); name != expression && !strings.ContainsAny(name, ".[*") {
+			r.fieldNames[strings.ToLower(name)] = true
+		}
+	}
+
+	patterns := cfg.Patterns
+	if len(patterns) == 0 {
+		patterns = defaultRedactionPatterns
+	}
+	for i, pattern := range patterns {
+		re, err := regexp.Compile(pattern.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern.Name, err)
+		}
+		name := pattern.Name
+		if name == "" {
+			name = fmt.Sprintf("pattern-%d", i+1)
+		}
+		r.patterns = append(r.patterns, redactionPattern{name: name, re: re})
+	}
+
+	return r, nil
+}
+
+// redact rewrites secrets in data in place and stamps data.Redacted with the
+// locations that were changed, such as "header:authorization", "query:token",
+// "body:$..password" or "response_body:pattern:jwt"
+func (r *redactor) redact(data *models.TrafficData) []string {
+	if r == nil {
+		return nil
+	}
+	found := make(map[string]bool)
+
+	r.redactHeaders(data.Headers, "header", found)
+	r.redactHeaders(data.ResponseHeaders, "response_header", found)
+	r.redactValues(data.QueryParams, "query", found)
+	data.URL = r.redactURL(data.URL, found)
+	data.Path = r.redactText(data.Path, "path", found)
+	contentType := data.ContentType
+	if contentType == "" {
+		contentType = headerValue(data.Headers, "Content-Type")
+	}
+	r.redactBody(&data.Body, &data.BodyText, contentType, "body", found)
+	r.redactBody(&data.ResponseBody, &data.ResponseText, headerValue(data.ResponseHeaders, "Content-Type"), "response_body", found)
+
+	if len(found) == 0 {
+		return nil
+	}
+	locations := make([]string, 0, len(found))
+	for location := range found {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	data.Redacted = locations
+	return locations
+}
+
+// hash returns a keyed hash of value that is stable for a given key
+func (r *redactor) hash(value string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(value))
+	return redactedPrefix + hex.EncodeToString(mac.Sum(nil)[:12])
+}
+
+func (r *redactor) redactHeaders(headers map[string]string, location string, found map[string]bool) {
+	for name, value := range headers {
+		if value == "" || strings.HasPrefix(value, redactedPrefix) {
+			continue
+		}
+		lower := strings.ToLower(name)
+		if r.headers[lower] {
+			headers[name] = r.hash(value)
+			found[location+":"+lower] = true
+			continue
+		}
+		headers[name] = r.redactText(value, location+":"+lower, found)
+	}
+}
+
+func (r *redactor) redactValues(values map[string]string, location string, found map[string]bool) {
+	for name, value := range values {
+		if value == "" || strings.HasPrefix(value, redactedPrefix) {
+			continue
+		}
+		if r.query[strings.ToLower(name)] {
+			values[name] = r.hash(value)
+			found[location+":"+name] = true
+			continue
+		}
+		values[name] = r.redactText(value, location+":"+name, found)
+	}
+}
+
+// redactURL hashes listed query parameters in the URL and applies the patterns
+// to the rest of it
+func (r *redactor) redactURL(rawURL string, found map[string]bool) string {
+	if rawURL == "" {
+		return rawURL
+	}
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.RawQuery != "" {
+		if query, err := url.ParseQuery(parsed.RawQuery); err == nil && r.redactForm(query, "query", found) {
+			parsed.RawQuery = query.Encode()
+			rawURL = parsed.String()
+		}
+	}
+	return r.redactText(rawURL, "url", found)
+}
+
+// redactForm hashes listed names in url.Values, applies the patterns to the other
+// decoded values and reports whether any changed. Field names from $..name paths
+// count as listed, matching how parsed form fields are redacted.
+func (r *redactor) redactForm(values url.Values, location string, found map[string]bool) bool {
+	changed := false
+	for name, list := range values {
+		listed := r.query[strings.ToLower(name)] || r.fieldNames[strings.ToLower(name)]
+		for i, value := range list {
+			if value == "" || strings.HasPrefix(value, redactedPrefix) {
+				continue
+			}
+			if listed {
+				list[i] = r.hash(value)
+				found[location+":"+name] = true
+			} else {
+				list[i] = r.redactText(value, location+":"+name, found)
+			}
+			changed = changed || list[i] != value
+		}
+	}
+	return changed
+}
+
+// redactBody redacts JSON paths in JSON bodies, listed fields in form bodies and
+// patterns in any text body. Binary bodies are left untouched.
+func (r *redactor) redactBody(body *[]byte, text *string, contentType string, location string, found map[string]bool) {
+	if len(*body) > 0 && utf8.Valid(*body) {
+		original := string(*body)
+		if redacted := r.redactBodyText(original, contentType, location, found); redacted != original {
+			*body = []byte(redacted)
+		}
+	}
+	if *text != "" {
+		*text = r.redactBodyText(*text, contentType, location, found)
+	}
+}
+
+func (r *redactor) redactBodyText(body string, contentType string, location string, found map[string]bool) string {
+	trimmed := strings.TrimSpace(body)
+	switch {
+	case formatForMediaType(mediaType(contentType)) == "ndjson":
+		// Each line is its own document; redacting the body as one would drop all but the first
+		lines := strings.Split(body, "\n")
+		for i, line := range lines {
+			if strings.TrimSpace(line) != "" {
+				lines[i] = r.redactJSON(line, location, found)
+			}
+		}
+		body = strings.Join(lines, "\n")
+	case strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "["):
+		body = r.redactJSON(body, location, found)
+	case strings.Contains(strings.ToLower(contentType), "application/x-www-form-urlencoded"):
+		if values, err := url.ParseQuery(body); err == nil && r.redactForm(values, location+":form", found) {
+			body = values.Encode()
+		}
+	}
+	return r.redactText(body, location, found)
+}
+
+func (r *redactor) redactJSON(body string, location string, found map[string]bool) string {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return body
+	}
+
+	changed := false
+	for _, path := range r.paths {
+		var count int
+		doc, count = path.replace(doc, func(value interface{}) interface{} {
+			if s, ok := value.(string); ok {
+				if strings.HasPrefix(s, redactedPrefix) {
+					return s
+				}
+				return r.hash(s)
+			}
+			if value == nil {
+				return nil
+			}
+			encoded, _ := json.Marshal(value)
+			return r.hash(string(encoded))
+		})
+		if count > 0 {
+			found[location+":"+path.expression] = true
+			changed = true
+		}
+	}
+	if !changed {
+		return body
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		return body
+	}
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// redactFields hashes parsed field values whose names are listed for redaction
+// and applies the patterns to the rest, reporting whether any value changed. It
+// covers fields in formats such as multipart that redactBody cannot rewrite in
+// place.
+func (r *redactor) redactFields(fields []models.ParsedField, location string, found map[string]bool) bool {
+	if r == nil {
+		return false
+	}
+	changed := false
+	for i := range fields {
+		field := &fields[i]
+		if field.Value == "" || strings.HasPrefix(field.Value, redactedPrefix) {
+			continue
+		}
+		name := strings.ToLower(parsedFieldName(field.Path))
+		if r.query[name] || r.fieldNames[name] {
+			field.Value = r.hash(field.Value)
+			field.Truncated = false
+			found[location+":field:"+name] = true
+			changed = true
+			continue
+		}
+		value := r.redactText(field.Value, location, found)
+		changed = changed || value != field.Value
+		field.Value = value
+	}
+	return changed
+}
+
+// redactText replaces pattern matches, or only their first capture group when the
+// pattern has one
+func (r *redactor) redactText(text string, location string, found map[string]bool) string {
+	if text == "" {
+		return text
+	}
+	for _, pattern := range r.patterns {
+		matches := pattern.re.FindAllStringSubmatchIndex(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		var b strings.Builder
+		last := 0
+		for _, match := range matches {
+			start, end := match[0], match[1]
+			if len(match) >= 4 && match[2] >= 0 {
+				start, end = match[2], match[3]
+			}
+			if start == end || strings.HasPrefix(text[start:end], redactedPrefix) {
+				continue
+			}
+			b.WriteString(text[last:start])
+			b.WriteString(r.hash(text[start:end]))
+			last = end
+		}
+		if last == 0 {
+			continue
+		}
+		b.WriteString(text[last:])
+		text = b.String()
+		found[location+":pattern:"+pattern.name] = true
+	}
+	return text
+}
+
+// Helper functions
+
+// parsedFieldName returns the last name in a field path, e.g. "password" for
+// $.users[0].password[1]
+func parsedFieldName(path string) string {
+	for strings.HasSuffix(path, "]") {
+		i := strings.LastIndexByte(path, '[')
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	if i := strings.LastIndexByte(path, '.'); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+func withDefault(values, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
+
+func lowerSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[strings.ToLower(value)] = true
+	}
+	return set
+}
@@ -0,0 +1,500 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	spoolRecordHeaderSize = 8 // uint32 length + uint32 CRC-32C
+	spoolSegmentSuffix    = ".seg"
+	spoolCursorFile       = "cursor"
+	maxSpoolRecordSize    = 64 * 1024 * 1024
+)
+
+var spoolChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// diskSpool is an append-only write-ahead log of records split into segment
+// files. Records are read back in the order they were written; a cursor file
+// tracks how far replay has progressed so a restart resumes where it stopped.
+type diskSpool struct {
+	directory   string
+	segmentSize int64
+	maxBytes    int64
+	maxAge      time.Duration
+
+	segments []*spoolSegment // oldest first; the last one is the active segment
+	active   *os.File
+	cursor   spoolPosition
+	records  int
+	bytes    int64
+	dropped  int64
+	corrupt  int64
+	mutex    sync.Mutex
+}
+
+type spoolSegment struct {
+	id        uint64
+	path      string
+	size      int64
+	records   int // records not yet replayed
+	lastWrite time.Time
+}
+
+// spoolPosition addresses a byte offset within a segment
+type spoolPosition struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+type spoolStats struct {
+	Records   int
+	Bytes     int64
+	Segments  int
+	Oldest    time.Time
+	Dropped   int64
+	Corrupted int64
+}
+
+func openDiskSpool(directory string, segmentSize, maxBytes int64, maxAge time.Duration) (*diskSpool, error) {
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	spool := &diskSpool{
+		directory:   directory,
+		segmentSize: segmentSize,
+		maxBytes:    maxBytes,
+		maxAge:      maxAge,
+	}
+
+	if err := spool.loadCursor(); err != nil {
+		return nil, err
+	}
+	if err := spool.loadSegments(); err != nil {
+		return nil, err
+	}
+	return spool, nil
+}
+
+// append writes records to the active segment and syncs them to disk
+func (s *diskSpool) append(payloads [][]byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, payload := range payloads {
+		if len(payload) > maxSpoolRecordSize {
+			return fmt.Errorf("spool record too large: %d bytes", len(payload))
+		}
+
+		segment := s.activeSegment()
+		if segment == nil || (segment.size > 0 && segment.size+int64(spoolRecordHeaderSize+len(payload)) > s.segmentSize) {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+			segment = s.activeSegment()
+		}
+
+		record := make([]byte, spoolRecordHeaderSize+len(payload))
+		binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+		binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(payload, spoolChecksumTable))
+		copy(record[spoolRecordHeaderSize:], payload)
+
+		if _, err := s.active.Write(record); err != nil {
+			return fmt.Errorf("failed to write spool record: %w", err)
+		}
+		segment.size += int64(len(record))
+		segment.records++
+		segment.lastWrite = time.Now()
+		s.records++
+		s.bytes += int64(len(record))
+	}
+
+	if s.active != nil {
+		if err := s.active.Sync(); err != nil {
+			return fmt.Errorf("failed to sync spool segment: %w", err)
+		}
+	}
+
+	s.enforceLimits()
+	return nil
+}
+
+// peek returns up to max unreplayed records and the position just past them
+func (s *diskSpool) peek(max int) ([][]byte, spoolPosition, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var payloads [][]byte
+	position := s.cursor
+
+	for _, segment := range s.segments {
+		if len(payloads) >= max {
+			break
+		}
+		if segment.id < position.Segment {
+			continue
+		}
+		if segment.id > position.Segment {
+			position = spoolPosition{Segment: segment.id}
+		}
+
+		records, next, err := readSpoolRecords(segment.path, position.Offset, max-len(payloads))
+		if err != nil && err != errSpoolCorrupt {
+			return nil, s.cursor, err
+		}
+		payloads = append(payloads, records...)
+		position.Offset = next
+
+		if err == errSpoolCorrupt {
+			// The rest of the segment cannot be trusted; skip to its end
+			if lost := segment.records - len(records); lost > 0 {
+				segment.records -= lost
+				s.records -= lost
+				s.corrupt += int64(lost)
+			}
+			position.Offset = segment.size
+		}
+	}
+
+	return payloads, position, nil
+}
+
+// commit marks everything before position as replayed
+func (s *diskSpool) commit(position spoolPosition, count int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	remaining := count
+	for _, segment := range s.segments {
+		if remaining == 0 || segment.id > position.Segment {
+			break
+		}
+		consumed := segment.records
+		if consumed > remaining {
+			consumed = remaining
+		}
+		segment.records -= consumed
+		s.records -= consumed
+		remaining -= consumed
+	}
+
+	s.cursor = position
+	s.removeConsumedSegments()
+	return s.saveCursor()
+}
+
+// expire drops segments whose newest record is older than the age cap
+func (s *diskSpool) expire() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.maxAge <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-s.maxAge)
+	for len(s.segments) > 0 && s.segments[0].lastWrite.Before(cutoff) {
+		if len(s.segments) == 1 {
+			if s.segments[0].records == 0 {
+				return
+			}
+			// Seal the active segment so it can be dropped
+			if err := s.rotate(); err != nil {
+				return
+			}
+		}
+		s.dropOldest()
+	}
+}
+
+func (s *diskSpool) stats() spoolStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := spoolStats{
+		Records:   s.records,
+		Bytes:     s.bytes,
+		Segments:  len(s.segments),
+		Dropped:   s.dropped,
+		Corrupted: s.corrupt,
+	}
+	for _, segment := range s.segments {
+		if segment.records > 0 {
+			stats.Oldest = segment.lastWrite
+			break
+		}
+	}
+	return stats
+}
+
+func (s *diskSpool) depth() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.records
+}
+
+func (s *diskSpool) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
+
+// Helper methods
+
+var errSpoolCorrupt = fmt.Errorf("corrupt spool record")
+
+// readSpoolRecords reads up to max records from a segment starting at offset.
+// It returns the records, the offset after the last good record and
+// errSpoolCorrupt if a record failed its checksum or was truncated.
+func readSpoolRecords(path string, offset int64, max int) ([][]byte, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, offset, fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, fmt.Errorf("failed to seek spool segment: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	var records [][]byte
+	header := make([]byte, spoolRecordHeaderSize)
+	for len(records) < max {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return records, offset, nil
+			}
+			return records, offset, errSpoolCorrupt
+		}
+
+		length := binary.BigEndian.Uint32(header[0:4])
+		if length > maxSpoolRecordSize {
+			return records, offset, errSpoolCorrupt
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return records, offset, errSpoolCorrupt
+		}
+		if crc32.Checksum(payload, spoolChecksumTable) != binary.BigEndian.Uint32(header[4:8]) {
+			return records, offset, errSpoolCorrupt
+		}
+
+		records = append(records, payload)
+		offset += int64(spoolRecordHeaderSize) + int64(length)
+	}
+	return records, offset, nil
+}
+
+func (s *diskSpool) activeSegment() *spoolSegment {
+	if len(s.segments) == 0 || s.active == nil {
+		return nil
+	}
+	return s.segments[len(s.segments)-1]
+}
+
+func (s *diskSpool) rotate() error {
+	if s.active != nil {
+		if err := s.active.Close(); err != nil {
+			return fmt.Errorf("failed to close spool segment: %w", err)
+		}
+		s.active = nil
+	}
+
+	var id uint64 = 1
+	if len(s.segments) > 0 {
+		id = s.segments[len(s.segments)-1].id + 1
+	} else if s.cursor.Segment >= id {
+		id = s.cursor.Segment + 1
+	}
+
+	path := filepath.Join(s.directory, fmt.Sprintf("%020d%s", id, spoolSegmentSuffix))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create spool segment: %w", err)
+	}
+
+	s.active = file
+	s.segments = append(s.segments, &spoolSegment{id: id, path: path, lastWrite: time.Now()})
+	return nil
+}
+
+// enforceLimits drops the oldest sealed segments while the spool exceeds its size cap
+func (s *diskSpool) enforceLimits() {
+	for s.maxBytes > 0 && s.bytes > s.maxBytes && len(s.segments) > 1 {
+		s.dropOldest()
+	}
+}
+
+func (s *diskSpool) dropOldest() {
+	oldest := s.segments[0]
+	os.Remove(oldest.path)
+
+	s.segments = s.segments[1:]
+	s.records -= oldest.records
+	s.bytes -= oldest.size
+	s.dropped += int64(oldest.records)
+
+	if s.cursor.Segment <= oldest.id {
+		if len(s.segments) > 0 {
+			s.cursor = spoolPosition{Segment: s.segments[0].id}
+		} else {
+			s.cursor = spoolPosition{Segment: oldest.id + 1}
+		}
+		s.saveCursor()
+	}
+}
+
+// removeConsumedSegments deletes sealed segments that replay has moved past
+func (s *diskSpool) removeConsumedSegments() {
+	for len(s.segments) > 1 && s.segments[0].id < s.cursor.Segment {
+		oldest := s.segments[0]
+		os.Remove(oldest.path)
+		s.segments = s.segments[1:]
+		s.bytes -= oldest.size
+	}
+
+	// A fully replayed active segment is truncated rather than deleted
+	if len(s.segments) == 1 && s.segments[0].records == 0 && s.cursor.Segment == s.segments[0].id && s.cursor.Offset == s.segments[0].size && s.active != nil {
+		if err := s.active.Truncate(0); err == nil {
+			s.bytes -= s.segments[0].size
+			s.segments[0].size = 0
+			s.cursor.Offset = 0
+		}
+	}
+}
+
+func (s *diskSpool) loadSegments() error {
+	entries, err := os.ReadDir(s.directory)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSegmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(s.directory, name)
+
+		if id < s.cursor.Segment {
+			// Fully replayed before the last shutdown
+			os.Remove(path)
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat spool segment: %w", err)
+		}
+		s.segments = append(s.segments, &spoolSegment{id: id, path: path, size: info.Size(), lastWrite: info.ModTime()})
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].id < s.segments[j].id })
+
+	for i, segment := range s.segments {
+		start := int64(0)
+		if segment.id == s.cursor.Segment {
+			start = s.cursor.Offset
+		}
+
+		count, end, err := countSpoolRecords(segment.path, start)
+		if err != nil {
+			return err
+		}
+		segment.records = count
+
+		if end < segment.size {
+			if i == len(s.segments)-1 {
+				// Torn write at the tail of the newest segment; cut it off
+				if err := os.Truncate(segment.path, end); err != nil {
+					return fmt.Errorf("failed to repair spool segment: %w", err)
+				}
+				segment.size = end
+			} else {
+				s.corrupt++
+			}
+		}
+
+		s.records += segment.records
+		s.bytes += segment.size
+	}
+
+	if len(s.segments) > 0 {
+		newest := s.segments[len(s.segments)-1]
+		file, err := os.OpenFile(newest.path, os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open spool segment: %w", err)
+		}
+		s.active = file
+	}
+	return nil
+}
+
+func countSpoolRecords(path string, offset int64) (int, int64, error) {
+	count := 0
+	for {
+		records, next, err := readSpoolRecords(path, offset, 1024)
+		count += len(records)
+		offset = next
+		if err == errSpoolCorrupt {
+			return count, offset, nil
+		}
+		if err != nil {
+			return count, offset, err
+		}
+		if len(records) == 0 {
+			return count, offset, nil
+		}
+	}
+}
+
+func (s *diskSpool) loadCursor() error {
+	data, err := os.ReadFile(filepath.Join(s.directory, spoolCursorFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read spool cursor: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.cursor); err != nil {
+		// Replaying from the start duplicates records but loses none
+		s.cursor = spoolPosition{}
+	}
+	return nil
+}
+
+func (s *diskSpool) saveCursor() error {
+	data, err := json.Marshal(s.cursor)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.directory, spoolCursorFile)
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write spool cursor: %w", err)
+	}
+	return os.Rename(temp, path)
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/shared/logging"
+	"scopeapi.local/backend/shared/messaging/kafka"
+)
+
+func spoolPayloads(prefix string, count int) [][]byte {
+	payloads := make([][]byte, count)
+	for i := range payloads {
+		payloads[i] = []byte(fmt.Sprintf("%s-%d", prefix, i))
+	}
+	return payloads
+}
+
+func TestDiskSpool_ReplayResumesAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := openDiskSpool(dir, 64, 1<<20, time.Hour)
+	if err != nil {
+		t.Fatalf("openDiskSpool: %v", err)
+	}
+	if err := spool.append(spoolPayloads("rec", 10)); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if stats := spool.stats(); stats.Records != 10 || stats.Segments < 2 {
+		t.Fatalf("expected records across several segments, got %+v", stats)
+	}
+
+	records, position, err := spool.peek(4)
+	if err != nil || len(records) != 4 || string(records[0]) != "rec-0" {
+		t.Fatalf("unexpected peek: %q %v", records, err)
+	}
+	if err := spool.commit(position, len(records)); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	spool.close()
+
+	reopened, err := openDiskSpool(dir, 64, 1<<20, time.Hour)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.close()
+	if reopened.depth() != 6 {
+		t.Fatalf("expected 6 pending records after reopen, got %d", reopened.depth())
+	}
+
+	records, position, err = reopened.peek(100)
+	if err != nil || len(records) != 6 || string(records[0]) != "rec-4" || string(records[5]) != "rec-9" {
+		t.Fatalf("unexpected replay after reopen: %q %v", records, err)
+	}
+	if err := reopened.commit(position, len(records)); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if reopened.depth() != 0 {
+		t.Fatalf("expected empty spool, got %d", reopened.depth())
+	}
+
+	// New appends after a full drain must still be replayed
+	if err := reopened.append(spoolPayloads("late", 1)); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	records, _, _ = reopened.peek(10)
+	if len(records) != 1 || string(records[0]) != "late-0" {
+		t.Fatalf("unexpected records after drain: %q", records)
+	}
+}
+
+func TestDiskSpool_TornTailIsRepaired(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := openDiskSpool(dir, 1<<20, 1<<20, time.Hour)
+	if err != nil {
+		t.Fatalf("openDiskSpool: %v", err)
+	}
+	if err := spool.append(spoolPayloads("rec", 3)); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	spool.close()
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentSuffix))
+	if len(segments) != 1 {
+		t.Fatalf("expected one segment, got %v", segments)
+	}
+	file, err := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open segment: %v", err)
+	}
+	// Simulate a crash part way through writing a record
+	file.Write([]byte{0, 0, 0, 9, 1, 2})
+	file.Close()
+
+	reopened, err := openDiskSpool(dir, 1<<20, 1<<20, time.Hour)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.close()
+	if reopened.depth() != 3 {
+		t.Fatalf("expected 3 intact records, got %d", reopened.depth())
+	}
+	if err := reopened.append(spoolPayloads("next", 1)); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	records, _, err := reopened.peek(10)
+	if err != nil || len(records) != 4 || string(records[3]) != "next-0" {
+		t.Fatalf("unexpected records: %q %v", records, err)
+	}
+}
+
+func TestDiskSpool_SizeCapDropsOldest(t *testing.T) {
+	spool, err := openDiskSpool(t.TempDir(), 64, 200, time.Hour)
+	if err != nil {
+		t.Fatalf("openDiskSpool: %v", err)
+	}
+	defer spool.close()
+
+	if err := spool.append(spoolPayloads("rec", 40)); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	stats := spool.stats()
+	if stats.Bytes > 200+64 || stats.Dropped == 0 {
+		t.Fatalf("expected oldest segments to be dropped, got %+v", stats)
+	}
+	records, _, _ := spool.peek(100)
+	if len(records) != stats.Records || string(records[len(records)-1]) != "rec-39" {
+		t.Fatalf("expected newest records to survive, got %q", records)
+	}
+}
+
+// switchableProducer fails every produce while down
+type switchableProducer struct {
+	mutex    sync.Mutex
+	down     bool
+	messages []kafka.Message
+}
+
+func (p *switchableProducer) setDown(down bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.down = down
+}
+
+func (p *switchableProducer) Produce(ctx context.Context, message kafka.Message) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.down {
+		return errors.New("broker unavailable")
+	}
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+func (p *switchableProducer) Close() error { return nil }
+
+func TestQueueService_PublishSpoolsWhileKafkaIsDownAndDrainsOnClose(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Queue.MaxSize = 10
+	cfg.Queue.Spool.Enabled = true
+	cfg.Queue.Spool.Directory = t.TempDir()
+	cfg.Queue.Spool.ReplayInterval = time.Hour
+	cfg.Ingestion.Topics.APITraffic = "api_traffic"
+	producer := &switchableProducer{down: true}
+	queue := NewQueueService(producer, logging.NewStructuredLogger("test"), cfg)
+	ctx := context.Background()
+
+	if err := queue.Publish(ctx, []models.TrafficData{{ID: "a"}, {ID: "b"}}); err != nil {
+		t.Fatalf("expected records to be spooled, got %v", err)
+	}
+
+	// Once Kafka is back, new records still wait behind the spooled ones
+	producer.setDown(false)
+	if err := queue.Publish(ctx, []models.TrafficData{{ID: "c"}}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if len(producer.messages) != 0 {
+		t.Fatalf("expected nothing produced ahead of the spool, got %d messages", len(producer.messages))
+	}
+	status, _ := queue.GetQueueStatus(ctx)
+	if status.Spool == nil || status.Spool.Depth != 3 {
+		t.Fatalf("expected 3 spooled records, got %+v", status.Spool)
+	}
+
+	if err := queue.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(producer.messages) != 1 {
+		t.Fatalf("expected the spool to be replayed as one batch, got %d messages", len(producer.messages))
+	}
+	var batch models.BatchTrafficData
+	if err := json.Unmarshal(producer.messages[0].Value, &batch); err != nil || batch.Count != 3 || batch.Data[2].ID != "c" {
+		t.Fatalf("unexpected replayed batch: %+v %v", batch, err)
+	}
+
+	// The shutdown path and a deferred Close may both close the queue
+	if err := queue.Close(ctx); err != nil || len(producer.messages) != 1 {
+		t.Fatalf("second Close = %v with %d messages", err, len(producer.messages))
+	}
+}
+
+func TestDataIngestionService_PublishesSingleRecordsThroughQueue(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Queue.MaxSize = 10
+	cfg.Ingestion.Topics.APITraffic = "api_traffic"
+	producer := &switchableProducer{}
+	logger := logging.NewStructuredLogger("test")
+	queue := NewQueueService(producer, logger, cfg)
+	service := NewDataIngestionService(queue, nil, NewDataParserService(logger, cfg), logger, cfg)
+
+	response, err := service.IngestTraffic(context.Background(), &models.IngestionRequest{
+		ID:   "req-1",
+		Data: models.TrafficData{ID: "t-1", Method: "GET", URL: "http://api.example.com/users"},
+	})
+	if err != nil || response.Status != "success" {
+		t.Fatalf("IngestTraffic: %+v %v", response, err)
+	}
+	if len(producer.messages) != 1 || string(producer.messages[0].Key) != response.TrafficIDs[0] {
+		t.Fatalf("expected one record keyed by its ID, got %+v", producer.messages)
+	}
+}
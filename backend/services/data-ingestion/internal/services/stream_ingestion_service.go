@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+const (
+	defaultStreamMaxStreams      = 100
+	defaultStreamWindow          = 16
+	defaultStreamMaxBatchRecords = 1000
+	defaultStreamSlowThreshold   = 0.7
+	defaultStreamPauseThreshold  = 0.9
+	defaultStreamPollInterval    = 250 * time.Millisecond
+
+	// maxStreamErrors bounds the errors kept per stream
+	maxStreamErrors = 100
+)
+
+type StreamIngestionServiceInterface interface {
+	OpenStream(ctx context.Context, transport string, client string) (*IngestStream, error)
+	GetBackpressure(ctx context.Context) models.BackpressureSignal
+	GetStreams(ctx context.Context) ([]models.StreamInfo, error)
+}
+
+// StreamIngestionService feeds long-lived streaming channels into the ingestion
+// pipeline. Ingested batches are published through the QueueService, so flow
+// control follows its in-memory queue and disk spool.
+type StreamIngestionService struct {
+	ingestionService DataIngestionServiceInterface
+	queueService     QueueServiceInterface
+	logger           logging.Logger
+	config           config.StreamingConfig
+	streams          map[string]*IngestStream
+	mutex            sync.Mutex
+}
+
+func NewStreamIngestionService(ingestionService DataIngestionServiceInterface, queueService QueueServiceInterface, logger logging.Logger, cfg *config.Config) StreamIngestionServiceInterface {
+	return &StreamIngestionService{
+		ingestionService: ingestionService,
+		queueService:     queueService,
+		logger:           logger,
+		config:           streamingConfigWithDefaults(cfg.Streaming),
+		streams:          make(map[string]*IngestStream),
+	}
+}
+
+// OpenStream registers a new stream; callers must Close it when the channel ends
+func (s *StreamIngestionService) OpenStream(ctx context.Context, transport string, client string) (*IngestStream, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.streams) >= s.config.MaxStreams {
+		return nil, fmt.Errorf("too many open streams: limit is %d", s.config.MaxStreams)
+	}
+
+	now := time.Now()
+	stream := &IngestStream{
+		service: s,
+		info: models.StreamInfo{
+			ID:           uuid.New().String(),
+			Transport:    transport,
+			Client:       client,
+			OpenedAt:     now,
+			LastActivity: now,
+		},
+	}
+	s.streams[stream.info.ID] = stream
+
+	s.logger.Info("Ingest stream opened", "stream_id", stream.info.ID, "transport", transport, "client", client)
+	return stream, nil
+}
+
+// GetBackpressure maps queue utilization onto a level and a credit window. The
+// spool counts by bytes against its cap, since past the cap it drops the oldest
+// records.
+func (s *StreamIngestionService) GetBackpressure(ctx context.Context) models.BackpressureSignal {
+	signal := models.BackpressureSignal{
+		Level:   models.BackpressureNone,
+		Credits: s.config.Window,
+	}
+
+	status, err := s.queueService.GetQueueStatus(ctx)
+	if err != nil || status == nil {
+		return signal
+	}
+
+	utilization := 0.0
+	if status.MaxSize > 0 {
+		utilization = float64(status.Size) / float64(status.MaxSize)
+	}
+	if status.Spool != nil && status.Spool.MaxBytes > 0 {
+		utilization = math.Max(utilization, float64(status.Spool.Bytes)/float64(status.Spool.MaxBytes))
+	}
+	signal.QueueUtilization = utilization
+
+	switch {
+	case utilization >= s.config.PauseThreshold:
+		signal.Level = models.BackpressurePause
+		signal.Credits = 0
+		signal.RetryAfter = s.config.PollInterval
+	case utilization >= s.config.SlowThreshold:
+		// Shrink the window linearly between the slow and pause thresholds
+		remaining := (s.config.PauseThreshold - utilization) / (s.config.PauseThreshold - s.config.SlowThreshold)
+		signal.Level = models.BackpressureSlow
+		signal.Credits = int(math.Max(1, math.Round(float64(s.config.Window)*remaining)))
+	}
+	return signal
+}
+
+func (s *StreamIngestionService) GetStreams(ctx context.Context) ([]models.StreamInfo, error) {
+	s.mutex.Lock()
+	streams := make([]*IngestStream, 0, len(s.streams))
+	for _, stream := range s.streams {
+		streams = append(streams, stream)
+	}
+	s.mutex.Unlock()
+
+	infos := make([]models.StreamInfo, 0, len(streams))
+	for _, stream := range streams {
+		infos = append(infos, stream.Info())
+	}
+	return infos, nil
+}
+
+// IngestStream tracks sequencing, granted credits and counters for one streaming
+// channel. Submit must not be called concurrently for the same stream.
+type IngestStream struct {
+	service *StreamIngestionService
+	info    models.StreamInfo
+	started bool
+	closed  bool
+	// limit is the highest sequence the client may send under the credits
+	// last granted to it
+	limit uint64
+	mutex sync.Mutex
+}
+
+func (st *IngestStream) ID() string {
+	return st.info.ID
+}
+
+// Submit ingests a batch and returns its acknowledgement. Batches at or below the
+// last acknowledged sequence are acknowledged as duplicates without being ingested.
+// Batches beyond the granted credits are rejected and may be resent once the
+// acknowledgement or a resume signal grants more.
+func (st *IngestStream) Submit(ctx context.Context, batch *models.StreamBatch) *models.StreamAck {
+	ack := &models.StreamAck{Sequence: batch.Sequence}
+
+	st.mutex.Lock()
+	st.info.LastActivity = time.Now()
+	st.info.Batches++
+	duplicate := st.started && batch.Sequence <= st.info.LastSequence
+	throttled := !duplicate && st.started && batch.Sequence > st.limit
+	limit := st.limit
+	if duplicate {
+		st.info.Duplicates++
+	}
+	if throttled {
+		st.info.Throttled++
+	}
+	st.mutex.Unlock()
+
+	switch {
+	case duplicate:
+		ack.Status = models.AckDuplicate
+	case throttled:
+		ack.Status = models.AckRejected
+		ack.Rejected = len(batch.Records)
+		ack.Errors = []string{fmt.Sprintf("sequence %d exceeds granted credits, highest allowed sequence is %d", batch.Sequence, limit)}
+	case len(batch.Records) > st.service.config.MaxBatchRecords:
+		ack.Status = models.AckRejected
+		ack.Rejected = len(batch.Records)
+		ack.Errors = []string{fmt.Sprintf("batch has %d records, limit is %d", len(batch.Records), st.service.config.MaxBatchRecords)}
+	case len(batch.Records) == 0:
+		ack.Status = models.AckAccepted
+	default:
+		st.ingest(ctx, batch, ack)
+	}
+
+	st.mutex.Lock()
+	if ack.Status != models.AckDuplicate && ack.Status != models.AckRejected {
+		st.started = true
+		st.info.LastSequence = batch.Sequence
+	}
+	st.info.Accepted += int64(ack.Accepted)
+	st.info.Rejected += int64(ack.Rejected)
+	for _, message := range ack.Errors {
+		if len(st.info.Errors) >= maxStreamErrors {
+			break
+		}
+		st.info.Errors = append(st.info.Errors, fmt.Sprintf("sequence %d: %s", batch.Sequence, message))
+	}
+	st.mutex.Unlock()
+
+	ack.Backpressure = st.grant(st.service.GetBackpressure(ctx))
+	return ack
+}
+
+// grant records the credits a signal sent to the client allows
+func (st *IngestStream) grant(signal models.BackpressureSignal) models.BackpressureSignal {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.limit = st.info.LastSequence + uint64(signal.Credits)
+	return signal
+}
+
+func (st *IngestStream) ingest(ctx context.Context, batch *models.StreamBatch, ack *models.StreamAck) {
+	response, err := st.service.ingestionService.IngestBatch(ctx, &models.BatchTrafficData{
+		ID:        fmt.Sprintf("%s-%d", st.info.ID, batch.Sequence),
+		Timestamp: time.Now(),
+		Count:     len(batch.Records),
+		Data:      batch.Records,
+		Status:    "pending",
+	})
+	if err != nil {
+		ack.Status = models.AckRejected
+		ack.Rejected = len(batch.Records)
+		ack.Errors = []string{err.Error()}
+		return
+	}
+
+	// Records dropped by ingestion policies were accepted, just not forwarded
+	ack.TrafficIDs = response.TrafficIDs
+	ack.Accepted = len(response.TrafficIDs) + response.Filtered
+	ack.Rejected = len(batch.Records) - ack.Accepted
+	ack.Errors = response.Errors
+
+	switch {
+	case ack.Rejected == 0:
+		ack.Status = models.AckAccepted
+	case ack.Accepted == 0:
+		ack.Status = models.AckRejected
+	default:
+		ack.Status = models.AckPartial
+	}
+}
+
+// WaitForCapacity blocks while the queue is saturated. onPause is called once
+// with the signal that caused the wait so transports can tell the client.
+func (st *IngestStream) WaitForCapacity(ctx context.Context, onPause func(models.BackpressureSignal)) (models.BackpressureSignal, error) {
+	signal := st.service.GetBackpressure(ctx)
+	if signal.Level != models.BackpressurePause {
+		return st.grant(signal), nil
+	}
+	st.grant(signal)
+
+	st.mutex.Lock()
+	st.info.Paused++
+	st.mutex.Unlock()
+	if onPause != nil {
+		onPause(signal)
+	}
+
+	ticker := time.NewTicker(st.service.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return signal, ctx.Err()
+		case <-ticker.C:
+			signal = st.service.GetBackpressure(ctx)
+			if signal.Level != models.BackpressurePause {
+				return st.grant(signal), nil
+			}
+		}
+	}
+}
+
+func (st *IngestStream) Info() models.StreamInfo {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	info := st.info
+	info.Errors = append([]string(nil), st.info.Errors...)
+	return info
+}
+
+// Close unregisters the stream and returns its final counters
+func (st *IngestStream) Close() models.StreamInfo {
+	st.mutex.Lock()
+	alreadyClosed := st.closed
+	st.closed = true
+	st.mutex.Unlock()
+
+	info := st.Info()
+	if alreadyClosed {
+		return info
+	}
+
+	st.service.mutex.Lock()
+	delete(st.service.streams, info.ID)
+	st.service.mutex.Unlock()
+
+	st.service.logger.Info("Ingest stream closed", "stream_id", info.ID, "transport", info.Transport,
+		"batches", info.Batches, "accepted", info.Accepted, "rejected", info.Rejected, "last_sequence", info.LastSequence)
+	return info
+}
+
+// Helper methods
+
+func streamingConfigWithDefaults(cfg config.StreamingConfig) config.StreamingConfig {
+	if cfg.MaxStreams <= 0 {
+		cfg.MaxStreams = defaultStreamMaxStreams
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaultStreamWindow
+	}
+	if cfg.MaxBatchRecords <= 0 {
+		cfg.MaxBatchRecords = defaultStreamMaxBatchRecords
+	}
+	if cfg.PauseThreshold <= 0 {
+		cfg.PauseThreshold = defaultStreamPauseThreshold
+	}
+	if cfg.SlowThreshold <= 0 {
+		cfg.SlowThreshold = defaultStreamSlowThreshold
+	}
+	if cfg.SlowThreshold >= cfg.PauseThreshold {
+		cfg.SlowThreshold = cfg.PauseThreshold * 0.75
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultStreamPollInterval
+	}
+	return cfg
+}
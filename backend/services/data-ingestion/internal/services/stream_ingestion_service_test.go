@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"scopeapi.local/backend/services/data-ingestion/internal/config"
+	"scopeapi.local/backend/services/data-ingestion/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+// fixedDepthQueue reports a configurable queue depth and spool size
+type fixedDepthQueue struct {
+	QueueServiceInterface
+	mutex      sync.Mutex
+	pending    int
+	spoolBytes int64
+}
+
+func (q *fixedDepthQueue) setPending(pending int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.pending = pending
+}
+
+func (q *fixedDepthQueue) setSpoolBytes(bytes int64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.spoolBytes = bytes
+}
+
+func (q *fixedDepthQueue) GetQueueStatus(ctx context.Context) (*models.QueueStatus, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return &models.QueueStatus{
+		MaxSize: 100,
+		Size:    q.pending,
+		Pending: q.pending,
+		Spool:   &models.SpoolStatus{Enabled: true, Bytes: q.spoolBytes, MaxBytes: 1000},
+	}, nil
+}
+
+func newTestStreamService() (*StreamIngestionService, *recordingIngestionService, *fixedDepthQueue) {
+	cfg := &config.Config{}
+	cfg.Streaming.Window = 10
+	cfg.Streaming.MaxStreams = 1
+	cfg.Streaming.PollInterval = time.Millisecond
+	recorder := &recordingIngestionService{}
+	queue := &fixedDepthQueue{}
+	service := NewStreamIngestionService(recorder, queue, logging.NewStructuredLogger("test"), cfg).(*StreamIngestionService)
+	return service, recorder, queue
+}
+
+func streamBatch(sequence uint64, ids ...string) *models.StreamBatch {
+	batch := &models.StreamBatch{Sequence: sequence}
+	for _, id := range ids {
+		batch.Records = append(batch.Records, models.TrafficData{ID: id, Method: "GET", URL: "http://api.example.com/" + id})
+	}
+	return batch
+}
+
+func TestIngestStream_SequencingAndDuplicates(t *testing.T) {
+	service, recorder, _ := newTestStreamService()
+	ctx := context.Background()
+
+	stream, err := service.OpenStream(ctx, "grpc", "10.0.0.1:5000")
+	if err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	if _, err := service.OpenStream(ctx, "grpc", "10.0.0.2:5000"); err == nil {
+		t.Fatal("expected the stream limit to be enforced")
+	}
+
+	ack := stream.Submit(ctx, streamBatch(1, "a", "b"))
+	if ack.Status != models.AckAccepted || ack.Sequence != 1 || ack.Accepted != 2 || ack.Backpressure.Credits != 10 {
+		t.Fatalf("unexpected ack: %+v", ack)
+	}
+
+	// A resend after a reconnect hiccup must not be ingested twice
+	ack = stream.Submit(ctx, streamBatch(1, "a", "b"))
+	if ack.Status != models.AckDuplicate || len(recorder.records) != 2 {
+		t.Fatalf("expected duplicate ack without ingestion, got %+v (%d records)", ack, len(recorder.records))
+	}
+
+	ack = stream.Submit(ctx, streamBatch(2, "c"))
+	if ack.Status != models.AckAccepted || len(recorder.records) != 3 {
+		t.Fatalf("unexpected ack for sequence 2: %+v", ack)
+	}
+
+	info := stream.Close()
+	if info.LastSequence != 2 || info.Batches != 3 || info.Accepted != 3 || info.Duplicates != 1 {
+		t.Fatalf("unexpected summary: %+v", info)
+	}
+	if streams, _ := service.GetStreams(ctx); len(streams) != 0 {
+		t.Fatalf("closed stream still registered: %+v", streams)
+	}
+	if _, err := service.OpenStream(ctx, "websocket", "10.0.0.2"); err != nil {
+		t.Fatalf("expected a slot after close: %v", err)
+	}
+}
+
+func TestStreamBackpressure_FollowsQueueDepth(t *testing.T) {
+	service, _, queue := newTestStreamService()
+	ctx := context.Background()
+
+	queue.setPending(80)
+	signal := service.GetBackpressure(ctx)
+	if signal.Level != models.BackpressureSlow || signal.Credits != 5 {
+		t.Fatalf("expected slow signal with half the window, got %+v", signal)
+	}
+
+	queue.setPending(95)
+	signal = service.GetBackpressure(ctx)
+	if signal.Level != models.BackpressurePause || signal.Credits != 0 {
+		t.Fatalf("expected pause signal, got %+v", signal)
+	}
+
+	stream, _ := service.OpenStream(ctx, "websocket", "client")
+	defer stream.Close()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		queue.setPending(10)
+	}()
+
+	pauses := 0
+	signal, err := stream.WaitForCapacity(ctx, func(models.BackpressureSignal) { pauses++ })
+	if err != nil || signal.Level != models.BackpressureNone || pauses != 1 {
+		t.Fatalf("expected to resume after the queue drained: %+v %v %d", signal, err, pauses)
+	}
+
+	queue.setPending(100)
+	cancelled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := stream.WaitForCapacity(cancelled, nil); err == nil {
+		t.Fatal("expected WaitForCapacity to stop when the context ends")
+	}
+}
+
+func TestStreamBackpressure_FollowsSpoolSize(t *testing.T) {
+	service, _, queue := newTestStreamService()
+
+	// Published records bypass the in-memory queue and land in the spool
+	queue.setSpoolBytes(950)
+	signal := service.GetBackpressure(context.Background())
+	if signal.Level != models.BackpressurePause || signal.QueueUtilization < 0.9 {
+		t.Fatalf("expected a full spool to pause streams, got %+v", signal)
+	}
+}
+
+func TestIngestStream_EnforcesCredits(t *testing.T) {
+	service, recorder, queue := newTestStreamService()
+	ctx := context.Background()
+
+	stream, _ := service.OpenStream(ctx, "grpc", "10.0.0.1:5000")
+	defer stream.Close()
+
+	queue.setPending(80)
+	ack := stream.Submit(ctx, streamBatch(1, "a"))
+	if ack.Status != models.AckAccepted || ack.Backpressure.Credits != 5 {
+		t.Fatalf("unexpected ack: %+v", ack)
+	}
+
+	// Sequence 7 is beyond the five batches granted after sequence 1
+	ack = stream.Submit(ctx, streamBatch(7, "b"))
+	if ack.Status != models.AckRejected || len(recorder.records) != 1 {
+		t.Fatalf("expected a batch beyond the credits to be rejected, got %+v", ack)
+	}
+
+	queue.setPending(95)
+	ack = stream.Submit(ctx, streamBatch(2, "c"))
+	if ack.Status != models.AckAccepted || ack.Backpressure.Credits != 0 {
+		t.Fatalf("unexpected ack: %+v", ack)
+	}
+	ack = stream.Submit(ctx, streamBatch(3, "d"))
+	if ack.Status != models.AckRejected || len(recorder.records) != 2 {
+		t.Fatalf("expected a paused stream to be refused, got %+v", ack)
+	}
+
+	// The resend goes through once capacity frees up
+	queue.setPending(10)
+	if _, err := stream.WaitForCapacity(ctx, nil); err != nil {
+		t.Fatalf("WaitForCapacity: %v", err)
+	}
+	ack = stream.Submit(ctx, streamBatch(3, "d"))
+	if ack.Status != models.AckAccepted || len(recorder.records) != 3 {
+		t.Fatalf("expected the resend to be accepted, got %+v", ack)
+	}
+	if info := stream.Info(); info.Throttled != 2 || info.LastSequence != 3 {
+		t.Fatalf("unexpected stream counters: %+v", info)
+	}
+}
@@ -71,12 +71,40 @@ func main() {
 	threatRepo := repository.NewThreatRepository(db)
 	patternRepo := repository.NewPatternRepository(db)
 	anomalyRepo := repository.NewAnomalyRepository(db)
+	incidentRepo := repository.NewIncidentRepository(db.DB())
 
 	// Initialize services
 	threatDetectionService := services.NewThreatDetectionService(threatRepo, kafkaProducer, logger)
 	anomalyDetectionService := services.NewAnomalyDetectionService(anomalyRepo, kafkaProducer, logger)
 	behavioralAnalysisService := services.NewBehavioralAnalysisService(patternRepo, kafkaProducer, logger)
 	signatureDetectionService := services.NewSignatureDetectionService(threatRepo, kafkaProducer, logger)
+	incidentCorrelationService := services.NewIncidentCorrelationService(incidentRepo, threatRepo, kafkaProducer, logger)
+
+	// Group detected threats into incidents
+	correlationPolicy := models.CorrelationPolicy{
+		Window:              cfg.Correlation.Window,
+		GroupBy:             cfg.Correlation.GroupBy,
+		EscalationThreshold: cfg.Correlation.EscalationThreshold,
+	}
+	if err := incidentCorrelationService.SetCorrelationPolicy(context.Background(), correlationPolicy); err != nil {
+		logger.Fatal("Invalid correlation policy", "window", correlationPolicy.Window, "group_by", correlationPolicy.GroupBy, "error", err)
+	}
+	threatDetectionService.SetIncidentCorrelator(incidentCorrelationService)
+
+	// Select the SQL injection and XSS detectors
+	if err := threatDetectionService.SetInjectionDetector(context.Background(), "", cfg.Detection.InjectionDetector); err != nil {
+		logger.Fatal("Invalid injection detector", "detector", cfg.Detection.InjectionDetector, "error", err)
+	}
+	for endpointID, detector := range cfg.Detection.EndpointInjectionDetectors {
+		if err := threatDetectionService.SetInjectionDetector(context.Background(), endpointID, detector); err != nil {
+			logger.Fatal("Invalid injection detector", "endpoint_id", endpointID, "detector", detector, "error", err)
+		}
+	}
+	// Selections made through the API are stored and override the configured ones
+	threatDetectionService.SetInjectionDetectorRepository(repository.NewInjectionDetectorRepository(db.DB()))
+	if err := threatDetectionService.LoadInjectionDetectors(context.Background()); err != nil {
+		logger.Warn("Failed to load stored injection detectors", "error", err)
+	}
 
 	// Initialize JWT middleware (placeholder for now)
 	// jwtMiddleware := jwt.NewMiddleware(cfg.Auth.JWT.Secret)
@@ -86,6 +114,7 @@ func main() {
 	anomalyHandler := handlers.NewAnomalyHandler(anomalyDetectionService, logger)
 	behavioralHandler := handlers.NewBehavioralHandler(behavioralAnalysisService, logger)
 	signatureHandler := handlers.NewSignatureHandler(signatureDetectionService, logger)
+	incidentHandler := handlers.NewIncidentHandler(incidentCorrelationService, logger)
 
 	// Setup Gin router
 	router := gin.New()
@@ -114,6 +143,24 @@ func main() {
 			threats.DELETE("/:id", threatHandler.DeleteThreat)
 		}
 
+		// Injection detector selection routes
+		injectionDetectors := v1.Group("/injection-detectors")
+		{
+			injectionDetectors.GET("", threatHandler.GetInjectionDetectors)
+			injectionDetectors.PUT("", threatHandler.SetInjectionDetector)
+			injectionDetectors.PUT("/:endpoint_id", threatHandler.SetInjectionDetector)
+			injectionDetectors.DELETE("/:endpoint_id", threatHandler.ResetInjectionDetector)
+		}
+
+		// Incident routes
+		incidents := v1.Group("/incidents")
+		{
+			incidents.GET("", incidentHandler.GetIncidents)
+			incidents.GET("/:id", incidentHandler.GetIncident)
+			incidents.GET("/:id/threats", incidentHandler.GetIncidentThreats)
+			incidents.PUT("/:id/status", incidentHandler.UpdateIncidentStatus)
+		}
+
 		// Anomaly detection routes
 		anomalies := v1.Group("/anomalies")
 		{
@@ -140,6 +187,8 @@ func main() {
 			signatures.POST("/detect", signatureHandler.DetectSignatures)
 			signatures.POST("/test", signatureHandler.TestSignature)
 			signatures.POST("/import", signatureHandler.ImportSignatureSet)
+			signatures.POST("/import/crs", signatureHandler.ImportCRSRules)
+			signatures.PUT("/sets/:set/paranoia-level", signatureHandler.SetParanoiaLevel)
 			signatures.GET("/export/:set", signatureHandler.ExportSignatureSet)
 		}
 	}
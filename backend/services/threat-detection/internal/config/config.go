@@ -4,17 +4,21 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server    ServerConfig    `mapstructure:"server"`
-	Database  DatabaseConfig  `mapstructure:"database"`
-	Messaging MessagingConfig `mapstructure:"messaging"`
-	Auth      AuthConfig      `mapstructure:"auth"`
-	Logging   LoggingConfig   `mapstructure:"logging"`
-	Metrics   MetricsConfig   `mapstructure:"metrics"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Database    DatabaseConfig    `mapstructure:"database"`
+	Messaging   MessagingConfig   `mapstructure:"messaging"`
+	Auth        AuthConfig        `mapstructure:"auth"`
+	Logging     LoggingConfig     `mapstructure:"logging"`
+	Metrics     MetricsConfig     `mapstructure:"metrics"`
+	Detection   DetectionConfig   `mapstructure:"detection"`
+	Correlation CorrelationConfig `mapstructure:"correlation"`
 }
 
 type ServerConfig struct {
@@ -62,6 +66,22 @@ type MetricsConfig struct {
 	Path    string `mapstructure:"path"`
 }
 
+// DetectionConfig selects the SQL injection and XSS detector: keyword
+// patterns, the lexical tokeniser or both, by default and per endpoint ID
+type DetectionConfig struct {
+	InjectionDetector          string            `mapstructure:"injection_detector"`
+	EndpointInjectionDetectors map[string]string `mapstructure:"endpoint_injection_detectors"`
+}
+
+// CorrelationConfig controls how threats are grouped into incidents: the
+// request attributes that link them, how far apart they may be and how many
+// threats escalate an incident's severity
+type CorrelationConfig struct {
+	Window              time.Duration `mapstructure:"window"`
+	GroupBy             []string      `mapstructure:"group_by"`
+	EscalationThreshold int           `mapstructure:"escalation_threshold"`
+}
+
 func LoadConfig() (*Config, error) {
 	// Set default values
 	viper.SetDefault("server.port", "8082")
@@ -79,6 +99,10 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("logging.format", "json")
 	viper.SetDefault("metrics.enabled", true)
 	viper.SetDefault("metrics.path", "/metrics")
+	viper.SetDefault("detection.injection_detector", "keyword")
+	viper.SetDefault("correlation.window", "30m")
+	viper.SetDefault("correlation.group_by", []string{"source_ip", "user_id", "session_id"})
+	viper.SetDefault("correlation.escalation_threshold", 10)
 
 	// Read from environment variables
 	viper.AutomaticEnv()
@@ -148,4 +172,19 @@ func loadFromEnv(config *Config) {
 	if topicPrefix := os.Getenv("KAFKA_TOPIC_PREFIX"); topicPrefix != "" {
 		config.Messaging.Kafka.TopicPrefix = topicPrefix
 	}
+	
+	// Detection configuration
+	if detector := os.Getenv("INJECTION_DETECTOR"); detector != "" {
+		config.Detection.InjectionDetector = detector
+	}
+	
+	// Correlation configuration
+	if window := os.Getenv("CORRELATION_WINDOW"); window != "" {
+		if w, err := time.ParseDuration(window); err == nil {
+			config.Correlation.Window = w
+		}
+	}
+	if groupBy := os.Getenv("CORRELATION_GROUP_BY"); groupBy != "" {
+		config.Correlation.GroupBy = strings.Split(groupBy, ",")
+	}
 } 
\ No newline at end of file
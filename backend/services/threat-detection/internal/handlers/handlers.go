@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -38,6 +40,12 @@ type SignatureHandler struct {
 	logger          logging.Logger
 }
 
+// IncidentHandler handles incident HTTP requests
+type IncidentHandler struct {
+	incidentService services.IncidentCorrelationServiceInterface
+	logger          logging.Logger
+}
+
 // Constructor functions
 func NewThreatHandler(threatService services.ThreatDetectionServiceInterface, logger logging.Logger) *ThreatHandler {
 	return &ThreatHandler{
@@ -67,6 +75,13 @@ func NewSignatureHandler(signatureService services.SignatureDetectionServiceInte
 	}
 }
 
+func NewIncidentHandler(incidentService services.IncidentCorrelationServiceInterface, logger logging.Logger) *IncidentHandler {
+	return &IncidentHandler{
+		incidentService: incidentService,
+		logger:          logger,
+	}
+}
+
 // =============================================================================
 // THREAT HANDLER METHODS
 // =============================================================================
@@ -366,6 +381,105 @@ func (h *ThreatHandler) GetThreatStatistics(c *gin.Context) {
 	})
 }
 
+// GetInjectionDetectors lists the SQL injection and XSS detector each endpoint
+// uses and how the detectors compare on endpoints running both
+func (h *ThreatHandler) GetInjectionDetectors(c *gin.Context) {
+	report, err := h.threatService.GetInjectionDetectors(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to get injection detectors", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "FETCH_FAILED",
+				"message": "Failed to retrieve injection detectors",
+			},
+		})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"data":      report,
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// SetInjectionDetector selects the injection detector for an endpoint, or the
+// default detector when no endpoint ID is given
+func (h *ThreatHandler) SetInjectionDetector(c *gin.Context) {
+	endpointID := c.Param("endpoint_id")
+	
+	var request struct {
+		Detector string `json:"detector" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid request format",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+	
+	if err := h.threatService.SetInjectionDetector(c.Request.Context(), endpointID, request.Detector); err != nil {
+		if errors.Is(err, services.ErrInvalidInjectionDetector) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "INVALID_INJECTION_DETECTOR",
+					"message": err.Error(),
+				},
+			})
+			return
+		}
+		h.logger.Error("Failed to set injection detector", "endpoint_id", endpointID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "UPDATE_FAILED",
+				"message": "Failed to set injection detector",
+			},
+		})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"endpoint_id": endpointID,
+			"detector":    request.Detector,
+		},
+		"message":   "Injection detector updated successfully",
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// ResetInjectionDetector returns an endpoint to the default injection detector
+func (h *ThreatHandler) ResetInjectionDetector(c *gin.Context) {
+	endpointID := c.Param("endpoint_id")
+	
+	if err := h.threatService.ResetInjectionDetector(c.Request.Context(), endpointID); err != nil {
+		h.logger.Error("Failed to reset injection detector", "endpoint_id", endpointID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "UPDATE_FAILED",
+				"message": "Failed to reset injection detector",
+			},
+		})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"message":   "Injection detector reset to default",
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
 // =============================================================================
 // ANOMALY HANDLER METHODS
 // =============================================================================
@@ -1327,3 +1441,333 @@ func (h *SignatureHandler) ExportSignatureSet(c *gin.Context) {
 	c.Header("Content-Type", "application/json")
 	c.Data(http.StatusOK, "application/json", exportData)
 }
+
+// ImportCRSRules imports OWASP Core Rule Set / ModSecurity rule files into a signature set
+func (h *SignatureHandler) ImportCRSRules(c *gin.Context) {
+	// Parse multipart form
+	if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "INVALID_FORM",
+				"message": "Invalid form data",
+			},
+		})
+		return
+	}
+	
+	signatureSet := c.PostForm("signature_set")
+	if signatureSet == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "MISSING_SIGNATURE_SET",
+				"message": "Signature set name is required",
+			},
+		})
+		return
+	}
+	
+	var options models.CRSImportOptions
+	for field, target := range map[string]*int{"paranoia_level": &options.ParanoiaLevel, "anomaly_threshold": &options.AnomalyThreshold} {
+		value := c.PostForm(field)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "INVALID_PARAMETER",
+					"message": fmt.Sprintf("%s must be a positive integer", field),
+				},
+			})
+			return
+		}
+		*target = parsed
+	}
+	
+	// Read the rule (.conf) and phrase (.data) files
+	files := make(map[string][]byte)
+	hasRules := false
+	for _, header := range c.Request.MultipartForm.File["rule_files"] {
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "FILE_READ_ERROR",
+					"message": "Failed to read rule file " + header.Filename,
+				},
+			})
+			return
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "FILE_READ_ERROR",
+					"message": "Failed to read rule file " + header.Filename,
+				},
+			})
+			return
+		}
+		files[header.Filename] = data
+		hasRules = hasRules || strings.HasSuffix(strings.ToLower(header.Filename), ".conf")
+	}
+	if !hasRules {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "MISSING_FILE",
+				"message": "At least one .conf rule file is required",
+			},
+		})
+		return
+	}
+	
+	result, err := h.signatureService.ImportCRSRules(c.Request.Context(), files, signatureSet, options)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidParanoiaLevel) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "INVALID_PARANOIA_LEVEL",
+					"message": err.Error(),
+				},
+			})
+			return
+		}
+		h.logger.Error("Failed to import CRS rules", "signature_set", signatureSet, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "IMPORT_FAILED",
+				"message": "Failed to import CRS rules: " + err.Error(),
+			},
+		})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+		"message": "CRS rules imported successfully",
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// SetParanoiaLevel enables the signatures of a set up to a paranoia level
+func (h *SignatureHandler) SetParanoiaLevel(c *gin.Context) {
+	signatureSet := c.Param("set")
+	
+	var request struct {
+		ParanoiaLevel int `json:"paranoia_level" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid request format",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+	
+	enabled, err := h.signatureService.SetParanoiaLevel(c.Request.Context(), signatureSet, request.ParanoiaLevel)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidParanoiaLevel) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "INVALID_PARANOIA_LEVEL",
+					"message": err.Error(),
+				},
+			})
+			return
+		}
+		h.logger.Error("Failed to set paranoia level", "signature_set", signatureSet, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "UPDATE_FAILED",
+				"message": "Failed to set paranoia level",
+			},
+		})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"signature_set":      signatureSet,
+			"paranoia_level":     request.ParanoiaLevel,
+			"enabled_signatures": enabled,
+		},
+		"message": "Paranoia level updated successfully",
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// =============================================================================
+// INCIDENT HANDLER METHODS
+// =============================================================================
+
+// GetIncidents retrieves incidents, most recently active first
+func (h *IncidentHandler) GetIncidents(c *gin.Context) {
+	filter := &models.IncidentFilter{
+		Status:   c.Query("status"),
+		Severity: c.Query("severity"),
+		Stage:    c.Query("stage"),
+		SourceIP: c.Query("source_ip"),
+		UserID:   c.Query("user_id"),
+		APIID:    c.Query("api_id"),
+		Active:   c.Query("active") == "true",
+	}
+	
+	// Parse date filter
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		if since, err := time.Parse(time.RFC3339, sinceStr); err == nil {
+			filter.Since = since
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "INVALID_DATE_FORMAT",
+					"message": "Invalid date format. Use RFC3339 format (e.g., 2024-01-15T10:30:00Z)",
+				},
+			})
+			return
+		}
+	}
+	
+	incidents, err := h.incidentService.GetIncidents(c.Request.Context(), filter)
+	if err != nil {
+		h.logger.Error("Failed to get incidents", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "Failed to retrieve incidents",
+			},
+		})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"items": incidents,
+			"total": len(incidents),
+		},
+		"message":   "Incidents retrieved successfully",
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// GetIncident retrieves an incident with its timeline
+func (h *IncidentHandler) GetIncident(c *gin.Context) {
+	incidentID := c.Param("id")
+	
+	incident, err := h.incidentService.GetIncident(c.Request.Context(), incidentID)
+	if err != nil {
+		h.incidentError(c, incidentID, "Failed to get incident", err)
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"data":      incident,
+		"message":   "Incident retrieved successfully",
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// GetIncidentThreats retrieves the threats grouped into an incident
+func (h *IncidentHandler) GetIncidentThreats(c *gin.Context) {
+	incidentID := c.Param("id")
+	
+	threats, err := h.incidentService.GetIncidentThreats(c.Request.Context(), incidentID)
+	if err != nil {
+		h.incidentError(c, incidentID, "Failed to get incident threats", err)
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"items": threats,
+			"total": len(threats),
+		},
+		"message":   "Incident threats retrieved successfully",
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// UpdateIncidentStatus moves an incident through its lifecycle, assigns it
+// or adds a note to its timeline
+func (h *IncidentHandler) UpdateIncidentStatus(c *gin.Context) {
+	incidentID := c.Param("id")
+	
+	var updateRequest models.IncidentUpdateRequest
+	if err := c.ShouldBindJSON(&updateRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid request format",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+	
+	incident, err := h.incidentService.UpdateIncidentStatus(c.Request.Context(), incidentID, &updateRequest)
+	if err != nil {
+		h.incidentError(c, incidentID, "Failed to update incident status", err)
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"data":      incident,
+		"message":   "Incident status updated successfully",
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// incidentError maps incident service errors to responses
+func (h *IncidentHandler) incidentError(c *gin.Context, incidentID, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrIncidentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "INCIDENT_NOT_FOUND",
+				"message": "Incident not found",
+			},
+		})
+	case errors.Is(err, services.ErrInvalidIncidentTransition):
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "INVALID_STATUS_TRANSITION",
+				"message": err.Error(),
+			},
+		})
+	default:
+		h.logger.Error(message, "incident_id", incidentID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": message,
+			},
+		})
+	}
+}
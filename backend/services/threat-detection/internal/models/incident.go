@@ -0,0 +1,118 @@
+package models
+
+import "time"
+
+// Incident groups the threats one actor caused within the correlation window,
+// so a multi-request attack is investigated as one case
+type Incident struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Status   string `json:"status"`
+	Severity string `json:"severity"`
+	// Highest severity of the grouped threats, before escalation
+	ThreatSeverity string `json:"threat_severity"`
+	// Furthest kill-chain stage reached, and every stage seen in the order
+	// it was first seen
+	Stage  string   `json:"stage"`
+	Stages []string `json:"stages"`
+	// Time of the earliest threat at each stage
+	StageFirstSeen map[string]time.Time `json:"stage_first_seen"`
+	// Keys such as "ip:203.0.113.7" that new threats are matched against
+	CorrelationKeys []string       `json:"correlation_keys"`
+	SourceIPs       []string       `json:"source_ips"`
+	UserIDs         []string       `json:"user_ids"`
+	SessionIDs      []string       `json:"session_ids"`
+	APIIDs          []string       `json:"api_ids"`
+	EndpointIDs     []string       `json:"endpoint_ids"`
+	ThreatCount     int            `json:"threat_count"`
+	ThreatTypes     map[string]int `json:"threat_types"`
+	RiskScore       float64        `json:"risk_score"`
+	FirstSeen       time.Time      `json:"first_seen"`
+	LastSeen        time.Time      `json:"last_seen"`
+	Assignee        string         `json:"assignee,omitempty"`
+	// ID of the incident this one was merged into
+	MergedInto string          `json:"merged_into,omitempty"`
+	Timeline   []IncidentEvent `json:"timeline"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	ResolvedAt *time.Time      `json:"resolved_at,omitempty"`
+}
+
+// IncidentEvent records a change to an incident
+type IncidentEvent struct {
+	Type        string    `json:"type"`
+	Description string    `json:"description"`
+	From        string    `json:"from,omitempty"`
+	To          string    `json:"to,omitempty"`
+	Actor       string    `json:"actor,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+type IncidentFilter struct {
+	Status   string    `json:"status,omitempty"`
+	Severity string    `json:"severity,omitempty"`
+	Stage    string    `json:"stage,omitempty"`
+	SourceIP string    `json:"source_ip,omitempty"`
+	UserID   string    `json:"user_id,omitempty"`
+	APIID    string    `json:"api_id,omitempty"`
+	Active   bool      `json:"active,omitempty"`
+	Since    time.Time `json:"since,omitempty"`
+}
+
+type IncidentUpdateRequest struct {
+	Status   string `json:"status,omitempty"`
+	Assignee string `json:"assignee,omitempty"`
+	Note     string `json:"note,omitempty"`
+	// Who made the change, recorded on the timeline
+	Actor string `json:"actor,omitempty"`
+}
+
+// CorrelationPolicy controls how threats are grouped into incidents
+type CorrelationPolicy struct {
+	// Threats join an incident whose last threat is at most this old
+	Window time.Duration `json:"window"`
+	// Request attributes that link threats: source_ip, user_id, session_id
+	// and api_id. With other attributes, api_id keeps each API's incidents
+	// apart; on its own it groups every threat against an API.
+	GroupBy []string `json:"group_by"`
+	// Number of threats at which an incident's severity is raised a level
+	EscalationThreshold int `json:"escalation_threshold"`
+}
+
+// Incident status
+const (
+	IncidentStatusOpen          = "open"
+	IncidentStatusInvestigating = "investigating"
+	IncidentStatusContained     = "contained"
+	IncidentStatusResolved      = "resolved"
+	IncidentStatusClosed        = "closed"
+	IncidentStatusFalsePositive = "false_positive"
+	IncidentStatusMerged        = "merged"
+)
+
+// Kill-chain stages, in the order an attack progresses through them
+const (
+	KillChainRecon        = "recon"
+	KillChainProbing      = "probing"
+	KillChainExploitation = "exploitation"
+	KillChainExfiltration = "exfiltration"
+)
+
+// Incident timeline event types
+const (
+	IncidentEventCreated           = "created"
+	IncidentEventStageAdvanced     = "stage_advanced"
+	IncidentEventSeverityEscalated = "severity_escalated"
+	IncidentEventMerged            = "merged"
+	IncidentEventStatusChanged     = "status_changed"
+	IncidentEventAssigned          = "assigned"
+	IncidentEventNote              = "note"
+)
+
+// Correlation attributes
+const (
+	CorrelateBySourceIP  = "source_ip"
+	CorrelateByUserID    = "user_id"
+	CorrelateBySessionID = "session_id"
+	CorrelateByAPIID     = "api_id"
+)
@@ -29,6 +29,9 @@ type SignatureDetectionResult struct {
 	Matched     bool      `json:"matched"`
 	Details     string    `json:"details"`
 	DetectedAt  time.Time `json:"detected_at"`
+	// Sum of the anomaly scores of the matching anomaly-scored signatures
+	AnomalyScore      int      `json:"anomaly_score,omitempty"`
+	MatchedSignatures []string `json:"matched_signatures,omitempty"`
 }
 
 type ThreatSignature struct {
@@ -47,6 +50,15 @@ type ThreatSignature struct {
 	SignatureSet string          `json:"signature_set"`
 	Enabled      bool            `json:"enabled"`
 	Rules        []SignatureRule `json:"rules"`
+	// ID of the rule the signature was imported from, such as a CRS rule ID
+	ExternalID string `json:"external_id,omitempty"`
+	// Every rule must match instead of any one of them, as in a SecRule chain
+	MatchAll      bool `json:"match_all,omitempty"`
+	ParanoiaLevel int  `json:"paranoia_level,omitempty"`
+	// Signatures with an anomaly score add it to the request's score instead
+	// of matching on their own; the request matches once the total reaches
+	// the anomaly threshold
+	AnomalyScore int `json:"anomaly_score,omitempty"`
 }
 
 type SignatureFilter struct {
@@ -115,6 +127,16 @@ type SignatureRule struct {
 	Value       string  `json:"value"`
 	IntValue    int     `json:"int_value"`
 	Weight      float64 `json:"weight"`
+	// Further fields to inspect besides Field. A name ending in "*" selects
+	// every field with that prefix, "prefix/regex/" the fields whose name after
+	// the prefix matches regex, and "names:" inspects field names instead of values.
+	Targets    []string `json:"targets,omitempty"`
+	Exclusions []string `json:"exclusions,omitempty"`
+	// Transformations applied to each value before the operator, in order
+	Transforms []string `json:"transforms,omitempty"`
+	// Check the operator after every transformation instead of only the last
+	MultiMatch bool `json:"multi_match,omitempty"`
+	Negate     bool `json:"negate,omitempty"`
 }
 
 type SignatureStatistics struct {
@@ -145,6 +167,35 @@ type SignatureOptimizationResult struct {
 	OptimizedAt         time.Time `json:"optimized_at"`
 }
 
+// CRSImportOptions selects which OWASP Core Rule Set / ModSecurity rules are
+// enabled on import. Zero values fall back to the tx.blocking_paranoia_level and
+// tx.inbound_anomaly_score_threshold set in the imported files, then to 1 and 5.
+type CRSImportOptions struct {
+	ParanoiaLevel    int `json:"paranoia_level"`
+	AnomalyThreshold int `json:"anomaly_threshold"`
+}
+
+type CRSImportResult struct {
+	SignatureSet     string `json:"signature_set"`
+	ParanoiaLevel    int    `json:"paranoia_level"`
+	AnomalyThreshold int    `json:"anomaly_threshold"`
+	Imported         int    `json:"imported"`
+	Enabled          int    `json:"enabled"`
+	// Rules without a detection of their own, such as initialisation and
+	// paranoia level gates
+	Ignored  int              `json:"ignored"`
+	Skipped  []CRSSkippedRule `json:"skipped,omitempty"`
+	Warnings []string         `json:"warnings,omitempty"`
+}
+
+// CRSSkippedRule is a detection rule that could not be translated
+type CRSSkippedRule struct {
+	RuleID string `json:"rule_id"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
 // Signature type constants
 const (
 	SignatureTypeCustom    = "custom"
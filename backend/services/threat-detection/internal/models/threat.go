@@ -118,6 +118,25 @@ type ThreatUpdateRequest struct {
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 }
 
+// InjectionDetectorReport lists the injection detector each endpoint uses
+// and, for endpoints running both, how their detections compare by threat type
+type InjectionDetectorReport struct {
+	Default     string                                            `json:"default"`
+	Endpoints   map[string]string                                 `json:"endpoints"`
+	Comparisons map[string]map[string]InjectionDetectorComparison `json:"comparisons"`
+}
+
+// InjectionDetectorComparison counts requests inspected by both injection
+// detectors and which of them flagged each one
+type InjectionDetectorComparison struct {
+	Requests          int64 `json:"requests"`
+	KeywordDetections int64 `json:"keyword_detections"`
+	LexicalDetections int64 `json:"lexical_detections"`
+	Agreed            int64 `json:"agreed"`
+	KeywordOnly       int64 `json:"keyword_only"`
+	LexicalOnly       int64 `json:"lexical_only"`
+}
+
 // Threat severity levels
 const (
 	ThreatSeverityCritical = "critical"
@@ -160,4 +179,13 @@ const (
 	DetectionMethodML         = "machine_learning"
 	DetectionMethodRule       = "rule_based"
 	DetectionMethodHeuristic  = "heuristic"
+	DetectionMethodLexical    = "lexical"
+)
+
+// Injection detectors the SQL injection and XSS checks can run. Both runs the
+// keyword patterns and the tokeniser side by side and counts where they agree.
+const (
+	InjectionDetectorKeyword = "keyword"
+	InjectionDetectorLexical = "lexical"
+	InjectionDetectorBoth    = "both"
 )
@@ -0,0 +1,351 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"scopeapi.local/backend/services/threat-detection/internal/models"
+)
+
+// PostgresIncidentRepository stores incidents in the incidents table and the
+// threats grouped into them in incident_threats
+type PostgresIncidentRepository struct {
+	db *sql.DB
+	// tx is set on the repository WithIncidentLock passes to its callback,
+	// whose reads lock the incident rows they return
+	tx *sql.Tx
+}
+
+// incidentQueryer is satisfied by both *sql.DB and *sql.Tx
+type incidentQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func NewPostgresIncidentRepository(db *sql.DB) *PostgresIncidentRepository {
+	return &PostgresIncidentRepository{db: db}
+}
+
+func (r *PostgresIncidentRepository) conn() incidentQueryer {
+	if r.tx != nil {
+		return r.tx
+	}
+	return r.db
+}
+
+// forUpdate locks the rows a read returns until the transaction ends
+func (r *PostgresIncidentRepository) forUpdate() string {
+	if r.tx != nil {
+		return ` FOR UPDATE`
+	}
+	return ``
+}
+
+// WithIncidentLock runs fn in one transaction holding an advisory lock on
+// each correlation key, so replicas correlating threats that share a key
+// take turns instead of each opening an incident
+func (r *PostgresIncidentRepository) WithIncidentLock(ctx context.Context, keys []string, fn func(repo IncidentRepositoryInterface) error) error {
+	if r.tx != nil {
+		return fn(r)
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin incident transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Taking the keys in order keeps two threats sharing several keys from
+	// deadlocking on each other
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	for _, key := range sorted {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, key); err != nil {
+			return fmt.Errorf("failed to lock correlation key: %w", err)
+		}
+	}
+
+	if err := fn(&PostgresIncidentRepository{db: r.db, tx: tx}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit incident transaction: %w", err)
+	}
+	return nil
+}
+
+const incidentColumns = `id, title, status, severity, threat_severity, stage, stages,
+	stage_first_seen, correlation_keys, source_ips, user_ids, session_ids, api_ids,
+	endpoint_ids, threat_count, threat_types, risk_score, first_seen, last_seen,
+	assignee, merged_into, timeline, resolved_at, created_at, updated_at`
+
+func (r *PostgresIncidentRepository) GetIncident(ctx context.Context, incidentID string) (*models.Incident, error) {
+	// IDs come from request paths, and anything but a UUID fails the cast
+	// in Postgres rather than finding no incident
+	if _, err := uuid.Parse(incidentID); err != nil {
+		return nil, nil
+	}
+	row := r.conn().QueryRowContext(ctx, `SELECT `+incidentColumns+` FROM incidents WHERE id = $1`+r.forUpdate(), incidentID)
+	incident, err := scanIncident(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get incident: %w", err)
+	}
+	return incident, nil
+}
+
+func (r *PostgresIncidentRepository) CreateIncident(ctx context.Context, incident *models.Incident) error {
+	args, err := incidentArgs(incident)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO incidents (` + incidentColumns + `)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12, $13, $14,
+			$15, $16, $17, $18, $19, NULLIF($20, ''), NULLIF($21, '')::uuid, $22, $23, $24, $25)
+	`
+	if _, err := r.conn().ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to create incident: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresIncidentRepository) UpdateIncident(ctx context.Context, incident *models.Incident) error {
+	args, err := incidentArgs(incident)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE incidents SET title = $2, status = $3, severity = $4, threat_severity = NULLIF($5, ''),
+			stage = $6, stages = $7, stage_first_seen = $8, correlation_keys = $9, source_ips = $10,
+			user_ids = $11, session_ids = $12, api_ids = $13, endpoint_ids = $14, threat_count = $15,
+			threat_types = $16, risk_score = $17, first_seen = $18, last_seen = $19,
+			assignee = NULLIF($20, ''), merged_into = NULLIF($21, '')::uuid, timeline = $22,
+			resolved_at = $23, created_at = $24, updated_at = $25
+		WHERE id = $1
+	`
+	result, err := r.conn().ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update incident: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return fmt.Errorf("incident not found: %s", incident.ID)
+	}
+	return nil
+}
+
+func (r *PostgresIncidentRepository) ListIncidents(ctx context.Context, filter *models.IncidentFilter) ([]models.Incident, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter != nil {
+		if filter.Status != "" {
+			where("status = $%d", filter.Status)
+		}
+		if filter.Severity != "" {
+			where("severity = $%d", filter.Severity)
+		}
+		if filter.Stage != "" {
+			where("stage = $%d", filter.Stage)
+		}
+		if filter.SourceIP != "" {
+			where("$%d = ANY(source_ips)", filter.SourceIP)
+		}
+		if filter.UserID != "" {
+			where("$%d = ANY(user_ids)", filter.UserID)
+		}
+		if filter.APIID != "" {
+			where("$%d = ANY(api_ids)", filter.APIID)
+		}
+		if filter.Active {
+			conditions = append(conditions, activeIncidentCondition)
+		}
+		if !filter.Since.IsZero() {
+			where("last_seen >= $%d", filter.Since)
+		}
+	}
+
+	query := `SELECT ` + incidentColumns + ` FROM incidents`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY last_seen DESC`
+
+	incidents, err := r.queryIncidents(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list incidents: %w", err)
+	}
+	return incidents, nil
+}
+
+func (r *PostgresIncidentRepository) FindActiveIncidents(ctx context.Context, keys []string, since time.Time) ([]models.Incident, error) {
+	query := `SELECT ` + incidentColumns + ` FROM incidents
+		WHERE ` + activeIncidentCondition + ` AND last_seen >= $1 AND correlation_keys && $2
+		ORDER BY first_seen` + r.forUpdate()
+	incidents, err := r.queryIncidents(ctx, query, since, stringArray(keys))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find active incidents: %w", err)
+	}
+	return incidents, nil
+}
+
+func (r *PostgresIncidentRepository) AddIncidentThreat(ctx context.Context, incidentID, threatID, stage string) error {
+	query := `
+		INSERT INTO incident_threats (incident_id, threat_id, stage)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (incident_id, threat_id) DO NOTHING
+	`
+	if _, err := r.conn().ExecContext(ctx, query, incidentID, threatID, stage); err != nil {
+		return fmt.Errorf("failed to link threat to incident: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresIncidentRepository) CopyIncidentThreats(ctx context.Context, fromID, toID string) error {
+	query := `
+		INSERT INTO incident_threats (incident_id, threat_id, stage, added_at)
+		SELECT $2, threat_id, stage, added_at FROM incident_threats WHERE incident_id = $1
+		ON CONFLICT (incident_id, threat_id) DO NOTHING
+	`
+	if _, err := r.conn().ExecContext(ctx, query, fromID, toID); err != nil {
+		return fmt.Errorf("failed to copy incident threats: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresIncidentRepository) GetIncidentThreatIDs(ctx context.Context, incidentID string) ([]string, error) {
+	rows, err := r.conn().QueryContext(ctx, `
+		SELECT threat_id FROM incident_threats WHERE incident_id = $1 ORDER BY added_at, threat_id
+	`, incidentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query incident threats: %w", err)
+	}
+	defer rows.Close()
+
+	var threatIDs []string
+	for rows.Next() {
+		var threatID string
+		if err := rows.Scan(&threatID); err != nil {
+			return nil, fmt.Errorf("failed to scan incident threat: %w", err)
+		}
+		threatIDs = append(threatIDs, threatID)
+	}
+	return threatIDs, rows.Err()
+}
+
+const activeIncidentCondition = `status IN ('open', 'investigating', 'contained')`
+
+func (r *PostgresIncidentRepository) queryIncidents(ctx context.Context, query string, args ...interface{}) ([]models.Incident, error) {
+	rows, err := r.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := []models.Incident{}
+	for rows.Next() {
+		incident, err := scanIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, *incident)
+	}
+	return incidents, rows.Err()
+}
+
+// incidentArgs lists an incident's values in incidentColumns order
+func incidentArgs(incident *models.Incident) ([]interface{}, error) {
+	stageFirstSeen, err := json.Marshal(incident.StageFirstSeen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal stage first seen times: %w", err)
+	}
+	threatTypes, err := json.Marshal(incident.ThreatTypes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal threat types: %w", err)
+	}
+	timeline, err := json.Marshal(incident.Timeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal timeline: %w", err)
+	}
+	if incident.Timeline == nil {
+		timeline = []byte("[]")
+	}
+	return []interface{}{
+		incident.ID, incident.Title, incident.Status, incident.Severity, incident.ThreatSeverity,
+		incident.Stage, stringArray(incident.Stages), stageFirstSeen, stringArray(incident.CorrelationKeys),
+		stringArray(incident.SourceIPs), stringArray(incident.UserIDs), stringArray(incident.SessionIDs),
+		stringArray(incident.APIIDs), stringArray(incident.EndpointIDs), incident.ThreatCount,
+		threatTypes, incident.RiskScore, incident.FirstSeen, incident.LastSeen, incident.Assignee,
+		incident.MergedInto, timeline, incident.ResolvedAt, incident.CreatedAt, incident.UpdatedAt,
+	}, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanIncident(row rowScanner) (*models.Incident, error) {
+	var incident models.Incident
+	var threatSeverity, assignee, mergedInto sql.NullString
+	var stageFirstSeen, threatTypes, timeline []byte
+	var stages, correlationKeys, sourceIPs, userIDs, sessionIDs, apiIDs, endpointIDs pq.StringArray
+	var resolvedAt sql.NullTime
+	err := row.Scan(
+		&incident.ID, &incident.Title, &incident.Status, &incident.Severity, &threatSeverity,
+		&incident.Stage, &stages, &stageFirstSeen, &correlationKeys, &sourceIPs, &userIDs, &sessionIDs,
+		&apiIDs, &endpointIDs, &incident.ThreatCount, &threatTypes, &incident.RiskScore,
+		&incident.FirstSeen, &incident.LastSeen, &assignee, &mergedInto, &timeline,
+		&resolvedAt, &incident.CreatedAt, &incident.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	incident.ThreatSeverity = threatSeverity.String
+	incident.Assignee = assignee.String
+	incident.MergedInto = mergedInto.String
+	incident.Stages = stages
+	incident.CorrelationKeys = correlationKeys
+	incident.SourceIPs = sourceIPs
+	incident.UserIDs = userIDs
+	incident.SessionIDs = sessionIDs
+	incident.APIIDs = apiIDs
+	incident.EndpointIDs = endpointIDs
+	if resolvedAt.Valid {
+		incident.ResolvedAt = &resolvedAt.Time
+	}
+	if err := json.Unmarshal(stageFirstSeen, &incident.StageFirstSeen); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal stage first seen times: %w", err)
+	}
+	if err := json.Unmarshal(threatTypes, &incident.ThreatTypes); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal threat types: %w", err)
+	}
+	if incident.ThreatTypes == nil {
+		incident.ThreatTypes = make(map[string]int)
+	}
+	if err := json.Unmarshal(timeline, &incident.Timeline); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal timeline: %w", err)
+	}
+	return &incident, nil
+}
+
+// stringArray stores a nil slice as an empty array rather than NULL
+func stringArray(values []string) pq.StringArray {
+	if values == nil {
+		return pq.StringArray{}
+	}
+	return pq.StringArray(values)
+}
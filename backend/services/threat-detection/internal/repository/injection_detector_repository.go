@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// InjectionDetectorRepository stores injection detector selections in the
+// injection_detectors table
+type InjectionDetectorRepository struct {
+	db *sql.DB
+}
+
+func NewInjectionDetectorRepository(db *sql.DB) *InjectionDetectorRepository {
+	return &InjectionDetectorRepository{db: db}
+}
+
+func (r *InjectionDetectorRepository) GetInjectionDetectors(ctx context.Context) (map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT endpoint_id, detector FROM injection_detectors`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query injection detectors: %w", err)
+	}
+	defer rows.Close()
+
+	detectors := make(map[string]string)
+	for rows.Next() {
+		var endpointID, detector string
+		if err := rows.Scan(&endpointID, &detector); err != nil {
+			return nil, fmt.Errorf("failed to scan injection detector: %w", err)
+		}
+		detectors[endpointID] = detector
+	}
+	return detectors, rows.Err()
+}
+
+func (r *InjectionDetectorRepository) SaveInjectionDetector(ctx context.Context, endpointID, detector string) error {
+	query := `
+		INSERT INTO injection_detectors (endpoint_id, detector, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (endpoint_id) DO UPDATE SET detector = EXCLUDED.detector, updated_at = EXCLUDED.updated_at
+	`
+	if _, err := r.db.ExecContext(ctx, query, endpointID, detector); err != nil {
+		return fmt.Errorf("failed to save injection detector: %w", err)
+	}
+	return nil
+}
+
+func (r *InjectionDetectorRepository) DeleteInjectionDetector(ctx context.Context, endpointID string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM injection_detectors WHERE endpoint_id = $1`, endpointID); err != nil {
+		return fmt.Errorf("failed to delete injection detector: %w", err)
+	}
+	return nil
+}
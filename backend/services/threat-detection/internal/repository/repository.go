@@ -2,7 +2,10 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"scopeapi.local/backend/services/threat-detection/internal/models"
@@ -84,6 +87,45 @@ type PatternRepositoryInterface interface {
 	GetHistoricalCountries(ctx context.Context, entityID string, entityType string) ([]string, error)
 }
 
+type IncidentRepositoryInterface interface {
+	// GetIncident returns an incident by ID, or nil if there is none
+	GetIncident(ctx context.Context, incidentID string) (*models.Incident, error)
+	// CreateIncident stores a new incident
+	CreateIncident(ctx context.Context, incident *models.Incident) error
+	// UpdateIncident replaces a stored incident
+	UpdateIncident(ctx context.Context, incident *models.Incident) error
+	// ListIncidents returns incidents matching a filter, most recently active first
+	ListIncidents(ctx context.Context, filter *models.IncidentFilter) ([]models.Incident, error)
+	// FindActiveIncidents returns open, investigating and contained incidents
+	// sharing a correlation key and active since a time
+	FindActiveIncidents(ctx context.Context, keys []string, since time.Time) ([]models.Incident, error)
+	// AddIncidentThreat links a threat to an incident at the kill-chain
+	// stage it was placed on
+	AddIncidentThreat(ctx context.Context, incidentID, threatID, stage string) error
+	// CopyIncidentThreats links the threats of one incident to another, for
+	// an incident merged into another
+	CopyIncidentThreats(ctx context.Context, fromID, toID string) error
+	// GetIncidentThreatIDs returns the IDs of the threats linked to an
+	// incident, in the order they were added
+	GetIncidentThreatIDs(ctx context.Context, incidentID string) ([]string, error)
+	// WithIncidentLock runs fn holding a lock on each correlation key, which
+	// serialises callers sharing a key. Incidents read through the repository
+	// passed to fn stay locked until it returns.
+	WithIncidentLock(ctx context.Context, keys []string, fn func(repo IncidentRepositoryInterface) error) error
+}
+
+// InjectionDetectorRepositoryInterface stores the SQL injection and XSS
+// detector selected per endpoint. The default detector is stored under an
+// empty endpoint ID.
+type InjectionDetectorRepositoryInterface interface {
+	// GetInjectionDetectors returns the selected detectors by endpoint ID
+	GetInjectionDetectors(ctx context.Context) (map[string]string, error)
+	// SaveInjectionDetector stores the detector selected for an endpoint
+	SaveInjectionDetector(ctx context.Context, endpointID, detector string) error
+	// DeleteInjectionDetector removes an endpoint's selection
+	DeleteInjectionDetector(ctx context.Context, endpointID string) error
+}
+
 // In-memory implementation of ThreatRepositoryInterface
 
 type MemoryThreatRepository struct {
@@ -259,6 +301,10 @@ func NewPatternRepository(db interface{}) PatternRepositoryInterface {
 	}
 }
 
+func NewIncidentRepository(db *sql.DB) IncidentRepositoryInterface {
+	return NewPostgresIncidentRepository(db)
+}
+
 func NewAnomalyRepository(db interface{}) AnomalyRepositoryInterface {
 	// For now, return the in-memory implementation
 	return &MemoryAnomalyRepository{
@@ -623,3 +669,236 @@ func (r *MemoryAnomalyRepository) GetModelPerformance(ctx context.Context, model
 		LastUpdated:       time.Now(),
 	}, nil
 }
+
+// In-memory implementation of IncidentRepositoryInterface. Incidents are
+// copied in and out, so callers can change the ones they hold without
+// changing the stored incidents.
+
+type MemoryIncidentRepository struct {
+	mu        sync.RWMutex
+	incidents map[string]*models.Incident
+	threats   map[string][]string
+	// lock is held by WithIncidentLock, for every key at once
+	lock sync.Mutex
+}
+
+func NewMemoryIncidentRepository() *MemoryIncidentRepository {
+	return &MemoryIncidentRepository{
+		incidents: make(map[string]*models.Incident),
+		threats:   make(map[string][]string),
+	}
+}
+
+func (r *MemoryIncidentRepository) GetIncident(ctx context.Context, incidentID string) (*models.Incident, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if incident, ok := r.incidents[incidentID]; ok {
+		return cloneIncident(incident), nil
+	}
+	return nil, nil
+}
+
+func (r *MemoryIncidentRepository) CreateIncident(ctx context.Context, incident *models.Incident) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.incidents[incident.ID]; exists {
+		return fmt.Errorf("incident already exists: %s", incident.ID)
+	}
+	r.incidents[incident.ID] = cloneIncident(incident)
+	return nil
+}
+
+func (r *MemoryIncidentRepository) UpdateIncident(ctx context.Context, incident *models.Incident) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.incidents[incident.ID]; !exists {
+		return fmt.Errorf("incident not found: %s", incident.ID)
+	}
+	r.incidents[incident.ID] = cloneIncident(incident)
+	return nil
+}
+
+func (r *MemoryIncidentRepository) ListIncidents(ctx context.Context, filter *models.IncidentFilter) ([]models.Incident, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []models.Incident{}
+	for _, incident := range r.incidents {
+		if filter != nil {
+			if filter.Status != "" && incident.Status != filter.Status {
+				continue
+			}
+			if filter.Severity != "" && incident.Severity != filter.Severity {
+				continue
+			}
+			if filter.Stage != "" && incident.Stage != filter.Stage {
+				continue
+			}
+			if filter.SourceIP != "" && !containsString(incident.SourceIPs, filter.SourceIP) {
+				continue
+			}
+			if filter.UserID != "" && !containsString(incident.UserIDs, filter.UserID) {
+				continue
+			}
+			if filter.APIID != "" && !containsString(incident.APIIDs, filter.APIID) {
+				continue
+			}
+			if filter.Active && !incidentActive(incident) {
+				continue
+			}
+			if !filter.Since.IsZero() && incident.LastSeen.Before(filter.Since) {
+				continue
+			}
+		}
+		result = append(result, *cloneIncident(incident))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+	return result, nil
+}
+
+func (r *MemoryIncidentRepository) FindActiveIncidents(ctx context.Context, keys []string, since time.Time) ([]models.Incident, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []models.Incident
+	for _, incident := range r.incidents {
+		if !incidentActive(incident) || incident.LastSeen.Before(since) {
+			continue
+		}
+		for _, key := range keys {
+			if containsString(incident.CorrelationKeys, key) {
+				result = append(result, *cloneIncident(incident))
+				break
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].FirstSeen.Before(result[j].FirstSeen)
+	})
+	return result, nil
+}
+
+func (r *MemoryIncidentRepository) AddIncidentThreat(ctx context.Context, incidentID, threatID, stage string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.incidents[incidentID]; !exists {
+		return fmt.Errorf("incident not found: %s", incidentID)
+	}
+	if !containsString(r.threats[incidentID], threatID) {
+		r.threats[incidentID] = append(r.threats[incidentID], threatID)
+	}
+	return nil
+}
+
+func (r *MemoryIncidentRepository) CopyIncidentThreats(ctx context.Context, fromID, toID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.incidents[toID]; !exists {
+		return fmt.Errorf("incident not found: %s", toID)
+	}
+	for _, threatID := range r.threats[fromID] {
+		if !containsString(r.threats[toID], threatID) {
+			r.threats[toID] = append(r.threats[toID], threatID)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryIncidentRepository) GetIncidentThreatIDs(ctx context.Context, incidentID string) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]string(nil), r.threats[incidentID]...), nil
+}
+
+func (r *MemoryIncidentRepository) WithIncidentLock(ctx context.Context, keys []string, fn func(repo IncidentRepositoryInterface) error) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return fn(r)
+}
+
+func incidentActive(incident *models.Incident) bool {
+	switch incident.Status {
+	case models.IncidentStatusOpen, models.IncidentStatusInvestigating, models.IncidentStatusContained:
+		return true
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func cloneIncident(incident *models.Incident) *models.Incident {
+	clone := *incident
+	clone.Stages = append([]string(nil), incident.Stages...)
+	clone.CorrelationKeys = append([]string(nil), incident.CorrelationKeys...)
+	clone.SourceIPs = append([]string(nil), incident.SourceIPs...)
+	clone.UserIDs = append([]string(nil), incident.UserIDs...)
+	clone.SessionIDs = append([]string(nil), incident.SessionIDs...)
+	clone.APIIDs = append([]string(nil), incident.APIIDs...)
+	clone.EndpointIDs = append([]string(nil), incident.EndpointIDs...)
+	clone.Timeline = append([]models.IncidentEvent(nil), incident.Timeline...)
+	clone.StageFirstSeen = make(map[string]time.Time, len(incident.StageFirstSeen))
+	for stage, at := range incident.StageFirstSeen {
+		clone.StageFirstSeen[stage] = at
+	}
+	clone.ThreatTypes = make(map[string]int, len(incident.ThreatTypes))
+	for threatType, count := range incident.ThreatTypes {
+		clone.ThreatTypes[threatType] = count
+	}
+	if incident.ResolvedAt != nil {
+		resolvedAt := *incident.ResolvedAt
+		clone.ResolvedAt = &resolvedAt
+	}
+	return &clone
+}
+
+// In-memory implementation of InjectionDetectorRepositoryInterface
+
+type MemoryInjectionDetectorRepository struct {
+	mu        sync.Mutex
+	detectors map[string]string
+}
+
+func NewMemoryInjectionDetectorRepository() *MemoryInjectionDetectorRepository {
+	return &MemoryInjectionDetectorRepository{
+		detectors: make(map[string]string),
+	}
+}
+
+func (r *MemoryInjectionDetectorRepository) GetInjectionDetectors(ctx context.Context) (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	detectors := make(map[string]string, len(r.detectors))
+	for endpointID, detector := range r.detectors {
+		detectors[endpointID] = detector
+	}
+	return detectors, nil
+}
+
+func (r *MemoryInjectionDetectorRepository) SaveInjectionDetector(ctx context.Context, endpointID, detector string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.detectors[endpointID] = detector
+	return nil
+}
+
+func (r *MemoryInjectionDetectorRepository) DeleteInjectionDetector(ctx context.Context, endpointID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.detectors, endpointID)
+	return nil
+}
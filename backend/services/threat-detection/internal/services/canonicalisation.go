@@ -0,0 +1,199 @@
+package services
+
+import (
+	"encoding/base64"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Bounds on canonicalisation. No decoder lengthens its input, so a value
+// costs at most maxCanonicalForms passes over its own length.
+const (
+	maxCanonicalDepth = 4
+	maxCanonicalForms = 32
+)
+
+// canonicalForm is a decoded form of a value and the decoders that produced
+// it, in the order they were applied
+type canonicalForm struct {
+	value      string
+	transforms []string
+}
+
+// canonicalMatch is a detection pattern found in a canonical form of a value
+type canonicalMatch struct {
+	pattern string
+	form    canonicalForm
+}
+
+// context describes the match for a threat indicator
+func (m canonicalMatch) context() map[string]interface{} {
+	transforms := m.form.transforms
+	if transforms == nil {
+		transforms = []string{}
+	}
+	return map[string]interface{}{
+		"matched_pattern": m.pattern,
+		"decoded_value":   m.form.value,
+		"transform_chain": transforms,
+	}
+}
+
+// canonicalDecoder undoes one encoding attackers use to hide payloads from
+// substring patterns. applies is a cheap check that skips values the decoder
+// cannot change.
+type canonicalDecoder struct {
+	name    string
+	applies func(string) bool
+	decode  func(string) string
+}
+
+var canonicalDecoders = []canonicalDecoder{
+	{"url_decode", func(v string) bool { return strings.ContainsAny(v, "%+") }, func(v string) string { return urlDecode(v, true) }},
+	{"overlong_utf8_decode", func(v string) bool { return !utf8.ValidString(v) }, decodeOverlongUTF8},
+	{"html_entity_decode", func(v string) bool { return strings.Contains(v, "&") }, html.UnescapeString},
+	{"escape_decode", func(v string) bool { return strings.Contains(v, `\`) }, decodeEscapes},
+	{"base64_decode", base64Token.MatchString, decodeBase64Tokens},
+	{"sql_comment_strip", func(v string) bool { return strings.Contains(v, "/*") }, stripSQLComments},
+	{"compress_whitespace", hasWhitespaceRun, compressWhitespace},
+}
+
+// canonicalForms returns value followed by every distinct form reachable by
+// chaining decoders, breadth first so the shortest chain to a form is the one
+// reported. Chains stop at maxCanonicalDepth decoders, and no more than
+// maxCanonicalForms forms are produced.
+func canonicalForms(value string) []canonicalForm {
+	forms := []canonicalForm{{value: value}}
+	seen := map[string]bool{value: true}
+	for start := 0; start < len(forms); start++ {
+		form := forms[start]
+		if len(form.transforms) == maxCanonicalDepth {
+			continue
+		}
+		for _, decoder := range canonicalDecoders {
+			if !decoder.applies(form.value) {
+				continue
+			}
+			decoded := decoder.decode(form.value)
+			if seen[decoded] {
+				continue
+			}
+			seen[decoded] = true
+
+			transforms := make([]string, len(form.transforms), len(form.transforms)+1)
+			copy(transforms, form.transforms)
+			forms = append(forms, canonicalForm{value: decoded, transforms: append(transforms, decoder.name)})
+			if len(forms) == maxCanonicalForms {
+				return forms
+			}
+		}
+	}
+	return forms
+}
+
+// matchCanonical looks for patterns, case-insensitively, in the raw value and
+// then in each decoded form, returning the first match
+func matchCanonical(value string, patterns []string) (canonicalMatch, bool) {
+	for _, form := range canonicalForms(value) {
+		lower := strings.ToLower(form.value)
+		for _, pattern := range patterns {
+			if strings.Contains(lower, strings.ToLower(pattern)) {
+				return canonicalMatch{pattern: pattern, form: form}, true
+			}
+		}
+	}
+	return canonicalMatch{}, false
+}
+
+// decodeOverlongUTF8 decodes overlong two- and three-byte UTF-8 encodings of
+// ASCII, such as C0 AF for '/', which lenient decoders accept
+func decodeOverlongUTF8(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case (c == 0xc0 || c == 0xc1) && i+1 < len(value) && isContinuation(value[i+1]):
+			b.WriteByte((c&0x1f)<<6 | value[i+1]&0x3f)
+			i++
+		case c == 0xe0 && i+2 < len(value) && value[i+1] >= 0x80 && value[i+1] <= 0x81 && isContinuation(value[i+2]):
+			b.WriteByte((value[i+1]&0x3f)<<6 | value[i+2]&0x3f)
+			i += 2
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isContinuation(c byte) bool {
+	return c >= 0x80 && c <= 0xbf
+}
+
+// base64Token matches runs long enough to be an encoded payload rather than
+// an ordinary word
+var base64Token = regexp.MustCompile(`[A-Za-z0-9+/]{12,}={0,2}`)
+
+// decodeBase64Tokens replaces each base64 run that decodes to printable text
+// with its decoding, leaving the rest of the value in place
+func decodeBase64Tokens(value string) string {
+	return base64Token.ReplaceAllStringFunc(value, func(token string) string {
+		decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(token, "="))
+		if err != nil || !printableText(decoded) {
+			return token
+		}
+		return string(decoded)
+	})
+}
+
+func printableText(value []byte) bool {
+	if !utf8.Valid(value) {
+		return false
+	}
+	for _, r := range string(value) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// stripSQLComments unwraps MySQL executable comments (/*! ... */ and
+// /*!50000 ... */), whose content the server runs, and replaces other block
+// comments with a space, since SQL treats them as token separators
+func stripSQLComments(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); {
+		if !strings.HasPrefix(value[i:], "/*") {
+			b.WriteByte(value[i])
+			i++
+			continue
+		}
+		body := value[i+2:]
+		end := strings.Index(body, "*/")
+		if end < 0 {
+			end = len(body)
+		}
+		if strings.HasPrefix(body, "!") {
+			b.WriteString(strings.TrimLeft(body[1:end], "0123456789"))
+		} else {
+			b.WriteByte(' ')
+		}
+		i += 2 + end + 2
+	}
+	return b.String()
+}
+
+func hasWhitespaceRun(value string) bool {
+	space := false
+	for _, r := range value {
+		current := unicode.IsSpace(r)
+		if current && (space || r != ' ') {
+			return true
+		}
+		space = current
+	}
+	return false
+}
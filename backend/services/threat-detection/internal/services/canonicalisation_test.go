@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"scopeapi.local/backend/services/threat-detection/internal/repository"
+	"scopeapi.local/backend/shared/logging"
+)
+
+func TestMatchCanonical(t *testing.T) {
+	tests := []struct {
+		input     string
+		patterns  []string
+		pattern   string
+		decoded   string
+		transform string
+	}{
+		{"id=1 UNION SELECT", []string{"union select"}, "union select", "id=1 UNION SELECT", "[]"},
+		{"%2e%2e%2fetc%2fpasswd", []string{"../"}, "../", "../etc/passwd", "[url_decode]"},
+		{"..%252f..%252fetc", []string{"../"}, "../", "../../etc", "[url_decode url_decode]"},
+		{"..%c0%af..%c1%9cwin", []string{"../", `..\`}, "../", `../..\win`, "[url_decode overlong_utf8_decode]"},
+		{"%u003cscript%u003e", []string{"<script"}, "<script", "<script>", "[url_decode]"},
+		{`\x3cscript\x3e`, []string{"<script"}, "<script", "<script>", "[escape_decode]"},
+		{"&#x3c;img src=x onerror=alert(1)&gt;", []string{"<img"}, "<img", "<img src=x onerror=alert(1)>", "[html_entity_decode]"},
+		{"%26lt%3Bsvg%26gt%3B", []string{"<svg"}, "<svg", "<svg>", "[url_decode html_entity_decode]"},
+		{"q=PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==", []string{"<script"}, "<script", "q=<script>alert(1)</script>", "[base64_decode]"},
+		{"1/**/UNION/**/SELECT", []string{"union select"}, "union select", "1 UNION SELECT", "[sql_comment_strip]"},
+		{"1 /*!50000UNION*/ /*!SELECT*/ 2", []string{"union select"}, "union select", "1 UNION SELECT 2", "[sql_comment_strip]"},
+		{"1%20UNION%09%0aSELECT", []string{"union select"}, "union select", "1 UNION SELECT", "[url_decode compress_whitespace]"},
+	}
+	for _, tt := range tests {
+		match, ok := matchCanonical(tt.input, tt.patterns)
+		if !ok {
+			t.Errorf("matchCanonical(%q) found nothing", tt.input)
+			continue
+		}
+		if match.pattern != tt.pattern || match.form.value != tt.decoded || fmt.Sprint(match.form.transforms) != tt.transform {
+			t.Errorf("matchCanonical(%q) = %q in %q via %v, want %q in %q via %s",
+				tt.input, match.pattern, match.form.value, match.form.transforms, tt.pattern, tt.decoded, tt.transform)
+		}
+	}
+
+	if match, ok := matchCanonical("aGVsbG8gd29ybGQgYWdhaW4=", []string{"../"}); ok {
+		t.Errorf("benign value matched %q in %q", match.pattern, match.form.value)
+	}
+}
+
+func TestCanonicalFormsAreBounded(t *testing.T) {
+	// Every layer of percent-encoding needs another url_decode
+	value := "../"
+	for i := 0; i < 10; i++ {
+		value = strings.ReplaceAll(value, "%", "%25")
+		value = strings.NewReplacer(".", "%2e", "/", "%2f").Replace(value)
+	}
+	for _, form := range canonicalForms(value) {
+		if len(form.transforms) > maxCanonicalDepth {
+			t.Fatalf("form %q decoded %d times", form.value, len(form.transforms))
+		}
+	}
+	if _, ok := matchCanonical(value, []string{"../"}); ok {
+		t.Errorf("payload encoded 11 times decoded within %d steps", maxCanonicalDepth)
+	}
+
+	mixed := strings.Repeat("%2541 &amp;amp; \\x41 /**/ QUFBQUFBQUFBQUFB  ", 50)
+	if forms := canonicalForms(mixed); len(forms) > maxCanonicalForms {
+		t.Errorf("canonicalForms produced %d forms", len(forms))
+	}
+}
+
+func TestThreatDetectionReportsDecodedMatch(t *testing.T) {
+	service := NewThreatDetectionService(repository.NewMemoryThreatRepository(), nil, logging.NewStructuredLogger("test"))
+	traffic := map[string]interface{}{"request": map[string]interface{}{
+		"path":       "/files/%252e%252e%252fetc%252fpasswd",
+		"parameters": map[string]interface{}{"q": "%253Csvg%252Fonload%253Dconfirm%2560%2531%2560%253E"},
+	}}
+
+	threats, _ := service.detectPathTraversal(context.Background(), traffic)
+	if len(threats) != 1 {
+		t.Fatalf("detectPathTraversal found %d threats", len(threats))
+	}
+	details := threats[0].Indicators[0].Context.(map[string]interface{})
+	if details["decoded_value"] != "/files/../etc/passwd" || fmt.Sprint(details["transform_chain"]) != "[url_decode url_decode]" {
+		t.Errorf("path traversal context = %v", details)
+	}
+
+	threats, _ = service.detectXSS(context.Background(), traffic)
+	if len(threats) != 1 {
+		t.Fatalf("detectXSS found %d threats", len(threats))
+	}
+	details = threats[0].Indicators[0].Context.(map[string]interface{})
+	if details["matched_pattern"] != "onload=" || details["decoded_value"] != "<svg/onload=confirm`1`>" ||
+		fmt.Sprint(details["transform_chain"]) != "[url_decode url_decode]" {
+		t.Errorf("xss context = %v", details)
+	}
+}
@@ -0,0 +1,809 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"scopeapi.local/backend/services/threat-detection/internal/models"
+	"scopeapi.local/backend/services/threat-detection/internal/repository"
+	"scopeapi.local/backend/shared/logging"
+	"scopeapi.local/backend/shared/messaging/kafka"
+)
+
+var (
+	// ErrIncidentNotFound is returned for an incident ID with no incident
+	ErrIncidentNotFound = errors.New("incident not found")
+	// ErrInvalidIncidentTransition is returned for a status change the
+	// incident lifecycle does not allow
+	ErrInvalidIncidentTransition = errors.New("invalid incident status transition")
+	// ErrInvalidCorrelationPolicy is returned for a non-positive window or
+	// escalation threshold, or an unknown group_by attribute
+	ErrInvalidCorrelationPolicy = errors.New("correlation policy needs a positive window and threshold and group_by of source_ip, user_id, session_id or api_id")
+)
+
+// IncidentCorrelator groups detected threats into incidents
+type IncidentCorrelator interface {
+	CorrelateThreats(ctx context.Context, threats []models.Threat) ([]models.Incident, error)
+}
+
+type IncidentCorrelationServiceInterface interface {
+	IncidentCorrelator
+	GetIncidents(ctx context.Context, filter *models.IncidentFilter) ([]models.Incident, error)
+	GetIncident(ctx context.Context, incidentID string) (*models.Incident, error)
+	GetIncidentThreats(ctx context.Context, incidentID string) ([]models.Threat, error)
+	UpdateIncidentStatus(ctx context.Context, incidentID string, update *models.IncidentUpdateRequest) (*models.Incident, error)
+}
+
+// DefaultCorrelationPolicy links threats from the same source IP, user or
+// session up to 30 minutes apart
+var DefaultCorrelationPolicy = models.CorrelationPolicy{
+	Window:              30 * time.Minute,
+	GroupBy:             []string{models.CorrelateBySourceIP, models.CorrelateByUserID, models.CorrelateBySessionID},
+	EscalationThreshold: 10,
+}
+
+// killChainStages lists the stages in the order an attack progresses
+var killChainStages = []string{
+	models.KillChainRecon,
+	models.KillChainProbing,
+	models.KillChainExploitation,
+	models.KillChainExfiltration,
+}
+
+// threatStages places threat types on the kill chain. Anomalies are treated
+// as reconnaissance, and so are types not listed here.
+var threatStages = map[string]string{
+	models.ThreatTypeAnomaly:          models.KillChainRecon,
+	"behavioral":                      models.KillChainRecon,
+	"pattern":                         models.KillChainRecon,
+	"ml_anomaly":                      models.KillChainRecon,
+	"ml_behavioral":                   models.KillChainRecon,
+	"ml_pattern":                      models.KillChainRecon,
+	models.ThreatTypeBruteForce:       models.KillChainProbing,
+	models.ThreatTypeDDoS:             models.KillChainProbing,
+	models.ThreatTypeRateLimitAbuse:   models.KillChainProbing,
+	models.ThreatTypeUnauthorized:     models.KillChainProbing,
+	models.ThreatTypeInjection:        models.KillChainExploitation,
+	"sql_injection":                   models.KillChainExploitation,
+	models.ThreatTypeXSS:              models.KillChainExploitation,
+	"path_traversal":                  models.KillChainExploitation,
+	"command_injection":               models.KillChainExploitation,
+	models.ThreatTypeCSRF:             models.KillChainExploitation,
+	models.ThreatTypePrivilegeEsc:     models.KillChainExploitation,
+	models.ThreatTypeMalware:          models.KillChainExploitation,
+	models.ThreatTypeDataExfiltration: models.KillChainExfiltration,
+}
+
+var stageTitles = map[string]string{
+	models.KillChainRecon:        "Reconnaissance",
+	models.KillChainProbing:      "Probing",
+	models.KillChainExploitation: "Exploitation attempts",
+	models.KillChainExfiltration: "Data exfiltration",
+}
+
+// incidentSeverities lists severities from lowest to highest
+var incidentSeverities = []string{
+	models.ThreatSeverityInfo,
+	models.ThreatSeverityLow,
+	models.ThreatSeverityMedium,
+	models.ThreatSeverityHigh,
+	models.ThreatSeverityCritical,
+}
+
+// incidentTransitions lists the statuses each status may move to. Merged and
+// closed incidents are final.
+var incidentTransitions = map[string][]string{
+	models.IncidentStatusOpen:          {models.IncidentStatusInvestigating, models.IncidentStatusContained, models.IncidentStatusResolved, models.IncidentStatusFalsePositive},
+	models.IncidentStatusInvestigating: {models.IncidentStatusContained, models.IncidentStatusResolved, models.IncidentStatusFalsePositive},
+	models.IncidentStatusContained:     {models.IncidentStatusInvestigating, models.IncidentStatusResolved},
+	models.IncidentStatusResolved:      {models.IncidentStatusOpen, models.IncidentStatusClosed},
+	models.IncidentStatusFalsePositive: {models.IncidentStatusOpen, models.IncidentStatusClosed},
+}
+
+// threatStatuses is the status given to an incident's threats when it is
+// resolved or found to be a false positive
+var threatStatuses = map[string]string{
+	models.IncidentStatusResolved:      models.ThreatStatusResolved,
+	models.IncidentStatusFalsePositive: models.ThreatStatusFalsePos,
+}
+
+type IncidentCorrelationService struct {
+	incidentRepo  repository.IncidentRepositoryInterface
+	threatRepo    repository.ThreatRepositoryInterface
+	kafkaProducer kafka.ProducerInterface
+	logger        logging.Logger
+
+	// mu guards the policy. Changes to incidents are serialised by the
+	// repository's WithIncidentLock instead, which holds across replicas, so
+	// threats arriving together from one actor cannot open two incidents and
+	// a status change cannot undo a threat being added.
+	mu     sync.RWMutex
+	policy models.CorrelationPolicy
+}
+
+func NewIncidentCorrelationService(
+	incidentRepo repository.IncidentRepositoryInterface,
+	threatRepo repository.ThreatRepositoryInterface,
+	kafkaProducer kafka.ProducerInterface,
+	logger logging.Logger,
+) *IncidentCorrelationService {
+	policy := DefaultCorrelationPolicy
+	policy.GroupBy = append([]string(nil), DefaultCorrelationPolicy.GroupBy...)
+	return &IncidentCorrelationService{
+		incidentRepo:  incidentRepo,
+		threatRepo:    threatRepo,
+		kafkaProducer: kafkaProducer,
+		logger:        logger,
+		policy:        policy,
+	}
+}
+
+// SetCorrelationPolicy changes how later threats are grouped; incidents
+// already open keep their correlation keys
+func (s *IncidentCorrelationService) SetCorrelationPolicy(ctx context.Context, policy models.CorrelationPolicy) error {
+	if policy.Window <= 0 || policy.EscalationThreshold <= 0 || len(policy.GroupBy) == 0 {
+		return ErrInvalidCorrelationPolicy
+	}
+	for _, attribute := range policy.GroupBy {
+		switch attribute {
+		case models.CorrelateBySourceIP, models.CorrelateByUserID, models.CorrelateBySessionID, models.CorrelateByAPIID:
+		default:
+			return ErrInvalidCorrelationPolicy
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = policy
+	s.policy.GroupBy = append([]string(nil), policy.GroupBy...)
+	s.logger.Info("Correlation policy updated", "window", policy.Window, "group_by", policy.GroupBy, "escalation_threshold", policy.EscalationThreshold)
+	return nil
+}
+
+func (s *IncidentCorrelationService) correlationPolicy() models.CorrelationPolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.policy
+}
+
+// CorrelateThreats adds each threat to the active incident sharing one of its
+// correlation keys within the window, opening an incident when there is
+// none. A threat linking several incidents merges them into the oldest.
+// It returns the incidents the threats were added to.
+func (s *IncidentCorrelationService) CorrelateThreats(ctx context.Context, threats []models.Threat) ([]models.Incident, error) {
+	var order []string
+	touched := make(map[string]*models.Incident)
+	for _, threat := range threats {
+		changes, err := s.correlateThreat(ctx, threat)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range changes {
+			s.publishIncidentEvents(ctx, change.incident, change.from)
+		}
+		if len(changes) == 0 {
+			continue
+		}
+
+		// The incidents merged away come first, and the one the threat joined last
+		for _, change := range changes[:len(changes)-1] {
+			if _, ok := touched[change.incident.ID]; ok {
+				// Report it as merged rather than as it was earlier in the batch
+				touched[change.incident.ID] = change.incident
+			}
+		}
+		incident := changes[len(changes)-1].incident
+		if _, ok := touched[incident.ID]; !ok {
+			order = append(order, incident.ID)
+		}
+		touched[incident.ID] = incident
+	}
+
+	incidents := make([]models.Incident, 0, len(order))
+	for _, id := range order {
+		incidents = append(incidents, *touched[id])
+	}
+	return incidents, nil
+}
+
+// incidentChange is an incident changed by correlation, with the index of its
+// first new timeline event
+type incidentChange struct {
+	incident *models.Incident
+	from     int
+}
+
+// correlateThreat adds one threat to its incident and returns the incidents
+// it changed, ending with the one the threat was added to
+func (s *IncidentCorrelationService) correlateThreat(ctx context.Context, threat models.Threat) ([]incidentChange, error) {
+	policy := s.correlationPolicy()
+	keys := correlationKeys(threat, policy)
+	if len(keys) == 0 {
+		s.logger.Debug("Threat has no correlation attributes", "threat_id", threat.ID, "threat_type", threat.Type)
+		return nil, nil
+	}
+	at := threatTime(threat)
+
+	var changes []incidentChange
+	err := s.incidentRepo.WithIncidentLock(ctx, keys, func(repo repository.IncidentRepositoryInterface) error {
+		changes = nil
+		candidates, err := repo.FindActiveIncidents(ctx, keys, at.Add(-policy.Window))
+		if err != nil {
+			return fmt.Errorf("failed to find incidents: %w", err)
+		}
+
+		var incident *models.Incident
+		eventsBefore := 0
+		if len(candidates) == 0 {
+			incident = s.newIncident(threat, at)
+			s.addThreat(incident, threat, keys, at)
+			if err := repo.CreateIncident(ctx, incident); err != nil {
+				return fmt.Errorf("failed to create incident: %w", err)
+			}
+		} else {
+			incident = &candidates[0]
+			eventsBefore = len(incident.Timeline)
+			for i := range candidates[1:] {
+				merged := &candidates[i+1]
+				s.mergeIncident(incident, merged)
+				if err := repo.UpdateIncident(ctx, merged); err != nil {
+					return fmt.Errorf("failed to update merged incident: %w", err)
+				}
+				if err := repo.CopyIncidentThreats(ctx, merged.ID, incident.ID); err != nil {
+					return fmt.Errorf("failed to copy threats of merged incident: %w", err)
+				}
+				changes = append(changes, incidentChange{incident: merged, from: len(merged.Timeline) - 1})
+			}
+			s.addThreat(incident, threat, keys, at)
+			if err := repo.UpdateIncident(ctx, incident); err != nil {
+				return fmt.Errorf("failed to update incident: %w", err)
+			}
+		}
+		if threat.ID != "" {
+			if err := repo.AddIncidentThreat(ctx, incident.ID, threat.ID, killChainStage(threat.Type)); err != nil {
+				return fmt.Errorf("failed to add threat to incident: %w", err)
+			}
+		}
+		changes = append(changes, incidentChange{incident: incident, from: eventsBefore})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Merges are logged once the transaction holding them has committed
+	for _, change := range changes[:len(changes)-1] {
+		s.logger.Info("Incidents merged", "incident_id", change.incident.MergedInto, "merged_id", change.incident.ID)
+	}
+	return changes, nil
+}
+
+// correlationKeys lists the keys a threat is matched on under the policy
+func correlationKeys(threat models.Threat, policy models.CorrelationPolicy) []string {
+	var keys []string
+	byAPI := false
+	for _, attribute := range policy.GroupBy {
+		var prefix, value string
+		switch attribute {
+		case models.CorrelateBySourceIP:
+			prefix, value = "ip", threatSourceIP(threat)
+		case models.CorrelateByUserID:
+			prefix, value = "user", threatAttribute(threat, "user_id")
+		case models.CorrelateBySessionID:
+			prefix, value = "session", threatAttribute(threat, "session_id")
+		case models.CorrelateByAPIID:
+			byAPI = true
+		}
+		if value != "" {
+			keys = append(keys, prefix+":"+value)
+		}
+	}
+
+	if !byAPI || threat.APIID == "" {
+		return keys
+	}
+	apiKey := "api:" + threat.APIID
+	if len(policy.GroupBy) == 1 {
+		return []string{apiKey}
+	}
+	for i := range keys {
+		keys[i] = apiKey + "/" + keys[i]
+	}
+	return keys
+}
+
+func threatSourceIP(threat models.Threat) string {
+	if threat.SourceIP != "" {
+		return threat.SourceIP
+	}
+	return threat.IPAddress
+}
+
+// threatAttribute reads a request attribute such as user_id from the threat's
+// request data, which some detectors store with the request nested inside
+func threatAttribute(threat models.Threat, key string) string {
+	if value, ok := threat.RequestData[key].(string); ok && value != "" {
+		return value
+	}
+	if requestData, ok := threat.RequestData["request"].(map[string]interface{}); ok {
+		if value, ok := requestData[key].(string); ok {
+			return value
+		}
+	}
+	if value, ok := threat.Metadata[key].(string); ok {
+		return value
+	}
+	return ""
+}
+
+func threatTime(threat models.Threat) time.Time {
+	switch {
+	case !threat.Timestamp.IsZero():
+		return threat.Timestamp
+	case !threat.CreatedAt.IsZero():
+		return threat.CreatedAt
+	default:
+		return time.Now()
+	}
+}
+
+func killChainStage(threatType string) string {
+	if stage, ok := threatStages[threatType]; ok {
+		return stage
+	}
+	return models.KillChainRecon
+}
+
+func stageRank(stage string) int {
+	for i, s := range killChainStages {
+		if s == stage {
+			return i
+		}
+	}
+	return -1
+}
+
+func severityRank(severity string) int {
+	for i, s := range incidentSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *IncidentCorrelationService) newIncident(threat models.Threat, at time.Time) *models.Incident {
+	now := time.Now()
+	incident := &models.Incident{
+		ID:             uuid.New().String(),
+		Status:         models.IncidentStatusOpen,
+		ThreatTypes:    make(map[string]int),
+		StageFirstSeen: make(map[string]time.Time),
+		FirstSeen:      at,
+		LastSeen:       at,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	incident.Timeline = append(incident.Timeline, models.IncidentEvent{
+		Type:        models.IncidentEventCreated,
+		Description: fmt.Sprintf("Opened for %s threat %s", threat.Type, threat.ID),
+		Timestamp:   now,
+	})
+	return incident
+}
+
+// addThreat records a threat on an incident, advancing its kill-chain stage
+// and escalating its severity as needed
+func (s *IncidentCorrelationService) addThreat(incident *models.Incident, threat models.Threat, keys []string, at time.Time) {
+	incident.ThreatCount++
+	incident.ThreatTypes[threat.Type]++
+	for _, key := range keys {
+		incident.CorrelationKeys = appendUnique(incident.CorrelationKeys, key)
+	}
+	incident.SourceIPs = appendUnique(incident.SourceIPs, threatSourceIP(threat))
+	incident.UserIDs = appendUnique(incident.UserIDs, threatAttribute(threat, "user_id"))
+	incident.SessionIDs = appendUnique(incident.SessionIDs, threatAttribute(threat, "session_id"))
+	incident.APIIDs = appendUnique(incident.APIIDs, threat.APIID)
+	incident.EndpointIDs = appendUnique(incident.EndpointIDs, threat.EndpointID)
+	if at.Before(incident.FirstSeen) {
+		incident.FirstSeen = at
+	}
+	if at.After(incident.LastSeen) {
+		incident.LastSeen = at
+	}
+	if threat.RiskScore > incident.RiskScore {
+		incident.RiskScore = threat.RiskScore
+	}
+	if severityRank(threat.Severity) > severityRank(incident.ThreatSeverity) {
+		incident.ThreatSeverity = threat.Severity
+	}
+
+	s.advanceStage(incident, killChainStage(threat.Type), at, fmt.Sprintf("%s threat %s", threat.Type, threat.ID))
+	s.escalate(incident)
+	incident.UpdatedAt = time.Now()
+}
+
+// advanceStage records a stage reached at a time, moving the incident to it
+// when it is further along the kill chain
+func (s *IncidentCorrelationService) advanceStage(incident *models.Incident, stage string, at time.Time, cause string) {
+	if incident.StageFirstSeen == nil {
+		incident.StageFirstSeen = make(map[string]time.Time)
+	}
+	if first, ok := incident.StageFirstSeen[stage]; !ok || at.Before(first) {
+		incident.StageFirstSeen[stage] = at
+	}
+	for _, seen := range incident.Stages {
+		if seen == stage {
+			return
+		}
+	}
+	incident.Stages = append(incident.Stages, stage)
+	if stageRank(stage) <= stageRank(incident.Stage) {
+		return
+	}
+
+	previous := incident.Stage
+	incident.Stage = stage
+	incident.Title = fmt.Sprintf("%s from %s", stageTitles[stage], incidentActor(incident))
+	if previous != "" {
+		incident.Timeline = append(incident.Timeline, models.IncidentEvent{
+			Type:        models.IncidentEventStageAdvanced,
+			Description: fmt.Sprintf("Kill chain advanced to %s by %s", stage, cause),
+			From:        previous,
+			To:          stage,
+			Timestamp:   time.Now(),
+		})
+	}
+}
+
+// escalate raises the incident's severity a level above its worst threat for
+// each of: exploitation following recon or probing, exfiltration following
+// an earlier stage, and reaching the escalation threshold of threats. A stage
+// follows another when its first threat is later than the other's first.
+// Severity is never lowered.
+func (s *IncidentCorrelationService) escalate(incident *models.Incident) {
+	level := severityRank(incident.ThreatSeverity)
+	if level < 0 {
+		level = severityRank(models.ThreatSeverityMedium)
+	}
+
+	var reasons []string
+	follows := func(stage string, earlier ...string) bool {
+		at, ok := incident.StageFirstSeen[stage]
+		if !ok {
+			return false
+		}
+		for _, previous := range earlier {
+			if first, ok := incident.StageFirstSeen[previous]; ok && first.Before(at) {
+				return true
+			}
+		}
+		return false
+	}
+	if follows(models.KillChainExploitation, models.KillChainRecon, models.KillChainProbing) {
+		reasons = append(reasons, "exploitation followed reconnaissance or probing")
+	}
+	if follows(models.KillChainExfiltration, models.KillChainRecon, models.KillChainProbing, models.KillChainExploitation) {
+		reasons = append(reasons, "exfiltration followed earlier attack stages")
+	}
+	if incident.ThreatCount >= s.correlationPolicy().EscalationThreshold {
+		reasons = append(reasons, fmt.Sprintf("%d threats correlated", incident.ThreatCount))
+	}
+	level += len(reasons)
+	if level >= len(incidentSeverities) {
+		level = len(incidentSeverities) - 1
+	}
+
+	severity := incidentSeverities[level]
+	if severityRank(severity) <= severityRank(incident.Severity) {
+		return
+	}
+	previous := incident.Severity
+	incident.Severity = severity
+	if previous == "" {
+		return
+	}
+	description := fmt.Sprintf("Severity raised by a %s threat", incident.ThreatSeverity)
+	if len(reasons) > 0 {
+		description = fmt.Sprintf("Severity escalated: %s", strings.Join(reasons, ", "))
+	}
+	incident.Timeline = append(incident.Timeline, models.IncidentEvent{
+		Type:        models.IncidentEventSeverityEscalated,
+		Description: description,
+		From:        previous,
+		To:          severity,
+		Timestamp:   time.Now(),
+	})
+}
+
+// mergeIncident folds other into incident and marks other as merged
+func (s *IncidentCorrelationService) mergeIncident(incident, other *models.Incident) {
+	now := time.Now()
+	incident.ThreatCount += other.ThreatCount
+	for threatType, count := range other.ThreatTypes {
+		incident.ThreatTypes[threatType] += count
+	}
+	for _, values := range [][2]*[]string{
+		{&incident.CorrelationKeys, &other.CorrelationKeys},
+		{&incident.SourceIPs, &other.SourceIPs},
+		{&incident.UserIDs, &other.UserIDs},
+		{&incident.SessionIDs, &other.SessionIDs},
+		{&incident.APIIDs, &other.APIIDs},
+		{&incident.EndpointIDs, &other.EndpointIDs},
+	} {
+		for _, value := range *values[1] {
+			*values[0] = appendUnique(*values[0], value)
+		}
+	}
+	if other.FirstSeen.Before(incident.FirstSeen) {
+		incident.FirstSeen = other.FirstSeen
+	}
+	if other.LastSeen.After(incident.LastSeen) {
+		incident.LastSeen = other.LastSeen
+	}
+	if other.RiskScore > incident.RiskScore {
+		incident.RiskScore = other.RiskScore
+	}
+	if severityRank(other.ThreatSeverity) > severityRank(incident.ThreatSeverity) {
+		incident.ThreatSeverity = other.ThreatSeverity
+	}
+	if severityRank(other.Severity) > severityRank(incident.Severity) {
+		incident.Severity = other.Severity
+	}
+
+	incident.Timeline = append(incident.Timeline, models.IncidentEvent{
+		Type:        models.IncidentEventMerged,
+		Description: fmt.Sprintf("Merged incident %s with %d threats", other.ID, other.ThreatCount),
+		Timestamp:   now,
+	})
+	for _, stage := range other.Stages {
+		s.advanceStage(incident, stage, other.StageFirstSeen[stage], "merged incident "+other.ID)
+	}
+	s.escalate(incident)
+	incident.UpdatedAt = now
+
+	previous := other.Status
+	other.Status = models.IncidentStatusMerged
+	other.MergedInto = incident.ID
+	other.UpdatedAt = now
+	other.Timeline = append(other.Timeline, models.IncidentEvent{
+		Type:        models.IncidentEventMerged,
+		Description: fmt.Sprintf("Merged into incident %s", incident.ID),
+		From:        previous,
+		To:          models.IncidentStatusMerged,
+		Timestamp:   now,
+	})
+}
+
+// incidentActor describes who an incident is about for its title
+func incidentActor(incident *models.Incident) string {
+	switch {
+	case len(incident.SourceIPs) > 0:
+		return incident.SourceIPs[0]
+	case len(incident.UserIDs) > 0:
+		return "user " + incident.UserIDs[0]
+	case len(incident.SessionIDs) > 0:
+		return "session " + incident.SessionIDs[0]
+	case len(incident.APIIDs) > 0:
+		return "API " + incident.APIIDs[0]
+	default:
+		return "unknown source"
+	}
+}
+
+func appendUnique(values []string, value string) []string {
+	if value == "" {
+		return values
+	}
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+func (s *IncidentCorrelationService) GetIncidents(ctx context.Context, filter *models.IncidentFilter) ([]models.Incident, error) {
+	return s.incidentRepo.ListIncidents(ctx, filter)
+}
+
+func (s *IncidentCorrelationService) GetIncident(ctx context.Context, incidentID string) (*models.Incident, error) {
+	incident, err := s.incidentRepo.GetIncident(ctx, incidentID)
+	if err != nil {
+		return nil, err
+	}
+	if incident == nil {
+		return nil, ErrIncidentNotFound
+	}
+	return incident, nil
+}
+
+// GetIncidentThreats returns the threats grouped into an incident, skipping
+// any deleted since
+func (s *IncidentCorrelationService) GetIncidentThreats(ctx context.Context, incidentID string) ([]models.Threat, error) {
+	incident, err := s.GetIncident(ctx, incidentID)
+	if err != nil {
+		return nil, err
+	}
+	threatIDs, err := s.incidentRepo.GetIncidentThreatIDs(ctx, incident.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get incident threats: %w", err)
+	}
+
+	threats := make([]models.Threat, 0, len(threatIDs))
+	for _, threatID := range threatIDs {
+		threat, err := s.threatRepo.GetThreat(ctx, threatID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get threat %s: %w", threatID, err)
+		}
+		if threat != nil {
+			threats = append(threats, *threat)
+		}
+	}
+	return threats, nil
+}
+
+// UpdateIncidentStatus moves an incident through its lifecycle and records
+// assignments and notes on its timeline. Resolving an incident or marking it
+// a false positive updates its threats to match.
+func (s *IncidentCorrelationService) UpdateIncidentStatus(ctx context.Context, incidentID string, update *models.IncidentUpdateRequest) (*models.Incident, error) {
+	incident, eventsBefore, err := s.updateIncident(ctx, incidentID, update)
+	if err != nil {
+		return nil, err
+	}
+	if len(incident.Timeline) == eventsBefore {
+		return incident, nil
+	}
+
+	statusChanged := false
+	for _, event := range incident.Timeline[eventsBefore:] {
+		statusChanged = statusChanged || event.Type == models.IncidentEventStatusChanged
+	}
+	if threatStatus, ok := threatStatuses[incident.Status]; ok && statusChanged {
+		threatIDs, err := s.incidentRepo.GetIncidentThreatIDs(ctx, incident.ID)
+		if err != nil {
+			s.logger.Error("Failed to get threats of incident", "incident_id", incident.ID, "error", err)
+		}
+		for _, threatID := range threatIDs {
+			if err := s.updateThreatStatus(ctx, threatID, threatStatus); err != nil {
+				s.logger.Error("Failed to update threat of incident", "incident_id", incident.ID, "threat_id", threatID, "error", err)
+			}
+		}
+	}
+
+	s.publishIncidentEvents(ctx, incident, eventsBefore)
+	return incident, nil
+}
+
+// updateIncident applies a status update and stores the incident, returning
+// it with the index of its first new timeline event
+func (s *IncidentCorrelationService) updateIncident(ctx context.Context, incidentID string, update *models.IncidentUpdateRequest) (*models.Incident, int, error) {
+	var incident *models.Incident
+	eventsBefore := 0
+	err := s.incidentRepo.WithIncidentLock(ctx, nil, func(repo repository.IncidentRepositoryInterface) error {
+		var err error
+		incident, err = repo.GetIncident(ctx, incidentID)
+		if err != nil {
+			return err
+		}
+		if incident == nil {
+			return ErrIncidentNotFound
+		}
+		eventsBefore = len(incident.Timeline)
+		now := time.Now()
+
+		statusChanged := update.Status != "" && update.Status != incident.Status
+		if statusChanged {
+			allowed := false
+			for _, status := range incidentTransitions[incident.Status] {
+				if status == update.Status {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return fmt.Errorf("%w: %s to %s", ErrInvalidIncidentTransition, incident.Status, update.Status)
+			}
+
+			previous := incident.Status
+			incident.Status = update.Status
+			switch update.Status {
+			case models.IncidentStatusResolved, models.IncidentStatusFalsePositive:
+				incident.ResolvedAt = &now
+			case models.IncidentStatusOpen:
+				incident.ResolvedAt = nil
+			}
+			incident.Timeline = append(incident.Timeline, models.IncidentEvent{
+				Type:        models.IncidentEventStatusChanged,
+				Description: update.Note,
+				From:        previous,
+				To:          update.Status,
+				Actor:       update.Actor,
+				Timestamp:   now,
+			})
+		} else if update.Note != "" {
+			incident.Timeline = append(incident.Timeline, models.IncidentEvent{
+				Type:        models.IncidentEventNote,
+				Description: update.Note,
+				Actor:       update.Actor,
+				Timestamp:   now,
+			})
+		}
+
+		if update.Assignee != "" && update.Assignee != incident.Assignee {
+			incident.Timeline = append(incident.Timeline, models.IncidentEvent{
+				Type:        models.IncidentEventAssigned,
+				Description: fmt.Sprintf("Assigned to %s", update.Assignee),
+				From:        incident.Assignee,
+				To:          update.Assignee,
+				Actor:       update.Actor,
+				Timestamp:   now,
+			})
+			incident.Assignee = update.Assignee
+		}
+
+		if len(incident.Timeline) == eventsBefore {
+			return nil
+		}
+		incident.UpdatedAt = now
+		if err := repo.UpdateIncident(ctx, incident); err != nil {
+			return fmt.Errorf("failed to update incident: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return incident, eventsBefore, nil
+}
+
+func (s *IncidentCorrelationService) updateThreatStatus(ctx context.Context, threatID, status string) error {
+	threat, err := s.threatRepo.GetThreat(ctx, threatID)
+	if err != nil || threat == nil {
+		return err
+	}
+	threat.Status = status
+	threat.UpdatedAt = time.Now()
+	return s.threatRepo.UpdateThreat(ctx, threatID, threat)
+}
+
+// publishIncidentEvents publishes the incident's timeline events from index
+// from onwards
+func (s *IncidentCorrelationService) publishIncidentEvents(ctx context.Context, incident *models.Incident, from int) {
+	if s.kafkaProducer == nil {
+		return
+	}
+	for _, event := range incident.Timeline[from:] {
+		eventJSON, err := json.Marshal(map[string]interface{}{
+			"event_type":   "incident_" + event.Type,
+			"incident_id":  incident.ID,
+			"status":       incident.Status,
+			"severity":     incident.Severity,
+			"stage":        incident.Stage,
+			"threat_count": incident.ThreatCount,
+			"source_ips":   incident.SourceIPs,
+			"api_ids":      incident.APIIDs,
+			"description":  event.Description,
+			"timestamp":    event.Timestamp,
+		})
+		if err != nil {
+			s.logger.Error("Failed to marshal incident event", "incident_id", incident.ID, "error", err)
+			continue
+		}
+
+		message := kafka.Message{
+			Topic: "incident_events",
+			Key:   []byte(incident.ID),
+			Value: eventJSON,
+		}
+		if err := s.kafkaProducer.Produce(ctx, message); err != nil {
+			s.logger.Error("Failed to publish incident event", "incident_id", incident.ID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"scopeapi.local/backend/services/threat-detection/internal/models"
+	"scopeapi.local/backend/services/threat-detection/internal/repository"
+	"scopeapi.local/backend/shared/logging"
+	"scopeapi.local/backend/shared/messaging/kafka"
+)
+
+var correlationStart = time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+func newTestIncidentService() (*IncidentCorrelationService, *repository.MemoryThreatRepository) {
+	threatRepo := repository.NewMemoryThreatRepository()
+	return NewIncidentCorrelationService(repository.NewMemoryIncidentRepository(), threatRepo, nil, logging.NewStructuredLogger("test")), threatRepo
+}
+
+// testThreat builds a threat from an IP at some minutes past correlationStart,
+// with optional user_id, session_id and api_id attributes
+func testThreat(threatType, severity, ip string, minutes int, attributes ...string) models.Threat {
+	requestData := map[string]interface{}{}
+	threat := models.Threat{
+		ID:          fmt.Sprintf("%s-%s-%d", threatType, ip, minutes),
+		Type:        threatType,
+		Severity:    severity,
+		Status:      models.ThreatStatusNew,
+		IPAddress:   ip,
+		RequestData: requestData,
+		Timestamp:   correlationStart.Add(time.Duration(minutes) * time.Minute),
+	}
+	for i := 0; i+1 < len(attributes); i += 2 {
+		if attributes[i] == "api_id" {
+			threat.APIID = attributes[i+1]
+			continue
+		}
+		requestData[attributes[i]] = attributes[i+1]
+	}
+	return threat
+}
+
+func correlate(t *testing.T, service *IncidentCorrelationService, threats ...models.Threat) []models.Incident {
+	t.Helper()
+	incidents, err := service.CorrelateThreats(context.Background(), threats)
+	if err != nil {
+		t.Fatalf("CorrelateThreats: %v", err)
+	}
+	return incidents
+}
+
+func timelineTypes(incident models.Incident) []string {
+	var types []string
+	for _, event := range incident.Timeline {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestIncidentKillChainProgression(t *testing.T) {
+	service, _ := newTestIncidentService()
+	ip := "203.0.113.7"
+
+	correlate(t, service, testThreat("ml_anomaly", models.ThreatSeverityLow, ip, 0))
+	correlate(t, service, testThreat(models.ThreatTypeBruteForce, models.ThreatSeverityMedium, ip, 5))
+	incidents := correlate(t, service, testThreat("sql_injection", models.ThreatSeverityMedium, ip, 10))
+	if len(incidents) != 1 {
+		t.Fatalf("got %d incidents, want 1", len(incidents))
+	}
+	incident := incidents[0]
+	if incident.Stage != models.KillChainExploitation || fmt.Sprint(incident.Stages) != "[recon probing exploitation]" {
+		t.Errorf("stage %s, stages %v", incident.Stage, incident.Stages)
+	}
+	if incident.Severity != models.ThreatSeverityHigh {
+		t.Errorf("severity after exploitation = %s, want high", incident.Severity)
+	}
+
+	incidents = correlate(t, service, testThreat(models.ThreatTypeDataExfiltration, models.ThreatSeverityMedium, ip, 20))
+	incident = incidents[0]
+	if incident.Stage != models.KillChainExfiltration || incident.ThreatCount != 4 {
+		t.Errorf("stage %s with %d threats", incident.Stage, incident.ThreatCount)
+	}
+	if incident.Severity != models.ThreatSeverityCritical || incident.ThreatSeverity != models.ThreatSeverityMedium {
+		t.Errorf("severity %s from threat severity %s, want critical from medium", incident.Severity, incident.ThreatSeverity)
+	}
+	if incident.Title != "Data exfiltration from "+ip {
+		t.Errorf("title = %q", incident.Title)
+	}
+	want := "[created stage_advanced severity_escalated stage_advanced severity_escalated stage_advanced severity_escalated]"
+	if got := fmt.Sprint(timelineTypes(incident)); got != want {
+		t.Errorf("timeline = %s, want %s", got, want)
+	}
+
+	// A lone large response is not escalated
+	incidents = correlate(t, service, testThreat(models.ThreatTypeDataExfiltration, models.ThreatSeverityMedium, "198.51.100.1", 0))
+	if incidents[0].Severity != models.ThreatSeverityMedium {
+		t.Errorf("lone exfiltration severity = %s", incidents[0].Severity)
+	}
+}
+
+func TestIncidentEscalationFollowsStageOrder(t *testing.T) {
+	service, _ := newTestIncidentService()
+	ip := "203.0.113.7"
+
+	// Reconnaissance after the exploitation attempt does not escalate it
+	correlate(t, service, testThreat("sql_injection", models.ThreatSeverityMedium, ip, 10))
+	incident := correlate(t, service, testThreat("ml_anomaly", models.ThreatSeverityLow, ip, 15))[0]
+	if incident.Severity != models.ThreatSeverityMedium {
+		t.Errorf("severity with recon after exploitation = %s, want medium", incident.Severity)
+	}
+
+	// Probing reported late but seen before the exploitation attempt does
+	incident = correlate(t, service, testThreat(models.ThreatTypeBruteForce, models.ThreatSeverityMedium, ip, 5))[0]
+	if incident.Severity != models.ThreatSeverityHigh {
+		t.Errorf("severity with earlier probing = %s, want high", incident.Severity)
+	}
+	if !incident.StageFirstSeen[models.KillChainProbing].Equal(correlationStart.Add(5 * time.Minute)) {
+		t.Errorf("stage first seen = %v", incident.StageFirstSeen)
+	}
+}
+
+func TestIncidentCorrelationKeysAndWindow(t *testing.T) {
+	service, _ := newTestIncidentService()
+
+	first := correlate(t, service, testThreat("xss", models.ThreatSeverityHigh, "203.0.113.7", 0, "session_id", "s1"))[0]
+	// Same session from a new address
+	sameSession := correlate(t, service, testThreat("xss", models.ThreatSeverityHigh, "203.0.113.8", 10, "session_id", "s1"))[0]
+	// Another actor entirely
+	other := correlate(t, service, testThreat("xss", models.ThreatSeverityHigh, "198.51.100.1", 10))[0]
+	// The first address again, after the window has passed since its last threat
+	later := correlate(t, service, testThreat("xss", models.ThreatSeverityHigh, "203.0.113.7", 45))[0]
+
+	if sameSession.ID != first.ID || fmt.Sprint(sameSession.SourceIPs) != "[203.0.113.7 203.0.113.8]" {
+		t.Errorf("same session opened %s with source IPs %v", sameSession.ID, sameSession.SourceIPs)
+	}
+	if other.ID == first.ID {
+		t.Errorf("unrelated actor joined the incident")
+	}
+	if later.ID == first.ID {
+		t.Errorf("threat after the window joined the incident")
+	}
+
+	// Threats without an address, user or session are not correlated
+	if incidents := correlate(t, service, testThreat("xss", models.ThreatSeverityHigh, "", 50)); len(incidents) != 0 {
+		t.Errorf("threat without attributes opened %d incidents", len(incidents))
+	}
+}
+
+func TestIncidentEscalationThreshold(t *testing.T) {
+	service, _ := newTestIncidentService()
+	policy := DefaultCorrelationPolicy
+	policy.EscalationThreshold = 3
+	if err := service.SetCorrelationPolicy(context.Background(), policy); err != nil {
+		t.Fatal(err)
+	}
+
+	var incident models.Incident
+	for i := 0; i < 3; i++ {
+		incident = correlate(t, service, testThreat("path_traversal", models.ThreatSeverityMedium, "203.0.113.7", i))[0]
+	}
+	if incident.Severity != models.ThreatSeverityHigh || incident.ThreatTypes["path_traversal"] != 3 {
+		t.Errorf("severity %s with threat types %v", incident.Severity, incident.ThreatTypes)
+	}
+}
+
+func TestIncidentMerge(t *testing.T) {
+	service, _ := newTestIncidentService()
+	ctx := context.Background()
+
+	byIP := correlate(t, service, testThreat("ml_pattern", models.ThreatSeverityLow, "203.0.113.7", 0))[0]
+	byUser := correlate(t, service, testThreat(models.ThreatTypeBruteForce, models.ThreatSeverityHigh, "198.51.100.1", 1, "user_id", "alice"))[0]
+	if byIP.ID == byUser.ID {
+		t.Fatal("separate actors share an incident")
+	}
+
+	// Alice signs in from the first address, linking both incidents
+	merged := correlate(t, service, testThreat("sql_injection", models.ThreatSeverityHigh, "203.0.113.7", 2, "user_id", "alice"))
+	if len(merged) != 1 || merged[0].ID != byIP.ID {
+		t.Fatalf("merged into %+v, want the older incident %s", merged, byIP.ID)
+	}
+	if merged[0].ThreatCount != 3 || fmt.Sprint(merged[0].Stages) != "[recon probing exploitation]" {
+		t.Errorf("merged incident has %d threats and stages %v", merged[0].ThreatCount, merged[0].Stages)
+	}
+	if merged[0].Severity != models.ThreatSeverityCritical {
+		t.Errorf("merged severity = %s", merged[0].Severity)
+	}
+
+	absorbed, err := service.GetIncident(ctx, byUser.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if absorbed.Status != models.IncidentStatusMerged || absorbed.MergedInto != byIP.ID {
+		t.Errorf("absorbed incident status %s, merged into %q", absorbed.Status, absorbed.MergedInto)
+	}
+	active, _ := service.GetIncidents(ctx, &models.IncidentFilter{Active: true})
+	if len(active) != 1 {
+		t.Errorf("%d active incidents after merge, want 1", len(active))
+	}
+}
+
+func TestIncidentGroupByAPI(t *testing.T) {
+	service, _ := newTestIncidentService()
+	policy := DefaultCorrelationPolicy
+	policy.GroupBy = []string{models.CorrelateBySourceIP, models.CorrelateByAPIID}
+	if err := service.SetCorrelationPolicy(context.Background(), policy); err != nil {
+		t.Fatal(err)
+	}
+
+	orders := correlate(t, service, testThreat("xss", models.ThreatSeverityHigh, "203.0.113.7", 0, "api_id", "orders"))[0]
+	users := correlate(t, service, testThreat("xss", models.ThreatSeverityHigh, "203.0.113.7", 1, "api_id", "users"))[0]
+	again := correlate(t, service, testThreat("xss", models.ThreatSeverityHigh, "203.0.113.7", 2, "api_id", "orders"))[0]
+	if orders.ID == users.ID || again.ID != orders.ID {
+		t.Errorf("incidents per API: orders %s, users %s, orders again %s", orders.ID, users.ID, again.ID)
+	}
+	if fmt.Sprint(orders.CorrelationKeys) != "[api:orders/ip:203.0.113.7]" {
+		t.Errorf("correlation keys = %v", orders.CorrelationKeys)
+	}
+
+	policy.GroupBy = []string{"country"}
+	if err := service.SetCorrelationPolicy(context.Background(), policy); !errors.Is(err, ErrInvalidCorrelationPolicy) {
+		t.Errorf("SetCorrelationPolicy(country) = %v", err)
+	}
+}
+
+func TestIncidentLifecycle(t *testing.T) {
+	service, threatRepo := newTestIncidentService()
+	ctx := context.Background()
+
+	threat := testThreat("command_injection", models.ThreatSeverityHigh, "203.0.113.7", 0)
+	threatRepo.CreateThreat(ctx, &threat)
+	incident := correlate(t, service, threat)[0]
+
+	if _, err := service.UpdateIncidentStatus(ctx, incident.ID, &models.IncidentUpdateRequest{Status: models.IncidentStatusClosed}); !errors.Is(err, ErrInvalidIncidentTransition) {
+		t.Errorf("open to closed = %v", err)
+	}
+	if _, err := service.UpdateIncidentStatus(ctx, "missing", &models.IncidentUpdateRequest{Status: models.IncidentStatusInvestigating}); !errors.Is(err, ErrIncidentNotFound) {
+		t.Errorf("missing incident = %v", err)
+	}
+
+	updated, err := service.UpdateIncidentStatus(ctx, incident.ID, &models.IncidentUpdateRequest{Status: models.IncidentStatusInvestigating, Assignee: "sam", Actor: "lee"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Assignee != "sam" || fmt.Sprint(timelineTypes(*updated)) != "[created status_changed assigned]" {
+		t.Errorf("assignee %q, timeline %v", updated.Assignee, timelineTypes(*updated))
+	}
+
+	updated, err = service.UpdateIncidentStatus(ctx, incident.ID, &models.IncidentUpdateRequest{Status: models.IncidentStatusFalsePositive, Note: "pentest traffic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ResolvedAt == nil {
+		t.Error("false positive incident has no resolved time")
+	}
+	if stored, _ := threatRepo.GetThreat(ctx, threat.ID); stored.Status != models.ThreatStatusFalsePos {
+		t.Errorf("threat status = %s, want false_positive", stored.Status)
+	}
+
+	// New threats from the same address open a new incident
+	next := correlate(t, service, testThreat("command_injection", models.ThreatSeverityHigh, "203.0.113.7", 1))[0]
+	if next.ID == incident.ID {
+		t.Error("threat added to an incident marked false positive")
+	}
+
+	threats, err := service.GetIncidentThreats(ctx, incident.ID)
+	if err != nil || len(threats) != 1 || threats[0].ID != threat.ID {
+		t.Errorf("GetIncidentThreats = %v, %v", threats, err)
+	}
+}
+
+type recordingProducer struct {
+	messages []kafka.Message
+}
+
+func (p *recordingProducer) Produce(ctx context.Context, message kafka.Message) error {
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+func (p *recordingProducer) Close() error { return nil }
+
+func TestAnalyzeTrafficCorrelatesThreats(t *testing.T) {
+	producer := &recordingProducer{}
+	threatRepo := repository.NewMemoryThreatRepository()
+	logger := logging.NewStructuredLogger("test")
+	correlator := NewIncidentCorrelationService(repository.NewMemoryIncidentRepository(), threatRepo, producer, logger)
+	service := NewThreatDetectionService(threatRepo, producer, logger)
+	service.SetIncidentCorrelator(correlator)
+
+	traffic, _ := json.Marshal(map[string]interface{}{"request": map[string]interface{}{
+		"ip_address": "203.0.113.7",
+		"parameters": map[string]interface{}{"id": "1 union select password from users"},
+	}})
+	var incidentIDs []string
+	for i := 0; i < 2; i++ {
+		result, err := service.AnalyzeTraffic(context.Background(), traffic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids, _ := result.Metadata["incident_ids"].([]string)
+		incidentIDs = append(incidentIDs, ids...)
+	}
+	if len(incidentIDs) != 2 || incidentIDs[0] != incidentIDs[1] {
+		t.Fatalf("incident IDs = %v, want one incident for both requests", incidentIDs)
+	}
+
+	incident, err := correlator.GetIncident(context.Background(), incidentIDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	threats, _ := correlator.GetIncidentThreats(context.Background(), incident.ID)
+	if len(threats) != incident.ThreatCount || incident.ThreatCount < 2 {
+		t.Errorf("incident holds %d threats, %d stored", incident.ThreatCount, len(threats))
+	}
+
+	published := 0
+	for _, message := range producer.messages {
+		if message.Topic == "incident_events" {
+			published++
+		}
+	}
+	if published == 0 {
+		t.Error("no incident events published")
+	}
+}
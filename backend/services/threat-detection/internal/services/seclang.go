@@ -0,0 +1,718 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"scopeapi.local/backend/services/threat-detection/internal/models"
+)
+
+// ErrInvalidParanoiaLevel is returned for paranoia levels outside 1 to 4
+var ErrInvalidParanoiaLevel = errors.New("paranoia level must be between 1 and 4")
+
+// secLangRule is a SecRule or SecAction directive; chained rules hold their
+// further links
+type secLangRule struct {
+	file      string
+	line      int
+	variables string
+	operator  string
+	actions   []secLangAction
+	chain     []*secLangRule
+}
+
+type secLangAction struct {
+	name  string
+	value string
+}
+
+// crsTranslation is the outcome of translating a set of SecLang files
+type crsTranslation struct {
+	signatures []models.ThreatSignature
+	// tx variables assigned by setvar, by lowercased name without the "tx." prefix
+	tx       map[string]string
+	ignored  int
+	skipped  []models.CRSSkippedRule
+	warnings []string
+}
+
+// secLangCollections maps SecLang collections to target field prefixes
+var secLangCollections = map[string]struct {
+	prefix string
+	names  bool
+}{
+	"ARGS":                   {"param_", false},
+	"ARGS_GET":               {"param_", false},
+	"ARGS_POST":              {"param_", false},
+	"ARGS_NAMES":             {"param_", true},
+	"ARGS_GET_NAMES":         {"param_", true},
+	"ARGS_POST_NAMES":        {"param_", true},
+	"REQUEST_HEADERS":        {"header_", false},
+	"REQUEST_HEADERS_NAMES":  {"header_", true},
+	"REQUEST_COOKIES":        {"cookie_", false},
+	"REQUEST_COOKIES_NAMES":  {"cookie_", true},
+	"RESPONSE_HEADERS":       {"response_header_", false},
+	"RESPONSE_HEADERS_NAMES": {"response_header_", true},
+}
+
+// secLangFields maps SecLang variables to single target fields
+var secLangFields = map[string]string{
+	"REQUEST_BODY":     "body",
+	"XML":              "body",
+	"REQUEST_URI":      "uri",
+	"REQUEST_URI_RAW":  "uri",
+	"REQUEST_FILENAME": "path",
+	"REQUEST_BASENAME": "basename",
+	"QUERY_STRING":     "query",
+	"REQUEST_METHOD":   "method",
+	"REQUEST_LINE":     "request_line",
+	"REQUEST_PROTOCOL": "protocol",
+	"REMOTE_ADDR":      "ip",
+	"RESPONSE_BODY":    "response_body",
+	"RESPONSE_STATUS":  "response_status",
+}
+
+// secLangOperators maps SecLang operators to signature rule operators
+var secLangOperators = map[string]string{
+	"rx":                   "regex",
+	"pm":                   "pm",
+	"pmfromfile":           "pm",
+	"pmf":                  "pm",
+	"contains":             "contains",
+	"streq":                "equals",
+	"beginswith":           "starts_with",
+	"endswith":             "ends_with",
+	"gt":                   "ge",
+	"lt":                   "le",
+	"eq":                   "eq",
+	"ge":                   "ge",
+	"le":                   "le",
+	"within":               "within",
+	"ipmatch":              "ip_match",
+	"detectsqli":           "detect_sqli",
+	"detectxss":            "detect_xss",
+	"validatebyterange":    "byte_range",
+	"validateurlencoding":  "invalid_url_encoding",
+	"validateutf8encoding": "invalid_utf8",
+	"unconditionalmatch":   "unconditional",
+}
+
+var (
+	secLangMacro         = regexp.MustCompile(`%\{([^}]+)\}`)
+	secLangParanoiaGate  = regexp.MustCompile(`(?i)^TX:(DETECTION_|EXECUTING_)?PARANOIA_LEVEL$`)
+	secLangParanoiaTag   = regexp.MustCompile(`(?i)^paranoia-level/(\d)$`)
+	secLangParanoiaRange = regexp.MustCompile(`^\s*@lt\s+(\d)\s*$`)
+)
+
+// crsSeverities maps SecLang severities to signature severities and risk scores
+var crsSeverities = map[string]struct {
+	severity  string
+	riskScore float64
+}{
+	"EMERGENCY": {"critical", 9.0}, "ALERT": {"critical", 9.0}, "CRITICAL": {"critical", 9.0},
+	"0": {"critical", 9.0}, "1": {"critical", 9.0}, "2": {"critical", 9.0},
+	"ERROR": {"high", 7.5}, "3": {"high", 7.5},
+	"WARNING": {"medium", 5.0}, "4": {"medium", 5.0},
+	"NOTICE": {"low", 3.0}, "5": {"low", 3.0},
+}
+
+// crsSeverityScores are the anomaly scores of rules that set none themselves,
+// the CRS defaults by severity
+var crsSeverityScores = map[string]int{"critical": 5, "high": 4, "medium": 3, "low": 2}
+
+// crsCategories maps CRS attack tags to threat categories where they differ
+var crsCategories = map[string]string{
+	"attack-sqli": "sql_injection",
+	"attack-xss":  "xss",
+	"attack-rce":  "command_injection",
+	"attack-lfi":  "path_traversal",
+	"attack-rfi":  "remote_file_inclusion",
+}
+
+// parseSecLang splits a SecLang file into its rules and rule removals.
+// Directives other than SecRule, SecAction and SecRuleRemoveById are ignored.
+func parseSecLang(file string, data []byte) ([]*secLangRule, []string, error) {
+	var rules []*secLangRule
+	var removals []string
+	var head *secLangRule
+
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		start := i + 1
+		directive := strings.TrimSpace(lines[i])
+		for strings.HasSuffix(directive, `\`) && i+1 < len(lines) {
+			i++
+			directive = strings.TrimSuffix(directive, `\`) + " " + strings.TrimSpace(lines[i])
+		}
+		if directive == "" || strings.HasPrefix(directive, "#") {
+			continue
+		}
+
+		args, err := secLangArguments(directive)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: %w", file, start, err)
+		}
+
+		rule := &secLangRule{file: file, line: start}
+		switch strings.ToLower(args[0]) {
+		case "secrule":
+			if len(args) < 3 {
+				return nil, nil, fmt.Errorf("%s:%d: SecRule needs variables and an operator", file, start)
+			}
+			rule.variables, rule.operator = args[1], args[2]
+			if len(args) > 3 {
+				rule.actions = secLangActions(args[3])
+			}
+		case "secaction":
+			if len(args) > 1 {
+				rule.actions = secLangActions(args[1])
+			}
+		case "secruleremovebyid":
+			removals = append(removals, args[1:]...)
+			continue
+		default:
+			continue
+		}
+
+		if head != nil {
+			head.chain = append(head.chain, rule)
+		} else {
+			rules = append(rules, rule)
+			head = rule
+		}
+		if !rule.hasAction("chain") {
+			head = nil
+		}
+	}
+	return rules, removals, nil
+}
+
+// secLangArguments splits a directive into its arguments; double-quoted
+// arguments may contain spaces and escaped quotes
+func secLangArguments(directive string) ([]string, error) {
+	var args []string
+	for i := 0; i < len(directive); {
+		if directive[i] == ' ' || directive[i] == '\t' {
+			i++
+			continue
+		}
+		if directive[i] != '"' {
+			end := strings.IndexAny(directive[i:], " \t")
+			if end < 0 {
+				end = len(directive) - i
+			}
+			args = append(args, directive[i:i+end])
+			i += end
+			continue
+		}
+
+		var arg strings.Builder
+		i++
+		for ; i < len(directive) && directive[i] != '"'; i++ {
+			if directive[i] == '\\' && i+1 < len(directive) && directive[i+1] == '"' {
+				i++
+			}
+			arg.WriteByte(directive[i])
+		}
+		if i >= len(directive) {
+			return nil, fmt.Errorf("unterminated quoted argument")
+		}
+		args = append(args, arg.String())
+		i++
+	}
+	return args, nil
+}
+
+// secLangActions splits an action list on the commas outside single quotes
+func secLangActions(list string) []secLangAction {
+	var actions []secLangAction
+	var current strings.Builder
+	quoted := false
+	flush := func() {
+		action := strings.TrimSpace(current.String())
+		current.Reset()
+		if action == "" {
+			return
+		}
+		name, value, _ := strings.Cut(action, ":")
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		actions = append(actions, secLangAction{name: strings.ToLower(strings.TrimSpace(name)), value: value})
+	}
+	for i := 0; i < len(list); i++ {
+		switch {
+		case list[i] == '\\' && i+1 < len(list) && list[i+1] == '\'':
+			current.WriteByte('\'')
+			i++
+		case list[i] == '\'':
+			quoted = !quoted
+			current.WriteByte('\'')
+		case list[i] == ',' && !quoted:
+			flush()
+		default:
+			current.WriteByte(list[i])
+		}
+	}
+	flush()
+	return actions
+}
+
+func (r *secLangRule) hasAction(name string) bool {
+	for _, action := range r.actions {
+		if action.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *secLangRule) actionValue(name string) string {
+	values := r.actionValues(name)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+func (r *secLangRule) actionValues(name string) []string {
+	var values []string
+	for _, action := range r.actions {
+		if action.name == name && action.value != "" {
+			values = append(values, action.value)
+		}
+	}
+	return values
+}
+
+// links returns the rule followed by its chained rules
+func (r *secLangRule) links() []*secLangRule {
+	return append([]*secLangRule{r}, r.chain...)
+}
+
+// translateCRSRules translates SecLang rule files into signatures. Setup files
+// ("*setup*") are read first, then the rest by name; ".data" files are only
+// read by @pmFromFile.
+func translateCRSRules(files map[string][]byte) (*crsTranslation, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if strings.HasSuffix(strings.ToLower(name), ".conf") {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		setupI := strings.Contains(strings.ToLower(names[i]), "setup")
+		setupJ := strings.Contains(strings.ToLower(names[j]), "setup")
+		if setupI != setupJ {
+			return setupI
+		}
+		return names[i] < names[j]
+	})
+
+	translation := &crsTranslation{
+		tx: map[string]string{
+			"critical_anomaly_score": "5",
+			"error_anomaly_score":    "4",
+			"warning_anomaly_score":  "3",
+			"notice_anomaly_score":   "2",
+		},
+	}
+
+	parsed := make(map[string][]*secLangRule)
+	var removals []string
+	defined := make(map[string]bool)
+	for _, name := range names {
+		rules, removed, err := parseSecLang(name, files[name])
+		if err != nil {
+			return nil, err
+		}
+		parsed[name] = rules
+		removals = append(removals, removed...)
+
+		// The first assignment of a tx variable is its configured value
+		for _, rule := range rules {
+			for _, link := range rule.links() {
+				for _, setvar := range link.actionValues("setvar") {
+					variable, value, found := strings.Cut(setvar, "=")
+					variable = strings.ToLower(strings.TrimSpace(variable))
+					if !found || !strings.HasPrefix(variable, "tx.") || strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-") {
+						continue
+					}
+					variable = strings.TrimPrefix(variable, "tx.")
+					if !defined[variable] {
+						defined[variable] = true
+						translation.tx[variable] = value
+					}
+				}
+			}
+		}
+	}
+
+	for _, name := range names {
+		paranoiaLevel := 1
+		for _, rule := range parsed[name] {
+			id := rule.actionValue("id")
+			if secLangParanoiaGate.MatchString(rule.variables) {
+				if level := secLangParanoiaRange.FindStringSubmatch(rule.operator); level != nil {
+					paranoiaLevel, _ = strconv.Atoi(level[1])
+				}
+				translation.ignored++
+				continue
+			}
+			if !isCRSDetectionRule(rule) || secLangRemoved(removals, id) {
+				translation.ignored++
+				continue
+			}
+
+			signature, reason := translation.translateRule(rule, paranoiaLevel, files)
+			if reason != "" {
+				translation.skipped = append(translation.skipped, models.CRSSkippedRule{
+					RuleID: id,
+					File:   rule.file,
+					Line:   rule.line,
+					Reason: reason,
+				})
+				continue
+			}
+			translation.signatures = append(translation.signatures, *signature)
+		}
+	}
+	return translation, nil
+}
+
+// isCRSDetectionRule reports whether a rule detects attacks, rather than
+// initialising variables or evaluating the anomaly score
+func isCRSDetectionRule(rule *secLangRule) bool {
+	if rule.operator == "" {
+		return false
+	}
+	for _, link := range rule.links() {
+		if link.actionValue("severity") != "" || crsAnomalySetvar(link) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// crsAnomalySetvar returns the increment a rule adds to the inbound or
+// outbound anomaly score
+func crsAnomalySetvar(rule *secLangRule) string {
+	for _, setvar := range rule.actionValues("setvar") {
+		variable, value, found := strings.Cut(setvar, "=+")
+		if found && strings.Contains(strings.ToLower(variable), "anomaly_score") {
+			return value
+		}
+	}
+	return ""
+}
+
+func secLangRemoved(removals []string, id string) bool {
+	ruleID, err := strconv.Atoi(id)
+	if err != nil {
+		return false
+	}
+	for _, removal := range removals {
+		low, high, isRange := strings.Cut(removal, "-")
+		from, err := strconv.Atoi(low)
+		if err != nil {
+			continue
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(high); err != nil {
+				continue
+			}
+		}
+		if ruleID >= from && ruleID <= to {
+			return true
+		}
+	}
+	return false
+}
+
+// translateRule translates a detection rule and its chain into one signature,
+// or returns why it cannot be
+func (t *crsTranslation) translateRule(rule *secLangRule, paranoiaLevel int, files map[string][]byte) (*models.ThreatSignature, string) {
+	id := rule.actionValue("id")
+	if id == "" {
+		return nil, "rule has no id"
+	}
+
+	tags := rule.actionValues("tag")
+	for _, tag := range tags {
+		if level := secLangParanoiaTag.FindStringSubmatch(tag); level != nil {
+			paranoiaLevel, _ = strconv.Atoi(level[1])
+		}
+	}
+
+	severityName := strings.ToUpper(rule.actionValue("severity"))
+	anomalyScore := 0
+	for _, link := range rule.links() {
+		if increment := crsAnomalySetvar(link); increment != "" {
+			resolved, ok := t.resolveMacros(increment)
+			if score, err := strconv.Atoi(strings.TrimSpace(resolved)); ok && err == nil {
+				anomalyScore = score
+			}
+		}
+	}
+	severity, ok := crsSeverities[severityName]
+	if !ok {
+		severity = crsSeverities["CRITICAL"]
+		// Anomaly scores 4, 3 and 2 are the CRS defaults for severities 3, 4 and 5
+		if anomalyScore >= 2 && anomalyScore < 5 {
+			severity = crsSeverities[strconv.Itoa(7-anomalyScore)]
+		}
+	}
+	if anomalyScore == 0 {
+		anomalyScore = crsSeverityScores[severity.severity]
+	}
+
+	msg := rule.actionValue("msg")
+	name := "CRS " + id
+	if msg != "" {
+		name += ": " + msg
+	}
+
+	signature := &models.ThreatSignature{
+		Name:          name,
+		Description:   msg,
+		Pattern:       rule.operator,
+		Severity:      severity.severity,
+		Type:          models.SignatureTypeCommunity,
+		Category:      crsCategory(tags),
+		RiskScore:     severity.riskScore,
+		Confidence:    crsConfidence(paranoiaLevel),
+		Tags:          tags,
+		ExternalID:    id,
+		MatchAll:      len(rule.chain) > 0,
+		ParanoiaLevel: paranoiaLevel,
+		AnomalyScore:  anomalyScore,
+	}
+
+	var previous *models.SignatureRule
+	for i, link := range rule.links() {
+		signatureRule, reason := t.translateLink(link, previous, files)
+		if reason != "" {
+			if i > 0 {
+				reason = fmt.Sprintf("chained rule at line %d: %s", link.line, reason)
+			}
+			return nil, reason
+		}
+		signatureRule.ID = id
+		if i > 0 {
+			signatureRule.ID = fmt.Sprintf("%s-%d", id, i+1)
+		}
+		signatureRule.Name = msg
+		signatureRule.Severity = severity.severity
+		signatureRule.Description = msg
+		signature.Rules = append(signature.Rules, *signatureRule)
+		previous = signatureRule
+	}
+	return signature, ""
+}
+
+// translateLink translates the variables, operator and transformations of one
+// link of a rule. MATCHED_VAR and MATCHED_VARS in a chained rule inspect the
+// fields of the previous link.
+func (t *crsTranslation) translateLink(link *secLangRule, previous *models.SignatureRule, files map[string][]byte) (*models.SignatureRule, string) {
+	rule := &models.SignatureRule{Pattern: link.operator, Weight: 1.0}
+
+	var selectors []string
+	for _, variable := range strings.Split(link.variables, "|") {
+		variable = strings.TrimSpace(variable)
+		exclusion := strings.HasPrefix(variable, "!")
+		variable = strings.TrimPrefix(variable, "!")
+		collection, key, _ := strings.Cut(variable, ":")
+		collection = strings.ToUpper(collection)
+
+		if previous != nil && (collection == "MATCHED_VAR" || collection == "MATCHED_VARS") {
+			selectors = append(selectors, append([]string{previous.Field}, previous.Targets...)...)
+			rule.Exclusions = append(rule.Exclusions, previous.Exclusions...)
+			continue
+		}
+
+		selector, ok := secLangSelector(collection, key)
+		if !ok || strings.HasPrefix(collection, "&") {
+			if !exclusion {
+				t.warnings = append(t.warnings, fmt.Sprintf("%s:%d: variable %s is not supported and was dropped", link.file, link.line, variable))
+			}
+			continue
+		}
+		if exclusion {
+			rule.Exclusions = append(rule.Exclusions, selector)
+		} else {
+			selectors = append(selectors, selector)
+		}
+	}
+	if len(selectors) == 0 {
+		return nil, fmt.Sprintf("no supported variables in %s", link.variables)
+	}
+	rule.Field, rule.Targets = selectors[0], selectors[1:]
+
+	operator := strings.TrimSpace(link.operator)
+	if strings.HasPrefix(operator, "!") {
+		rule.Negate = true
+		operator = strings.TrimPrefix(operator, "!")
+	}
+	name, argument := "rx", operator
+	if strings.HasPrefix(operator, "@") {
+		name, argument, _ = strings.Cut(operator[1:], " ")
+		argument = strings.TrimSpace(argument)
+	}
+	name = strings.ToLower(name)
+
+	var ok bool
+	if rule.Operator, ok = secLangOperators[name]; !ok {
+		return nil, fmt.Sprintf("operator @%s is not supported", name)
+	}
+	if argument, ok = t.resolveMacros(argument); !ok {
+		return nil, fmt.Sprintf("unresolved macro in %s", link.operator)
+	}
+
+	switch name {
+	case "rx":
+		if _, err := regexp.Compile(argument); err != nil {
+			return nil, fmt.Sprintf("regular expression is not supported: %v", err)
+		}
+	case "pmfromfile", "pmf":
+		var phrases []string
+		for _, file := range strings.Fields(argument) {
+			data, found := secLangDataFile(files, file)
+			if !found {
+				return nil, fmt.Sprintf("data file %s was not uploaded", file)
+			}
+			for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+				if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+					phrases = append(phrases, line)
+				}
+			}
+		}
+		argument = strings.Join(phrases, "\n") + "\n"
+	case "gt", "lt", "eq", "ge", "le":
+		bound, err := strconv.Atoi(argument)
+		if err != nil {
+			return nil, fmt.Sprintf("operator @%s needs a number, not %q", name, argument)
+		}
+		// Integer comparisons: @gt N is @ge N+1 and @lt N is @le N-1
+		if name == "gt" {
+			bound++
+		} else if name == "lt" {
+			bound--
+		}
+		argument = strconv.Itoa(bound)
+		rule.IntValue = bound
+	}
+	rule.Value = argument
+
+	for _, action := range link.actions {
+		switch action.name {
+		case "t":
+			if strings.EqualFold(action.value, "none") {
+				rule.Transforms = nil
+				continue
+			}
+			if _, ok := signatureTransforms[strings.ToLower(action.value)]; !ok {
+				return nil, fmt.Sprintf("transformation %s is not supported", action.value)
+			}
+			rule.Transforms = append(rule.Transforms, action.value)
+		case "multimatch":
+			rule.MultiMatch = true
+		}
+	}
+	return rule, ""
+}
+
+// secLangSelector translates a SecLang variable to a target field selector
+func secLangSelector(collection, key string) (string, bool) {
+	if field, ok := secLangFields[collection]; ok {
+		return field, true
+	}
+	target, ok := secLangCollections[collection]
+	if !ok {
+		return "", false
+	}
+
+	key = strings.Trim(key, "'")
+	selector := target.prefix + "*"
+	switch {
+	case len(key) > 1 && strings.HasPrefix(key, "/") && strings.HasSuffix(key, "/"):
+		selector = target.prefix + key
+	case key != "" && target.prefix == "param_":
+		selector = target.prefix + key
+	case key != "":
+		selector = target.prefix + strings.ToLower(key)
+	}
+	if target.names {
+		selector = "names:" + selector
+	}
+	return selector, true
+}
+
+func secLangDataFile(files map[string][]byte, name string) ([]byte, bool) {
+	for file, data := range files {
+		if path.Base(file) == path.Base(name) {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// resolveMacros expands %{tx.name} macros; other macros cannot be resolved
+func (t *crsTranslation) resolveMacros(value string) (string, bool) {
+	resolved := true
+	expanded := secLangMacro.ReplaceAllStringFunc(value, func(macro string) string {
+		name := strings.ToLower(secLangMacro.FindStringSubmatch(macro)[1])
+		if strings.HasPrefix(name, "tx.") {
+			if value, ok := t.tx[strings.TrimPrefix(name, "tx.")]; ok {
+				return value
+			}
+		}
+		resolved = false
+		return macro
+	})
+	return expanded, resolved
+}
+
+// txInt returns the first of the named tx variables that holds a number
+func (t *crsTranslation) txInt(names ...string) int {
+	for _, name := range names {
+		if value, err := strconv.Atoi(strings.TrimSpace(t.tx[name])); err == nil && value > 0 {
+			return value
+		}
+	}
+	return 0
+}
+
+func crsCategory(tags []string) string {
+	for _, tag := range tags {
+		tag = strings.ToLower(tag)
+		if category, ok := crsCategories[tag]; ok {
+			return category
+		}
+		if strings.HasPrefix(tag, "attack-") {
+			return strings.ReplaceAll(strings.TrimPrefix(tag, "attack-"), "-", "_")
+		}
+	}
+	return "crs"
+}
+
+// crsConfidence lowers confidence as paranoia levels trade false positives
+// for coverage
+func crsConfidence(paranoiaLevel int) float64 {
+	switch {
+	case paranoiaLevel <= 1:
+		return 0.9
+	case paranoiaLevel == 2:
+		return 0.8
+	case paranoiaLevel == 3:
+		return 0.7
+	default:
+		return 0.6
+	}
+}
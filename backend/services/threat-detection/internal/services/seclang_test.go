@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"scopeapi.local/backend/services/threat-detection/internal/models"
+	"scopeapi.local/backend/services/threat-detection/internal/repository"
+	"scopeapi.local/backend/shared/logging"
+)
+
+// crsExcerpt is a cut-down Core Rule Set: setup, initialisation, SQL injection
+// rules at two paranoia levels, a data leakage rule reading a phrase file and
+// the blocking evaluation
+var crsExcerpt = map[string][]byte{
+	"crs-setup.conf": []byte(`
+# Blocking paranoia level and threshold
+SecAction \
+    "id:900000,\
+    phase:1,\
+    pass,\
+    t:none,\
+    nolog,\
+    setvar:tx.blocking_paranoia_level=1"
+SecAction "id:900110,phase:1,pass,t:none,nolog,setvar:tx.inbound_anomaly_score_threshold=5"
+`),
+	"REQUEST-901-INITIALIZATION.conf": []byte(`
+SecRule &TX:blocking_paranoia_level "@eq 0" "id:901120,phase:1,pass,nolog,setvar:'tx.blocking_paranoia_level=4'"
+`),
+	"REQUEST-942-APPLICATION-ATTACK-SQLI.conf": []byte(`
+SecRule TX:DETECTION_PARANOIA_LEVEL "@lt 1" "id:942011,phase:1,pass,nolog,skipAfter:END-REQUEST-942-APPLICATION-ATTACK-SQLI"
+SecRule TX:DETECTION_PARANOIA_LEVEL "@lt 1" "id:942012,phase:2,pass,nolog,skipAfter:END-REQUEST-942-APPLICATION-ATTACK-SQLI"
+
+SecRule REQUEST_COOKIES|!REQUEST_COOKIES:/__utm/|REQUEST_COOKIES_NAMES|ARGS_NAMES|ARGS|XML:/* "@rx (?i)\bunion\b[\s\S]*?\bselect\b" \
+    "id:942100,\
+    phase:2,\
+    block,\
+    capture,\
+    t:none,t:urlDecodeUni,t:lowercase,\
+    msg:'SQL Injection Attack: UNION SELECT',\
+    tag:'application-multi',\
+    tag:'attack-sqli',\
+    tag:'paranoia-level/1',\
+    severity:'CRITICAL',\
+    setvar:'tx.sql_injection_score=+%{tx.critical_anomaly_score}',\
+    setvar:'tx.inbound_anomaly_score_pl1=+%{tx.critical_anomaly_score}'"
+
+SecRule ARGS "@rx (\w+)=\1" \
+    "id:942130,phase:2,block,t:none,msg:'SQL Injection Attack: SQL Tautology',tag:'attack-sqli',severity:'CRITICAL',\
+    setvar:'tx.inbound_anomaly_score_pl1=+%{tx.critical_anomaly_score}'"
+
+SecRule ARGS "@verifyCC \d{13,16}" "id:942998,phase:2,block,msg:'Card number',severity:'NOTICE',setvar:'tx.inbound_anomaly_score_pl1=+%{tx.notice_anomaly_score}'"
+
+SecRule REQUEST_METHOD "@streq POST" \
+    "id:942999,phase:2,block,msg:'Comment in POST arguments',tag:'attack-sqli',severity:'WARNING',chain"
+    SecRule ARGS "@contains /*" "t:none,setvar:'tx.inbound_anomaly_score_pl1=+%{tx.warning_anomaly_score}'"
+
+SecRule TX:DETECTION_PARANOIA_LEVEL "@lt 2" "id:942013,phase:1,pass,nolog,skipAfter:END-REQUEST-942-APPLICATION-ATTACK-SQLI"
+
+SecRule ARGS "@rx --\s*$" \
+    "id:942200,phase:2,block,t:none,t:urlDecodeUni,msg:'SQL comment sequence',tag:'attack-sqli',severity:'WARNING',\
+    setvar:'tx.inbound_anomaly_score_pl2=+%{tx.warning_anomaly_score}'"
+`),
+	"RESPONSE-951-DATA-LEAKAGES-SQL.conf": []byte(`
+SecRule RESPONSE_BODY "@pmFromFile sql-errors.data" \
+    "id:951100,phase:4,block,msg:'SQL Error Leakage',tag:'attack-disclosure',severity:'ERROR',\
+    setvar:'tx.outbound_anomaly_score_pl1=+%{tx.error_anomaly_score}'"
+`),
+	"REQUEST-949-BLOCKING-EVALUATION.conf": []byte(`
+SecRule TX:BLOCKING_INBOUND_ANOMALY_SCORE "@ge %{tx.inbound_anomaly_score_threshold}" "id:949110,phase:2,deny,t:none,log"
+`),
+	"sql-errors.data": []byte("# Database errors\nYou have an error in your SQL syntax\nunterminated quoted string\n"),
+}
+
+func newCRSTestService(t *testing.T) (*SignatureDetectionService, map[string]models.ThreatSignature) {
+	t.Helper()
+	service := NewSignatureDetectionService(repository.NewMemoryThreatRepository(), nil, logging.NewStructuredLogger("test"))
+	result, err := service.ImportCRSRules(context.Background(), crsExcerpt, "crs", models.CRSImportOptions{})
+	if err != nil {
+		t.Fatalf("ImportCRSRules: %v", err)
+	}
+	if result.Imported != 4 || result.Enabled != 3 || result.Ignored != 7 || result.ParanoiaLevel != 1 || result.AnomalyThreshold != 5 {
+		t.Errorf("result = %+v", result)
+	}
+	var skipped []string
+	for _, rule := range result.Skipped {
+		skipped = append(skipped, fmt.Sprintf("%s %s:%d %s", rule.RuleID, rule.File, rule.Line, rule.Reason))
+	}
+	if len(skipped) != 2 || !strings.HasPrefix(skipped[0], "942130 REQUEST-942-APPLICATION-ATTACK-SQLI.conf:19 regular expression is not supported") ||
+		skipped[1] != "942998 REQUEST-942-APPLICATION-ATTACK-SQLI.conf:23 operator @verifycc is not supported" {
+		t.Errorf("skipped = %q", skipped)
+	}
+
+	signatures, _ := service.GetSignatures(context.Background(), &models.SignatureFilter{SignatureSet: "crs"})
+	byRule := make(map[string]models.ThreatSignature)
+	for _, signature := range signatures {
+		byRule[signature.ExternalID] = signature
+	}
+	return service, byRule
+}
+
+func TestCRSRuleTranslation(t *testing.T) {
+	_, signatures := newCRSTestService(t)
+
+	union := signatures["942100"]
+	rule := union.Rules[0]
+	if union.Name != "CRS 942100: SQL Injection Attack: UNION SELECT" || union.Category != "sql_injection" ||
+		union.Severity != "critical" || union.AnomalyScore != 5 || union.ParanoiaLevel != 1 || !union.Enabled ||
+		union.Type != models.SignatureTypeCommunity || union.Confidence != 0.9 {
+		t.Errorf("942100 = %+v", union)
+	}
+	if got := fmt.Sprintf("%s %v %v %v", rule.Field, rule.Targets, rule.Exclusions, rule.Transforms); got !=
+		"cookie_* [names:cookie_* names:param_* param_* body] [cookie_/__utm/] [urlDecodeUni lowercase]" {
+		t.Errorf("942100 rule = %s", got)
+	}
+
+	chain := signatures["942999"]
+	if !chain.MatchAll || len(chain.Rules) != 2 || chain.Rules[1].ID != "942999-2" || chain.Rules[1].Operator != "contains" ||
+		chain.AnomalyScore != 3 || chain.Severity != "medium" {
+		t.Errorf("942999 = %+v", chain)
+	}
+
+	if comment := signatures["942200"]; comment.ParanoiaLevel != 2 || comment.Enabled || comment.Confidence != 0.8 {
+		t.Errorf("942200 = %+v", comment)
+	}
+
+	leak := signatures["951100"]
+	if leak.Rules[0].Field != "response_body" || leak.Rules[0].Operator != "pm" || leak.AnomalyScore != 4 || leak.Category != "disclosure" {
+		t.Errorf("951100 = %+v", leak)
+	}
+
+	if _, err := NewSignatureDetectionService(repository.NewMemoryThreatRepository(), nil, logging.NewStructuredLogger("test")).
+		ImportCRSRules(context.Background(), crsExcerpt, "crs", models.CRSImportOptions{ParanoiaLevel: 5}); !errors.Is(err, ErrInvalidParanoiaLevel) {
+		t.Errorf("paranoia level 5: err = %v", err)
+	}
+}
+
+func TestCRSAnomalyScoring(t *testing.T) {
+	service, signatures := newCRSTestService(t)
+	ctx := context.Background()
+
+	detect := func(method string, params, cookies map[string]interface{}, responseBody string) *models.SignatureDetectionResult {
+		t.Helper()
+		headers := map[string]interface{}{}
+		var pairs []string
+		for name, value := range cookies {
+			pairs = append(pairs, name+"="+value.(string))
+		}
+		if len(pairs) > 0 {
+			headers["Cookie"] = strings.Join(pairs, "; ")
+		}
+		result, err := service.DetectSignatures(ctx, &models.SignatureDetectionRequest{TrafficData: map[string]interface{}{
+			"request":  map[string]interface{}{"method": method, "path": "/search", "headers": headers, "parameters": params},
+			"response": map[string]interface{}{"body": responseBody, "status_code": float64(500)},
+		}})
+		if err != nil {
+			t.Fatalf("DetectSignatures: %v", err)
+		}
+		return result
+	}
+	matched := func(result *models.SignatureDetectionResult) string {
+		var rules []string
+		for _, id := range result.MatchedSignatures {
+			for rule, signature := range signatures {
+				if signature.ID == id {
+					rules = append(rules, rule)
+				}
+			}
+		}
+		sort.Strings(rules)
+		return fmt.Sprintf("%t %d %v", result.Matched, result.AnomalyScore, rules)
+	}
+
+	// Encoded UNION SELECT reaches the threshold on its own
+	result := detect("GET", map[string]interface{}{"q": "1%20UNION%2f**%2fSELECT%20password"}, nil, "")
+	if got := matched(result); got != "true 5 [942100]" || result.SignatureID != signatures["942100"].ID ||
+		!strings.HasPrefix(result.Details, "Anomaly score 5 reached threshold 5") {
+		t.Errorf("union select = %s, %+v", got, result)
+	}
+
+	// Excluded cookies are not inspected, but their names are
+	if got := matched(detect("GET", nil, map[string]interface{}{"__utmz": "union select"}, "")); got != "false 0 []" {
+		t.Errorf("excluded cookie = %s", got)
+	}
+	if got := matched(detect("GET", nil, map[string]interface{}{"union%20select": "1"}, "")); got != "true 5 [942100]" {
+		t.Errorf("cookie name = %s", got)
+	}
+
+	// A chain needs every link; one warning stays below the threshold
+	if got := matched(detect("GET", map[string]interface{}{"a": "x /* y"}, nil, "")); got != "false 0 []" {
+		t.Errorf("chain on GET = %s", got)
+	}
+	if got := matched(detect("POST", map[string]interface{}{"a": "x /* y"}, nil, "")); got != "false 3 [942999]" {
+		t.Errorf("chain on POST = %s", got)
+	}
+
+	// Raising the paranoia level enables 942200, whose score tips the request over
+	if enabled, err := service.SetParanoiaLevel(ctx, "crs", 2); err != nil || enabled != 4 {
+		t.Fatalf("SetParanoiaLevel = %d, %v", enabled, err)
+	}
+	if got := matched(detect("POST", map[string]interface{}{"a": "x /* y --"}, nil, "")); got != "true 6 [942200 942999]" {
+		t.Errorf("paranoia level 2 = %s", got)
+	}
+
+	if got := matched(detect("GET", nil, nil, "Warning: You have an error in your SQL syntax near ''")); got != "false 4 [951100]" {
+		t.Errorf("sql error leakage = %s", got)
+	}
+}
+
+func TestCRSAnomalyThresholdPerSet(t *testing.T) {
+	service, signatures := newCRSTestService(t)
+	ctx := context.Background()
+
+	result, err := service.ImportCRSRules(ctx, crsExcerpt, "strict", models.CRSImportOptions{AnomalyThreshold: 3})
+	if err != nil || result.AnomalyThreshold != 3 {
+		t.Fatalf("ImportCRSRules = %+v, %v", result, err)
+	}
+	strict, _ := service.GetSignatures(ctx, &models.SignatureFilter{SignatureSet: "strict"})
+	strictIDs := make(map[string]string)
+	for _, signature := range strict {
+		strictIDs[signature.ID] = signature.ExternalID
+	}
+
+	detect := func(method, value string) *models.SignatureDetectionResult {
+		t.Helper()
+		result, err := service.DetectSignatures(ctx, &models.SignatureDetectionRequest{TrafficData: map[string]interface{}{
+			"request": map[string]interface{}{"method": method, "path": "/search", "parameters": map[string]interface{}{"a": value}},
+		}})
+		if err != nil {
+			t.Fatalf("DetectSignatures: %v", err)
+		}
+		return result
+	}
+
+	// The chain scores 3 in both sets; only the strict set's threshold is 3
+	if result := detect("POST", "x /* y"); !result.Matched || result.AnomalyScore != 3 || strictIDs[result.SignatureID] != "942999" ||
+		!strings.HasPrefix(result.Details, "Anomaly score 3 reached threshold 3") {
+		t.Errorf("chain = %+v", result)
+	}
+
+	// Importing the strict set leaves the threshold of the crs set alone
+	if result := detect("GET", "1 UNION SELECT password"); !result.Matched || result.AnomalyScore != 5 || result.SignatureID != signatures["942100"].ID ||
+		!strings.HasPrefix(result.Details, "Anomaly score 5 reached threshold 5") {
+		t.Errorf("union select = %+v", result)
+	}
+}
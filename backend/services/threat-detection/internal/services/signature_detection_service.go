@@ -4,10 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	neturl "net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"scopeapi.local/backend/services/threat-detection/internal/models"
@@ -27,14 +32,27 @@ type SignatureDetectionServiceInterface interface {
 	ExportSignatureSet(ctx context.Context, set string) ([]byte, error)
 	GetSignatureStatistics(ctx context.Context, timeRange time.Duration) (*models.SignatureStatistics, error)
 	OptimizeSignatures(ctx context.Context) (*models.SignatureOptimizationResult, error)
+	ImportCRSRules(ctx context.Context, files map[string][]byte, signatureSet string, options models.CRSImportOptions) (*models.CRSImportResult, error)
+	SetParanoiaLevel(ctx context.Context, signatureSet string, level int) (int, error)
 }
 
+// defaultAnomalyThreshold is the inbound anomaly score at which requests match,
+// the OWASP Core Rule Set default
+const defaultAnomalyThreshold = 5
+
 type SignatureDetectionService struct {
 	threatRepo    repository.ThreatRepositoryInterface
 	kafkaProducer kafka.ProducerInterface
 	logger        logging.Logger
 	signatures    map[string]*models.ThreatSignature
-	compiledRules map[string]*regexp.Regexp
+	// Total anomaly score at which the anomaly-scored signatures of a set
+	// match a request, by signature set
+	anomalyThresholds map[string]int
+
+	// mu serialises changes to the loaded signatures; detection only reads
+	// the engine compiled from them
+	mu     sync.Mutex
+	engine atomic.Pointer[signatureEngine]
 }
 
 func NewSignatureDetectionService(
@@ -42,13 +60,22 @@ func NewSignatureDetectionService(
 	kafkaProducer kafka.ProducerInterface,
 	logger logging.Logger,
 ) *SignatureDetectionService {
-	return &SignatureDetectionService{
+	service := &SignatureDetectionService{
 		threatRepo:    threatRepo,
 		kafkaProducer: kafkaProducer,
 		logger:        logger,
 		signatures:    make(map[string]*models.ThreatSignature),
-		compiledRules: make(map[string]*regexp.Regexp),
+
+		anomalyThresholds: make(map[string]int),
 	}
+	service.rebuildEngine()
+	return service
+}
+
+// rebuildEngine compiles the loaded signatures and swaps the new engine in.
+// Callers hold s.mu, except during construction.
+func (s *SignatureDetectionService) rebuildEngine() {
+	s.engine.Store(newSignatureEngine(s.signatures, s.engine.Load(), s.anomalyThresholds, s.logger))
 }
 
 func (s *SignatureDetectionService) DetectSignatures(ctx context.Context, request *models.SignatureDetectionRequest) (*models.SignatureDetectionResult, error) {
@@ -61,23 +88,77 @@ func (s *SignatureDetectionService) DetectSignatures(ctx context.Context, reques
 	}
 
 	targets := s.extractDetectionTargets(request.TrafficData)
+	if request.IPAddress != "" {
+		targets["ip"] = request.IPAddress
+	}
 
-	for signatureID, signature := range s.signatures {
+	// Only the signatures the engine cannot rule out are checked.
+	// Signatures without an anomaly score match on their own; the first one
+	// decides the result. Anomaly-scored signatures add up instead, per
+	// signature set, against the threshold of their set.
+	engine := s.engine.Load()
+	anomalyScores := make(map[string]int)
+	topAnomalyScores := make(map[string]int)
+	topAnomalyMatches := make(map[string]*models.SignatureMatch)
+	for _, index := range engine.candidates(targets) {
+		signatureID := engine.ids[index]
+		signature := engine.signatures[signatureID]
 		match, err := s.checkSignature(signature, targets, request)
 		if err != nil {
 			s.logger.Error("Error checking signature", "signature_id", signatureID, "error", err)
 			continue
 		}
+		if match == nil || !match.Matched {
+			continue
+		}
+
+		result.MatchedSignatures = append(result.MatchedSignatures, signatureID)
+		if signature.AnomalyScore > 0 {
+			set := signature.SignatureSet
+			anomalyScores[set] += signature.AnomalyScore
+			if signature.AnomalyScore > topAnomalyScores[set] {
+				topAnomalyScores[set] = signature.AnomalyScore
+				topAnomalyMatches[set] = match
+			}
+			continue
+		}
 
-		if match != nil && match.Matched {
+		if !result.Matched {
 			result.SignatureID = signatureID
 			result.Matched = true
 			result.Details = match.Details
 			result.DetectedAt = time.Now()
-			break
 		}
 	}
 
+	// The result carries the score of the set that reached its threshold,
+	// or else the highest score of any set
+	sets := make([]string, 0, len(anomalyScores))
+	for set := range anomalyScores {
+		sets = append(sets, set)
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		if anomalyScores[sets[i]] != anomalyScores[sets[j]] {
+			return anomalyScores[sets[i]] > anomalyScores[sets[j]]
+		}
+		return sets[i] < sets[j]
+	})
+	if len(sets) > 0 {
+		result.AnomalyScore = anomalyScores[sets[0]]
+	}
+	for _, set := range sets {
+		threshold := engine.anomalyThreshold(set)
+		if result.Matched || anomalyScores[set] < threshold {
+			continue
+		}
+		result.AnomalyScore = anomalyScores[set]
+		result.SignatureID = topAnomalyMatches[set].SignatureID
+		result.Matched = true
+		result.Details = fmt.Sprintf("Anomaly score %d reached threshold %d; highest scoring match: %s",
+			anomalyScores[set], threshold, topAnomalyMatches[set].Details)
+		result.DetectedAt = time.Now()
+	}
+
 	return result, nil
 }
 
@@ -98,6 +179,24 @@ func (s *SignatureDetectionService) extractDetectionTargets(requestData map[stri
 		if query, ok := request["query"].(string); ok {
 			targets["query"] = query
 		}
+		if protocol, ok := request["protocol"].(string); ok {
+			targets["protocol"] = protocol
+		}
+
+		// Derive the request URI and line from the path and query, falling back to the URL
+		if path, ok := targets["path"]; ok {
+			targets["uri"] = path
+			if targets["query"] != "" {
+				targets["uri"] += "?" + targets["query"]
+			}
+			targets["basename"] = path[strings.LastIndex(path, "/")+1:]
+		} else if parsed, err := neturl.Parse(targets["url"]); err == nil && targets["url"] != "" {
+			targets["uri"] = parsed.RequestURI()
+			targets["basename"] = parsed.Path[strings.LastIndex(parsed.Path, "/")+1:]
+		}
+		if targets["method"] != "" && targets["uri"] != "" {
+			targets["request_line"] = strings.TrimSpace(targets["method"] + " " + targets["uri"] + " " + targets["protocol"])
+		}
 
 		// Extract headers
 		if headers, ok := request["headers"].(map[string]interface{}); ok {
@@ -108,6 +207,13 @@ func (s *SignatureDetectionService) extractDetectionTargets(requestData map[stri
 			}
 		}
 
+		// Extract cookies from the Cookie header
+		for _, cookie := range strings.Split(targets["header_cookie"], ";") {
+			if name, value, found := strings.Cut(strings.TrimSpace(cookie), "="); found && name != "" {
+				targets["cookie_"+name] = value
+			}
+		}
+
 		// Extract body
 		if body, ok := request["body"].(string); ok {
 			targets["body"] = body
@@ -135,6 +241,14 @@ func (s *SignatureDetectionService) extractDetectionTargets(requestData map[stri
 				}
 			}
 		}
+		switch status := response["status_code"].(type) {
+		case float64:
+			targets["response_status"] = strconv.Itoa(int(status))
+		case int:
+			targets["response_status"] = strconv.Itoa(status)
+		case string:
+			targets["response_status"] = status
+		}
 	}
 
 	return targets
@@ -146,19 +260,41 @@ func (s *SignatureDetectionService) checkSignature(signature *models.ThreatSigna
 		return nil, fmt.Errorf("signature %s has no rules", signature.ID)
 	}
 
-	// Check each rule against the targets
+	// Check each rule against the targets. Signatures that match all their
+	// rules report the first rule's match with every rule's details.
+	var allMatch *models.SignatureMatch
 	for _, rule := range signature.Rules {
 		match, err := s.checkRule(rule, targets, signature, request)
 		if err != nil {
 			s.logger.Warn("Rule check failed", "signature_id", signature.ID, "rule_id", rule.ID, "error", err)
+			if signature.MatchAll {
+				break
+			}
+			continue
+		}
+
+		matched := match != nil && match.Matched
+		if !signature.MatchAll {
+			if matched {
+				// Found a matching rule, return the match
+				return match, nil
+			}
 			continue
 		}
 
-		if match != nil && match.Matched {
-			// Found a matching rule, return the match
-			return match, nil
+		if !matched {
+			allMatch = nil
+			break
+		}
+		if allMatch == nil {
+			allMatch = match
+		} else {
+			allMatch.Details += "; " + match.Details
 		}
 	}
+	if allMatch != nil {
+		return allMatch, nil
+	}
 
 	// No rules matched
 	return &models.SignatureMatch{
@@ -176,91 +312,44 @@ func (s *SignatureDetectionService) checkSignature(signature *models.ThreatSigna
 	}, nil
 }
 
+// checkRule checks every value the rule selects, after its transformations,
+// and returns the first match. Rules whose fields are absent do not match.
 func (s *SignatureDetectionService) checkRule(rule models.SignatureRule, targets map[string]string, signature *models.ThreatSignature, request *models.SignatureDetectionRequest) (*models.SignatureMatch, error) {
-	// Get the target value based on the rule field
-	targetValue, exists := targets[rule.Field]
-	if !exists {
-		return nil, fmt.Errorf("field %s not found in targets", rule.Field)
-	}
-
-	var matched bool
-	var matchedValue string
-	var details string
-
-	// Apply the rule operator
-	switch rule.Operator {
-	case "equals":
-		matched = targetValue == rule.Value
-		matchedValue = targetValue
-		details = fmt.Sprintf("Field '%s' equals '%s'", rule.Field, rule.Value)
-
-	case "contains":
-		matched = strings.Contains(strings.ToLower(targetValue), strings.ToLower(rule.Value))
-		matchedValue = targetValue
-		details = fmt.Sprintf("Field '%s' contains '%s'", rule.Field, rule.Value)
-
-	case "regex":
-		// Use compiled regex if available
-		ruleKey := fmt.Sprintf("%s_%s", signature.ID, rule.ID)
-		if regex, ok := s.compiledRules[ruleKey]; ok {
-			matched = regex.MatchString(targetValue)
-			matchedValue = targetValue
-			details = fmt.Sprintf("Field '%s' matches regex pattern '%s'", rule.Field, rule.Value)
-		} else {
-			// Compile regex on the fly if not pre-compiled
-			if regex, err := regexp.Compile(rule.Value); err == nil {
-				matched = regex.MatchString(targetValue)
-				matchedValue = targetValue
-				details = fmt.Sprintf("Field '%s' matches regex pattern '%s'", rule.Field, rule.Value)
-			} else {
-				return nil, fmt.Errorf("invalid regex pattern '%s': %w", rule.Value, err)
-			}
+	for _, transform := range rule.Transforms {
+		if _, ok := signatureTransforms[strings.ToLower(transform)]; !ok && !strings.EqualFold(transform, "none") {
+			return nil, fmt.Errorf("unsupported transformation: %s", transform)
 		}
+	}
 
-	case "starts_with":
-		matched = strings.HasPrefix(strings.ToLower(targetValue), strings.ToLower(rule.Value))
-		matchedValue = targetValue
-		details = fmt.Sprintf("Field '%s' starts with '%s'", rule.Field, rule.Value)
-
-	case "ends_with":
-		matched = strings.HasSuffix(strings.ToLower(targetValue), strings.ToLower(rule.Value))
-		matchedValue = targetValue
-		details = fmt.Sprintf("Field '%s' ends with '%s'", rule.Field, rule.Value)
+	var regex *regexp.Regexp
+	if rule.Operator == "regex" {
+		regex = s.engine.Load().regexes[signature.ID+"_"+rule.ID]
+	}
 
-	case "greater_than":
-		if rule.IntValue > 0 {
-			if intVal, err := strconv.Atoi(targetValue); err == nil {
-				matched = intVal > rule.IntValue
-				matchedValue = targetValue
-				details = fmt.Sprintf("Field '%s' value %d is greater than %d", rule.Field, intVal, rule.IntValue)
+	var matched bool
+	var matchedField, matchedValue, details string
+
+values:
+	for _, value := range selectRuleValues(rule, targets) {
+		for _, form := range transformValue(value.value, rule.Transforms, rule.MultiMatch) {
+			formMatched, err := applyOperator(rule, regex, form)
+			if err != nil {
+				return nil, err
 			}
-		}
-
-	case "less_than":
-		if rule.IntValue > 0 {
-			if intVal, err := strconv.Atoi(targetValue); err == nil {
-				matched = intVal < rule.IntValue
-				matchedValue = targetValue
-				details = fmt.Sprintf("Field '%s' value %d is less than %d", rule.Field, intVal, rule.IntValue)
+			if formMatched != rule.Negate {
+				matched = true
+				matchedField = value.field
+				matchedValue = value.value
+				details = operatorDetails(rule, value.field, form)
+				if rule.Negate {
+					details = "Not: " + details
+				}
+				break values
 			}
 		}
-
-	case "length_greater":
-		if rule.IntValue > 0 {
-			matched = len(targetValue) > rule.IntValue
-			matchedValue = targetValue
-			details = fmt.Sprintf("Field '%s' length %d is greater than %d", rule.Field, len(targetValue), rule.IntValue)
-		}
-
-	case "length_less":
-		if rule.IntValue > 0 {
-			matched = len(targetValue) < rule.IntValue
-			matchedValue = targetValue
-			details = fmt.Sprintf("Field '%s' length %d is less than %d", rule.Field, len(targetValue), rule.IntValue)
-		}
-
-	default:
-		return nil, fmt.Errorf("unsupported operator: %s", rule.Operator)
+	}
+	if !matched {
+		return nil, nil
 	}
 
 	// Create signature match result
@@ -273,7 +362,7 @@ func (s *SignatureDetectionService) checkRule(rule models.SignatureRule, targets
 		RiskScore:     signature.RiskScore * rule.Weight,
 		Confidence:    signature.Confidence,
 		Description:   signature.Description,
-		MatchedField:  rule.Field,
+		MatchedField:  matchedField,
 		MatchedValue:  matchedValue,
 		RuleMatched:   rule.ID,
 		RuleOperator:  rule.Operator,
@@ -291,6 +380,132 @@ func (s *SignatureDetectionService) checkRule(rule models.SignatureRule, targets
 	return match, nil
 }
 
+// applyOperator applies the rule operator to a single value. Regex rules use
+// regex when it is compiled already.
+func applyOperator(rule models.SignatureRule, regex *regexp.Regexp, targetValue string) (bool, error) {
+	switch rule.Operator {
+	case "equals":
+		return targetValue == rule.Value, nil
+	case "not_equals":
+		return targetValue != rule.Value, nil
+	case "contains":
+		return strings.Contains(strings.ToLower(targetValue), strings.ToLower(rule.Value)), nil
+	case "not_contains":
+		return !strings.Contains(strings.ToLower(targetValue), strings.ToLower(rule.Value)), nil
+	case "regex":
+		if regex == nil {
+			// Compile regex on the fly if not pre-compiled
+			var err error
+			if regex, err = regexp.Compile(rule.Value); err != nil {
+				return false, fmt.Errorf("invalid regex pattern '%s': %w", rule.Value, err)
+			}
+		}
+		return regex.MatchString(targetValue), nil
+	case "pm":
+		_, found := matchesPhrase(targetValue, rule.Value)
+		return found, nil
+	case "starts_with":
+		return strings.HasPrefix(strings.ToLower(targetValue), strings.ToLower(rule.Value)), nil
+	case "ends_with":
+		return strings.HasSuffix(strings.ToLower(targetValue), strings.ToLower(rule.Value)), nil
+	case "within":
+		return targetValue != "" && strings.Contains(rule.Value, targetValue), nil
+	case "greater_than":
+		intVal, err := strconv.Atoi(targetValue)
+		return rule.IntValue > 0 && err == nil && intVal > rule.IntValue, nil
+	case "less_than":
+		intVal, err := strconv.Atoi(targetValue)
+		return rule.IntValue > 0 && err == nil && intVal < rule.IntValue, nil
+	case "eq", "ge", "le":
+		intVal, err := strconv.Atoi(strings.TrimSpace(targetValue))
+		if err != nil {
+			return false, nil
+		}
+		bound := ruleBound(rule)
+		return rule.Operator == "eq" && intVal == bound ||
+			rule.Operator == "ge" && intVal >= bound ||
+			rule.Operator == "le" && intVal <= bound, nil
+	case "length_greater":
+		return rule.IntValue > 0 && len(targetValue) > rule.IntValue, nil
+	case "length_less":
+		return rule.IntValue > 0 && len(targetValue) < rule.IntValue, nil
+	case "ip_match":
+		return ipMatches(targetValue, rule.Value), nil
+	case "detect_sqli":
+		return sqliHeuristic.MatchString(targetValue), nil
+	case "detect_xss":
+		return xssHeuristic.MatchString(targetValue), nil
+	case "byte_range":
+		return !inByteRange(targetValue, rule.Value), nil
+	case "invalid_url_encoding":
+		return invalidURLEncoding(targetValue), nil
+	case "invalid_utf8":
+		return !utf8.ValidString(targetValue), nil
+	case "unconditional":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported operator: %s", rule.Operator)
+	}
+}
+
+// operatorDetails describes how a value of field satisfied the rule operator
+func operatorDetails(rule models.SignatureRule, field, targetValue string) string {
+	switch rule.Operator {
+	case "equals":
+		return fmt.Sprintf("Field '%s' equals '%s'", field, rule.Value)
+	case "not_equals":
+		return fmt.Sprintf("Field '%s' does not equal '%s'", field, rule.Value)
+	case "contains":
+		return fmt.Sprintf("Field '%s' contains '%s'", field, rule.Value)
+	case "not_contains":
+		return fmt.Sprintf("Field '%s' does not contain '%s'", field, rule.Value)
+	case "regex":
+		return fmt.Sprintf("Field '%s' matches regex pattern '%s'", field, rule.Value)
+	case "pm":
+		phrase, _ := matchesPhrase(targetValue, rule.Value)
+		return fmt.Sprintf("Field '%s' contains phrase '%s'", field, phrase)
+	case "starts_with":
+		return fmt.Sprintf("Field '%s' starts with '%s'", field, rule.Value)
+	case "ends_with":
+		return fmt.Sprintf("Field '%s' ends with '%s'", field, rule.Value)
+	case "within":
+		return fmt.Sprintf("Field '%s' value '%s' is within '%s'", field, targetValue, rule.Value)
+	case "greater_than":
+		return fmt.Sprintf("Field '%s' value %s is greater than %d", field, targetValue, rule.IntValue)
+	case "less_than":
+		return fmt.Sprintf("Field '%s' value %s is less than %d", field, targetValue, rule.IntValue)
+	case "eq", "ge", "le":
+		return fmt.Sprintf("Field '%s' value %s is %s %d", field, strings.TrimSpace(targetValue), rule.Operator, ruleBound(rule))
+	case "length_greater":
+		return fmt.Sprintf("Field '%s' length %d is greater than %d", field, len(targetValue), rule.IntValue)
+	case "length_less":
+		return fmt.Sprintf("Field '%s' length %d is less than %d", field, len(targetValue), rule.IntValue)
+	case "ip_match":
+		return fmt.Sprintf("Field '%s' address %s is in %s", field, targetValue, rule.Value)
+	case "detect_sqli":
+		return fmt.Sprintf("Field '%s' contains SQL injection", field)
+	case "detect_xss":
+		return fmt.Sprintf("Field '%s' contains cross-site scripting", field)
+	case "byte_range":
+		return fmt.Sprintf("Field '%s' has bytes outside %s", field, rule.Value)
+	case "invalid_url_encoding":
+		return fmt.Sprintf("Field '%s' has invalid URL encoding", field)
+	case "invalid_utf8":
+		return fmt.Sprintf("Field '%s' has invalid UTF-8 encoding", field)
+	default:
+		return fmt.Sprintf("Field '%s' is present", field)
+	}
+}
+
+// ruleBound is the number numeric comparisons compare with: the rule value
+// when it is a number, otherwise its int value
+func ruleBound(rule models.SignatureRule) int {
+	if value, err := strconv.Atoi(rule.Value); err == nil {
+		return value
+	}
+	return rule.IntValue
+}
+
 func (s *SignatureDetectionService) LoadSignatures(ctx context.Context, signatureSet string) error {
 	signatures, err := s.threatRepo.GetThreatSignatures(ctx, &models.SignatureFilter{
 		SignatureSet: signatureSet,
@@ -300,6 +515,9 @@ func (s *SignatureDetectionService) LoadSignatures(ctx context.Context, signatur
 		return fmt.Errorf("failed to load signatures: %w", err)
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	// Clear existing signatures for this set
 	for id, sig := range s.signatures {
 		if sig.SignatureSet == signatureSet {
@@ -307,22 +525,11 @@ func (s *SignatureDetectionService) LoadSignatures(ctx context.Context, signatur
 		}
 	}
 
-	// Load new signatures
+	// Load new signatures and compile them
 	for _, signature := range signatures {
 		s.signatures[signature.ID] = &signature
-
-		// Pre-compile regex rules
-		for _, rule := range signature.Rules {
-			if rule.Operator == "regex" {
-				ruleKey := fmt.Sprintf("%s_%s", signature.ID, rule.ID)
-				if regex, err := regexp.Compile(rule.Value); err == nil {
-					s.compiledRules[ruleKey] = regex
-				} else {
-					s.logger.Warn("Failed to compile regex rule", "signature_id", signature.ID, "rule_id", rule.ID, "error", err)
-				}
-			}
-		}
 	}
+	s.rebuildEngine()
 
 	s.logger.Info("Loaded signatures", "signature_set", signatureSet, "count", len(signatures))
 	return nil
@@ -334,22 +541,12 @@ func (s *SignatureDetectionService) UpdateSignature(ctx context.Context, signatu
 		return fmt.Errorf("failed to update signature in repository: %w", err)
 	}
 
-	// Update in memory
+	// Update in memory and recompile
 	signature.UpdatedAt = time.Now()
+	s.mu.Lock()
 	s.signatures[signatureID] = signature
-
-	// Update compiled rules
-	for _, rule := range signature.Rules {
-		if rule.Operator == "regex" {
-			ruleKey := fmt.Sprintf("%s_%s", signature.ID, rule.ID)
-			if regex, err := regexp.Compile(rule.Value); err == nil {
-				s.compiledRules[ruleKey] = regex
-			} else {
-				delete(s.compiledRules, ruleKey)
-				s.logger.Warn("Failed to compile updated regex rule", "signature_id", signature.ID, "rule_id", rule.ID, "error", err)
-			}
-		}
-	}
+	s.rebuildEngine()
+	s.mu.Unlock()
 
 	s.logger.Info("Updated signature", "signature_id", signatureID)
 	return nil
@@ -376,21 +573,12 @@ func (s *SignatureDetectionService) CreateCustomSignature(ctx context.Context, s
 		return fmt.Errorf("failed to create signature: %w", err)
 	}
 
-	// Add to memory if enabled
+	// Add to memory and recompile if enabled
 	if signature.Enabled {
+		s.mu.Lock()
 		s.signatures[signature.ID] = signature
-
-		// Compile regex rules
-		for _, rule := range signature.Rules {
-			if rule.Operator == "regex" {
-				ruleKey := fmt.Sprintf("%s_%s", signature.ID, rule.ID)
-				if regex, err := regexp.Compile(rule.Value); err == nil {
-					s.compiledRules[ruleKey] = regex
-				} else {
-					s.logger.Warn("Failed to compile regex rule in new signature", "signature_id", signature.ID, "rule_id", rule.ID, "error", err)
-				}
-			}
-		}
+		s.rebuildEngine()
+		s.mu.Unlock()
 	}
 
 	s.logger.Info("Created custom signature", "signature_id", signature.ID, "name", signature.Name)
@@ -416,6 +604,21 @@ func (s *SignatureDetectionService) validateSignature(signature *models.ThreatSi
 		"length_less":    true,
 		"not_contains":   true,
 		"not_equals":     true,
+		"greater_than":   true,
+		"less_than":      true,
+		"eq":             true,
+		"ge":             true,
+		"le":             true,
+		"within":         true,
+		"pm":             true,
+		"ip_match":       true,
+		"detect_sqli":    true,
+		"detect_xss":     true,
+		"byte_range":     true,
+
+		"invalid_url_encoding": true,
+		"invalid_utf8":         true,
+		"unconditional":        true,
 	}
 
 	for i, rule := range signature.Rules {
@@ -436,13 +639,21 @@ func (s *SignatureDetectionService) validateSignature(signature *models.ThreatSi
 		if (rule.Operator == "length_greater" || rule.Operator == "length_less") && rule.IntValue <= 0 {
 			return fmt.Errorf("rule %d: int_value must be positive for length operators", i)
 		}
+
+		for _, transform := range rule.Transforms {
+			if _, ok := signatureTransforms[strings.ToLower(transform)]; !ok && !strings.EqualFold(transform, "none") {
+				return fmt.Errorf("rule %d: unsupported transformation '%s'", i, transform)
+			}
+		}
 	}
 
 	return nil
 }
 
 func (s *SignatureDetectionService) TestSignature(ctx context.Context, signatureID string, testData []map[string]interface{}) (*models.SignatureTestResult, error) {
+	s.mu.Lock()
 	signature, exists := s.signatures[signatureID]
+	s.mu.Unlock()
 	if !exists {
 		// Try to load from repository
 		signatures, err := s.threatRepo.GetThreatSignatures(ctx, &models.SignatureFilter{
@@ -495,7 +706,7 @@ func (s *SignatureDetectionService) TestSignature(ctx context.Context, signature
 			testCase.Error = err.Error()
 			result.FailedTests++
 		} else {
-			testCase.Actual = match != nil
+			testCase.Actual = match != nil && match.Matched
 			if match != nil {
 				testCase.MatchedRule = match.RuleMatched
 			}
@@ -516,6 +727,9 @@ func (s *SignatureDetectionService) TestSignature(ctx context.Context, signature
 }
 
 func (s *SignatureDetectionService) getDetectionCategories() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	categories := make(map[string]bool)
 	for _, signature := range s.signatures {
 		if signature.Enabled {
@@ -609,6 +823,123 @@ func (s *SignatureDetectionService) ImportSignatureSet(ctx context.Context, sign
 	return nil
 }
 
+// ImportCRSRules translates OWASP Core Rule Set / ModSecurity SecLang rule
+// files into the signatures of a set, replacing the set's current signatures.
+// Rules above the selected paranoia level are imported disabled.
+func (s *SignatureDetectionService) ImportCRSRules(ctx context.Context, files map[string][]byte, signatureSet string, options models.CRSImportOptions) (*models.CRSImportResult, error) {
+	if options.ParanoiaLevel < 0 || options.ParanoiaLevel > 4 {
+		return nil, ErrInvalidParanoiaLevel
+	}
+
+	translation, err := translateCRSRules(files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rule files: %w", err)
+	}
+
+	result := &models.CRSImportResult{
+		SignatureSet:     signatureSet,
+		ParanoiaLevel:    options.ParanoiaLevel,
+		AnomalyThreshold: options.AnomalyThreshold,
+		Ignored:          translation.ignored,
+		Skipped:          translation.skipped,
+		Warnings:         translation.warnings,
+	}
+	if result.ParanoiaLevel == 0 {
+		result.ParanoiaLevel = translation.txInt("blocking_paranoia_level", "paranoia_level")
+		if result.ParanoiaLevel < 1 || result.ParanoiaLevel > 4 {
+			result.ParanoiaLevel = 1
+		}
+	}
+	if result.AnomalyThreshold <= 0 {
+		result.AnomalyThreshold = translation.txInt("inbound_anomaly_score_threshold")
+		if result.AnomalyThreshold <= 0 {
+			result.AnomalyThreshold = defaultAnomalyThreshold
+		}
+	}
+
+	existing, err := s.threatRepo.GetThreatSignatures(ctx, &models.SignatureFilter{SignatureSet: signatureSet})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signatures of set %s: %w", signatureSet, err)
+	}
+	for _, signature := range existing {
+		if err := s.threatRepo.DeleteThreatSignature(ctx, signature.ID); err != nil {
+			return nil, fmt.Errorf("failed to delete signature %s: %w", signature.ID, err)
+		}
+	}
+
+	for _, signature := range translation.signatures {
+		if err := s.validateSignature(&signature); err != nil {
+			result.Skipped = append(result.Skipped, models.CRSSkippedRule{RuleID: signature.ExternalID, Reason: err.Error()})
+			continue
+		}
+
+		signature.ID = uuid.New().String()
+		signature.SignatureSet = signatureSet
+		signature.Enabled = signature.ParanoiaLevel <= result.ParanoiaLevel
+		signature.CreatedAt = time.Now()
+		signature.UpdatedAt = time.Now()
+
+		if err := s.threatRepo.CreateThreatSignature(ctx, &signature); err != nil {
+			return nil, fmt.Errorf("failed to create signature %s: %w", signature.Name, err)
+		}
+		result.Imported++
+		if signature.Enabled {
+			result.Enabled++
+		}
+	}
+
+	s.mu.Lock()
+	s.anomalyThresholds[signatureSet] = result.AnomalyThreshold
+	s.mu.Unlock()
+	if err := s.LoadSignatures(ctx, signatureSet); err != nil {
+		return nil, fmt.Errorf("failed to reload signatures after import: %w", err)
+	}
+
+	s.logger.Info("Imported CRS rules", "signature_set", signatureSet, "imported", result.Imported,
+		"enabled", result.Enabled, "skipped", len(result.Skipped), "paranoia_level", result.ParanoiaLevel)
+	return result, nil
+}
+
+// SetParanoiaLevel enables the signatures of a set up to a paranoia level and
+// disables those above it, returning how many are enabled. Signatures without
+// a paranoia level are left as they are.
+func (s *SignatureDetectionService) SetParanoiaLevel(ctx context.Context, signatureSet string, level int) (int, error) {
+	if level < 1 || level > 4 {
+		return 0, ErrInvalidParanoiaLevel
+	}
+
+	signatures, err := s.threatRepo.GetThreatSignatures(ctx, &models.SignatureFilter{SignatureSet: signatureSet})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get signatures of set %s: %w", signatureSet, err)
+	}
+
+	enabled := 0
+	for _, signature := range signatures {
+		if signature.ParanoiaLevel == 0 {
+			continue
+		}
+		wanted := signature.ParanoiaLevel <= level
+		if wanted {
+			enabled++
+		}
+		if signature.Enabled == wanted {
+			continue
+		}
+		signature.Enabled = wanted
+		signature.UpdatedAt = time.Now()
+		if err := s.threatRepo.UpdateThreatSignature(ctx, signature.ID, &signature); err != nil {
+			return 0, fmt.Errorf("failed to update signature %s: %w", signature.ID, err)
+		}
+	}
+
+	if err := s.LoadSignatures(ctx, signatureSet); err != nil {
+		return 0, fmt.Errorf("failed to reload signatures: %w", err)
+	}
+
+	s.logger.Info("Set paranoia level", "signature_set", signatureSet, "paranoia_level", level, "enabled", enabled)
+	return enabled, nil
+}
+
 func (s *SignatureDetectionService) ExportSignatureSet(ctx context.Context, signatureSet string) ([]byte, error) {
 	signatures, err := s.threatRepo.GetThreatSignatures(ctx, &models.SignatureFilter{
 		SignatureSet: signatureSet,
@@ -633,6 +964,7 @@ func (s *SignatureDetectionService) ExportSignatureSet(ctx context.Context, sign
 }
 
 func (s *SignatureDetectionService) GetSignatureStatistics(ctx context.Context, timeRange time.Duration) (*models.SignatureStatistics, error) {
+	s.mu.Lock()
 	stats := &models.SignatureStatistics{
 		TotalSignatures:      len(s.signatures),
 		EnabledSignatures:    0,
@@ -659,6 +991,7 @@ func (s *SignatureDetectionService) GetSignatureStatistics(ctx context.Context,
 		stats.SignaturesByType[signature.Type]++
 		stats.SignaturesByCategory[signature.Category]++
 	}
+	s.mu.Unlock()
 
 	// Get match statistics from repository
 	matchStats, err := s.threatRepo.GetSignatureMatchStatistics(ctx)
@@ -686,6 +1019,9 @@ func (s *SignatureDetectionService) OptimizeSignatures(ctx context.Context) (*mo
 		return nil, fmt.Errorf("failed to get signature statistics: %w", err)
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	// Identify low-performing signatures
 	for signatureID, signature := range s.signatures {
 		if !signature.Enabled {
@@ -0,0 +1,530 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+
+	"scopeapi.local/backend/services/threat-detection/internal/models"
+	"scopeapi.local/backend/shared/logging"
+)
+
+// Limits on literal prefilters: shorter literals, or more of them, filter
+// too little to be worth scanning for
+const (
+	minPrefilterLiteral = 3
+	maxPrefilterSet     = 32
+)
+
+// signatureEngine is the compiled, immutable form of the loaded signatures.
+// It narrows a request down to the signatures that can match before their
+// rules are checked: rules are indexed by the fields they select, and the
+// literal fragments of their values and patterns are found with one
+// Aho-Corasick pass per value. Rules without literals are applied directly
+// with their pre-compiled regular expressions. Go's regexp has no
+// multi-pattern matcher like RE2::Set, and alternations of many patterns run
+// slower than the patterns one by one, so the literal pass stands in for one.
+// The service swaps engines atomically, so detection never sees a partial one.
+type signatureEngine struct {
+	signatures map[string]*models.ThreatSignature
+	// Signature IDs in detection order
+	ids     []string
+	regexes map[string]*regexp.Regexp
+
+	// Anomaly thresholds by signature set; sets without one use
+	// defaultAnomalyThreshold
+	anomalyThresholds map[string]int
+
+	rules  []engineRule
+	chains []engineChain
+	// Rules without a literal prefilter by the selectors they use, and the
+	// transformation chains of prefiltered rules by selector. Pattern
+	// selectors are those matching more than one field.
+	selectors        map[string][]int
+	prefilterChains  map[string][]int
+	patternSelectors []string
+
+	literals     *ahoCorasick
+	literalRules [][]int
+}
+
+// engineRule is one rule of one signature
+type engineRule struct {
+	signature  int
+	rule       models.SignatureRule
+	regex      *regexp.Regexp
+	selectors  []string
+	chain      int
+	prefilter  bool
+	exclusions bool
+}
+
+// engineChain is a transformation chain shared by rules
+type engineChain struct {
+	transforms []string
+	multiMatch bool
+}
+
+// newSignatureEngine compiles signatures, reusing the regular expressions of
+// the previous engine where the pattern is unchanged
+func newSignatureEngine(signatures map[string]*models.ThreatSignature, previous *signatureEngine, anomalyThresholds map[string]int, logger logging.Logger) *signatureEngine {
+	engine := &signatureEngine{
+		signatures:        make(map[string]*models.ThreatSignature, len(signatures)),
+		regexes:           make(map[string]*regexp.Regexp),
+		anomalyThresholds: make(map[string]int, len(anomalyThresholds)),
+		selectors:         make(map[string][]int),
+		prefilterChains:   make(map[string][]int),
+	}
+	for set, threshold := range anomalyThresholds {
+		engine.anomalyThresholds[set] = threshold
+	}
+	for id, signature := range signatures {
+		engine.signatures[id] = signature
+		engine.ids = append(engine.ids, id)
+	}
+	sort.Strings(engine.ids)
+
+	chains := make(map[string]int)
+	literals := make(map[string]int)
+	var literalList []string
+
+	for index, id := range engine.ids {
+		signature := engine.signatures[id]
+		for _, rule := range signature.Rules {
+			var regex *regexp.Regexp
+			if rule.Operator == "regex" {
+				ruleKey := fmt.Sprintf("%s_%s", signature.ID, rule.ID)
+				if previous != nil && previous.regexes[ruleKey] != nil && previous.regexes[ruleKey].String() == rule.Value {
+					regex = previous.regexes[ruleKey]
+				} else if compiled, err := regexp.Compile(rule.Value); err == nil {
+					regex = compiled
+				} else if logger != nil {
+					logger.Warn("Failed to compile regex rule", "signature_id", signature.ID, "rule_id", rule.ID, "error", err)
+				}
+				if regex != nil {
+					engine.regexes[ruleKey] = regex
+				}
+			}
+
+			chainKey := fmt.Sprintf("%t %s", rule.MultiMatch, strings.ToLower(strings.Join(rule.Transforms, ",")))
+			chain, ok := chains[chainKey]
+			if !ok {
+				chain = len(engine.chains)
+				chains[chainKey] = chain
+				engine.chains = append(engine.chains, engineChain{transforms: rule.Transforms, multiMatch: rule.MultiMatch})
+			}
+
+			ruleIndex := len(engine.rules)
+			compiled := engineRule{
+				signature:  index,
+				rule:       rule,
+				regex:      regex,
+				selectors:  append([]string{rule.Field}, rule.Targets...),
+				chain:      chain,
+				exclusions: len(rule.Exclusions) > 0,
+			}
+			if fragments := ruleLiterals(rule); fragments != nil && !rule.Negate {
+				compiled.prefilter = true
+				for _, fragment := range fragments {
+					literal, ok := literals[fragment]
+					if !ok {
+						literal = len(literalList)
+						literals[fragment] = literal
+						literalList = append(literalList, fragment)
+						engine.literalRules = append(engine.literalRules, nil)
+					}
+					engine.literalRules[literal] = append(engine.literalRules[literal], ruleIndex)
+				}
+			}
+			engine.rules = append(engine.rules, compiled)
+
+			for _, selector := range compiled.selectors {
+				_, plain := engine.selectors[selector]
+				_, prefiltered := engine.prefilterChains[selector]
+				if !plain && !prefiltered && isPatternSelector(selector) {
+					engine.patternSelectors = append(engine.patternSelectors, selector)
+				}
+				if !compiled.prefilter {
+					engine.selectors[selector] = append(engine.selectors[selector], ruleIndex)
+				} else if !containsInt(engine.prefilterChains[selector], chain) {
+					engine.prefilterChains[selector] = append(engine.prefilterChains[selector], chain)
+				}
+			}
+		}
+	}
+	sort.Strings(engine.patternSelectors)
+
+	engine.literals = newAhoCorasick(literalList)
+	return engine
+}
+
+func isPatternSelector(selector string) bool {
+	selector = strings.TrimPrefix(selector, "names:")
+	if strings.HasSuffix(selector, "*") {
+		return true
+	}
+	start := strings.Index(selector, "/")
+	return start >= 0 && len(selector) > start+1 && strings.HasSuffix(selector, "/")
+}
+
+// anomalyThreshold returns the total anomaly score at which the anomaly-scored
+// signatures of a set match a request
+func (e *signatureEngine) anomalyThreshold(signatureSet string) int {
+	if threshold, ok := e.anomalyThresholds[signatureSet]; ok {
+		return threshold
+	}
+	return defaultAnomalyThreshold
+}
+
+// candidates returns the indexes, in detection order, of the signatures that
+// may match targets. Every signature left out is certain not to match.
+func (e *signatureEngine) candidates(targets map[string]string) []int {
+	if len(e.rules) == 0 {
+		return nil
+	}
+
+	fields := make([]string, 0, len(targets))
+	for field := range targets {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	// Values are transformed and scanned once per transformation chain
+	type valueGroup struct {
+		value string
+		chain int
+	}
+	candidate := make([]bool, len(e.rules))
+	forms := make(map[valueGroup][]string)
+	hits := make(map[string][]int)
+
+	for _, field := range fields {
+		// The value each selector that matches the field inspects
+		values := make(map[string]string)
+		selectField := func(selector, prefix string) {
+			if strings.HasPrefix(selector, "names:") {
+				values[selector] = strings.TrimPrefix(field, prefix)
+			} else {
+				values[selector] = targets[field]
+			}
+		}
+		selectField(field, "")
+		prefix, _ := selectorMatches(field, field)
+		selectField("names:"+field, prefix)
+		for _, selector := range e.patternSelectors {
+			if prefix, ok := selectorMatches(selector, field); ok {
+				selectField(selector, prefix)
+			}
+		}
+
+		ruleGroups := make(map[valueGroup][]int)
+		scanGroups := make(map[valueGroup]bool)
+		for selector, value := range values {
+			names := strings.HasPrefix(selector, "names:")
+			for _, chain := range e.prefilterChains[selector] {
+				scanGroups[valueGroup{value: value, chain: chain}] = true
+			}
+			for _, ruleIndex := range e.selectors[selector] {
+				rule := &e.rules[ruleIndex]
+				if candidate[ruleIndex] || rule.exclusions && excludedField(rule.rule.Exclusions, names, field) {
+					continue
+				}
+				group := valueGroup{value: value, chain: rule.chain}
+				ruleGroups[group] = append(ruleGroups[group], ruleIndex)
+			}
+		}
+
+		transformed := func(group valueGroup) []string {
+			groupForms, ok := forms[group]
+			if !ok {
+				chain := &e.chains[group.chain]
+				groupForms = transformValue(group.value, chain.transforms, chain.multiMatch)
+				forms[group] = groupForms
+			}
+			return groupForms
+		}
+
+		// Prefiltered rules are candidates when one of their literals occurs
+		// in a value they select
+		for group := range scanGroups {
+			for _, form := range transformed(group) {
+				folded := foldLiteral(form)
+				formHits, ok := hits[folded]
+				if !ok {
+					formHits = e.literals.find(folded)
+					hits[folded] = formHits
+				}
+				for _, literal := range formHits {
+					for _, ruleIndex := range e.literalRules[literal] {
+						if !candidate[ruleIndex] && e.rules[ruleIndex].chain == group.chain {
+							candidate[ruleIndex] = e.rules[ruleIndex].selects(values, group.value, field)
+						}
+					}
+				}
+			}
+		}
+
+		// Other rules are applied here; rules that fail are left to the full
+		// check to report
+		for group, ruleIndexes := range ruleGroups {
+			for _, form := range transformed(group) {
+				for _, ruleIndex := range ruleIndexes {
+					rule := &e.rules[ruleIndex]
+					if !candidate[ruleIndex] {
+						matched, err := applyOperator(rule.rule, rule.regex, form)
+						candidate[ruleIndex] = err != nil || matched != rule.rule.Negate
+					}
+				}
+			}
+		}
+	}
+
+	// Signatures that need all their rules need every rule to be a candidate
+	candidateRules := make([]int, len(e.ids))
+	for ruleIndex, isCandidate := range candidate {
+		if isCandidate {
+			candidateRules[e.rules[ruleIndex].signature]++
+		}
+	}
+	var result []int
+	for index, count := range candidateRules {
+		signature := e.signatures[e.ids[index]]
+		if count > 0 && (!signature.MatchAll || count == len(signature.Rules)) {
+			result = append(result, index)
+		}
+	}
+	return result
+}
+
+// selects reports whether the rule inspects value of field, given the values
+// of the field's selectors
+func (r *engineRule) selects(values map[string]string, value, field string) bool {
+	for _, selector := range r.selectors {
+		selected, ok := values[selector]
+		if !ok || selected != value {
+			continue
+		}
+		if !r.exclusions || !excludedField(r.rule.Exclusions, strings.HasPrefix(selector, "names:"), field) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleLiterals returns folded literals of which a value must contain at least
+// one for the rule to match, or nil when the rule has no such literals
+func ruleLiterals(rule models.SignatureRule) []string {
+	var literals []string
+	switch rule.Operator {
+	case "contains", "equals", "starts_with", "ends_with":
+		if rule.Value != "" {
+			literals = []string{rule.Value}
+		}
+	case "pm":
+		phrases := strings.Fields(rule.Value)
+		if strings.Contains(rule.Value, "\n") {
+			phrases = strings.Split(rule.Value, "\n")
+		}
+		for _, phrase := range phrases {
+			if phrase == "" {
+				continue
+			}
+			literals = append(literals, phrase)
+		}
+		// Every phrase is a literal, so phrase lists are never too large
+		for i := range literals {
+			literals[i] = foldLiteral(literals[i])
+		}
+		return literals
+	case "regex":
+		parsed, err := syntax.Parse(rule.Value, syntax.Perl)
+		if err != nil {
+			return nil
+		}
+		literals = regexLiterals(parsed.Simplify())
+		if len(literals) > maxPrefilterSet {
+			return nil
+		}
+		for _, literal := range literals {
+			if len(literal) < minPrefilterLiteral {
+				return nil
+			}
+		}
+	}
+	for i := range literals {
+		literals[i] = foldLiteral(literals[i])
+	}
+	return literals
+}
+
+// regexLiterals returns literals of which any match of re contains one, or nil.
+// Only ASCII literals are used, as other characters have case folds that
+// lowercasing does not reach.
+func regexLiterals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		literal := string(re.Rune)
+		for _, r := range literal {
+			if r >= unicode.MaxASCII {
+				return nil
+			}
+		}
+		return []string{literal}
+	case syntax.OpCapture, syntax.OpPlus:
+		return regexLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return regexLiterals(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		// The sub-expression whose shortest literal is longest filters best
+		var best []string
+		bestLength := 0
+		for _, sub := range re.Sub {
+			literals := regexLiterals(sub)
+			if literals == nil || len(literals) > maxPrefilterSet {
+				continue
+			}
+			shortest := len(literals[0])
+			for _, literal := range literals {
+				if len(literal) < shortest {
+					shortest = len(literal)
+				}
+			}
+			if shortest > bestLength {
+				best, bestLength = literals, shortest
+			}
+		}
+		return best
+	case syntax.OpAlternate:
+		var literals []string
+		for _, sub := range re.Sub {
+			subLiterals := regexLiterals(sub)
+			if subLiterals == nil {
+				return nil
+			}
+			literals = append(literals, subLiterals...)
+		}
+		return literals
+	}
+	return nil
+}
+
+// foldLiteral lowercases s the way prefilter literals and values are compared,
+// also folding the long s and Kelvin sign that match "s" and "k" without case
+func foldLiteral(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case 'ſ':
+			return 's'
+		case 'K':
+			return 'k'
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
+
+// ahoCorasick finds every occurrence of a set of literals in one pass
+type ahoCorasick struct {
+	nodes []ahoCorasickNode
+}
+
+type ahoCorasickNode struct {
+	next map[byte]int32
+	fail int32
+	// Nearest node along the failure links that ends a literal
+	output int32
+	// Literal ending at this node, or -1
+	literal int32
+}
+
+func newAhoCorasick(literals []string) *ahoCorasick {
+	ac := &ahoCorasick{nodes: []ahoCorasickNode{{next: map[byte]int32{}, output: -1, literal: -1}}}
+	for i, literal := range literals {
+		node := int32(0)
+		for j := 0; j < len(literal); j++ {
+			next, ok := ac.nodes[node].next[literal[j]]
+			if !ok {
+				next = int32(len(ac.nodes))
+				ac.nodes = append(ac.nodes, ahoCorasickNode{next: map[byte]int32{}, output: -1, literal: -1})
+				ac.nodes[node].next[literal[j]] = next
+			}
+			node = next
+		}
+		ac.nodes[node].literal = int32(i)
+	}
+
+	// Breadth-first, so failure links point at nodes already linked
+	queue := make([]int32, 0, len(ac.nodes))
+	for _, child := range ac.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for c, child := range ac.nodes[node].next {
+			fail := ac.nodes[node].fail
+			for fail > 0 {
+				if _, ok := ac.nodes[fail].next[c]; ok {
+					break
+				}
+				fail = ac.nodes[fail].fail
+			}
+			if target, ok := ac.nodes[fail].next[c]; ok && target != child {
+				ac.nodes[child].fail = target
+			}
+			failNode := ac.nodes[child].fail
+			if ac.nodes[failNode].literal >= 0 {
+				ac.nodes[child].output = failNode
+			} else {
+				ac.nodes[child].output = ac.nodes[failNode].output
+			}
+			queue = append(queue, child)
+		}
+	}
+	return ac
+}
+
+// find returns the indexes of the literals that occur in text
+func (ac *ahoCorasick) find(text string) []int {
+	if len(ac.nodes) == 1 {
+		return nil
+	}
+	var found []int
+	seen := make(map[int32]bool)
+	node := int32(0)
+	for i := 0; i < len(text); i++ {
+		for {
+			if next, ok := ac.nodes[node].next[text[i]]; ok {
+				node = next
+				break
+			}
+			if node == 0 {
+				break
+			}
+			node = ac.nodes[node].fail
+		}
+		for match := node; match > 0; match = ac.nodes[match].output {
+			if literal := ac.nodes[match].literal; literal >= 0 {
+				if seen[literal] {
+					break
+				}
+				seen[literal] = true
+				found = append(found, int(literal))
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"regexp/syntax"
+	"sort"
+	"testing"
+
+	"scopeapi.local/backend/services/threat-detection/internal/models"
+	"scopeapi.local/backend/services/threat-detection/internal/repository"
+	"scopeapi.local/backend/shared/logging"
+)
+
+func TestRegexLiterals(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{`(?i)\bunion\b[\s\S]*?\bselect\b`, "[select]"},
+		{`(?i)(?:sleep|benchmark)\s*\(`, "[sleep benchmark]"},
+		{`<SCRIPT[^>]*>`, "[<script]"},
+		{`(?:etc|proc)/(?:passwd|self)`, "[passwd self]"},
+		{`(?:foo)?bar\d*`, "[bar]"},
+		{`(?:foo|.*)bar`, "[bar]"},
+		{`[a-z]+\d{3}`, "[]"},
+		{`café`, "[]"},
+	}
+	for _, tt := range tests {
+		if _, err := syntax.Parse(tt.pattern, syntax.Perl); err != nil {
+			t.Fatalf("parse %s: %v", tt.pattern, err)
+		}
+		if got := fmt.Sprint(ruleLiterals(models.SignatureRule{Operator: "regex", Value: tt.pattern})); got != tt.want {
+			t.Errorf("ruleLiterals(%s) = %s, want %s", tt.pattern, got, tt.want)
+		}
+	}
+
+	// Literals shorter than minPrefilterLiteral do not filter
+	if literals := ruleLiterals(models.SignatureRule{Operator: "regex", Value: `(?:ab|xyz)\d`}); literals != nil {
+		t.Errorf("short literals = %q", literals)
+	}
+	if literals := ruleLiterals(models.SignatureRule{Operator: "contains", Value: "SELECTſ"}); fmt.Sprint(literals) != "[selects]" {
+		t.Errorf("folded literal = %q", literals)
+	}
+}
+
+func TestAhoCorasick(t *testing.T) {
+	ac := newAhoCorasick([]string{"he", "she", "his", "hers", "x"})
+	found := ac.find("ushers")
+	sort.Ints(found)
+	if fmt.Sprint(found) != "[0 1 3]" {
+		t.Errorf("find(ushers) = %v", found)
+	}
+	if found := ac.find("nothing"); len(found) != 0 {
+		t.Errorf("find(nothing) = %v", found)
+	}
+}
+
+// generatedSignatures builds n signatures mixing every kind of rule the
+// engine indexes differently. Like real traffic, generated requests match few
+// of them.
+func generatedSignatures(n int) []*models.ThreatSignature {
+	random := rand.New(rand.NewSource(1))
+	signatures := make([]*models.ThreatSignature, n)
+	for i := range signatures {
+		word := fmt.Sprintf("tok%d", i)
+		var rules []models.SignatureRule
+		switch i % 8 {
+		case 0:
+			rules = []models.SignatureRule{{Field: "param_*", Operator: "contains", Value: word}}
+		case 1:
+			rules = []models.SignatureRule{{Field: "body", Targets: []string{"param_*"}, Operator: "regex",
+				Value: fmt.Sprintf(`(?i)\b%s\s*=\s*\d+`, word), Transforms: []string{"urlDecodeUni"}}}
+		case 2:
+			rules = []models.SignatureRule{{Field: "param_*", Operator: "pm",
+				Value: fmt.Sprintf("%s %sa %sb", word, word, word), Transforms: []string{"lowercase"}}}
+		case 3:
+			rules = []models.SignatureRule{{Field: "header_user-agent", Operator: "regex", Value: fmt.Sprintf(`^[a-z]{%d}\d$`, 3+random.Intn(40))}}
+		case 4:
+			rules = []models.SignatureRule{
+				{ID: "1", Field: "method", Operator: "equals", Value: "POST"},
+				{ID: "2", Field: "param_*", Operator: "contains", Value: word, Exclusions: []string{"param_safe"}},
+			}
+		case 5:
+			rules = []models.SignatureRule{{Field: "names:param_*", Operator: "starts_with", Value: word}}
+		case 6:
+			rules = []models.SignatureRule{{Field: "param_id", Operator: "regex", Value: fmt.Sprintf(`^%d$`, i), Negate: i%256 == 6}}
+		case 7:
+			rules = []models.SignatureRule{{Field: "param_n", Operator: "ge", Value: fmt.Sprint(995 + random.Intn(1000))}}
+		}
+		for j := range rules {
+			if rules[j].ID == "" {
+				rules[j].ID = "1"
+			}
+			rules[j].Weight = 1
+		}
+		signatures[i] = &models.ThreatSignature{
+			ID: fmt.Sprintf("sig-%05d", i), Name: word, SignatureSet: "generated", Enabled: true,
+			MatchAll: i%8 == 4, Rules: rules, AnomalyScore: i % 3,
+		}
+	}
+	return signatures
+}
+
+func generatedTraffic(random *rand.Rand, n int) map[string]interface{} {
+	word := func() string { return fmt.Sprintf("tok%d", random.Intn(n)) }
+	methods := []string{"GET", "POST"}
+	return map[string]interface{}{"request": map[string]interface{}{
+		"method": methods[random.Intn(2)],
+		"path":   "/api/items",
+		"headers": map[string]interface{}{
+			"User-Agent": fmt.Sprintf("abcdefgh%d", random.Intn(10)),
+		},
+		"body": fmt.Sprintf("%s%%20=%%20%d", word(), random.Intn(100)),
+		"parameters": map[string]interface{}{
+			"q":           "search " + word() + " " + word(),
+			"safe":        word(),
+			word() + "_x": "1",
+			"id":          fmt.Sprint(random.Intn(n)),
+			"n":           fmt.Sprint(random.Intn(1000)),
+		},
+	}}
+}
+
+func newGeneratedService(tb testing.TB, n int) *SignatureDetectionService {
+	tb.Helper()
+	repo := repository.NewMemoryThreatRepository()
+	for _, signature := range generatedSignatures(n) {
+		repo.CreateThreatSignature(context.Background(), signature)
+	}
+	service := NewSignatureDetectionService(repo, nil, logging.NewStructuredLogger("test"))
+	if err := service.LoadSignatures(context.Background(), "generated"); err != nil {
+		tb.Fatalf("LoadSignatures: %v", err)
+	}
+	return service
+}
+
+// fullScan checks every loaded signature, as detection did before the engine
+func fullScan(service *SignatureDetectionService, targets map[string]string) []string {
+	var matched []string
+	for id, signature := range service.signatures {
+		if match, err := service.checkSignature(signature, targets, &models.SignatureDetectionRequest{}); err == nil && match.Matched {
+			matched = append(matched, id)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+func TestSignatureEngineAgreesWithFullScan(t *testing.T) {
+	const n = 2000
+	service := newGeneratedService(t, n)
+	random := rand.New(rand.NewSource(2))
+
+	candidates := 0
+	for i := 0; i < 200; i++ {
+		traffic := generatedTraffic(random, n)
+		result, err := service.DetectSignatures(context.Background(), &models.SignatureDetectionRequest{TrafficData: traffic})
+		if err != nil {
+			t.Fatalf("DetectSignatures: %v", err)
+		}
+		want := fullScan(service, service.extractDetectionTargets(traffic))
+		if fmt.Sprint(result.MatchedSignatures) != fmt.Sprint(want) {
+			t.Fatalf("request %d matched %v, full scan %v", i, result.MatchedSignatures, want)
+		}
+		candidates += len(service.engine.Load().candidates(service.extractDetectionTargets(traffic)))
+	}
+	// Only signatures with a literal in the request, or whose rules the
+	// engine applied itself, remain
+	if average := candidates / 200; average > n/50 {
+		t.Errorf("engine checks %d of %d signatures per request", average, n)
+	}
+}
+
+func TestSignatureEngineRebuildsOnUpdate(t *testing.T) {
+	service := newGeneratedService(t, 16)
+	detect := func(q string) []string {
+		result, _ := service.DetectSignatures(context.Background(), &models.SignatureDetectionRequest{TrafficData: map[string]interface{}{
+			"request": map[string]interface{}{"parameters": map[string]interface{}{"q": q}},
+		}})
+		return result.MatchedSignatures
+	}
+	if got := fmt.Sprint(detect("tok8 and changed")); got != "[sig-00008]" {
+		t.Fatalf("before update = %s", got)
+	}
+
+	signature := *service.signatures["sig-00008"]
+	signature.Rules = []models.SignatureRule{{ID: "1", Field: "param_q", Operator: "regex", Value: `chang(?:ed|ing)`, Weight: 1}}
+	if err := service.UpdateSignature(context.Background(), signature.ID, &signature); err != nil {
+		t.Fatalf("UpdateSignature: %v", err)
+	}
+	if got := fmt.Sprint(detect("tok8 and changed")); got != "[sig-00008]" {
+		t.Errorf("after update = %s", got)
+	}
+	if got := fmt.Sprint(detect("tok8")); got != "[]" {
+		t.Errorf("old rule after update = %s", got)
+	}
+}
+
+func benchmarkDetection(b *testing.B, detect func(*SignatureDetectionService, map[string]interface{})) {
+	const n = 10000
+	service := newGeneratedService(b, n)
+	random := rand.New(rand.NewSource(3))
+	traffic := make([]map[string]interface{}, 256)
+	for i := range traffic {
+		traffic[i] = generatedTraffic(random, n)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		detect(service, traffic[i%len(traffic)])
+	}
+}
+
+// BenchmarkDetectSignatures10k reports per-request latency at 10,000 signatures
+func BenchmarkDetectSignatures10k(b *testing.B) {
+	benchmarkDetection(b, func(service *SignatureDetectionService, traffic map[string]interface{}) {
+		service.DetectSignatures(context.Background(), &models.SignatureDetectionRequest{TrafficData: traffic})
+	})
+}
+
+// BenchmarkFullScan10k is the same workload checking every signature
+func BenchmarkFullScan10k(b *testing.B) {
+	benchmarkDetection(b, func(service *SignatureDetectionService, traffic map[string]interface{}) {
+		fullScan(service, service.extractDetectionTargets(traffic))
+	})
+}
+
+// BenchmarkRebuildEngine10k measures the rebuild behind UpdateSignature and LoadSignatures
+func BenchmarkRebuildEngine10k(b *testing.B) {
+	service := newGeneratedService(b, 10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		service.mu.Lock()
+		service.rebuildEngine()
+		service.mu.Unlock()
+	}
+}
@@ -0,0 +1,542 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"scopeapi.local/backend/services/threat-detection/internal/models"
+)
+
+// ruleValue is a value a rule inspects and the field it came from
+type ruleValue struct {
+	field string
+	value string
+}
+
+// selectorPatterns caches the regular expressions of "prefix/regex/" selectors
+var selectorPatterns sync.Map
+
+// selectRuleValues returns the values of the fields a rule inspects, in field
+// order, leaving out excluded fields
+func selectRuleValues(rule models.SignatureRule, targets map[string]string) []ruleValue {
+	// A single field needs no lookup across fields
+	if len(rule.Targets) == 0 && !strings.HasPrefix(rule.Field, "names:") && !isPatternSelector(rule.Field) {
+		if value, ok := targets[rule.Field]; ok && !excludedField(rule.Exclusions, false, rule.Field) {
+			return []ruleValue{{field: rule.Field, value: value}}
+		}
+		return nil
+	}
+
+	selectors := append([]string{rule.Field}, rule.Targets...)
+
+	fields := make([]string, 0, len(targets))
+	for field := range targets {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var values []ruleValue
+	seen := make(map[string]bool)
+	for _, selector := range selectors {
+		names := strings.HasPrefix(selector, "names:")
+		for _, field := range fields {
+			prefix, ok := selectorMatches(selector, field)
+			if !ok || excludedField(rule.Exclusions, names, field) {
+				continue
+			}
+			value := targets[field]
+			if names {
+				value = strings.TrimPrefix(field, prefix)
+			}
+			key := fmt.Sprintf("%t %s", names, field)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			values = append(values, ruleValue{field: field, value: value})
+		}
+	}
+	return values
+}
+
+// selectorMatches reports whether a selector selects a field, and the field
+// name prefix the selector is scoped to
+func selectorMatches(selector, field string) (string, bool) {
+	selector = strings.TrimPrefix(selector, "names:")
+	if strings.HasSuffix(selector, "*") {
+		prefix := strings.TrimSuffix(selector, "*")
+		return prefix, strings.HasPrefix(field, prefix)
+	}
+	if start := strings.Index(selector, "/"); start >= 0 && len(selector) > start+1 && strings.HasSuffix(selector, "/") {
+		prefix := selector[:start]
+		if !strings.HasPrefix(field, prefix) {
+			return prefix, false
+		}
+		pattern := selector[start+1 : len(selector)-1]
+		compiled, ok := selectorPatterns.Load(pattern)
+		if !ok {
+			regex, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				return prefix, false
+			}
+			compiled, _ = selectorPatterns.LoadOrStore(pattern, regex)
+		}
+		return prefix, compiled.(*regexp.Regexp).MatchString(strings.TrimPrefix(field, prefix))
+	}
+	for _, prefix := range collectionPrefixes {
+		if strings.HasPrefix(selector, prefix) {
+			return prefix, field == selector
+		}
+	}
+	return "", field == selector
+}
+
+// collectionPrefixes are the prefixes of target fields that hold one value per
+// name, longest first
+var collectionPrefixes = []string{"response_header_", "header_", "cookie_", "param_"}
+
+func excludedField(exclusions []string, names bool, field string) bool {
+	for _, exclusion := range exclusions {
+		if strings.HasPrefix(exclusion, "names:") != names {
+			continue
+		}
+		if _, ok := selectorMatches(exclusion, field); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// signatureTransforms are the transformations rules can apply to values
+// before their operator, by lowercased SecLang name
+var signatureTransforms = map[string]func(string) string{
+	"lowercase":          strings.ToLower,
+	"uppercase":          strings.ToUpper,
+	"urldecode":          func(v string) string { return urlDecode(v, false) },
+	"urldecodeuni":       func(v string) string { return urlDecode(v, true) },
+	"htmlentitydecode":   html.UnescapeString,
+	"jsdecode":           decodeEscapes,
+	"escapeseqdecode":    decodeEscapes,
+	"cssdecode":          cssDecode,
+	"compresswhitespace": compressWhitespace,
+	"removewhitespace":   func(v string) string { return strings.Join(strings.Fields(v), "") },
+	"removenulls":        func(v string) string { return strings.ReplaceAll(v, "\x00", "") },
+	"replacenulls":       func(v string) string { return strings.ReplaceAll(v, "\x00", " ") },
+	"removecomments":     func(v string) string { return stripComments(v, "") },
+	"replacecomments":    func(v string) string { return stripComments(v, " ") },
+	"removecommentschar": removeCommentChars,
+	"normalisepath":      func(v string) string { return normalisePath(v, false) },
+	"normalizepath":      func(v string) string { return normalisePath(v, false) },
+	"normalisepathwin":   func(v string) string { return normalisePath(v, true) },
+	"normalizepathwin":   func(v string) string { return normalisePath(v, true) },
+	"base64decode":       func(v string) string { return base64Decode(v, false) },
+	"base64decodeext":    func(v string) string { return base64Decode(v, true) },
+	"hexdecode":          hexDecode,
+	"sqlhexdecode":       sqlHexDecode,
+	"trim":               strings.TrimSpace,
+	"trimleft":           func(v string) string { return strings.TrimLeft(v, " \t\n\r\f\v") },
+	"trimright":          func(v string) string { return strings.TrimRight(v, " \t\n\r\f\v") },
+	"utf8tounicode":      utf8ToUnicode,
+	"cmdline":            cmdLine,
+	"length":             func(v string) string { return strconv.Itoa(len(v)) },
+}
+
+// transformValue applies transformations in order and returns every
+// intermediate form when multiMatch is set, or only the final one
+func transformValue(value string, transforms []string, multiMatch bool) []string {
+	forms := []string{value}
+	for _, name := range transforms {
+		transform, ok := signatureTransforms[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		value = transform(value)
+		if multiMatch {
+			forms = append(forms, value)
+		} else {
+			forms[0] = value
+		}
+	}
+	return forms
+}
+
+func urlDecode(value string, unicode bool) string {
+	if !strings.ContainsAny(value, "%+") {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '+':
+			b.WriteByte(' ')
+		case c == '%' && unicode && i+5 < len(value) && (value[i+1] == 'u' || value[i+1] == 'U') && isHex(value[i+2:i+6]):
+			code, _ := strconv.ParseUint(value[i+2:i+6], 16, 32)
+			// Full-width ASCII decodes to ASCII, as in ModSecurity's default unicode map
+			if code >= 0xff01 && code <= 0xff5e {
+				code -= 0xfee0
+			}
+			b.WriteRune(rune(code))
+			i += 5
+		case c == '%' && i+2 < len(value) && isHex(value[i+1:i+3]):
+			decoded, _ := strconv.ParseUint(value[i+1:i+3], 16, 8)
+			b.WriteByte(byte(decoded))
+			i += 2
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isHex(value string) bool {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return value != ""
+}
+
+// decodeEscapes decodes JavaScript and C escape sequences: \n, \xHH, \uHHHH and octal
+func decodeEscapes(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	simple := map[byte]byte{'a': '\a', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v'}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 >= len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		next := value[i+1]
+		switch {
+		case (next == 'x' || next == 'X') && i+3 < len(value) && isHex(value[i+2:i+4]):
+			decoded, _ := strconv.ParseUint(value[i+2:i+4], 16, 8)
+			b.WriteByte(byte(decoded))
+			i += 3
+		case (next == 'u' || next == 'U') && i+5 < len(value) && isHex(value[i+2:i+6]):
+			code, _ := strconv.ParseUint(value[i+2:i+6], 16, 32)
+			if code >= 0xff01 && code <= 0xff5e {
+				code -= 0xfee0
+			}
+			b.WriteRune(rune(code))
+			i += 5
+		case next >= '0' && next <= '7':
+			end := i + 2
+			for end < len(value) && end < i+4 && value[end] >= '0' && value[end] <= '7' {
+				end++
+			}
+			decoded, _ := strconv.ParseUint(value[i+1:end], 8, 16)
+			b.WriteByte(byte(decoded))
+			i = end - 1
+		case simple[next] != 0:
+			b.WriteByte(simple[next])
+			i++
+		default:
+			b.WriteByte(next)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// cssDecode decodes CSS escapes: a backslash followed by up to six hex digits
+// and an optional space, or by any other character
+func cssDecode(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 >= len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		end := i + 1
+		for end < len(value) && end < i+7 && isHex(value[end:end+1]) {
+			end++
+		}
+		if end == i+1 {
+			if value[end] != '\n' {
+				b.WriteByte(value[end])
+			}
+			i = end
+			continue
+		}
+		code, _ := strconv.ParseUint(value[i+1:end], 16, 32)
+		if code >= 0xff01 && code <= 0xff5e {
+			code -= 0xfee0
+		}
+		b.WriteRune(rune(code))
+		if end < len(value) && value[end] == ' ' {
+			end++
+		}
+		i = end - 1
+	}
+	return b.String()
+}
+
+func compressWhitespace(value string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range value {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' || r == '\v' || r == 0xa0 {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// stripComments removes C, HTML and SQL comments, putting replacement in place
+// of each; an unterminated comment runs to the end of the value
+func stripComments(value, replacement string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); {
+		rest := value[i:]
+		var end int
+		switch {
+		case strings.HasPrefix(rest, "/*"):
+			end = strings.Index(rest[2:], "*/")
+			end = commentEnd(rest, end, 2, 2)
+		case strings.HasPrefix(rest, "<!--"):
+			end = strings.Index(rest[4:], "-->")
+			end = commentEnd(rest, end, 4, 3)
+		case replacement == "" && (strings.HasPrefix(rest, "--") || rest[0] == '#'):
+			end = strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+		default:
+			b.WriteByte(value[i])
+			i++
+			continue
+		}
+		b.WriteString(replacement)
+		i += end
+	}
+	return b.String()
+}
+
+func commentEnd(rest string, index, open, close int) int {
+	if index < 0 {
+		return len(rest)
+	}
+	return open + index + close
+}
+
+func removeCommentChars(value string) string {
+	return strings.NewReplacer("/*", "", "*/", "", "<!--", "", "-->", "", "--", "", "#", "").Replace(value)
+}
+
+// normalisePath removes self references, back references and repeated slashes
+func normalisePath(value string, windows bool) string {
+	if windows {
+		value = strings.ReplaceAll(value, `\`, "/")
+	}
+	absolute := strings.HasPrefix(value, "/")
+	trailing := strings.HasSuffix(value, "/")
+
+	var segments []string
+	for _, segment := range strings.Split(value, "/") {
+		switch segment {
+		case "", ".":
+		case "..":
+			if len(segments) > 0 && segments[len(segments)-1] != ".." {
+				segments = segments[:len(segments)-1]
+			} else if !absolute {
+				segments = append(segments, segment)
+			}
+		default:
+			segments = append(segments, segment)
+		}
+	}
+
+	normalised := strings.Join(segments, "/")
+	if absolute {
+		normalised = "/" + normalised
+	}
+	if trailing && !strings.HasSuffix(normalised, "/") {
+		normalised += "/"
+	}
+	return normalised
+}
+
+// base64Decode decodes standard base64 with or without padding; forgiving
+// decoding skips characters outside the alphabet first
+func base64Decode(value string, forgiving bool) string {
+	if forgiving {
+		value = strings.Map(func(r rune) rune {
+			if r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '+' || r == '/' {
+				return r
+			}
+			return -1
+		}, value)
+	}
+	decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return value
+	}
+	return string(decoded)
+}
+
+func hexDecode(value string) string {
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		return value
+	}
+	return string(decoded)
+}
+
+var sqlHexLiteral = regexp.MustCompile(`(?i)0x((?:[0-9a-f]{2})+)`)
+
+// sqlHexDecode decodes SQL hex literals such as 0x414243
+func sqlHexDecode(value string) string {
+	return sqlHexLiteral.ReplaceAllStringFunc(value, func(literal string) string {
+		decoded, err := hex.DecodeString(literal[2:])
+		if err != nil {
+			return literal
+		}
+		return string(decoded)
+	})
+}
+
+// utf8ToUnicode writes non-ASCII characters as %uHHHH
+func utf8ToUnicode(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+			continue
+		}
+		fmt.Fprintf(&b, "%%u%04x", r)
+	}
+	return b.String()
+}
+
+// cmdLine normalises a shell command line: escapes and quotes are removed,
+// separators become spaces and the result is lowercased
+func cmdLine(value string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch c {
+		case '\\', '"', '\'', '^':
+			continue
+		case ' ', '\t', '\n', '\r', ',', ';':
+			space = true
+			continue
+		case '/', '(':
+			space = false
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(c)
+	}
+	return strings.ToLower(b.String())
+}
+
+// Heuristics behind the detect_sqli and detect_xss operators
+var (
+	sqliHeuristic = regexp.MustCompile(`(?i)(\bunion\b.*\bselect\b|\bselect\b.+\bfrom\b|\binsert\s+into\b|\bdelete\s+from\b|\bdrop\s+(table|database)\b|\bupdate\b.+\bset\b|['"\d]\s*\b(or|and|xor)\b\s*['"\d(]|['"]\s*(=|<|>|like\b)|;\s*(drop|shutdown|exec|select|declare)\b|\b(sleep|benchmark|pg_sleep)\s*\(|\bwaitfor\s+delay\b|['"\d]\s*(--|#|/\*))`)
+	xssHeuristic  = regexp.MustCompile(`(?i)(<\s*script\b|<[^>]*\s(on\w+)\s*=|javascript\s*:|vbscript\s*:|<\s*(iframe|object|embed|svg|math|base|link|meta)\b|\bsrcdoc\s*=|\bexpression\s*\(|data\s*:\s*text/html)`)
+)
+
+// inByteRange reports whether every byte of value falls within ranges such as
+// "9,10,13,32-126"
+func inByteRange(value, ranges string) bool {
+	var allowed [256]bool
+	for _, part := range strings.Split(ranges, ",") {
+		low, high, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := strconv.Atoi(strings.TrimSpace(low))
+		if err != nil {
+			continue
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(strings.TrimSpace(high)); err != nil {
+				continue
+			}
+		}
+		for b := from; b <= to && b < 256; b++ {
+			if b >= 0 {
+				allowed[b] = true
+			}
+		}
+	}
+	for i := 0; i < len(value); i++ {
+		if !allowed[value[i]] {
+			return false
+		}
+	}
+	return true
+}
+
+// invalidURLEncoding reports a % not followed by two hex digits
+func invalidURLEncoding(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] == '%' && (i+2 >= len(value) || !isHex(value[i+1:i+3])) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipMatches reports whether an address falls within comma or space separated
+// addresses and CIDR ranges
+func ipMatches(address, ranges string) bool {
+	ip := net.ParseIP(strings.TrimSpace(address))
+	if ip == nil {
+		return false
+	}
+	for _, entry := range strings.FieldsFunc(ranges, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if other := net.ParseIP(entry); other != nil && other.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesPhrase reports whether value contains any of the phrases, ignoring
+// case. Phrases are separated by newlines when there are any, as in phrase
+// files, and by spaces otherwise.
+func matchesPhrase(value, phrases string) (string, bool) {
+	lowered := strings.ToLower(value)
+	list := strings.Fields(phrases)
+	if strings.Contains(phrases, "\n") {
+		list = strings.Split(phrases, "\n")
+	}
+	for _, phrase := range list {
+		if phrase == "" {
+			continue
+		}
+		if strings.Contains(lowered, strings.ToLower(phrase)) {
+			return phrase, true
+		}
+	}
+	return "", false
+}
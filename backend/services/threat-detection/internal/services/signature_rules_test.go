@@ -0,0 +1,33 @@
+package services
+
+import "testing"
+
+func TestSignatureTransforms(t *testing.T) {
+	tests := []struct {
+		transforms []string
+		value      string
+		want       string
+	}{
+		{[]string{"urlDecodeUni", "lowercase"}, "%55NION+%uff33elect", "union select"},
+		{[]string{"htmlEntityDecode"}, "&lt;script&gt;", "<script>"},
+		{[]string{"jsDecode"}, `\x3cscript>`, "<script>"},
+		{[]string{"cssDecode"}, `\6a avascript`, "javascript"},
+		{[]string{"replaceComments", "compressWhitespace"}, "union/**/select /* x", "union select "},
+		{[]string{"removeComments"}, "1-- comment\nor 1=1", "1\nor 1=1"},
+		{[]string{"normalisePathWin"}, `..\a\.\b\..\c//d/`, "../a/c/d/"},
+		{[]string{"base64DecodeExt"}, "PHNj.cmlwdD4", "<script>"},
+		{[]string{"sqlHexDecode"}, "select 0x61646d696e", "select admin"},
+		{[]string{"cmdLine"}, `C^A"T  /etc/passwd;ls`, "cat/etc/passwd ls"},
+		{[]string{"utf8toUnicode"}, "é", "%u00e9"},
+		{[]string{"length"}, "abcd", "4"},
+	}
+	for _, tt := range tests {
+		if got := transformValue(tt.value, tt.transforms, false)[0]; got != tt.want {
+			t.Errorf("%v(%q) = %q, want %q", tt.transforms, tt.value, got, tt.want)
+		}
+	}
+
+	if forms := transformValue("%2541", []string{"urlDecode", "urlDecode"}, true); len(forms) != 3 || forms[2] != "A" {
+		t.Errorf("multiMatch forms = %q", forms)
+	}
+}
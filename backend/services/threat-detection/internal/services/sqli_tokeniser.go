@@ -0,0 +1,336 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// SQL token kinds, one character each so a token stream reads as a fingerprint
+const (
+	sqlString    = 's'
+	sqlBareword  = 'n'
+	sqlNumber    = '1'
+	sqlVariable  = 'v'
+	sqlOperator  = 'o'
+	sqlLogic     = '&'
+	sqlFunction  = 'f'
+	sqlStatement = 'E'
+	sqlUnion     = 'U'
+	sqlGroupBy   = 'B'
+	sqlTSQL      = 'T'
+	sqlKeyword   = 'k'
+	sqlComment   = 'c'
+	sqlOpen      = '('
+	sqlClose     = ')'
+	sqlComma     = ','
+	sqlSemi      = ';'
+
+	// sqlArith is an arithmetic operator, folded away between two operands
+	sqlArith = 'a'
+)
+
+// sqlFingerprintLength is how many folded tokens a fingerprint keeps
+const sqlFingerprintLength = 5
+
+var sqlWords = map[string]byte{
+	"and": sqlLogic, "or": sqlLogic, "xor": sqlLogic,
+	"like": sqlOperator, "rlike": sqlOperator, "regexp": sqlOperator, "sounds": sqlOperator,
+	"is": sqlOperator, "in": sqlOperator, "not": sqlOperator, "between": sqlOperator,
+	"div": sqlOperator, "mod": sqlOperator,
+	"select": sqlStatement, "insert": sqlStatement, "update": sqlStatement, "delete": sqlStatement,
+	"drop": sqlStatement, "create": sqlStatement, "alter": sqlStatement, "truncate": sqlStatement,
+	"exec": sqlStatement, "execute": sqlStatement, "grant": sqlStatement, "revoke": sqlStatement,
+	"rename": sqlStatement, "union": sqlUnion,
+	"waitfor": sqlTSQL, "shutdown": sqlTSQL, "declare": sqlTSQL,
+	"from": sqlKeyword, "where": sqlKeyword, "having": sqlKeyword, "limit": sqlKeyword,
+	"offset": sqlKeyword, "into": sqlKeyword, "outfile": sqlKeyword, "dumpfile": sqlKeyword,
+	"values": sqlKeyword, "table": sqlKeyword, "all": sqlKeyword, "distinct": sqlKeyword,
+	"top": sqlKeyword, "case": sqlKeyword, "when": sqlKeyword, "then": sqlKeyword,
+	"else": sqlKeyword, "end": sqlKeyword, "delay": sqlKeyword, "procedure": sqlKeyword,
+	"collate": sqlKeyword,
+}
+
+// sqlFunctions are barewords read as function calls when followed by "("
+var sqlFunctions = map[string]bool{
+	"sleep": true, "benchmark": true, "pg_sleep": true, "randomblob": true,
+	"char": true, "chr": true, "concat": true, "concat_ws": true, "group_concat": true,
+	"substring": true, "substr": true, "mid": true, "ascii": true, "ord": true,
+	"hex": true, "unhex": true, "load_file": true, "version": true, "user": true,
+	"database": true, "schema": true, "current_user": true, "system_user": true,
+	"session_user": true, "extractvalue": true, "updatexml": true, "if": true,
+	"ifnull": true, "count": true, "cast": true, "convert": true, "length": true,
+	"md5": true, "sha1": true, "rand": true, "floor": true, "name_const": true,
+	"exp": true, "json_extract": true, "sqlite_version": true, "xp_cmdshell": true,
+	"dbms_pipe.receive_message": true, "utl_inaddr.get_host_address": true,
+	"utl_http.request": true, "dbms_lock.sleep": true,
+}
+
+// sqlShape is a fingerprint pattern typical of one kind of injection
+type sqlShape struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// sqlShapes are anchored at the start of the fingerprint. Shapes starting with
+// "s" describe a value that closes the string literal it was placed in; the
+// others a value placed where SQL expects a number.
+var sqlShapes = []sqlShape{
+	{"boolean", regexp.MustCompile(`^s\)*&\(*(?:[s1v]|f\(|no|E)`)},
+	{"boolean", regexp.MustCompile(`^1\)*&\(*(?:[1sv]o|f\(|E)`)},
+	{"union", regexp.MustCompile(`^[s1nv]?\)*U[k(]*E`)},
+	{"stacked_query", regexp.MustCompile(`^[s1v]\)*;[ET]`)},
+	{"time_based", regexp.MustCompile(`^[s1v]\)*T`)},
+	{"subquery", regexp.MustCompile(`^[s1]\)*o\(+E`)},
+	{"function_call", regexp.MustCompile(`^s\)*o\(*f\(`)},
+	{"order_by", regexp.MustCompile(`^[s1]\)*B1`)},
+	{"comment_truncation", regexp.MustCompile(`^s\)*c$`)},
+}
+
+// sqlContexts are the places a value can be interpolated into a query:
+// bare, or inside a single or double quoted string literal
+var sqlContexts = []struct {
+	name  string
+	quote byte
+}{
+	{"as_is", 0},
+	{"single_quote", '\''},
+	{"double_quote", '"'},
+}
+
+// sqlInjectionMatch is an injection shape found in a value
+type sqlInjectionMatch struct {
+	context     string
+	fingerprint string
+	shape       string
+}
+
+// detectSQLInjectionShape tokenises value in each SQL context and reports the
+// first fingerprint that has a known injection shape
+func detectSQLInjectionShape(value string) (sqlInjectionMatch, bool) {
+	for _, context := range sqlContexts {
+		if context.quote != 0 && strings.IndexByte(value, context.quote) < 0 {
+			continue
+		}
+		fingerprint := sqlFingerprint(value, context.quote)
+		for _, shape := range sqlShapes {
+			if shape.pattern.MatchString(fingerprint) {
+				return sqlInjectionMatch{context: context.name, fingerprint: fingerprint, shape: shape.name}, true
+			}
+		}
+	}
+	return sqlInjectionMatch{}, false
+}
+
+// sqlFingerprint tokenises value as SQL and returns the kinds of its first
+// folded tokens. With a quote, value is read as continuing a string literal
+// opened by that quote.
+func sqlFingerprint(value string, quote byte) string {
+	lexer := &sqlLexer{input: value}
+	if quote != 0 {
+		lexer.pos = lexer.stringEnd(0, quote)
+		lexer.emit(sqlString, "")
+	}
+	for lexer.pos < len(lexer.input) && len(lexer.tokens) <= sqlFingerprintLength {
+		lexer.next()
+	}
+	if lexer.comment && len(lexer.tokens) < sqlFingerprintLength {
+		lexer.tokens = append(lexer.tokens, sqlToken{kind: sqlComment})
+	}
+
+	var b strings.Builder
+	for i, token := range lexer.tokens {
+		if i == sqlFingerprintLength {
+			break
+		}
+		if token.kind == sqlArith {
+			token.kind = sqlOperator
+		}
+		b.WriteByte(token.kind)
+	}
+	return b.String()
+}
+
+type sqlToken struct {
+	kind  byte
+	value string
+}
+
+// sqlLexer folds tokens as it emits them: comments are dropped unless they
+// end the input, adjacent strings join, leading parentheses and unary
+// operators are skipped and arithmetic between operands collapses
+type sqlLexer struct {
+	input   string
+	pos     int
+	tokens  []sqlToken
+	comment bool
+}
+
+func (l *sqlLexer) next() {
+	c := l.input[l.pos]
+	rest := l.input[l.pos:]
+	switch {
+	case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v' || c == 0xa0:
+		l.pos++
+	case strings.HasPrefix(rest, "/*"):
+		end := strings.Index(rest[2:], "*/")
+		if end < 0 {
+			l.pos = len(l.input)
+		} else {
+			l.pos += end + 4
+		}
+		l.comment = true
+	case strings.HasPrefix(rest, "--") || c == '#':
+		end := strings.IndexByte(rest, '\n')
+		if end < 0 {
+			l.pos = len(l.input)
+		} else {
+			l.pos += end + 1
+		}
+		l.comment = true
+	case c == '\'' || c == '"':
+		end := l.stringEnd(l.pos+1, c)
+		l.emit(sqlString, l.input[l.pos:end])
+		l.pos = end
+	case c == '`':
+		end := strings.IndexByte(rest[1:], '`')
+		if end < 0 {
+			end = len(rest)
+		} else {
+			end += 2
+		}
+		l.emit(sqlBareword, rest[:end])
+		l.pos += end
+	case c >= '0' && c <= '9' || c == '.' && len(rest) > 1 && rest[1] >= '0' && rest[1] <= '9':
+		end := 1
+		for end < len(rest) && (isWordByte(rest[end]) || rest[end] == '.') {
+			end++
+		}
+		l.emit(sqlNumber, rest[:end])
+		l.pos += end
+	case c == '@':
+		end := 1
+		for end < len(rest) && (isWordByte(rest[end]) || rest[end] == '@') {
+			end++
+		}
+		l.emit(sqlVariable, rest[:end])
+		l.pos += end
+	case isWordByte(c) || c >= 0x80:
+		l.word()
+	case c == '(' || c == ')' || c == ',' || c == ';':
+		l.emit(c, rest[:1])
+		l.pos++
+	default:
+		l.operator()
+	}
+}
+
+// stringEnd returns the index after the literal closed by quote, honouring
+// doubled quotes and backslash escapes; an unterminated literal runs to the end
+func (l *sqlLexer) stringEnd(start int, quote byte) int {
+	for i := start; i < len(l.input); i++ {
+		switch l.input[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(l.input) && l.input[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(l.input)
+}
+
+func (l *sqlLexer) word() {
+	end := l.pos
+	for end < len(l.input) && (isWordByte(l.input[end]) || l.input[end] == '.' || l.input[end] >= 0x80) {
+		end++
+	}
+	word := strings.ToLower(l.input[l.pos:end])
+	l.pos = end
+
+	if word == "by" && len(l.tokens) > 0 {
+		if last := &l.tokens[len(l.tokens)-1]; last.value == "order" || last.value == "group" {
+			last.kind = sqlGroupBy
+			return
+		}
+	}
+	if sqlFunctions[word] && l.followedByParen() {
+		l.emit(sqlFunction, word)
+		return
+	}
+	if kind, ok := sqlWords[word]; ok {
+		l.emit(kind, word)
+		return
+	}
+	l.emit(sqlBareword, word)
+}
+
+// followedByParen reports whether the next token is "(", skipping whitespace
+// and block comments as MySQL does
+func (l *sqlLexer) followedByParen() bool {
+	rest := strings.TrimLeft(l.input[l.pos:], " \t\n\r\f\v")
+	for strings.HasPrefix(rest, "/*") {
+		end := strings.Index(rest, "*/")
+		if end < 0 {
+			return false
+		}
+		rest = strings.TrimLeft(rest[end+2:], " \t\n\r\f\v")
+	}
+	return strings.HasPrefix(rest, "(")
+}
+
+func (l *sqlLexer) operator() {
+	rest := l.input[l.pos:]
+	for _, op := range []string{"<=>", "&&", "||", "<=", ">=", "<>", "!=", ":="} {
+		if strings.HasPrefix(rest, op) {
+			kind := byte(sqlOperator)
+			if op == "&&" || op == "||" {
+				kind = sqlLogic
+			}
+			l.emit(kind, op)
+			l.pos += len(op)
+			return
+		}
+	}
+	l.pos++
+	switch rest[0] {
+	case '=', '<', '>', '|', '&', '^', '~', '!':
+		l.emit(sqlOperator, rest[:1])
+	case '+', '-', '*', '/', '%':
+		l.emit(sqlArith, rest[:1])
+	}
+	// Anything else, such as braces or backslashes, is not SQL and is skipped
+}
+
+func (l *sqlLexer) emit(kind byte, value string) {
+	// A comment followed by more tokens only separated them
+	l.comment = false
+
+	var last byte
+	if len(l.tokens) > 0 {
+		last = l.tokens[len(l.tokens)-1].kind
+	}
+	unary := kind == sqlArith && (value == "+" || value == "-") || kind == sqlOperator && (value == "!" || value == "~")
+	switch {
+	case kind == sqlString && last == sqlString:
+		return
+	case len(l.tokens) == 0 && kind == sqlOpen:
+		return
+	case unary && (last == 0 || last == sqlOperator || last == sqlLogic || last == sqlArith || last == sqlOpen || last == sqlComma):
+		return
+	case isSQLOperand(kind) && last == sqlArith && len(l.tokens) > 1 && isSQLOperand(l.tokens[len(l.tokens)-2].kind):
+		l.tokens = l.tokens[:len(l.tokens)-1]
+		return
+	}
+	l.tokens = append(l.tokens, sqlToken{kind: kind, value: value})
+}
+
+func isSQLOperand(kind byte) bool {
+	return kind == sqlString || kind == sqlNumber || kind == sqlBareword || kind == sqlVariable
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$'
+}
@@ -71,6 +71,11 @@ type ThreatDetectionServiceInterface interface {
 	UpdateMLModel(ctx context.Context, modelID string, newData []byte) error
 	GetMLModelMetrics(ctx context.Context, modelID string) (*MLModel, error)
 	PredictThreat(ctx context.Context, traffic map[string]interface{}) (*MLPrediction, error)
+
+	// Injection detector selection
+	GetInjectionDetectors(ctx context.Context) (*models.InjectionDetectorReport, error)
+	SetInjectionDetector(ctx context.Context, endpointID, detector string) error
+	ResetInjectionDetector(ctx context.Context, endpointID string) error
 }
 
 type ThreatDetectionService struct {
@@ -81,6 +86,8 @@ type ThreatDetectionService struct {
 	anomalyDetector    *MLAnomalyDetector
 	behavioralAnalyzer *MLBehavioralAnalyzer
 	mlModels           map[string]*MLModel
+	injectionDetectors *injectionDetectors
+	incidentCorrelator IncidentCorrelator
 }
 
 func NewThreatDetectionService(
@@ -99,9 +106,15 @@ func NewThreatDetectionService(
 		anomalyDetector:    NewMLAnomalyDetector(logger, mlModels),
 		behavioralAnalyzer: NewMLBehavioralAnalyzer(logger, mlModels),
 		mlModels:           mlModels,
+		injectionDetectors: newInjectionDetectors(),
 	}
 }
 
+// SetIncidentCorrelator has analysed traffic's threats grouped into incidents
+func (s *ThreatDetectionService) SetIncidentCorrelator(correlator IncidentCorrelator) {
+	s.incidentCorrelator = correlator
+}
+
 // initializeMLModels sets up default ML models
 func initializeMLModels() map[string]*MLModel {
 	models := make(map[string]*MLModel)
@@ -190,7 +203,7 @@ func (s *ThreatDetectionService) AnalyzeTraffic(ctx context.Context, trafficData
 	threats := []models.Threat{}
 
 	// 1. SQL Injection Detection
-	sqlInjectionThreats, err := s.detectSQLInjection(ctx, traffic)
+	sqlInjectionThreats, err := s.detectInjection(ctx, traffic, "sql_injection", s.detectSQLInjection, s.detectLexicalSQLInjection)
 	if err != nil {
 		s.logger.Error("SQL injection detection failed", "error", err)
 	} else {
@@ -198,7 +211,7 @@ func (s *ThreatDetectionService) AnalyzeTraffic(ctx context.Context, trafficData
 	}
 
 	// 2. XSS Detection
-	xssThreats, err := s.detectXSS(ctx, traffic)
+	xssThreats, err := s.detectInjection(ctx, traffic, "xss", s.detectXSS, s.detectLexicalXSS)
 	if err != nil {
 		s.logger.Error("XSS detection failed", "error", err)
 	} else {
@@ -303,6 +316,19 @@ func (s *ThreatDetectionService) AnalyzeTraffic(ctx context.Context, trafficData
 			}
 		}
 
+		// Group threats into incidents with earlier threats from the same actor
+		if s.incidentCorrelator != nil {
+			incidents, err := s.incidentCorrelator.CorrelateThreats(ctx, threats)
+			if err != nil {
+				s.logger.Error("Failed to correlate threats", "error", err)
+			}
+			incidentIDs := make([]string, 0, len(incidents))
+			for _, incident := range incidents {
+				incidentIDs = append(incidentIDs, incident.ID)
+			}
+			result.Metadata["incident_ids"] = incidentIDs
+		}
+
 		// Generate recommendations
 		result.Recommendations = s.generateRecommendations(threats)
 
@@ -347,7 +373,7 @@ func (s *ThreatDetectionService) detectSQLInjection(ctx context.Context, traffic
 	// Check URL parameters
 	if params, ok := requestData["parameters"].(map[string]interface{}); ok {
 		for key, value := range params {
-			if s.containsSQLInjectionPattern(fmt.Sprintf("%v", value), sqlPatterns) {
+			if match, ok := s.containsSQLInjectionPattern(fmt.Sprintf("%v", value), sqlPatterns); ok {
 				threat := models.Threat{
 					ID:              uuid.New().String(),
 					Type:            "sql_injection",
@@ -365,6 +391,7 @@ func (s *ThreatDetectionService) detectSQLInjection(ctx context.Context, traffic
 							Description: "Suspicious SQL pattern detected",
 							Severity:    "high",
 							Confidence:  0.85,
+							Context:     locatedContext(match.context(), "parameter", key),
 						},
 					},
 					RequestData: requestData,
@@ -401,7 +428,7 @@ func (s *ThreatDetectionService) detectSQLInjection(ctx context.Context, traffic
 
 	// Check request body
 	if body, ok := requestData["body"].(string); ok {
-		if s.containsSQLInjectionPattern(body, sqlPatterns) {
+		if match, ok := s.containsSQLInjectionPattern(body, sqlPatterns); ok {
 			threat := models.Threat{
 				ID:              uuid.New().String(),
 				Type:            "sql_injection",
@@ -419,6 +446,7 @@ func (s *ThreatDetectionService) detectSQLInjection(ctx context.Context, traffic
 						Description: "Suspicious SQL pattern detected in request body",
 						Severity:    "high",
 						Confidence:  0.80,
+						Context:     locatedContext(match.context(), "body", ""),
 					},
 				},
 				RequestData: requestData,
@@ -442,7 +470,7 @@ func (s *ThreatDetectionService) detectSQLInjection(ctx context.Context, traffic
 	// Check headers for suspicious content
 	if headers, ok := requestData["headers"].(map[string]interface{}); ok {
 		for headerName, headerValue := range headers {
-			if s.containsSQLInjectionPattern(fmt.Sprintf("%v", headerValue), sqlPatterns) {
+			if match, ok := s.containsSQLInjectionPattern(fmt.Sprintf("%v", headerValue), sqlPatterns); ok {
 				threat := models.Threat{
 					ID:              uuid.New().String(),
 					Type:            "sql_injection",
@@ -460,6 +488,7 @@ func (s *ThreatDetectionService) detectSQLInjection(ctx context.Context, traffic
 							Description: fmt.Sprintf("Suspicious SQL pattern detected in header '%s'", headerName),
 							Severity:    "medium",
 							Confidence:  0.75,
+							Context:     locatedContext(match.context(), "header", headerName),
 						},
 					},
 					RequestData: requestData,
@@ -478,14 +507,8 @@ func (s *ThreatDetectionService) detectSQLInjection(ctx context.Context, traffic
 	return threats, nil
 }
 
-func (s *ThreatDetectionService) containsSQLInjectionPattern(input string, patterns []string) bool {
-	inputLower := strings.ToLower(input)
-	for _, pattern := range patterns {
-		if strings.Contains(inputLower, pattern) {
-			return true
-		}
-	}
-	return false
+func (s *ThreatDetectionService) containsSQLInjectionPattern(input string, patterns []string) (canonicalMatch, bool) {
+	return matchCanonical(input, patterns)
 }
 
 func (s *ThreatDetectionService) detectXSS(ctx context.Context, traffic map[string]interface{}) ([]models.Threat, error) {
@@ -513,7 +536,7 @@ func (s *ThreatDetectionService) detectXSS(ctx context.Context, traffic map[stri
 	// Check URL parameters
 	if params, ok := requestData["parameters"].(map[string]interface{}); ok {
 		for key, value := range params {
-			if s.containsXSSPattern(fmt.Sprintf("%v", value), xssPatterns) {
+			if match, ok := s.containsXSSPattern(fmt.Sprintf("%v", value), xssPatterns); ok {
 				threat := models.Threat{
 					ID:              uuid.New().String(),
 					Type:            "xss",
@@ -531,6 +554,7 @@ func (s *ThreatDetectionService) detectXSS(ctx context.Context, traffic map[stri
 							Description: "Suspicious XSS pattern detected",
 							Severity:    "high",
 							Confidence:  0.90,
+							Context:     locatedContext(match.context(), "parameter", key),
 						},
 					},
 					RequestData: requestData,
@@ -563,7 +587,7 @@ func (s *ThreatDetectionService) detectXSS(ctx context.Context, traffic map[stri
 
 	// Check request body
 	if body, ok := requestData["body"].(string); ok {
-		if s.containsXSSPattern(body, xssPatterns) {
+		if match, ok := s.containsXSSPattern(body, xssPatterns); ok {
 			threat := models.Threat{
 				ID:              uuid.New().String(),
 				Type:            "xss",
@@ -581,6 +605,7 @@ func (s *ThreatDetectionService) detectXSS(ctx context.Context, traffic map[stri
 						Description: "XSS pattern detected in request body",
 						Severity:    "high",
 						Confidence:  0.85,
+						Context:     locatedContext(match.context(), "body", ""),
 					},
 				},
 				RequestData: requestData,
@@ -604,7 +629,7 @@ func (s *ThreatDetectionService) detectXSS(ctx context.Context, traffic map[stri
 	// Check headers for suspicious content
 	if headers, ok := requestData["headers"].(map[string]interface{}); ok {
 		for headerName, headerValue := range headers {
-			if s.containsXSSPattern(fmt.Sprintf("%v", headerValue), xssPatterns) {
+			if match, ok := s.containsXSSPattern(fmt.Sprintf("%v", headerValue), xssPatterns); ok {
 				threat := models.Threat{
 					ID:              uuid.New().String(),
 					Type:            "xss",
@@ -622,6 +647,7 @@ func (s *ThreatDetectionService) detectXSS(ctx context.Context, traffic map[stri
 							Description: fmt.Sprintf("XSS pattern detected in header '%s'", headerName),
 							Severity:    "medium",
 							Confidence:  0.80,
+							Context:     locatedContext(match.context(), "header", headerName),
 						},
 					},
 					RequestData: requestData,
@@ -640,14 +666,8 @@ func (s *ThreatDetectionService) detectXSS(ctx context.Context, traffic map[stri
 	return threats, nil
 }
 
-func (s *ThreatDetectionService) containsXSSPattern(input string, patterns []string) bool {
-	inputLower := strings.ToLower(input)
-	for _, pattern := range patterns {
-		if strings.Contains(inputLower, strings.ToLower(pattern)) {
-			return true
-		}
-	}
-	return false
+func (s *ThreatDetectionService) containsXSSPattern(input string, patterns []string) (canonicalMatch, bool) {
+	return matchCanonical(input, patterns)
 }
 
 func (s *ThreatDetectionService) detectDDoS(ctx context.Context, traffic map[string]interface{}) ([]models.Threat, error) {
@@ -1096,22 +1116,13 @@ func (s *ThreatDetectionService) detectPathTraversal(ctx context.Context, traffi
 		return threats, nil
 	}
 
-	// Path traversal patterns to detect
-	pathTraversalPatterns := []string{
-		"../", "..\\", "..%2f", "..%5c", "..%2F", "..%5C",
-		"....//", "....\\\\", "....%2f", "....%5c",
-		"%2e%2e%2f", "%2e%2e%5c", "%2e%2e%2F", "%2e%2e%5C",
-		"..%252f", "..%255c", "..%252F", "..%255C",
-		"..%c0%af", "..%c1%9c", "..%c0%AF", "..%c1%9C",
-		"..%255c", "..%255C", "..%c1%9c", "..%c1%9C",
-		"..%c0%af", "..%c0%AF", "..%c1%9c", "..%c1%9C",
-		"..%c0%af", "..%c0%AF", "..%c1%9c", "..%c1%9C",
-		"..%c0%af", "..%c0%AF", "..%c1%9c", "..%c1%9C",
-	}
+	// Path traversal patterns to detect. Encoded forms such as %2e%2e%2f,
+	// ..%252f and ..%c0%af are decoded before matching.
+	pathTraversalPatterns := []string{"../", "..\\"}
 
 	// Check URL path
 	if path, ok := requestData["path"].(string); ok {
-		if s.containsPathTraversalPattern(path, pathTraversalPatterns) {
+		if match, ok := s.containsPathTraversalPattern(path, pathTraversalPatterns); ok {
 			threat := models.Threat{
 				ID:              uuid.New().String(),
 				Type:            "path_traversal",
@@ -1129,6 +1140,7 @@ func (s *ThreatDetectionService) detectPathTraversal(ctx context.Context, traffi
 						Description: "Path traversal pattern detected in URL",
 						Severity:    "high",
 						Confidence:  0.95,
+						Context:     match.context(),
 					},
 				},
 				RequestData: requestData,
@@ -1161,7 +1173,7 @@ func (s *ThreatDetectionService) detectPathTraversal(ctx context.Context, traffi
 	// Check URL parameters for path traversal
 	if params, ok := requestData["parameters"].(map[string]interface{}); ok {
 		for key, value := range params {
-			if s.containsPathTraversalPattern(fmt.Sprintf("%v", value), pathTraversalPatterns) {
+			if match, ok := s.containsPathTraversalPattern(fmt.Sprintf("%v", value), pathTraversalPatterns); ok {
 				threat := models.Threat{
 					ID:              uuid.New().String(),
 					Type:            "path_traversal",
@@ -1179,6 +1191,7 @@ func (s *ThreatDetectionService) detectPathTraversal(ctx context.Context, traffi
 							Description: fmt.Sprintf("Path traversal pattern detected in parameter '%s'", key),
 							Severity:    "high",
 							Confidence:  0.90,
+							Context:     match.context(),
 						},
 					},
 					RequestData: requestData,
@@ -1212,14 +1225,8 @@ func (s *ThreatDetectionService) detectPathTraversal(ctx context.Context, traffi
 	return threats, nil
 }
 
-func (s *ThreatDetectionService) containsPathTraversalPattern(input string, patterns []string) bool {
-	inputLower := strings.ToLower(input)
-	for _, pattern := range patterns {
-		if strings.Contains(inputLower, strings.ToLower(pattern)) {
-			return true
-		}
-	}
-	return false
+func (s *ThreatDetectionService) containsPathTraversalPattern(input string, patterns []string) (canonicalMatch, bool) {
+	return matchCanonical(input, patterns)
 }
 
 // detectCommandInjection detects command injection attacks
@@ -1250,7 +1257,7 @@ func (s *ThreatDetectionService) detectCommandInjection(ctx context.Context, tra
 	// Check URL parameters
 	if params, ok := requestData["parameters"].(map[string]interface{}); ok {
 		for key, value := range params {
-			if s.containsCommandInjectionPattern(fmt.Sprintf("%v", value), commandInjectionPatterns) {
+			if match, ok := s.containsCommandInjectionPattern(fmt.Sprintf("%v", value), commandInjectionPatterns); ok {
 				threat := models.Threat{
 					ID:              uuid.New().String(),
 					Type:            "command_injection",
@@ -1268,6 +1275,7 @@ func (s *ThreatDetectionService) detectCommandInjection(ctx context.Context, tra
 							Description: "Suspicious command injection pattern detected",
 							Severity:    "critical",
 							Confidence:  0.95,
+							Context:     match.context(),
 						},
 					},
 					RequestData: requestData,
@@ -1300,7 +1308,7 @@ func (s *ThreatDetectionService) detectCommandInjection(ctx context.Context, tra
 
 	// Check request body
 	if body, ok := requestData["body"].(string); ok {
-		if s.containsCommandInjectionPattern(body, commandInjectionPatterns) {
+		if match, ok := s.containsCommandInjectionPattern(body, commandInjectionPatterns); ok {
 			threat := models.Threat{
 				ID:              uuid.New().String(),
 				Type:            "command_injection",
@@ -1318,6 +1326,7 @@ func (s *ThreatDetectionService) detectCommandInjection(ctx context.Context, tra
 						Description: "Command injection pattern detected in request body",
 						Severity:    "critical",
 						Confidence:  0.90,
+						Context:     match.context(),
 					},
 				},
 				RequestData: requestData,
@@ -1341,14 +1350,8 @@ func (s *ThreatDetectionService) detectCommandInjection(ctx context.Context, tra
 	return threats, nil
 }
 
-func (s *ThreatDetectionService) containsCommandInjectionPattern(input string, patterns []string) bool {
-	inputLower := strings.ToLower(input)
-	for _, pattern := range patterns {
-		if strings.Contains(inputLower, strings.ToLower(pattern)) {
-			return true
-		}
-	}
-	return false
+func (s *ThreatDetectionService) containsCommandInjectionPattern(input string, patterns []string) (canonicalMatch, bool) {
+	return matchCanonical(input, patterns)
 }
 
 // detectMLAnomalies uses ML models to detect anomalies
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"html"
+	"strings"
+)
+
+// HTML token kinds
+const (
+	htmlTagOpen   = 't'
+	htmlAttrValue = 'v'
+	htmlComment   = 'c'
+	htmlPI        = '?'
+)
+
+type htmlToken struct {
+	kind  byte
+	value string
+	// attr names the attribute of an htmlAttrValue
+	attr string
+}
+
+// String renders the token as it appeared in the markup
+func (t htmlToken) String() string {
+	switch t.kind {
+	case htmlTagOpen:
+		return "<" + t.value
+	case htmlAttrValue:
+		return t.attr + "=" + t.value
+	case htmlComment:
+		return "<!--" + t.value
+	}
+	return "<?" + t.value
+}
+
+// htmlContexts are the places a value can be reflected into a page: as text,
+// or as the value of an attribute, unquoted or in quotes. In an attribute
+// context the value is read as finishing that attribute first.
+var htmlContexts = []struct {
+	name  string
+	quote byte
+	inTag bool
+}{
+	{"html_data", 0, false},
+	{"attribute_double_quote", '"', true},
+	{"attribute_single_quote", '\'', true},
+	{"attribute_backquote", '`', true},
+	{"attribute_unquoted", 0, true},
+}
+
+// jsContexts are JavaScript string literals a value can be reflected into
+var jsContexts = []struct {
+	name  string
+	quote byte
+}{
+	{"js_single_quote", '\''},
+	{"js_double_quote", '"'},
+}
+
+var xssTags = map[string]bool{
+	"script": true, "iframe": true, "frame": true, "frameset": true, "object": true,
+	"embed": true, "applet": true, "svg": true, "math": true, "base": true, "link": true,
+	"meta": true, "style": true, "xml": true, "import": true, "isindex": true,
+	"vmlframe": true, "xss": true, "portal": true,
+}
+
+var xssEventHandlers = map[string]bool{
+	"onabort": true, "onafterprint": true, "onanimationend": true, "onanimationiteration": true,
+	"onanimationstart": true, "onauxclick": true, "onbeforecopy": true, "onbeforecut": true,
+	"onbeforeprint": true, "onbeforeunload": true, "onbegin": true, "onblur": true,
+	"oncanplay": true, "oncanplaythrough": true, "onchange": true, "onclick": true,
+	"oncontextmenu": true, "oncopy": true, "oncut": true, "ondblclick": true, "ondrag": true,
+	"ondragend": true, "ondragenter": true, "ondragleave": true, "ondragover": true,
+	"ondragstart": true, "ondrop": true, "ondurationchange": true, "onend": true,
+	"onended": true, "onerror": true, "onfinish": true, "onfocus": true, "onfocusin": true,
+	"onfocusout": true, "onformdata": true, "onhashchange": true, "oninput": true,
+	"oninvalid": true, "onkeydown": true, "onkeypress": true, "onkeyup": true, "onload": true,
+	"onloadeddata": true, "onloadedmetadata": true, "onloadend": true, "onloadstart": true,
+	"onmessage": true, "onmousedown": true, "onmouseenter": true, "onmouseleave": true,
+	"onmousemove": true, "onmouseout": true, "onmouseover": true, "onmouseup": true,
+	"onmousewheel": true, "onpageshow": true, "onpaste": true, "onpause": true, "onplay": true,
+	"onplaying": true, "onpointerdown": true, "onpointerenter": true, "onpointerleave": true,
+	"onpointermove": true, "onpointerout": true, "onpointerover": true, "onpointerup": true,
+	"onpopstate": true, "onprogress": true, "onrepeat": true, "onreset": true, "onresize": true,
+	"onscroll": true, "onscrollend": true, "onsearch": true, "onseeked": true, "onseeking": true,
+	"onselect": true, "onselectionchange": true, "onselectstart": true, "onshow": true,
+	"onstart": true, "onsubmit": true, "ontimeupdate": true, "ontoggle": true,
+	"ontouchend": true, "ontouchmove": true, "ontouchstart": true, "ontransitionend": true,
+	"onunload": true, "onvolumechange": true, "onwheel": true,
+}
+
+// xssURLAttributes hold URLs a browser navigates to or loads, so a script
+// scheme in them runs
+var xssURLAttributes = map[string]bool{
+	"href": true, "src": true, "action": true, "formaction": true, "data": true,
+	"xlink:href": true, "background": true, "dynsrc": true, "lowsrc": true, "poster": true,
+	"codebase": true, "from": true, "to": true, "values": true,
+}
+
+var xssSchemes = []string{"javascript:", "vbscript:", "livescript:", "mocha:", "data:text/html", "data:image/svg"}
+
+// jsCallSinks run code or navigate when called; jsAssignSinks when assigned
+var (
+	jsCallSinks = map[string]bool{
+		"alert": true, "confirm": true, "prompt": true, "eval": true, "function": true,
+		"settimeout": true, "setinterval": true, "execscript": true, "fetch": true,
+		"import": true, "document.write": true, "document.writeln": true, "window.open": true,
+		"location.assign": true, "location.replace": true,
+	}
+	jsAssignSinks = map[string]bool{
+		"location": true, "location.href": true, "document.location": true,
+		"window.location": true, "document.cookie": true, "document.domain": true,
+	}
+)
+
+// xssMatch is an injection shape found in a value
+type xssMatch struct {
+	context string
+	token   string
+	shape   string
+}
+
+// detectXSSShape tokenises value in each HTML and JavaScript context and
+// reports the first token a browser would run as script
+func detectXSSShape(value string) (xssMatch, bool) {
+	for _, context := range htmlContexts {
+		if context.inTag && context.quote != 0 && strings.IndexByte(value, context.quote) < 0 {
+			continue
+		}
+		for _, token := range tokeniseHTML(value, context.quote, context.inTag) {
+			if shape, ok := xssShape(token); ok {
+				return xssMatch{context: context.name, token: token.String(), shape: shape}, true
+			}
+		}
+	}
+	for _, context := range jsContexts {
+		if sink, ok := jsBreakout(value, context.quote); ok {
+			return xssMatch{context: context.name, token: "sink:" + sink, shape: "js_breakout"}, true
+		}
+	}
+	return xssMatch{}, false
+}
+
+func xssShape(token htmlToken) (string, bool) {
+	switch token.kind {
+	case htmlTagOpen:
+		return "dangerous_tag", xssTags[token.value]
+	case htmlAttrValue:
+		// Attributes are judged by their values, so prose that happens to
+		// contain a word like "onclick" is not a handler
+		if xssEventHandlers[token.attr] {
+			return "event_handler", true
+		}
+		if token.attr == "srcdoc" {
+			return "dangerous_attribute", true
+		}
+		if xssURLAttributes[token.attr] {
+			url := scriptURL(token.value)
+			for _, scheme := range xssSchemes {
+				if strings.HasPrefix(url, scheme) {
+					return "script_url", true
+				}
+			}
+		}
+		if token.attr == "style" {
+			style := scriptURL(token.value)
+			for _, marker := range []string{"expression(", "javascript:", "behavior:", "-moz-binding"} {
+				if strings.Contains(style, marker) {
+					return "style_expression", true
+				}
+			}
+		}
+	case htmlComment:
+		return "conditional_comment", strings.HasPrefix(token.value, "[if") || strings.Contains(token.value, "<![endif")
+	case htmlPI:
+		return "processing_instruction", strings.HasPrefix(token.value, "xml") || strings.HasPrefix(token.value, "import")
+	}
+	return "", false
+}
+
+// scriptURL decodes entities and drops the whitespace and control characters
+// browsers ignore in a URL scheme, so "jav&#x09;ascript:" reads "javascript:"
+func scriptURL(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(html.UnescapeString(value)))
+}
+
+// tokeniseHTML splits value into the tags, attributes and comments an HTML5
+// parser would see. With inTag set, value first finishes an attribute value
+// delimited by quote, or unquoted when quote is 0.
+func tokeniseHTML(value string, quote byte, inTag bool) []htmlToken {
+	var tokens []htmlToken
+	pos := 0
+	if inTag {
+		pos = attributeValueEnd(value, 0, quote)
+		if pos < len(value) && quote != 0 {
+			pos++
+		}
+		tokens, pos = tokeniseAttributes(value, pos, tokens)
+	}
+	for pos < len(value) {
+		open := strings.IndexByte(value[pos:], '<')
+		if open < 0 {
+			break
+		}
+		pos += open + 1
+		rest := value[pos:]
+		switch {
+		case strings.HasPrefix(rest, "!--"):
+			end := strings.Index(rest[3:], "-->")
+			if end < 0 {
+				end = len(rest) - 3
+			}
+			tokens = append(tokens, htmlToken{kind: htmlComment, value: strings.ToLower(rest[3 : 3+end])})
+			pos += 3 + end
+		case strings.HasPrefix(rest, "?"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				end = len(rest)
+			}
+			tokens = append(tokens, htmlToken{kind: htmlPI, value: strings.ToLower(rest[1:end])})
+			pos += end
+		case rest != "" && isASCIILetter(rest[0]):
+			end := 0
+			for end < len(rest) && !isHTMLSpace(rest[end]) && rest[end] != '/' && rest[end] != '>' {
+				end++
+			}
+			name := strings.ToLower(strings.ReplaceAll(rest[:end], "\x00", ""))
+			tokens = append(tokens, htmlToken{kind: htmlTagOpen, value: name})
+			tokens, pos = tokeniseAttributes(value, pos+end, tokens)
+		}
+	}
+	return tokens
+}
+
+// tokeniseAttributes reads attributes from pos to the end of the tag
+func tokeniseAttributes(value string, pos int, tokens []htmlToken) ([]htmlToken, int) {
+	for pos < len(value) {
+		c := value[pos]
+		if isHTMLSpace(c) || c == '/' {
+			pos++
+			continue
+		}
+		if c == '>' {
+			return tokens, pos + 1
+		}
+
+		end := pos + 1
+		for end < len(value) && !isHTMLSpace(value[end]) && value[end] != '=' && value[end] != '>' && value[end] != '/' {
+			end++
+		}
+		name := strings.ToLower(strings.ReplaceAll(value[pos:end], "\x00", ""))
+		pos = skipHTMLSpace(value, end)
+		if pos >= len(value) || value[pos] != '=' {
+			continue
+		}
+
+		pos = skipHTMLSpace(value, pos+1)
+		var quote byte
+		if pos < len(value) && (value[pos] == '"' || value[pos] == '\'' || value[pos] == '`') {
+			quote = value[pos]
+			pos++
+		}
+		end = attributeValueEnd(value, pos, quote)
+		tokens = append(tokens, htmlToken{kind: htmlAttrValue, value: value[pos:end], attr: name})
+		pos = end
+		if quote != 0 && pos < len(value) {
+			pos++
+		}
+	}
+	return tokens, pos
+}
+
+// attributeValueEnd returns the index of the quote closing a value, or of the
+// space or ">" ending an unquoted one
+func attributeValueEnd(value string, pos int, quote byte) int {
+	for ; pos < len(value); pos++ {
+		c := value[pos]
+		if quote != 0 && c == quote || quote == 0 && (isHTMLSpace(c) || c == '>') {
+			return pos
+		}
+	}
+	return len(value)
+}
+
+func skipHTMLSpace(value string, pos int) int {
+	for pos < len(value) && isHTMLSpace(value[pos]) {
+		pos++
+	}
+	return pos
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// jsBreakout reads value as finishing a JavaScript string delimited by quote
+// and reports the sink called or assigned by the code after it, as in
+// "';alert(1)//" or "\"-confirm`1`-\""
+func jsBreakout(value string, quote byte) (string, bool) {
+	pos := strings.IndexByte(value, quote)
+	for pos > 0 && value[pos-1] == '\\' {
+		next := strings.IndexByte(value[pos+1:], quote)
+		if next < 0 {
+			return "", false
+		}
+		pos += next + 1
+	}
+	if pos < 0 {
+		return "", false
+	}
+
+	// The string must be followed by an operator or separator to end the expression
+	separated := false
+	for pos++; pos < len(value); pos++ {
+		c := value[pos]
+		switch {
+		case isHTMLSpace(c):
+		case strings.HasPrefix(value[pos:], "//") || strings.HasPrefix(value[pos:], "/*"):
+			return "", false
+		case strings.IndexByte(";,+-*/%|&^!~?:<>=)]}", c) >= 0:
+			separated = true
+		case c == '(' && separated:
+		default:
+			if !separated {
+				return "", false
+			}
+			return jsSink(value[pos:])
+		}
+	}
+	return "", false
+}
+
+// jsSink reports whether code starts by calling or assigning a sink
+func jsSink(code string) (string, bool) {
+	end := 0
+	for end < len(code) && (isWordByte(code[end]) || code[end] == '.') {
+		end++
+	}
+	name := strings.ToLower(code[:end])
+	rest := strings.TrimLeft(code[end:], " \t\n\r\f")
+	switch {
+	case jsCallSinks[name] && (strings.HasPrefix(rest, "(") || strings.HasPrefix(rest, "`")):
+		return name, true
+	case jsAssignSinks[name] && strings.HasPrefix(rest, "=") && !strings.HasPrefix(rest, "=="):
+		return name, true
+	}
+	return "", false
+}
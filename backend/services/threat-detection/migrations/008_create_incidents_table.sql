@@ -0,0 +1,86 @@
+-- Migration: Create incidents table
+-- Description: Creates the incidents table for threats correlated into multi-request attacks, and the incident_threats table linking them
+-- Version: 008
+-- Date: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS incidents (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    title VARCHAR(500) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'investigating', 'contained', 'resolved', 'closed', 'false_positive', 'merged')),
+    severity VARCHAR(20) NOT NULL CHECK (severity IN ('info', 'low', 'medium', 'high', 'critical')),
+    threat_severity VARCHAR(20) CHECK (threat_severity IN ('info', 'low', 'medium', 'high', 'critical')),
+    
+    -- Kill-chain progress
+    stage VARCHAR(20) NOT NULL CHECK (stage IN ('recon', 'probing', 'exploitation', 'exfiltration')),
+    stages TEXT[] NOT NULL DEFAULT '{}',
+    stage_first_seen JSONB NOT NULL DEFAULT '{}',
+    
+    -- Correlation attributes
+    correlation_keys TEXT[] NOT NULL DEFAULT '{}',
+    source_ips TEXT[] NOT NULL DEFAULT '{}',
+    user_ids TEXT[] NOT NULL DEFAULT '{}',
+    session_ids TEXT[] NOT NULL DEFAULT '{}',
+    api_ids TEXT[] NOT NULL DEFAULT '{}',
+    endpoint_ids TEXT[] NOT NULL DEFAULT '{}',
+    
+    -- Threat summary
+    threat_count INTEGER NOT NULL DEFAULT 0 CHECK (threat_count >= 0),
+    threat_types JSONB NOT NULL DEFAULT '{}',
+    risk_score DECIMAL(5,2) NOT NULL DEFAULT 0,
+    first_seen TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_seen TIMESTAMP WITH TIME ZONE NOT NULL,
+    
+    -- Lifecycle
+    assignee VARCHAR(255),
+    merged_into UUID REFERENCES incidents(id),
+    timeline JSONB NOT NULL DEFAULT '[]',
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    
+    -- Metadata
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    
+    -- Constraints
+    CONSTRAINT incidents_seen_check CHECK (first_seen <= last_seen),
+    CONSTRAINT incidents_merged_check CHECK ((status = 'merged') = (merged_into IS NOT NULL))
+);
+
+CREATE TABLE IF NOT EXISTS incident_threats (
+    incident_id UUID NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    -- Not a foreign key, as threats are not yet stored in the threats table
+    threat_id UUID NOT NULL,
+    stage VARCHAR(20) NOT NULL CHECK (stage IN ('recon', 'probing', 'exploitation', 'exfiltration')),
+    added_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    
+    PRIMARY KEY (incident_id, threat_id)
+);
+
+-- Create indexes for better query performance
+CREATE INDEX IF NOT EXISTS idx_incidents_status ON incidents(status);
+CREATE INDEX IF NOT EXISTS idx_incidents_severity ON incidents(severity);
+CREATE INDEX IF NOT EXISTS idx_incidents_stage ON incidents(stage);
+CREATE INDEX IF NOT EXISTS idx_incidents_last_seen ON incidents(last_seen);
+CREATE INDEX IF NOT EXISTS idx_incidents_correlation_keys ON incidents USING GIN(correlation_keys);
+CREATE INDEX IF NOT EXISTS idx_incidents_source_ips ON incidents USING GIN(source_ips);
+CREATE INDEX IF NOT EXISTS idx_incidents_user_ids ON incidents USING GIN(user_ids);
+CREATE INDEX IF NOT EXISTS idx_incidents_api_ids ON incidents USING GIN(api_ids);
+CREATE INDEX IF NOT EXISTS idx_incident_threats_threat_id ON incident_threats(threat_id);
+
+-- Create composite indexes for common queries
+CREATE INDEX IF NOT EXISTS idx_incidents_active ON incidents(last_seen) WHERE status IN ('open', 'investigating', 'contained');
+CREATE INDEX IF NOT EXISTS idx_incidents_status_severity ON incidents(status, severity);
+
+-- Add comments for documentation
+COMMENT ON TABLE incidents IS 'Stores incidents grouping the threats of one actor within the correlation window';
+COMMENT ON COLUMN incidents.id IS 'Unique identifier for the incident';
+COMMENT ON COLUMN incidents.status IS 'Lifecycle status of the incident';
+COMMENT ON COLUMN incidents.severity IS 'Severity after escalation';
+COMMENT ON COLUMN incidents.threat_severity IS 'Highest severity of the grouped threats';
+COMMENT ON COLUMN incidents.stage IS 'Furthest kill-chain stage reached';
+COMMENT ON COLUMN incidents.stages IS 'Kill-chain stages seen, in the order first seen';
+COMMENT ON COLUMN incidents.stage_first_seen IS 'Time of the earliest threat at each kill-chain stage';
+COMMENT ON COLUMN incidents.correlation_keys IS 'Keys such as ip:203.0.113.7 that new threats are matched against';
+COMMENT ON COLUMN incidents.threat_types IS 'Number of grouped threats by threat type';
+COMMENT ON COLUMN incidents.merged_into IS 'Incident this one was merged into';
+COMMENT ON COLUMN incidents.timeline IS 'Stage changes, escalations, merges, status changes and notes';
+COMMENT ON TABLE incident_threats IS 'Links incidents to the threats grouped into them';
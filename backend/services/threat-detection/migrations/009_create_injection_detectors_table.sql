@@ -0,0 +1,15 @@
+-- Migration: Create injection detectors table
+-- Description: Creates the injection_detectors table storing the SQL injection and XSS detector selected per endpoint
+-- Version: 009
+-- Date: 2026-10-16
+
+CREATE TABLE IF NOT EXISTS injection_detectors (
+    endpoint_id VARCHAR(255) PRIMARY KEY,
+    detector VARCHAR(20) NOT NULL CHECK (detector IN ('keyword', 'lexical', 'both')),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Add comments for documentation
+COMMENT ON TABLE injection_detectors IS 'Stores the injection detectors selected through the API, which take precedence over the configured ones';
+COMMENT ON COLUMN injection_detectors.endpoint_id IS 'Endpoint the detector is selected for; empty for the default detector';
+COMMENT ON COLUMN injection_detectors.detector IS 'keyword, lexical or both';
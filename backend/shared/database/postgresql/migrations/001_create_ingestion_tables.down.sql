@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS ingestion_stats_minute;
+DROP TABLE IF EXISTS ingestion_batches;
+DROP TABLE IF EXISTS ingestion_jobs;
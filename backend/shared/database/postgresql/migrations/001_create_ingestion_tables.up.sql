@@ -0,0 +1,54 @@
+-- Migration: Create ingestion tables
+-- Description: Persists data-ingestion jobs, their published batches and per-minute stats rollups
+
+CREATE TABLE IF NOT EXISTS ingestion_jobs (
+    id UUID PRIMARY KEY,
+    kind VARCHAR(20) NOT NULL,
+    status VARCHAR(30) NOT NULL,
+    progress DOUBLE PRECISION NOT NULL DEFAULT 0,
+    total_items INTEGER NOT NULL DEFAULT 0,
+    processed_items INTEGER NOT NULL DEFAULT 0,
+    failed_items INTEGER NOT NULL DEFAULT 0,
+    filtered_items INTEGER NOT NULL DEFAULT 0,
+    errors JSONB NOT NULL DEFAULT '[]',
+    metadata JSONB,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ended_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ingestion_jobs_started_at ON ingestion_jobs (started_at);
+CREATE INDEX IF NOT EXISTS idx_ingestion_jobs_status ON ingestion_jobs (status);
+
+CREATE TABLE IF NOT EXISTS ingestion_batches (
+    id UUID PRIMARY KEY,
+    job_id UUID NOT NULL REFERENCES ingestion_jobs (id) ON DELETE CASCADE,
+    batch_id VARCHAR(255) NOT NULL,
+    record_count INTEGER NOT NULL DEFAULT 0,
+    published_count INTEGER NOT NULL DEFAULT 0,
+    filtered_count INTEGER NOT NULL DEFAULT 0,
+    failed_count INTEGER NOT NULL DEFAULT 0,
+    status VARCHAR(30) NOT NULL,
+    error TEXT,
+    topic VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_ingestion_batches_job_id ON ingestion_batches (job_id);
+CREATE INDEX IF NOT EXISTS idx_ingestion_batches_batch_id ON ingestion_batches (batch_id);
+
+-- Counters are added to on conflict so several instances can share a minute
+CREATE TABLE IF NOT EXISTS ingestion_stats_minute (
+    minute TIMESTAMP WITH TIME ZONE PRIMARY KEY,
+    ingested BIGINT NOT NULL DEFAULT 0,
+    succeeded BIGINT NOT NULL DEFAULT 0,
+    errors BIGINT NOT NULL DEFAULT 0,
+    sampled_out BIGINT NOT NULL DEFAULT 0,
+    deduplicated BIGINT NOT NULL DEFAULT 0,
+    truncated BIGINT NOT NULL DEFAULT 0,
+    redacted BIGINT NOT NULL DEFAULT 0,
+    processing_time_us BIGINT NOT NULL DEFAULT 0,
+    max_processing_time_us BIGINT NOT NULL DEFAULT 0,
+    last_ingestion TIMESTAMP WITH TIME ZONE,
+    last_error TIMESTAMP WITH TIME ZONE
+);
@@ -11,9 +11,12 @@ import (
 	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// defaultMigrationsTable records applied migrations unless a service picks its own
+const defaultMigrationsTable = "schema_migrations"
+
 // Migration represents a database migration
 type Migration struct {
 	Version   int
@@ -27,6 +30,7 @@ type Migration struct {
 type Migrator struct {
 	db     *sql.DB
 	config Config
+	table  string
 }
 
 // NewMigrator creates a new migration manager
@@ -39,9 +43,17 @@ func NewMigrator(config Config) (*Migrator, error) {
 	return &Migrator{
 		db:     db,
 		config: config,
+		table:  defaultMigrationsTable,
 	}, nil
 }
 
+// WithTable records applied migrations in table instead of schema_migrations, so
+// services sharing a database keep separate migration histories
+func (m *Migrator) WithTable(table string) *Migrator {
+	m.table = table
+	return m
+}
+
 // Close closes the database connection
 func (m *Migrator) Close() error {
 	return m.db.Close()
@@ -49,20 +61,20 @@ func (m *Migrator) Close() error {
 
 // Init creates the migrations table if it doesn't exist
 func (m *Migrator) Init() error {
-	query := `
-		CREATE TABLE IF NOT EXISTS schema_migrations (
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
 			version INTEGER PRIMARY KEY,
 			name VARCHAR(255) NOT NULL,
 			applied_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 		);
-	`
+	`, pq.QuoteIdentifier(m.table))
 	_, err := m.db.Exec(query)
 	return err
 }
 
 // GetAppliedMigrations returns all applied migrations
 func (m *Migrator) GetAppliedMigrations() ([]Migration, error) {
-	query := `SELECT version, name, applied_at FROM schema_migrations ORDER BY version`
+	query := fmt.Sprintf(`SELECT version, name, applied_at FROM %s ORDER BY version`, pq.QuoteIdentifier(m.table))
 	rows, err := m.db.Query(query)
 	if err != nil {
 		return nil, err
@@ -189,7 +201,7 @@ func (m *Migrator) Migrate(migrationsDir string) error {
 			}
 
 			// Record migration as applied
-			_, err = tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", 
+			_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s (version, name) VALUES ($1, $2)", pq.QuoteIdentifier(m.table)),
 				migration.Version, migration.Name)
 			if err != nil {
 				tx.Rollback()
@@ -248,7 +260,7 @@ func (m *Migrator) Rollback() error {
 	}
 
 	// Remove migration record
-	_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = $1", lastMigration.Version)
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE version = $1", pq.QuoteIdentifier(m.table)), lastMigration.Version)
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to remove migration record %d: %w", lastMigration.Version, err)
@@ -0,0 +1,661 @@
+// Package graphql parses executable GraphQL documents into JSON-friendly ASTs
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaxDepth bounds nesting so hostile documents cannot exhaust the stack
+	MaxDepth  = 64
+	MaxTokens = 100000
+)
+
+// Options control how a document's values are rendered
+type Options struct {
+	// EnumValue renders an enum value. Enum values become their name when
+	// it is nil, the same as a string.
+	EnumValue func(name string) interface{}
+}
+
+// EnumObject renders an enum value as {"enum": name}, so it can be told
+// apart from a string
+func EnumObject(name string) interface{} {
+	return map[string]interface{}{"enum": name}
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type lexToken struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+// ParseDocument parses an executable GraphQL document into a JSON-friendly
+// AST of operations and fragments. Type system definitions are rejected.
+func ParseDocument(query string, options Options) (map[string]interface{}, error) {
+	tokens, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, enumValue: options.EnumValue}
+
+	operations := []interface{}{}
+	fragments := []interface{}{}
+	for !p.at(tokenEOF, "") {
+		switch {
+		case p.at(tokenPunct, "{"):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, map[string]interface{}{
+				"operation":  "query",
+				"selections": selections,
+			})
+		case p.at(tokenName, "query") || p.at(tokenName, "mutation") || p.at(tokenName, "subscription"):
+			operation, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			operations = append(operations, operation)
+		case p.at(tokenName, "fragment"):
+			fragment, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			fragments = append(fragments, fragment)
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(operations) == 0 {
+		return nil, fmt.Errorf("graphql document has no operations")
+	}
+
+	return map[string]interface{}{
+		"operations": operations,
+		"fragments":  fragments,
+	}, nil
+}
+
+// SelectOperation returns the operation that would execute: the one named
+// operationName, or the only one in the document
+func SelectOperation(document map[string]interface{}, operationName string) (map[string]interface{}, error) {
+	operations, _ := document["operations"].([]interface{})
+	if operationName == "" {
+		if len(operations) != 1 {
+			return nil, fmt.Errorf("operation name is required for documents with %d operations", len(operations))
+		}
+		return operations[0].(map[string]interface{}), nil
+	}
+	for _, candidate := range operations {
+		operation := candidate.(map[string]interface{})
+		if operation["name"] == operationName {
+			return operation, nil
+		}
+	}
+	return nil, fmt.Errorf("operation %q not found in document", operationName)
+}
+
+type parser struct {
+	tokens    []lexToken
+	pos       int
+	depth     int
+	enumValue func(name string) interface{}
+}
+
+func (p *parser) peek() lexToken {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) at(kind tokenKind, value string) bool {
+	token := p.tokens[p.pos]
+	return token.kind == kind && (value == "" || token.value == value)
+}
+
+func (p *parser) next() lexToken {
+	token := p.tokens[p.pos]
+	if token.kind != tokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *parser) expect(kind tokenKind, value string) (lexToken, error) {
+	if !p.at(kind, value) {
+		return lexToken{}, p.unexpected()
+	}
+	return p.next(), nil
+}
+
+func (p *parser) unexpected() error {
+	token := p.peek()
+	if token.kind == tokenEOF {
+		return fmt.Errorf("graphql syntax error: unexpected end of document")
+	}
+	return fmt.Errorf("graphql syntax error at offset %d: unexpected %q", token.pos, token.value)
+}
+
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > MaxDepth {
+		return fmt.Errorf("graphql document exceeds maximum depth of %d", MaxDepth)
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+func (p *parser) operation() (map[string]interface{}, error) {
+	operation := map[string]interface{}{"operation": p.next().value}
+	if p.at(tokenName, "") {
+		operation["name"] = p.next().value
+	}
+
+	if p.at(tokenPunct, "(") {
+		p.next()
+		definitions := []interface{}{}
+		for !p.at(tokenPunct, ")") {
+			definition, err := p.variableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			definitions = append(definitions, definition)
+		}
+		p.next()
+		operation["variable_definitions"] = definitions
+	}
+
+	directives, err := p.directives()
+	if err != nil {
+		return nil, err
+	}
+	if len(directives) > 0 {
+		operation["directives"] = directives
+	}
+
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	operation["selections"] = selections
+	return operation, nil
+}
+
+func (p *parser) variableDefinition() (map[string]interface{}, error) {
+	if _, err := p.expect(tokenPunct, "$"); err != nil {
+		return nil, err
+	}
+	name, err := p.expect(tokenName, "")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenPunct, ":"); err != nil {
+		return nil, err
+	}
+	typeRef, err := p.typeRef()
+	if err != nil {
+		return nil, err
+	}
+
+	definition := map[string]interface{}{"name": name.value, "type": typeRef}
+	if p.at(tokenPunct, "=") {
+		p.next()
+		value, err := p.value(true)
+		if err != nil {
+			return nil, err
+		}
+		definition["default"] = value
+	}
+	directives, err := p.directives()
+	if err != nil {
+		return nil, err
+	}
+	if len(directives) > 0 {
+		definition["directives"] = directives
+	}
+	return definition, nil
+}
+
+// typeRef returns a type reference in SDL notation, such as "[ID!]!"
+func (p *parser) typeRef() (string, error) {
+	if err := p.enter(); err != nil {
+		return "", err
+	}
+	defer p.leave()
+
+	var typeRef string
+	if p.at(tokenPunct, "[") {
+		p.next()
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if _, err := p.expect(tokenPunct, "]"); err != nil {
+			return "", err
+		}
+		typeRef = "[" + inner + "]"
+	} else {
+		name, err := p.expect(tokenName, "")
+		if err != nil {
+			return "", err
+		}
+		typeRef = name.value
+	}
+	if p.at(tokenPunct, "!") {
+		p.next()
+		typeRef += "!"
+	}
+	return typeRef, nil
+}
+
+func (p *parser) fragment() (map[string]interface{}, error) {
+	p.next()
+	name, err := p.expect(tokenName, "")
+	if err != nil {
+		return nil, err
+	}
+	if name.value == "on" {
+		return nil, fmt.Errorf("graphql syntax error at offset %d: fragment cannot be named \"on\"", name.pos)
+	}
+	if _, err := p.expect(tokenName, "on"); err != nil {
+		return nil, err
+	}
+	typeCondition, err := p.expect(tokenName, "")
+	if err != nil {
+		return nil, err
+	}
+
+	fragment := map[string]interface{}{"name": name.value, "type_condition": typeCondition.value}
+	directives, err := p.directives()
+	if err != nil {
+		return nil, err
+	}
+	if len(directives) > 0 {
+		fragment["directives"] = directives
+	}
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	fragment["selections"] = selections
+	return fragment, nil
+}
+
+func (p *parser) selectionSet() ([]interface{}, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	if _, err := p.expect(tokenPunct, "{"); err != nil {
+		return nil, err
+	}
+	selections := []interface{}{}
+	for !p.at(tokenPunct, "}") {
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	p.next()
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("graphql syntax error: empty selection set")
+	}
+	return selections, nil
+}
+
+func (p *parser) selection() (map[string]interface{}, error) {
+	if p.at(tokenPunct, "...") {
+		p.next()
+		if p.at(tokenName, "") && !p.at(tokenName, "on") {
+			spread := map[string]interface{}{"kind": "fragment_spread", "name": p.next().value}
+			directives, err := p.directives()
+			if err != nil {
+				return nil, err
+			}
+			if len(directives) > 0 {
+				spread["directives"] = directives
+			}
+			return spread, nil
+		}
+
+		inline := map[string]interface{}{"kind": "inline_fragment"}
+		if p.at(tokenName, "on") {
+			p.next()
+			typeCondition, err := p.expect(tokenName, "")
+			if err != nil {
+				return nil, err
+			}
+			inline["type_condition"] = typeCondition.value
+		}
+		directives, err := p.directives()
+		if err != nil {
+			return nil, err
+		}
+		if len(directives) > 0 {
+			inline["directives"] = directives
+		}
+		selections, err := p.selectionSet()
+		if err != nil {
+			return nil, err
+		}
+		inline["selections"] = selections
+		return inline, nil
+	}
+
+	name, err := p.expect(tokenName, "")
+	if err != nil {
+		return nil, err
+	}
+	field := map[string]interface{}{"kind": "field", "name": name.value}
+	if p.at(tokenPunct, ":") {
+		p.next()
+		actual, err := p.expect(tokenName, "")
+		if err != nil {
+			return nil, err
+		}
+		field["alias"] = name.value
+		field["name"] = actual.value
+	}
+
+	if p.at(tokenPunct, "(") {
+		arguments, err := p.arguments(false)
+		if err != nil {
+			return nil, err
+		}
+		field["arguments"] = arguments
+	}
+	directives, err := p.directives()
+	if err != nil {
+		return nil, err
+	}
+	if len(directives) > 0 {
+		field["directives"] = directives
+	}
+	if p.at(tokenPunct, "{") {
+		selections, err := p.selectionSet()
+		if err != nil {
+			return nil, err
+		}
+		field["selections"] = selections
+	}
+	return field, nil
+}
+
+func (p *parser) arguments(constant bool) (map[string]interface{}, error) {
+	p.next()
+	arguments := make(map[string]interface{})
+	for !p.at(tokenPunct, ")") {
+		name, err := p.expect(tokenName, "")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenPunct, ":"); err != nil {
+			return nil, err
+		}
+		value, err := p.value(constant)
+		if err != nil {
+			return nil, err
+		}
+		arguments[name.value] = value
+	}
+	p.next()
+	if len(arguments) == 0 {
+		return nil, fmt.Errorf("graphql syntax error: empty argument list")
+	}
+	return arguments, nil
+}
+
+func (p *parser) directives() ([]interface{}, error) {
+	var directives []interface{}
+	for p.at(tokenPunct, "@") {
+		p.next()
+		name, err := p.expect(tokenName, "")
+		if err != nil {
+			return nil, err
+		}
+		directive := map[string]interface{}{"name": name.value}
+		if p.at(tokenPunct, "(") {
+			arguments, err := p.arguments(false)
+			if err != nil {
+				return nil, err
+			}
+			directive["arguments"] = arguments
+		}
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+// value parses an input value. Variables become {"variable": name} and enum
+// values are rendered by enumValue; constant values may not reference
+// variables.
+func (p *parser) value(constant bool) (interface{}, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	token := p.peek()
+	switch token.kind {
+	case tokenInt, tokenFloat:
+		p.next()
+		return json.Number(token.value), nil
+	case tokenString:
+		p.next()
+		return token.value, nil
+	case tokenName:
+		p.next()
+		switch token.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		if p.enumValue != nil {
+			return p.enumValue(token.value), nil
+		}
+		return token.value, nil
+	case tokenPunct:
+		switch token.value {
+		case "$":
+			if constant {
+				return nil, fmt.Errorf("graphql syntax error at offset %d: variable in constant value", token.pos)
+			}
+			p.next()
+			name, err := p.expect(tokenName, "")
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"variable": name.value}, nil
+		case "[":
+			p.next()
+			list := []interface{}{}
+			for !p.at(tokenPunct, "]") {
+				if p.at(tokenEOF, "") {
+					return nil, p.unexpected()
+				}
+				item, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, item)
+			}
+			p.next()
+			return list, nil
+		case "{":
+			p.next()
+			object := make(map[string]interface{})
+			for !p.at(tokenPunct, "}") {
+				name, err := p.expect(tokenName, "")
+				if err != nil {
+					return nil, err
+				}
+				if _, err := p.expect(tokenPunct, ":"); err != nil {
+					return nil, err
+				}
+				item, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				object[name.value] = item
+			}
+			p.next()
+			return object, nil
+		}
+	}
+	return nil, p.unexpected()
+}
+
+// Helper functions
+
+func lex(source string) ([]lexToken, error) {
+	var tokens []lexToken
+	i := 0
+	for {
+		if len(tokens) > MaxTokens {
+			return nil, fmt.Errorf("graphql document exceeds %d tokens", MaxTokens)
+		}
+
+		// Whitespace, commas, byte order marks and comments are insignificant
+		for i < len(source) {
+			switch {
+			case source[i] == ' ' || source[i] == '\t' || source[i] == '\n' || source[i] == '\r' || source[i] == ',':
+				i++
+				continue
+			case strings.HasPrefix(source[i:], "\uFEFF"):
+				i += len("\uFEFF")
+				continue
+			case source[i] == '#':
+				for i < len(source) && source[i] != '\n' && source[i] != '\r' {
+					i++
+				}
+				continue
+			}
+			break
+		}
+		if i >= len(source) {
+			return append(tokens, lexToken{kind: tokenEOF, pos: i}), nil
+		}
+
+		start := i
+		c := source[i]
+		switch {
+		case strings.HasPrefix(source[i:], "..."):
+			tokens = append(tokens, lexToken{kind: tokenPunct, value: "...", pos: start})
+			i += 3
+		case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+			tokens = append(tokens, lexToken{kind: tokenPunct, value: string(c), pos: start})
+			i++
+		case c == '_' || isASCIILetter(c):
+			for i < len(source) && (source[i] == '_' || isASCIILetter(source[i]) || isASCIIDigit(source[i])) {
+				i++
+			}
+			tokens = append(tokens, lexToken{kind: tokenName, value: source[start:i], pos: start})
+		case c == '-' || isASCIIDigit(c):
+			kind := tokenInt
+			if c == '-' {
+				i++
+			}
+			digits := i
+			for i < len(source) && isASCIIDigit(source[i]) {
+				i++
+			}
+			if i == digits {
+				return nil, fmt.Errorf("graphql syntax error at offset %d: invalid number", start)
+			}
+			if i < len(source) && source[i] == '.' {
+				kind = tokenFloat
+				i++
+				fraction := i
+				for i < len(source) && isASCIIDigit(source[i]) {
+					i++
+				}
+				if i == fraction {
+					return nil, fmt.Errorf("graphql syntax error at offset %d: invalid number", start)
+				}
+			}
+			if i < len(source) && (source[i] == 'e' || source[i] == 'E') {
+				kind = tokenFloat
+				i++
+				if i < len(source) && (source[i] == '+' || source[i] == '-') {
+					i++
+				}
+				exponent := i
+				for i < len(source) && isASCIIDigit(source[i]) {
+					i++
+				}
+				if i == exponent {
+					return nil, fmt.Errorf("graphql syntax error at offset %d: invalid number", start)
+				}
+			}
+			tokens = append(tokens, lexToken{kind: kind, value: source[start:i], pos: start})
+		case strings.HasPrefix(source[i:], `"""`):
+			end := i + 3
+			for {
+				next := strings.Index(source[end:], `"""`)
+				if next < 0 {
+					return nil, fmt.Errorf("graphql syntax error at offset %d: unterminated block string", start)
+				}
+				end += next
+				if source[end-1] != '\\' {
+					break
+				}
+				end += 3
+			}
+			value := strings.ReplaceAll(source[i+3:end], `\"""`, `"""`)
+			tokens = append(tokens, lexToken{kind: tokenString, value: value, pos: start})
+			i = end + 3
+		case c == '"':
+			i++
+			for i < len(source) && source[i] != '"' {
+				if source[i] == '\n' || source[i] == '\r' {
+					return nil, fmt.Errorf("graphql syntax error at offset %d: unterminated string", start)
+				}
+				if source[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(source) {
+				return nil, fmt.Errorf("graphql syntax error at offset %d: unterminated string", start)
+			}
+			i++
+			// GraphQL string escapes are a subset of JSON's
+			var value string
+			if err := json.Unmarshal([]byte(source[start:i]), &value); err != nil {
+				return nil, fmt.Errorf("graphql syntax error at offset %d: invalid string", start)
+			}
+			tokens = append(tokens, lexToken{kind: tokenString, value: value, pos: start})
+		default:
+			return nil, fmt.Errorf("graphql syntax error at offset %d: unexpected character %q", start, c)
+		}
+	}
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isASCIIDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
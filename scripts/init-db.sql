@@ -6,24 +6,15 @@ CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 CREATE EXTENSION IF NOT EXISTS "pgcrypto";
 
 -- Create schemas
-CREATE SCHEMA IF NOT EXISTS api_discovery;
+CREATE SCHEMA IF NOT EXISTS scopeapi;
 CREATE SCHEMA IF NOT EXISTS threat_detection;
 CREATE SCHEMA IF NOT EXISTS data_protection;
 CREATE SCHEMA IF NOT EXISTS attack_blocking;
 CREATE SCHEMA IF NOT EXISTS gateway_integration;
 CREATE SCHEMA IF NOT EXISTS audit;
 
--- Create basic tables for API Discovery
-CREATE TABLE IF NOT EXISTS api_discovery.endpoints (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    url VARCHAR(500) NOT NULL,
-    method VARCHAR(10) NOT NULL,
-    service_name VARCHAR(100),
-    discovered_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-    last_seen TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
-    is_active BOOLEAN DEFAULT true,
-    metadata JSONB
-);
+-- API Discovery tables live in the scopeapi schema and are created by the
+-- service's own migrations (services/api-discovery/migrations) at startup
 
 -- Create basic tables for Threat Detection
 CREATE TABLE IF NOT EXISTS threat_detection.threats (
@@ -82,8 +73,6 @@ CREATE TABLE IF NOT EXISTS audit.logs (
 );
 
 -- Create indexes for better performance
-CREATE INDEX IF NOT EXISTS idx_endpoints_url ON api_discovery.endpoints(url);
-CREATE INDEX IF NOT EXISTS idx_endpoints_service ON api_discovery.endpoints(service_name);
 CREATE INDEX IF NOT EXISTS idx_threats_status ON threat_detection.threats(status);
 CREATE INDEX IF NOT EXISTS idx_threats_severity ON threat_detection.threats(severity);
 CREATE INDEX IF NOT EXISTS idx_threats_detected_at ON threat_detection.threats(detected_at);
@@ -93,12 +82,6 @@ CREATE INDEX IF NOT EXISTS idx_audit_timestamp ON audit.logs(timestamp);
 CREATE INDEX IF NOT EXISTS idx_audit_service ON audit.logs(service_name);
 
 -- Insert some sample data
-INSERT INTO api_discovery.endpoints (url, method, service_name) VALUES
-    ('/api/v1/health', 'GET', 'health-check'),
-    ('/api/v1/discovery', 'POST', 'api-discovery'),
-    ('/api/v1/threats', 'GET', 'threat-detection')
-ON CONFLICT DO NOTHING;
-
 INSERT INTO threat_detection.threats (threat_type, severity, source_ip, target_endpoint) VALUES
     ('SQL_INJECTION', 'HIGH', '192.168.1.100', '/api/v1/users'),
     ('XSS_ATTACK', 'MEDIUM', '10.0.0.50', '/api/v1/comments')
@@ -110,14 +93,14 @@ INSERT INTO attack_blocking.blocking_rules (rule_name, rule_type, conditions, ac
 ON CONFLICT DO NOTHING;
 
 -- Grant permissions to scopeapi user
-GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA api_discovery TO scopeapi;
+GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA scopeapi TO scopeapi;
 GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA threat_detection TO scopeapi;
 GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA data_protection TO scopeapi;
 GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA attack_blocking TO scopeapi;
 GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA gateway_integration TO scopeapi;
 GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA audit TO scopeapi;
 
-GRANT USAGE ON SCHEMA api_discovery TO scopeapi;
+GRANT USAGE, CREATE ON SCHEMA scopeapi TO scopeapi;
 GRANT USAGE ON SCHEMA threat_detection TO scopeapi;
 GRANT USAGE ON SCHEMA data_protection TO scopeapi;
 GRANT USAGE ON SCHEMA attack_blocking TO scopeapi;
@@ -142,6 +125,6 @@ CREATE TRIGGER update_gateway_integration_updated_at
 DO $$
 BEGIN
     RAISE NOTICE 'ScopeAPI database initialization completed successfully!';
-    RAISE NOTICE 'Created schemas: api_discovery, threat_detection, data_protection, attack_blocking, gateway_integration, audit';
+    RAISE NOTICE 'Created schemas: scopeapi, threat_detection, data_protection, attack_blocking, gateway_integration, audit';
     RAISE NOTICE 'Sample data inserted for testing';
 END $$; 
\ No newline at end of file
@@ -220,14 +220,13 @@ create_test_data() {
         return 0
     fi
     
-    # Insert test endpoints (only if not in basic mode)
+    # Insert test threats (only if not in basic mode). API Discovery creates
+    # its scopeapi tables through its own migrations when it starts
     if psql -h "$DB_HOST" -p "$DB_PORT" -U "$DB_USER" -d "$DB_NAME" -c "
-    INSERT INTO api_discovery.endpoints (url, method, service_name) VALUES
-    ('/api/v1/users', 'GET', 'user-service'),
-    ('/api/v1/users', 'POST', 'user-service'),
-    ('/api/v1/auth/login', 'POST', 'auth-service'),
-    ('/api/v1/health', 'GET', 'health-check')
-    ON CONFLICT (url, method) DO NOTHING;
+    INSERT INTO threat_detection.threats (threat_type, severity, source_ip, target_endpoint) VALUES
+    ('SQL_INJECTION', 'HIGH', '192.168.1.100', '/api/v1/users'),
+    ('BRUTE_FORCE', 'MEDIUM', '10.0.0.50', '/api/v1/auth/login')
+    ON CONFLICT DO NOTHING;
     " >/dev/null 2>&1; then
         print_status 0 "Test data created successfully"
     else
@@ -258,7 +257,7 @@ validate_database() {
     
     # Test schema and tables (only if not in basic mode)
     print_info "Testing database schema..."
-    if psql -h "$DB_HOST" -p "$DB_PORT" -U "$DB_USER" -d "$DB_NAME" -c "SELECT COUNT(*) FROM api_discovery.endpoints;" >/dev/null 2>&1; then
+    if psql -h "$DB_HOST" -p "$DB_PORT" -U "$DB_USER" -d "$DB_NAME" -c "SELECT 'scopeapi'::regnamespace, COUNT(*) FROM threat_detection.threats;" >/dev/null 2>&1; then
         print_status 0 "Database schema is valid"
     else
         print_status 1 "Database schema validation failed"